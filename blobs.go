@@ -29,6 +29,10 @@ var (
 	// ErrBlobInvalidLength returned when the blob has an expected length on
 	// commit, meaning mismatched with the descriptor or an invalid value.
 	ErrBlobInvalidLength = errors.New("blob invalid length")
+
+	// ErrBlobCorrupted returned when the content of a blob read from storage
+	// does not match its digest.
+	ErrBlobCorrupted = errors.New("blob corrupted")
 )
 
 // ErrBlobInvalidDigest returned when digest check fails.
@@ -42,6 +46,18 @@ func (err ErrBlobInvalidDigest) Error() string {
 		err.Digest, err.Reason)
 }
 
+// ErrBlobUploadRangeInvalid returned when data written to an upload does not
+// start at its end, the Size of the upload.
+type ErrBlobUploadRangeInvalid struct {
+	Start int64
+	Size  int64
+}
+
+func (err ErrBlobUploadRangeInvalid) Error() string {
+	return fmt.Sprintf("blob upload range invalid: data starting at %d written to an upload of %d bytes",
+		err.Start, err.Size)
+}
+
 // ErrBlobMounted returned when a blob is mounted from another repository
 // instead of initiating an upload session.
 type ErrBlobMounted struct {
@@ -80,6 +96,10 @@ type Descriptor struct {
 	// This should only be used when referring to a manifest.
 	Platform *v1.Platform `json:"platform,omitempty"`
 
+	// ArtifactType is the type of the artifact in the manifest, when the
+	// descriptor describes the referrer of another manifest.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// NOTE: Before adding a field here, please ensure that all
 	// other options have been exhausted. Much of the type relationships
 	// depend on the simplicity of this type.
@@ -189,6 +209,16 @@ type BlobIngester interface {
 	Resume(ctx context.Context, id string) (BlobWriter, error)
 }
 
+// BlobURLIngester is implemented by blob stores which can ingest blob data
+// from a remote URL, without the content passing through the client.
+// Callers should check for it with a type assertion on a BlobIngester.
+type BlobURLIngester interface {
+	// IngestFromURL streams the content at url into the blob store,
+	// verifying that it matches the expected digest. If a blob with the
+	// expected digest is already stored, it is linked without fetching url.
+	IngestFromURL(ctx context.Context, url string, expected digest.Digest) (Descriptor, error)
+}
+
 // BlobCreateOption is a general extensible function argument for blob creation
 // methods. A BlobIngester may choose to honor any or none of the given
 // BlobCreateOptions, which can be specific to the implementation of the
@@ -208,6 +238,12 @@ type CreateOptions struct {
 		// Blob access check will be skipped if set.
 		Stat *Descriptor
 	}
+
+	// Progress, if set, is called after each write to the blob with the
+	// number of bytes written so far and the expected size of the blob, or
+	// -1 if unknown. It runs synchronously in the writing goroutine, and
+	// must return quickly.
+	Progress func(written, total int64)
 }
 
 // BlobWriter provides a handle for inserting data into a blob store.
@@ -0,0 +1,79 @@
+package distribution
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDescriptorJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		desc     Descriptor
+		expected string
+		oci      bool
+	}{
+		{
+			name: "full",
+			desc: Descriptor{
+				MediaType:   v1.MediaTypeImageManifest,
+				Digest:      digest.FromString("manifest"),
+				Size:        7682,
+				URLs:        []string{"https://example.com/manifest"},
+				Annotations: map[string]string{"org.opencontainers.image.title": "manifest"},
+				Platform:    &v1.Platform{Architecture: "arm64", OS: "linux", Variant: "v8"},
+			},
+			expected: `{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + digest.FromString("manifest").String() + `","size":7682,"urls":["https://example.com/manifest"],"annotations":{"org.opencontainers.image.title":"manifest"},"platform":{"architecture":"arm64","os":"linux","variant":"v8"}}`,
+			oci:      true,
+		},
+		{
+			// Empty fields are omitted rather than null or zero, as in the
+			// events of tag deletions. Manifests marshal the required
+			// fields of their descriptors even when zero.
+			name:     "empty",
+			desc:     Descriptor{URLs: []string{}},
+			expected: `{}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := json.Marshal(tc.desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(p) != tc.expected {
+				t.Fatalf("unexpected json:\n%s\n!=\n%s", p, tc.expected)
+			}
+
+			// A complete descriptor must round trip through the OCI
+			// descriptor type without losing any fields.
+			if tc.oci {
+				var ociDesc v1.Descriptor
+				if err := json.Unmarshal(p, &ociDesc); err != nil {
+					t.Fatal(err)
+				}
+				ociJSON, err := json.Marshal(ociDesc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(ociJSON) != tc.expected {
+					t.Fatalf("json does not match OCI descriptor:\n%s\n!=\n%s", ociJSON, tc.expected)
+				}
+			}
+
+			var roundTripped Descriptor
+			if err := json.Unmarshal(p, &roundTripped); err != nil {
+				t.Fatal(err)
+			}
+			expected := tc.desc
+			if len(expected.URLs) == 0 {
+				expected.URLs = nil
+			}
+			if !reflect.DeepEqual(roundTripped, expected) {
+				t.Fatalf("descriptor did not round trip: %#v != %#v", roundTripped, expected)
+			}
+		})
+	}
+}
@@ -42,6 +42,9 @@ type Configuration struct {
 		// Hooks allows users to configure the log hooks, to enabling the
 		// sequent handling behavior, when defined levels of log message emit.
 		Hooks []LogHook `yaml:"hooks,omitempty"`
+
+		// Sampling drops part of the repeated log lines.
+		Sampling LogSampling `yaml:"sampling,omitempty"`
 	}
 
 	// Loglevel is the level at which registry operations are logged.
@@ -155,7 +158,51 @@ type Configuration struct {
 			// Specifies whether the registry should disallow clients attempting
 			// to connect via http2. If set to true, only http/1.1 is supported.
 			Disabled bool `yaml:"disabled,omitempty"`
+
+			// ServerPush configures the blobs pushed along with manifests
+			// to http2 clients.
+			ServerPush struct {
+				// Enabled pushes the config and the layers of image
+				// manifests fetched by http2 clients accepting pushes.
+				Enabled bool `yaml:"enabled,omitempty"`
+
+				// MaxSize is the size of the largest blob pushed, in
+				// bytes. Defaults to 1MB.
+				MaxSize int64 `yaml:"maxsize,omitempty"`
+			} `yaml:"serverpush,omitempty"`
 		} `yaml:"http2,omitempty"`
+
+		// BlobBatch configures the batched blob existence checks.
+		BlobBatch struct {
+			// MaxSize is the largest number of digests checked by a
+			// single request. Defaults to 100.
+			MaxSize int `yaml:"maxsize,omitempty"`
+		} `yaml:"blobbatch,omitempty"`
+
+		// BlobImport configures the import of blobs from URLs.
+		BlobImport BlobImport `yaml:"blobimport,omitempty"`
+
+		// RateLimit configures the rate limits of the requests, by
+		// category of endpoints.
+		RateLimit RateLimit `yaml:"ratelimit,omitempty"`
+
+		// UI configures the serving of the static files of a web interface.
+		UI struct {
+			// Enabled serves the files of Dir under Prefix.
+			Enabled bool `yaml:"enabled,omitempty"`
+
+			// Dir is the directory holding the files of the web interface.
+			Dir string `yaml:"dir,omitempty"`
+
+			// Prefix is the path the web interface is served under. It
+			// must not hold the routes of the API. Defaults to /ui.
+			Prefix string `yaml:"prefix,omitempty"`
+
+			// IndexFallback serves index.html for the paths under Prefix
+			// which are not files, for web interfaces routing on the
+			// client side.
+			IndexFallback bool `yaml:"indexfallback,omitempty"`
+		} `yaml:"ui,omitempty"`
 	} `yaml:"http,omitempty"`
 
 	// Notifications specifies configuration about various endpoint to which
@@ -201,6 +248,14 @@ type Configuration struct {
 
 	Proxy Proxy `yaml:"proxy,omitempty"`
 
+	// CDN configures redirection of blob downloads to a content delivery
+	// network.
+	CDN CDN `yaml:"cdn,omitempty"`
+
+	// Replication configures how content pushed by peer registries is
+	// accepted.
+	Replication Replication `yaml:"replication,omitempty"`
+
 	// Compatibility is used for configurations of working with older or deprecated features.
 	Compatibility struct {
 		// Schema1 configures how schema1 manifests will be handled
@@ -211,6 +266,10 @@ type Configuration struct {
 			// Enabled determines if schema1 manifests should be pullable
 			Enabled bool `yaml:"enabled,omitempty"`
 		} `yaml:"schema1,omitempty"`
+		// DowngradeOCIToSchema2 serves the OCI image manifests fetched by
+		// tag as schema2 manifests to clients which do not accept OCI
+		// manifests.
+		DowngradeOCIToSchema2 bool `yaml:"downgradeocitoschema2,omitempty"`
 	} `yaml:"compatibility,omitempty"`
 
 	// Validation configures validation options for the registry.
@@ -222,6 +281,9 @@ type Configuration struct {
 		Disabled bool `yaml:"disabled,omitempty"`
 		// Manifests configures manifest validation.
 		Manifests struct {
+			// Enabled rejects the pushed manifests which do not comply
+			// with the constraints of their schema.
+			Enabled bool `yaml:"enabled,omitempty"`
 			// URLs configures validation for URLs in pushed manifests.
 			URLs struct {
 				// Allow specifies regular expressions (https://godoc.org/regexp/syntax)
@@ -244,8 +306,68 @@ type Configuration struct {
 			// manifests. When non-empty, the registry will enforce
 			// the class in authorized resources.
 			Classes []string `yaml:"classes"`
+
+			// NamingPolicy restricts the names of the repositories
+			// manifests are pushed to.
+			NamingPolicy struct {
+				// Pattern is a regular expression
+				// (https://godoc.org/regexp/syntax) which the names of
+				// the repositories pushed to must match.
+				Pattern string `yaml:"pattern,omitempty"`
+
+				// DenyMessage replaces the message of the error
+				// returned for the names not matching Pattern.
+				DenyMessage string `yaml:"denymessage,omitempty"`
+			} `yaml:"namingpolicy,omitempty"`
 		} `yaml:"repository,omitempty"`
 	} `yaml:"policy,omitempty"`
+
+	// Scanning configures the vulnerability scanning of pushed images.
+	Scanning struct {
+		// ExemptionSigningKey is the path of the PEM encoded public key which
+		// must have signed the CVE exemptions carried by manifests.
+		ExemptionSigningKey string `yaml:"exemptionsigningkey,omitempty"`
+	} `yaml:"scanning,omitempty"`
+
+	// Transparency configures the recording of the pushed manifests in a
+	// Rekor transparency log.
+	Transparency Transparency `yaml:"transparency,omitempty"`
+
+	// Attestations configures the serving of the attestations attached to
+	// manifests.
+	Attestations struct {
+		// BundleCacheTTL is how long the bundles of the attestations of
+		// manifests are cached. Defaults to one minute. A negative value
+		// disables the cache.
+		BundleCacheTTL time.Duration `yaml:"bundlecachettl,omitempty"`
+	} `yaml:"attestations,omitempty"`
+
+	// Archive configures the archiving of repositories to cold storage.
+	Archive struct {
+		// Storage configures the cold storage driver the archived
+		// repositories are copied to. Archiving is disabled if unset.
+		Storage Storage `yaml:"storage,omitempty"`
+	} `yaml:"archive,omitempty"`
+
+	// Config configures how the registry handles its configuration file.
+	Config struct {
+		// WatchFile reloads the configuration file whenever it changes, and
+		// applies the parameters which can be changed at runtime.
+		WatchFile bool `yaml:"watchfile,omitempty"`
+		// WatchDebounce is how long the file must remain unchanged before
+		// it is reloaded, so that successive writes trigger a single
+		// reload. Defaults to 500ms.
+		WatchDebounce time.Duration `yaml:"watchdebounce,omitempty"`
+	} `yaml:"config,omitempty"`
+
+	// GracefulShutdown configures how the registry stops when it receives
+	// SIGTERM.
+	GracefulShutdown struct {
+		// Timeout bounds the time spent completing in-flight requests and
+		// flushing pending notifications. It takes precedence over
+		// http.draintimeout.
+		Timeout time.Duration `yaml:"timeout,omitempty"`
+	} `yaml:"gracefulshutdown,omitempty"`
 }
 
 // LogHook is composed of hook Level and Type.
@@ -266,6 +388,99 @@ type LogHook struct {
 	MailOptions MailOptions `yaml:"options,omitempty"`
 }
 
+// RateLimit configures token buckets limiting the rate of the requests to
+// the registry, one per category of endpoints. Categories without a rate are
+// not limited.
+type RateLimit struct {
+	// Push limits the requests writing to repositories, such as blob
+	// uploads and manifest pushes.
+	Push RateLimitBucket `yaml:"push,omitempty"`
+
+	// Pull limits the requests reading from repositories, such as
+	// manifest and blob fetches.
+	Pull RateLimitBucket `yaml:"pull,omitempty"`
+
+	// Catalog limits the requests listing the repositories.
+	Catalog RateLimitBucket `yaml:"catalog,omitempty"`
+}
+
+// RateLimitBucket configures the token bucket of a category of endpoints.
+type RateLimitBucket struct {
+	// RPS is the number of requests per second allowed over time. Zero
+	// places no limit.
+	RPS float64 `yaml:"rps,omitempty"`
+
+	// Burst is the number of requests allowed at once. Defaults to RPS,
+	// rounded up.
+	Burst int `yaml:"burst,omitempty"`
+}
+
+// BlobImport configures the import of blobs which the registry fetches from
+// URLs, such as presigned URLs or the URLs of cloud storage objects, rather
+// than clients uploading them.
+type BlobImport struct {
+	// Enabled enables the import of blobs.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// AllowedURLs lists the prefixes of the URLs blobs may be imported
+	// from, besides those of Credentials.
+	AllowedURLs []string `yaml:"allowedurls,omitempty"`
+
+	// MaxSize is the size of the largest blob imported, in bytes. Zero
+	// places no limit.
+	MaxSize int64 `yaml:"maxsize,omitempty"`
+
+	// Credentials lists the credentials of the URLs blobs are imported
+	// from, such as those of other accounts.
+	Credentials []ImportCredentials `yaml:"credentials,omitempty"`
+}
+
+// ImportCredentials are the credentials used to import blobs from the URLs
+// starting with URL. Headers are added to the requests, and s3:// URLs are
+// signed with the AWS keys.
+type ImportCredentials struct {
+	// URL is the prefix of the URLs the credentials are used for.
+	URL string `yaml:"url"`
+
+	// Headers are added to the requests fetching the blobs.
+	Headers http.Header `yaml:"headers,omitempty"`
+
+	// AccessKey, SecretKey and SessionToken sign the requests to s3://
+	// URLs.
+	AccessKey    string `yaml:"accesskey,omitempty"`
+	SecretKey    string `yaml:"secretkey,omitempty"`
+	SessionToken string `yaml:"sessiontoken,omitempty"`
+
+	// Region is the region of the buckets of s3:// URLs. Defaults to
+	// us-east-1.
+	Region string `yaml:"region,omitempty"`
+
+	// Endpoint is the endpoint of s3:// URLs, for S3 compatible storage.
+	// Defaults to the endpoint of Region.
+	Endpoint string `yaml:"endpoint,omitempty"`
+}
+
+// LogSampling configures the sampling of log lines, which limits the number
+// of identical lines logged every second. Lines logged for a request are
+// identical when they have the same method, path and status, other lines
+// when they have the same level and message.
+type LogSampling struct {
+	// Enabled enables the sampling of log lines.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Initial is the number of identical lines logged every second before
+	// sampling them, 100 by default.
+	Initial int `yaml:"initial,omitempty"`
+
+	// Thereafter logs one line in every Thereafter identical lines past the
+	// Initial ones, 10 by default.
+	Thereafter int `yaml:"thereafter,omitempty"`
+
+	// Exclude lists regular expressions of the lines which are never
+	// sampled, matched against their message and the names of their fields.
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
 // MailOptions provides the configuration sections to user, for specific handler.
 type MailOptions struct {
 	SMTP struct {
@@ -348,6 +563,12 @@ type Health struct {
 		// Threshold is the number of times a check must fail to trigger an
 		// unhealthy state
 		Threshold int `yaml:"threshold,omitempty"`
+		// ProbeWrite makes the check write a probe file, read it back and
+		// delete it, rather than only stat the storage root
+		ProbeWrite bool `yaml:"probewrite,omitempty"`
+		// Path is the path of the probe file, which implies ProbeWrite. It
+		// defaults to a path of its own for each registry instance.
+		Path string `yaml:"path,omitempty"`
 	} `yaml:"storagedriver,omitempty"`
 }
 
@@ -426,6 +647,20 @@ func (storage Storage) Type() string {
 			// allow configuration of delete
 		case "redirect":
 			// allow configuration of redirect
+		case "manifests":
+			// allow configuration of manifest storage
+		case "singleflight":
+			// allow configuration of blob request deduplication
+		case "shard":
+			// allow configuration of storage sharding
+		case "tags":
+			// allow configuration of tag matching
+		case "verifyonread":
+			// allow configuration of blob verification
+		case "blobs":
+			// allow configuration of blob responses
+		case "tracing":
+			// allow configuration of storage tracing
 		default:
 			storageType = append(storageType, k)
 		}
@@ -467,6 +702,20 @@ func (storage *Storage) UnmarshalYAML(unmarshal func(interface{}) error) error {
 					// allow configuration of delete
 				case "redirect":
 					// allow configuration of redirect
+				case "manifests":
+					// allow configuration of manifest storage
+				case "singleflight":
+					// allow configuration of blob request deduplication
+				case "shard":
+					// allow configuration of storage sharding
+				case "tags":
+					// allow configuration of tag matching
+				case "verifyonread":
+					// allow configuration of blob verification
+				case "blobs":
+					// allow configuration of blob responses
+				case "tracing":
+					// allow configuration of storage tracing
 				default:
 					types = append(types, k)
 				}
@@ -505,7 +754,12 @@ type Auth map[string]Parameters
 func (auth Auth) Type() string {
 	// Return only key in this map
 	for k := range auth {
-		return k
+		switch k {
+		case "anonymous":
+			// allow configuration of anonymous pulls
+		default:
+			return k
+		}
 	}
 	return ""
 }
@@ -529,13 +783,19 @@ func (auth *Auth) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		if len(m) > 1 {
 			types := make([]string, 0, len(m))
 			for k := range m {
-				types = append(types, k)
+				switch k {
+				case "anonymous":
+					// allow configuration of anonymous pulls
+				default:
+					types = append(types, k)
+				}
 			}
 
 			// TODO(stevvooe): May want to change this slightly for
 			// authorization to allow multiple challenges.
-			return fmt.Errorf("must provide exactly one type. Provided: %v", types)
-
+			if len(types) > 1 {
+				return fmt.Errorf("must provide exactly one type. Provided: %v", types)
+			}
 		}
 		*auth = m
 		return nil
@@ -553,7 +813,7 @@ func (auth *Auth) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 // MarshalYAML implements the yaml.Marshaler interface
 func (auth Auth) MarshalYAML() (interface{}, error) {
-	if auth.Parameters() == nil {
+	if len(auth) == 1 && auth.Type() != "" && auth.Parameters() == nil {
 		return auth.Type(), nil
 	}
 	return map[string]Parameters(auth), nil
@@ -581,6 +841,7 @@ type Endpoint struct {
 	Backoff           time.Duration `yaml:"backoff"`           // backoff duration
 	IgnoredMediaTypes []string      `yaml:"ignoredmediatypes"` // target media types to ignore
 	Ignore            Ignore        `yaml:"ignore"`            // ignore event types
+	Filter            Filter        `yaml:"filter"`            // filter events by repository and type
 }
 
 // Events configures notification events.
@@ -594,6 +855,36 @@ type Ignore struct {
 	Actions    []string `yaml:"actions"`    // ignore action types
 }
 
+// Filter configures the repositories and the actions of the events
+// propagated to an endpoint.
+type Filter struct {
+	Repositories []string `yaml:"repositories"` // glob patterns of repositories, negated by a leading "!"
+	Events       []string `yaml:"events"`       // actions of the events to propagate
+}
+
+// Transparency configures the recording of the pushed manifests in a Rekor
+// transparency log.
+type Transparency struct {
+	// Enabled records the pushed manifests in the transparency log.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// RekorURL is the URL of the Rekor instance. Defaults to the public
+	// instance of Sigstore, https://rekor.sigstore.dev.
+	RekorURL string `yaml:"rekorurl,omitempty"`
+
+	// Key is the path of the PEM encoded ECDSA or RSA private key signing the
+	// digests of the manifests.
+	Key string `yaml:"key,omitempty"`
+
+	// Certificate is the path of the PEM encoded certificate of Key,
+	// submitted with the signatures. The public key of Key is submitted
+	// when unset.
+	Certificate string `yaml:"certificate,omitempty"`
+
+	// Timeout bounds the submission of each manifest. Defaults to 10s.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
 // Reporting defines error reporting methods.
 type Reporting struct {
 	// Bugsnag configures error reporting for Bugsnag (bugsnag.com).
@@ -643,6 +934,45 @@ type Proxy struct {
 
 	// Password of the hub user
 	Password string `yaml:"password"`
+
+	// ResilientTransport enables retries and per-host circuit breaking
+	// for requests to the remote registry
+	ResilientTransport bool `yaml:"resilienttransport,omitempty"`
+}
+
+// CDN configures redirection of blob downloads to a content delivery network
+// using provider specific pre-signed URLs.
+type CDN struct {
+	// Enabled turns on CDN redirection.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// Provider is the CDN provider, either "cloudfront" or "fastly".
+	Provider string `yaml:"provider,omitempty"`
+
+	// BaseURL is the URL of the CDN distribution fronting the storage
+	// backend.
+	BaseURL string `yaml:"baseurl,omitempty"`
+
+	// SigningKey is the key used to sign URLs. For CloudFront this is a PEM
+	// encoded RSA private key, for Fastly the shared token secret.
+	SigningKey string `yaml:"signingkey,omitempty"`
+
+	// KeyPairID is the CloudFront key pair identifier.
+	KeyPairID string `yaml:"keypairid,omitempty"`
+
+	// Duration is the lifetime of signed URLs.
+	Duration time.Duration `yaml:"duration,omitempty"`
+}
+
+// Replication configures verification of requests sent by peer registries
+// replicating content into this registry.
+type Replication struct {
+	// VerifySignature requires all mutating requests to carry a valid
+	// X-Registry-Signature header computed with SigningKey.
+	VerifySignature bool `yaml:"verifysignature,omitempty"`
+
+	// SigningKey is the shared secret used to compute request signatures.
+	SigningKey string `yaml:"signingkey,omitempty"`
 }
 
 // Parse parses an input configuration yaml document into a Configuration struct
@@ -653,6 +983,14 @@ type Proxy struct {
 // Configuration.Abc may be replaced by the value of REGISTRY_ABC,
 // Configuration.Abc.Xyz may be replaced by the value of REGISTRY_ABC_XYZ, and so forth
 func Parse(rd io.Reader) (*Configuration, error) {
+	return ParseWithOverrides(rd, nil)
+}
+
+// ParseWithOverrides parses an input configuration like Parse, then applies
+// overrides on top of the file and environment. Each override has the form
+// key=value, where key is the dot-notation path of a configuration parameter
+// such as log.level or storage.s3.bucket, and value is parsed as YAML.
+func ParseWithOverrides(rd io.Reader, overrides []string) (*Configuration, error) {
 	in, err := io.ReadAll(rd)
 	if err != nil {
 		return nil, err
@@ -684,6 +1022,14 @@ func Parse(rd io.Reader) (*Configuration, error) {
 		},
 	})
 
+	for _, o := range overrides {
+		key, value, ok := strings.Cut(o, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid configuration override %q: expected key=value", o)
+		}
+		p.Override(key, value)
+	}
+
 	config := new(Configuration)
 	err = p.Parse(in, config)
 	if err != nil {
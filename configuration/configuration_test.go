@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -27,6 +28,7 @@ var configStruct = Configuration{
 		Formatter string                 `yaml:"formatter,omitempty"`
 		Fields    map[string]interface{} `yaml:"fields,omitempty"`
 		Hooks     []LogHook              `yaml:"hooks,omitempty"`
+		Sampling  LogSampling            `yaml:"sampling,omitempty"`
 	}{
 		Level:  "info",
 		Fields: map[string]interface{}{"environment": "test"},
@@ -67,6 +69,10 @@ var configStruct = Configuration{
 					MediaTypes: []string{"application/octet-stream"},
 					Actions:    []string{"pull"},
 				},
+				Filter: Filter{
+					Repositories: []string{"prod/*", "!prod/staging"},
+					Events:       []string{"push"},
+				},
 			},
 		},
 	},
@@ -99,8 +105,23 @@ var configStruct = Configuration{
 			} `yaml:"prometheus,omitempty"`
 		} `yaml:"debug,omitempty"`
 		HTTP2 struct {
-			Disabled bool `yaml:"disabled,omitempty"`
+			Disabled   bool `yaml:"disabled,omitempty"`
+			ServerPush struct {
+				Enabled bool  `yaml:"enabled,omitempty"`
+				MaxSize int64 `yaml:"maxsize,omitempty"`
+			} `yaml:"serverpush,omitempty"`
 		} `yaml:"http2,omitempty"`
+		BlobBatch struct {
+			MaxSize int `yaml:"maxsize,omitempty"`
+		} `yaml:"blobbatch,omitempty"`
+		BlobImport BlobImport `yaml:"blobimport,omitempty"`
+		RateLimit  RateLimit  `yaml:"ratelimit,omitempty"`
+		UI         struct {
+			Enabled       bool   `yaml:"enabled,omitempty"`
+			Dir           string `yaml:"dir,omitempty"`
+			Prefix        string `yaml:"prefix,omitempty"`
+			IndexFallback bool   `yaml:"indexfallback,omitempty"`
+		} `yaml:"ui,omitempty"`
 	}{
 		TLS: struct {
 			Certificate  string   `yaml:"certificate,omitempty"`
@@ -120,7 +141,11 @@ var configStruct = Configuration{
 			"X-Content-Type-Options": []string{"nosniff"},
 		},
 		HTTP2: struct {
-			Disabled bool `yaml:"disabled,omitempty"`
+			Disabled   bool `yaml:"disabled,omitempty"`
+			ServerPush struct {
+				Enabled bool  `yaml:"enabled,omitempty"`
+				MaxSize int64 `yaml:"maxsize,omitempty"`
+			} `yaml:"serverpush,omitempty"`
 		}{
 			Disabled: false,
 		},
@@ -161,6 +186,12 @@ notifications:
            - application/octet-stream
         actions:
            - pull
+      filter:
+        repositories:
+          - prod/*
+          - "!prod/staging"
+        events:
+          - push
 reporting:
   bugsnag:
     apikey: BugsnagApiKey
@@ -195,6 +226,12 @@ notifications:
            - application/octet-stream
         actions:
            - pull
+      filter:
+        repositories:
+          - prod/*
+          - "!prod/staging"
+        events:
+          - push
 http:
   headers:
     X-Content-Type-Options: [nosniff]
@@ -427,6 +464,36 @@ func (suite *ConfigSuite) TestParseEnvVarImplicitMaps(c *C) {
 	c.Assert(config, DeepEquals, suite.expectedConfig)
 }
 
+// TestParseManifestsStorageOption validates that the manifests storage
+// section is not mistaken for a storage driver.
+func (suite *ConfigSuite) TestParseManifestsStorageOption(c *C) {
+	suite.expectedConfig.Storage["manifests"] = map[string]interface{}{"compress": true}
+
+	os.Setenv("REGISTRY_STORAGE_MANIFESTS_COMPRESS", "true")
+
+	config, err := Parse(bytes.NewReader([]byte(configYamlV0_1)))
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, suite.expectedConfig)
+	c.Assert(config.Storage.Type(), Equals, "somedriver")
+}
+
+func (suite *ConfigSuite) TestParseAuthAnonymous(c *C) {
+	suite.expectedConfig.Auth["anonymous"] = Parameters{
+		"enabled":      true,
+		"repositories": []interface{}{"public/*"},
+	}
+
+	configYaml := strings.Replace(configYamlV0_1, "auth:\n", `auth:
+  anonymous:
+    enabled: true
+    repositories: ["public/*"]
+`, 1)
+	config, err := Parse(bytes.NewReader([]byte(configYaml)))
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, suite.expectedConfig)
+	c.Assert(config.Auth.Type(), Equals, "silly")
+}
+
 // TestParseEnvWrongTypeMap validates that incorrectly attempting to unmarshal a
 // string over existing map fails.
 func (suite *ConfigSuite) TestParseEnvWrongTypeMap(c *C) {
@@ -474,6 +541,183 @@ func (suite *ConfigSuite) TestParseEnvMany(c *C) {
 	c.Assert(err, IsNil)
 }
 
+// TestParseWithOverrides validates that dot-notation overrides replace
+// values from both the yaml document and the environment.
+func (suite *ConfigSuite) TestParseWithOverrides(c *C) {
+	suite.expectedConfig.Log.Level = "debug"
+	suite.expectedConfig.HTTP.Addr = ":5001"
+	suite.expectedConfig.Storage.setParameter("bool1", false)
+	suite.expectedConfig.Storage.setParameter("newparam", "some Value")
+
+	os.Setenv("REGISTRY_LOG_LEVEL", "error")
+
+	config, err := ParseWithOverrides(bytes.NewReader([]byte(configYamlV0_1)), []string{
+		"log.level=debug",
+		"http.addr=:5001",
+		"storage.somedriver.bool1=false",
+		"Storage.SomeDriver.NewParam=some Value",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, suite.expectedConfig)
+}
+
+// TestParseWithOverridesApplyInOrder validates that later overrides win.
+func (suite *ConfigSuite) TestParseWithOverridesApplyInOrder(c *C) {
+	config, err := ParseWithOverrides(bytes.NewReader([]byte(configYamlV0_1)), []string{
+		"log.level=error",
+		"log.level=warn",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(config.Log.Level, Equals, Loglevel("warn"))
+}
+
+// TestParseWithInvalidOverrides validates that overrides which do not
+// identify a configuration parameter fail the parse with a clear error.
+func (suite *ConfigSuite) TestParseWithInvalidOverrides(c *C) {
+	for _, tc := range []struct {
+		override string
+		err      string
+	}{
+		{"log.levle=debug", `invalid configuration override "log.levle": unknown key log.levle`},
+		{"nosuchsection.key=value", `invalid configuration override "nosuchsection.key": unknown key nosuchsection`},
+		{"log.level.extra=debug", `invalid configuration override "log.level.extra": log.level is not a section`},
+		{"version=0.2", `invalid configuration override "version": unknown key version`},
+		{"log..level=debug", `invalid configuration override "log..level": empty key`},
+		{"log.level", `invalid configuration override "log.level": expected key=value`},
+		{"log.hooks=somestring", `(?s)parsing configuration override log.hooks: .*`},
+	} {
+		_, err := ParseWithOverrides(bytes.NewReader([]byte(configYamlV0_1)), []string{tc.override})
+		c.Assert(err, ErrorMatches, tc.err, Commentf("override %s", tc.override))
+	}
+}
+
+// envField is a configuration field reachable from the environment, along
+// with the name of its environment variable.
+type envField struct {
+	name  string
+	index [][]int
+	typ   reflect.Type
+}
+
+// envFields lists the fields of t which can be set from the environment,
+// naming their variables after the YAML keys of the configuration file.
+// Maps and interfaces are free-form, so they are not descended into.
+func envFields(prefix string, t reflect.Type, index [][]int) []envField {
+	var fields []envField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(sf.Name)
+		}
+
+		name := prefix + "_" + strings.ToUpper(key)
+		fieldIndex := append(append([][]int{}, index...), sf.Index)
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		switch ft.Kind() {
+		case reflect.Struct:
+			fields = append(fields, envFields(name, ft, fieldIndex)...)
+		case reflect.Map, reflect.Interface:
+		default:
+			fields = append(fields, envField{name: name, index: fieldIndex, typ: sf.Type})
+		}
+	}
+	return fields
+}
+
+// fieldByIndexPath returns the field of v at index, dereferencing pointers.
+func fieldByIndexPath(v reflect.Value, index [][]int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByIndex(i)
+	}
+	return v
+}
+
+// TestParseEnvAllFields validates that every configuration field outside of
+// free-form sections can be set through a REGISTRY_<SECTION>_<KEY>
+// environment variable named after the keys of the configuration file.
+func (suite *ConfigSuite) TestParseEnvAllFields(c *C) {
+	base, err := Parse(bytes.NewReader([]byte(configYamlV0_1)))
+	c.Assert(err, IsNil)
+
+	fields := envFields("REGISTRY", reflect.TypeOf(Configuration{}), nil)
+	c.Assert(len(fields) > 50, Equals, true)
+
+	for _, field := range fields {
+		switch field.name {
+		case "REGISTRY_VERSION":
+			// The version cannot be overridden.
+			continue
+		case "REGISTRY_LOGLEVEL":
+			// Deprecated, and folded into log.level while parsing.
+			continue
+		}
+
+		var (
+			payload  string
+			expected reflect.Value
+		)
+		current := fieldByIndexPath(reflect.ValueOf(base).Elem(), field.index)
+		switch {
+		case field.typ == reflect.TypeOf(Loglevel("")):
+			payload, expected = "debug", reflect.ValueOf(Loglevel("debug"))
+		case field.typ.Kind() == reflect.String:
+			value := current.String() + "-env"
+			payload, expected = value, reflect.ValueOf(value).Convert(field.typ)
+		case field.typ.Kind() == reflect.Bool:
+			value := !(current.IsValid() && current.Bool())
+			payload, expected = strconv.FormatBool(value), reflect.ValueOf(value)
+		case field.typ.Kind() >= reflect.Int && field.typ.Kind() <= reflect.Int64:
+			var value int64 = 42
+			if current.IsValid() {
+				value += current.Int()
+			}
+			payload, expected = strconv.FormatInt(value, 10), reflect.ValueOf(value).Convert(field.typ)
+		case field.typ.Kind() >= reflect.Uint && field.typ.Kind() <= reflect.Uint64:
+			var value uint64 = 42
+			if current.IsValid() {
+				value += current.Uint()
+			}
+			payload, expected = strconv.FormatUint(value, 10), reflect.ValueOf(value).Convert(field.typ)
+		case field.typ.Kind() == reflect.Float32 || field.typ.Kind() == reflect.Float64:
+			value := 4.5
+			if current.IsValid() {
+				value += current.Float()
+			}
+			payload, expected = strconv.FormatFloat(value, 'f', -1, 64), reflect.ValueOf(value).Convert(field.typ)
+		case field.typ == reflect.TypeOf([]string{}):
+			// Arrays are passed as JSON.
+			payload, expected = `["a", "b"]`, reflect.ValueOf([]string{"a", "b"})
+		case field.typ.Kind() == reflect.Slice:
+			payload, expected = "[{}]", reflect.MakeSlice(field.typ, 1, 1)
+		default:
+			c.Fatalf("no test value for %s of type %s", field.name, field.typ)
+		}
+
+		os.Setenv(field.name, payload)
+		config, err := Parse(bytes.NewReader([]byte(configYamlV0_1)))
+		os.Unsetenv(field.name)
+		c.Assert(err, IsNil, Commentf("%s=%s", field.name, payload))
+
+		actual := fieldByIndexPath(reflect.ValueOf(config).Elem(), field.index)
+		c.Assert(actual.IsValid(), Equals, true, Commentf("%s=%s", field.name, payload))
+		c.Assert(actual.Interface(), DeepEquals, expected.Interface(), Commentf("%s=%s", field.name, payload))
+	}
+}
+
 func checkStructs(c *C, t reflect.Type, structsChecked map[string]struct{}) {
 	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Map || t.Kind() == reflect.Slice {
 		t = t.Elem()
@@ -1,6 +1,7 @@
 package configuration
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
@@ -67,6 +68,11 @@ type envVar struct {
 
 type envVars []envVar
 
+type override struct {
+	key   string
+	value string
+}
+
 func (a envVars) Len() int           { return len(a) }
 func (a envVars) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a envVars) Less(i, j int) bool { return a[i].name < a[j].name }
@@ -74,9 +80,10 @@ func (a envVars) Less(i, j int) bool { return a[i].name < a[j].name }
 // Parser can be used to parse a configuration file and environment of a defined
 // version into a unified output structure
 type Parser struct {
-	prefix  string
-	mapping map[Version]VersionedParseInfo
-	env     envVars
+	prefix    string
+	mapping   map[Version]VersionedParseInfo
+	env       envVars
+	overrides []override
 }
 
 // NewParser returns a *Parser with the given environment prefix which handles
@@ -104,6 +111,14 @@ func NewParser(prefix string, parseInfos []VersionedParseInfo) *Parser {
 	return &p
 }
 
+// Override replaces the configuration parameter identified by the dot-notation
+// key with value, parsed as YAML. Overrides are applied by Parse after the
+// environment, in the order they were added. Like environment variables, keys
+// are matched case-insensitively, so v.Abc.Xyz is identified by abc.xyz.
+func (p *Parser) Override(key, value string) {
+	p.overrides = append(p.overrides, override{key, value})
+}
+
 // Parse reads in the given []byte and environment and writes the resulting
 // configuration into the input v
 //
@@ -111,6 +126,9 @@ func NewParser(prefix string, parseInfos []VersionedParseInfo) *Parser {
 // than version, following the scheme below:
 // v.Abc may be replaced by the value of PREFIX_ABC,
 // v.Abc.Xyz may be replaced by the value of PREFIX_ABC_XYZ, and so forth
+//
+// Overrides registered with Override are applied last, and fail the parse if
+// their key does not identify a configuration parameter.
 func (p *Parser) Parse(in []byte, v interface{}) error {
 	var versionedStruct struct {
 		Version Version
@@ -143,6 +161,18 @@ func (p *Parser) Parse(in []byte, v interface{}) error {
 		}
 	}
 
+	for _, o := range p.overrides {
+		path := strings.Split(strings.ToUpper(o.key), ".")
+		if err := validateOverride(parseInfo.ParseAs, path); err != nil {
+			return fmt.Errorf("invalid configuration override %q: %v", o.key, err)
+		}
+
+		err = p.overwriteFields(parseAs, o.key, path, o.value)
+		if err != nil {
+			return fmt.Errorf("parsing configuration override %s: %v", o.key, err)
+		}
+	}
+
 	c, err := parseInfo.ConversionFunc(parseAs.Interface())
 	if err != nil {
 		return err
@@ -151,6 +181,64 @@ func (p *Parser) Parse(in []byte, v interface{}) error {
 	return nil
 }
 
+// validateOverride checks that path identifies a parameter of a configuration
+// of type t. Map keys are free-form, as are the contents of interfaces, so
+// they are only checked against the type of the map values.
+func validateOverride(t reflect.Type, path []string) error {
+	for i, elem := range path {
+		if elem == "" {
+			return errors.New("empty key")
+		}
+
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			fieldIndex, ok := fieldsByUpperCaseName(t)[elem]
+			if !ok || (i == 0 && elem == "VERSION") {
+				return fmt.Errorf("unknown key %s", strings.ToLower(strings.Join(path[:i+1], ".")))
+			}
+			t = t.Field(fieldIndex).Type
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return fmt.Errorf("%s has non-string keys", strings.ToLower(strings.Join(path[:i], ".")))
+			}
+			t = t.Elem()
+		case reflect.Interface:
+			return nil
+		default:
+			return fmt.Errorf("%s is not a section", strings.ToLower(strings.Join(path[:i], ".")))
+		}
+	}
+	return nil
+}
+
+// fieldsByUpperCaseName returns a case-insensitive index of the fields of the
+// struct type t. A field is known by both its name and its YAML key, so that
+// the environment follows the layout of the configuration file when the two
+// differ (REGISTRY_NOTIFICATIONS_EVENTS for Notifications.EventConfig).
+func fieldsByUpperCaseName(t reflect.Type) map[string]int {
+	byUpperCase := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		names := []string{sf.Name}
+		if key, _, _ := strings.Cut(sf.Tag.Get("yaml"), ","); key != "" && key != "-" {
+			names = append(names, key)
+		}
+
+		for _, name := range names {
+			upper := strings.ToUpper(name)
+			if j, present := byUpperCase[upper]; present && j != i {
+				panic(fmt.Sprintf("field name collision in configuration object: %s", sf.Name))
+			}
+			byUpperCase[upper] = i
+		}
+	}
+	return byUpperCase
+}
+
 // overwriteFields replaces configuration values with alternate values specified
 // through the environment. Precondition: an empty path slice must never be
 // passed in.
@@ -182,18 +270,7 @@ func (p *Parser) overwriteFields(v reflect.Value, fullpath string, path []string
 }
 
 func (p *Parser) overwriteStruct(v reflect.Value, fullpath string, path []string, payload string) error {
-	// Generate case-insensitive map of struct fields
-	byUpperCase := make(map[string]int)
-	for i := 0; i < v.NumField(); i++ {
-		sf := v.Type().Field(i)
-		upper := strings.ToUpper(sf.Name)
-		if _, present := byUpperCase[upper]; present {
-			panic(fmt.Sprintf("field name collision in configuration object: %s", sf.Name))
-		}
-		byUpperCase[upper] = i
-	}
-
-	fieldIndex, present := byUpperCase[path[0]]
+	fieldIndex, present := fieldsByUpperCaseName(v.Type())[path[0]]
 	if !present {
 		logrus.Warnf("Ignoring unrecognized environment variable %s", fullpath)
 		return nil
@@ -283,6 +283,13 @@ func (irw *instrumentedResponseWriter) Flush() {
 	}
 }
 
+func (irw *instrumentedResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := irw.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
 func (irw *instrumentedResponseWriter) Value(key interface{}) interface{} {
 	if keyStr, ok := key.(string); ok {
 		switch keyStr {
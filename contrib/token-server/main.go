@@ -15,6 +15,7 @@ import (
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	"github.com/distribution/distribution/v3/registry/auth"
 	_ "github.com/distribution/distribution/v3/registry/auth/htpasswd"
+	"github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
 	"github.com/docker/libtrust"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -35,6 +36,8 @@ func main() {
 
 		cert    string
 		certKey string
+
+		totpDir string
 	)
 
 	flag.StringVar(&issuer.Issuer, "issuer", "distribution-token-server", "Issuer string for token")
@@ -50,6 +53,8 @@ func main() {
 
 	flag.BoolVar(&enforceRepoClass, "enforce-class", false, "Enforce policy for single repository class")
 
+	flag.StringVar(&totpDir, "totp-dir", "", "Directory storing the TOTP secrets of the accounts, enabling TOTP")
+
 	flag.Parse()
 
 	if debug {
@@ -92,10 +97,20 @@ func main() {
 		accessController: ac,
 		refreshCache:     map[string]refreshToken{},
 	}
+	if totpDir != "" {
+		driver, err := filesystem.FromParameters(map[string]interface{}{"rootdirectory": totpDir})
+		if err != nil {
+			logrus.Fatalf("Error initializing TOTP storage: %v", err)
+		}
+		ts.totp = &totpStore{driver: driver}
+	}
 
 	router := mux.NewRouter()
 	router.Path("/token/").Methods(http.MethodGet).Handler(handlerWithContext(ctx, ts.getToken))
 	router.Path("/token/").Methods(http.MethodPost).Handler(handlerWithContext(ctx, ts.postToken))
+	if ts.totp != nil {
+		router.Path("/v2/admin/accounts/{name}/totp/enroll").Methods(http.MethodPost).Handler(handlerWithContext(ctx, ts.enrollTOTP))
+	}
 
 	if cert == "" {
 		err = http.ListenAndServe(addr, router)
@@ -161,6 +176,10 @@ type tokenServer struct {
 	issuer           *TokenIssuer
 	accessController auth.AccessController
 	refreshCache     map[string]refreshToken
+
+	// totp checks the TOTP codes of the accounts which enabled TOTP, as a
+	// second factor of their password. Nil disables TOTP.
+	totp *totpStore
 }
 
 type tokenResponse struct {
@@ -260,6 +279,12 @@ func (ts *tokenServer) getToken(ctx context.Context, w http.ResponseWriter, r *h
 	ctx = authorizedCtx
 
 	username := dcontext.GetStringValue(ctx, "auth.user.name")
+	if ts.totp != nil {
+		if err := ts.totp.check(ctx, username, params.Get("totp_code"), time.Now()); err != nil {
+			handleError(ctx, err, w)
+			return
+		}
+	}
 
 	ctx = context.WithValue(ctx, acctSubject{}, username)
 	ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(ctx, acctSubject{}))
@@ -378,6 +403,12 @@ func (ts *tokenServer) postToken(ctx context.Context, w http.ResponseWriter, r *
 			handleError(ctx, errcode.ErrorCodeUnauthorized.WithDetail("invalid credentials"), w)
 			return
 		}
+		if ts.totp != nil {
+			if err := ts.totp.check(ctx, subject, r.PostFormValue("totp_code"), time.Now()); err != nil {
+				handleError(ctx, err, w)
+				return
+			}
+		}
 	default:
 		handleError(ctx, ErrorUnsupportedValue.WithDetail("unknown grant_type value"), w)
 		return
@@ -429,3 +460,48 @@ func (ts *tokenServer) postToken(ctx context.Context, w http.ResponseWriter, r *
 
 	dcontext.GetResponseLogger(ctx).Info("post token complete")
 }
+
+type enrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+// enrollTOTP handles generating a new TOTP secret for an account, which must
+// authenticate with its password, and with a code of its current secret when
+// it already enabled TOTP.
+func (ts *tokenServer) enrollTOTP(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	ca, ok := ts.accessController.(auth.CredentialAuthenticator)
+	if !ok {
+		handleError(ctx, ErrorUnsupportedValue.WithDetail("password authentication not supported"), w)
+		return
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok || username != name {
+		handleError(ctx, errcode.ErrorCodeUnauthorized.WithDetail("invalid credentials"), w)
+		return
+	}
+	if err := ca.AuthenticateUser(username, password); err != nil {
+		handleError(ctx, errcode.ErrorCodeUnauthorized.WithDetail("invalid credentials"), w)
+		return
+	}
+
+	key, err := ts.totp.enroll(ctx, ts.issuer.Issuer, name, r.PostFormValue("totp_code"), time.Now())
+	if err != nil {
+		handleError(ctx, err, w)
+		return
+	}
+
+	ctx = context.WithValue(ctx, acctSubject{}, name)
+	ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(ctx, acctSubject{}))
+	ctx, w = dcontext.WithResponseWriter(ctx, w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollTOTPResponse{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+	})
+
+	dcontext.GetResponseLogger(ctx).Info("totp enrollment complete")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// totpPeriod is the time step of the TOTP codes, as in RFC 6238.
+	totpPeriod = 30 * time.Second
+
+	// totpSkew is the number of time steps before and after the current
+	// one whose codes are accepted, for clients with a skewed clock.
+	totpSkew = 1
+)
+
+// totpOpts are the options of the TOTP codes, the defaults of
+// authenticator apps.
+var totpOpts = totp.ValidateOpts{
+	Period:    uint(totpPeriod / time.Second),
+	Skew:      totpSkew,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// totpCounter returns the time step of t.
+func totpCounter(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// validateTOTP returns the time step whose code of secret is code, among
+// the ones accepted at now, and whether there is one. The time step is
+// needed to refuse codes already used, which totp.Validate does not tell.
+func validateTOTP(secret string, code string, now time.Time) (int64, bool) {
+	opts := hotp.ValidateOpts{Digits: totpOpts.Digits, Algorithm: totpOpts.Algorithm}
+	current := totpCounter(now)
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if ok, err := hotp.ValidateCustom(code, uint64(counter), secret, opts); err == nil && ok {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpAccount is the TOTP configuration of an account.
+type totpAccount struct {
+	// Secret is the base32 encoded TOTP secret.
+	Secret string `json:"secret"`
+
+	// LastCounter is the time step of the last code accepted, which is
+	// not accepted again.
+	LastCounter int64 `json:"lastCounter,omitempty"`
+}
+
+// totpStore stores the TOTP configuration of the accounts, at
+// /_admin/accounts/<name>/totp.json in the storage driver.
+type totpStore struct {
+	driver storagedriver.StorageDriver
+	mu     sync.Mutex
+}
+
+func (s *totpStore) path(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return "", fmt.Errorf("invalid account name %q", name)
+	}
+	return path.Join("/_admin", "accounts", name, "totp.json"), nil
+}
+
+// get returns the TOTP configuration of the account name, nil when the
+// account has not enabled TOTP.
+func (s *totpStore) get(ctx context.Context, name string) (*totpAccount, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.driver.GetContent(ctx, p)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var account totpAccount
+	if err := json.Unmarshal(content, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (s *totpStore) put(ctx context.Context, name string, account *totpAccount) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	return s.driver.PutContent(ctx, p, content)
+}
+
+// check returns an error unless the account name has not enabled TOTP, or
+// code is a valid code of the account at now which was not used before.
+func (s *totpStore) check(ctx context.Context, name string, code string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return nil
+	}
+	if code == "" {
+		return errcode.ErrorCodeUnauthorized.WithDetail("missing totp_code value")
+	}
+	counter, ok := validateTOTP(account.Secret, code, now)
+	if !ok || counter <= account.LastCounter {
+		return errcode.ErrorCodeUnauthorized.WithDetail("invalid TOTP code")
+	}
+	account.LastCounter = counter
+	return s.put(ctx, name, account)
+}
+
+// enroll generates and stores a new TOTP key for the account name of
+// issuer, and returns it. An account which already enabled TOTP must
+// provide a valid code of its current secret.
+func (s *totpStore) enroll(ctx context.Context, issuer, name string, code string, now time.Time) (*otp.Key, error) {
+	if err := s.check(ctx, name, code, now); err != nil {
+		return nil, err
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: name,
+		Period:      totpOpts.Period,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.put(ctx, name, &totpAccount{Secret: key.Secret()}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
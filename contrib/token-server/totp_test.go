@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/docker/libtrust"
+	"github.com/gorilla/mux"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// The test vectors of RFC 6238 for SHA1, truncated to 6 digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		now := time.Unix(tc.unix, 0)
+		if code := currentCode(t, secret, now); code != tc.code {
+			t.Errorf("unexpected code %s at %d, expected %s", code, tc.unix, tc.code)
+		}
+		if counter, ok := validateTOTP(secret, tc.code, now); !ok || counter != totpCounter(now) {
+			t.Errorf("expected code %s to be valid at %d", tc.code, tc.unix)
+		}
+	}
+}
+
+// currentCode returns the code of secret at now.
+func currentCode(t *testing.T, secret string, now time.Time) string {
+	code, err := totp.GenerateCodeCustom(secret, now, totpOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPStore(t *testing.T) {
+	ctx := context.Background()
+	store := &totpStore{driver: inmemory.New()}
+	now := time.Now()
+
+	if err := store.check(ctx, "alice", "", now); err != nil {
+		t.Fatalf("unexpected error for an account without TOTP: %v", err)
+	}
+
+	key, err := store.enroll(ctx, "test", "alice", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := key.Secret()
+	for _, tc := range []struct {
+		name  string
+		code  string
+		valid bool
+	}{
+		{name: "missing", code: ""},
+		{name: "invalid", code: "000000"},
+		{name: "malformed", code: "abc"},
+		{name: "expired", code: currentCode(t, secret, now.Add(-3*totpPeriod))},
+		{name: "valid", code: currentCode(t, secret, now), valid: true},
+		{name: "replayed", code: currentCode(t, secret, now)},
+		{name: "next", code: currentCode(t, secret, now.Add(totpPeriod)), valid: true},
+	} {
+		err := store.check(ctx, "alice", tc.code, now)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error checking code: %v", tc.name, err)
+		} else if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error checking code", tc.name)
+		}
+	}
+
+	if _, err := store.enroll(ctx, "test", "alice", "", now); err == nil {
+		t.Fatal("expected an error enrolling again without a code")
+	}
+	if _, err := store.enroll(ctx, "test", "../alice", "", now); err == nil {
+		t.Fatal("expected an error enrolling an invalid account name")
+	}
+}
+
+// passwordController authenticates the user alice with the password secret.
+type passwordController struct{}
+
+func (passwordController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	return nil, errors.New("unsupported")
+}
+
+func (passwordController) AuthenticateUser(username, password string) error {
+	if username != "alice" || password != "secret" {
+		return auth.ErrAuthenticationFailure
+	}
+	return nil
+}
+
+func TestPostTokenTOTP(t *testing.T) {
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &tokenServer{
+		issuer:           &TokenIssuer{Issuer: "test", SigningKey: key, Expiration: time.Minute},
+		accessController: passwordController{},
+		refreshCache:     map[string]refreshToken{},
+		totp:             &totpStore{driver: inmemory.New()},
+	}
+	ctx := dcontext.Background()
+	router := mux.NewRouter()
+	router.Path("/token/").Methods(http.MethodPost).Handler(handlerWithContext(ctx, ts.postToken))
+	router.Path("/v2/admin/accounts/{name}/totp/enroll").Methods(http.MethodPost).Handler(handlerWithContext(ctx, ts.enrollTOTP))
+
+	postToken := func(code string) int {
+		form := url.Values{
+			"grant_type": {"password"},
+			"service":    {"registry"},
+			"client_id":  {"test"},
+			"username":   {"alice"},
+			"password":   {"secret"},
+		}
+		if code != "" {
+			form.Set("totp_code", code)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/token/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if status := postToken(""); status != http.StatusOK {
+		t.Fatalf("unexpected status %d before enrolling", status)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v2/admin/accounts/bob/totp/enroll", nil)
+	req.SetBasicAuth("alice", "secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status %d enrolling another account", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v2/admin/accounts/alice/totp/enroll", nil)
+	req.SetBasicAuth("alice", "secret")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d enrolling: %s", rec.Code, rec.Body)
+	}
+	var enrolled enrollTOTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&enrolled); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enrolled.URL, "otpauth://totp/") {
+		t.Fatalf("unexpected TOTP URL %s", enrolled.URL)
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		name   string
+		code   string
+		status int
+	}{
+		{name: "missing", code: "", status: http.StatusUnauthorized},
+		{name: "invalid", code: "000000", status: http.StatusUnauthorized},
+		{name: "expired", code: currentCode(t, enrolled.Secret, now.Add(-3*totpPeriod)), status: http.StatusUnauthorized},
+		{name: "valid", code: currentCode(t, enrolled.Secret, now), status: http.StatusOK},
+	} {
+		if status := postToken(tc.code); status != tc.status {
+			t.Errorf("%s: unexpected status %d, expected %d", tc.name, status, tc.status)
+		}
+	}
+}
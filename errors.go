@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 )
@@ -20,6 +21,10 @@ var ErrManifestNotModified = errors.New("manifest not modified")
 // performed
 var ErrUnsupported = errors.New("operation unsupported")
 
+// ErrReadOnly is returned when a write is attempted on a registry in
+// read-only mode
+var ErrReadOnly = errors.New("registry is in read-only mode")
+
 // ErrSchemaV1Unsupported is returned when a client tries to upload a schema v1
 // manifest but the registry is configured to reject it
 var ErrSchemaV1Unsupported = errors.New("manifest schema v1 unsupported")
@@ -33,6 +38,47 @@ func (err ErrTagUnknown) Error() string {
 	return fmt.Sprintf("unknown tag=%s", err.Tag)
 }
 
+// ErrTagInvalid is returned when a tag name is not valid, with the reason.
+type ErrTagInvalid struct {
+	Tag    string
+	Reason string
+}
+
+func (err ErrTagInvalid) Error() string {
+	return fmt.Sprintf("invalid tag %q: %s", err.Tag, err.Reason)
+}
+
+// ErrTagConflict is returned when renaming a tag to an existing tag.
+type ErrTagConflict struct {
+	Tag         string
+	ExistingTag string
+}
+
+func (err ErrTagConflict) Error() string {
+	return fmt.Sprintf("tag %s conflicts with existing tag %s", err.Tag, err.ExistingTag)
+}
+
+// ErrTagCollision is returned when tagging with a tag which differs only in
+// case from an existing tag, while tags are case sensitive.
+type ErrTagCollision struct {
+	Tag         string
+	ExistingTag string
+}
+
+func (err ErrTagCollision) Error() string {
+	return fmt.Sprintf("tag %s collides with existing tag %s, differing only in case", err.Tag, err.ExistingTag)
+}
+
+// ErrTagLocked is returned when tagging with a tag which is locked against
+// being overwritten.
+type ErrTagLocked struct {
+	Tag string
+}
+
+func (err ErrTagLocked) Error() string {
+	return fmt.Sprintf("tag %s is locked", err.Tag)
+}
+
 // ErrRepositoryUnknown is returned if the named repository is not known by
 // the registry.
 type ErrRepositoryUnknown struct {
@@ -76,6 +122,27 @@ func (err ErrManifestUnknownRevision) Error() string {
 	return fmt.Sprintf("unknown manifest name=%s revision=%s", err.Name, err.Revision)
 }
 
+// ErrManifestDeleted is returned when a manifest revision was deleted from a
+// repository, and its deletion was recorded.
+type ErrManifestDeleted struct {
+	Name       string
+	Digest     digest.Digest
+	DeletedAt  time.Time
+	Reason     string
+	ReplacedBy digest.Digest
+}
+
+func (err ErrManifestDeleted) Error() string {
+	msg := fmt.Sprintf("manifest name=%s revision=%s deleted at %s", err.Name, err.Digest, err.DeletedAt.Format(time.RFC3339))
+	if err.Reason != "" {
+		msg += ": " + err.Reason
+	}
+	if err.ReplacedBy != "" {
+		msg += fmt.Sprintf(", replaced by %s", err.ReplacedBy)
+	}
+	return msg
+}
+
 // ErrManifestUnverified is returned when the registry is unable to verify
 // the manifest.
 type ErrManifestUnverified struct{}
@@ -107,6 +174,16 @@ func (err ErrManifestBlobUnknown) Error() string {
 	return fmt.Sprintf("unknown blob %v on manifest", err.Digest)
 }
 
+// ErrManifestInvalid is returned when a manifest does not comply with its
+// schema. Reason describes the violation.
+type ErrManifestInvalid struct {
+	Reason string
+}
+
+func (err ErrManifestInvalid) Error() string {
+	return fmt.Sprintf("invalid manifest: %s", err.Reason)
+}
+
 // ErrManifestNameInvalid should be used to denote an invalid manifest
 // name. Reason may set, indicating the cause of invalidity.
 type ErrManifestNameInvalid struct {
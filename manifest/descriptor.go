@@ -0,0 +1,31 @@
+package manifest
+
+import (
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Descriptor has the fields of distribution.Descriptor, which it converts
+// from, but always marshals the media type, digest and size, even when zero,
+// as the manifest formats require them. Manifests are marshaled with it,
+// while descriptors elsewhere, such as in events, omit the empty fields.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       digest.Digest     `json:"digest"`
+	Size         int64             `json:"size"`
+	URLs         []string          `json:"urls,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *v1.Platform      `json:"platform,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+}
+
+// Descriptors converts descs to Descriptors. The result is never nil, such
+// that required lists marshal as empty arrays rather than null.
+func Descriptors(descs []distribution.Descriptor) []Descriptor {
+	converted := make([]Descriptor, len(descs))
+	for i, desc := range descs {
+		converted[i] = Descriptor(desc)
+	}
+	return converted
+}
@@ -0,0 +1,123 @@
+package manifestlist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// IndexBuilder is a type for constructing OCI image indexes, detecting the
+// platform of each referenced manifest from its image configuration.
+type IndexBuilder struct {
+	// ms fetches the referenced manifests.
+	ms distribution.ManifestService
+
+	// bs fetches the image configurations of the referenced manifests.
+	bs distribution.BlobProvider
+
+	// manifests is a list of manifest descriptors that gets built by
+	// successive calls to AppendReference.
+	manifests []distribution.Descriptor
+}
+
+// NewImageIndexBuilder is used to build OCI image indexes. It takes a
+// ManifestService and a BlobProvider so it can read the image configuration
+// of the referenced manifests as part of the Build process.
+func NewImageIndexBuilder(ms distribution.ManifestService, bs distribution.BlobProvider) distribution.ManifestBuilder {
+	return &IndexBuilder{
+		ms: ms,
+		bs: bs,
+	}
+}
+
+// Build produces an OCI image index from the given references. The platform
+// of the references without one is set from the architecture, os and
+// variant of their image configuration.
+func (ib *IndexBuilder) Build(ctx context.Context) (distribution.Manifest, error) {
+	descriptors := make([]ManifestDescriptor, 0, len(ib.manifests))
+	for _, desc := range ib.manifests {
+		platform := desc.Platform
+		if platform == nil {
+			var err error
+			desc, platform, err = ib.detectPlatform(ctx, desc)
+			if err != nil {
+				return nil, err
+			}
+		}
+		desc.Platform = nil
+
+		descriptors = append(descriptors, ManifestDescriptor{
+			Descriptor: desc,
+			Platform: PlatformSpec{
+				Architecture: platform.Architecture,
+				OS:           platform.OS,
+				OSVersion:    platform.OSVersion,
+				OSFeatures:   platform.OSFeatures,
+				Variant:      platform.Variant,
+			},
+		})
+	}
+
+	return FromDescriptorsWithMediaType(descriptors, v1.MediaTypeImageIndex)
+}
+
+// detectPlatform returns the platform of the manifest desc from its image
+// configuration, along with desc completed with the media type and size of
+// the manifest.
+func (ib *IndexBuilder) detectPlatform(ctx context.Context, desc distribution.Descriptor) (distribution.Descriptor, *v1.Platform, error) {
+	m, err := ib.ms.Get(ctx, desc.Digest)
+	if err != nil {
+		return desc, nil, err
+	}
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return desc, nil, err
+	}
+	if desc.MediaType == "" {
+		desc.MediaType = mediaType
+	}
+	if desc.Size == 0 {
+		desc.Size = int64(len(payload))
+	}
+
+	var config *distribution.Descriptor
+	for _, ref := range m.References() {
+		if ref.MediaType == v1.MediaTypeImageConfig || ref.MediaType == schema2.MediaTypeImageConfig {
+			ref := ref
+			config = &ref
+			break
+		}
+	}
+	if config == nil {
+		return desc, nil, fmt.Errorf("manifest %s has no image configuration to detect its platform from", desc.Digest)
+	}
+
+	p, err := ib.bs.Get(ctx, config.Digest)
+	if err != nil {
+		return desc, nil, fmt.Errorf("failed to get image configuration %s of manifest %s: %v", config.Digest, desc.Digest, err)
+	}
+	var platform v1.Platform
+	if err := json.Unmarshal(p, &platform); err != nil {
+		return desc, nil, fmt.Errorf("failed to parse image configuration %s of manifest %s: %v", config.Digest, desc.Digest, err)
+	}
+	if platform.Architecture == "" || platform.OS == "" {
+		return desc, nil, fmt.Errorf("image configuration %s of manifest %s has no architecture or os", config.Digest, desc.Digest)
+	}
+	return desc, &platform, nil
+}
+
+// AppendReference adds a reference to a platform manifest to the current
+// ManifestBuilder. The platform of the descriptor is kept if set.
+func (ib *IndexBuilder) AppendReference(d distribution.Describable) error {
+	ib.manifests = append(ib.manifests, d.Descriptor())
+	return nil
+}
+
+// References returns the current references added to this builder.
+func (ib *IndexBuilder) References() []distribution.Descriptor {
+	return ib.manifests
+}
@@ -0,0 +1,170 @@
+package manifestlist
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type mockManifestService struct {
+	distribution.ManifestService
+	manifests map[digest.Digest]distribution.Manifest
+}
+
+func (ms *mockManifestService) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	if m, ok := ms.manifests[dgst]; ok {
+		return m, nil
+	}
+	return nil, distribution.ErrManifestUnknownRevision{Revision: dgst}
+}
+
+type mockBlobProvider struct {
+	distribution.BlobProvider
+	blobs map[digest.Digest][]byte
+}
+
+func (bs *mockBlobProvider) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if p, ok := bs.blobs[dgst]; ok {
+		return p, nil
+	}
+	return nil, distribution.ErrBlobUnknown
+}
+
+// putImage stores an image manifest whose configuration has the given
+// platform, and returns its descriptor.
+func putImage(t *testing.T, ms *mockManifestService, bs *mockBlobProvider, platform v1.Platform) distribution.Descriptor {
+	t.Helper()
+	config, err := json.Marshal(platform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configDigest := digest.FromBytes(config)
+	bs.blobs[configDigest] = config
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(config)),
+		},
+		Layers: []distribution.Descriptor{{
+			MediaType: v1.MediaTypeImageLayerGzip,
+			Digest:    digest.FromString(platform.Architecture),
+			Size:      1,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, err := m.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromBytes(payload)
+	ms.manifests[dgst] = m
+	return distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}
+}
+
+func TestImageIndexBuilder(t *testing.T) {
+	ctx := context.Background()
+	ms := &mockManifestService{manifests: make(map[digest.Digest]distribution.Manifest)}
+	bs := &mockBlobProvider{blobs: make(map[digest.Digest][]byte)}
+
+	amd64 := putImage(t, ms, bs, v1.Platform{Architecture: "amd64", OS: "linux"})
+	arm := putImage(t, ms, bs, v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"})
+
+	builder := NewImageIndexBuilder(ms, bs)
+	if err := builder.AppendReference(amd64); err != nil {
+		t.Fatal(err)
+	}
+	// The media type and size are completed from the manifest.
+	if err := builder.AppendReference(distribution.Descriptor{Digest: arm.Digest}); err != nil {
+		t.Fatal(err)
+	}
+	if refs := builder.References(); len(refs) != 2 || refs[0].Digest != amd64.Digest || refs[1].Digest != arm.Digest {
+		t.Fatalf("unexpected references: %v", refs)
+	}
+
+	built, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error building index: %v", err)
+	}
+	mediaType, payload, err := built.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected media type %s", mediaType)
+	}
+
+	var index DeserializedManifestList
+	if err := index.UnmarshalJSON(payload); err != nil {
+		t.Fatalf("unexpected error parsing built index: %v", err)
+	}
+	expected := []ManifestDescriptor{
+		{
+			Descriptor: amd64,
+			Platform:   PlatformSpec{Architecture: "amd64", OS: "linux"},
+		},
+		{
+			Descriptor: arm,
+			Platform:   PlatformSpec{Architecture: "arm", OS: "linux", Variant: "v7"},
+		},
+	}
+	if index.SchemaVersion != 2 || index.MediaType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected versioning of built index: %+v", index.Versioned)
+	}
+	if !reflect.DeepEqual(index.Manifests, expected) {
+		t.Fatalf("unexpected manifests of built index:\n%+v\n!=\n%+v", index.Manifests, expected)
+	}
+}
+
+func TestImageIndexBuilderPlatform(t *testing.T) {
+	ctx := context.Background()
+	ms := &mockManifestService{manifests: make(map[digest.Digest]distribution.Manifest)}
+	bs := &mockBlobProvider{blobs: make(map[digest.Digest][]byte)}
+
+	// An explicit platform is kept, and the manifest is not read.
+	desc := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    digest.FromString("windows"),
+		Size:      1,
+		Platform:  &v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763.1879"},
+	}
+	builder := NewImageIndexBuilder(ms, bs)
+	builder.AppendReference(desc)
+	built, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error building index: %v", err)
+	}
+	index := built.(*DeserializedManifestList)
+	if p := index.Manifests[0].Platform; p.OS != "windows" || p.OSVersion != "10.0.17763.1879" {
+		t.Fatalf("unexpected platform: %+v", p)
+	}
+
+	// Platforms cannot be detected from configurations without them.
+	noPlatform := putImage(t, ms, bs, v1.Platform{})
+	builder = NewImageIndexBuilder(ms, bs)
+	builder.AppendReference(noPlatform)
+	if _, err := builder.Build(ctx); err == nil {
+		t.Fatal("expected an error detecting the platform of a configuration without one")
+	}
+
+	// Nor from missing manifests.
+	builder = NewImageIndexBuilder(ms, bs)
+	builder.AppendReference(distribution.Descriptor{Digest: digest.FromString("missing")})
+	if _, err := builder.Build(ctx); err == nil {
+		t.Fatal("expected an error detecting the platform of a missing manifest")
+	}
+}
@@ -104,6 +104,11 @@ type PlatformSpec struct {
 	// Features is an optional field specifying an array of strings, each
 	// listing a required CPU feature (for example `sse4` or `aes`).
 	Features []string `json:"features,omitempty"`
+
+	// Attributes is an optional field specifying further attributes of the
+	// platform, for example `io.myco.env: prod`, by which manifests can be
+	// selected when pulling the manifest list.
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // A ManifestDescriptor references a platform-specific manifest.
@@ -180,11 +185,34 @@ func FromDescriptorsWithMediaType(descriptors []ManifestDescriptor, mediaType st
 		ManifestList: m,
 	}
 
+	mj := manifestListJSON{
+		Versioned: m.Versioned,
+		Manifests: make([]manifestDescriptorJSON, len(m.Manifests)),
+	}
+	for i, md := range m.Manifests {
+		mj.Manifests[i] = manifestDescriptorJSON{
+			Descriptor: manifest.Descriptor(md.Descriptor),
+			Platform:   md.Platform,
+		}
+	}
+
 	var err error
-	deserialized.canonical, err = json.MarshalIndent(&m, "", "   ")
+	deserialized.canonical, err = json.MarshalIndent(&mj, "", "   ")
 	return &deserialized, err
 }
 
+// manifestListJSON is the serialization of a ManifestList, with the required
+// fields of its descriptors present even when zero.
+type manifestListJSON struct {
+	manifest.Versioned
+	Manifests []manifestDescriptorJSON `json:"manifests"`
+}
+
+type manifestDescriptorJSON struct {
+	manifest.Descriptor
+	Platform PlatformSpec `json:"platform"`
+}
+
 // UnmarshalJSON populates a new ManifestList struct from JSON data.
 func (m *DeserializedManifestList) UnmarshalJSON(b []byte) error {
 	m.canonical = make([]byte, len(b))
@@ -0,0 +1,50 @@
+package ocischema
+
+import (
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// schema2LayerMediaTypes maps the media types of the OCI layers to those of
+// the schema2 layers.
+var schema2LayerMediaTypes = map[string]string{
+	v1.MediaTypeImageLayer:                     schema2.MediaTypeUncompressedLayer,
+	v1.MediaTypeImageLayerGzip:                 schema2.MediaTypeLayer,
+	v1.MediaTypeImageLayerNonDistributableGzip: schema2.MediaTypeForeignLayer,
+}
+
+// ConvertOCIToSchema2 converts an OCI image manifest to a schema2 manifest
+// referencing the same config and layers, for clients which do not support
+// OCI manifests. The annotations of the manifest are dropped, as schema2 has
+// none. Manifests which schema2 cannot represent, such as those of artifacts,
+// of zstd compressed or encrypted layers, or with a subject, are not
+// converted.
+func ConvertOCIToSchema2(m *DeserializedManifest) (*schema2.DeserializedManifest, error) {
+	if m.Subject != nil {
+		return nil, fmt.Errorf("cannot convert manifest with a subject to schema2")
+	}
+	if m.Config.MediaType != v1.MediaTypeImageConfig {
+		return nil, fmt.Errorf("cannot convert manifest with config of media type %q to schema2", m.Config.MediaType)
+	}
+
+	config := m.Config
+	config.MediaType = schema2.MediaTypeImageConfig
+	layers := make([]distribution.Descriptor, len(m.Layers))
+	for i, layer := range m.Layers {
+		mediaType, ok := schema2LayerMediaTypes[layer.MediaType]
+		if !ok {
+			return nil, fmt.Errorf("cannot convert layer %s of media type %q to schema2", layer.Digest, layer.MediaType)
+		}
+		layers[i] = layer
+		layers[i].MediaType = mediaType
+	}
+
+	return schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    layers,
+	})
+}
@@ -0,0 +1,111 @@
+package ocischema
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestConvertOCIToSchema2(t *testing.T) {
+	mfst := makeTestManifest(v1.MediaTypeImageManifest)
+	mfst.Layers = append(mfst.Layers,
+		distribution.Descriptor{
+			MediaType: v1.MediaTypeImageLayer,
+			Digest:    "sha256:aaaa908bee94c202b2d35224a221aaa2058318bfa9879fa541efaecba272331b",
+			Size:      1024,
+		},
+		distribution.Descriptor{
+			MediaType: v1.MediaTypeImageLayerNonDistributableGzip,
+			Digest:    "sha256:bbbb908bee94c202b2d35224a221aaa2058318bfa9879fa541efaecba272331b",
+			Size:      2048,
+			URLs:      []string{"https://example.com/layer"},
+		},
+	)
+	deserialized, err := FromStruct(mfst)
+	if err != nil {
+		t.Fatalf("error creating DeserializedManifest: %v", err)
+	}
+
+	converted, err := ConvertOCIToSchema2(deserialized)
+	if err != nil {
+		t.Fatalf("error converting manifest: %v", err)
+	}
+	mediaType, _, err := converted.Payload()
+	if err != nil {
+		t.Fatalf("error getting payload: %v", err)
+	}
+	if mediaType != schema2.MediaTypeManifest {
+		t.Fatalf("unexpected media type of converted manifest: %s", mediaType)
+	}
+	if converted.Config.MediaType != schema2.MediaTypeImageConfig || converted.Config.Digest != mfst.Config.Digest {
+		t.Fatalf("unexpected config of converted manifest: %+v", converted.Config)
+	}
+	expected := []string{schema2.MediaTypeLayer, schema2.MediaTypeUncompressedLayer, schema2.MediaTypeForeignLayer}
+	if len(converted.Layers) != len(expected) {
+		t.Fatalf("unexpected number of layers of converted manifest: %d", len(converted.Layers))
+	}
+	for i, layer := range converted.Layers {
+		if layer.MediaType != expected[i] || layer.Digest != mfst.Layers[i].Digest || layer.Size != mfst.Layers[i].Size {
+			t.Fatalf("unexpected layer %d of converted manifest: %+v", i, layer)
+		}
+	}
+	if len(converted.Layers[2].URLs) != 1 {
+		t.Fatalf("urls of foreign layer were not kept: %+v", converted.Layers[2])
+	}
+
+	// The converted manifest must be parsed as schema2.
+	_, p, _ := converted.Payload()
+	if _, _, err := distribution.UnmarshalManifest(schema2.MediaTypeManifest, p); err != nil {
+		t.Fatalf("error unmarshaling converted manifest: %v", err)
+	}
+}
+
+func TestConvertOCIToSchema2Unsupported(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(*Manifest)
+	}{
+		{
+			name: "artifact config",
+			modify: func(m *Manifest) {
+				m.Config.MediaType = "application/vnd.example.config.v1+json"
+			},
+		},
+		{
+			name: "zstd layer",
+			modify: func(m *Manifest) {
+				m.Layers[0].MediaType = "application/vnd.oci.image.layer.v1.tar+zstd"
+			},
+		},
+		{
+			name: "encrypted layer",
+			modify: func(m *Manifest) {
+				m.Layers[0].MediaType = MediaTypeImageLayerGzipEncrypted
+			},
+		},
+		{
+			name: "subject",
+			modify: func(m *Manifest) {
+				m.Subject = &distribution.Descriptor{
+					MediaType: v1.MediaTypeImageManifest,
+					Digest:    "sha256:cccc908bee94c202b2d35224a221aaa2058318bfa9879fa541efaecba272331b",
+					Size:      512,
+				}
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mfst := makeTestManifest(v1.MediaTypeImageManifest)
+			tc.modify(&mfst)
+			deserialized, err := FromStruct(mfst)
+			if err != nil {
+				t.Fatalf("error creating DeserializedManifest: %v", err)
+			}
+			if _, err := ConvertOCIToSchema2(deserialized); err == nil {
+				t.Fatal("expected an error converting manifest")
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package ocischema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Media types and annotations of the layers encrypted as defined by the OCI
+// image encryption specification, implemented by containers/ocicrypt.
+const (
+	// MediaTypeImageLayerEncrypted is the media type of encrypted tar
+	// layers.
+	MediaTypeImageLayerEncrypted = v1.MediaTypeImageLayer + "+encrypted"
+
+	// MediaTypeImageLayerGzipEncrypted is the media type of encrypted
+	// gzipped tar layers.
+	MediaTypeImageLayerGzipEncrypted = v1.MediaTypeImageLayerGzip + "+encrypted"
+
+	// MediaTypeImageLayerZstdEncrypted is the media type of encrypted zstd
+	// compressed tar layers.
+	MediaTypeImageLayerZstdEncrypted = "application/vnd.oci.image.layer.v1.tar+zstd+encrypted"
+
+	// AnnotationEncryptionKeysPrefix prefixes the annotations holding the
+	// wrapped key material of an encrypted layer, suffixed with the key
+	// wrapping scheme, such as "jwe".
+	AnnotationEncryptionKeysPrefix = "org.opencontainers.image.enc.keys."
+
+	// AnnotationEncryptionPubOpts is the annotation holding the public
+	// options of the cipher of an encrypted layer.
+	AnnotationEncryptionPubOpts = "org.opencontainers.image.enc.pubopts"
+)
+
+// IsEncryptedLayer reports whether mediaType is the one of an encrypted
+// layer.
+func IsEncryptedLayer(mediaType string) bool {
+	switch mediaType {
+	case MediaTypeImageLayerEncrypted, MediaTypeImageLayerGzipEncrypted, MediaTypeImageLayerZstdEncrypted:
+		return true
+	}
+	return false
+}
+
+// ValidateEncryptedLayer checks that the encrypted layer desc carries the
+// annotations needed to decrypt it.
+func ValidateEncryptedLayer(desc distribution.Descriptor) error {
+	if desc.Annotations[AnnotationEncryptionPubOpts] == "" {
+		return fmt.Errorf("encrypted layer %s has no %s annotation", desc.Digest, AnnotationEncryptionPubOpts)
+	}
+	for annotation, value := range desc.Annotations {
+		if strings.HasPrefix(annotation, AnnotationEncryptionKeysPrefix) && value != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("encrypted layer %s has no key material", desc.Digest)
+}
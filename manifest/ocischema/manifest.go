@@ -42,6 +42,10 @@ func init() {
 type Manifest struct {
 	manifest.Versioned
 
+	// ArtifactType is the type of the artifact held by the manifest. The
+	// media type of its config is the type of the artifact otherwise.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Config references the image configuration as a blob.
 	Config distribution.Descriptor `json:"config"`
 
@@ -51,6 +55,11 @@ type Manifest struct {
 
 	// Annotations contains arbitrary metadata for the image manifest.
 	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Subject references the manifest this manifest applies to, such as
+	// the image a signature or an attestation is about. It is not a
+	// reference of the manifest, as it is not required to exist.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
 }
 
 // References returns the descriptors of this manifests references.
@@ -78,14 +87,46 @@ type DeserializedManifest struct {
 // FromStruct takes a Manifest structure, marshals it to JSON, and returns a
 // DeserializedManifest which contains the manifest and its JSON representation.
 func FromStruct(m Manifest) (*DeserializedManifest, error) {
+	// layers is a required field, so it must serialize as an empty array
+	// rather than null.
+	if m.Layers == nil {
+		m.Layers = []distribution.Descriptor{}
+	}
+
 	var deserialized DeserializedManifest
 	deserialized.Manifest = m
 
 	var err error
-	deserialized.canonical, err = json.MarshalIndent(&m, "", "   ")
+	deserialized.canonical, err = json.MarshalIndent(newManifestJSON(m), "", "   ")
 	return &deserialized, err
 }
 
+// manifestJSON is the serialization of a Manifest, with the required fields
+// of its descriptors present even when zero.
+type manifestJSON struct {
+	manifest.Versioned
+	ArtifactType string                `json:"artifactType,omitempty"`
+	Config       manifest.Descriptor   `json:"config"`
+	Layers       []manifest.Descriptor `json:"layers"`
+	Annotations  map[string]string     `json:"annotations,omitempty"`
+	Subject      *manifest.Descriptor  `json:"subject,omitempty"`
+}
+
+func newManifestJSON(m Manifest) *manifestJSON {
+	mj := &manifestJSON{
+		Versioned:    m.Versioned,
+		ArtifactType: m.ArtifactType,
+		Config:       manifest.Descriptor(m.Config),
+		Layers:       manifest.Descriptors(m.Layers),
+		Annotations:  m.Annotations,
+	}
+	if m.Subject != nil {
+		subject := manifest.Descriptor(*m.Subject)
+		mj.Subject = &subject
+	}
+	return mj
+}
+
 // UnmarshalJSON populates a new Manifest struct from JSON data.
 func (m *DeserializedManifest) UnmarshalJSON(b []byte) error {
 	m.canonical = make([]byte, len(b))
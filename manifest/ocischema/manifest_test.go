@@ -9,6 +9,7 @@ import (
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/opencontainers/go-digest"
 
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
@@ -214,3 +215,62 @@ func TestValidateManifest(t *testing.T) {
 		}
 	})
 }
+
+func TestFromStructEmptyLayers(t *testing.T) {
+	deserialized, err := FromStruct(Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 2,
+			MediaType:     v1.MediaTypeImageManifest,
+		},
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
+			Size:      985,
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating DeserializedManifest: %v", err)
+	}
+
+	_, canonical, _ := deserialized.Payload()
+	if !bytes.Contains(canonical, []byte(`"layers": []`)) {
+		t.Fatalf("expected empty layers array in manifest:\n%s", canonical)
+	}
+}
+
+func TestFromStructRequiredDescriptorFields(t *testing.T) {
+	emptyLayer := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(nil),
+	}
+	deserialized, err := FromStruct(Manifest{
+		Versioned: SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
+			Size:      985,
+		},
+		Layers: []distribution.Descriptor{emptyLayer},
+	})
+	if err != nil {
+		t.Fatalf("error creating DeserializedManifest: %v", err)
+	}
+
+	// The size of the empty layer is required, while the descriptors
+	// marshaled outside of manifests omit it.
+	_, canonical, _ := deserialized.Payload()
+	if !bytes.Contains(canonical, []byte(`"size": 0`)) {
+		t.Fatalf("expected the size of the empty layer in manifest:\n%s", canonical)
+	}
+	if bytes.Contains(canonical, []byte(`"urls"`)) || bytes.Contains(canonical, []byte(`"annotations"`)) {
+		t.Fatalf("unexpected empty optional fields in manifest:\n%s", canonical)
+	}
+
+	var m DeserializedManifest
+	if err := m.UnmarshalJSON(canonical); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Layers, []distribution.Descriptor{emptyLayer}) {
+		t.Fatalf("unexpected layers after round trip: %v", m.Layers)
+	}
+}
@@ -0,0 +1,20 @@
+package manifest
+
+// PlatformAttribute is an attribute of a platform beyond its operating
+// system and CPU, such as the availability of a GPU, by which the manifests
+// of a manifest list can be selected.
+type PlatformAttribute struct {
+	Key   string
+	Value string
+}
+
+// MatchPlatformAttributes reports whether attributes has all the required
+// attributes.
+func MatchPlatformAttributes(attributes map[string]string, required []PlatformAttribute) bool {
+	for _, attribute := range required {
+		if value, ok := attributes[attribute.Key]; !ok || value != attribute.Value {
+			return false
+		}
+	}
+	return true
+}
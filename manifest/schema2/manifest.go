@@ -94,14 +94,32 @@ type DeserializedManifest struct {
 // FromStruct takes a Manifest structure, marshals it to JSON, and returns a
 // DeserializedManifest which contains the manifest and its JSON representation.
 func FromStruct(m Manifest) (*DeserializedManifest, error) {
+	// layers is a required field, so it must serialize as an empty array
+	// rather than null.
+	if m.Layers == nil {
+		m.Layers = []distribution.Descriptor{}
+	}
+
 	var deserialized DeserializedManifest
 	deserialized.Manifest = m
 
 	var err error
-	deserialized.canonical, err = json.MarshalIndent(&m, "", "   ")
+	deserialized.canonical, err = json.MarshalIndent(&manifestJSON{
+		Versioned: m.Versioned,
+		Config:    manifest.Descriptor(m.Config),
+		Layers:    manifest.Descriptors(m.Layers),
+	}, "", "   ")
 	return &deserialized, err
 }
 
+// manifestJSON is the serialization of a Manifest, with the required fields
+// of its descriptors present even when zero.
+type manifestJSON struct {
+	manifest.Versioned
+	Config manifest.Descriptor   `json:"config"`
+	Layers []manifest.Descriptor `json:"layers"`
+}
+
 // UnmarshalJSON populates a new Manifest struct from JSON data.
 func (m *DeserializedManifest) UnmarshalJSON(b []byte) error {
 	m.canonical = make([]byte, len(b))
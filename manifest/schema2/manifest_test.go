@@ -160,3 +160,22 @@ func TestMediaTypes(t *testing.T) {
 	mediaTypeTest(t, MediaTypeManifest, false)
 	mediaTypeTest(t, MediaTypeManifest+"XXX", true)
 }
+
+func TestFromStructEmptyLayers(t *testing.T) {
+	deserialized, err := FromStruct(Manifest{
+		Versioned: SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: MediaTypeImageConfig,
+			Digest:    "sha256:1a9ec845ee94c202b2d5da74a24f0ed2058318bfa9879fa541efaecba272e86b",
+			Size:      985,
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating DeserializedManifest: %v", err)
+	}
+
+	_, canonical, _ := deserialized.Payload()
+	if !bytes.Contains(canonical, []byte(`"layers": []`)) {
+		t.Fatalf("expected empty layers array in manifest:\n%s", canonical)
+	}
+}
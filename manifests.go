@@ -69,6 +69,14 @@ type ManifestEnumerator interface {
 	Enumerate(ctx context.Context, ingester func(digest.Digest) error) error
 }
 
+// ReferrersService lists the referrers of manifests, the manifests having
+// them as their subject.
+type ReferrersService interface {
+	// List returns the descriptors of the referrers of the manifest dgst,
+	// in the order they were pushed.
+	List(ctx context.Context, dgst digest.Digest) ([]Descriptor, error)
+}
+
 // Describable is an interface for descriptors
 type Describable interface {
 	Descriptor() Descriptor
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/docker/go-metrics"
+)
+
+// HPANamespace is the prometheus namespace of the load metrics intended for
+// horizontal pod autoscaling. It has no subsystem, so that the metrics are
+// exported under short, stable names.
+var HPANamespace = metrics.NewNamespace(NamespacePrefix, "", nil)
+
+// HPA is the process wide exporter of autoscaling metrics.
+var HPA = NewMetricsExporter(HPANamespace)
+
+func init() {
+	metrics.Register(HPANamespace)
+}
+
+// HPAValues is a snapshot of the autoscaling metrics.
+type HPAValues struct {
+	ActiveBlobUploads    int64 `json:"registry_active_blob_uploads"`
+	ActiveManifestPushes int64 `json:"registry_active_manifest_pushes"`
+	BlobPullQueueDepth   int64 `json:"registry_blob_pull_queue_depth"`
+}
+
+// MetricsExporter tracks the number of in-flight blob uploads, manifest
+// pushes and blob pulls, and publishes them as prometheus gauges.
+type MetricsExporter struct {
+	activeBlobUploads    hpaGauge
+	activeManifestPushes hpaGauge
+	blobPullQueueDepth   hpaGauge
+}
+
+// NewMetricsExporter creates a MetricsExporter whose gauges are added to ns.
+func NewMetricsExporter(ns *metrics.Namespace) *MetricsExporter {
+	return &MetricsExporter{
+		activeBlobUploads: hpaGauge{
+			gauge: ns.NewGauge("active_blob_uploads", "The number of blob uploads in progress", ""),
+		},
+		activeManifestPushes: hpaGauge{
+			gauge: ns.NewGauge("active_manifest_pushes", "The number of manifest pushes in progress", ""),
+		},
+		blobPullQueueDepth: hpaGauge{
+			gauge: ns.NewGauge("blob_pull_queue_depth", "The number of blob pulls being served", ""),
+		},
+	}
+}
+
+// BlobUploadStarted records the start of a blob upload request. The returned
+// function must be called once the request is done.
+func (e *MetricsExporter) BlobUploadStarted() func() {
+	return e.activeBlobUploads.start()
+}
+
+// ManifestPushStarted records the start of a manifest push request. The
+// returned function must be called once the request is done.
+func (e *MetricsExporter) ManifestPushStarted() func() {
+	return e.activeManifestPushes.start()
+}
+
+// BlobPullStarted records the start of a blob pull request. The returned
+// function must be called once the request is done.
+func (e *MetricsExporter) BlobPullStarted() func() {
+	return e.blobPullQueueDepth.start()
+}
+
+// Values returns the current values of the metrics.
+func (e *MetricsExporter) Values() HPAValues {
+	return HPAValues{
+		ActiveBlobUploads:    atomic.LoadInt64(&e.activeBlobUploads.value),
+		ActiveManifestPushes: atomic.LoadInt64(&e.activeManifestPushes.value),
+		BlobPullQueueDepth:   atomic.LoadInt64(&e.blobPullQueueDepth.value),
+	}
+}
+
+// hpaGauge keeps a readable copy of the value published through gauge.
+type hpaGauge struct {
+	value int64
+	gauge metrics.Gauge
+}
+
+func (g *hpaGauge) start() func() {
+	atomic.AddInt64(&g.value, 1)
+	g.gauge.Inc()
+	return func() {
+		atomic.AddInt64(&g.value, -1)
+		g.gauge.Dec()
+	}
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/docker/go-metrics"
+)
+
+func TestMetricsExporter(t *testing.T) {
+	e := NewMetricsExporter(metrics.NewNamespace(NamespacePrefix, "", nil))
+
+	uploadDone := e.BlobUploadStarted()
+	pushDone := e.ManifestPushStarted()
+	pullDone := e.BlobPullStarted()
+	pullDone2 := e.BlobPullStarted()
+
+	if values := e.Values(); values != (HPAValues{ActiveBlobUploads: 1, ActiveManifestPushes: 1, BlobPullQueueDepth: 2}) {
+		t.Fatalf("unexpected values: %+v", values)
+	}
+
+	uploadDone()
+	pushDone()
+	pullDone()
+	if values := e.Values(); values != (HPAValues{BlobPullQueueDepth: 1}) {
+		t.Fatalf("unexpected values: %+v", values)
+	}
+
+	pullDone2()
+	if values := e.Values(); values != (HPAValues{}) {
+		t.Fatalf("unexpected values: %+v", values)
+	}
+}
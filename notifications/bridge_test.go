@@ -1,6 +1,8 @@
 package notifications
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/distribution/distribution/v3"
@@ -125,6 +127,18 @@ func TestEventBridgeTagDeleted(t *testing.T) {
 		if event.(Event).Target.Tag != m.Tag {
 			t.Fatalf("unexpected tag on event target: %q != %q", event.(Event).Target.Tag, m.Tag)
 		}
+
+		// The target of a tag deletion describes no content, which must
+		// not be serialized as empty fields.
+		p, err := json.Marshal(event.(Event).Target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range []string{`"mediaType"`, `"digest"`, `"size"`} {
+			if strings.Contains(string(p), field) {
+				t.Fatalf("unexpected %s in the target of a tag deletion: %s", field, p)
+			}
+		}
 		return nil
 	}))
 
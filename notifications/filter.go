@@ -0,0 +1,115 @@
+package notifications
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	events "github.com/docker/go-events"
+)
+
+// RepoFilter matches repository names against glob patterns, as understood
+// by path.Match. Patterns starting with "!" exclude the repositories they
+// match. A repository also matches the patterns matching one of its parent
+// namespaces, such that "prod/*" matches "prod/team/app".
+type RepoFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewRepoFilter returns a RepoFilter for patterns. Without patterns other
+// than exclusions, all the repositories which are not excluded match.
+func NewRepoFilter(patterns []string) (RepoFilter, error) {
+	var filter RepoFilter
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if pattern == "" {
+			return RepoFilter{}, fmt.Errorf("empty repository pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return RepoFilter{}, fmt.Errorf("invalid repository pattern %q: %v", pattern, err)
+		}
+		if exclude {
+			filter.exclude = append(filter.exclude, pattern)
+		} else {
+			filter.include = append(filter.include, pattern)
+		}
+	}
+	return filter, nil
+}
+
+// Match returns whether repo matches an included pattern, or there is none,
+// and no excluded pattern.
+func (rf RepoFilter) Match(repo string) bool {
+	if len(rf.include) > 0 && !matchAny(rf.include, repo) {
+		return false
+	}
+	return !matchAny(rf.exclude, repo)
+}
+
+// matchAny returns whether repo, or one of its parent namespaces, matches
+// one of patterns.
+func matchAny(patterns []string, repo string) bool {
+	for _, pattern := range patterns {
+		for name := repo; ; {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+			i := strings.LastIndex(name, "/")
+			if i < 0 {
+				break
+			}
+			name = name[:i]
+		}
+	}
+	return false
+}
+
+// FilteredSink passes along the events of the repositories matching its
+// filter, and with one of its actions, discarding the rest.
+type FilteredSink struct {
+	inner   events.Sink
+	filter  RepoFilter
+	actions map[string]bool
+}
+
+// NewFilteredSink returns a FilteredSink writing to sink the events of the
+// repositories matching filter. With actions, such as "push" or "pull",
+// only the events with one of them are written.
+func NewFilteredSink(sink events.Sink, filter RepoFilter, actions []string) *FilteredSink {
+	var actionsMap map[string]bool
+	if len(actions) > 0 {
+		actionsMap = make(map[string]bool, len(actions))
+		for _, action := range actions {
+			actionsMap[action] = true
+		}
+	}
+
+	return &FilteredSink{
+		inner:   sink,
+		filter:  filter,
+		actions: actionsMap,
+	}
+}
+
+// Write passes event along if it matches the filter of the sink.
+func (fs *FilteredSink) Write(event events.Event) error {
+	e, ok := event.(Event)
+	if !ok {
+		return fs.inner.Write(event)
+	}
+	if fs.actions != nil && !fs.actions[e.Action] {
+		return nil
+	}
+	if !fs.filter.Match(e.Target.Repository) {
+		return nil
+	}
+
+	return fs.inner.Write(event)
+}
+
+// Close closes the underlying sink.
+func (fs *FilteredSink) Close() error {
+	return fs.inner.Close()
+}
@@ -0,0 +1,153 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepoFilter(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		matched  []string
+		rejected []string
+	}{
+		{
+			patterns: nil,
+			matched:  []string{"library/test", "prod/app"},
+		},
+		{
+			patterns: []string{"prod/*"},
+			matched:  []string{"prod/app", "prod/team/app"},
+			rejected: []string{"prod", "production/app", "staging/app"},
+		},
+		{
+			patterns: []string{"prod/*", "!prod/staging*"},
+			matched:  []string{"prod/app"},
+			rejected: []string{"prod/staging", "prod/staging-app", "prod/staging/app", "dev/app"},
+		},
+		{
+			patterns: []string{"!staging/*"},
+			matched:  []string{"prod/app", "library/test"},
+			rejected: []string{"staging/app", "staging/team/app"},
+		},
+		{
+			patterns: []string{"library/test", "prod/*"},
+			matched:  []string{"library/test", "prod/app"},
+			rejected: []string{"library/other"},
+		},
+	} {
+		filter, err := NewRepoFilter(tc.patterns)
+		if err != nil {
+			t.Fatalf("unexpected error creating filter %v: %v", tc.patterns, err)
+		}
+		for _, repo := range tc.matched {
+			if !filter.Match(repo) {
+				t.Errorf("expected %v to match %q", tc.patterns, repo)
+			}
+		}
+		for _, repo := range tc.rejected {
+			if filter.Match(repo) {
+				t.Errorf("expected %v not to match %q", tc.patterns, repo)
+			}
+		}
+	}
+
+	for _, patterns := range [][]string{{"prod/["}, {"!"}, {""}} {
+		if _, err := NewRepoFilter(patterns); err == nil {
+			t.Errorf("expected an error creating filter %q", patterns)
+		}
+	}
+}
+
+func TestFilteredSink(t *testing.T) {
+	filter, err := NewRepoFilter([]string{"prod/*", "!staging/*"})
+	if err != nil {
+		t.Fatalf("unexpected error creating filter: %v", err)
+	}
+
+	for _, tc := range []struct {
+		actions []string
+		event   Event
+		written bool
+	}{
+		{nil, createTestEvent("push", "prod/app", "blob"), true},
+		{nil, createTestEvent("pull", "prod/app", "blob"), true},
+		{nil, createTestEvent("push", "staging/app", "blob"), false},
+		{nil, createTestEvent("push", "library/test", "blob"), false},
+		{[]string{"push"}, createTestEvent("push", "prod/app", "manifest"), true},
+		{[]string{"push"}, createTestEvent("pull", "prod/app", "manifest"), false},
+		{[]string{"push", "pull"}, createTestEvent("pull", "prod/app", "manifest"), true},
+		{[]string{"push", "pull"}, createTestEvent("delete", "prod/app", "manifest"), false},
+		{[]string{"push"}, createTestEvent("push", "staging/app", "manifest"), false},
+	} {
+		ts := &testSink{}
+		s := NewFilteredSink(ts, filter, tc.actions)
+		if err := s.Write(tc.event); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+
+		ts.mu.Lock()
+		if written := ts.count == 1; written != tc.written {
+			t.Errorf("unexpected write of %s event of %s with actions %v: %v != %v",
+				tc.event.Action, tc.event.Target.Repository, tc.actions, written, tc.written)
+		}
+		ts.mu.Unlock()
+
+		if err := s.Close(); err != nil {
+			t.Fatalf("error closing sink: %v", err)
+		}
+		if !ts.closed {
+			t.Fatal("expected the underlying sink to be closed")
+		}
+	}
+}
+
+func TestFilteredEndpoint(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		repositories []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var envelope struct {
+			Events []Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		for _, event := range envelope.Events {
+			repositories = append(repositories, event.Target.Repository)
+		}
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	filter, err := NewRepoFilter([]string{"prod/*", "!prod/staging"})
+	if err != nil {
+		t.Fatalf("unexpected error creating filter: %v", err)
+	}
+	sink := NewFilteredSink(newHTTPSink(server.URL, time.Second, nil, nil), filter, []string{"push"})
+	defer sink.Close()
+
+	for _, event := range []Event{
+		createTestEvent("push", "dev/app", "manifest"),
+		createTestEvent("push", "prod/staging", "manifest"),
+		createTestEvent("pull", "prod/app", "manifest"),
+		createTestEvent("push", "prod/app", "manifest"),
+	} {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(repositories) != 1 || repositories[0] != "prod/app" {
+		t.Fatalf("unexpected events received by the endpoint: %v", repositories)
+	}
+}
@@ -160,5 +160,5 @@ func (imts *ignoredSink) Write(event events.Event) error {
 }
 
 func (imts *ignoredSink) Close() error {
-	return nil
+	return imts.Sink.Close()
 }
@@ -26,6 +26,14 @@ var (
 		Description: `Tag or digest of the target manifest.`,
 	}
 
+	tagParameterDescriptor = ParameterDescriptor{
+		Name:        "tag",
+		Type:        "string",
+		Format:      reference.TagRegexp.String(),
+		Required:    true,
+		Description: `Tag of the target manifest.`,
+	}
+
 	uuidParameterDescriptor = ParameterDescriptor{
 		Name:        "uuid",
 		Type:        "opaque",
@@ -512,14 +520,14 @@ var routeDescriptors = []RouteDescriptor{
 		},
 	},
 	{
-		Name:        RouteNameManifest,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
-		Entity:      "Manifest",
-		Description: "Create, update, delete and retrieve manifests.",
+		Name:        RouteNameManifestChain,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{digest:" + digest.DigestRegexp.String() + "}/chain",
+		Entity:      "Manifest Chain",
+		Description: "Retrieve the chain of artifacts a manifest belongs to, such as a signature and the image it signs, by following the `subject` of the manifests.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      http.MethodGet,
-				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Description: "Fetch the descriptors of the manifest identified by `name` and `digest`, of its subject, of the subject of its subject, and so on, until a manifest without subject, a subject unknown to the repository, or `depth` subjects are reached. The response is the tree of the chain, rooted at the last manifest reached, where the children of a manifest have it as their subject.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -528,28 +536,69 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
+							digestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "depth",
+								Type:        "integer",
+								Description: "The number of subjects to follow at most. Defaults to 10.",
+								Format:      "<integer>",
+							},
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
+								Description: "The tree of the chain of the manifest.",
 								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
-									digestHeader,
+									{
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "application/json",
+										Description: "The chain is JSON encoded.",
+									},
 								},
 								Body: BodyDescriptor{
-									ContentType: "<media type of manifest>",
-									Format:      manifestBody,
+									ContentType: "application/json",
+									Format: `{
+    "name": <name>,
+    "chain": {
+        "mediaType": <media type>,
+        "digest": <digest>,
+        "size": <size>,
+        "children": [
+            {
+                "mediaType": <media type>,
+                "digest": <digest>,
+                "size": <size>,
+                "children": [...]
+            }
+        ]
+    }
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "The name or reference was invalid.",
+								Description: "The name, digest or depth is invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
+									ErrorCodeChainDepthInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The manifest identified by `name` and `digest` is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
@@ -564,9 +613,17 @@ var routeDescriptors = []RouteDescriptor{
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameAttestations,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/attestations/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Attestations",
+		Description: "Retrieve the attestations attached to a manifest, such as its SLSA provenance, its SBOMs and its vulnerability scans, as a single bundle.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      http.MethodPut,
-				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Method:      http.MethodGet,
+				Description: "Fetch the bundle of the SLSA provenance, SBOM and vulnerability scan attestations attached to the manifest identified by `name` and `digest`, found among its referrers and in the manifest tagged `<algorithm>-<hex>.att`. The content of the attestations is returned as stored, without verifying their signatures. Bundles may be cached by the registry for a configured time.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -575,122 +632,54 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
-						},
-						Body: BodyDescriptor{
-							ContentType: "<media type of manifest>",
-							Format:      manifestBody,
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
-								StatusCode:  http.StatusCreated,
+								Description: "The bundle of the attestations of the manifest.",
+								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Description: "The canonical location url of the uploaded manifest.",
-										Format:      "<url>",
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "application/json",
+										Description: "The bundle is JSON encoded.",
 									},
-									contentLengthZeroHeader,
-									digestHeader,
-								},
-							},
-						},
-						Failures: []ResponseDescriptor{
-							{
-								Name:        "Invalid Manifest",
-								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
-								StatusCode:  http.StatusBadRequest,
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
-								},
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
-									ErrorCodeManifestInvalid,
-									ErrorCodeManifestUnverified,
-									ErrorCodeBlobUnknown,
-								},
-							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
-							tooManyRequestsDescriptor,
-							{
-								Name:        "Missing Layer(s)",
-								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
-								StatusCode:  http.StatusBadRequest,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
 									Format: `{
-    "errors:" [{
-            "code": "BLOB_UNKNOWN",
-            "message": "blob unknown to registry",
-            "detail": {
-                "digest": "<digest>"
-            }
+    "manifest": <descriptor>,
+    "provenance": [
+        {
+            "referrer": <descriptor>,
+            "descriptor": <descriptor>,
+            "predicateType": <predicate type>,
+            "content": <content>
         },
         ...
-    ]
+    ],
+    "sbom": [...],
+    "vulnScan": [...]
 }`,
 								},
 							},
-							{
-								Name:        "Not allowed",
-								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
-								StatusCode:  http.StatusMethodNotAllowed,
-								ErrorCodes: []errcode.ErrorCode{
-									errcode.ErrorCodeUnsupported,
-								},
-							},
-						},
-					},
-				},
-			},
-			{
-				Method:      http.MethodDelete,
-				Description: "Delete the manifest or tag identified by `name` and `reference` where `reference` can be a tag or digest. Note that a manifest can _only_ be deleted by digest.",
-				Requests: []RequestDescriptor{
-					{
-						Headers: []ParameterDescriptor{
-							hostHeader,
-							authHeader,
-						},
-						PathParameters: []ParameterDescriptor{
-							nameParameterDescriptor,
-							referenceParameterDescriptor,
-						},
-						Successes: []ResponseDescriptor{
-							{
-								StatusCode: http.StatusAccepted,
-							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:        "Invalid Name or Reference",
-								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								Description: "The name or digest is invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json",
 									Format:      errorsBody,
 								},
 							},
-							unauthorizedResponseDescriptor,
-							repositoryNotFoundResponseDescriptor,
-							deniedResponseDescriptor,
-							tooManyRequestsDescriptor,
 							{
-								Name:        "Unknown Manifest",
-								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest or tag was already deleted if this response is returned.",
+								Description: "The manifest identified by `name` and `digest` is unknown to the registry.",
 								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameUnknown,
@@ -701,33 +690,27 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
-							{
-								Name:        "Not allowed",
-								Description: "Manifest or tag delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
-								StatusCode:  http.StatusMethodNotAllowed,
-								ErrorCodes: []errcode.ErrorCode{
-									errcode.ErrorCodeUnsupported,
-								},
-							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
 						},
 					},
 				},
 			},
 		},
 	},
-
 	{
-		Name:        RouteNameBlob,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
-		Entity:      "Blob",
-		Description: "Operations on blobs identified by `name` and `digest`. Used to fetch or delete layers by digest.",
+		Name:        RouteNameReferrers,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/referrers/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Referrers",
+		Description: "Retrieve the referrers of a manifest, the manifests having it as their subject, such as its signatures and attestations, as defined by the OCI distribution specification 1.1.",
 		Methods: []MethodDescriptor{
 			{
 				Method:      http.MethodGet,
-				Description: "Retrieve the blob from the registry identified by `digest`. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Description: "Fetch the image index of the referrers of the manifest identified by `name` and `digest`. The manifest itself is not required to exist, in which case the index may be empty.",
 				Requests: []RequestDescriptor{
 					{
-						Name: "Fetch Blob",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
@@ -736,41 +719,55 @@ var routeDescriptors = []RouteDescriptor{
 							nameParameterDescriptor,
 							digestPathParameter,
 						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "artifactType",
+								Type:        "string",
+								Format:      "<artifact type>",
+								Required:    false,
+								Description: "Only return the referrers of this artifact type.",
+							},
+						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob identified by `digest` is available. The blob content will be present in the body of the request.",
+								Description: "The image index of the referrers of the manifest.",
 								StatusCode:  http.StatusOK,
 								Headers: []ParameterDescriptor{
 									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "The length of the requested blob content.",
-										Format:      "<length>",
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "application/vnd.oci.image.index.v1+json",
+										Description: "The referrers are returned as an OCI image index.",
 									},
-									digestHeader,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/octet-stream",
-									Format:      "<blob binary data>",
-								},
-							},
-							{
-								Description: "The blob identified by `digest` is available at the provided location.",
-								StatusCode:  http.StatusTemporaryRedirect,
-								Headers: []ParameterDescriptor{
 									{
-										Name:        "Location",
-										Type:        "url",
-										Description: "The location where the layer should be accessible.",
-										Format:      "<blob location>",
+										Name:        "OCI-Filters-Applied",
+										Type:        "string",
+										Format:      "artifactType",
+										Description: "Set when the referrers were filtered by their artifact type.",
 									},
-									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.oci.image.index.v1+json",
+									Format: `{
+    "schemaVersion": 2,
+    "mediaType": "application/vnd.oci.image.index.v1+json",
+    "manifests": [
+        {
+            "mediaType": <media type>,
+            "artifactType": <artifact type>,
+            "digest": <digest>,
+            "size": <size>,
+            "annotations": <annotations>
+        },
+        ...
+    ]
+}`,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
+								Description: "The name or digest is invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameInvalid,
@@ -781,76 +778,749 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
-							{
-								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
-								StatusCode:  http.StatusNotFound,
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
-								},
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
-									ErrorCodeBlobUnknown,
-								},
-							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameManifestUpload,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/uploads",
+		Entity:      "Initiate Manifest Upload",
+		Description: "Initiate a resumable manifest upload. Large manifests may be pushed in several chunks, which are accumulated by the registry until the upload is committed.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPost,
+				Description: "Start a manifest upload session. The returned `Location` is used for subsequent `PATCH`, `PUT` and `DELETE` requests.",
+				Requests: []RequestDescriptor{
 					{
-						Name:        "Fetch Blob Part",
-						Description: "This endpoint may also support RFC7233 compliant range requests. Support can be detected by issuing a HEAD request. If the header `Accept-Range: bytes` is returned, range requests can be used to fetch partial content.",
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
-							{
-								Name:        "Range",
-								Type:        "string",
-								Description: "HTTP Range header specifying blob chunk.",
-								Format:      "bytes=<start>-<end>",
-							},
+							contentLengthZeroHeader,
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The blob identified by `digest` is available. The specified chunk of blob content will be present in the body of the request.",
-								StatusCode:  http.StatusPartialContent,
+								Description: "The upload has been created.",
+								StatusCode:  http.StatusAccepted,
 								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
 									{
-										Name:        "Content-Length",
-										Type:        "integer",
-										Description: "The length of the requested blob chunk.",
-										Format:      "<length>",
-									},
-									{
-										Name:        "Content-Range",
-										Type:        "byte range",
-										Description: "Content range of blob chunk.",
-										Format:      "bytes <start>-<end>/<size>",
+										Name:        "Location",
+										Type:        "url",
+										Format:      "/v2/<name>/manifests/uploads/<uuid>",
+										Description: "The location of the created upload.",
 									},
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/octet-stream",
-									Format:      "<blob binary data>",
+									dockerUploadUUIDHeader,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
-							{
-								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
-								StatusCode:  http.StatusBadRequest,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeDigestInvalid,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/json",
-									Format:      errorsBody,
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameManifestValidate,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/validate",
+		Entity:      "Manifest Validation",
+		Description: "Validate a manifest before pushing it, such that pipelines fail fast on manifests the registry would reject.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPost,
+				Description: "Run the validators of the registry on the manifest in the request body, as when it is put, such as the checks of the media type and of the existence of the referenced blobs, without storing it. Requires push access to the repository.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "<media type of manifest>",
+							Format:      manifestBody,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The manifest has been validated. The errors it would be rejected with are listed, if any.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "application/json",
+										Description: "The result is JSON encoded.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "valid": <true or false>,
+    "errors": [
+        {
+            "code": <error identifier>,
+            "message": <message describing condition>,
+            "detail": <unstructured>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The registry does not support validating manifests, such as when it is a pull through cache.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameManifestUploadChunk,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/uploads/{uuid:[a-zA-Z0-9-_.=]+}",
+		Entity:      "Manifest Upload",
+		Description: "Append to, commit or cancel a manifest upload. Clients should take this endpoint from the `Location` header returned when the upload was started.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPatch,
+				Description: "Append a chunk of the manifest payload to the upload.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/octet-stream",
+							Format:      "<manifest chunk>",
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The chunk has been accepted. The `Range` header reports the bytes received so far.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+									contentLengthZeroHeader,
+									dockerUploadUUIDHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      http.MethodPut,
+				Description: "Commit the upload. The accumulated payload is verified against `digest` and stored as a regular manifest, tagged with `tag` if provided.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "query",
+								Format:      "<digest>",
+								Regexp:      digest.DigestRegexp,
+								Required:    true,
+								Description: `Digest of the uploaded manifest.`,
+							},
+							{
+								Name:        "tag",
+								Type:        "query",
+								Format:      "<tag>",
+								Regexp:      reference.TagRegexp,
+								Description: `Tag to apply to the manifest once stored.`,
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The manifest has been stored and the upload removed.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<url>",
+										Description: "The canonical location of the manifest.",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Manifest",
+								Description: "The uploaded manifest is invalid or does not match `digest`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeManifestInvalid,
+									ErrorCodeManifestBlobUnknown,
+									ErrorCodeTagInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The upload is unknown to the registry. The upload must be restarted.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      http.MethodDelete,
+				Description: "Cancel the upload, discarding any data received so far.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							contentLengthZeroHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The upload has been cancelled.",
+								StatusCode:  http.StatusNoContent,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The upload is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameManifest,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Manifest",
+		Description: "Create, update, delete and retrieve manifests.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "platform.attribute.<key>",
+								Type:        "string",
+								Format:      "<value>",
+								Description: "Only return the manifests of a manifest list whose platform has the attribute `<key>` set to `<value>`. The filtered manifest list is not stored, and is returned with its own digest.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "<media type of manifest>",
+									Format:      manifestBody,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name or reference was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      http.MethodPut,
+				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "<media type of manifest>",
+							Format:      manifestBody,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the uploaded manifest.",
+										Format:      "<url>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Manifest",
+								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeManifestInvalid,
+									ErrorCodeManifestUnverified,
+									ErrorCodeBlobUnknown,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+							{
+								Name:        "Missing Layer(s)",
+								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "errors:" [{
+            "code": "BLOB_UNKNOWN",
+            "message": "blob unknown to registry",
+            "detail": {
+                "digest": "<digest>"
+            }
+        },
+        ...
+    ]
+}`,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				Method:      http.MethodPatch,
+				Description: "Update the annotations of the OCI image manifest identified by `name` and `reference`, where `reference` must be a digest. The body is a JSON merge patch of the manifest holding only its `annotations`: annotations with a string value are added or updated, and annotations with a `null` value are deleted. As the annotations are part of the manifest, the updated manifest is stored under a new digest, and the tags pointing to the original manifest are moved to it. The original manifest is kept.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Content-Type",
+								Type:        "string",
+								Format:      "application/merge-patch+json",
+								Description: "The body is a JSON merge patch.",
+								Required:    true,
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/merge-patch+json",
+							Format: `{
+    "annotations": {
+        <key>: <value or null>,
+        ...
+    }
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The annotations have been updated. The updated manifest is available at the provided location.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the updated manifest.",
+										Format:      "<url>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Patch",
+								Description: "The reference is not a digest, the body is not a merge patch of the annotations, or the manifest is not an OCI image manifest.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+									ErrorCodeManifestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Manifest",
+								Description: "The manifest identified by `name` and `reference` is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      http.MethodDelete,
+				Description: "Delete the manifest or tag identified by `name` and `reference` where `reference` can be a tag or digest. Note that a manifest can _only_ be deleted by digest.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Name or Reference",
+								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+							{
+								Name:        "Unknown Manifest",
+								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest or tag was already deleted if this response is returned.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Manifest or tag delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlob,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Blob",
+		Description: "Operations on blobs identified by `name` and `digest`. Used to fetch or delete layers by digest.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Retrieve the blob from the registry identified by `digest`. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "Fetch Blob",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob identified by `digest` is available. The blob content will be present in the body of the request.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested blob content.",
+										Format:      "<length>",
+									},
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
+								},
+							},
+							{
+								Description: "The blob identified by `digest` is available at the provided location.",
+								StatusCode:  http.StatusTemporaryRedirect,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The location where the layer should be accessible.",
+										Format:      "<blob location>",
+									},
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The blob, identified by `name` and `digest`, is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeBlobUnknown,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+					{
+						Name:        "Fetch Blob Part",
+						Description: "This endpoint may also support RFC7233 compliant range requests. Support can be detected by issuing a HEAD request. If the header `Accept-Range: bytes` is returned, range requests can be used to fetch partial content.",
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+							{
+								Name:        "Range",
+								Type:        "string",
+								Description: "HTTP Range header specifying blob chunk.",
+								Format:      "bytes=<start>-<end>",
+							},
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob identified by `digest` is available. The specified chunk of blob content will be present in the body of the request.",
+								StatusCode:  http.StatusPartialContent,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "The length of the requested blob chunk.",
+										Format:      "<length>",
+									},
+									{
+										Name:        "Content-Range",
+										Type:        "byte range",
+										Description: "Content range of blob chunk.",
+										Format:      "bytes <start>-<end>/<size>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/octet-stream",
+									Format:      "<blob binary data>",
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "There was a problem with the request that needs to be addressed by the client, such as an invalid `name` or `tag`.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
 								},
 							},
 							{
@@ -950,6 +1620,175 @@ var routeDescriptors = []RouteDescriptor{
 		},
 	},
 
+	{
+		Name:        RouteNameBlobBatch,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/batch",
+		Entity:      "Blob Batch",
+		Description: "Check the existence of several blobs in a single request, such as before deciding which layers to push.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPost,
+				Description: "Check the existence of the blobs listed in the body in the repository. The results are in the order of the request.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+    "digests": [
+        "<digest>",
+        ...
+    ]
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The existence of each blob, and the size of those which exist.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "application/json",
+										Description: "The results are JSON encoded.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "results": [
+        {
+            "digest": "<digest>",
+            "exists": <true|false>,
+            "size": <size>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The body is malformed, lists an invalid digest, or lists more digests than the registry accepts.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+									ErrorCodeBlobBatchInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameBlobImport,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/imports",
+		Entity:      "Blob Import",
+		Description: "Import a blob which the registry fetches from a URL, such as a presigned URL or the URL of a cloud storage object, rather than the client uploading it.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPost,
+				Description: "Fetch the blob at the URL of the body, verify its digest and link it into the repository.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format: `{
+    "url": "<https, s3 or gs url>",
+    "digest": "<digest>"
+}`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blob was imported, or already existed in the repository.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<blob location>",
+										Description: "The location of the imported blob.",
+									},
+									digestHeader,
+									{
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "application/json",
+										Description: "The descriptor of the blob is JSON encoded.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+    "mediaType": "<media type>",
+    "size": <size>,
+    "digest": "<digest>"
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The body is malformed, has an invalid digest, or a URL the registry does not import from, or the blob does not match the digest.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeDigestInvalid,
+									ErrorCodeBlobImportInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The blob could not be fetched from the URL.",
+								StatusCode:  http.StatusBadGateway,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobImportFailed,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
 	{
 		Name:        RouteNameBlobUpload,
 		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/",
@@ -1363,8 +2202,16 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The `Content-Range` specification cannot be accepted, either because it does not overlap with the current progress or it is invalid.",
+								Description: "The `Content-Range` specification cannot be accepted, either because it does not start at the end of the current progress or it is invalid. When the range leaves a gap or overlaps with the data received, the `Range` header reports the current progress, after which the client resumes the upload.",
 								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Range",
+										Type:        "header",
+										Format:      "0-<offset>",
+										Description: "Range indicating the current progress of the upload.",
+									},
+								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
@@ -1524,6 +2371,69 @@ var routeDescriptors = []RouteDescriptor{
 			},
 		},
 	},
+	{
+		Name:        RouteNameBlobUploadProgress,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/uploads/{uuid:[a-zA-Z0-9-_.=]+}/progress",
+		Entity:      "Blob Upload Progress",
+		Description: "Follow the progress of a blob upload, such as to display it while another client pushes the blob.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Stream the progress of the upload identified by `uuid` as server-sent events. A `progress` event is sent after the data of a request to the upload is written, and a `complete` event once the upload is completed or canceled, ending the stream.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							uuidParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The stream of the progress of the upload. The `total` is the size of the upload once the data of the current request is written, or -1 if unknown.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "text/event-stream",
+										Description: "The progress is streamed as server-sent events.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "text/event-stream",
+									Format: `event: progress
+data: {"written": <bytes>, "total": <bytes>}
+
+event: complete
+data: {"written": <bytes>, "total": <bytes>}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The upload is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUploadUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
 	{
 		Name:        RouteNameCatalog,
 		Path:        "/v2/_catalog",
@@ -1562,9 +2472,15 @@ var routeDescriptors = []RouteDescriptor{
 						},
 					},
 					{
-						Name:            "Catalog Fetch Paginated",
-						Description:     "Return the specified portion of repositories.",
-						QueryParameters: paginationParameters,
+						Name:        "Catalog Fetch Paginated",
+						Description: "Return the specified portion of repositories. At most 1000 repositories are returned, whatever the value of `n`.",
+						QueryParameters: append(paginationParameters, ParameterDescriptor{
+							Name:        "cursor",
+							Type:        "string",
+							Description: "Opaque cursor from the `Link` header of a previous response, after which the result set starts. Takes precedence over last.",
+							Format:      "<cursor>",
+							Required:    false,
+						}),
 						Successes: []ResponseDescriptor{
 							{
 								StatusCode: http.StatusOK,
@@ -1575,7 +2491,6 @@ var routeDescriptors = []RouteDescriptor{
 		<name>,
 		...
 	]
-	"next": "<url>?last=<name>&n=<last value of n>"
 }`,
 								},
 								Headers: []ParameterDescriptor{
@@ -1585,9 +2500,267 @@ var routeDescriptors = []RouteDescriptor{
 										Description: "Length of the JSON response body.",
 										Format:      "<length>",
 									},
-									linkHeader,
+									{
+										Name:        "Link",
+										Type:        "link",
+										Description: "RFC5988 compliant rel='next' with URL to next result set, if available",
+										Format:      `<<url>?n=<last n value>&cursor=<cursor after the last entry from response>>; rel="next"`,
+									},
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid pagination cursor",
+								Description: "The cursor parameter was not returned by the registry. The client should restart the pagination.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodePaginationCursorInvalid,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameHPAMetrics,
+		Path:        "/v2/admin/metrics/hpa",
+		Entity:      "HPA Metrics",
+		Description: "Report the load metrics used to autoscale registry instances. The same values are exported to Prometheus, this endpoint is meant for debugging.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Retrieve the current values of the autoscaling metrics of the registry instance serving the request.",
+				Requests: []RequestDescriptor{
+					{
+						Name: "HPA Metrics Fetch",
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The current metric values.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"registry_active_blob_uploads": <count>,
+	"registry_active_manifest_pushes": <count>,
+	"registry_blob_pull_queue_depth": <count>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameTagLock,
+		Path:        "/v2/admin/tags/{name:" + reference.NameRegexp.String() + "}/{tag:" + reference.TagRegexp.String() + "}/lock",
+		Entity:      "Tag Lock",
+		Description: "Lock tags against being overwritten, such that automated systems cannot move protected tags. Requires the `registry:admin:write` scope, and fails with `UNSUPPORTED` unless the registry is configured with the `token` access controller.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPost,
+				Description: "Lock the tag. Pushing a manifest with a locked tag, deleting the tag or deleting the manifest it points to then fails with `TAG_LOCKED`, unless the client has the `registry:admin:write` scope. The tag needs not exist yet.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							tagParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The tag has been locked.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      http.MethodDelete,
+				Description: "Unlock the tag. Unlocking a tag which is not locked succeeds.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							tagParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The tag has been unlocked.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepositoryArchive,
+		Path:        "/v2/admin/repositories/{name:" + reference.NameRegexp.String() + "}/archive",
+		Entity:      "Repository Archive",
+		Description: "Archive repositories to the cold storage, which makes them read-only. Requires the `registry:admin:write` scope, and fails with `UNSUPPORTED` unless the registry is configured with the `token` access controller.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPost,
+				Description: "Archive the repository. Its manifests, tags and blobs are copied to the cold storage, and pushing to, deleting from or tagging in the repository then fails with `REPOSITORY_ARCHIVED`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "remove",
+								Type:        "boolean",
+								Format:      "true",
+								Description: "Remove the content of the repository from the registry storage once archived. The blobs it links are left to the garbage collection.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The repository has been archived.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Type",
+										Type:        "string",
+										Format:      "application/json",
+										Description: "The archive record.",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format: `{
+	"archivedAt": "<time>",
+	"location": "<location>",
+	"removed": <true|false>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The repository is already archived.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeRepositoryArchived,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The repository is not known to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepositoryUnarchive,
+		Path:        "/v2/admin/repositories/{name:" + reference.NameRegexp.String() + "}/unarchive",
+		Entity:      "Repository Unarchive",
+		Description: "Restore repositories archived to the cold storage. Requires the `registry:admin:write` scope, and fails with `UNSUPPORTED` unless the registry is configured with the `token` access controller.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodPost,
+				Description: "Unarchive the repository. Its content is copied back from the cold storage if it was removed, and the repository is writable again.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The repository has been unarchived.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The repository is not archived.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
 								},
 							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
 						},
 					},
 				},
@@ -63,6 +63,37 @@ var (
 		HTTPStatusCode: http.StatusBadRequest,
 	})
 
+	// ErrorCodeTagConflict is returned when the tag of a manifest differs
+	// only in case from an existing tag.
+	ErrorCodeTagConflict = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TAG_CONFLICT",
+		Message: "tag conflicts with an existing tag",
+		Description: `During a manifest upload, if the tag differs only in case
+		from an existing tag of the repository, this error will be returned.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
+	// ErrorCodeTagLocked is returned when the tag of a manifest is locked.
+	ErrorCodeTagLocked = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TAG_LOCKED",
+		Message: "tag is locked",
+		Description: `During a manifest upload or deletion, or a tag deletion,
+		if the tag is locked against being overwritten or removed by an
+		administrator, this error will be returned.`,
+		HTTPStatusCode: http.StatusLocked,
+	})
+
+	// ErrorCodeRepositoryArchived is returned when modifying an archived
+	// repository, or archiving it again.
+	ErrorCodeRepositoryArchived = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "REPOSITORY_ARCHIVED",
+		Message: "repository is archived",
+		Description: `Returned when pushing to, deleting from or tagging in a
+		repository archived by an administrator, which is read-only until it
+		is unarchived, or when archiving it again.`,
+		HTTPStatusCode: http.StatusMethodNotAllowed,
+	})
+
 	// ErrorCodeNameUnknown when the repository name is not known.
 	ErrorCodeNameUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "NAME_UNKNOWN",
@@ -81,6 +112,17 @@ var (
 		HTTPStatusCode: http.StatusNotFound,
 	})
 
+	// ErrorCodeManifestDeleted is returned when a manifest revision was
+	// deleted from the repository, and its deletion was recorded.
+	ErrorCodeManifestDeleted = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "MANIFEST_DELETED",
+		Message: "manifest deleted",
+		Description: `This error is returned when the manifest, identified by
+		digest, was deleted from the repository. The detail records when and
+		why it was deleted, and the manifest replacing it, if any.`,
+		HTTPStatusCode: http.StatusGone,
+	})
+
 	// ErrorCodeManifestInvalid returned when an image manifest is invalid,
 	// typically during a PUT operation. This error encompasses all errors
 	// encountered during manifest validation that aren't signature errors.
@@ -145,6 +187,61 @@ var (
 		HTTPStatusCode: http.StatusNotFound,
 	})
 
+	// ErrorCodeManifestUploadUnknown is returned when a manifest upload is
+	// unknown.
+	ErrorCodeManifestUploadUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "MANIFEST_UPLOAD_UNKNOWN",
+		Message: "manifest upload unknown to registry",
+		Description: `If a manifest upload has been committed, cancelled
+		or was never started, this error code may be returned.`,
+		HTTPStatusCode: http.StatusNotFound,
+	})
+
+	// ErrorCodeChainDepthInvalid is returned when the `depth` parameter of
+	// a manifest chain request is not a positive integer.
+	ErrorCodeChainDepthInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "CHAIN_DEPTH_INVALID",
+		Message: "invalid manifest chain depth",
+		Description: `Returned when the "depth" parameter (number of subjects
+		to follow) of a manifest chain request is not an integer, or is not
+		positive.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeBlobBatchInvalid is returned when the body of a batched blob
+	// existence check is malformed, or lists too many digests.
+	ErrorCodeBlobBatchInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_BATCH_INVALID",
+		Message: "invalid blob batch",
+		Description: `Returned when the body of a batched blob existence
+		check is not a valid JSON object listing digests, or lists more digests
+		than the registry accepts in a single request.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeBlobImportInvalid is returned when the body of a blob import
+	// is malformed, or its URL may not be imported from.
+	ErrorCodeBlobImportInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_IMPORT_INVALID",
+		Message: "invalid blob import",
+		Description: `Returned when the body of a blob import is not a
+		valid JSON object with a URL and a digest, when the URL is not one
+		the registry imports blobs from, or when the blob is larger than the
+		registry accepts.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
+	// ErrorCodeBlobImportFailed is returned when the blob of an import could
+	// not be fetched from its URL.
+	ErrorCodeBlobImportFailed = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_IMPORT_FAILED",
+		Message: "blob import failed",
+		Description: `Returned when the registry fails to fetch the blob
+		of an import from its URL, such as when the URL responds with an
+		error.`,
+		HTTPStatusCode: http.StatusBadGateway,
+	})
+
 	// ErrorCodePaginationNumberInvalid is returned when the `n` parameter is
 	// not an integer, or `n` is negative.
 	ErrorCodePaginationNumberInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
@@ -154,4 +251,14 @@ var (
 		to return) is not an integer, or "n" is negative.`,
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+
+	// ErrorCodePaginationCursorInvalid is returned when the `cursor`
+	// parameter was not returned by the registry.
+	ErrorCodePaginationCursorInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "PAGINATION_CURSOR_INVALID",
+		Message: "invalid pagination cursor",
+		Description: `Returned when the "cursor" parameter is not a
+		cursor returned by the registry in a pagination link.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
 )
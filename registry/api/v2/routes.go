@@ -1,6 +1,7 @@
 package v2
 
 import (
+	"net/http"
 	"sync"
 
 	"github.com/gorilla/mux"
@@ -9,13 +10,26 @@ import (
 // The following are definitions of the name under which all V2 routes are
 // registered. These symbols can be used to look up a route based on the name.
 const (
-	RouteNameBase            = "base"
-	RouteNameManifest        = "manifest"
-	RouteNameTags            = "tags"
-	RouteNameBlob            = "blob"
-	RouteNameBlobUpload      = "blob-upload"
-	RouteNameBlobUploadChunk = "blob-upload-chunk"
-	RouteNameCatalog         = "catalog"
+	RouteNameBase                = "base"
+	RouteNameAttestations        = "attestations"
+	RouteNameReferrers           = "referrers"
+	RouteNameManifest            = "manifest"
+	RouteNameManifestChain       = "manifest-chain"
+	RouteNameManifestUpload      = "manifest-upload"
+	RouteNameManifestUploadChunk = "manifest-upload-chunk"
+	RouteNameManifestValidate    = "manifest-validate"
+	RouteNameTags                = "tags"
+	RouteNameBlob                = "blob"
+	RouteNameBlobBatch           = "blob-batch"
+	RouteNameBlobImport          = "blob-import"
+	RouteNameBlobUpload          = "blob-upload"
+	RouteNameBlobUploadChunk     = "blob-upload-chunk"
+	RouteNameBlobUploadProgress  = "blob-upload-progress"
+	RouteNameCatalog             = "catalog"
+	RouteNameHPAMetrics          = "hpa-metrics"
+	RouteNameTagLock             = "tag-lock"
+	RouteNameRepositoryArchive   = "repository-archive"
+	RouteNameRepositoryUnarchive = "repository-unarchive"
 )
 
 var (
@@ -45,7 +59,13 @@ func RouterWithPrefix(prefix string) *mux.Router {
 	router.StrictSlash(true)
 
 	for _, descriptor := range routeDescriptors {
-		router.Path(descriptor.Path).Name(descriptor.Name)
+		route := router.Path(descriptor.Path).Name(descriptor.Name)
+		switch descriptor.Name {
+		case RouteNameManifestUpload, RouteNameManifestValidate:
+			// Only claim POST, so that "uploads" and "validate" remain
+			// usable as tags on the manifest route.
+			route.Methods(http.MethodPost)
+		}
 	}
 
 	return rootRouter
@@ -127,6 +127,14 @@ func TestRouter(t *testing.T) {
 				"uuid": "RDk1MzA2RkEtRkFEMy00RTM2LThENDEtQ0YxQzkzRUY4Mjg2IA==",
 			},
 		},
+		{
+			RouteName:  RouteNameBlobUploadProgress,
+			RequestURI: "/v2/foo/bar/blobs/uploads/D95306FA-FAD3-4E36-8D41-CF1C93EF8286/progress",
+			Vars: map[string]string{
+				"name": "foo/bar",
+				"uuid": "D95306FA-FAD3-4E36-8D41-CF1C93EF8286",
+			},
+		},
 		{
 			// supports urlsafe base64
 			RouteName:  RouteNameBlobUploadChunk,
@@ -142,6 +150,71 @@ func TestRouter(t *testing.T) {
 			RequestURI: "/v2/foo/bar/blobs/uploads/totalandcompletejunk++$$-==",
 			StatusCode: http.StatusNotFound,
 		},
+		{
+			RouteName:  RouteNameManifestUploadChunk,
+			RequestURI: "/v2/foo/bar/manifests/uploads/D95306FA-FAD3-4E36-8D41-CF1C93EF8286",
+			Vars: map[string]string{
+				"name": "foo/bar",
+				"uuid": "D95306FA-FAD3-4E36-8D41-CF1C93EF8286",
+			},
+		},
+		{
+			// The manifest upload route only claims POST, so "uploads" is
+			// still a valid tag for pulls.
+			RouteName:  RouteNameManifest,
+			RequestURI: "/v2/foo/bar/manifests/uploads",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "uploads",
+			},
+		},
+		{
+			// The manifest validation route only claims POST, so
+			// "validate" is still a valid tag for pulls.
+			RouteName:  RouteNameManifest,
+			RequestURI: "/v2/foo/bar/manifests/validate",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "validate",
+			},
+		},
+		{
+			RouteName:  RouteNameManifestChain,
+			RequestURI: "/v2/foo/bar/manifests/sha256:abcdef0123456789/chain",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0123456789",
+			},
+		},
+		{
+			RouteName:  RouteNameAttestations,
+			RequestURI: "/v2/foo/bar/attestations/sha256:abcdef0123456789",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0123456789",
+			},
+		},
+		{
+			RouteName:  RouteNameReferrers,
+			RequestURI: "/v2/foo/bar/referrers/sha256:abcdef0123456789",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0123456789",
+			},
+		},
+		{
+			RouteName:  RouteNameHPAMetrics,
+			RequestURI: "/v2/admin/metrics/hpa",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameTagLock,
+			RequestURI: "/v2/admin/tags/foo/bar/latest/lock",
+			Vars: map[string]string{
+				"name": "foo/bar",
+				"tag":  "latest",
+			},
+		},
 		{
 			// Check ambiguity: ensure we can distinguish between tags for
 			// "foo/bar/image/image" and image for "foo/bar/image" with tag
@@ -127,6 +127,58 @@ func (ub *URLBuilder) BuildCatalogURL(values ...url.Values) (string, error) {
 	return appendValuesURL(catalogURL, values...).String(), nil
 }
 
+// BuildHPAMetricsURL constructs a url to retrieve the autoscaling metrics of
+// the registry.
+func (ub *URLBuilder) BuildHPAMetricsURL() (string, error) {
+	route := ub.cloneRoute(RouteNameHPAMetrics)
+
+	metricsURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return metricsURL.String(), nil
+}
+
+// BuildTagLockURL constructs a url to lock or unlock the tag of the named
+// repository.
+func (ub *URLBuilder) BuildTagLockURL(name reference.Named, tag string) (string, error) {
+	route := ub.cloneRoute(RouteNameTagLock)
+
+	lockURL, err := route.URL("name", name.Name(), "tag", tag)
+	if err != nil {
+		return "", err
+	}
+
+	return lockURL.String(), nil
+}
+
+// BuildRepositoryArchiveURL constructs a url to archive the named
+// repository.
+func (ub *URLBuilder) BuildRepositoryArchiveURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameRepositoryArchive)
+
+	archiveURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(archiveURL, values...).String(), nil
+}
+
+// BuildRepositoryUnarchiveURL constructs a url to unarchive the named
+// repository.
+func (ub *URLBuilder) BuildRepositoryUnarchiveURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameRepositoryUnarchive)
+
+	unarchiveURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return unarchiveURL.String(), nil
+}
+
 // BuildTagsURL constructs a url to list the tags in the named repository.
 func (ub *URLBuilder) BuildTagsURL(name reference.Named, values ...url.Values) (string, error) {
 	route := ub.cloneRoute(RouteNameTags)
@@ -162,6 +214,110 @@ func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
 	return manifestURL.String(), nil
 }
 
+// BuildManifestChainURL constructs a url for the chain of the manifest
+// identified by the digest of ref, following the subjects of the manifests.
+func (ub *URLBuilder) BuildManifestChainURL(ref reference.Canonical, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestChain)
+
+	chainURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(chainURL, values...).String(), nil
+}
+
+// BuildAttestationsURL constructs a url for the bundle of the attestations
+// of the manifest identified by the digest of ref.
+func (ub *URLBuilder) BuildAttestationsURL(ref reference.Canonical) (string, error) {
+	route := ub.cloneRoute(RouteNameAttestations)
+
+	attestationsURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return attestationsURL.String(), nil
+}
+
+// BuildReferrersURL constructs a url for the referrers of the manifest
+// identified by the digest of ref.
+func (ub *URLBuilder) BuildReferrersURL(ref reference.Canonical, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameReferrers)
+
+	referrersURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(referrersURL, values...).String(), nil
+}
+
+// BuildBlobBatchURL constructs a url to check the existence of several
+// blobs in the repository identified by name.
+func (ub *URLBuilder) BuildBlobBatchURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameBlobBatch)
+
+	batchURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return batchURL.String(), nil
+}
+
+// BuildBlobImportURL constructs a url to import a blob from a URL into the
+// repository identified by name.
+func (ub *URLBuilder) BuildBlobImportURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameBlobImport)
+
+	importURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return importURL.String(), nil
+}
+
+// BuildManifestUploadURL constructs a url to begin a manifest upload in the
+// repository identified by name.
+func (ub *URLBuilder) BuildManifestUploadURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestUpload)
+
+	uploadURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return uploadURL.String(), nil
+}
+
+// BuildManifestValidateURL constructs a url to validate a manifest without
+// storing it in the repository identified by name.
+func (ub *URLBuilder) BuildManifestValidateURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestValidate)
+
+	validateURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return validateURL.String(), nil
+}
+
+// BuildManifestUploadChunkURL constructs a url for the manifest upload
+// identified by uuid, including any url values.
+func (ub *URLBuilder) BuildManifestUploadChunkURL(name reference.Named, uuid string, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestUploadChunk)
+
+	uploadURL, err := route.URL("name", name.Name(), "uuid", uuid)
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(uploadURL, values...).String(), nil
+}
+
 // BuildBlobURL constructs the url for the blob identified by name and dgst.
 func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
 	route := ub.cloneRoute(RouteNameBlob)
@@ -202,6 +358,19 @@ func (ub *URLBuilder) BuildBlobUploadChunkURL(name reference.Named, uuid string,
 	return appendValuesURL(uploadURL, values...).String(), nil
 }
 
+// BuildBlobUploadProgressURL constructs a url to follow the progress of the
+// upload identified by uuid in the repository identified by name.
+func (ub *URLBuilder) BuildBlobUploadProgressURL(name reference.Named, uuid string, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameBlobUploadProgress)
+
+	progressURL, err := route.URL("name", name.Name(), "uuid", uuid)
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(progressURL, values...).String(), nil
+}
+
 // clondedRoute returns a clone of the named route from the router. Routes
 // must be cloned to avoid modifying them during url generation.
 func (ub *URLBuilder) cloneRoute(name string) clonedRoute {
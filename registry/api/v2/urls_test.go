@@ -26,6 +26,12 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 			expectedErr:  nil,
 			build:        urlBuilder.BuildBaseURL,
 		},
+		{
+			description:  "test hpa metrics url",
+			expectedPath: "/v2/admin/metrics/hpa",
+			expectedErr:  nil,
+			build:        urlBuilder.BuildHPAMetricsURL,
+		},
 		{
 			description:  "test tags url",
 			expectedPath: "/v2/foo/bar/tags/list",
@@ -71,6 +77,24 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildManifestURL(fooBarRef)
 			},
 		},
+		{
+			description:  "build manifest upload url",
+			expectedPath: "/v2/foo/bar/manifests/uploads",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildManifestUploadURL(fooBarRef)
+			},
+		},
+		{
+			description:  "build manifest upload chunk url",
+			expectedPath: "/v2/foo/bar/manifests/uploads/uuid-part?digest=sha256%3A3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildManifestUploadChunkURL(fooBarRef, "uuid-part", url.Values{
+					"digest": []string{"sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5"},
+				})
+			},
+		},
 		{
 			description:  "build blob url",
 			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
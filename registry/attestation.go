@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/attestation"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/spf13/cobra"
+)
+
+var (
+	attestationPredicate     string
+	attestationPredicateType string
+	attestationKey           string
+	attestationUsername      string
+	attestationPassword      string
+	attestationPlainHTTP     bool
+)
+
+func init() {
+	AttestationCmd.AddCommand(AttestationPushCmd)
+	AttestationCmd.AddCommand(AttestationVerifyCmd)
+	AttestationCmd.PersistentFlags().StringVarP(&attestationUsername, "username", "u", "", "username for the registry")
+	AttestationCmd.PersistentFlags().StringVarP(&attestationPassword, "password", "p", "", "password for the registry")
+	AttestationCmd.PersistentFlags().BoolVar(&attestationPlainHTTP, "plain-http", false, "connect to the registry over plain HTTP")
+	AttestationPushCmd.Flags().StringVar(&attestationPredicate, "predicate", "", "path of the JSON predicate")
+	AttestationPushCmd.Flags().StringVar(&attestationPredicateType, "predicate-type", "https://slsa.dev/provenance/v0.2", "type of the predicate")
+	AttestationPushCmd.Flags().StringVar(&attestationKey, "key", "", "path of the PEM encoded private key signing the attestation")
+	AttestationVerifyCmd.Flags().StringVar(&attestationKey, "key", "", "path of the PEM encoded public key verifying the attestations")
+	AttestationPushCmd.MarkFlagRequired("predicate")
+	AttestationPushCmd.MarkFlagRequired("key")
+	AttestationVerifyCmd.MarkFlagRequired("key")
+}
+
+func attestationOptions() attestation.Options {
+	return attestation.Options{
+		Auth: remote.AuthConfig{
+			Username: attestationUsername,
+			Password: attestationPassword,
+		},
+		PlainHTTP: attestationPlainHTTP,
+	}
+}
+
+// AttestationCmd is the cobra command that corresponds to the attestation
+// subcommand
+var AttestationCmd = &cobra.Command{
+	Use:   "attestation",
+	Short: "`attestation` manages the signed attestations of images",
+	Long:  "`attestation` manages the in-toto attestations of images, such as SLSA provenance, signed in DSSE envelopes.",
+}
+
+// AttestationPushCmd is the cobra command that corresponds to the attestation
+// push subcommand
+var AttestationPushCmd = &cobra.Command{
+	Use:   "push --predicate <file> [--predicate-type <type>] --key <file> <ref>",
+	Short: "`push` attests an image",
+	Long: "`push` wraps the predicate in an in-toto statement about the image referenced by <ref>, signs it " +
+		"in a DSSE envelope, and pushes it as an OCI artifact next to the image.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		predicate, err := os.ReadFile(attestationPredicate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read predicate: %v\n", err)
+			os.Exit(1)
+		}
+		key, err := attestation.LoadPrivateKey(attestationKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load key: %v\n", err)
+			os.Exit(1)
+		}
+
+		desc, err := attestation.Push(dcontext.Background(), args[0], attestationPredicateType, predicate, key, attestationOptions())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to push attestation: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(desc.Digest)
+	},
+}
+
+// AttestationVerifyCmd is the cobra command that corresponds to the
+// attestation verify subcommand
+var AttestationVerifyCmd = &cobra.Command{
+	Use:   "verify --key <file> <ref>",
+	Short: "`verify` verifies the attestations of an image",
+	Long:  "`verify` fetches the attestations of the image referenced by <ref>, and prints the statements signed by the key.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := attestation.LoadPublicKey(attestationKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load key: %v\n", err)
+			os.Exit(1)
+		}
+
+		statements, err := attestation.Verify(dcontext.Background(), args[0], key, attestationOptions())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to verify attestations: %v\n", err)
+			os.Exit(1)
+		}
+
+		p, err := json.MarshalIndent(statements, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode statements: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(p))
+	},
+}
@@ -0,0 +1,275 @@
+// Package attestation pushes and verifies in-toto attestations of images,
+// such as SLSA provenance, stored as signed OCI artifacts next to the images
+// they describe.
+//
+// Attestations are in-toto statements wrapped in DSSE envelopes, pushed as
+// the layers of an OCI image manifest tagged after the digest of the
+// attested image, as cosign does for registries without the referrers API.
+package attestation
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/opencontainers/go-digest"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+const (
+	// MediaTypeEnvelope is the media type of the layers holding DSSE
+	// envelopes.
+	MediaTypeEnvelope = "application/vnd.dsse.envelope.v1+json"
+
+	// predicateTypeAnnotation annotates the layers with the predicate type of
+	// their statement.
+	predicateTypeAnnotation = "predicateType"
+)
+
+// Statement is an in-toto statement, whose predicate is left encoded.
+type Statement struct {
+	in_toto.StatementHeader
+	Predicate json.RawMessage `json:"predicate"`
+}
+
+// Options configures the connection to the registry.
+type Options struct {
+	// Auth holds the credentials for the registry.
+	Auth remote.AuthConfig
+
+	// PlainHTTP connects to the registry over HTTP rather than HTTPS.
+	PlainHTTP bool
+}
+
+// Tag returns the tag of the attestations of the image dgst.
+func Tag(dgst digest.Digest) string {
+	return fmt.Sprintf("%s-%s.att", dgst.Algorithm(), dgst.Hex())
+}
+
+// Push attests the image referenced by ref, by tag or digest, with predicate
+// of type predicateType. The statement is signed with key, and added to the
+// attestations of the image.
+func Push(ctx context.Context, ref, predicateType string, predicate []byte, key crypto.Signer, opts Options) (distribution.Descriptor, error) {
+	if !json.Valid(predicate) {
+		return distribution.Descriptor{}, errors.New("predicate is not valid JSON")
+	}
+
+	named, repo, subject, err := resolve(ctx, ref, opts)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	statement, err := json.Marshal(Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          in_toto.StatementInTotoV01,
+			PredicateType: predicateType,
+			Subject: []in_toto.Subject{{
+				Name:   named.Name(),
+				Digest: map[string]string{subject.Algorithm().String(): subject.Hex()},
+			}},
+		},
+		Predicate: predicate,
+	})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	envelope, err := Sign(statement, key)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	p, err := json.Marshal(envelope)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	blobs := repo.Blobs(ctx)
+	layer, err := blobs.Put(ctx, MediaTypeEnvelope, p)
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("pushing attestation: %v", err)
+	}
+	layer.MediaType = MediaTypeEnvelope
+	layer.Annotations = map[string]string{predicateTypeAnnotation: predicateType}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	existing, err := attestations(ctx, ms, subject)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	builder := ocischema.NewManifestBuilder(blobs, []byte("{}"), nil)
+	for _, desc := range append(existing, layer) {
+		if err := builder.AppendReference(desc); err != nil {
+			return distribution.Descriptor{}, err
+		}
+	}
+	m, err := builder.Build(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	dgst, err := ms.Put(ctx, m, distribution.WithTag(Tag(subject)))
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("pushing attestation manifest: %v", err)
+	}
+
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+// Verify returns the statements attesting the image referenced by ref, by tag
+// or digest, which are signed by key. Attestations signed by other keys are
+// ignored, and an error is returned if none is signed by key.
+func Verify(ctx context.Context, ref string, key crypto.PublicKey, opts Options) ([]Statement, error) {
+	_, repo, subject, err := resolve(ctx, ref, opts)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := attestations(ctx, ms, subject)
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("%s has no attestation", ref)
+	}
+
+	var (
+		statements []Statement
+		errs       []string
+	)
+	blobs := repo.Blobs(ctx)
+	for _, layer := range layers {
+		if layer.MediaType != MediaTypeEnvelope {
+			continue
+		}
+		statement, err := verifyLayer(ctx, blobs, layer, subject, key)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", layer.Digest, err))
+			continue
+		}
+		statements = append(statements, statement)
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no verified attestation for %s: %s", ref, strings.Join(errs, "; "))
+	}
+	return statements, nil
+}
+
+// verifyLayer returns the statement of the envelope layer, once its
+// signature is verified and its subject matches the attested image.
+func verifyLayer(ctx context.Context, blobs distribution.BlobStore, layer distribution.Descriptor, subject digest.Digest, key crypto.PublicKey) (Statement, error) {
+	p, err := blobs.Get(ctx, layer.Digest)
+	if err != nil {
+		return Statement{}, err
+	}
+	var envelope dsse.Envelope
+	if err := json.Unmarshal(p, &envelope); err != nil {
+		return Statement{}, fmt.Errorf("invalid envelope: %v", err)
+	}
+	payload, err := Open(&envelope, key)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	var statement Statement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return Statement{}, fmt.Errorf("invalid statement: %v", err)
+	}
+	if statement.Type != in_toto.StatementInTotoV01 {
+		return Statement{}, fmt.Errorf("unexpected statement type %s", statement.Type)
+	}
+	for _, s := range statement.Subject {
+		if s.Digest[subject.Algorithm().String()] == subject.Hex() {
+			return statement, nil
+		}
+	}
+	return Statement{}, fmt.Errorf("statement does not apply to %s", subject)
+}
+
+// attestations returns the layers of the attestations of the image subject.
+func attestations(ctx context.Context, ms distribution.ManifestService, subject digest.Digest) ([]distribution.Descriptor, error) {
+	m, err := ms.Get(ctx, "", distribution.WithTag(Tag(subject)))
+	if err != nil {
+		if isManifestUnknown(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fetching attestations: %v", err)
+	}
+	im, ok := m.(*ocischema.DeserializedManifest)
+	if !ok {
+		return nil, fmt.Errorf("unexpected attestation manifest type %T", m)
+	}
+	return im.Layers, nil
+}
+
+// resolve returns the parsed ref, its repository, and the digest of the
+// manifest it references.
+func resolve(ctx context.Context, ref string, opts Options) (reference.Named, distribution.Repository, digest.Digest, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	scheme := "https"
+	if opts.PlainHTTP {
+		scheme = "http"
+	}
+	name, err := reference.WithName(reference.Path(named))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	repo, err := remote.NewRepository(name, &url.URL{Scheme: scheme, Host: reference.Domain(named)}, opts.Auth)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	switch ref := named.(type) {
+	case reference.Canonical:
+		return named, repo, ref.Digest(), nil
+	case reference.Tagged:
+		desc, err := repo.Tags(ctx).Get(ctx, ref.Tag())
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("resolving %s: %v", ref, err)
+		}
+		return named, repo, desc.Digest, nil
+	}
+	return nil, nil, "", fmt.Errorf("%s: reference must be tagged or referenced by digest", ref)
+}
+
+// isManifestUnknown reports whether err is the error of the registry for an
+// unknown manifest.
+func isManifestUnknown(err error) bool {
+	var errs errcode.Errors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, err := range errs {
+		if e, ok := err.(errcode.Error); ok && e.Code == v2.ErrorCodeManifestUnknown {
+			return true
+		}
+	}
+	return false
+}
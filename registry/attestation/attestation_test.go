@@ -0,0 +1,213 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/registrytest"
+	"github.com/in-toto/in-toto-golang/in_toto"
+)
+
+const slsaProvenance = "https://slsa.dev/provenance/v0.2"
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestPushAndVerify(t *testing.T) {
+	ctx := context.Background()
+	base := registrytest.New(t)
+	host := base.Host
+	repo := registrytest.Repository(t, base, "foo/app", nil)
+	dgst := registrytest.PushImage(t, repo, "1.0", "amd64", []byte("1.0")).Digest
+	opts := Options{PlainHTTP: true}
+
+	predicate, err := os.ReadFile(filepath.Join("testdata", "provenance.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := generateKey(t)
+	if _, err := Push(ctx, host+"/foo/app:1.0", slsaProvenance, predicate, key, opts); err != nil {
+		t.Fatalf("error pushing attestation: %v", err)
+	}
+
+	// A second attestation, signed by another key, is added next to the
+	// first one.
+	otherKey := generateKey(t)
+	if _, err := Push(ctx, host+"/foo/app@"+dgst.String(), "https://example.com/test/v1", []byte(`{"passed":true}`), otherKey, opts); err != nil {
+		t.Fatalf("error pushing attestation: %v", err)
+	}
+
+	for _, ref := range []string{host + "/foo/app:1.0", host + "/foo/app@" + dgst.String()} {
+		statements, err := Verify(ctx, ref, key.Public(), opts)
+		if err != nil {
+			t.Fatalf("error verifying %s: %v", ref, err)
+		}
+		if len(statements) != 1 {
+			t.Fatalf("expected 1 statement signed by the key, got %d", len(statements))
+		}
+
+		statement := statements[0]
+		if statement.Type != in_toto.StatementInTotoV01 || statement.PredicateType != slsaProvenance {
+			t.Errorf("unexpected statement types %s and %s", statement.Type, statement.PredicateType)
+		}
+		if len(statement.Subject) != 1 || statement.Subject[0].Name != host+"/foo/app" ||
+			statement.Subject[0].Digest["sha256"] != dgst.Hex() {
+			t.Errorf("unexpected subject %+v", statement.Subject)
+		}
+		var expected, actual bytes.Buffer
+		if err := json.Compact(&expected, predicate); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Compact(&actual, statement.Predicate); err != nil {
+			t.Fatal(err)
+		}
+		if expected.String() != actual.String() {
+			t.Errorf("unexpected predicate %s", actual.String())
+		}
+	}
+
+	statements, err := Verify(ctx, host+"/foo/app:1.0", otherKey.Public(), opts)
+	if err != nil || len(statements) != 1 || statements[0].PredicateType != "https://example.com/test/v1" {
+		t.Fatalf("unexpected statements signed by the other key: %+v, %v", statements, err)
+	}
+
+	if _, err := Verify(ctx, host+"/foo/app:1.0", generateKey(t).Public(), opts); err == nil {
+		t.Fatal("expected verification with an unknown key to fail")
+	}
+}
+
+func TestVerifyWithoutAttestation(t *testing.T) {
+	base := registrytest.New(t)
+	host := base.Host
+	registrytest.PushImage(t, registrytest.Repository(t, base, "foo/app", nil), "1.0", "amd64", []byte("1.0"))
+
+	_, err := Verify(context.Background(), host+"/foo/app:1.0", generateKey(t).Public(), Options{PlainHTTP: true})
+	if err == nil || !strings.Contains(err.Error(), "no attestation") {
+		t.Fatalf("expected a missing attestation error, got %v", err)
+	}
+}
+
+func TestVerifyRejectsOtherSubject(t *testing.T) {
+	ctx := context.Background()
+	base := registrytest.New(t)
+	host := base.Host
+	repo := registrytest.Repository(t, base, "foo/app", nil)
+	opts := Options{PlainHTTP: true}
+	key := generateKey(t)
+
+	registrytest.PushImage(t, repo, "1.0", "amd64", []byte("1.0"))
+	other := registrytest.PushImage(t, repo, "2.0", "amd64", []byte("2.0")).Digest
+	if _, err := Push(ctx, host+"/foo/app:1.0", slsaProvenance, []byte(`{}`), key, opts); err != nil {
+		t.Fatalf("error pushing attestation: %v", err)
+	}
+
+	// Copy the attestations of 1.0 to 2.0.
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := repo.Tags(ctx).Get(ctx, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ms.Get(ctx, "", distribution.WithTag(Tag(desc.Digest)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Put(ctx, m, distribution.WithTag(Tag(other))); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Verify(ctx, host+"/foo/app:2.0", key.Public(), opts)
+	if err == nil || !strings.Contains(err.Error(), "does not apply") {
+		t.Fatalf("expected a subject mismatch error, got %v", err)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []crypto.Signer{generateKey(t), edKey} {
+		envelope, err := Sign([]byte(`{"_type":"test"}`), key)
+		if err != nil {
+			t.Fatalf("%T: error signing: %v", key, err)
+		}
+		if envelope.PayloadType != in_toto.PayloadType {
+			t.Fatalf("%T: unexpected payload type %s", key, envelope.PayloadType)
+		}
+		payload, err := Open(envelope, key.Public())
+		if err != nil || string(payload) != `{"_type":"test"}` {
+			t.Fatalf("%T: unexpected verification result %q, %v", key, payload, err)
+		}
+		if _, err := Open(envelope, generateKey(t).Public()); err != ErrSignatureInvalid {
+			t.Fatalf("%T: expected an invalid signature with another key, got %v", key, err)
+		}
+
+		// The payload type is signed along with the payload.
+		envelope.PayloadType = "application/json"
+		if _, err := Open(envelope, key.Public()); err == nil {
+			t.Fatalf("%T: expected an error opening an envelope of another payload type", key)
+		}
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	key := generateKey(t)
+	dir := t.TempDir()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePath := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPath := filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := LoadPrivateKey(privatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := LoadPublicKey(publicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := Sign([]byte("{}"), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(envelope, public); err != nil {
+		t.Fatalf("error verifying with the loaded public key: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+// Package bundle aggregates the attestations attached to a manifest, such as
+// its SLSA provenance, its SBOMs and its vulnerability scans, into a single
+// document.
+//
+// Attestations are found among the referrers of the manifest, and in the
+// manifest tagged after its digest, as pushed by cosign and the attestation
+// package for registries without the referrers API.
+package bundle
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// mediaTypeEnvelope is the media type of the layers holding DSSE
+	// envelopes.
+	mediaTypeEnvelope = "application/vnd.dsse.envelope.v1+json"
+
+	// mediaTypeSPDX and mediaTypeCycloneDX are the media types of the layers
+	// holding SBOM documents.
+	mediaTypeSPDX      = "application/spdx+json"
+	mediaTypeCycloneDX = "application/vnd.cyclonedx+json"
+
+	// payloadTypeInToto is the DSSE payload type of in-toto statements.
+	payloadTypeInToto = "application/vnd.in-toto+json"
+
+	// maxContentSize bounds the size of the layers read to classify them
+	// and included in bundles.
+	maxContentSize = 4 << 20
+)
+
+// predicateTypeAnnotations annotate the layers with the predicate type of
+// their statement.
+var predicateTypeAnnotations = []string{"predicateType", "in-toto.io/predicate-type"}
+
+// AttestationBundle holds the attestations attached to a manifest.
+type AttestationBundle struct {
+	// Manifest describes the attested manifest.
+	Manifest distribution.Descriptor `json:"manifest"`
+
+	// Provenance holds the SLSA provenance attestations of the manifest.
+	Provenance []Attestation `json:"provenance"`
+
+	// SBOM holds the SPDX and CycloneDX SBOMs of the manifest.
+	SBOM []Attestation `json:"sbom"`
+
+	// VulnScan holds the vulnerability scan attestations of the manifest.
+	VulnScan []Attestation `json:"vulnScan"`
+}
+
+// Attestation is an attestation attached to a manifest. Its content is
+// included as stored, without verifying its signatures, which is left to the
+// clients.
+type Attestation struct {
+	// Referrer describes the manifest carrying the attestation.
+	Referrer distribution.Descriptor `json:"referrer"`
+
+	// Descriptor describes the layer of the referrer holding the
+	// attestation.
+	Descriptor distribution.Descriptor `json:"descriptor"`
+
+	// PredicateType is the predicate type of the in-toto statement of the
+	// attestation, if any.
+	PredicateType string `json:"predicateType,omitempty"`
+
+	// Content is the content of the layer, omitted when it is too large or
+	// is not JSON.
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+// category is the category of the attestations of a bundle.
+type category int
+
+const (
+	categoryNone category = iota
+	categoryProvenance
+	categorySBOM
+	categoryVulnScan
+)
+
+// Build returns the bundle of the attestations attached to the manifest dgst
+// of repo. Referrers which do not hold attestations of a known category are
+// left out.
+func Build(ctx context.Context, repo distribution.Repository, dgst digest.Digest) (*AttestationBundle, error) {
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ms.Get(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return nil, err
+	}
+	bundle := &AttestationBundle{
+		Manifest: distribution.Descriptor{
+			MediaType: mediaType,
+			Digest:    dgst,
+			Size:      int64(len(payload)),
+		},
+		Provenance: []Attestation{},
+		SBOM:       []Attestation{},
+		VulnScan:   []Attestation{},
+	}
+
+	referrers, err := storage.Referrers(ctx, repo, dgst)
+	if err != nil && err != distribution.ErrUnsupported {
+		return nil, err
+	}
+	desc, err := repo.Tags(ctx).Get(ctx, fmt.Sprintf("%s-%s.att", dgst.Algorithm(), dgst.Encoded()))
+	switch err.(type) {
+	case nil:
+		referrers = append(referrers, desc.Digest)
+	case distribution.ErrTagUnknown:
+	default:
+		return nil, err
+	}
+
+	seen := make(map[digest.Digest]bool)
+	for _, referrer := range referrers {
+		if seen[referrer] {
+			continue
+		}
+		seen[referrer] = true
+		if err := bundle.add(ctx, repo, ms, referrer); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+// add adds the attestations held by the manifest referrer to the bundle.
+func (b *AttestationBundle) add(ctx context.Context, repo distribution.Repository, ms distribution.ManifestService, referrer digest.Digest) error {
+	m, err := ms.Get(ctx, referrer)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			return nil
+		}
+		return err
+	}
+	om, ok := m.(*ocischema.DeserializedManifest)
+	if !ok {
+		return nil
+	}
+	mediaType, payload, err := om.Payload()
+	if err != nil {
+		return err
+	}
+	referrerDesc := distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    referrer,
+		Size:      int64(len(payload)),
+	}
+
+	blobs := repo.Blobs(ctx)
+	for _, layer := range om.Layers {
+		attestation := Attestation{
+			Referrer:   referrerDesc,
+			Descriptor: layer,
+		}
+		for _, annotation := range predicateTypeAnnotations {
+			if predicateType := layer.Annotations[annotation]; predicateType != "" {
+				attestation.PredicateType = predicateType
+				break
+			}
+		}
+		if layer.Size <= maxContentSize {
+			p, err := blobs.Get(ctx, layer.Digest)
+			if err != nil {
+				if err == distribution.ErrBlobUnknown {
+					continue
+				}
+				return err
+			}
+			if json.Valid(p) {
+				attestation.Content = p
+				if attestation.PredicateType == "" {
+					attestation.PredicateType = predicateType(layer.MediaType, p)
+				}
+			}
+		}
+
+		mediaType := layer.MediaType
+		if mediaType == "" || mediaType == "application/octet-stream" {
+			mediaType = om.Config.MediaType
+		}
+		switch classify(mediaType, attestation.PredicateType) {
+		case categoryProvenance:
+			b.Provenance = append(b.Provenance, attestation)
+		case categorySBOM:
+			b.SBOM = append(b.SBOM, attestation)
+		case categoryVulnScan:
+			b.VulnScan = append(b.VulnScan, attestation)
+		}
+	}
+	return nil
+}
+
+// predicateType returns the predicate type of the in-toto statement p holds,
+// either as is or in a DSSE envelope, or an empty string.
+func predicateType(mediaType string, p []byte) string {
+	var envelope struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+	}
+	if err := json.Unmarshal(p, &envelope); err == nil && envelope.PayloadType != "" {
+		if envelope.PayloadType != payloadTypeInToto {
+			return ""
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return ""
+		}
+		p = payload
+	} else if mediaType == mediaTypeEnvelope {
+		return ""
+	}
+
+	var statement struct {
+		Type          string `json:"_type"`
+		PredicateType string `json:"predicateType"`
+	}
+	if err := json.Unmarshal(p, &statement); err != nil || !strings.HasPrefix(statement.Type, "https://in-toto.io/Statement/") {
+		return ""
+	}
+	return statement.PredicateType
+}
+
+// classify returns the category of the attestation of media type mediaType
+// with the predicate type predicateType.
+func classify(mediaType, predicateType string) category {
+	switch {
+	case strings.HasPrefix(predicateType, "https://slsa.dev/provenance/"):
+		return categoryProvenance
+	case strings.HasPrefix(predicateType, "https://spdx.dev/Document"),
+		strings.HasPrefix(predicateType, "https://cyclonedx.org/bom"):
+		return categorySBOM
+	case predicateType == "https://cosign.sigstore.dev/attestation/vuln/v1",
+		strings.HasPrefix(predicateType, "https://in-toto.io/attestation/vulns"):
+		return categoryVulnScan
+	case predicateType != "":
+		return categoryNone
+	}
+
+	switch mediaType {
+	case mediaTypeSPDX, mediaTypeCycloneDX:
+		return categorySBOM
+	}
+	return categoryNone
+}
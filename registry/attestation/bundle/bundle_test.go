@@ -0,0 +1,245 @@
+package bundle
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	slsaProvenance = "https://slsa.dev/provenance/v0.2"
+	cosignVuln     = "https://cosign.sigstore.dev/attestation/vuln/v1"
+)
+
+func newRepository(t *testing.T) distribution.Repository {
+	t.Helper()
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New(), storage.EnableDelete)
+	if err != nil {
+		t.Fatalf("unexpected error creating registry: %v", err)
+	}
+	named, _ := reference.WithName("foo/bundle")
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	return repo
+}
+
+// putManifest stores an OCI manifest of layers, about subject if not nil and
+// tagged tag if not empty, and returns its descriptor.
+func putManifest(t *testing.T, repo distribution.Repository, subject *distribution.Descriptor, tag string, layers ...distribution.Descriptor) distribution.Descriptor {
+	t.Helper()
+	ctx := context.Background()
+
+	config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	config.MediaType = v1.MediaTypeImageConfig
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 2,
+			MediaType:     v1.MediaTypeImageManifest,
+		},
+		Config:  config,
+		Layers:  layers,
+		Subject: subject,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	dgst, err := ms.Put(ctx, m)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	_, payload, err := m.Payload()
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest payload: %v", err)
+	}
+	desc := distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst, Size: int64(len(payload))}
+	if tag != "" {
+		if err := repo.Tags(ctx).Tag(ctx, tag, desc); err != nil {
+			t.Fatalf("unexpected error tagging manifest: %v", err)
+		}
+	}
+	return desc
+}
+
+// putLayer stores content as a blob, and returns its descriptor as a layer
+// of media type mediaType with annotations.
+func putLayer(t *testing.T, repo distribution.Repository, mediaType string, content []byte, annotations map[string]string) distribution.Descriptor {
+	t.Helper()
+	ctx := context.Background()
+
+	desc, err := repo.Blobs(ctx).Put(ctx, mediaType, content)
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+	desc.MediaType = mediaType
+	desc.Annotations = annotations
+	return desc
+}
+
+func statement(t *testing.T, predicateType string) []byte {
+	t.Helper()
+	p, err := json.Marshal(map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"predicateType": predicateType,
+		"subject":       []interface{}{},
+		"predicate":     map[string]string{"fixture": predicateType},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error encoding statement: %v", err)
+	}
+	return p
+}
+
+func envelope(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	p, err := json.Marshal(map[string]interface{}{
+		"payloadType": payloadTypeInToto,
+		"payload":     base64.StdEncoding.EncodeToString(payload),
+		"signatures":  []map[string]string{{"keyid": "fixture", "sig": "c2ln"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error encoding envelope: %v", err)
+	}
+	return p
+}
+
+func checkAttestations(t *testing.T, kind string, attestations []Attestation, expected ...distribution.Descriptor) {
+	t.Helper()
+	if len(attestations) != len(expected) {
+		t.Fatalf("expected %d %s attestations, got %d", len(expected), kind, len(attestations))
+	}
+	found := make(map[digest.Digest]bool)
+	for _, attestation := range attestations {
+		found[attestation.Descriptor.Digest] = true
+		if len(attestation.Content) == 0 {
+			t.Fatalf("expected the content of %s attestation %s", kind, attestation.Descriptor.Digest)
+		}
+	}
+	for _, desc := range expected {
+		if !found[desc.Digest] {
+			t.Fatalf("expected %s attestation %s", kind, desc.Digest)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	image := putManifest(t, repo, nil, "latest", putLayer(t, repo, v1.MediaTypeImageLayer, []byte("layer"), nil))
+
+	// A DSSE envelope classified from its statement.
+	provenance := putLayer(t, repo, mediaTypeEnvelope, envelope(t, statement(t, slsaProvenance)), nil)
+	provenanceReferrer := putManifest(t, repo, &image, "", provenance)
+
+	// An SBOM classified from its media type, next to an unrelated layer.
+	sbom := putLayer(t, repo, mediaTypeSPDX, []byte(`{"spdxVersion":"SPDX-2.3"}`), nil)
+	putManifest(t, repo, &image, "", sbom, putLayer(t, repo, "application/vnd.example.other", []byte("{}"), nil))
+
+	// A statement classified from its annotation.
+	vulnScan := putLayer(t, repo, "application/vnd.in-toto+json", statement(t, cosignVuln), map[string]string{"predicateType": cosignVuln})
+	putManifest(t, repo, &image, "", vulnScan)
+
+	// A signature, which is not an attestation.
+	putManifest(t, repo, &image, "", putLayer(t, repo, "application/vnd.example.signature", []byte(`{"signature":"c2ln"}`), nil))
+
+	// Attestations tagged after the image, as cosign pushes them.
+	tagged := putLayer(t, repo, mediaTypeEnvelope, envelope(t, statement(t, "https://slsa.dev/provenance/v1")), map[string]string{"predicateType": "https://slsa.dev/provenance/v1"})
+	putManifest(t, repo, nil, fmt.Sprintf("sha256-%s.att", image.Digest.Encoded()), tagged)
+
+	// Attestations of another manifest are left out.
+	other := putManifest(t, repo, nil, "other", putLayer(t, repo, v1.MediaTypeImageLayer, []byte("other layer"), nil))
+	putManifest(t, repo, &other, "", putLayer(t, repo, mediaTypeEnvelope, envelope(t, statement(t, slsaProvenance)), nil))
+
+	bundle, err := Build(ctx, repo, image.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error building bundle: %v", err)
+	}
+	if bundle.Manifest.Digest != image.Digest || bundle.Manifest.MediaType != image.MediaType || bundle.Manifest.Size != image.Size {
+		t.Fatalf("unexpected manifest of the bundle: %+v != %+v", bundle.Manifest, image)
+	}
+	checkAttestations(t, "provenance", bundle.Provenance, provenance, tagged)
+	checkAttestations(t, "sbom", bundle.SBOM, sbom)
+	checkAttestations(t, "vulnerability scan", bundle.VulnScan, vulnScan)
+	for _, attestation := range bundle.Provenance {
+		if attestation.Descriptor.Digest == provenance.Digest {
+			if attestation.Referrer.Digest != provenanceReferrer.Digest {
+				t.Fatalf("unexpected referrer of the provenance: %s != %s", attestation.Referrer.Digest, provenanceReferrer.Digest)
+			}
+			if attestation.PredicateType != slsaProvenance {
+				t.Fatalf("unexpected predicate type of the provenance: %s", attestation.PredicateType)
+			}
+		}
+	}
+
+	// Deleted referrers are left out.
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	if err := ms.Delete(ctx, provenanceReferrer.Digest); err != nil {
+		t.Fatalf("unexpected error deleting referrer: %v", err)
+	}
+	bundle, err = Build(ctx, repo, image.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error building bundle: %v", err)
+	}
+	checkAttestations(t, "provenance", bundle.Provenance, tagged)
+
+	bundle, err = Build(ctx, repo, other.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error building bundle: %v", err)
+	}
+	if len(bundle.Provenance) != 1 || len(bundle.SBOM) != 0 || len(bundle.VulnScan) != 0 {
+		t.Fatalf("unexpected attestations of another manifest: %+v", bundle)
+	}
+
+	if _, err := Build(ctx, repo, provenanceReferrer.Digest); err == nil {
+		t.Fatal("expected an error building the bundle of a deleted manifest")
+	} else if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("unexpected error building the bundle of a deleted manifest: %v", err)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		mediaType     string
+		predicateType string
+		expected      category
+	}{
+		{mediaTypeEnvelope, "https://slsa.dev/provenance/v0.2", categoryProvenance},
+		{mediaTypeEnvelope, "https://spdx.dev/Document", categorySBOM},
+		{mediaTypeEnvelope, "https://cyclonedx.org/bom/v1.4", categorySBOM},
+		{mediaTypeEnvelope, "https://in-toto.io/attestation/vulns/v0.1", categoryVulnScan},
+		{mediaTypeEnvelope, cosignVuln, categoryVulnScan},
+		{mediaTypeEnvelope, "https://example.com/custom", categoryNone},
+		{mediaTypeSPDX, "", categorySBOM},
+		{mediaTypeCycloneDX, "", categorySBOM},
+		{mediaTypeSPDX, "https://example.com/custom", categoryNone},
+		{"application/vnd.example.signature", "", categoryNone},
+	} {
+		if c := classify(tc.mediaType, tc.predicateType); c != tc.expected {
+			t.Errorf("unexpected category of %s %q: %d != %d", tc.mediaType, tc.predicateType, c, tc.expected)
+		}
+	}
+}
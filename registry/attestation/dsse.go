@@ -0,0 +1,153 @@
+package attestation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// ErrSignatureInvalid is returned when no signature of an envelope verifies.
+var ErrSignatureInvalid = errors.New("no valid signature")
+
+// Sign wraps the in-toto statement in a DSSE envelope signed by key. ECDSA,
+// RSA and Ed25519 keys are supported.
+func Sign(statement []byte, key crypto.Signer) (*dsse.Envelope, error) {
+	switch key.Public().(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.Public())
+	}
+	signer, err := in_toto.NewDSSESigner(&signerVerifier{verifier: verifier{key: key.Public()}, signer: key})
+	if err != nil {
+		return nil, err
+	}
+	return signer.SignPayload(statement)
+}
+
+// Open returns the in-toto statement of the envelope, if one of its
+// signatures verifies with key.
+func Open(envelope *dsse.Envelope, key crypto.PublicKey) ([]byte, error) {
+	if envelope.PayloadType != in_toto.PayloadType {
+		return nil, fmt.Errorf("unexpected payload type %s", envelope.PayloadType)
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	ev, err := dsse.NewEnvelopeVerifier(verifier{key: key})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ev.Verify(envelope); err != nil {
+		return nil, ErrSignatureInvalid
+	}
+	return envelope.DecodeB64Payload()
+}
+
+// verifier verifies the signatures of the pre-authentication encoding of
+// envelopes, which sign its SHA-256 digest, or the encoding itself for
+// Ed25519 keys.
+type verifier struct {
+	key crypto.PublicKey
+}
+
+func (v verifier) Verify(data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	var ok bool
+	switch key := v.key.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, sig)
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+func (v verifier) KeyID() (string, error) {
+	return dsse.SHA256KeyID(v.key)
+}
+
+func (v verifier) Public() crypto.PublicKey {
+	return v.key
+}
+
+// signerVerifier signs the pre-authentication encoding of envelopes as
+// verifier verifies them.
+type signerVerifier struct {
+	verifier
+	signer crypto.Signer
+}
+
+func (sv *signerVerifier) Sign(data []byte) ([]byte, error) {
+	if _, ok := sv.key.(ed25519.PublicKey); ok {
+		return sv.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return sv.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// LoadPrivateKey reads the PEM encoded private key at path, in PKCS #8,
+// PKCS #1 or SEC 1 form.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported private key", path)
+}
+
+// LoadPublicKey reads the PEM encoded PKIX public key at path.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(p)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
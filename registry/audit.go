@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditRepository string
+	auditFix        bool
+	auditWorkers    int
+)
+
+func init() {
+	AuditCmd.Flags().StringVar(&auditRepository, "repository", "", "only audit the given repository")
+	AuditCmd.Flags().BoolVar(&auditFix, "fix", false, "remove the link files pointing to missing blobs")
+	AuditCmd.Flags().IntVar(&auditWorkers, "workers", 4, "number of link files checked concurrently")
+}
+
+// AuditCmd is the cobra command that corresponds to the audit subcommand
+var AuditCmd = &cobra.Command{
+	Use:   "audit [--repository <name>] [--fix] <config>",
+	Short: "`audit` checks the consistency of the repositories of the storage",
+	Long: "`audit` checks that every link file of the repositories points to an existing blob, that the linked manifests " +
+		"can be parsed, and that the blobs they reference exist. The report is printed as JSON.",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		report, err := storage.Audit(ctx, driver, storage.AuditOpts{
+			Repository: auditRepository,
+			Fix:        auditFix,
+			Workers:    auditWorkers,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to audit: %v\n", err)
+			os.Exit(1)
+		}
+
+		p, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(p))
+	},
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+)
+
+// anonymousPullAccessController authorizes the requests without credentials
+// which only pull from public repositories, leaving the other requests to
+// the access controller it wraps.
+type anonymousPullAccessController struct {
+	AccessController
+	repositories []string
+}
+
+// WithAnonymousPull returns an AccessController authorizing the requests
+// without credentials to pull from the repositories matching one of the
+// glob patterns repositories, as understood by path.Match. The other
+// requests are authorized by ac.
+func WithAnonymousPull(ac AccessController, repositories []string) (AccessController, error) {
+	for _, pattern := range repositories {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid repository pattern %q: %v", pattern, err)
+		}
+	}
+	return &anonymousPullAccessController{
+		AccessController: ac,
+		repositories:     repositories,
+	}, nil
+}
+
+// Authorized authorizes the request when it has no credentials and only
+// pulls from public repositories, without setting a user.
+func (ac *anonymousPullAccessController) Authorized(ctx context.Context, access ...Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Authorization") == "" && len(access) > 0 && ac.publicPull(access) {
+		return ctx, nil
+	}
+	return ac.AccessController.Authorized(ctx, access...)
+}
+
+// publicPull returns whether access only pulls from public repositories.
+func (ac *anonymousPullAccessController) publicPull(access []Access) bool {
+	for _, a := range access {
+		if a.Type != "repository" || a.Action != "pull" || !ac.public(a.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// public returns whether the repository name matches one of the patterns of
+// public repositories.
+func (ac *anonymousPullAccessController) public(name string) bool {
+	for _, pattern := range ac.repositories {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantsScopes reports whether the wrapped access controller decides on the
+// access requested.
+func (ac *anonymousPullAccessController) GrantsScopes() bool {
+	return GrantsScopes(ac.AccessController)
+}
@@ -105,6 +105,25 @@ type AccessController interface {
 	Authorized(ctx context.Context, access ...Access) (context.Context, error)
 }
 
+// ScopedAccessController is implemented by the access controllers which
+// decide on the access each request is granted, such as from the scopes of a
+// token. The other access controllers only authenticate requests, and grant
+// any access to authenticated users.
+type ScopedAccessController interface {
+	AccessController
+
+	// GrantsScopes reports whether the access controller decides on the
+	// access requested, rather than granting any access once authenticated.
+	GrantsScopes() bool
+}
+
+// GrantsScopes reports whether ac decides on the access requested, such that
+// granting a scope to some users only is meaningful.
+func GrantsScopes(ac AccessController) bool {
+	scoped, ok := ac.(ScopedAccessController)
+	return ok && scoped.GrantsScopes()
+}
+
 // CredentialAuthenticator is an object which is able to authenticate credentials
 type CredentialAuthenticator interface {
 	AuthenticateUser(username, password string) error
@@ -133,6 +133,9 @@ type accessController struct {
 	service      string
 	rootCerts    *x509.CertPool
 	trustedKeys  map[string]libtrust.PublicKey
+
+	// auditor is set when the tokens granting excessive access are logged.
+	auditor *TokenScopeAuditor
 }
 
 // tokenAccessOptions is a convenience type for handling
@@ -143,6 +146,8 @@ type tokenAccessOptions struct {
 	issuer         string
 	service        string
 	rootCertBundle string
+
+	logExcessiveScope bool
 }
 
 // checkOptions gathers the necessary options
@@ -171,6 +176,14 @@ func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 		opts.autoRedirect = autoRedirect
 	}
 
+	if logExcessiveScopeVal, ok := options["logexcessivescope"]; ok {
+		logExcessiveScope, ok := logExcessiveScopeVal.(bool)
+		if !ok {
+			return opts, fmt.Errorf("token auth requires a valid option bool: logexcessivescope")
+		}
+		opts.logExcessiveScope = logExcessiveScope
+	}
+
 	return opts, nil
 }
 
@@ -222,14 +235,18 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 		trustedKeys[pubKey.KeyID()] = pubKey
 	}
 
-	return &accessController{
+	ac := &accessController{
 		realm:        config.realm,
 		autoRedirect: config.autoRedirect,
 		issuer:       config.issuer,
 		service:      config.service,
 		rootCerts:    rootPool,
 		trustedKeys:  trustedKeys,
-	}, nil
+	}
+	if config.logExcessiveScope {
+		ac.auditor = &TokenScopeAuditor{}
+	}
+	return ac, nil
 }
 
 // Authorized handles checking whether the given request is authorized
@@ -279,11 +296,21 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		}
 	}
 
+	if ac.auditor != nil {
+		ac.auditor.Audit(ctx, token, accessItems)
+	}
+
 	ctx = auth.WithResources(ctx, token.resources())
 
 	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
 }
 
+// GrantsScopes returns true, as requests are only granted the access of the
+// scopes of their token.
+func (ac *accessController) GrantsScopes() bool {
+	return true
+}
+
 // init handles registering the token auth backend.
 func init() {
 	auth.Register("token", auth.InitFunc(newAccessController))
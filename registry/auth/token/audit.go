@@ -0,0 +1,67 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+// TokenScopeAuditor warns of the tokens granting broader access than the
+// requests they authorize require.
+type TokenScopeAuditor struct{}
+
+// Audit logs the access granted by token beyond the access required, along
+// with the subject of the token.
+func (TokenScopeAuditor) Audit(ctx context.Context, token *Token, required []auth.Access) {
+	var granted []auth.Access
+	for _, resourceActions := range token.Claims.Access {
+		for _, action := range resourceActions.Actions {
+			granted = append(granted, auth.Access{
+				Resource: auth.Resource{
+					Type:  resourceActions.Type,
+					Class: resourceActions.Class,
+					Name:  resourceActions.Name,
+				},
+				Action: action,
+			})
+		}
+	}
+
+	excess := AuditScope(granted, required)
+	if len(excess) == 0 {
+		return
+	}
+	scopes := make([]string, 0, len(excess))
+	for _, access := range excess {
+		scopes = append(scopes, fmt.Sprintf("%s:%s:%s", access.Type, access.Name, access.Action))
+	}
+	dcontext.GetLoggerWithField(ctx, "auth.token.subject", token.Claims.Subject).
+		Warnf("token grants access beyond the request: %s", strings.Join(scopes, " "))
+}
+
+// AuditScope returns the granted access which is not required. Access is
+// required when an entry of required names the same resource and action;
+// pulling is required to push. Wildcard names and actions granted are
+// excessive, unless required as such.
+func AuditScope(granted, required []auth.Access) []auth.Access {
+	var excess []auth.Access
+	for _, g := range granted {
+		needed := false
+		for _, r := range required {
+			if g.Type != r.Type || g.Name != r.Name {
+				continue
+			}
+			if g.Action == r.Action || (g.Action == "pull" && r.Action == "push") {
+				needed = true
+				break
+			}
+		}
+		if !needed {
+			excess = append(excess, g)
+		}
+	}
+	return excess
+}
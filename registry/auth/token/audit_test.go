@@ -0,0 +1,86 @@
+package token
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+func repositoryAccess(name, action string) auth.Access {
+	return auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: name},
+		Action:   action,
+	}
+}
+
+func TestAuditScope(t *testing.T) {
+	catalog := auth.Access{
+		Resource: auth.Resource{Type: "registry", Name: "catalog"},
+		Action:   "*",
+	}
+
+	for _, tc := range []struct {
+		name     string
+		granted  []auth.Access
+		required []auth.Access
+		excess   []auth.Access
+	}{
+		{
+			name:     "exact",
+			granted:  []auth.Access{repositoryAccess("foo", "pull")},
+			required: []auth.Access{repositoryAccess("foo", "pull")},
+		},
+		{
+			name:     "nothing granted",
+			required: []auth.Access{repositoryAccess("foo", "pull")},
+		},
+		{
+			name:     "push includes pull",
+			granted:  []auth.Access{repositoryAccess("foo", "pull"), repositoryAccess("foo", "push")},
+			required: []auth.Access{repositoryAccess("foo", "push")},
+		},
+		{
+			name:     "push beyond pull",
+			granted:  []auth.Access{repositoryAccess("foo", "pull"), repositoryAccess("foo", "push")},
+			required: []auth.Access{repositoryAccess("foo", "pull")},
+			excess:   []auth.Access{repositoryAccess("foo", "push")},
+		},
+		{
+			name:     "other repository",
+			granted:  []auth.Access{repositoryAccess("foo", "pull"), repositoryAccess("bar", "pull")},
+			required: []auth.Access{repositoryAccess("foo", "pull")},
+			excess:   []auth.Access{repositoryAccess("bar", "pull")},
+		},
+		{
+			name:     "wildcard repository",
+			granted:  []auth.Access{repositoryAccess("*", "pull")},
+			required: []auth.Access{repositoryAccess("foo", "pull")},
+			excess:   []auth.Access{repositoryAccess("*", "pull")},
+		},
+		{
+			name:     "wildcard action",
+			granted:  []auth.Access{repositoryAccess("foo", "*")},
+			required: []auth.Access{repositoryAccess("foo", "pull")},
+			excess:   []auth.Access{repositoryAccess("foo", "*")},
+		},
+		{
+			name:     "wildcard action required",
+			granted:  []auth.Access{catalog},
+			required: []auth.Access{catalog},
+		},
+		{
+			name:     "other resource type",
+			granted:  []auth.Access{catalog, repositoryAccess("foo", "pull")},
+			required: []auth.Access{repositoryAccess("foo", "pull")},
+			excess:   []auth.Access{catalog},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			excess := AuditScope(tc.granted, tc.required)
+			if !reflect.DeepEqual(excess, tc.excess) {
+				t.Fatalf("unexpected excess access %v, expected %v", excess, tc.excess)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/buildx"
+	"github.com/distribution/distribution/v3/registry/buildx/bake"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bakeFile      string
+	bakeTargets   []string
+	pushUsername  string
+	pushPassword  string
+	pushPlainHTTP bool
+)
+
+func init() {
+	BuildxCmd.AddCommand(BuildxPushCmd)
+	BuildxPushCmd.Flags().StringVarP(&bakeFile, "bake-file", "f", "docker-bake.hcl", "bake file describing the platform builds, in HCL or JSON")
+	BuildxPushCmd.Flags().StringSliceVar(&bakeTargets, "target", nil, "bake targets or groups to push, defaults to the default group")
+	BuildxPushCmd.Flags().StringVarP(&pushUsername, "username", "u", "", "username for the registry")
+	BuildxPushCmd.Flags().StringVarP(&pushPassword, "password", "p", "", "password for the registry")
+	BuildxPushCmd.Flags().BoolVar(&pushPlainHTTP, "plain-http", false, "connect to the registry over plain HTTP")
+}
+
+// BuildxCmd is the cobra command that corresponds to the buildx subcommand
+var BuildxCmd = &cobra.Command{
+	Use:   "buildx",
+	Short: "`buildx` manages multi-platform images",
+	Long:  "`buildx` manages multi-platform images",
+}
+
+// BuildxPushCmd is the cobra command that corresponds to the buildx push
+// subcommand
+var BuildxPushCmd = &cobra.Command{
+	Use:   "push --bake-file <file> <base-ref>",
+	Short: "`push` pushes an image index for the platform images of a bake file",
+	Long: "`push` pushes an OCI image index to <base-ref>, referencing the image of every target of a bake file.\n" +
+		"The image of each target must already be pushed to the registry, under the first tag of the target.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := bake.ParseFile(bakeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read bake file: %v\n", err)
+			os.Exit(1)
+		}
+
+		desc, err := buildx.Push(dcontext.Background(), f, args[0], buildx.PushOptions{
+			Targets:   bakeTargets,
+			PlainHTTP: pushPlainHTTP,
+			Auth: remote.AuthConfig{
+				Username: pushUsername,
+				Password: pushPassword,
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to push image index: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(desc.Digest)
+	},
+}
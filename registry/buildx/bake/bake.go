@@ -0,0 +1,154 @@
+// Package bake parses docker buildx bake files, describing the targets of a
+// multi-platform image build. Only the parts of the format needed to
+// assemble an image index are interpreted: groups, and the platforms and
+// tags of targets.
+package bake
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultGroup is the group resolved when no target is named.
+const DefaultGroup = "default"
+
+// File is a parsed bake file.
+type File struct {
+	Groups  map[string]Group  `json:"group"`
+	Targets map[string]Target `json:"target"`
+}
+
+// Group is a named set of targets, or of other groups.
+type Group struct {
+	Targets []string `json:"targets"`
+}
+
+// Target describes the build of an image.
+type Target struct {
+	// Name is the name of the target in the bake file.
+	Name string `json:"-"`
+
+	// Platforms lists the platforms the target is built for, in the
+	// os/arch[/variant] format.
+	Platforms []string `json:"platforms"`
+
+	// Tags lists the references the built image is pushed to.
+	Tags []string `json:"tags"`
+}
+
+// ParseFile reads and parses the bake file at path. Files with a .json
+// extension are parsed as JSON, any other file as HCL.
+func ParseFile(path string) (*File, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseJSON(p)
+	}
+	return ParseHCL(p)
+}
+
+// ParseJSON parses a bake file in the JSON format.
+func ParseJSON(p []byte) (*File, error) {
+	var f File
+	if err := json.Unmarshal(p, &f); err != nil {
+		return nil, fmt.Errorf("invalid bake file: %v", err)
+	}
+	for name, target := range f.Targets {
+		target.Name = name
+		f.Targets[name] = target
+	}
+	return &f, nil
+}
+
+// ParseHCL parses a bake file in the HCL format. Variables, functions and
+// interpolation are not supported: strings are used verbatim.
+func ParseHCL(p []byte) (*File, error) {
+	blocks, err := parseHCL(string(p))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bake file: %v", err)
+	}
+
+	// Convert the blocks to the JSON layout, so that both formats share
+	// the same decoding.
+	doc := make(map[string]map[string]interface{})
+	for _, b := range blocks {
+		if b.kind != "group" && b.kind != "target" {
+			continue
+		}
+		if len(b.labels) != 1 {
+			return nil, fmt.Errorf("invalid bake file: %s block must have a single label", b.kind)
+		}
+		if doc[b.kind] == nil {
+			doc[b.kind] = make(map[string]interface{})
+		}
+		doc[b.kind][b.labels[0]] = b.attributes
+	}
+
+	p, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJSON(p)
+}
+
+// Resolve returns the targets designated by names, which may be targets or
+// groups. Groups are expanded recursively. With no names, the default group
+// is resolved, or every target when the file has no default group. Targets
+// are returned once each, in the order they are first referenced.
+func (f *File) Resolve(names ...string) ([]Target, error) {
+	if len(names) == 0 {
+		if _, ok := f.Groups[DefaultGroup]; ok {
+			names = []string{DefaultGroup}
+		} else {
+			for name := range f.Targets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+	}
+
+	var targets []Target
+	seen := make(map[string]bool)
+
+	var resolve func(name string, visiting map[string]bool) error
+	resolve = func(name string, visiting map[string]bool) error {
+		if target, ok := f.Targets[name]; ok {
+			if !seen[name] {
+				seen[name] = true
+				targets = append(targets, target)
+			}
+			return nil
+		}
+
+		group, ok := f.Groups[name]
+		if !ok {
+			return fmt.Errorf("unknown target %q", name)
+		}
+		if visiting[name] {
+			return fmt.Errorf("group %q references itself", name)
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		for _, member := range group.Targets {
+			if err := resolve(member, visiting); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, name := range names {
+		if err := resolve(name, make(map[string]bool)); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
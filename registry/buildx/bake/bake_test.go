@@ -0,0 +1,166 @@
+package bake
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testHCL = `
+// Release builds.
+group "default" {
+  targets = ["release"]
+}
+
+group "release" {
+  targets = ["amd64", "arm64",]
+}
+
+variable "TAG" {
+  default = "latest"
+}
+
+target "amd64" {
+  platforms = ["linux/amd64"]
+  tags      = ["registry.example.com/app:amd64"]
+  args = {
+    "VERSION" = "1.0"
+    DEBUG     = false
+  }
+  # ignored
+  output = ["type=registry"]
+}
+
+/*
+ * The arm64 build.
+ */
+target "arm64" {
+  platforms = ["linux/arm64/v8"]
+  tags      = ["registry.example.com/app:arm64", "registry.example.com/app:\"quoted\""]
+  cache-from = []
+}
+`
+
+const testJSON = `{
+  "group": {
+    "default": {"targets": ["release"]},
+    "release": {"targets": ["amd64", "arm64"]}
+  },
+  "target": {
+    "amd64": {
+      "platforms": ["linux/amd64"],
+      "tags": ["registry.example.com/app:amd64"],
+      "args": {"VERSION": "1.0", "DEBUG": "false"}
+    },
+    "arm64": {
+      "platforms": ["linux/arm64/v8"],
+      "tags": ["registry.example.com/app:arm64", "registry.example.com/app:\"quoted\""]
+    }
+  }
+}`
+
+func TestParse(t *testing.T) {
+	expected := []Target{
+		{
+			Name:      "amd64",
+			Platforms: []string{"linux/amd64"},
+			Tags:      []string{"registry.example.com/app:amd64"},
+		},
+		{
+			Name:      "arm64",
+			Platforms: []string{"linux/arm64/v8"},
+			Tags:      []string{"registry.example.com/app:arm64", `registry.example.com/app:"quoted"`},
+		},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		parse func([]byte) (*File, error)
+		src   string
+	}{
+		{name: "hcl", parse: ParseHCL, src: testHCL},
+		{name: "json", parse: ParseJSON, src: testJSON},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := tc.parse([]byte(tc.src))
+			if err != nil {
+				t.Fatalf("unexpected error parsing bake file: %v", err)
+			}
+
+			targets, err := f.Resolve()
+			if err != nil {
+				t.Fatalf("unexpected error resolving targets: %v", err)
+			}
+			if !reflect.DeepEqual(targets, expected) {
+				t.Fatalf("unexpected targets: %#v", targets)
+			}
+		})
+	}
+}
+
+func TestParseHCLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src string
+		err string
+	}{
+		{src: `target "a" {`, err: "unexpected end of file"},
+		{src: `target "a" { tags = ["a" }`, err: `line 1: unexpected "}"`},
+		{src: "target \"a\" {\n tags = [\"a]\n}", err: "line 2: unterminated string"},
+		{src: "target \"a\" {\n tags = \"${TAG}\"\n platforms = notsupported\n}", err: `line 3: unsupported expression "notsupported"`},
+		{src: `target "a" "b" {}`, err: "target block must have a single label"},
+		{src: `/* target "a" {}`, err: "unterminated comment"},
+	} {
+		_, err := ParseHCL([]byte(tc.src))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("parsing %q: expected error containing %q, got %v", tc.src, tc.err, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	f := &File{
+		Groups: map[string]Group{
+			"all":  {Targets: []string{"b", "some"}},
+			"some": {Targets: []string{"a", "b"}},
+			"loop": {Targets: []string{"a", "loop"}},
+			"bad":  {Targets: []string{"missing"}},
+		},
+		Targets: map[string]Target{
+			"a": {Name: "a"},
+			"b": {Name: "b"},
+			"c": {Name: "c"},
+		},
+	}
+
+	names := func(targets []Target) []string {
+		var names []string
+		for _, target := range targets {
+			names = append(names, target.Name)
+		}
+		return names
+	}
+
+	// Without a default group, every target is resolved.
+	targets, err := f.Resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := names(targets); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected targets: %v", got)
+	}
+
+	targets, err = f.Resolve("all", "c")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := names(targets); !reflect.DeepEqual(got, []string{"b", "a", "c"}) {
+		t.Fatalf("unexpected targets: %v", got)
+	}
+
+	if _, err := f.Resolve("loop"); err == nil || !strings.Contains(err.Error(), "references itself") {
+		t.Fatalf("expected error resolving looping group, got %v", err)
+	}
+	if _, err := f.Resolve("bad"); err == nil || !strings.Contains(err.Error(), `unknown target "missing"`) {
+		t.Fatalf("expected error resolving unknown target, got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package bake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// block is a top level HCL block, such as `target "name" { ... }`.
+type block struct {
+	kind       string
+	labels     []string
+	attributes map[string]interface{}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+}
+
+// hclParser is a recursive descent parser for the subset of HCL used by
+// bake files: blocks with string labels, and attributes whose values are
+// strings, numbers, booleans, lists and objects.
+type hclParser struct {
+	tokens []token
+	pos    int
+}
+
+func parseHCL(src string) ([]block, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &hclParser{tokens: tokens}
+
+	var blocks []block
+	for p.peek().kind != tokenEOF {
+		kind, err := p.expect(tokenIdent, "")
+		if err != nil {
+			return nil, err
+		}
+
+		b := block{kind: kind.value}
+		for p.peek().kind == tokenString {
+			b.labels = append(b.labels, p.next().value)
+		}
+		if _, err := p.expect(tokenPunct, "{"); err != nil {
+			return nil, err
+		}
+		if b.attributes, err = p.parseBody("}"); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// parseBody parses attributes up to the closing delimiter. Nested blocks are
+// not supported.
+func (p *hclParser) parseBody(end string) (map[string]interface{}, error) {
+	attributes := make(map[string]interface{})
+	for {
+		t := p.next()
+		switch {
+		case t.kind == tokenPunct && t.value == end:
+			return attributes, nil
+		case t.kind == tokenPunct && t.value == ",":
+			continue
+		case t.kind != tokenIdent && t.kind != tokenString:
+			return nil, p.errorf(t, "expected attribute name")
+		}
+
+		if _, err := p.expect(tokenPunct, "="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		attributes[t.value] = value
+	}
+}
+
+func (p *hclParser) parseValue() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return t.value, nil
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		if n, err := strconv.ParseFloat(t.value, 64); err == nil {
+			return n, nil
+		}
+		return nil, p.errorf(t, "unsupported expression %q", t.value)
+	case tokenPunct:
+		switch t.value {
+		case "[":
+			var list []interface{}
+			for {
+				if next := p.peek(); next.kind == tokenPunct && next.value == "]" {
+					p.next()
+					return list, nil
+				}
+				value, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+
+				if next := p.peek(); next.kind == tokenPunct && next.value == "," {
+					p.next()
+				}
+			}
+		case "{":
+			return p.parseBody("}")
+		}
+	}
+	return nil, p.errorf(t, "unexpected %q", t.value)
+}
+
+func (p *hclParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *hclParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *hclParser) expect(kind tokenKind, value string) (token, error) {
+	t := p.next()
+	if t.kind != kind || (value != "" && t.value != value) {
+		if value == "" {
+			value = "identifier"
+		}
+		return t, p.errorf(t, "expected %q", value)
+	}
+	return t, nil
+}
+
+func (p *hclParser) errorf(t token, format string, args ...interface{}) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("line %d: unexpected end of file", t.line)
+	}
+	return fmt.Errorf("line %d: %s", t.line, fmt.Sprintf(format, args...))
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || (r == '/' && i+1 < len(runes) && runes[i+1] == '/'):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := strings.Index(string(runes[i+2:]), "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			comment := []rune(string(runes[i+2:])[:end])
+			line += strings.Count(string(comment), "\n")
+			i += 2 + len(comment) + 2
+		case r == '"':
+			var sb strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated string", line)
+				}
+				if runes[i] != '\\' {
+					sb.WriteRune(runes[i])
+					continue
+				}
+				i++
+				if i == len(runes) {
+					break
+				}
+				switch runes[i] {
+				case 'n':
+					sb.WriteRune('\n')
+				case 't':
+					sb.WriteRune('\t')
+				default:
+					sb.WriteRune(runes[i])
+				}
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, value: sb.String(), line: line})
+		case strings.ContainsRune("{}[]=,", r):
+			tokens = append(tokens, token{kind: tokenPunct, value: string(r), line: line})
+			i++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_-.", runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: string(runes[start:i]), line: line})
+		default:
+			return nil, fmt.Errorf("line %d: unexpected character %q", line, r)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, line: line}), nil
+}
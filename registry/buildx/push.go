@@ -0,0 +1,246 @@
+// Package buildx assembles multi-platform images from the per-platform
+// images of a bake file, which have already been pushed to a registry.
+package buildx
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/buildx/bake"
+	"github.com/distribution/distribution/v3/registry/client"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PushOptions configures Push.
+type PushOptions struct {
+	// Targets names the bake targets or groups to push. The default group
+	// is used when empty.
+	Targets []string
+
+	// Auth holds the credentials for the registry.
+	Auth remote.AuthConfig
+
+	// PlainHTTP connects to the registry over HTTP rather than HTTPS.
+	PlainHTTP bool
+}
+
+// Push assembles the image index described by the bake file f and pushes it
+// to base, which must be a tagged reference.
+//
+// Each target must build a single platform, and its first tag must name the
+// platform manifest, already pushed to the registry of base. Manifests from
+// other repositories are copied into the repository of base, mounting their
+// blobs, so that the index only references local content.
+func Push(ctx context.Context, f *bake.File, base string, opts PushOptions) (distribution.Descriptor, error) {
+	named, err := reference.ParseNormalizedNamed(base)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	tagged, ok := named.(reference.NamedTagged)
+	if !ok {
+		return distribution.Descriptor{}, fmt.Errorf("%s: base reference must be tagged", base)
+	}
+
+	targets, err := f.Resolve(opts.Targets...)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if len(targets) == 0 {
+		return distribution.Descriptor{}, fmt.Errorf("bake file has no targets")
+	}
+
+	scheme := "https"
+	if opts.PlainHTTP {
+		scheme = "http"
+	}
+	baseURL := &url.URL{Scheme: scheme, Host: reference.Domain(named)}
+
+	p := &pusher{
+		baseURL: baseURL,
+		auth:    opts.Auth,
+		repos:   make(map[string]distribution.Repository),
+	}
+
+	dest, err := p.repository(named)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	var descriptors []manifestlist.ManifestDescriptor
+	for _, target := range targets {
+		desc, err := p.pushTarget(ctx, target, dest)
+		if err != nil {
+			return distribution.Descriptor{}, fmt.Errorf("target %q: %v", target.Name, err)
+		}
+		descriptors = append(descriptors, desc)
+	}
+
+	index, err := manifestlist.FromDescriptorsWithMediaType(descriptors, v1.MediaTypeImageIndex)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	ms, err := dest.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	dgst, err := ms.Put(ctx, index, distribution.WithTag(tagged.Tag()))
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	_, payload, err := index.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return distribution.Descriptor{
+		MediaType: v1.MediaTypeImageIndex,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+type pusher struct {
+	baseURL *url.URL
+	auth    remote.AuthConfig
+	repos   map[string]distribution.Repository
+}
+
+// repository returns the repository of ref, on the registry of the pushed
+// index.
+func (p *pusher) repository(ref reference.Named) (distribution.Repository, error) {
+	path := reference.Path(ref)
+	if repo, ok := p.repos[path]; ok {
+		return repo, nil
+	}
+
+	name, err := reference.WithName(path)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := remote.NewRepository(name, p.baseURL, p.auth)
+	if err != nil {
+		return nil, err
+	}
+	p.repos[path] = repo
+	return repo, nil
+}
+
+// pushTarget makes the platform manifest of target available in dest, and
+// returns its index entry.
+func (p *pusher) pushTarget(ctx context.Context, target bake.Target, dest distribution.Repository) (manifestlist.ManifestDescriptor, error) {
+	if len(target.Platforms) != 1 {
+		return manifestlist.ManifestDescriptor{}, fmt.Errorf("expected a single platform, got %d", len(target.Platforms))
+	}
+	platform, err := parsePlatform(target.Platforms[0])
+	if err != nil {
+		return manifestlist.ManifestDescriptor{}, err
+	}
+
+	if len(target.Tags) == 0 {
+		return manifestlist.ManifestDescriptor{}, fmt.Errorf("no tags")
+	}
+	ref, err := reference.ParseNormalizedNamed(target.Tags[0])
+	if err != nil {
+		return manifestlist.ManifestDescriptor{}, err
+	}
+	if reference.Domain(ref) != p.baseURL.Host {
+		return manifestlist.ManifestDescriptor{}, fmt.Errorf("%s is not on registry %s", ref, p.baseURL.Host)
+	}
+
+	src, err := p.repository(ref)
+	if err != nil {
+		return manifestlist.ManifestDescriptor{}, err
+	}
+	srcManifests, err := src.Manifests(ctx)
+	if err != nil {
+		return manifestlist.ManifestDescriptor{}, err
+	}
+
+	var m distribution.Manifest
+	switch ref := ref.(type) {
+	case reference.Canonical:
+		m, err = srcManifests.Get(ctx, ref.Digest())
+	case reference.Tagged:
+		m, err = srcManifests.Get(ctx, "", distribution.WithTag(ref.Tag()))
+	default:
+		return manifestlist.ManifestDescriptor{}, fmt.Errorf("%s must be tagged or referenced by digest", ref)
+	}
+	if err != nil {
+		return manifestlist.ManifestDescriptor{}, fmt.Errorf("fetching %s: %v", ref, err)
+	}
+
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return manifestlist.ManifestDescriptor{}, err
+	}
+	dgst := digest.FromBytes(payload)
+
+	if src.Named().Name() != dest.Named().Name() {
+		if err := copyManifest(ctx, src, dest, m); err != nil {
+			return manifestlist.ManifestDescriptor{}, err
+		}
+	}
+
+	return manifestlist.ManifestDescriptor{
+		Descriptor: distribution.Descriptor{
+			MediaType: mediaType,
+			Digest:    dgst,
+			Size:      int64(len(payload)),
+		},
+		Platform: platform,
+	}, nil
+}
+
+// copyManifest mounts the blobs referenced by m from src into dest, and
+// pushes m to dest by digest.
+func copyManifest(ctx context.Context, src, dest distribution.Repository, m distribution.Manifest) error {
+	blobs := dest.Blobs(ctx)
+	for _, desc := range m.References() {
+		from, err := reference.WithDigest(src.Named(), desc.Digest)
+		if err != nil {
+			return err
+		}
+
+		bw, err := blobs.Create(ctx, client.WithMountFrom(from))
+		if _, mounted := err.(distribution.ErrBlobMounted); mounted {
+			continue
+		}
+		if err == nil {
+			bw.Cancel(ctx)
+			err = fmt.Errorf("registry did not mount %s", from)
+		}
+		return err
+	}
+
+	ms, err := dest.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = ms.Put(ctx, m)
+	return err
+}
+
+// parsePlatform parses a platform in the os/arch[/variant] format.
+func parsePlatform(s string) (manifestlist.PlatformSpec, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return manifestlist.PlatformSpec{}, fmt.Errorf("invalid platform %q", s)
+	}
+
+	platform := manifestlist.PlatformSpec{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
@@ -0,0 +1,111 @@
+package buildx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/registry/buildx/bake"
+	"github.com/distribution/distribution/v3/registry/registrytest"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPush(t *testing.T) {
+	for _, fixture := range []string{"docker-bake.hcl", "docker-bake.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			testPush(t, fixture)
+		})
+	}
+}
+
+func testPush(t *testing.T, fixture string) {
+	ctx := context.Background()
+	base := registrytest.New(t)
+	host := base.Host
+
+	amd64 := registrytest.PushImage(t, registrytest.Repository(t, base, "foo/app", nil), "1.0-amd64", "amd64", []byte("layer for amd64")).Digest
+	arm64 := registrytest.PushImage(t, registrytest.Repository(t, base, "foo/app-arm64", nil), "1.0", "arm64", []byte("layer for arm64")).Digest
+
+	p, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = []byte(strings.ReplaceAll(string(p), "REGISTRY", host))
+	parse := bake.ParseHCL
+	if filepath.Ext(fixture) == ".json" {
+		parse = bake.ParseJSON
+	}
+	f, err := parse(p)
+	if err != nil {
+		t.Fatalf("unexpected error parsing bake file: %v", err)
+	}
+
+	desc, err := Push(ctx, f, host+"/foo/app:1.0", PushOptions{PlainHTTP: true})
+	if err != nil {
+		t.Fatalf("unexpected error pushing index: %v", err)
+	}
+	if desc.MediaType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected media type: %s", desc.MediaType)
+	}
+
+	repo := registrytest.Repository(t, base, "foo/app", nil)
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ms.Get(ctx, "", distribution.WithTag("1.0"))
+	if err != nil {
+		t.Fatalf("unexpected error fetching index: %v", err)
+	}
+	index, ok := m.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		t.Fatalf("unexpected manifest type: %T", m)
+	}
+	if index.MediaType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected index media type: %s", index.MediaType)
+	}
+
+	var platforms []manifestlist.PlatformSpec
+	var digests []digest.Digest
+	for _, entry := range index.Manifests {
+		platforms = append(platforms, entry.Platform)
+		digests = append(digests, entry.Digest)
+	}
+	if !reflect.DeepEqual(platforms, []manifestlist.PlatformSpec{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}) {
+		t.Fatalf("unexpected platforms: %v", platforms)
+	}
+	if !reflect.DeepEqual(digests, []digest.Digest{amd64, arm64}) {
+		t.Fatalf("unexpected digests: %v", digests)
+	}
+
+	// The arm64 image was copied into the repository of the index.
+	if _, err := ms.Get(ctx, arm64); err != nil {
+		t.Fatalf("expected arm64 manifest to be copied: %v", err)
+	}
+}
+
+func TestPushErrors(t *testing.T) {
+	ctx := context.Background()
+	f := &bake.File{
+		Targets: map[string]bake.Target{
+			"multi": {Name: "multi", Platforms: []string{"linux/amd64", "linux/arm64"}, Tags: []string{"localhost:5000/foo:multi"}},
+		},
+	}
+
+	if _, err := Push(ctx, f, "localhost:5000/foo", PushOptions{}); err == nil || !strings.Contains(err.Error(), "must be tagged") {
+		t.Fatalf("expected untagged base error, got %v", err)
+	}
+	if _, err := Push(ctx, f, "localhost:5000/foo:1.0", PushOptions{}); err == nil || !strings.Contains(err.Error(), "expected a single platform") {
+		t.Fatalf("expected multiple platforms error, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+# Builds of the same image for two platforms, pushed separately.
+group "default" {
+  targets = ["amd64", "arm64"]
+}
+
+target "common" {
+  context    = "."
+  dockerfile = "Dockerfile"
+}
+
+target "amd64" {
+  platforms = ["linux/amd64"]
+  tags      = ["REGISTRY/foo/app:1.0-amd64"]
+  args = {
+    GOARCH = "amd64"
+  }
+}
+
+/* The arm64 image is pushed to its own repository. */
+target "arm64" {
+  platforms = ["linux/arm64/v8"]
+  tags      = ["REGISTRY/foo/app-arm64:1.0", "REGISTRY/foo/app-arm64:latest"]
+  args = {
+    GOARCH = "arm64"
+  }
+}
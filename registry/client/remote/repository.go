@@ -0,0 +1,77 @@
+// Package remote provides access to services of a remote registry through
+// the registry HTTP API.
+package remote
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/client"
+	"github.com/distribution/distribution/v3/registry/client/auth"
+	"github.com/distribution/distribution/v3/registry/client/auth/challenge"
+	"github.com/distribution/distribution/v3/registry/client/transport"
+)
+
+// AuthConfig holds the credentials used to authenticate against a remote
+// registry. Both basic and token authentication are supported, depending on
+// the challenge returned by the registry.
+type AuthConfig struct {
+	Username string
+	Password string
+}
+
+// Basic implements auth.CredentialStore.
+func (c AuthConfig) Basic(*url.URL) (string, string) {
+	return c.Username, c.Password
+}
+
+// RefreshToken implements auth.CredentialStore.
+func (c AuthConfig) RefreshToken(*url.URL, string) string {
+	return ""
+}
+
+// SetRefreshToken implements auth.CredentialStore.
+func (c AuthConfig) SetRefreshToken(*url.URL, string, string) {
+}
+
+// NewRepository returns a distribution.Repository for the repository name on
+// the registry at base, authenticating with authConfig. When credentials are
+// set, the registry is contacted once to discover its authentication
+// challenges.
+func NewRepository(name reference.Named, base *url.URL, authConfig AuthConfig) (distribution.Repository, error) {
+	rt := http.DefaultTransport
+	if authConfig.Username != "" {
+		var err error
+		rt, err = newAuthTransport(rt, base, name, authConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return client.NewRepository(name, base.String(), rt)
+}
+
+// newAuthTransport pings the registry to record its challenges, and returns
+// a transport answering them with the credentials in authConfig.
+func newAuthTransport(base http.RoundTripper, baseURL *url.URL, name reference.Named, authConfig AuthConfig) (http.RoundTripper, error) {
+	pingURL := strings.TrimSuffix(baseURL.String(), "/") + "/v2/"
+
+	resp, err := (&http.Client{Transport: base}).Get(pingURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	manager := challenge.NewSimpleManager()
+	if err := manager.AddResponse(resp); err != nil {
+		return nil, err
+	}
+
+	return transport.NewTransport(base, auth.NewAuthorizer(manager,
+		auth.NewTokenHandler(base, authConfig, name.Name(), "pull", "push", "delete"),
+		auth.NewBasicHandler(authConfig),
+	)), nil
+}
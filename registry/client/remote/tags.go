@@ -0,0 +1,20 @@
+package remote
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+)
+
+// NewRemoteTagService returns a distribution.TagService for the repository
+// name on the registry at base, authenticating with authConfig.
+func NewRemoteTagService(name reference.Named, base *url.URL, authConfig AuthConfig) (distribution.TagService, error) {
+	repo, err := NewRepository(name, base, authConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.Tags(context.Background()), nil
+}
@@ -0,0 +1,112 @@
+package remote
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/handlers"
+	"github.com/distribution/distribution/v3/registry/registrytest"
+)
+
+const (
+	testUsername = "replicator"
+	testPassword = "s3cr3t"
+)
+
+// newTestRegistry starts an in-memory registry which requires basic
+// authentication with the test credentials.
+func newTestRegistry(t *testing.T) *url.URL {
+	t.Helper()
+
+	config := registrytest.Config()
+	config.Storage["delete"] = configuration.Parameters{"enabled": true}
+	app := handlers.NewApp(context.Background(), config)
+
+	return registrytest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != testUsername || password != testPassword {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		app.ServeHTTP(w, r)
+	}))
+}
+
+type basicAuthTransport struct{}
+
+func (basicAuthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.SetBasicAuth(testUsername, testPassword)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestRemoteTagService(t *testing.T) {
+	ctx := context.Background()
+	base := newTestRegistry(t)
+	name, _ := reference.WithName("foo/bar")
+	repo := registrytest.Repository(t, base, name.Name(), basicAuthTransport{})
+	desc := registrytest.PushImage(t, repo, "", "amd64", []byte("layer"))
+
+	tags, err := NewRemoteTagService(name, base, AuthConfig{Username: testUsername, Password: testPassword})
+	if err != nil {
+		t.Fatalf("unexpected error creating tag service: %v", err)
+	}
+
+	for _, tag := range []string{"latest", "v1"} {
+		if err := tags.Tag(ctx, tag, desc); err != nil {
+			t.Fatalf("unexpected error tagging %s: %v", tag, err)
+		}
+	}
+
+	all, err := tags.All(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error listing tags: %v", err)
+	}
+	sort.Strings(all)
+	if !reflect.DeepEqual(all, []string{"latest", "v1"}) {
+		t.Fatalf("unexpected tags: %v", all)
+	}
+
+	got, err := tags.Get(ctx, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error getting tag: %v", err)
+	}
+	if got.Digest != desc.Digest || got.Size != desc.Size || got.MediaType != desc.MediaType {
+		t.Fatalf("unexpected descriptor: %v != %v", got, desc)
+	}
+
+	if err := tags.Untag(ctx, "v1"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+	if _, err := tags.Get(ctx, "v1"); err == nil {
+		t.Fatal("expected error getting removed tag")
+	}
+
+	found, err := tags.Lookup(ctx, desc)
+	if err != nil {
+		t.Fatalf("unexpected error looking up tags: %v", err)
+	}
+	if !reflect.DeepEqual(found, []string{"latest"}) {
+		t.Fatalf("unexpected tags for %s: %v", desc.Digest, found)
+	}
+}
+
+func TestRemoteTagServiceUnauthorized(t *testing.T) {
+	base := newTestRegistry(t)
+	name, _ := reference.WithName("foo/bar")
+
+	tags, err := NewRemoteTagService(name, base, AuthConfig{Username: testUsername, Password: "wrong"})
+	if err != nil {
+		t.Fatalf("unexpected error creating tag service: %v", err)
+	}
+
+	if _, err := tags.All(context.Background()); err == nil {
+		t.Fatal("expected error listing tags with wrong credentials")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -200,9 +201,35 @@ type tags struct {
 
 // All returns all tags
 func (t *tags) All(ctx context.Context) ([]string, error) {
+	tags, err := t.list(ctx, nil, -1)
+	if err != nil {
+		return tags, err
+	}
+	// Registries are not all listing tags in lexical order.
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// AllPaged returns the tags after last, up to count of them. The registry
+// pages the tags, the pages being followed until count tags are listed.
+func (t *tags) AllPaged(ctx context.Context, last string, count int) ([]string, error) {
+	values := url.Values{}
+	if last != "" {
+		values.Set("last", last)
+	}
+	if count >= 0 {
+		values.Set("n", strconv.Itoa(count))
+	}
+	return t.list(ctx, values, count)
+}
+
+// list lists the tags from the tags list URL with the query values, following
+// the pages of tags until count tags are listed. A negative count lists all
+// the tags.
+func (t *tags) list(ctx context.Context, values url.Values, count int) ([]string, error) {
 	var tags []string
 
-	listURLStr, err := t.ub.BuildTagsURL(t.name)
+	listURLStr, err := t.ub.BuildTagsURL(t.name, values)
 	if err != nil {
 		return tags, err
 	}
@@ -236,6 +263,9 @@ func (t *tags) All(ctx context.Context) ([]string, error) {
 				return tags, err
 			}
 			tags = append(tags, tagsResponse.Tags...)
+			if count >= 0 && len(tags) >= count {
+				return tags[:count], nil
+			}
 			if link := resp.Header.Get("Link"); link != "" {
 				firsLink, _, _ := strings.Cut(link, ";")
 				linkURL, err := url.Parse(strings.Trim(firsLink, "<>"))
@@ -349,12 +379,82 @@ func (t *tags) Get(ctx context.Context, tag string) (distribution.Descriptor, er
 	}
 }
 
-func (t *tags) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
-	panic("not implemented")
+// Exists issues a HEAD request for a Manifest against its named endpoint,
+// which transfers no manifest content.
+func (t *tags) Exists(ctx context.Context, tag string) (bool, error) {
+	ref, err := reference.WithTag(t.name, tag)
+	if err != nil {
+		return false, err
+	}
+	u, err := t.ub.BuildManifestURL(ref)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range distribution.ManifestMediaTypes() {
+		req.Header.Add("Accept", t)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case SuccessStatus(resp.StatusCode):
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	default:
+		return false, HandleErrorResponse(resp)
+	}
+}
+
+// Lookup returns the tags of the repository which currently reference the
+// digest of desc. The remote API has no reverse index, so every tag is
+// resolved in turn.
+func (t *tags) Lookup(ctx context.Context, desc distribution.Descriptor, opts ...distribution.LookupOption) ([]string, error) {
+	allTags, err := t.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, tag := range allTags {
+		tagDesc, err := t.Get(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+		if tagDesc.Digest == desc.Digest {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
 }
 
-func (t *tags) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
-	panic("not implemented")
+// Tag points tag at the manifest identified by desc. The remote API can only
+// tag a manifest by pushing it, so the manifest is fetched by digest and
+// pushed back under the tag.
+func (t *tags) Tag(ctx context.Context, tag string, desc distribution.Descriptor, opts ...distribution.TagOption) error {
+	ms := &manifests{
+		name:   t.name,
+		ub:     t.ub,
+		client: t.client,
+		etags:  make(map[string]string),
+	}
+
+	m, err := ms.Get(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+
+	_, err = ms.Put(ctx, m, distribution.WithTag(tag))
+	return err
 }
 
 func (t *tags) Untag(ctx context.Context, tag string) error {
@@ -384,6 +484,22 @@ func (t *tags) Untag(ctx context.Context, tag string) error {
 	return HandleErrorResponse(resp)
 }
 
+// Rename is not supported: the remote API has no way to rename a tag without
+// a moment where both or neither of the tags exist.
+func (t *tags) Rename(ctx context.Context, src, dst string) error {
+	return distribution.ErrUnsupported
+}
+
+// History returns the current descriptor of tag, as the remote API has no
+// history of tags.
+func (t *tags) History(ctx context.Context, tag string) ([]distribution.Descriptor, error) {
+	desc, err := t.Get(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return []distribution.Descriptor{desc}, nil
+}
+
 type manifests struct {
 	name   reference.Named
 	ub     *v2.URLBuilder
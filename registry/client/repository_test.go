@@ -1458,6 +1458,53 @@ func TestTagDelete(t *testing.T) {
 	}
 }
 
+func TestTagExists(t *testing.T) {
+	repo, _ := reference.WithName("test.example.com/repo/exists")
+
+	var m testutil.RequestResponseMap
+	m = append(m, testutil.RequestResponseMapping{
+		Request: testutil.Request{
+			Method: http.MethodHead,
+			Route:  "/v2/" + repo.Name() + "/manifests/latest",
+		},
+		Response: testutil.Response{
+			StatusCode: http.StatusOK,
+			Headers: http.Header(map[string][]string{
+				"Docker-Content-Digest": {"sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			}),
+		},
+	})
+	m = append(m, testutil.RequestResponseMapping{
+		Request: testutil.Request{
+			Method: http.MethodHead,
+			Route:  "/v2/" + repo.Name() + "/manifests/broken",
+		},
+		Response: testutil.Response{
+			StatusCode: http.StatusInternalServerError,
+		},
+	})
+
+	e, c := testServer(m)
+	defer c()
+
+	r, err := NewRepository(repo, e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ts := r.Tags(ctx)
+
+	if exists, err := ts.Exists(ctx, "latest"); err != nil || !exists {
+		t.Fatalf("expected latest to exist, got %t, %v", exists, err)
+	}
+	if exists, err := ts.Exists(ctx, "missing"); err != nil || exists {
+		t.Fatalf("expected missing not to exist, got %t, %v", exists, err)
+	}
+	if _, err := ts.Exists(ctx, "broken"); err == nil {
+		t.Fatal("expected an error checking a tag on a failing registry")
+	}
+}
+
 func TestObtainsErrorForMissingTag(t *testing.T) {
 	repo, _ := reference.WithName("test.example.com/repo")
 
@@ -0,0 +1,210 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/sony/gobreaker"
+)
+
+// ErrCircuitOpen is returned by a resilient transport when requests to a
+// host are rejected because the circuit breaker for that host is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// TransportConfig configures a transport created by NewResilientTransport.
+// Zero values select the defaults documented on each field.
+type TransportConfig struct {
+	// Base is the transport used to send requests. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+
+	// MaxRetries is the number of times a request failing with a network
+	// error or a 5xx response is retried. Defaults to 3. A negative value
+	// disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the base delay between retries, doubled after every
+	// attempt. A random jitter of up to the delay is added. Defaults to
+	// 100ms.
+	RetryBackoff time.Duration
+
+	// MaxRetryBackoff caps the delay between retries. Defaults to 5s.
+	MaxRetryBackoff time.Duration
+
+	// Timeout bounds each attempt, including reading the response body.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed requests after
+	// which the circuit breaker for a host opens. Defaults to 5.
+	FailureThreshold int
+
+	// OpenTimeout is how long the circuit breaker for a host stays open
+	// before a trial request is let through. Defaults to 30s.
+	OpenTimeout time.Duration
+
+	// RequestID enables injection of an X-Request-ID header. The id of the
+	// request being served is used when available in the request context,
+	// otherwise a new one is generated.
+	RequestID bool
+}
+
+// NewResilientTransport returns a transport which retries failed requests
+// with jittered exponential backoff, guards each upstream host with a
+// circuit breaker and enforces a timeout on every attempt.
+func NewResilientTransport(config TransportConfig) http.RoundTripper {
+	if config.Base == nil {
+		config.Base = http.DefaultTransport
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = 100 * time.Millisecond
+	}
+	if config.MaxRetryBackoff <= 0 {
+		config.MaxRetryBackoff = 5 * time.Second
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+
+	return &resilientTransport{
+		config:   config,
+		breakers: make(map[string]*gobreaker.TwoStepCircuitBreaker),
+	}
+}
+
+type resilientTransport struct {
+	config TransportConfig
+
+	mu       sync.Mutex
+	breakers map[string]*gobreaker.TwoStepCircuitBreaker
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.config.RequestID && req.Header.Get("X-Request-ID") == "" {
+		id := dcontext.GetRequestID(req.Context())
+		if id == "" {
+			id = uuid.Generate().String()
+		}
+		req = cloneRequest(req)
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	breaker := t.breaker(req.URL.Host)
+
+	// Requests with a body can only be retried when the body can be
+	// recreated.
+	maxRetries := t.config.MaxRetries
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxRetries = 0
+	}
+
+	backoff := t.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		done, err := breaker.Allow()
+		if err != nil {
+			// The breaker is open, or half-open with its trial request
+			// in flight.
+			return nil, fmt.Errorf("%s: %w", req.URL.Host, ErrCircuitOpen)
+		}
+
+		resp, err := t.try(req, attempt)
+		failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		done(!failed)
+
+		if !failed || attempt >= maxRetries {
+			return resp, err
+		}
+
+		if resp != nil {
+			// Drain a bounded amount of the body so the connection can
+			// be reused.
+			io.CopyN(io.Discard, resp.Body, 4096)
+			resp.Body.Close()
+		}
+
+		delay := backoff + time.Duration(rand.Int63n(int64(backoff)))
+		if delay > t.config.MaxRetryBackoff {
+			delay = t.config.MaxRetryBackoff
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+// try sends a single attempt of req.
+func (t *resilientTransport) try(req *http.Request, attempt int) (*http.Response, error) {
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = cloneRequest(req)
+		req.Body = body
+	}
+
+	if t.config.Timeout <= 0 {
+		return t.config.Base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.config.Timeout)
+	resp, err := t.config.Base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnCloseReader{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (t *resilientTransport) breaker(host string) *gobreaker.TwoStepCircuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.breakers[host]
+	if !ok {
+		threshold := uint32(t.config.FailureThreshold)
+		b = gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+			Name:        host,
+			MaxRequests: 1,
+			Timeout:     t.config.OpenTimeout,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= threshold
+			},
+		})
+		t.breakers[host] = b
+	}
+	return b
+}
+
+// cancelOnCloseReader releases the context of an attempt once its response
+// body is closed.
+type cancelOnCloseReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnCloseReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
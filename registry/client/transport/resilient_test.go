@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with a 503, and answers
+// the following ones with "ok".
+func flakyServer(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestResilientTransportRetries(t *testing.T) {
+	server, requests := flakyServer(t, 2)
+	client := &http.Client{Transport: NewResilientTransport(TransportConfig{
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	})}
+
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestResilientTransportGivesUp(t *testing.T) {
+	server, requests := flakyServer(t, 10)
+	client := &http.Client{Transport: NewResilientTransport(TransportConfig{
+		MaxRetries:       2,
+		RetryBackoff:     time.Millisecond,
+		FailureThreshold: 10,
+	})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestResilientTransportNetworkError(t *testing.T) {
+	server, _ := flakyServer(t, 0)
+	url := server.URL
+	server.Close()
+
+	client := &http.Client{Transport: NewResilientTransport(TransportConfig{
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	})}
+	if _, err := client.Get(url); err == nil {
+		t.Fatal("expected error from closed server")
+	}
+}
+
+func TestResilientTransportCircuitBreaker(t *testing.T) {
+	server, requests := flakyServer(t, 3)
+	client := &http.Client{Transport: NewResilientTransport(TransportConfig{
+		MaxRetries:       -1,
+		FailureThreshold: 3,
+		OpenTimeout:      50 * time.Millisecond,
+	})}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// The breaker is open: requests fail without reaching the server.
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit open error, got %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+
+	// Once the open timeout passes, a successful trial request closes it.
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error after open timeout: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestResilientTransportTimeout(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewResilientTransport(TransportConfig{
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+		Timeout:      50 * time.Millisecond,
+	})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+	if string(body) != "ok" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+}
+
+func TestResilientTransportRequestID(t *testing.T) {
+	ids := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids <- r.Header.Get("X-Request-ID")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewResilientTransport(TransportConfig{RequestID: true})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if id := <-ids; id == "" {
+		t.Fatal("expected a generated request id")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("X-Request-ID", "abc")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if id := <-ids; id != "abc" {
+		t.Fatalf("request id was overwritten: %q", id)
+	}
+}
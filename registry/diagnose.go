@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/diagnose"
+	"github.com/spf13/cobra"
+)
+
+// DiagnoseCmd is the cobra command that corresponds to the diagnose subcommand
+var DiagnoseCmd = &cobra.Command{
+	Use:   "diagnose <config>",
+	Short: "`diagnose` checks the environment the registry is configured to run in",
+	Long: "`diagnose` validates the configuration and, without starting the registry, checks that the storage is reachable,\n" +
+		"that the TLS certificate is valid, that the authentication backend is reachable and that the addresses are free.\n" +
+		"It exits with a non-zero status unless all the checks pass.",
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			printCheckResult(diagnose.CheckResult{
+				Name:        "configuration",
+				Status:      diagnose.StatusFail,
+				Message:     err.Error(),
+				Remediation: "fix the configuration file, see docs/configuration.md",
+			})
+			os.Exit(1)
+		}
+		printCheckResult(diagnose.CheckResult{Name: "configuration", Message: "configuration is valid"})
+
+		checkers := []diagnose.Checker{
+			diagnose.StorageDriverCheck{Type: config.Storage.Type(), Parameters: config.Storage.Parameters()},
+			diagnose.TLSCertCheck{
+				Certificate: config.HTTP.TLS.Certificate,
+				Key:         config.HTTP.TLS.Key,
+				ClientCAs:   config.HTTP.TLS.ClientCAs,
+			},
+			diagnose.AuthBackendCheck{Type: config.Auth.Type(), Parameters: config.Auth.Parameters()},
+			diagnose.NetworkBindCheck{Net: config.HTTP.Net, Addr: config.HTTP.Addr},
+		}
+		if config.HTTP.Debug.Addr != "" {
+			checkers = append(checkers, diagnose.NetworkBindCheck{Name: "debug", Addr: config.HTTP.Debug.Addr})
+		}
+
+		results := diagnose.Run(dcontext.Background(), checkers...)
+		for _, result := range results {
+			printCheckResult(result)
+		}
+		if !diagnose.Passed(results) {
+			os.Exit(1)
+		}
+	},
+}
+
+func printCheckResult(result diagnose.CheckResult) {
+	fmt.Printf("%s  %-13s %s\n", result.Status, result.Name, result.Message)
+	if result.Remediation != "" {
+		fmt.Printf("      %-13s -> %s\n", "", result.Remediation)
+	}
+}
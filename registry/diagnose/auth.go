@@ -0,0 +1,155 @@
+package diagnose
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+)
+
+// defaultAuthTimeout bounds the requests to the token server by default.
+const defaultAuthTimeout = 10 * time.Second
+
+// AuthBackendCheck checks the authentication backend of the registry: that
+// the htpasswd file can be read, or that the token server is reachable.
+type AuthBackendCheck struct {
+	// Type is the type of the access controller, such as token. No
+	// authentication is configured when Type is empty.
+	Type string
+
+	// Parameters are the parameters of the access controller.
+	Parameters map[string]interface{}
+
+	// Client sends the requests to the token server, with a 10 seconds
+	// timeout by default.
+	Client *http.Client
+}
+
+// Check implements Checker.
+func (c AuthBackendCheck) Check(ctx context.Context) CheckResult {
+	result := CheckResult{Name: "auth"}
+	switch c.Type {
+	case "":
+		result.Message = "no authentication configured"
+	case "silly":
+		result.Status = StatusWarn
+		result.Message = "silly authentication accepts any credentials"
+		result.Remediation = "configure htpasswd or token authentication outside of development"
+	case "htpasswd":
+		c.checkHtpasswd(&result)
+	case "token":
+		c.checkToken(ctx, &result)
+	default:
+		if _, err := auth.GetAccessController(c.Type, c.Parameters); err != nil {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("failed to construct %s access controller: %v", c.Type, err)
+			result.Remediation = fmt.Sprintf("check the parameters of auth.%s", c.Type)
+			return result
+		}
+		result.Message = fmt.Sprintf("%s access controller constructed", c.Type)
+	}
+	return result
+}
+
+// checkHtpasswd checks that the htpasswd file lists users. The access
+// controller is not constructed, as it creates a missing file.
+func (c AuthBackendCheck) checkHtpasswd(result *CheckResult) {
+	path, _ := c.Parameters["path"].(string)
+	if path == "" {
+		result.Status = StatusFail
+		result.Message = "no htpasswd file configured"
+		result.Remediation = "set auth.htpasswd.path"
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			result.Status = StatusWarn
+			result.Message = fmt.Sprintf("htpasswd file %s does not exist, it will be created with a generated password for user docker", path)
+			result.Remediation = "create the htpasswd file with the users of the registry"
+			return
+		}
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to open htpasswd file %s: %v", path, err)
+		result.Remediation = "check the permissions of auth.htpasswd.path"
+		return
+	}
+	defer f.Close()
+
+	users := 0
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		t := strings.TrimSpace(scanner.Text())
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if i := strings.Index(t, ":"); i <= 0 || i == len(t)-1 {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("invalid entry on line %d of htpasswd file %s", line, path)
+			result.Remediation = "generate the entries with htpasswd -B"
+			return
+		}
+		users++
+	}
+	if err := scanner.Err(); err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to read htpasswd file %s: %v", path, err)
+		result.Remediation = "check the permissions of auth.htpasswd.path"
+		return
+	}
+	if users == 0 {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("htpasswd file %s lists no users, no one can authenticate", path)
+		result.Remediation = "add users with htpasswd -B"
+		return
+	}
+	result.Message = fmt.Sprintf("htpasswd file %s lists %d users", path, users)
+}
+
+// checkToken checks the options of the token access controller, and that
+// its realm answers.
+func (c AuthBackendCheck) checkToken(ctx context.Context, result *CheckResult) {
+	if _, err := auth.GetAccessController(c.Type, c.Parameters); err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to construct token access controller: %v", err)
+		result.Remediation = "check the parameters of auth.token, and that auth.token.rootcertbundle is readable"
+		return
+	}
+
+	realm, _ := c.Parameters["realm"].(string)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm, nil)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("invalid token realm %q: %v", realm, err)
+		result.Remediation = "set auth.token.realm to the URL of the token server"
+		return
+	}
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultAuthTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("token server %s is unreachable: %v", realm, err)
+		result.Remediation = "check that the token server is running and reachable from the registry"
+		return
+	}
+	resp.Body.Close()
+
+	// An anonymous request is usually denied, which still shows the server
+	// is up.
+	if resp.StatusCode >= http.StatusInternalServerError {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("token server %s answered %s", realm, resp.Status)
+		result.Remediation = "check the logs of the token server"
+		return
+	}
+	result.Message = fmt.Sprintf("token server %s is reachable", realm)
+}
@@ -0,0 +1,107 @@
+package diagnose
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/distribution/distribution/v3/registry/auth/token"
+)
+
+func TestAuthBackendCheckHtpasswd(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name    string
+		content *string
+		status  Status
+	}{
+		{name: "users", content: strptr("# users\nadmin:$2y$05$abcdefghijklmnopqrstuv\n"), status: StatusPass},
+		{name: "no users", content: strptr("# no users\n"), status: StatusWarn},
+		{name: "invalid entry", content: strptr("admin\n"), status: StatusFail},
+		{name: "missing", status: StatusWarn},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			if tc.content != nil {
+				if err := os.WriteFile(path, []byte(*tc.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result := AuthBackendCheck{Type: "htpasswd", Parameters: map[string]interface{}{
+				"realm": "registry",
+				"path":  path,
+			}}.Check(context.Background())
+			if result.Status != tc.status {
+				t.Fatalf("unexpected status %s: %s", result.Status, result.Message)
+			}
+			if tc.content == nil {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Fatalf("expected the missing htpasswd file not to be created: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthBackendCheckToken(t *testing.T) {
+	cert, _ := writeCertificate(t, t.TempDir(), time.Now().Add(time.Hour))
+	params := func(realm string) map[string]interface{} {
+		return map[string]interface{}{
+			"realm":          realm,
+			"service":        "registry",
+			"issuer":         "auth",
+			"rootcertbundle": cert,
+		}
+	}
+
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	result := AuthBackendCheck{Type: "token", Parameters: params(server.URL)}.Check(context.Background())
+	if result.Status != StatusPass {
+		t.Fatalf("expected a reachable token server to pass, got %+v", result)
+	}
+
+	status = http.StatusBadGateway
+	result = AuthBackendCheck{Type: "token", Parameters: params(server.URL)}.Check(context.Background())
+	if result.Status != StatusFail || result.Remediation == "" {
+		t.Fatalf("expected a failing token server to fail, got %+v", result)
+	}
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	result = AuthBackendCheck{Type: "token", Parameters: params(unreachable.URL)}.Check(context.Background())
+	if result.Status != StatusFail || result.Remediation == "" {
+		t.Fatalf("expected an unreachable token server to fail, got %+v", result)
+	}
+
+	invalid := params(server.URL)
+	invalid["rootcertbundle"] = cert + ".missing"
+	result = AuthBackendCheck{Type: "token", Parameters: invalid}.Check(context.Background())
+	if result.Status != StatusFail {
+		t.Fatalf("expected a missing root certificate bundle to fail, got %+v", result)
+	}
+}
+
+func TestAuthBackendCheckOthers(t *testing.T) {
+	if result := (AuthBackendCheck{}).Check(context.Background()); result.Status != StatusPass {
+		t.Fatalf("expected no authentication to pass, got %+v", result)
+	}
+	if result := (AuthBackendCheck{Type: "silly"}).Check(context.Background()); result.Status != StatusWarn {
+		t.Fatalf("expected silly authentication to warn, got %+v", result)
+	}
+	if result := (AuthBackendCheck{Type: "unknown"}).Check(context.Background()); result.Status != StatusFail {
+		t.Fatalf("expected an unknown access controller to fail, got %+v", result)
+	}
+}
+
+func strptr(s string) *string {
+	return &s
+}
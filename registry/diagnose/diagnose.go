@@ -0,0 +1,72 @@
+// Package diagnose checks the environment a registry is configured to run
+// in, such as the reachability of its storage and authentication backends,
+// without starting the registry.
+package diagnose
+
+import (
+	"context"
+)
+
+// Status is the outcome of a check.
+type Status int
+
+const (
+	// StatusPass reports a check which found no issue.
+	StatusPass Status = iota
+
+	// StatusWarn reports an issue the registry runs with, which may still
+	// need attention, such as a certificate about to expire.
+	StatusWarn
+
+	// StatusFail reports an issue preventing the registry from serving.
+	StatusFail
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "PASS"
+	case StatusWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// CheckResult is the result of a check.
+type CheckResult struct {
+	// Name identifies the check, such as "storage".
+	Name string
+
+	Status Status
+
+	// Message describes what was checked, or the issue found.
+	Message string
+
+	// Remediation suggests how to fix the issue, if any.
+	Remediation string
+}
+
+// Checker checks a part of the environment of the registry.
+type Checker interface {
+	Check(ctx context.Context) CheckResult
+}
+
+// Run runs checkers in order, and returns their results.
+func Run(ctx context.Context, checkers ...Checker) []CheckResult {
+	results := make([]CheckResult, 0, len(checkers))
+	for _, checker := range checkers {
+		results = append(results, checker.Check(ctx))
+	}
+	return results
+}
+
+// Passed returns true if all the results passed.
+func Passed(results []CheckResult) bool {
+	for _, result := range results {
+		if result.Status != StatusPass {
+			return false
+		}
+	}
+	return true
+}
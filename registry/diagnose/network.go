@@ -0,0 +1,40 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/distribution/distribution/v3/registry/listener"
+)
+
+// NetworkBindCheck checks that the registry can listen on its address, the
+// address not being used by another process.
+type NetworkBindCheck struct {
+	// Name identifies the check, "http" by default.
+	Name string
+
+	// Net is the network of Addr, tcp or unix, tcp by default.
+	Net string
+
+	Addr string
+}
+
+// Check implements Checker.
+func (c NetworkBindCheck) Check(ctx context.Context) CheckResult {
+	result := CheckResult{Name: c.Name}
+	if result.Name == "" {
+		result.Name = "http"
+	}
+
+	ln, err := listener.NewListener(c.Net, c.Addr)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to listen on %s: %v", c.Addr, err)
+		result.Remediation = "stop the process using the address, or configure another address"
+		return result
+	}
+	ln.Close()
+
+	result.Message = fmt.Sprintf("able to listen on %s", c.Addr)
+	return result
+}
@@ -0,0 +1,39 @@
+package diagnose
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetworkBindCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	result := NetworkBindCheck{Addr: ln.Addr().String()}.Check(context.Background())
+	if result.Status != StatusFail || result.Remediation == "" {
+		t.Fatalf("expected a used address to fail, got %+v", result)
+	}
+	if result.Name != "http" {
+		t.Fatalf("unexpected default name %q", result.Name)
+	}
+
+	result = NetworkBindCheck{Addr: "127.0.0.1:0"}.Check(context.Background())
+	if result.Status != StatusPass {
+		t.Fatalf("expected a free address to pass, got %+v", result)
+	}
+
+	result = NetworkBindCheck{Name: "debug", Net: "unix", Addr: filepath.Join(t.TempDir(), "registry.sock")}.Check(context.Background())
+	if result.Status != StatusPass || result.Name != "debug" {
+		t.Fatalf("expected a unix socket to pass, got %+v", result)
+	}
+
+	result = NetworkBindCheck{Net: "udp", Addr: "127.0.0.1:0"}.Check(context.Background())
+	if result.Status != StatusFail {
+		t.Fatalf("expected an unknown network to fail, got %+v", result)
+	}
+}
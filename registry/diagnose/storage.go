@@ -0,0 +1,51 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+)
+
+// StorageDriverCheck checks that the storage driver can be constructed from
+// its parameters, and that its storage can be read.
+type StorageDriverCheck struct {
+	// Type is the name of the storage driver, such as s3.
+	Type string
+
+	// Parameters are the parameters of the storage driver.
+	Parameters map[string]interface{}
+}
+
+// Check implements Checker.
+func (c StorageDriverCheck) Check(ctx context.Context) CheckResult {
+	result := CheckResult{Name: "storage"}
+	if c.Type == "" {
+		result.Status = StatusFail
+		result.Message = "no storage driver configured"
+		result.Remediation = "configure a storage driver, such as filesystem or s3, in the storage section"
+		return result
+	}
+
+	driver, err := factory.Create(c.Type, c.Parameters)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to construct %s driver: %v", c.Type, err)
+		result.Remediation = fmt.Sprintf("check the parameters of storage.%s", c.Type)
+		return result
+	}
+
+	// An empty storage has no root yet, which is not an issue.
+	if _, err := driver.List(ctx, "/"); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("failed to read %s storage: %v", c.Type, err)
+			result.Remediation = fmt.Sprintf("check the connectivity and the credentials of storage.%s", c.Type)
+			return result
+		}
+	}
+
+	result.Message = fmt.Sprintf("%s storage is readable", c.Type)
+	return result
+}
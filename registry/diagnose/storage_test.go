@@ -0,0 +1,89 @@
+package diagnose
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+// mockDriver is a storage driver failing to list its storage with err.
+type mockDriver struct {
+	storagedriver.StorageDriver
+	err error
+}
+
+func (d mockDriver) List(ctx context.Context, path string) ([]string, error) {
+	return nil, d.err
+}
+
+type mockDriverFactory struct{}
+
+func (mockDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	if parameters["invalid"] != nil {
+		return nil, errors.New("invalid parameters")
+	}
+	err, _ := parameters["err"].(error)
+	return mockDriver{err: err}, nil
+}
+
+func init() {
+	factory.Register("diagnose-mock", mockDriverFactory{})
+}
+
+func TestStorageDriverCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		check      StorageDriverCheck
+		status     Status
+		remediated bool
+	}{
+		{
+			name:   "inmemory",
+			check:  StorageDriverCheck{Type: "inmemory"},
+			status: StatusPass,
+		},
+		{
+			name:   "empty storage",
+			check:  StorageDriverCheck{Type: "diagnose-mock", Parameters: map[string]interface{}{"err": storagedriver.PathNotFoundError{Path: "/"}}},
+			status: StatusPass,
+		},
+		{
+			name:       "unreachable storage",
+			check:      StorageDriverCheck{Type: "diagnose-mock", Parameters: map[string]interface{}{"err": errors.New("connection refused")}},
+			status:     StatusFail,
+			remediated: true,
+		},
+		{
+			name:       "invalid parameters",
+			check:      StorageDriverCheck{Type: "diagnose-mock", Parameters: map[string]interface{}{"invalid": true}},
+			status:     StatusFail,
+			remediated: true,
+		},
+		{
+			name:       "unknown driver",
+			check:      StorageDriverCheck{Type: "unknown"},
+			status:     StatusFail,
+			remediated: true,
+		},
+		{
+			name:       "no driver",
+			check:      StorageDriverCheck{},
+			status:     StatusFail,
+			remediated: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.check.Check(context.Background())
+			if result.Status != tc.status {
+				t.Fatalf("unexpected status %s: %s", result.Status, result.Message)
+			}
+			if (result.Remediation != "") != tc.remediated {
+				t.Fatalf("unexpected remediation %q", result.Remediation)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package diagnose
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultExpiryWarning is how long before the expiry of the certificate
+// TLSCertCheck warns by default.
+const defaultExpiryWarning = 30 * 24 * time.Hour
+
+// TLSCertCheck checks that the TLS certificate and key of the registry can
+// be loaded, and that the certificate is not about to expire.
+type TLSCertCheck struct {
+	// Certificate and Key are the paths of the certificate and its private
+	// key. No TLS is configured when Certificate is empty.
+	Certificate string
+	Key         string
+
+	// ClientCAs are the paths of the certificate authorities of the
+	// clients, if any.
+	ClientCAs []string
+
+	// ExpiryWarning is how long before the expiry of the certificate to
+	// warn, 30 days by default.
+	ExpiryWarning time.Duration
+
+	// Now returns the current time, time.Now by default.
+	Now func() time.Time
+}
+
+// Check implements Checker.
+func (c TLSCertCheck) Check(ctx context.Context) CheckResult {
+	result := CheckResult{Name: "tls"}
+	if c.Certificate == "" {
+		result.Message = "no TLS certificate configured, the registry serves plain HTTP"
+		return result
+	}
+
+	pair, err := tls.LoadX509KeyPair(c.Certificate, c.Key)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to load TLS certificate %s and key %s: %v", c.Certificate, c.Key, err)
+		result.Remediation = "check that http.tls.certificate and http.tls.key are readable PEM files of a matching pair"
+		return result
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("failed to parse TLS certificate %s: %v", c.Certificate, err)
+		result.Remediation = "replace http.tls.certificate with a valid x509 certificate"
+		return result
+	}
+
+	for _, ca := range c.ClientCAs {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("failed to read client CA %s: %v", ca, err)
+			result.Remediation = "check the paths of http.tls.clientcas"
+			return result
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("no certificate found in client CA %s", ca)
+			result.Remediation = "check that http.tls.clientcas are PEM encoded certificates"
+			return result
+		}
+	}
+
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	expiryWarning := c.ExpiryWarning
+	if expiryWarning == 0 {
+		expiryWarning = defaultExpiryWarning
+	}
+	remaining := cert.NotAfter.Sub(now())
+	switch {
+	case remaining <= 0:
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("TLS certificate %s expired on %s", c.Certificate, cert.NotAfter.Format(time.RFC3339))
+		result.Remediation = "renew the certificate"
+	case remaining < expiryWarning:
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("TLS certificate %s expires in %d days, on %s", c.Certificate, int(remaining.Hours()/24), cert.NotAfter.Format(time.RFC3339))
+		result.Remediation = "renew the certificate before it expires"
+	default:
+		result.Message = fmt.Sprintf("TLS certificate %s is valid until %s", c.Certificate, cert.NotAfter.Format(time.RFC3339))
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package diagnose
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate valid until notAfter
+// and its key to dir, and returns their paths.
+func writeCertificate(t *testing.T, dir string, notAfter time.Time) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "registry.example.com"},
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestTLSCertCheck(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	for _, tc := range []struct {
+		name      string
+		notAfter  time.Time
+		clientCAs bool
+		status    Status
+	}{
+		{name: "valid", notAfter: now.Add(90 * 24 * time.Hour), status: StatusPass},
+		{name: "valid with client CAs", notAfter: now.Add(90 * 24 * time.Hour), clientCAs: true, status: StatusPass},
+		{name: "expiring", notAfter: now.Add(10 * 24 * time.Hour), status: StatusWarn},
+		{name: "expired", notAfter: now.Add(-time.Hour), status: StatusFail},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cert, key := writeCertificate(t, t.TempDir(), tc.notAfter)
+			check := TLSCertCheck{Certificate: cert, Key: key, Now: clock}
+			if tc.clientCAs {
+				check.ClientCAs = []string{cert}
+			}
+			result := check.Check(context.Background())
+			if result.Status != tc.status {
+				t.Fatalf("unexpected status %s: %s", result.Status, result.Message)
+			}
+			if (result.Status != StatusPass) != (result.Remediation != "") {
+				t.Fatalf("unexpected remediation %q", result.Remediation)
+			}
+		})
+	}
+
+	t.Run("mismatched key", func(t *testing.T) {
+		cert, _ := writeCertificate(t, t.TempDir(), now.Add(90*24*time.Hour))
+		_, key := writeCertificate(t, t.TempDir(), now.Add(90*24*time.Hour))
+		result := TLSCertCheck{Certificate: cert, Key: key, Now: clock}.Check(context.Background())
+		if result.Status != StatusFail {
+			t.Fatalf("expected a mismatched key to fail, got %+v", result)
+		}
+	})
+
+	t.Run("missing client CA", func(t *testing.T) {
+		cert, key := writeCertificate(t, t.TempDir(), now.Add(90*24*time.Hour))
+		result := TLSCertCheck{Certificate: cert, Key: key, ClientCAs: []string{key + ".missing"}, Now: clock}.Check(context.Background())
+		if result.Status != StatusFail {
+			t.Fatalf("expected a missing client CA to fail, got %+v", result)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		result := TLSCertCheck{}.Check(context.Background())
+		if result.Status != StatusPass {
+			t.Fatalf("expected no TLS to pass, got %+v", result)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+// Package dockersave pushes images exported by a Docker daemon, in the
+// format of docker save, to a registry.
+package dockersave
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/client"
+)
+
+// DefaultSocket is the default path of the Docker daemon socket.
+const DefaultSocket = "/var/run/docker.sock"
+
+// DaemonClient talks to the API of a Docker daemon over its unix socket.
+type DaemonClient struct {
+	client *client.Client
+}
+
+// NewDaemonClient returns a client for the Docker daemon listening on the
+// unix socket at path.
+func NewDaemonClient(path string) (*DaemonClient, error) {
+	c, err := client.NewClientWithOpts(client.WithHost("unix://" + path))
+	if err != nil {
+		return nil, err
+	}
+	return &DaemonClient{client: c}, nil
+}
+
+// ImageSave returns the tar archive of image, in the format of docker save.
+// The caller must close the returned reader.
+func (c *DaemonClient) ImageSave(ctx context.Context, image string) (io.ReadCloser, error) {
+	rc, err := c.client.ImageSave(ctx, []string{image})
+	if err != nil {
+		return nil, fmt.Errorf("saving image %s: %w", image, err)
+	}
+	return rc, nil
+}
@@ -0,0 +1,365 @@
+package dockersave
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+// maxMetadataSize bounds the size of the JSON files read from an archive.
+const maxMetadataSize = 8 << 20
+
+// Push reads the docker save archive r and pushes its image to repo, tagged
+// tag. Both the current archive format, described by manifest.json, and the
+// legacy format, described by a repositories file and the json file of each
+// layer, are supported.
+//
+// The archive is read as a stream: layers are compressed and pushed as they
+// are found, without being buffered.
+func Push(ctx context.Context, r io.Reader, repo distribution.Repository, tag string) (distribution.Descriptor, error) {
+	a := &archive{
+		blobs:  repo.Blobs(ctx),
+		layers: make(map[string]layer),
+		links:  make(map[string]string),
+		files:  make(map[string][]byte),
+	}
+	if err := a.read(ctx, r); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	var (
+		config []byte
+		layers []layer
+		err    error
+	)
+	switch {
+	case a.files["manifest.json"] != nil:
+		config, layers, err = a.image()
+	case a.files["repositories"] != nil:
+		config, layers, err = a.legacyImage()
+	default:
+		err = errors.New("not a docker save archive: no manifest.json or repositories file")
+	}
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	configDesc, err := a.blobs.Put(ctx, schema2.MediaTypeImageConfig, config)
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("pushing image config: %v", err)
+	}
+	configDesc.MediaType = schema2.MediaTypeImageConfig
+
+	m := schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    configDesc,
+	}
+	for _, l := range layers {
+		m.Layers = append(m.Layers, l.desc)
+	}
+	manifest, err := schema2.FromStruct(m)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	dgst, err := ms.Put(ctx, manifest, distribution.WithTag(tag))
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("pushing manifest: %v", err)
+	}
+
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return distribution.Descriptor{
+		MediaType: schema2.MediaTypeManifest,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+// layer is a layer pushed from an archive.
+type layer struct {
+	desc   distribution.Descriptor
+	diffID digest.Digest
+}
+
+// archive holds the content read from a docker save archive.
+type archive struct {
+	blobs distribution.BlobStore
+
+	// layers are the pushed layers, by path in the archive.
+	layers map[string]layer
+	// links are the targets of the symbolic and hard links of the archive,
+	// which docker save uses for layers shared by several images.
+	links map[string]string
+	// files are the metadata files of the archive.
+	files map[string][]byte
+}
+
+func (a *archive) read(ctx context.Context, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %v", err)
+		}
+
+		name := cleanPath(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			a.links[name] = cleanPath(path.Join(path.Dir(name), hdr.Linkname))
+		case tar.TypeLink:
+			a.links[name] = cleanPath(hdr.Linkname)
+		case tar.TypeReg:
+			switch {
+			case path.Base(name) == "layer.tar":
+				l, err := a.pushLayer(ctx, tr)
+				if err != nil {
+					return fmt.Errorf("pushing layer %s: %v", name, err)
+				}
+				a.layers[name] = l
+			case name == "repositories" || strings.HasSuffix(name, "json"):
+				p, err := io.ReadAll(io.LimitReader(tr, maxMetadataSize+1))
+				if err != nil {
+					return fmt.Errorf("reading %s: %v", name, err)
+				}
+				if len(p) > maxMetadataSize {
+					return fmt.Errorf("%s is too large", name)
+				}
+				a.files[name] = p
+			}
+		}
+	}
+}
+
+// pushLayer pushes the uncompressed layer r, compressed with gzip.
+func (a *archive) pushLayer(ctx context.Context, r io.Reader) (layer, error) {
+	bw, err := a.blobs.Create(ctx)
+	if err != nil {
+		return layer{}, err
+	}
+
+	diffID := digest.Canonical.Digester()
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, io.TeeReader(r, diffID.Hash()))
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	compressed := digest.Canonical.Digester()
+	n, err := bw.ReadFrom(io.TeeReader(pr, compressed.Hash()))
+	if err != nil {
+		pr.CloseWithError(err)
+		bw.Cancel(ctx)
+		return layer{}, err
+	}
+
+	desc, err := bw.Commit(ctx, distribution.Descriptor{
+		MediaType: schema2.MediaTypeLayer,
+		Digest:    compressed.Digest(),
+		Size:      n,
+	})
+	if err != nil {
+		return layer{}, err
+	}
+	desc.MediaType = schema2.MediaTypeLayer
+	return layer{desc: desc, diffID: diffID.Digest()}, nil
+}
+
+// layer returns the layer pushed from the archive path p, following links.
+func (a *archive) layer(p string) (layer, error) {
+	p = cleanPath(p)
+	for i := 0; i < 16; i++ {
+		if l, ok := a.layers[p]; ok {
+			return l, nil
+		}
+		target, ok := a.links[p]
+		if !ok {
+			break
+		}
+		p = target
+	}
+	return layer{}, fmt.Errorf("layer %s not found in archive", p)
+}
+
+// image returns the config and layers of the image described by
+// manifest.json. Only the first image of the archive is pushed.
+func (a *archive) image() ([]byte, []layer, error) {
+	var manifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := json.Unmarshal(a.files["manifest.json"], &manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest.json: %v", err)
+	}
+	if len(manifest) == 0 {
+		return nil, nil, errors.New("manifest.json lists no image")
+	}
+
+	config, ok := a.files[cleanPath(manifest[0].Config)]
+	if !ok {
+		return nil, nil, fmt.Errorf("image config %s not found in archive", manifest[0].Config)
+	}
+	var image struct {
+		RootFS struct {
+			DiffIDs []digest.Digest `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(config, &image); err != nil {
+		return nil, nil, fmt.Errorf("invalid image config: %v", err)
+	}
+
+	var layers []layer
+	for _, p := range manifest[0].Layers {
+		l, err := a.layer(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, l)
+	}
+
+	if len(image.RootFS.DiffIDs) != len(layers) {
+		return nil, nil, fmt.Errorf("image config lists %d layers, archive has %d", len(image.RootFS.DiffIDs), len(layers))
+	}
+	for i, l := range layers {
+		if image.RootFS.DiffIDs[i] != l.diffID {
+			return nil, nil, fmt.Errorf("layer %d has diff ID %s, image config expects %s", i, l.diffID, image.RootFS.DiffIDs[i])
+		}
+	}
+	return config, layers, nil
+}
+
+// legacyImage returns the layers of the image described by the repositories
+// file, along with an image config built from the json file of its top
+// layer, as docker does when migrating legacy images.
+func (a *archive) legacyImage() ([]byte, []layer, error) {
+	var repositories map[string]map[string]string
+	if err := json.Unmarshal(a.files["repositories"], &repositories); err != nil {
+		return nil, nil, fmt.Errorf("invalid repositories file: %v", err)
+	}
+	top := firstImageID(repositories)
+	if top == "" {
+		return nil, nil, errors.New("repositories file lists no image")
+	}
+
+	// Walk from the top layer to the base layer.
+	var (
+		layers  []layer
+		history []map[string]interface{}
+		config  map[string]interface{}
+	)
+	for id := top; id != ""; {
+		p, ok := a.files[id+"/json"]
+		if !ok {
+			return nil, nil, fmt.Errorf("layer %s has no json file", id)
+		}
+		var v1 map[string]interface{}
+		if err := json.Unmarshal(p, &v1); err != nil {
+			return nil, nil, fmt.Errorf("invalid json file of layer %s: %v", id, err)
+		}
+		if config == nil {
+			config = v1
+		}
+
+		l, err := a.layer(id + "/layer.tar")
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append([]layer{l}, layers...)
+
+		entry := map[string]interface{}{}
+		if created, ok := v1["created"]; ok {
+			entry["created"] = created
+		}
+		if cc, ok := v1["container_config"].(map[string]interface{}); ok {
+			if cmd, ok := cc["Cmd"].([]interface{}); ok {
+				var parts []string
+				for _, part := range cmd {
+					parts = append(parts, fmt.Sprint(part))
+				}
+				entry["created_by"] = strings.Join(parts, " ")
+			}
+		}
+		history = append([]map[string]interface{}{entry}, history...)
+
+		parent, _ := v1["parent"].(string)
+		id = parent
+		if len(layers) > 1000 {
+			return nil, nil, errors.New("layer chain is too long")
+		}
+	}
+
+	for _, key := range []string{"id", "parent", "Size", "parent_id", "layer_id", "throwaway"} {
+		delete(config, key)
+	}
+	if _, ok := config["created"]; !ok {
+		config["created"] = time.Time{}
+	}
+	var diffIDs []digest.Digest
+	for _, l := range layers {
+		diffIDs = append(diffIDs, l.diffID)
+	}
+	config["rootfs"] = map[string]interface{}{
+		"type":     "layers",
+		"diff_ids": diffIDs,
+	}
+	config["history"] = history
+
+	p, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, layers, nil
+}
+
+// firstImageID returns the image ID of the first tag of the first
+// repository, in lexical order.
+func firstImageID(repositories map[string]map[string]string) string {
+	var names []string
+	for name := range repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var tags []string
+		for tag := range repositories[name] {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		if len(tags) > 0 {
+			return repositories[name][tags[0]]
+		}
+	}
+	return ""
+}
+
+// cleanPath normalizes a path of the archive.
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
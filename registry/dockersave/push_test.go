@@ -0,0 +1,315 @@
+package dockersave
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/client"
+	"github.com/distribution/distribution/v3/registry/handlers"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+type tarEntry struct {
+	name     string
+	content  []byte
+	linkname string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.linkname != "" {
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.linkname, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// layerTars returns two layers, as found in a docker save archive.
+func layerTars(t *testing.T) [][]byte {
+	return [][]byte{
+		buildTar(t, []tarEntry{{name: "etc/hostname", content: []byte("base\n")}}),
+		buildTar(t, []tarEntry{{name: "app/run.sh", content: []byte("#!/bin/sh\necho hello\n")}}),
+	}
+}
+
+// archiveV2 returns an archive in the current docker save format, where the
+// second layer of the manifest is a link to the first one.
+func archiveV2(t *testing.T) ([]byte, [][]byte) {
+	layers := layerTars(t)
+	layers = append(layers, layers[0])
+
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs": map[string]interface{}{
+			"type": "layers",
+			"diff_ids": []digest.Digest{
+				digest.FromBytes(layers[0]),
+				digest.FromBytes(layers[1]),
+				digest.FromBytes(layers[2]),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configName := digest.FromBytes(config).Hex() + ".json"
+
+	manifest, err := json.Marshal([]map[string]interface{}{{
+		"Config":   configName,
+		"RepoTags": []string{"app:latest"},
+		"Layers":   []string{"aaa/layer.tar", "bbb/layer.tar", "ccc/layer.tar"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buildTar(t, []tarEntry{
+		{name: "aaa/VERSION", content: []byte("1.0")},
+		{name: "aaa/layer.tar", content: layers[0]},
+		{name: "bbb/layer.tar", content: layers[1]},
+		{name: "ccc/layer.tar", linkname: "../aaa/layer.tar"},
+		{name: configName, content: config},
+		{name: "manifest.json", content: manifest},
+	}), layers
+}
+
+// archiveV1 returns an archive in the legacy docker save format.
+func archiveV1(t *testing.T) ([]byte, [][]byte) {
+	layers := layerTars(t)
+
+	return buildTar(t, []tarEntry{
+		{name: "repositories", content: []byte(`{"app":{"latest":"top"}}`)},
+		{name: "base/json", content: []byte(`{"id":"base","created":"2016-01-01T00:00:00Z"}`)},
+		{name: "base/layer.tar", content: layers[0]},
+		{name: "top/json", content: []byte(`{"id":"top","parent":"base","created":"2016-01-02T00:00:00Z",` +
+			`"architecture":"amd64","os":"linux","container_config":{"Cmd":["/bin/sh","-c","echo hello"]}}`)},
+		{name: "top/layer.tar", content: layers[1]},
+	}), layers
+}
+
+// newDockerSocket serves the archives on a unix socket mocking the image
+// export endpoint of the Docker daemon.
+func newDockerSocket(t *testing.T, archives map[string][]byte) string {
+	t.Helper()
+
+	// Unix socket paths are limited in length, so avoid t.TempDir.
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The path is prefixed with the version of the API.
+		image := r.URL.Query().Get("names")
+		archive, ok := archives[image]
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/images/get") || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such image: ` + image + `"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Write(archive)
+	})}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+
+	return socket
+}
+
+func newTestRepository(t *testing.T, name string) distribution.Repository {
+	t.Helper()
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	server := httptest.NewServer(handlers.NewApp(context.Background(), config))
+	t.Cleanup(server.Close)
+
+	named, err := reference.WithName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := client.NewRepository(named, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// checkPushed checks that tag references a schema2 manifest of the given
+// layers, and returns its image config.
+func checkPushed(t *testing.T, repo distribution.Repository, tag string, layers [][]byte) map[string]interface{} {
+	t.Helper()
+	ctx := context.Background()
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ms.Get(ctx, "", distribution.WithTag(tag))
+	if err != nil {
+		t.Fatalf("error fetching pushed manifest: %v", err)
+	}
+	manifest, ok := m.(*schema2.DeserializedManifest)
+	if !ok {
+		t.Fatalf("expected a schema2 manifest, got %T", m)
+	}
+	if len(manifest.Layers) != len(layers) {
+		t.Fatalf("expected %d layers, got %d", len(layers), len(manifest.Layers))
+	}
+
+	blobs := repo.Blobs(ctx)
+	for i, desc := range manifest.Layers {
+		if desc.MediaType != schema2.MediaTypeLayer {
+			t.Errorf("layer %d: unexpected media type %s", i, desc.MediaType)
+		}
+		p, err := blobs.Get(ctx, desc.Digest)
+		if err != nil {
+			t.Fatalf("layer %d: %v", i, err)
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(p))
+		if err != nil {
+			t.Fatalf("layer %d: %v", i, err)
+		}
+		uncompressed, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatalf("layer %d: %v", i, err)
+		}
+		if !bytes.Equal(uncompressed, layers[i]) {
+			t.Fatalf("layer %d: content does not match", i)
+		}
+	}
+
+	p, err := blobs.Get(ctx, manifest.Config.Digest)
+	if err != nil {
+		t.Fatalf("error fetching image config: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(p, &config); err != nil {
+		t.Fatalf("invalid image config: %v", err)
+	}
+
+	diffIDs := config["rootfs"].(map[string]interface{})["diff_ids"].([]interface{})
+	if len(diffIDs) != len(layers) {
+		t.Fatalf("expected %d diff IDs, got %d", len(layers), len(diffIDs))
+	}
+	for i, diffID := range diffIDs {
+		if diffID != digest.FromBytes(layers[i]).String() {
+			t.Errorf("layer %d: unexpected diff ID %s", i, diffID)
+		}
+	}
+	return config
+}
+
+func TestPush(t *testing.T) {
+	v2, v2Layers := archiveV2(t)
+	v1, v1Layers := archiveV1(t)
+	socket := newDockerSocket(t, map[string][]byte{"app:latest": v2, "legacy": v1})
+	daemon, err := NewDaemonClient(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("v2", func(t *testing.T) {
+		repo := newTestRepository(t, "foo/app")
+		rc, err := daemon.ImageSave(ctx, "app:latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+
+		if _, err := Push(ctx, rc, repo, "1.0"); err != nil {
+			t.Fatalf("error pushing image: %v", err)
+		}
+		checkPushed(t, repo, "1.0", v2Layers)
+	})
+
+	t.Run("v1", func(t *testing.T) {
+		repo := newTestRepository(t, "foo/legacy")
+		rc, err := daemon.ImageSave(ctx, "legacy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+
+		if _, err := Push(ctx, rc, repo, "1.0"); err != nil {
+			t.Fatalf("error pushing image: %v", err)
+		}
+		config := checkPushed(t, repo, "1.0", v1Layers)
+
+		if config["architecture"] != "amd64" || config["id"] != nil || config["parent"] != nil {
+			t.Errorf("unexpected image config: %v", config)
+		}
+		history := config["history"].([]interface{})
+		if len(history) != 2 || history[1].(map[string]interface{})["created_by"] != "/bin/sh -c echo hello" {
+			t.Errorf("unexpected history: %v", history)
+		}
+	})
+
+	t.Run("unknown image", func(t *testing.T) {
+		_, err := daemon.ImageSave(ctx, "unknown")
+		if err == nil || !strings.Contains(err.Error(), "No such image") {
+			t.Fatalf("expected an error for an unknown image, got %v", err)
+		}
+	})
+}
+
+func TestPushRejectsMismatchedDiffIDs(t *testing.T) {
+	layers := layerTars(t)
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":["` + digest.FromBytes(layers[1]).String() + `"]}}`)
+	archive := buildTar(t, []tarEntry{
+		{name: "aaa/layer.tar", content: layers[0]},
+		{name: "config.json", content: config},
+		{name: "manifest.json", content: []byte(`[{"Config":"config.json","Layers":["aaa/layer.tar"]}]`)},
+	})
+
+	repo := newTestRepository(t, "foo/app")
+	_, err := Push(context.Background(), bytes.NewReader(archive), repo, "1.0")
+	if err == nil || !strings.Contains(err.Error(), "diff ID") {
+		t.Fatalf("expected a diff ID mismatch error, got %v", err)
+	}
+}
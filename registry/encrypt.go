@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/distribution/distribution/v3/registry/ocicrypt"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cryptKeyFile    string
+	cryptRecipients []string
+	cryptUsername   string
+	cryptPassword   string
+	cryptPlainHTTP  bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{EncryptCmd, DecryptCmd} {
+		cmd.Flags().StringVarP(&cryptUsername, "username", "u", "", "username for the registry")
+		cmd.Flags().StringVarP(&cryptPassword, "password", "p", "", "password for the registry")
+		cmd.Flags().BoolVar(&cryptPlainHTTP, "plain-http", false, "connect to the registry over plain HTTP")
+	}
+	EncryptCmd.Flags().StringArrayVar(&cryptRecipients, "recipient", nil, "path of the PEM encoded RSA public key to encrypt for (can be repeated)")
+	EncryptCmd.Flags().StringVar(&cryptKeyFile, "key-file", "", "path of the PEM encoded RSA private key of layers already encrypted, to add the recipients to")
+	DecryptCmd.Flags().StringVar(&cryptKeyFile, "key-file", "", "path of the PEM encoded RSA private key decrypting the layers")
+	EncryptCmd.MarkFlagRequired("recipient")
+	DecryptCmd.MarkFlagRequired("key-file")
+}
+
+func cryptOptions() ocicrypt.Options {
+	return ocicrypt.Options{
+		Auth: remote.AuthConfig{
+			Username: cryptUsername,
+			Password: cryptPassword,
+		},
+		PlainHTTP: cryptPlainHTTP,
+	}
+}
+
+// EncryptCmd is the cobra command that corresponds to the encrypt subcommand
+var EncryptCmd = &cobra.Command{
+	Use:   "encrypt --recipient <pubkey> [--key-file <pem>] <ref>",
+	Short: "`encrypt` encrypts the layers of an image",
+	Long: "`encrypt` encrypts the layers of the OCI image referenced by <ref> for the recipients, and pushes " +
+		"the encrypted image in its place. Layers already encrypted are left as they are, unless --key-file " +
+		"decrypts them, in which case the recipients are added to them.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var recipients []*rsa.PublicKey
+		for _, path := range cryptRecipients {
+			recipient, err := ocicrypt.LoadPublicKey(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load recipient: %v\n", err)
+				os.Exit(1)
+			}
+			recipients = append(recipients, recipient)
+		}
+		var key *rsa.PrivateKey
+		if cryptKeyFile != "" {
+			var err error
+			if key, err = ocicrypt.LoadPrivateKey(cryptKeyFile); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load key: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		desc, err := ocicrypt.Encrypt(dcontext.Background(), args[0], recipients, key, cryptOptions())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encrypt image: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(desc.Digest)
+	},
+}
+
+// DecryptCmd is the cobra command that corresponds to the decrypt subcommand
+var DecryptCmd = &cobra.Command{
+	Use:   "decrypt --key-file <pem> <ref>",
+	Short: "`decrypt` decrypts the layers of an image",
+	Long:  "`decrypt` decrypts the layers of the OCI image referenced by <ref> with the key, and pushes the decrypted image in its place.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := ocicrypt.LoadPrivateKey(cryptKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load key: %v\n", err)
+			os.Exit(1)
+		}
+
+		desc, err := ocicrypt.Decrypt(dcontext.Background(), args[0], key, cryptOptions())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to decrypt image: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(desc.Digest)
+	},
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
@@ -18,11 +20,13 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/configuration"
 	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/manifest/schema1"
 	"github.com/distribution/distribution/v3/manifest/schema2"
 	"github.com/distribution/distribution/v3/reference"
@@ -35,6 +39,7 @@ import (
 	"github.com/docker/libtrust"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var headerConfig = http.Header{
@@ -196,6 +201,55 @@ func TestCatalogAPI(t *testing.T) {
 	}
 }
 
+func TestCatalogAPICursor(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	images := []string{"foo/aaaa", "foo/bbbb", "foo/cccc"}
+	for _, image := range images {
+		createRepository(env, t, image, "sometag")
+	}
+
+	catalogURL, err := env.builder.BuildCatalogURL(url.Values{
+		"n":      []string{"1"},
+		"cursor": []string{encodeCatalogCursor("foo/aaaa")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+	resp, err := http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+
+	var ctlg struct {
+		Repositories []string `json:"repositories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding catalog: %v", err)
+	}
+	if len(ctlg.Repositories) != 1 || ctlg.Repositories[0] != "foo/bbbb" {
+		t.Fatalf("expected the repository after the cursor, got %v", ctlg.Repositories)
+	}
+	checkLink(t, resp.Header.Get("Link"), 1, "foo/bbbb")
+
+	for _, cursor := range []string{"not base64!", encodeCatalogCursor("Not/A/Name")} {
+		catalogURL, err := env.builder.BuildCatalogURL(url.Values{"cursor": []string{cursor}})
+		if err != nil {
+			t.Fatalf("unexpected error building catalog url: %v", err)
+		}
+		resp, err := http.Get(catalogURL)
+		if err != nil {
+			t.Fatalf("unexpected error issuing request: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "issuing catalog api check with an invalid cursor", resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "invalid cursor", resp, v2.ErrorCodePaginationCursorInvalid)
+	}
+}
+
 // TestTagsAPI tests the /v2/<name>/tags/list endpoint
 func TestTagsAPI(t *testing.T) {
 	env := newTestEnv(t, false)
@@ -309,10 +363,17 @@ func TestTagsAPI(t *testing.T) {
 			queryParams:        url.Values{"last": []string{"does-not-exist"}, "n": []string{"3"}},
 			expectedStatusCode: http.StatusOK,
 			expectedBody: tagsAPIResponse{Name: imageName.Name(), Tags: []string{
+				"jyi7b",
 				"kb0j5",
 				"sb71y",
 			}},
 		},
+		{
+			name:               "after final tag",
+			queryParams:        url.Values{"last": []string{"sb71y"}, "n": []string{"3"}},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       tagsAPIResponse{Name: imageName.Name(), Tags: []string{}},
+		},
 	}
 
 	for _, test := range tt {
@@ -366,8 +427,8 @@ func checkLink(t *testing.T, urlStr string, numEntries int, last string) url.Val
 		t.Fatalf("Catalog link entry size is incorrect")
 	}
 
-	if urlValues.Get("last") != last {
-		t.Fatal("Catalog link last entry is incorrect")
+	if urlValues.Get("cursor") != encodeCatalogCursor(last) {
+		t.Fatal("Catalog link cursor is incorrect")
 	}
 
 	return urlValues
@@ -949,6 +1010,215 @@ func TestDeleteReadOnly(t *testing.T) {
 	checkResponse(t, "deleting layer in read-only mode", resp, http.StatusMethodNotAllowed)
 }
 
+func TestBlobBatch(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.BlobBatch.MaxSize = 3
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/batch")
+	layerFile, layerDigest, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random layer file: %v", err)
+	}
+	layerSize, err := layerFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("error getting layer size: %v", err)
+	}
+	if _, err := layerFile.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("error rewinding layer file: %v", err)
+	}
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, layerDigest, uploadURLBase, layerFile)
+
+	batchURL, err := env.builder.BuildBlobBatchURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building blob batch url: %v", err)
+	}
+	checkBlobs := func(digests ...digest.Digest) *http.Response {
+		p, err := json.Marshal(blobBatchRequest{Digests: digests})
+		if err != nil {
+			t.Fatalf("unexpected error marshaling blob batch: %v", err)
+		}
+		resp, err := http.Post(batchURL, "application/json", bytes.NewReader(p))
+		if err != nil {
+			t.Fatalf("unexpected error checking blobs: %v", err)
+		}
+		return resp
+	}
+
+	missing := digest.FromString("never pushed")
+	resp := checkBlobs(missing, layerDigest)
+	defer resp.Body.Close()
+	checkResponse(t, "checking blobs", resp, http.StatusOK)
+	var batch blobBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		t.Fatalf("error decoding blob batch response: %v", err)
+	}
+	expected := []blobBatchResult{
+		{Digest: missing},
+		{Digest: layerDigest, Exists: true, Size: layerSize},
+	}
+	if !reflect.DeepEqual(batch.Results, expected) {
+		t.Fatalf("unexpected blob batch results: %+v != %+v", batch.Results, expected)
+	}
+
+	resp = checkBlobs(missing, layerDigest, missing, layerDigest)
+	defer resp.Body.Close()
+	checkResponse(t, "checking too many blobs", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "checking too many blobs", resp, v2.ErrorCodeBlobBatchInvalid)
+
+	resp = checkBlobs("sha256:invalid")
+	defer resp.Body.Close()
+	checkResponse(t, "checking an invalid digest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "checking an invalid digest", resp, v2.ErrorCodeDigestInvalid)
+}
+
+func TestBlobImport(t *testing.T) {
+	content := []byte("imported blob content")
+	contentDigest := digest.FromBytes(content)
+
+	// The server stands for S3, serving the object of a presigned URL, and
+	// that of a signed request.
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/blob" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("X-Amz-Signature") == "" && !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			http.Error(w, "missing signature", http.StatusForbidden)
+			return
+		}
+		w.Write(content)
+	}))
+	defer s3.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.BlobImport.Enabled = true
+	config.HTTP.BlobImport.AllowedURLs = []string{s3.URL + "/bucket/"}
+	config.HTTP.BlobImport.Credentials = []configuration.ImportCredentials{
+		{
+			URL:       "s3://bucket/",
+			AccessKey: "AKIDEXAMPLE",
+			SecretKey: "secret",
+			Endpoint:  s3.URL,
+		},
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/import")
+	importURL, err := env.builder.BuildBlobImportURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building blob import url: %v", err)
+	}
+	importBlob := func(rawURL string, dgst digest.Digest) *http.Response {
+		p, err := json.Marshal(blobImportRequest{URL: rawURL, Digest: dgst})
+		if err != nil {
+			t.Fatalf("unexpected error marshaling blob import: %v", err)
+		}
+		resp, err := http.Post(importURL, "application/json", bytes.NewReader(p))
+		if err != nil {
+			t.Fatalf("unexpected error importing blob: %v", err)
+		}
+		return resp
+	}
+
+	resp := importBlob(s3.URL+"/bucket/blob?X-Amz-Signature=presigned", contentDigest)
+	defer resp.Body.Close()
+	checkResponse(t, "importing a blob from a presigned url", resp, http.StatusCreated)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{contentDigest.String()},
+	})
+	var desc distribution.Descriptor
+	if err := json.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		t.Fatalf("error decoding blob import response: %v", err)
+	}
+	if desc.Digest != contentDigest || desc.Size != int64(len(content)) {
+		t.Fatalf("unexpected descriptor of imported blob: %+v", desc)
+	}
+
+	ref, _ := reference.WithDigest(imageName, contentDigest)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+	resp, err = http.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching imported blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching imported blob", resp, http.StatusOK)
+	p, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading imported blob: %v", err)
+	}
+	if !bytes.Equal(p, content) {
+		t.Fatalf("unexpected content of imported blob: %q", p)
+	}
+
+	// Importing through s3:// signs the request with the credentials.
+	imageName, _ = reference.WithName("foo/imports3")
+	importURL, err = env.builder.BuildBlobImportURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building blob import url: %v", err)
+	}
+	resp = importBlob("s3://bucket/blob", contentDigest)
+	defer resp.Body.Close()
+	checkResponse(t, "importing a blob from s3", resp, http.StatusCreated)
+
+	resp = importBlob(s3.URL+"/bucket/blob?X-Amz-Signature=presigned", digest.FromString("other content"))
+	defer resp.Body.Close()
+	checkResponse(t, "importing a blob of another digest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "importing a blob of another digest", resp, v2.ErrorCodeDigestInvalid)
+
+	resp = importBlob(s3.URL+"/elsewhere/blob", contentDigest)
+	defer resp.Body.Close()
+	checkResponse(t, "importing a blob from a disallowed url", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "importing a blob from a disallowed url", resp, v2.ErrorCodeBlobImportInvalid)
+
+	for _, rawURL := range []string{
+		s3.URL + "/bucket/../elsewhere/blob",
+		s3.URL + "/bucket/%2e%2e/elsewhere/blob",
+		"s3://bucket/%2e%2e/elsewhere/blob",
+	} {
+		resp = importBlob(rawURL, contentDigest)
+		defer resp.Body.Close()
+		checkResponse(t, "importing a blob from a url with dot segments", resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "importing a blob from a url with dot segments", resp, v2.ErrorCodeBlobImportInvalid)
+	}
+
+	// The status of the upstream response is not disclosed.
+	resp = importBlob(s3.URL+"/bucket/missing", digest.FromString("missing content"))
+	defer resp.Body.Close()
+	checkResponse(t, "importing a missing blob", resp, http.StatusBadGateway)
+	p, err = io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading response: %v", err)
+	}
+	if bytes.Contains(p, []byte("404")) || bytes.Contains(p, []byte("Not Found")) {
+		t.Fatalf("upstream status disclosed in response: %s", p)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(p))
+	checkBodyHasErrorCodes(t, "importing a missing blob", resp, v2.ErrorCodeBlobImportFailed)
+}
+
 func TestStartPushReadOnly(t *testing.T) {
 	env := newTestEnv(t, true)
 	defer env.Shutdown()
@@ -1205,6 +1475,359 @@ func TestManifestDeleteDisabled(t *testing.T) {
 	testManifestDeleteDisabled(t, env, schema1Repo)
 }
 
+func TestManifestDeleteTombstone(t *testing.T) {
+	for _, tombstones := range []bool{true, false} {
+		config := configuration.Configuration{
+			Storage: configuration.Storage{
+				"testdriver": configuration.Parameters{},
+				"delete":     configuration.Parameters{"enabled": true, "tombstones": tombstones},
+				"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+					"enabled": false,
+				}},
+			},
+		}
+		config.Compatibility.Schema1.Enabled = true
+		config.HTTP.Headers = headerConfig
+		env := newTestEnvWithConfig(t, &config)
+		defer env.Shutdown()
+
+		imageName, _ := reference.WithName("foo/tombstone")
+		deleted := createRepository(env, t, imageName.Name(), "old")
+		replacement := createRepository(env, t, imageName.Name(), "new")
+
+		ref, _ := reference.WithDigest(imageName, deleted)
+		manifestURL, err := env.builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error getting manifest url: %v", err)
+		}
+		resp, err := httpDelete(manifestURL + "?reason=vulnerable&replaced_by=" + replacement.String())
+		if err != nil {
+			t.Fatalf("unexpected error deleting manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "deleting manifest", resp, http.StatusAccepted)
+
+		resp, err = http.Get(manifestURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching deleted manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		if !tombstones {
+			checkResponse(t, "fetching deleted manifest without tombstones", resp, http.StatusNotFound)
+			checkBodyHasErrorCodes(t, "fetching deleted manifest without tombstones", resp, v2.ErrorCodeManifestUnknown)
+			continue
+		}
+		checkResponse(t, "fetching deleted manifest", resp, http.StatusGone)
+		errs, _, _ := checkBodyHasErrorCodes(t, "fetching deleted manifest", resp, v2.ErrorCodeManifestDeleted)
+		detail, ok := errs[0].(errcode.Error).Detail.(map[string]interface{})
+		if !ok {
+			t.Fatalf("unexpected detail of deleted manifest error: %#v", errs[0])
+		}
+		if detail["reason"] != "vulnerable" || detail["replaced_by"] != replacement.String() || detail["digest"] != deleted.String() || detail["deleted_at"] == nil {
+			t.Fatalf("unexpected detail of deleted manifest error: %v", detail)
+		}
+
+		// Manifests which never existed remain unknown.
+		ref, _ = reference.WithDigest(imageName, digest.FromString("never pushed"))
+		unknownURL, err := env.builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error getting manifest url: %v", err)
+		}
+		resp, err = http.Get(unknownURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching unknown manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "fetching unknown manifest", resp, http.StatusNotFound)
+
+		// The replacement must be a digest.
+		ref, _ = reference.WithDigest(imageName, replacement)
+		manifestURL, err = env.builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error getting manifest url: %v", err)
+		}
+		resp, err = httpDelete(manifestURL + "?replaced_by=latest")
+		if err != nil {
+			t.Fatalf("unexpected error deleting manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "deleting manifest with an invalid replacement", resp, http.StatusBadRequest)
+	}
+}
+
+func TestManifestChain(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/chain")
+	image := createRepository(env, t, imageName.Name(), "latest")
+
+	configBlob := []byte("{}")
+	configDigest := digest.FromBytes(configBlob)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(configBlob))
+
+	// Push a signature of the image, and an attestation of the signature.
+	pushArtifact := func(subject digest.Digest) digest.Digest {
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: "application/vnd.example.artifact",
+				Digest:    configDigest,
+				Size:      int64(len(configBlob)),
+			},
+			Subject: &distribution.Descriptor{
+				MediaType: schema1.MediaTypeSignedManifest,
+				Digest:    subject,
+				Size:      1,
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating artifact: %v", err)
+		}
+		ref, _ := reference.WithTag(imageName, "sha256-"+subject.Encoded())
+		manifestURL, err := env.builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error getting manifest url: %v", err)
+		}
+		resp := putManifest(t, "putting artifact", manifestURL, v1.MediaTypeImageManifest, m)
+		defer resp.Body.Close()
+		checkResponse(t, "putting artifact", resp, http.StatusCreated)
+		return digest.Digest(resp.Header.Get("Docker-Content-Digest"))
+	}
+	signature := pushArtifact(image)
+	attestation := pushArtifact(signature)
+
+	ref, _ := reference.WithDigest(imageName, attestation)
+	chainURL, err := env.builder.BuildManifestChainURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest chain url: %v", err)
+	}
+	resp, err := http.Get(chainURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest chain: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting manifest chain", resp, http.StatusOK)
+
+	var chain manifestChainAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chain); err != nil {
+		t.Fatalf("error decoding manifest chain: %v", err)
+	}
+	node := chain.Chain
+	for i, expected := range []digest.Digest{image, signature, attestation} {
+		if node == nil || node.Descriptor.Digest != expected {
+			t.Fatalf("expected manifest %d of the chain tree to be %s, got %+v", i, expected, node)
+		}
+		if len(node.Children) > 1 {
+			t.Fatalf("expected manifest %s to have a single child, got %d", expected, len(node.Children))
+		}
+		next := node
+		node = nil
+		if len(next.Children) == 1 {
+			node = next.Children[0]
+		}
+	}
+	if node != nil {
+		t.Fatalf("unexpected manifest below the attestation: %+v", node)
+	}
+
+	resp, err = http.Get(chainURL + "?depth=0")
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest chain: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting manifest chain with an invalid depth", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "getting manifest chain with an invalid depth", resp, v2.ErrorCodeChainDepthInvalid)
+
+	ref, _ = reference.WithDigest(imageName, digest.FromString("never pushed"))
+	chainURL, err = env.builder.BuildManifestChainURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest chain url: %v", err)
+	}
+	resp, err = http.Get(chainURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest chain: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting the chain of an unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting the chain of an unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+}
+
+func TestBlobUploadProgress(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/progress")
+	uploadURLBase, uploadUUID := startPushLayer(t, env, imageName)
+
+	progressURL, err := env.builder.BuildBlobUploadProgressURL(imageName, uploadUUID)
+	if err != nil {
+		t.Fatalf("unexpected error building upload progress url: %v", err)
+	}
+	resp, err := http.Get(progressURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting upload progress: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting upload progress", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{"Content-Type": []string{"text/event-stream"}})
+
+	type event struct {
+		name     string
+		progress uploadProgressEvent
+	}
+	events := bufio.NewScanner(resp.Body)
+	next := func() event {
+		var e event
+		for events.Scan() {
+			line := events.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.progress); err != nil {
+					t.Fatalf("unexpected error decoding upload progress: %v", err)
+				}
+			case line == "":
+				return e
+			}
+		}
+		t.Fatalf("unexpected end of upload progress: %v", events.Err())
+		return e
+	}
+
+	// The current progress is sent first, once the client follows it.
+	if e := next(); e.name != "progress" || e.progress.Written != 0 {
+		t.Fatalf("unexpected first upload progress event: %+v", e)
+	}
+
+	chunk := bytes.Repeat([]byte("a"), 1024)
+	uploadURLBase, dgst := pushChunk(t, env.builder, imageName, uploadURLBase, bytes.NewReader(chunk), int64(len(chunk)))
+	var e event
+	for e = next(); e.progress.Written < int64(len(chunk)); e = next() {
+		if e.name != "progress" {
+			t.Fatalf("unexpected upload progress event: %+v", e)
+		}
+	}
+	if e.name != "progress" || e.progress.Written != int64(len(chunk)) {
+		t.Fatalf("unexpected upload progress event: %+v", e)
+	}
+
+	finishUpload(t, env.builder, imageName, uploadURLBase, dgst)
+	if e := next(); e.name != "complete" || e.progress.Written != int64(len(chunk)) {
+		t.Fatalf("unexpected upload completion event: %+v", e)
+	}
+
+	// Unknown uploads have no progress.
+	progressURL, err = env.builder.BuildBlobUploadProgressURL(imageName, "unknown")
+	if err != nil {
+		t.Fatalf("unexpected error building upload progress url: %v", err)
+	}
+	resp, err = http.Get(progressURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting upload progress: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting progress of unknown upload", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "getting progress of unknown upload", resp, v2.ErrorCodeBlobUploadUnknown)
+}
+
+// TestBlobUploadInterrupted resumes an upload after the connection of a
+// chunk is dropped, at the offset the registry reports.
+func TestBlobUploadInterrupted(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/interrupted")
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+
+	layer := bytes.Repeat([]byte("0123456789"), 6000)
+	received := 20000
+
+	// Send the start of the chunk, then drop the connection.
+	u, err := url.Parse(uploadURLBase)
+	if err != nil {
+		t.Fatalf("unexpected error parsing upload url: %v", err)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatalf("unexpected error connecting to the registry: %v", err)
+	}
+	fmt.Fprintf(conn, "PATCH %s HTTP/1.1\r\nHost: %s\r\nContent-Type: application/octet-stream\r\nContent-Length: %d\r\n\r\n", u.RequestURI(), u.Host, len(layer))
+	if _, err := conn.Write(layer[:received]); err != nil {
+		t.Fatalf("unexpected error sending the chunk: %v", err)
+	}
+	conn.Close()
+
+	// The registry stores the data received once it finds the connection
+	// dropped.
+	var (
+		location string
+		end      int64
+	)
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		location, end, err = getUploadStatus(uploadURLBase)
+		if err != nil {
+			t.Fatalf("unexpected error getting upload status: %v", err)
+		}
+		if end == int64(received-1) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected upload offset %d, expected %d", end+1, received)
+		}
+	}
+
+	resp, err := doPushChunk(t, location, bytes.NewReader(layer[received:]), chunkOptions{
+		contentRange: fmt.Sprintf("%d-%d", received, len(layer)-1),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error resuming the upload: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "resuming the upload", resp, http.StatusAccepted)
+	checkHeaders(t, resp, http.Header{
+		"Range": []string{fmt.Sprintf("0-%d", len(layer)-1)},
+	})
+
+	finishUpload(t, env.builder, imageName, resp.Header.Get("Location"), digest.FromBytes(layer))
+}
+
+func TestTagConflict(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/tags")
+	createRepository(env, t, imageName.Name(), "latest")
+
+	configBlob := []byte("{}")
+	configDigest := digest.FromBytes(configBlob)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(configBlob))
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(configBlob)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	ref, _ := reference.WithTag(imageName, "Latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest url: %v", err)
+	}
+	resp := putManifest(t, "putting manifest with conflicting tag", manifestURL, v1.MediaTypeImageManifest, m)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest with conflicting tag", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "putting manifest with conflicting tag", resp, v2.ErrorCodeTagConflict)
+}
+
 func testManifestDeleteDisabled(t *testing.T, env *testEnv, imageName reference.Named) {
 	ref, _ := reference.WithDigest(imageName, digestSha256EmptyTar)
 	manifestURL, err := env.builder.BuildManifestURL(ref)
@@ -1848,6 +2471,33 @@ func testManifestAPISchema2(t *testing.T, env *testEnv, imageName reference.Name
 		t.Fatalf("tag not as expected: %q != %q", tagsResponse.Tags[0], tag)
 	}
 
+	// ------------------
+	// Fetch by tag name as a docker daemon older than 19.03, which gets the
+	// linux/amd64 manifest despite accepting manifest lists
+	req, err = http.NewRequest(http.MethodGet, manifestURL, nil)
+	if err != nil {
+		t.Fatalf("Error constructing request: %s", err)
+	}
+	req.Header.Set("Accept", manifestlist.MediaTypeManifestList)
+	req.Header.Add("Accept", schema2.MediaTypeManifest)
+	req.Header.Set("User-Agent", "docker/18.09.7 go/go1.10.8 git-commit/2d0083d kernel/4.19.76 os/linux arch/amd64")
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest list as a legacy daemon")
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching manifest list as a legacy daemon", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{schema2.MediaTypeManifest},
+		"Docker-Content-Digest": []string{args.dgst.String()},
+		"ETag":                  []string{fmt.Sprintf(`"%s"`, args.dgst)},
+	})
+
+	legacyBytes, err := io.ReadAll(resp.Body)
+	checkErr(t, err, "reading manifest fetched as a legacy daemon")
+	if digest.FromBytes(legacyBytes) != args.dgst {
+		t.Fatalf("manifest fetched as a legacy daemon does not match the linux/amd64 manifest")
+	}
+
 	// ------------------
 	// Fetch as a schema1 manifest
 	resp, err = http.Get(manifestURL)
@@ -2896,3 +3546,56 @@ func TestProxyManifestGetByTag(t *testing.T) {
 		"Docker-Content-Digest": []string{newDigest.String()},
 	})
 }
+
+// TestBlobUploadContentRange ensures that chunks which do not start at the
+// end of the upload, such as retried ones, are rejected with the range
+// received so far.
+func TestBlobUploadContentRange(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/range")
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	content := []byte("0123456789")
+
+	resp, err := doPushChunk(t, uploadURLBase, bytes.NewReader(content[:4]), chunkOptions{contentRange: "0-3"})
+	if err != nil {
+		t.Fatalf("unexpected error pushing chunk: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "pushing first chunk", resp, http.StatusAccepted)
+	uploadURLBase = resp.Header.Get("Location")
+
+	for _, tc := range []struct {
+		name         string
+		contentRange string
+		chunk        []byte
+	}{
+		{name: "overlapping", contentRange: "2-5", chunk: content[2:6]},
+		{name: "retried", contentRange: "0-3", chunk: content[:4]},
+		{name: "gapped", contentRange: "6-9", chunk: content[6:]},
+	} {
+		resp, err := doPushChunk(t, uploadURLBase, bytes.NewReader(tc.chunk), chunkOptions{contentRange: tc.contentRange})
+		if err != nil {
+			t.Fatalf("unexpected error pushing %s chunk: %v", tc.name, err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "pushing "+tc.name+" chunk", resp, http.StatusRequestedRangeNotSatisfiable)
+		checkHeaders(t, resp, http.Header{
+			"Range": []string{"0-3"},
+		})
+		checkBodyHasErrorCodes(t, "pushing "+tc.name+" chunk", resp, v2.ErrorCodeRangeInvalid)
+	}
+
+	// The upload resumes after the data received.
+	resp, err = doPushChunk(t, uploadURLBase, bytes.NewReader(content[4:]), chunkOptions{contentRange: "4-9"})
+	if err != nil {
+		t.Fatalf("unexpected error pushing chunk: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "pushing next chunk", resp, http.StatusAccepted)
+	checkHeaders(t, resp, http.Header{
+		"Range": []string{"0-9"},
+	})
+	finishUpload(t, env.builder, imageName, resp.Header.Get("Location"), digest.FromBytes(content))
+}
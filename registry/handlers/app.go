@@ -35,14 +35,18 @@ import (
 	memorycache "github.com/distribution/distribution/v3/registry/storage/cache/memory"
 	rediscache "github.com/distribution/distribution/v3/registry/storage/cache/redis"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	drivercache "github.com/distribution/distribution/v3/registry/storage/driver/cache"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	storagemiddleware "github.com/distribution/distribution/v3/registry/storage/driver/middleware"
+	cdnmiddleware "github.com/distribution/distribution/v3/registry/storage/driver/middleware/cdn"
+	"github.com/distribution/distribution/v3/registry/storage/driver/shard"
 	"github.com/distribution/distribution/v3/version"
 	events "github.com/docker/go-events"
 	"github.com/docker/go-metrics"
 	"github.com/docker/libtrust"
 	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/mux"
+	promclient "github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
@@ -89,17 +93,60 @@ type App struct {
 
 	// readOnly is true if the registry is in a read-only maintenance mode
 	readOnly bool
+
+	// uploadProgress hands the progress of the uploads off to the clients
+	// following them.
+	uploadProgress *uploadProgressBroker
+
+	// transparency records the pushed manifests in a transparency log, if
+	// enabled.
+	transparency *transparencyLog
+
+	// blobContentDisposition and manifestContentDisposition are the
+	// templates of the Content-Disposition header of blob and manifest
+	// responses, if configured.
+	blobContentDisposition     string
+	manifestContentDisposition string
+
+	// validateManifestSchemas rejects the pushed manifests which do not
+	// comply with the constraints of their schema.
+	validateManifestSchemas bool
+
+	// caseInsensitiveTags stores tags, and their locks, in lowercase.
+	caseInsensitiveTags bool
+
+	// attestationBundles caches the attestation bundles of manifests.
+	attestationBundles *attestationBundleCache
+
+	// rateLimiter limits the rate of the requests, if configured.
+	rateLimiter *rateLimiter
+
+	// namingPattern is the pattern the names of the repositories pushed to
+	// must match, if configured.
+	namingPattern *regexp.Regexp
+
+	// archiveDriver is the cold storage the repositories are archived to,
+	// if configured.
+	archiveDriver storagedriver.StorageDriver
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
 // requests. The app only implements ServeHTTP and can be wrapped in other
 // handlers accordingly.
 func NewApp(ctx context.Context, config *configuration.Configuration) *App {
+	if err := checkResponseHeaders(config.HTTP.Headers); err != nil {
+		panic(fmt.Sprintf("invalid http headers: %v", err))
+	}
+
 	app := &App{
 		Config:  config,
 		Context: ctx,
 		router:  v2.RouterWithPrefix(config.HTTP.Prefix),
 		isCache: config.Proxy.RemoteURL != "",
+
+		uploadProgress:     newUploadProgressBroker(),
+		attestationBundles: newAttestationBundleCache(config.Attestations.BundleCacheTTL),
+		rateLimiter:        newRateLimiter(config.HTTP.RateLimit),
 	}
 
 	// Register the handler dispatchers.
@@ -107,11 +154,24 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		return http.HandlerFunc(apiBase)
 	})
 	app.register(v2.RouteNameManifest, manifestDispatcher)
+	app.register(v2.RouteNameManifestChain, manifestChainDispatcher)
+	app.register(v2.RouteNameAttestations, attestationsDispatcher)
+	app.register(v2.RouteNameReferrers, referrersDispatcher)
+	app.register(v2.RouteNameManifestUpload, manifestUploadDispatcher)
+	app.register(v2.RouteNameManifestUploadChunk, manifestUploadDispatcher)
+	app.register(v2.RouteNameManifestValidate, manifestValidateDispatcher)
 	app.register(v2.RouteNameCatalog, catalogDispatcher)
 	app.register(v2.RouteNameTags, tagsDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
+	app.register(v2.RouteNameBlobBatch, blobBatchDispatcher)
+	app.register(v2.RouteNameBlobImport, blobImportDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
+	app.register(v2.RouteNameBlobUploadProgress, blobUploadProgressDispatcher)
+	app.register(v2.RouteNameHPAMetrics, hpaMetricsDispatcher)
+	app.register(v2.RouteNameTagLock, tagLockDispatcher)
+	app.register(v2.RouteNameRepositoryArchive, repositoryArchiveDispatcher)
+	app.register(v2.RouteNameRepositoryUnarchive, repositoryArchiveDispatcher)
 
 	// override the storage driver's UA string for registry outbound HTTP requests
 	storageParams := config.Storage.Parameters()
@@ -120,6 +180,22 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 	storageParams["useragent"] = fmt.Sprintf("docker-distribution/%s %s", version.Version, runtime.Version())
 
+	// trace the calls to the storage drivers, including the ones of the
+	// shards and of the archive.
+	var tracingEnabled bool
+	if tracingConfig, ok := config.Storage["tracing"]; ok {
+		switch v := tracingConfig["enabled"].(type) {
+		case nil:
+		case bool:
+			tracingEnabled = v
+		default:
+			panic(fmt.Sprintf("invalid type for tracing enabled: %#v", v))
+		}
+	}
+	if tracingEnabled {
+		storageParams[factory.TracingParameter] = true
+	}
+
 	var err error
 	app.driver, err = factory.Create(config.Storage.Type(), storageParams)
 	if err != nil {
@@ -129,6 +205,66 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		panic(err)
 	}
 
+	// distribute the repositories and blobs across the storage drivers of
+	// the shards, the storage driver above holding the content to migrate.
+	if shardConfig, ok := config.Storage["shard"]; ok {
+		switch enabled := shardConfig["enabled"].(type) {
+		case nil:
+		case bool:
+			if enabled {
+				app.driver, err = shard.FromParameters(shardConfig, map[string]interface{}{
+					"useragent":              storageParams["useragent"],
+					factory.TracingParameter: tracingEnabled,
+				})
+				if err != nil {
+					panic(fmt.Sprintf("invalid shard config: %v", err))
+				}
+			}
+		default:
+			panic(fmt.Sprintf("invalid type for shard enabled: %#v", enabled))
+		}
+	}
+
+	// cache the listings, file infos and small files of the storage driver.
+	if cc, ok := config.Storage["cache"]; ok {
+		switch v := cc["driver"]; v {
+		case nil, "":
+		case "layered":
+			var options drivercache.Options
+			if size, ok := cc["driversize"]; ok {
+				// Since Parameters is not strongly typed, render to a string and convert back
+				options.Size, err = strconv.Atoi(fmt.Sprint(size))
+				if err != nil {
+					panic(fmt.Sprintf("invalid driversize value %s: %s", size, err))
+				}
+			}
+			switch ttl := cc["driverttl"].(type) {
+			case nil:
+			case string:
+				options.TTL, err = time.ParseDuration(ttl)
+				if err != nil {
+					panic(fmt.Sprintf("invalid driverttl: %v", err))
+				}
+			default:
+				panic(fmt.Sprintf("invalid type for driverttl: %#v", ttl))
+			}
+			switch pattern := cc["driverpattern"].(type) {
+			case nil:
+			case string:
+				options.Pattern, err = regexp.Compile(pattern)
+				if err != nil {
+					panic(fmt.Sprintf("invalid driverpattern: %v", err))
+				}
+			default:
+				panic(fmt.Sprintf("invalid type for driverpattern: %#v", pattern))
+			}
+			app.driver = drivercache.New(app.driver, options)
+			dcontext.GetLogger(app).Infof("using layered storage driver cache")
+		default:
+			panic(fmt.Sprintf("unknown storage driver cache type %q", v))
+		}
+	}
+
 	purgeConfig := uploadPurgeDefaultConfig()
 	if mc, ok := config.Storage["maintenance"]; ok {
 		if v, ok := mc["uploadpurging"]; ok {
@@ -158,10 +294,39 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		panic(err)
 	}
 
+	if config.CDN.Enabled {
+		app.driver, err = cdnmiddleware.NewCDNRedirector(cdnmiddleware.CDNConfig{
+			Provider:   config.CDN.Provider,
+			BaseURL:    config.CDN.BaseURL,
+			SigningKey: config.CDN.SigningKey,
+			KeyPairID:  config.CDN.KeyPairID,
+			Duration:   config.CDN.Duration,
+		}, app.driver)
+		if err != nil {
+			panic(fmt.Sprintf("unable to configure cdn: %v", err))
+		}
+		dcontext.GetLogger(app).Infof("redirecting blob downloads to %s cdn at %s", config.CDN.Provider, config.CDN.BaseURL)
+	}
+
+	if archiveType := config.Archive.Storage.Type(); archiveType != "" {
+		archiveParams := config.Archive.Storage.Parameters()
+		if archiveParams == nil {
+			archiveParams = make(configuration.Parameters)
+		}
+		if tracingEnabled {
+			archiveParams[factory.TracingParameter] = true
+		}
+		app.archiveDriver, err = factory.Create(archiveType, archiveParams)
+		if err != nil {
+			panic(fmt.Sprintf("unable to configure archive storage: %v", err))
+		}
+	}
+
 	app.configureSecret(config)
 	app.configureEvents(config)
 	app.configureRedis(config)
 	app.configureLogHook(config)
+	app.configureTransparency(config)
 
 	options := registrymiddleware.GetRegistryOptions()
 	if config.Compatibility.Schema1.TrustKey != "" {
@@ -184,6 +349,10 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		options = append(options, storage.EnableSchema1)
 	}
 
+	if app.readOnly {
+		options = append(options, storage.ReadOnlyTags)
+	}
+
 	if config.HTTP.Host != "" {
 		u, err := url.Parse(config.HTTP.Host)
 		if err != nil {
@@ -204,23 +373,227 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				options = append(options, storage.EnableDelete)
 			}
 		}
+		switch v := d["tombstones"].(type) {
+		case nil:
+		case bool:
+			if v {
+				options = append(options, storage.EnableTombstones)
+			}
+		default:
+			panic(fmt.Sprintf("invalid type for delete tombstones: %#v", v))
+		}
+	}
+
+	if tagsConfig, ok := config.Storage["tags"]; ok {
+		switch v := tagsConfig["caseinsensitive"].(type) {
+		case nil:
+		case bool:
+			if v {
+				options = append(options, storage.CaseInsensitiveTags)
+				app.caseInsensitiveTags = true
+			}
+		default:
+			panic(fmt.Sprintf("invalid type for tags caseinsensitive: %#v", v))
+		}
+		switch v := tagsConfig["collisioncheck"].(type) {
+		case nil:
+		case string:
+			options = append(options, storage.TagCollisionChecking(storage.TagCollisionCheck(v)))
+		default:
+			panic(fmt.Sprintf("invalid type for tags collisioncheck: %#v", v))
+		}
+
+		var retries int
+		switch v := tagsConfig["retries"].(type) {
+		case nil:
+		case int:
+			retries = v
+		default:
+			panic(fmt.Sprintf("invalid type for tags retries: %#v", v))
+		}
+		var retryDelay time.Duration
+		switch v := tagsConfig["retrydelay"].(type) {
+		case nil:
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				panic(fmt.Sprintf("invalid tags retrydelay: %v", err))
+			}
+			retryDelay = d
+		default:
+			panic(fmt.Sprintf("invalid type for tags retrydelay: %#v", v))
+		}
+		if retries != 0 || retryDelay != 0 {
+			options = append(options, storage.TagLinkRetries(retries, retryDelay))
+		}
+	}
+
+	if config.HTTP.Debug.Prometheus.Enabled {
+		options = append(options, storage.TagStoreMetrics(promclient.DefaultRegisterer))
+	}
+
+	if verifyConfig, ok := config.Storage["verifyonread"]; ok {
+		switch v := verifyConfig["enabled"].(type) {
+		case nil:
+		case bool:
+			if v {
+				options = append(options, storage.VerifyBlobsOnRead)
+			}
+		default:
+			panic(fmt.Sprintf("invalid type for verifyonread enabled: %#v", v))
+		}
 	}
 
 	// configure redirects
 	var redirectDisabled bool
+	var redirectBandwidth int64
+	var redirectMaxExpiry time.Duration
 	if redirectConfig, ok := config.Storage["redirect"]; ok {
 		v := redirectConfig["disable"]
 		switch v := v.(type) {
+		case nil:
 		case bool:
 			redirectDisabled = v
 		default:
 			panic(fmt.Sprintf("invalid type for redirect config: %#v", redirectConfig))
 		}
+
+		switch v := redirectConfig["bandwidth"].(type) {
+		case nil:
+		case int:
+			redirectBandwidth = int64(v)
+		default:
+			panic(fmt.Sprintf("invalid type for redirect bandwidth: %#v", v))
+		}
+
+		switch v := redirectConfig["maxexpiry"].(type) {
+		case nil:
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				panic(fmt.Sprintf("invalid redirect maxexpiry: %v", err))
+			}
+			redirectMaxExpiry = d
+		default:
+			panic(fmt.Sprintf("invalid type for redirect maxexpiry: %#v", v))
+		}
 	}
 	if redirectDisabled {
 		dcontext.GetLogger(app).Infof("backend redirection disabled")
 	} else {
 		options = append(options, storage.EnableRedirect)
+		if redirectBandwidth > 0 {
+			options = append(options, storage.RedirectExpiry(redirectBandwidth, redirectMaxExpiry))
+		}
+	}
+
+	if blobsConfig, ok := config.Storage["blobs"]; ok {
+		switch v := blobsConfig["contentdisposition"].(type) {
+		case nil:
+		case string:
+			app.blobContentDisposition = v
+		default:
+			panic(fmt.Sprintf("invalid type for blobs contentdisposition: %#v", v))
+		}
+
+		if v, ok := blobsConfig["existencecache"]; ok {
+			existenceConfig, ok := v.(map[interface{}]interface{})
+			if !ok {
+				panic("existencecache config key must contain additional keys")
+			}
+			if enabled, _ := existenceConfig["enabled"].(bool); enabled {
+				ttl := storage.DefaultBlobExistenceCacheTTL
+				switch v := existenceConfig["ttl"].(type) {
+				case nil:
+				case string:
+					d, err := time.ParseDuration(v)
+					if err != nil {
+						panic(fmt.Sprintf("invalid existencecache ttl: %v", err))
+					}
+					ttl = d
+				default:
+					panic(fmt.Sprintf("invalid type for existencecache ttl: %#v", v))
+				}
+				dcontext.GetLogger(app).Infof("blob existence cache enabled")
+				options = append(options, storage.BlobExistenceCache(ttl))
+			}
+		}
+	}
+
+	// configure manifest storage
+	if manifestsConfig, ok := config.Storage["manifests"]; ok {
+		switch v := manifestsConfig["contentdisposition"].(type) {
+		case nil:
+		case string:
+			app.manifestContentDisposition = v
+		default:
+			panic(fmt.Sprintf("invalid type for manifests contentdisposition: %#v", v))
+		}
+
+		switch v := manifestsConfig["compress"].(type) {
+		case nil:
+		case bool:
+			if v {
+				dcontext.GetLogger(app).Infof("manifest compression enabled")
+				options = append(options, storage.CompressManifests)
+			}
+		default:
+			panic(fmt.Sprintf("invalid type for manifests config: %#v", manifestsConfig))
+		}
+
+		if v, ok := manifestsConfig["bloomfilter"]; ok {
+			bloomConfig, ok := v.(map[interface{}]interface{})
+			if !ok {
+				panic("bloomfilter config key must contain additional keys")
+			}
+			if enabled, _ := bloomConfig["enabled"].(bool); enabled {
+				falsePositiveRate := 0.001
+				switch v := bloomConfig["falsepositiverate"].(type) {
+				case nil:
+				case float64:
+					falsePositiveRate = v
+				default:
+					panic(fmt.Sprintf("invalid type for bloomfilter falsepositiverate: %#v", v))
+				}
+				refresh := time.Minute
+				switch v := bloomConfig["refresh"].(type) {
+				case nil:
+				case string:
+					d, err := time.ParseDuration(v)
+					if err != nil {
+						panic(fmt.Sprintf("invalid bloomfilter refresh: %v", err))
+					}
+					refresh = d
+				default:
+					panic(fmt.Sprintf("invalid type for bloomfilter refresh: %#v", v))
+				}
+				dcontext.GetLogger(app).Infof("manifest bloom filter enabled")
+				options = append(options, storage.ManifestBloomFilter(falsePositiveRate, refresh))
+			}
+		}
+	}
+
+	// configure deduplication of concurrent blob requests
+	if singleFlightConfig, ok := config.Storage["singleflight"]; ok {
+		var maxSize int64
+		switch v := singleFlightConfig["maxsize"].(type) {
+		case nil:
+		case int:
+			maxSize = int64(v)
+		default:
+			panic(fmt.Sprintf("invalid type for singleflight maxsize: %#v", v))
+		}
+
+		switch v := singleFlightConfig["enabled"].(type) {
+		case nil:
+		case bool:
+			if v {
+				dcontext.GetLogger(app).Infof("blob request deduplication enabled")
+				options = append(options, storage.SingleFlightBlobs(maxSize))
+			}
+		default:
+			panic(fmt.Sprintf("invalid type for singleflight config: %#v", singleFlightConfig))
+		}
 	}
 
 	if !config.Validation.Enabled {
@@ -229,6 +602,8 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 
 	// configure validation
 	if config.Validation.Enabled {
+		app.validateManifestSchemas = config.Validation.Manifests.Enabled
+
 		if len(config.Validation.Manifests.URLs.Allow) == 0 && len(config.Validation.Manifests.URLs.Deny) == 0 {
 			// If Allow and Deny are empty, allow nothing.
 			options = append(options, storage.ManifestURLsAllowRegexp(regexp.MustCompile("^$")))
@@ -260,6 +635,14 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
+	if pattern := config.Policy.Repository.NamingPolicy.Pattern; pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			panic(fmt.Sprintf("policy.repository.namingpolicy.pattern: %s", err))
+		}
+		app.namingPattern = re
+	}
+
 	// configure storage caches
 	if cc, ok := config.Storage["cache"]; ok {
 		v, ok := cc["blobdescriptor"]
@@ -302,7 +685,8 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 			}
 			dcontext.GetLogger(app).Infof("using inmemory blob descriptor cache")
 		default:
-			if v != "" {
+			// the cache section may only configure the storage driver cache.
+			if v != nil && v != "" {
 				dcontext.GetLogger(app).Warnf("unknown cache type %q, caching disabled", config.Storage["cache"])
 			}
 		}
@@ -330,6 +714,10 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 		app.accessController = accessController
 		dcontext.GetLogger(app).Debugf("configured %q access controller", authType)
+
+		if anonymousConfig, ok := config.Auth["anonymous"]; ok {
+			app.accessController = withAnonymousPull(app.accessController, anonymousConfig)
+		}
 	}
 
 	// configure as a pull through cache
@@ -380,6 +768,22 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 			return err
 		}
 
+		if probePath := app.Config.Health.StorageDriver.Path; probePath != "" || app.Config.Health.StorageDriver.ProbeWrite {
+			var prober *storage.StorageHealthProber
+			var err error
+			if probePath != "" {
+				prober, err = storage.NewStorageHealthProberAt(app.driver, probePath)
+			} else {
+				prober, err = storage.NewStorageHealthProber(app.driver)
+			}
+			if err != nil {
+				panic(fmt.Sprintf("unable to configure storage health probe: %v", err))
+			}
+			storageDriverCheck = func() error {
+				return prober.Probe(app)
+			}
+		}
+
 		if app.Config.Health.StorageDriver.Threshold != 0 {
 			healthRegistry.RegisterPeriodicThresholdFunc("storagedriver_"+app.Config.Storage.Type(), interval, app.Config.Health.StorageDriver.Threshold, storageDriverCheck)
 		} else {
@@ -440,7 +844,7 @@ func (app *App) RegisterHealthChecks(healthRegistries ...*health.Registry) {
 // passed through the application filters and context will be constructed at
 // request time.
 func (app *App) register(routeName string, dispatch dispatchFunc) {
-	handler := app.dispatcher(dispatch)
+	handler := app.rateLimiter.limit(routeName, trackHPAMetrics(routeName, app.dispatcher(dispatch)))
 
 	// Chain the handler with prometheus instrumented handler
 	if app.Config.HTTP.Debug.Prometheus.Enabled {
@@ -459,6 +863,19 @@ func (app *App) register(routeName string, dispatch dispatchFunc) {
 	app.router.GetRoute(routeName).Handler(handler)
 }
 
+// filteredSink returns sink, filtered according to the filter of its
+// endpoint configuration, if any.
+func filteredSink(sink events.Sink, filter configuration.Filter) events.Sink {
+	if len(filter.Repositories) == 0 && len(filter.Events) == 0 {
+		return sink
+	}
+	repoFilter, err := notifications.NewRepoFilter(filter.Repositories)
+	if err != nil {
+		panic(fmt.Sprintf("invalid notifications filter: %v", err))
+	}
+	return notifications.NewFilteredSink(sink, repoFilter, filter.Events)
+}
+
 // configureEvents prepares the event sink for action.
 func (app *App) configureEvents(configuration *configuration.Configuration) {
 	// Configure all of the endpoint sinks.
@@ -470,6 +887,7 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 		}
 
 		dcontext.GetLogger(app).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, endpoint.URL, endpoint.Timeout, endpoint.Headers)
+		filter := endpoint.Filter
 		endpoint := notifications.NewEndpoint(endpoint.Name, endpoint.URL, notifications.EndpointConfig{
 			Timeout:           endpoint.Timeout,
 			Threshold:         endpoint.Threshold,
@@ -479,7 +897,7 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 			Ignore:            endpoint.Ignore,
 		})
 
-		sinks = append(sinks, endpoint)
+		sinks = append(sinks, filteredSink(endpoint, filter))
 	}
 
 	// NOTE(stevvooe): Moving to a new queuing implementation is as easy as
@@ -635,6 +1053,23 @@ func (app *App) configureSecret(configuration *configuration.Configuration) {
 	}
 }
 
+// Shutdown flushes the notifications pending delivery to the configured
+// endpoints. It returns the error of ctx if it is done before all of them
+// were delivered. No event may be emitted after Shutdown is called.
+func (app *App) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- app.events.sink.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close() // ensure that request body is always closed.
 
@@ -654,6 +1089,7 @@ func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Set a header with the Docker Distribution API Version for all responses.
 	w.Header().Add("Docker-Distribution-API-Version", "registry/2.0")
+	addResponseHeaders(w, app.Config.HTTP.Headers)
 	app.router.ServeHTTP(w, r)
 }
 
@@ -670,12 +1106,6 @@ type dispatchFunc func(ctx *Context, r *http.Request) http.Handler
 // handler, using the dispatch factory function.
 func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		for headerName, headerValues := range app.Config.HTTP.Headers {
-			for _, value := range headerValues {
-				w.Header().Add(headerName, value)
-			}
-		}
-
 		context := app.context(w, r)
 
 		if err := app.authorized(w, r, context); err != nil {
@@ -737,6 +1167,15 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 				}
 				return
 			}
+
+			if err := app.checkArchived(context, r); err != nil {
+				context.Errors = append(context.Errors, err)
+
+				if err := errcode.ServeJSON(w, context.Errors); err != nil {
+					dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+				}
+				return
+			}
 		}
 
 		dispatch(context, r).ServeHTTP(w, r)
@@ -826,14 +1265,34 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	dcontext.GetLogger(context).Debug("authorizing request")
 	repo := getName(context)
 
+	route := mux.CurrentRoute(r)
+	if route != nil && isAdminRoute(route.GetName()) && !app.adminEnabled() {
+		// tag locks and archives are managed by the administrators, whom
+		// only an access controller granting scopes tells apart.
+		if err := errcode.ServeJSON(w, errcode.ErrorCodeUnsupported.WithDetail("administration requires an access controller granting scopes, such as token")); err != nil {
+			dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
+		}
+		return fmt.Errorf("forbidden: administration is not enabled")
+	}
+
 	if app.accessController == nil {
 		return nil // access controller is not enabled.
 	}
 
 	var accessRecords []auth.Access
 
-	if repo != "" {
-		accessRecords = appendAccessRecords(accessRecords, r.Method, repo)
+	if route != nil && isAdminRoute(route.GetName()) {
+		// tag locks and archives are managed by the administrators,
+		// whatever their access to the repository.
+		accessRecords = append(accessRecords, adminAccess)
+	} else if repo != "" {
+		method := r.Method
+		if route != nil && route.GetName() == v2.RouteNameBlobBatch {
+			// checking the existence of blobs only requires pull access,
+			// although the request is a POST.
+			method = http.MethodGet
+		}
+		accessRecords = appendAccessRecords(accessRecords, method, repo)
 		if fromRepo := r.FormValue("from"); fromRepo != "" {
 			// mounting a blob from one repository to another requires pull (GET)
 			// access to the source repository.
@@ -854,6 +1313,7 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			return fmt.Errorf("forbidden: no repository name")
 		}
 		accessRecords = appendCatalogAccessRecord(accessRecords, r)
+		accessRecords = appendHPAMetricsAccessRecord(accessRecords, r)
 	}
 
 	ctx, err := app.accessController.Authorized(context.Context, accessRecords...)
@@ -886,6 +1346,43 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	return nil
 }
 
+// withAnonymousPull wraps ac to authorize the requests without credentials
+// pulling from the public repositories of the auth.anonymous configuration,
+// when enabled.
+func withAnonymousPull(ac auth.AccessController, anonymousConfig configuration.Parameters) auth.AccessController {
+	switch v := anonymousConfig["enabled"].(type) {
+	case nil:
+		return ac
+	case bool:
+		if !v {
+			return ac
+		}
+	default:
+		panic(fmt.Sprintf("invalid type for auth anonymous enabled: %#v", v))
+	}
+
+	var repositories []string
+	switch v := anonymousConfig["repositories"].(type) {
+	case nil:
+	case []interface{}:
+		for _, repository := range v {
+			pattern, ok := repository.(string)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for auth anonymous repository: %#v", repository))
+			}
+			repositories = append(repositories, pattern)
+		}
+	default:
+		panic(fmt.Sprintf("invalid type for auth anonymous repositories: %#v", v))
+	}
+
+	ac, err := auth.WithAnonymousPull(ac, repositories)
+	if err != nil {
+		panic(fmt.Sprintf("unable to configure anonymous pulls: %v", err))
+	}
+	return ac
+}
+
 // eventBridge returns a bridge for the current request, configured with the
 // correct actor and source.
 func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listener {
@@ -904,7 +1401,7 @@ func (app *App) nameRequired(r *http.Request) bool {
 		return true
 	}
 	routeName := route.GetName()
-	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog
+	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog && routeName != v2.RouteNameHPAMetrics
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -972,6 +1469,26 @@ func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []a
 	return accessRecords
 }
 
+// Add the access record for the autoscaling metrics if it's our current route
+func appendHPAMetricsAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
+	route := mux.CurrentRoute(r)
+	routeName := route.GetName()
+
+	if routeName == v2.RouteNameHPAMetrics {
+		resource := auth.Resource{
+			Type: "registry",
+			Name: "metrics",
+		}
+
+		accessRecords = append(accessRecords,
+			auth.Access{
+				Resource: resource,
+				Action:   "*",
+			})
+	}
+	return accessRecords
+}
+
 // applyRegistryMiddleware wraps a registry instance with the configured middlewares
 func applyRegistryMiddleware(ctx context.Context, registry distribution.Namespace, middlewares []configuration.Middleware) (distribution.Namespace, error) {
 	for _, mw := range middlewares {
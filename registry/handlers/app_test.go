@@ -10,6 +10,7 @@ import (
 
 	"github.com/distribution/distribution/v3/configuration"
 	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/auth"
@@ -17,6 +18,7 @@ import (
 	"github.com/distribution/distribution/v3/registry/storage"
 	memorycache "github.com/distribution/distribution/v3/registry/storage/cache/memory"
 	"github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/opencontainers/go-digest"
 )
 
 // TestAppDispatcher builds an application with a test dispatcher and ensures
@@ -30,16 +32,18 @@ func TestAppDispatcher(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error creating registry: %v", err)
 	}
+	// Use a private router, since the routes are modified below and
+	// v2.Router is shared with the other tests.
+	router := v2.RouterWithPrefix("")
 	app := &App{
 		Config:   &configuration.Configuration{},
 		Context:  ctx,
-		router:   v2.Router(),
+		router:   router,
 		driver:   driver,
 		registry: registry,
 	}
 	server := httptest.NewServer(app)
 	defer server.Close()
-	router := v2.Router()
 
 	serverURL, err := url.Parse(server.URL)
 	if err != nil {
@@ -210,6 +214,96 @@ func TestNewApp(t *testing.T) {
 	}
 }
 
+// TestAnonymousPull checks the requests without credentials are only
+// authorized to pull from the public repositories.
+func TestAnonymousPull(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": nil,
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Auth: configuration.Auth{
+			"silly": {
+				"realm":   "realm-test",
+				"service": "service-test",
+			},
+			"anonymous": {
+				"enabled":      true,
+				"repositories": []interface{}{"public/*"},
+			},
+		},
+	}
+	app := NewApp(context.Background(), &config)
+	server := httptest.NewServer(app)
+	defer server.Close()
+	builder, err := v2.NewURLBuilderFromString(server.URL, false)
+	if err != nil {
+		t.Fatalf("error creating urlbuilder: %v", err)
+	}
+
+	for _, tc := range []struct {
+		repository string
+		method     string
+		status     int
+	}{
+		// Unknown manifests and blobs are reported once authorized.
+		{"public/app", http.MethodGet, http.StatusNotFound},
+		{"public/app", http.MethodHead, http.StatusNotFound},
+		{"private/app", http.MethodGet, http.StatusUnauthorized},
+		{"public/team/app", http.MethodGet, http.StatusUnauthorized},
+		{"public/app", http.MethodDelete, http.StatusUnauthorized},
+	} {
+		name, _ := reference.WithName(tc.repository)
+		ref, _ := reference.WithTag(name, "latest")
+		manifestURL, err := builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobRef, _ := reference.WithDigest(name, digest.FromString("blob"))
+		blobURL, err := builder.BuildBlobURL(blobRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, u := range []string{manifestURL, blobURL} {
+			req, err := http.NewRequest(tc.method, u, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error during %s %s: %v", tc.method, u, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("unexpected status of %s %s: %d != %d", tc.method, u, resp.StatusCode, tc.status)
+			}
+		}
+	}
+
+	// Requests with credentials are authorized by the access controller.
+	name, _ := reference.WithName("public/app")
+	tagsURL, err := builder.BuildTagsURL(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, tagsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error during GET %s: %v", tagsURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected status of GET %s with credentials: %d", tagsURL, resp.StatusCode)
+	}
+}
+
 // Test the access record accumulator
 func TestAppendAccessRecords(t *testing.T) {
 	repo := "testRepo"
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+)
+
+// repositoryArchiveDispatcher constructs and returns the repository archive
+// handler for the given request context.
+func repositoryArchiveDispatcher(ctx *Context, r *http.Request) http.Handler {
+	rah := &repositoryArchiveHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == v2.RouteNameRepositoryUnarchive {
+			mhandler[http.MethodPost] = http.HandlerFunc(rah.UnarchiveRepository)
+		} else {
+			mhandler[http.MethodPost] = http.HandlerFunc(rah.ArchiveRepository)
+		}
+	}
+
+	return mhandler
+}
+
+// repositoryArchiveHandler archives and unarchives repositories.
+type repositoryArchiveHandler struct {
+	*Context
+}
+
+// ArchiveRepository copies the repository to the cold storage, and makes it
+// read-only.
+func (rah *repositoryArchiveHandler) ArchiveRepository(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rah).Debug("ArchiveRepository")
+
+	if rah.App.archiveDriver == nil {
+		rah.Errors = append(rah.Errors, errcode.ErrorCodeUnsupported.WithDetail("archive storage is not configured"))
+		return
+	}
+
+	name := rah.Repository.Named().Name()
+	record, err := storage.ArchiveRepository(rah, rah.App.driver, rah.App.archiveDriver, name, r.FormValue("remove") == "true")
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			rah.Errors = append(rah.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		} else if err == storage.ErrRepositoryArchived {
+			rah.Errors = append(rah.Errors, v2.ErrorCodeRepositoryArchived)
+		} else {
+			rah.Errors = append(rah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	p, err := json.Marshal(record)
+	if err != nil {
+		rah.Errors = append(rah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(p)
+}
+
+// UnarchiveRepository restores the repository from the cold storage, and
+// makes it writable again.
+func (rah *repositoryArchiveHandler) UnarchiveRepository(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rah).Debug("UnarchiveRepository")
+
+	if rah.App.archiveDriver == nil {
+		rah.Errors = append(rah.Errors, errcode.ErrorCodeUnsupported.WithDetail("archive storage is not configured"))
+		return
+	}
+
+	if err := storage.UnarchiveRepository(rah, rah.App.driver, rah.App.archiveDriver, rah.Repository.Named().Name()); err != nil {
+		if err == storage.ErrRepositoryNotArchived {
+			rah.Errors = append(rah.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		} else {
+			rah.Errors = append(rah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// isAdminRoute reports whether the route of name is managed by the
+// administrators of the registry.
+func isAdminRoute(name string) bool {
+	switch name {
+	case v2.RouteNameTagLock, v2.RouteNameRepositoryArchive, v2.RouteNameRepositoryUnarchive:
+		return true
+	}
+	return false
+}
+
+// checkArchived returns ErrorCodeRepositoryArchived if the request modifies
+// the repository of ctx while it is archived. Archiving is checked only when
+// the archive storage is configured.
+func (app *App) checkArchived(ctx *Context, r *http.Request) error {
+	if app.archiveDriver == nil {
+		return nil
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		switch route.GetName() {
+		case v2.RouteNameRepositoryArchive, v2.RouteNameRepositoryUnarchive, v2.RouteNameBlobBatch:
+			return nil
+		}
+	}
+
+	archived, err := storage.RepositoryArchived(ctx, app.driver, ctx.Repository.Named().Name())
+	if err != nil {
+		return errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+	if archived {
+		return v2.ErrorCodeRepositoryArchived
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestRepositoryArchive(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Archive.Storage = configuration.Storage{"inmemory": configuration.Parameters{}}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+	env.app.accessController = adminAccessController{}
+
+	name, _ := reference.WithName("archived/repo")
+	resp := putNamingPolicyManifest(t, env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest", resp, http.StatusCreated)
+
+	archiveURL, err := env.builder.BuildRepositoryArchiveURL(name, url.Values{"remove": []string{"true"}})
+	checkErr(t, err, "building archive url")
+	resp = doAdminRequest(t, http.MethodPost, archiveURL, true, "", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "archiving repository", resp, http.StatusCreated)
+	var record storage.ArchiveRecord
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		t.Fatalf("error decoding archive record: %v", err)
+	}
+	if record.ArchivedAt.IsZero() || !record.Removed {
+		t.Fatalf("unexpected archive record: %+v", record)
+	}
+
+	resp = doAdminRequest(t, http.MethodPost, archiveURL, true, "", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "archiving repository again", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "archiving repository again", resp, v2.ErrorCodeRepositoryArchived)
+
+	uploadURL, err := env.builder.BuildBlobUploadURL(name)
+	checkErr(t, err, "building upload url")
+	resp, err = http.Post(uploadURL, "", nil)
+	checkErr(t, err, "starting upload to an archived repository")
+	defer resp.Body.Close()
+	checkResponse(t, "starting upload to an archived repository", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "starting upload to an archived repository", resp, v2.ErrorCodeRepositoryArchived)
+
+	unarchiveURL, err := env.builder.BuildRepositoryUnarchiveURL(name)
+	checkErr(t, err, "building unarchive url")
+	resp = doAdminRequest(t, http.MethodPost, unarchiveURL, true, "", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "unarchiving repository", resp, http.StatusAccepted)
+
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp = getManifestAccepting(t, manifestURL, v1.MediaTypeImageManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching restored manifest", resp, http.StatusOK)
+
+	resp = putNamingPolicyManifest(t, env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest to an unarchived repository", resp, http.StatusCreated)
+
+	resp = doAdminRequest(t, http.MethodPost, unarchiveURL, true, "", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "unarchiving repository again", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "unarchiving repository again", resp, v2.ErrorCodeNameUnknown)
+}
+
+func TestRepositoryArchiveNotConfigured(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+	env.app.accessController = adminAccessController{}
+
+	name, _ := reference.WithName("archived/repo")
+	archiveURL, err := env.builder.BuildRepositoryArchiveURL(name)
+	checkErr(t, err, "building archive url")
+	resp := doAdminRequest(t, http.MethodPost, archiveURL, true, "", nil)
+	defer resp.Body.Close()
+	checkResponse(t, "archiving repository", resp, http.StatusMethodNotAllowed)
+}
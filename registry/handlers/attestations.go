@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/attestation/bundle"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// defaultAttestationBundleCacheTTL is how long attestation bundles are
+	// cached when attestations.bundlecachettl is not configured.
+	defaultAttestationBundleCacheTTL = time.Minute
+
+	// maxAttestationBundleCacheEntries bounds the number of attestation
+	// bundles cached.
+	maxAttestationBundleCacheEntries = 1024
+)
+
+// attestationBundleCache caches the attestation bundles of manifests for a
+// fixed time.
+type attestationBundleCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]attestationBundleCacheEntry
+}
+
+type attestationBundleCacheEntry struct {
+	bundle  *bundle.AttestationBundle
+	expires time.Time
+}
+
+// newAttestationBundleCache returns a cache of attestation bundles expiring
+// after ttl, which defaults to defaultAttestationBundleCacheTTL when zero.
+// The cache is disabled when ttl is negative.
+func newAttestationBundleCache(ttl time.Duration) *attestationBundleCache {
+	if ttl == 0 {
+		ttl = defaultAttestationBundleCacheTTL
+	}
+	return &attestationBundleCache{
+		ttl:     ttl,
+		entries: make(map[string]attestationBundleCacheEntry),
+	}
+}
+
+// get returns the cached bundle of the manifest dgst of the repository name,
+// or nil.
+func (c *attestationBundleCache) get(name string, dgst digest.Digest) *bundle.AttestationBundle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := name + "@" + dgst.String()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.bundle
+}
+
+// add caches the bundle of the manifest dgst of the repository name. Expired
+// bundles are evicted when the cache is full, and the bundle is not cached
+// if it remains full.
+func (c *attestationBundleCache) add(name string, dgst digest.Digest, b *bundle.AttestationBundle) {
+	if c.ttl < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxAttestationBundleCacheEntries {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxAttestationBundleCacheEntries {
+			return
+		}
+	}
+	c.entries[name+"@"+dgst.String()] = attestationBundleCacheEntry{
+		bundle:  b,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// attestationsDispatcher constructs the handler returning the attestation
+// bundle of a manifest.
+func attestationsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	attestationsHandler := &attestationsHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(attestationsHandler.GetAttestations),
+	}
+}
+
+// attestationsHandler handles requests for the attestations of a manifest.
+type attestationsHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// GetAttestations returns the bundle of the attestations attached to the
+// manifest.
+func (ah *attestationsHandler) GetAttestations(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	name := ah.Repository.Named().Name()
+	b := ah.App.attestationBundles.get(name, ah.Digest)
+	if b == nil {
+		// Look for the referrers in the repository of the storage, as the
+		// repository of the request may be decorated without giving access
+		// to it.
+		repo, err := ah.App.registry.Repository(ah, ah.Repository.Named())
+		if err != nil {
+			ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		b, err = bundle.Build(ah, repo, ah.Digest)
+		if err != nil {
+			switch err := err.(type) {
+			case distribution.ErrManifestUnknownRevision:
+				ah.Errors = append(ah.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			case distribution.ErrRepositoryUnknown:
+				ah.Errors = append(ah.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": name}))
+			case errcode.Error:
+				ah.Errors = append(ah.Errors, err)
+			default:
+				ah.Errors = append(ah.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		ah.App.attestationBundles.add(name, ah.Digest, b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(b); err != nil {
+		dcontext.GetLogger(ah).Errorf("error encoding attestation bundle: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/attestation/bundle"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// pushReferrer pushes an OCI manifest about subject, holding content as a
+// layer of media type mediaType annotated with predicateType.
+func pushReferrer(t *testing.T, env *testEnv, name reference.Named, subject digest.Digest, mediaType, predicateType string, content []byte) digest.Digest {
+	t.Helper()
+
+	configBlob := []byte("{}")
+	configDigest := digest.FromBytes(configBlob)
+	uploadURLBase, _ := startPushLayer(t, env, name)
+	pushLayer(t, env.builder, name, configDigest, uploadURLBase, bytes.NewReader(configBlob))
+	layerDigest := digest.FromBytes(content)
+	uploadURLBase, _ = startPushLayer(t, env, name)
+	pushLayer(t, env.builder, name, layerDigest, uploadURLBase, bytes.NewReader(content))
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(configBlob)),
+		},
+		Layers: []distribution.Descriptor{{
+			MediaType:   mediaType,
+			Digest:      layerDigest,
+			Size:        int64(len(content)),
+			Annotations: map[string]string{"predicateType": predicateType},
+		}},
+		Subject: &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	_, payload, _ := m.Payload()
+	dgst := digest.FromBytes(payload)
+
+	ref, _ := reference.WithDigest(name, dgst)
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting referrer", manifestURL, v1.MediaTypeImageManifest, m)
+	defer resp.Body.Close()
+	checkResponse(t, "putting referrer", resp, http.StatusCreated)
+	return dgst
+}
+
+func getAttestations(t *testing.T, env *testEnv, name reference.Named, dgst digest.Digest) *http.Response {
+	t.Helper()
+
+	ref, _ := reference.WithDigest(name, dgst)
+	attestationsURL, err := env.builder.BuildAttestationsURL(ref)
+	checkErr(t, err, "building attestations url")
+	resp, err := http.Get(attestationsURL)
+	checkErr(t, err, "fetching attestations")
+	return resp
+}
+
+func TestAttestationsAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/attestations")
+	image := pushTransparencyManifest(t, env, name, `{"image":true}`)
+	provenance := pushReferrer(t, env, name, image, "application/vnd.in-toto+json", "https://slsa.dev/provenance/v0.2",
+		[]byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","predicate":{}}`))
+	pushReferrer(t, env, name, image, "application/spdx+json", "https://spdx.dev/Document", []byte(`{"spdxVersion":"SPDX-2.3"}`))
+
+	resp := getAttestations(t, env, name, image)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching attestations", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{"Content-Type": []string{"application/json"}})
+
+	var b bundle.AttestationBundle
+	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		t.Fatalf("unexpected error decoding attestation bundle: %v", err)
+	}
+	if b.Manifest.Digest != image {
+		t.Fatalf("unexpected manifest of the bundle: %s != %s", b.Manifest.Digest, image)
+	}
+	if len(b.Provenance) != 1 || b.Provenance[0].Referrer.Digest != provenance {
+		t.Fatalf("unexpected provenance in the bundle: %+v", b.Provenance)
+	}
+	if len(b.SBOM) != 1 || len(b.VulnScan) != 0 {
+		t.Fatalf("unexpected attestations in the bundle: %+v", b)
+	}
+
+	// The bundle is cached.
+	pushReferrer(t, env, name, image, "application/vnd.in-toto+json", "https://cosign.sigstore.dev/attestation/vuln/v1", []byte(`{"scanner":{}}`))
+	resp = getAttestations(t, env, name, image)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching cached attestations", resp, http.StatusOK)
+	b = bundle.AttestationBundle{}
+	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		t.Fatalf("unexpected error decoding attestation bundle: %v", err)
+	}
+	if len(b.VulnScan) != 0 {
+		t.Fatalf("expected the cached bundle, got %+v", b)
+	}
+
+	resp = getAttestations(t, env, name, digest.FromString("never pushed"))
+	defer resp.Body.Close()
+	checkResponse(t, "fetching attestations of an unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching attestations of an unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+}
@@ -66,7 +66,15 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if bh.App.blobContentDisposition != "" {
+		w.Header().Set("Content-Disposition", formatContentDisposition(bh.App.blobContentDisposition, bh.Repository.Named().Name(), desc.Digest))
+	}
+
 	if err := blobs.ServeBlob(bh, w, r, desc.Digest); err != nil {
+		if err == distribution.ErrBlobCorrupted {
+			// The response is already under way, and left incomplete.
+			return
+		}
 		context.GetLogger(bh).Debugf("unexpected error getting blob HTTP handler: %v", err)
 		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
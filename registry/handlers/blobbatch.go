@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// defaultBlobBatchMaxSize is the number of digests a batched blob
+	// existence check may list, unless configured otherwise.
+	defaultBlobBatchMaxSize = 100
+
+	// blobBatchConcurrency bounds the number of blobs of a batch stat'd
+	// concurrently.
+	blobBatchConcurrency = 10
+)
+
+// blobBatchDispatcher constructs the handler checking the existence of
+// several blobs at once.
+func blobBatchDispatcher(ctx *Context, r *http.Request) http.Handler {
+	blobBatchHandler := &blobBatchHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodPost: http.HandlerFunc(blobBatchHandler.CheckBlobs),
+	}
+}
+
+// blobBatchHandler handles batched blob existence checks.
+type blobBatchHandler struct {
+	*Context
+}
+
+type blobBatchRequest struct {
+	Digests []digest.Digest `json:"digests"`
+}
+
+type blobBatchResult struct {
+	Digest digest.Digest `json:"digest"`
+	Exists bool          `json:"exists"`
+	Size   int64         `json:"size,omitempty"`
+}
+
+type blobBatchResponse struct {
+	Results []blobBatchResult `json:"results"`
+}
+
+// CheckBlobs reports which of the blobs listed in the request body exist in
+// the repository, along with their size.
+func (bbh *blobBatchHandler) CheckBlobs(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var batch blobBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		bbh.Errors = append(bbh.Errors, v2.ErrorCodeBlobBatchInvalid.WithDetail(err))
+		return
+	}
+	maxSize := bbh.App.Config.HTTP.BlobBatch.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultBlobBatchMaxSize
+	}
+	if len(batch.Digests) > maxSize {
+		bbh.Errors = append(bbh.Errors, v2.ErrorCodeBlobBatchInvalid.WithDetail(fmt.Sprintf("batch of %d digests exceeds the maximum of %d", len(batch.Digests), maxSize)))
+		return
+	}
+	for _, dgst := range batch.Digests {
+		if err := dgst.Validate(); err != nil {
+			bbh.Errors = append(bbh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(map[string]string{"digest": dgst.String()}))
+			return
+		}
+	}
+
+	results := make([]blobBatchResult, len(batch.Digests))
+	errs := make([]error, len(batch.Digests))
+	blobs := bbh.Repository.Blobs(bbh)
+	sem := make(chan struct{}, blobBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, dgst := range batch.Digests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dgst digest.Digest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i].Digest = dgst
+			desc, err := blobs.Stat(bbh, dgst)
+			switch err {
+			case nil:
+				results[i].Exists = true
+				results[i].Size = desc.Size
+			case distribution.ErrBlobUnknown:
+			default:
+				errs[i] = err
+			}
+		}(i, dgst)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			bbh.Errors = append(bbh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(blobBatchResponse{Results: results}); err != nil {
+		bbh.Errors = append(bbh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultImportRegion is the region of the buckets of s3:// URLs, unless
+// configured otherwise.
+const defaultImportRegion = "us-east-1"
+
+// blobImportClient fetches the blobs imported. It does not follow
+// redirects, which would escape the allowed URLs.
+var blobImportClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// blobImportDispatcher constructs the handler importing blobs from URLs.
+func blobImportDispatcher(ctx *Context, r *http.Request) http.Handler {
+	blobImportHandler := &blobImportHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler[http.MethodPost] = http.HandlerFunc(blobImportHandler.ImportBlob)
+	}
+
+	return mhandler
+}
+
+// blobImportHandler handles the import of blobs from URLs.
+type blobImportHandler struct {
+	*Context
+}
+
+type blobImportRequest struct {
+	URL    string        `json:"url"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// ImportBlob fetches the blob at the URL of the request body and links it
+// into the repository, provided its content matches the digest.
+func (bih *blobImportHandler) ImportBlob(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	config := bih.App.Config.HTTP.BlobImport
+	if !config.Enabled {
+		bih.Errors = append(bih.Errors, errcode.ErrorCodeUnsupported.WithDetail("blob import is disabled"))
+		return
+	}
+
+	var imp blobImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&imp); err != nil {
+		bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportInvalid.WithDetail(err))
+		return
+	}
+	if err := imp.Digest.Validate(); err != nil {
+		bih.Errors = append(bih.Errors, v2.ErrorCodeDigestInvalid.WithDetail(map[string]string{"digest": imp.Digest.String()}))
+		return
+	}
+
+	u, err := parseImportURL(imp.URL)
+	if err != nil {
+		bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportInvalid.WithDetail(err.Error()))
+		return
+	}
+	cred, ok := importCredentials(config, u)
+	if !ok {
+		bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportInvalid.WithDetail(fmt.Sprintf("blobs are not imported from %q", imp.URL)))
+		return
+	}
+
+	blobs := bih.Repository.Blobs(bih)
+	desc, err := blobs.Stat(bih, imp.Digest)
+	switch err {
+	case nil:
+		if err := bih.writeBlobImportedResponse(w, desc); err != nil {
+			bih.Errors = append(bih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	case distribution.ErrBlobUnknown:
+	default:
+		bih.Errors = append(bih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	req, err := newBlobImportRequest(r, u, cred)
+	if err != nil {
+		bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportInvalid.WithDetail(err))
+		return
+	}
+	// The client only learns that the blob could not be fetched, not
+	// whether the object exists.
+	resp, err := blobImportClient.Do(req)
+	if err != nil {
+		dcontext.GetLogger(bih).Errorf("error importing blob from %s: %v", imp.URL, err)
+		bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportFailed)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		dcontext.GetLogger(bih).Errorf("error importing blob from %s: %s", imp.URL, resp.Status)
+		bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportFailed)
+		return
+	}
+	body := io.Reader(resp.Body)
+	if config.MaxSize > 0 {
+		if resp.ContentLength > config.MaxSize {
+			bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportInvalid.WithDetail(fmt.Sprintf("blob of %d bytes exceeds the maximum of %d", resp.ContentLength, config.MaxSize)))
+			return
+		}
+		// Read one byte past the maximum to notice larger blobs without
+		// a Content-Length.
+		body = io.LimitReader(resp.Body, config.MaxSize+1)
+	}
+
+	bw, err := blobs.Create(bih)
+	if err != nil {
+		bih.Errors = append(bih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	n, err := io.Copy(bw, body)
+	if err == nil && config.MaxSize > 0 && n > config.MaxSize {
+		err = v2.ErrorCodeBlobImportInvalid.WithDetail(fmt.Sprintf("blob exceeds the maximum of %d bytes", config.MaxSize))
+	}
+	if err == nil {
+		desc, err = bw.Commit(bih, distribution.Descriptor{
+			Digest: imp.Digest,
+			Size:   n,
+		})
+	}
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrBlobInvalidDigest:
+			bih.Errors = append(bih.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		case errcode.Error:
+			bih.Errors = append(bih.Errors, err)
+		default:
+			bih.Errors = append(bih.Errors, v2.ErrorCodeBlobImportFailed.WithDetail(err))
+		}
+
+		if err := bw.Cancel(bih); err != nil {
+			dcontext.GetLogger(bih).Errorf("error canceling import after error: %v", err)
+		}
+		return
+	}
+
+	if err := bih.writeBlobImportedResponse(w, desc); err != nil {
+		bih.Errors = append(bih.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+// writeBlobImportedResponse writes the 201 response of an imported blob,
+// with its location and descriptor.
+func (bih *blobImportHandler) writeBlobImportedResponse(w http.ResponseWriter, desc distribution.Descriptor) error {
+	ref, err := reference.WithDigest(bih.Repository.Named(), desc.Digest)
+	if err != nil {
+		return err
+	}
+	blobURL, err := bih.urlBuilder.BuildBlobURL(ref)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", blobURL)
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(desc)
+}
+
+// parseImportURL parses the URL of a blob to import, or a prefix of such
+// URLs. URLs with dot segments, escaped or not, and escaped slashes are
+// refused, as the URL fetched would not be under the prefixes they match.
+func parseImportURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "s3", "gs":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return nil, fmt.Errorf("URL %q lacks a host", rawURL)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("URL %q holds user information", rawURL)
+	}
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		segment, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		if segment == "." || segment == ".." || strings.ContainsAny(segment, `/\`) {
+			return nil, fmt.Errorf("URL %q holds a dot segment or an escaped slash", rawURL)
+		}
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+// importURLHasPrefix reports whether u is under prefix: it has the same
+// scheme and host, and its path is that of prefix or below it.
+func importURLHasPrefix(u, prefix *url.URL) bool {
+	if u.Scheme != prefix.Scheme || u.Host != prefix.Host {
+		return false
+	}
+	p := strings.TrimSuffix(prefix.Path, "/")
+	return p == "" || u.Path == p || strings.HasPrefix(u.Path, p+"/")
+}
+
+// importCredentials returns the credentials of the longest URL prefix
+// matching u, and whether blobs may be imported from u at all. Prefixes
+// which are not valid import URLs match nothing.
+func importCredentials(config configuration.BlobImport, u *url.URL) (configuration.ImportCredentials, bool) {
+	var (
+		match       configuration.ImportCredentials
+		matchLength = -1
+	)
+	for _, cred := range config.Credentials {
+		prefix, err := parseImportURL(cred.URL)
+		if err != nil || !importURLHasPrefix(u, prefix) {
+			continue
+		}
+		if n := len(strings.TrimSuffix(prefix.Path, "/")); n > matchLength {
+			match, matchLength = cred, n
+		}
+	}
+	if matchLength >= 0 {
+		return match, true
+	}
+	for _, rawPrefix := range config.AllowedURLs {
+		prefix, err := parseImportURL(rawPrefix)
+		if err == nil && importURLHasPrefix(u, prefix) {
+			return match, true
+		}
+	}
+	return match, false
+}
+
+// newBlobImportRequest builds the request fetching the blob at u, parsed
+// with parseImportURL. http and https URLs are fetched as is, s3:// URLs from
+// the endpoint of the credentials, signed with their keys if any, and gs://
+// URLs from the Google Cloud Storage endpoint.
+func newBlobImportRequest(r *http.Request, u *url.URL, cred configuration.ImportCredentials) (*http.Request, error) {
+	var err error
+	scheme := u.Scheme
+	region := cred.Region
+	if region == "" {
+		region = defaultImportRegion
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "s3":
+		endpoint := cred.Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+		}
+		u, err = bucketObjectURL(endpoint, u)
+		if err != nil {
+			return nil, err
+		}
+	case "gs":
+		u, err = bucketObjectURL("https://storage.googleapis.com", u)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range cred.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if scheme == "s3" && cred.AccessKey != "" {
+		signer := v4.NewSigner(credentials.NewStaticCredentials(cred.AccessKey, cred.SecretKey, cred.SessionToken))
+		if _, err := signer.Sign(req, nil, "s3", region, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// bucketObjectURL returns the path style URL of the object of a bucket URL,
+// such as s3://bucket/key, on endpoint.
+func bucketObjectURL(endpoint string, u *url.URL) (*url.URL, error) {
+	if u.Host == "" || strings.TrimPrefix(u.Path, "/") == "" {
+		return nil, fmt.Errorf("%s URL %q lacks a bucket or key", u.Scheme, u.String())
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return base.JoinPath(u.Host, u.Path), nil
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+func TestImportCredentials(t *testing.T) {
+	config := configuration.BlobImport{
+		AllowedURLs: []string{
+			"https://bucket.s3.example.com",
+			"https://example.com/public/",
+		},
+		Credentials: []configuration.ImportCredentials{
+			{URL: "s3://otherbucket/", AccessKey: "other"},
+			{URL: "s3://otherbucket/private", AccessKey: "private"},
+		},
+	}
+
+	for _, tc := range []struct {
+		url       string
+		allowed   bool
+		accessKey string
+		invalid   bool
+	}{
+		{url: "s3://otherbucket/blob", allowed: true, accessKey: "other"},
+		{url: "S3://OtherBucket/blob", allowed: true, accessKey: "other"},
+		{url: "s3://otherbucket/private/blob", allowed: true, accessKey: "private"},
+		{url: "s3://otherbucket/privateer/blob", allowed: true, accessKey: "other"},
+		{url: "s3://otherbucketx/blob"},
+		{url: "s3://victimbucket/secret"},
+		{url: "https://bucket.s3.example.com/blob", allowed: true},
+		{url: "https://bucket.s3.example.com.evil/blob"},
+		{url: "https://bucket.s3.example.com:8443/blob"},
+		{url: "http://bucket.s3.example.com/blob"},
+		{url: "https://example.com/public", allowed: true},
+		{url: "https://example.com/publicity/blob"},
+		{url: "s3://otherbucket/../victimbucket/secret", invalid: true},
+		{url: "s3://otherbucket/%2e%2e/victimbucket/secret", invalid: true},
+		{url: "s3://otherbucket/%2E./victimbucket/secret", invalid: true},
+		{url: "https://example.com/public/./blob", invalid: true},
+		{url: "https://example.com/public/..%2fprivate", invalid: true},
+		{url: "https://user@example.com/public/blob", invalid: true},
+		{url: "file:///etc/passwd", invalid: true},
+	} {
+		u, err := parseImportURL(tc.url)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("expected %s to be refused", tc.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", tc.url, err)
+			continue
+		}
+		cred, allowed := importCredentials(config, u)
+		if allowed != tc.allowed || cred.AccessKey != tc.accessKey {
+			t.Errorf("unexpected credentials of %s: %q, %t, expected %q, %t", tc.url, cred.AccessKey, allowed, tc.accessKey, tc.allowed)
+		}
+	}
+}
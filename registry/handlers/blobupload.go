@@ -41,6 +41,9 @@ func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
 			return handler
 		}
 		if h := buh.ResumeBlobUpload(ctx, r); h != nil {
+			if buh.Upload != nil {
+				return closeResources(h, buh.Upload)
+			}
 			return h
 		}
 		return closeResources(handler, buh.Upload)
@@ -150,10 +153,14 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 			buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
 			return
 		}
-		if start > end || start != buh.Upload.Size() {
+		if start > end {
 			buh.Errors = append(buh.Errors, v2.ErrorCodeRangeInvalid)
 			return
 		}
+		if size := buh.Upload.Size(); start != size {
+			buh.appendPayloadError(w, distribution.ErrBlobUploadRangeInvalid{Start: start, Size: size})
+			return
+		}
 
 		clInt, err := strconv.ParseInt(cl, 10, 64)
 		if err != nil {
@@ -167,7 +174,7 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 	}
 
 	if err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PATCH"); err != nil {
-		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
+		buh.appendPayloadError(w, err)
 		return
 	}
 
@@ -207,7 +214,7 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 	}
 
 	if err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PUT"); err != nil {
-		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
+		buh.appendPayloadError(w, err)
 		return
 	}
 
@@ -247,6 +254,7 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 
 		return
 	}
+	buh.App.uploadProgress.complete(buh.UUID)
 	if err := buh.writeBlobCreatedHeaders(w, desc); err != nil {
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
@@ -266,6 +274,7 @@ func (buh *blobUploadHandler) CancelBlobUpload(w http.ResponseWriter, r *http.Re
 		dcontext.GetLogger(buh).Errorf("error encountered canceling upload: %v", err)
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 	}
+	buh.App.uploadProgress.complete(buh.UUID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -294,8 +303,17 @@ func (buh *blobUploadHandler) ResumeBlobUpload(ctx *Context, r *http.Request) ht
 		})
 	}
 
+	// Report the progress of the data of the request to the clients
+	// following the upload.
+	progressCtx := storage.WithUploadProgress(buh, ctx.App.uploadProgress.progressCallback(buh.UUID), r.ContentLength)
+	if cr := r.Header.Get("Content-Range"); cr != "" {
+		if start, _, err := parseContentRange(cr); err == nil {
+			progressCtx = storage.WithUploadRange(progressCtx, start)
+		}
+	}
+
 	blobs := ctx.Repository.Blobs(buh)
-	upload, err := blobs.Resume(buh, buh.UUID)
+	upload, err := blobs.Resume(progressCtx, buh.UUID)
 	if err != nil {
 		dcontext.GetLogger(ctx).Errorf("error resolving upload: %v", err)
 		if err == distribution.ErrBlobUploadUnknown {
@@ -319,6 +337,22 @@ func (buh *blobUploadHandler) ResumeBlobUpload(ctx *Context, r *http.Request) ht
 	return nil
 }
 
+// appendPayloadError appends the error writing the payload of a request to
+// the upload. A payload not starting at the end of the upload is rejected
+// with the range received so far, after which the client resumes.
+func (buh *blobUploadHandler) appendPayloadError(w http.ResponseWriter, err error) {
+	if err, ok := err.(distribution.ErrBlobUploadRangeInvalid); ok {
+		endRange := err.Size
+		if endRange > 0 {
+			endRange = endRange - 1
+		}
+		w.Header().Set("Range", fmt.Sprintf("0-%d", endRange))
+		buh.Errors = append(buh.Errors, v2.ErrorCodeRangeInvalid.WithDetail(err))
+		return
+	}
+	buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
+}
+
 // blobUploadResponse provides a standard request for uploading blobs and
 // chunk responses. This sets the correct headers but the response status is
 // left to the caller.
@@ -360,7 +394,8 @@ func (buh *blobUploadHandler) blobUploadResponse(w http.ResponseWriter, r *http.
 	return nil
 }
 
-// mountBlob attempts to mount a blob from another repository by its digest. If
+// createBlobMountOption returns the option mounting a blob from another
+// repository by its digest, without transferring its data. If
 // successful, the blob is linked into the blob store and 201 Created is
 // returned with the canonical url of the blob.
 func (buh *blobUploadHandler) createBlobMountOption(fromRepo, mountDigest string) (distribution.BlobCreateOption, error) {
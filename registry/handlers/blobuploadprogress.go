@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// uploadProgressEvent is the progress of an upload, sent to the clients
+// following it.
+type uploadProgressEvent struct {
+	Written int64 `json:"written"`
+	Total   int64 `json:"total"`
+}
+
+// uploadProgressBroker hands the progress of the uploads off to the clients
+// following them. It only knows of the uploads written to this instance of
+// the registry.
+type uploadProgressBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan uploadProgressEvent]struct{}
+}
+
+func newUploadProgressBroker() *uploadProgressBroker {
+	return &uploadProgressBroker{
+		subscribers: make(map[string]map[chan uploadProgressEvent]struct{}),
+	}
+}
+
+// subscribe returns a channel receiving the latest progress of the upload
+// id, closed once the upload completes, and a function to unsubscribe.
+func (b *uploadProgressBroker) subscribe(id string) (<-chan uploadProgressEvent, func()) {
+	ch := make(chan uploadProgressEvent, 1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = make(map[chan uploadProgressEvent]struct{})
+	}
+	b.subscribers[id][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id][ch]; ok {
+			delete(b.subscribers[id], ch)
+			if len(b.subscribers[id]) == 0 {
+				delete(b.subscribers, id)
+			}
+		}
+	}
+}
+
+// publish sends the progress of the upload id to its subscribers. It runs
+// in the goroutine writing the upload, so it never blocks: subscribers which
+// did not receive the previous progress yet only receive the latest.
+func (b *uploadProgressBroker) publish(id string, event uploadProgressEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[id] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- event
+	}
+}
+
+// complete closes the channels of the subscribers of the upload id.
+func (b *uploadProgressBroker) complete(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[id] {
+		close(ch)
+	}
+	delete(b.subscribers, id)
+}
+
+// progressCallback returns the callback publishing the progress of the
+// upload id.
+func (b *uploadProgressBroker) progressCallback(id string) func(written, total int64) {
+	return func(written, total int64) {
+		b.publish(id, uploadProgressEvent{Written: written, Total: total})
+	}
+}
+
+// blobUploadProgressDispatcher constructs the handler streaming the progress
+// of an upload.
+func blobUploadProgressDispatcher(ctx *Context, r *http.Request) http.Handler {
+	buph := &blobUploadProgressHandler{
+		Context: ctx,
+		UUID:    getUploadUUID(ctx),
+	}
+
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(buph.StreamProgress),
+	}
+}
+
+// blobUploadProgressHandler handles requests for the progress of an upload.
+type blobUploadProgressHandler struct {
+	*Context
+
+	UUID string
+}
+
+// StreamProgress streams the progress of the upload as server-sent events,
+// until the upload completes or the client goes away.
+func (buph *blobUploadProgressHandler) StreamProgress(w http.ResponseWriter, r *http.Request) {
+	upload, err := buph.Repository.Blobs(buph).Resume(buph, buph.UUID)
+	if err != nil {
+		if err == distribution.ErrBlobUploadUnknown {
+			buph.Errors = append(buph.Errors, v2.ErrorCodeBlobUploadUnknown.WithDetail(err))
+		} else {
+			buph.Errors = append(buph.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	upload.Close()
+	event := uploadProgressEvent{Written: upload.Size(), Total: -1}
+
+	events, unsubscribe := buph.App.uploadProgress.subscribe(buph.UUID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	send := func(name string, event uploadProgressEvent) bool {
+		p, _ := json.Marshal(event)
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, p); err != nil {
+			dcontext.GetLogger(buph).Debugf("error sending upload progress: %v", err)
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	if !send("progress", event) {
+		return
+	}
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				send("complete", event)
+				return
+			}
+			event = e
+			if !send("progress", event) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
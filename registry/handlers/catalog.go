@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,12 +9,20 @@ import (
 	"net/url"
 	"strconv"
 
+	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/gorilla/handlers"
 )
 
-const maximumReturnedEntries = 100
+const (
+	maximumReturnedEntries = 100
+
+	// maximumCatalogEntries bounds the repositories of a catalog response,
+	// however many are requested, the rest being linked to.
+	maximumCatalogEntries = 1000
+)
 
 func catalogDispatcher(ctx *Context, r *http.Request) http.Handler {
 	catalogHandler := &catalogHandler{
@@ -38,10 +47,21 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	lastEntry := q.Get("last")
+	if cursor := q.Get("cursor"); cursor != "" {
+		var err error
+		lastEntry, err = decodeCatalogCursor(cursor)
+		if err != nil {
+			ch.Errors = append(ch.Errors, v2.ErrorCodePaginationCursorInvalid.WithDetail(map[string]string{"cursor": cursor}))
+			return
+		}
+	}
 	maxEntries, err := strconv.Atoi(q.Get("n"))
 	if err != nil || maxEntries < 0 {
 		maxEntries = maximumReturnedEntries
 	}
+	if maxEntries > maximumCatalogEntries {
+		maxEntries = maximumCatalogEntries
+	}
 
 	repos := make([]string, maxEntries)
 
@@ -60,7 +80,7 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	// Add a link header if there are more entries to retrieve
 	if moreEntries {
 		lastEntry = repos[len(repos)-1]
-		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, lastEntry)
+		urlStr, err := createCatalogLinkEntry(r.URL.String(), maxEntries, lastEntry)
 		if err != nil {
 			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			return
@@ -96,3 +116,43 @@ func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string,
 
 	return urlStr, nil
 }
+
+// createCatalogLinkEntry creates the link header to the repositories after
+// lastEntry, resuming from a cursor rather than from the last parameter so
+// that any replica of the registry may serve it.
+func createCatalogLinkEntry(origURL string, maxEntries int, lastEntry string) (string, error) {
+	calledURL, err := url.Parse(origURL)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Add("n", strconv.Itoa(maxEntries))
+	v.Add("cursor", encodeCatalogCursor(lastEntry))
+
+	calledURL.RawQuery = v.Encode()
+
+	calledURL.Fragment = ""
+	urlStr := fmt.Sprintf("<%s>; rel=\"next\"", calledURL.String())
+
+	return urlStr, nil
+}
+
+// encodeCatalogCursor returns the opaque cursor of the catalog resuming
+// after the repository lastEntry.
+func encodeCatalogCursor(lastEntry string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastEntry))
+}
+
+// decodeCatalogCursor returns the repository after which the catalog of
+// cursor resumes.
+func decodeCatalogCursor(cursor string) (string, error) {
+	lastEntry, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+	if _, err := reference.WithName(string(lastEntry)); err != nil {
+		return "", err
+	}
+	return string(lastEntry), nil
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// shortDigestLength is the number of hexadecimal characters of the short
+// form of digests.
+const shortDigestLength = 12
+
+// formatContentDisposition returns the Content-Disposition header of the
+// content dgst of repository from template, in which {shortDigest},
+// {fullDigest} and {repository} are replaced by the first characters of the
+// encoded digest, the whole encoded digest and the repository name.
+func formatContentDisposition(template, repository string, dgst digest.Digest) string {
+	encoded := dgst.Encoded()
+	short := encoded
+	if len(short) > shortDigestLength {
+		short = short[:shortDigestLength]
+	}
+	return strings.NewReplacer(
+		"{shortDigest}", short,
+		"{fullDigest}", encoded,
+		"{repository}", repository,
+	).Replace(template)
+}
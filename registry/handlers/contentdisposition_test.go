@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestFormatContentDisposition(t *testing.T) {
+	dgst := digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	for _, tc := range []struct {
+		template string
+		expected string
+	}{
+		{
+			template: "attachment; filename={shortDigest}.tar.gz",
+			expected: "attachment; filename=0123456789ab.tar.gz",
+		},
+		{
+			template: `attachment; filename="{repository}@{fullDigest}"`,
+			expected: `attachment; filename="foo/bar@0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"`,
+		},
+		{
+			template: "inline",
+			expected: "inline",
+		},
+		{
+			template: "attachment; filename={unknown}",
+			expected: "attachment; filename={unknown}",
+		},
+	} {
+		if actual := formatContentDisposition(tc.template, "foo/bar", dgst); actual != tc.expected {
+			t.Errorf("expected %q from template %q, got %q", tc.expected, tc.template, actual)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+			"blobs": configuration.Parameters{
+				"contentdisposition": "attachment; filename={shortDigest}.tar.gz",
+			},
+			"manifests": configuration.Parameters{
+				"contentdisposition": `inline; filename="{repository}-{shortDigest}.json"`,
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/disposition")
+
+	layer := []byte("layer content")
+	layerDigest := digest.FromBytes(layer)
+	uploadURLBase, _ := startPushLayer(t, env, name)
+	pushLayer(t, env.builder, name, layerDigest, uploadURLBase, bytes.NewReader(layer))
+
+	ref, _ := reference.WithDigest(name, layerDigest)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	checkErr(t, err, "building blob url")
+	resp, err := http.Get(blobURL)
+	checkErr(t, err, "fetching blob")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching blob", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Disposition": []string{"attachment; filename=" + layerDigest.Encoded()[:12] + ".tar.gz"},
+	})
+
+	manifestDigest := pushTransparencyManifest(t, env, name, `{"disposition":true}`)
+	ref, _ = reference.WithDigest(name, manifestDigest)
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	checkErr(t, err, "creating manifest request")
+	req.Header.Set("Accept", v1.MediaTypeImageManifest)
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Disposition": []string{`inline; filename="foo/disposition-` + manifestDigest.Encoded()[:12] + `.json"`},
+	})
+}
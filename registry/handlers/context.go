@@ -73,6 +73,10 @@ func getDigest(ctx context.Context) (dgst digest.Digest, err error) {
 	return d, nil
 }
 
+func getTag(ctx context.Context) (tag string) {
+	return dcontext.GetStringValue(ctx, "vars.tag")
+}
+
 func getUploadUUID(ctx context.Context) (uuid string) {
 	return dcontext.GetStringValue(ctx, "vars.uuid")
 }
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// reservedResponseHeaders are the headers the registry sets itself, as
+// required by the distribution API and the OCI distribution specification.
+// They cannot be configured as static response headers.
+var reservedResponseHeaders = []string{
+	"Content-Length",
+	"Content-Range",
+	"Content-Type",
+	"Docker-Content-Digest",
+	"Docker-Distribution-API-Version",
+	"Docker-Upload-UUID",
+	"Etag",
+	"Link",
+	"Location",
+	"OCI-Subject",
+	"Range",
+	"WWW-Authenticate",
+}
+
+// checkResponseHeaders returns an error if the static response headers
+// include a reserved header.
+func checkResponseHeaders(headers http.Header) error {
+	for name := range headers {
+		for _, reserved := range reservedResponseHeaders {
+			if http.CanonicalHeaderKey(name) == http.CanonicalHeaderKey(reserved) {
+				return fmt.Errorf("header %s is set by the registry and cannot be configured", name)
+			}
+		}
+	}
+	return nil
+}
+
+// addResponseHeaders adds the static response headers to w.
+func addResponseHeaders(w http.ResponseWriter, headers http.Header) {
+	for name, values := range headers {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+}
+
+// ResponseHeaders wraps handler with the addition of the static response
+// headers, for the handlers served next to the application.
+func ResponseHeaders(headers http.Header, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addResponseHeaders(w, headers)
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = http.Header{
+		"X-Content-Type-Options":    []string{"nosniff"},
+		"X-Frame-Options":           []string{"DENY"},
+		"Content-Security-Policy":   []string{"default-src 'none'"},
+		"Strict-Transport-Security": []string{"max-age=31536000"},
+	}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	baseURL, err := env.builder.BuildBaseURL()
+	checkErr(t, err, "building base url")
+	name, _ := reference.WithName("foo/headers")
+	tagsURL, err := env.builder.BuildTagsURL(name)
+	checkErr(t, err, "building tags url")
+
+	// The headers are added to successful responses, error responses and
+	// the responses of unknown routes.
+	for _, tc := range []struct {
+		url    string
+		status int
+	}{
+		{baseURL, http.StatusOK},
+		{tagsURL, http.StatusNotFound},
+		{baseURL + "unknown/route", http.StatusNotFound},
+	} {
+		resp, err := http.Get(tc.url)
+		checkErr(t, err, "fetching "+tc.url)
+		defer resp.Body.Close()
+		checkResponse(t, "fetching "+tc.url, resp, tc.status)
+		checkHeaders(t, resp, config.HTTP.Headers)
+	}
+}
+
+func TestReservedResponseHeaders(t *testing.T) {
+	for _, name := range []string{"Content-Type", "docker-content-digest", "Location"} {
+		config := configuration.Configuration{
+			Storage: configuration.Storage{"testdriver": configuration.Parameters{}},
+		}
+		config.HTTP.Headers = http.Header{name: []string{"value"}}
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected configuring the %s header to be rejected", name)
+				}
+			}()
+			NewApp(context.Background(), &config)
+		}()
+	}
+}
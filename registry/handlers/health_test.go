@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -9,8 +11,9 @@ import (
 	"time"
 
 	"github.com/distribution/distribution/v3/configuration"
-	"github.com/distribution/distribution/v3/context"
+	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/health"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 )
 
 func TestFileHealthCheck(t *testing.T) {
@@ -39,7 +42,7 @@ func TestFileHealthCheck(t *testing.T) {
 		},
 	}
 
-	ctx := context.Background()
+	ctx := dcontext.Background()
 
 	app := NewApp(ctx, config)
 	healthRegistry := health.NewRegistry()
@@ -103,7 +106,7 @@ func TestTCPHealthCheck(t *testing.T) {
 		},
 	}
 
-	ctx := context.Background()
+	ctx := dcontext.Background()
 
 	app := NewApp(ctx, config)
 	healthRegistry := health.NewRegistry()
@@ -165,7 +168,7 @@ func TestHTTPHealthCheck(t *testing.T) {
 		},
 	}
 
-	ctx := context.Background()
+	ctx := dcontext.Background()
 
 	app := NewApp(ctx, config)
 	healthRegistry := health.NewRegistry()
@@ -207,3 +210,61 @@ func TestHTTPHealthCheck(t *testing.T) {
 		t.Fatal("expected 0 items in health check results")
 	}
 }
+
+// failingWriteDriver fails to write files while failing is set.
+type failingWriteDriver struct {
+	storagedriver.StorageDriver
+	failing chan struct{}
+}
+
+func (d *failingWriteDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	select {
+	case <-d.failing:
+		return d.StorageDriver.PutContent(ctx, path, content)
+	default:
+		return errors.New("storage unavailable")
+	}
+}
+
+func TestStorageDriverHealthCheck(t *testing.T) {
+	interval := 100 * time.Millisecond
+	threshold := 3
+
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Health.StorageDriver.Enabled = true
+	config.Health.StorageDriver.Interval = interval
+	config.Health.StorageDriver.Threshold = threshold
+	config.Health.StorageDriver.Path = "/_health/ping"
+
+	ctx := dcontext.Background()
+
+	app := NewApp(ctx, config)
+	driver := &failingWriteDriver{StorageDriver: app.driver, failing: make(chan struct{})}
+	app.driver = driver
+	healthRegistry := health.NewRegistry()
+	app.RegisterHealthChecks(healthRegistry)
+
+	<-time.After(time.Duration(threshold+2) * interval)
+	status := healthRegistry.CheckStatus()
+	if status["storagedriver_inmemory"] != "writing health probe: storage unavailable" {
+		t.Fatalf("expected the storage driver check to fail, got %v", status)
+	}
+
+	// Let the probe write again.
+	close(driver.failing)
+
+	<-time.After(3 * interval)
+	if status := healthRegistry.CheckStatus(); len(status) != 0 {
+		t.Fatalf("expected 0 items in health check results, got %v", status)
+	}
+	if _, err := app.driver.Stat(ctx, "/_health/ping"); err == nil {
+		t.Fatal("expected the probe file to be deleted")
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/gorilla/handlers"
+)
+
+// hpaMetricsDispatcher serves the current autoscaling metric values.
+func hpaMetricsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(getHPAMetrics),
+	}
+}
+
+func getHPAMetrics(w http.ResponseWriter, r *http.Request) {
+	p, err := json.Marshal(prometheus.HPA.Values())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	w.Write(p)
+}
+
+// trackHPAMetrics wraps handler so that the requests of the route which
+// contribute to the registry load are counted by the autoscaling metrics.
+func trackHPAMetrics(routeName string, handler http.Handler) http.Handler {
+	var track func(r *http.Request) func()
+
+	switch routeName {
+	case v2.RouteNameBlob:
+		track = func(r *http.Request) func() {
+			if r.Method != http.MethodGet {
+				return nil
+			}
+			return prometheus.HPA.BlobPullStarted()
+		}
+	case v2.RouteNameBlobUpload, v2.RouteNameBlobUploadChunk:
+		track = func(r *http.Request) func() {
+			switch r.Method {
+			case http.MethodPost, http.MethodPatch, http.MethodPut:
+				return prometheus.HPA.BlobUploadStarted()
+			}
+			return nil
+		}
+	case v2.RouteNameManifest, v2.RouteNameManifestUploadChunk:
+		track = func(r *http.Request) func() {
+			switch r.Method {
+			case http.MethodPatch, http.MethodPut:
+				return prometheus.HPA.ManifestPushStarted()
+			}
+			return nil
+		}
+	default:
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if done := track(r); done != nil {
+			defer done()
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
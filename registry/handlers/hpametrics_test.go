@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/distribution/distribution/v3/reference"
+)
+
+func fetchHPAMetrics(t *testing.T, env *testEnv) prometheus.HPAValues {
+	t.Helper()
+
+	metricsURL, err := env.builder.BuildHPAMetricsURL()
+	checkErr(t, err, "building hpa metrics url")
+
+	resp, err := http.Get(metricsURL)
+	checkErr(t, err, "fetching hpa metrics")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching hpa metrics", resp, http.StatusOK)
+
+	var values prometheus.HPAValues
+	checkErr(t, json.NewDecoder(resp.Body).Decode(&values), "decoding hpa metrics")
+	return values
+}
+
+func TestHPAMetrics(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	if values := fetchHPAMetrics(t, env); values.ActiveBlobUploads != 0 {
+		t.Fatalf("unexpected active blob uploads before upload: %d", values.ActiveBlobUploads)
+	}
+
+	imageName, _ := reference.WithName("foo/bar")
+	location, _ := startPushLayer(t, env, imageName)
+
+	// Stream the upload body through a pipe, so that the request stays in
+	// flight until the pipe is closed.
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPatch, location, pr)
+	checkErr(t, err, "creating patch request")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	if _, err := pw.Write([]byte("some layer data")); err != nil {
+		t.Fatalf("unexpected error writing upload data: %v", err)
+	}
+
+	if values := fetchHPAMetrics(t, env); values.ActiveBlobUploads != 1 {
+		t.Fatalf("unexpected active blob uploads during upload: %d", values.ActiveBlobUploads)
+	}
+
+	pw.Close()
+	<-done
+
+	// The upload is accounted for until the handler returns, which may be
+	// after the client has received the response.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		values := fetchHPAMetrics(t, env)
+		if values.ActiveBlobUploads == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected active blob uploads after upload: %d", values.ActiveBlobUploads)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
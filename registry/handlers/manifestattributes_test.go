@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// getIndex fetches the image index referenced by ref with the query
+// parameters.
+func getIndex(t *testing.T, env *testEnv, ref reference.Named, query url.Values) *http.Response {
+	t.Helper()
+
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	if len(query) > 0 {
+		manifestURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	checkErr(t, err, "creating manifest request")
+	req.Header.Set("Accept", v1.MediaTypeImageIndex)
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching image index")
+	return resp
+}
+
+// checkIndexManifests checks the image index of resp holds the manifests,
+// and returns its digest.
+func checkIndexManifests(t *testing.T, resp *http.Response, manifests ...digest.Digest) digest.Digest {
+	t.Helper()
+
+	checkResponse(t, "fetching image index", resp, http.StatusOK)
+	var index manifestlist.DeserializedManifestList
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		t.Fatalf("unexpected error decoding image index: %v", err)
+	}
+	_, p, err := index.Payload()
+	checkErr(t, err, "getting image index payload")
+	dgst := digest.FromBytes(p)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{v1.MediaTypeImageIndex},
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+
+	if len(index.Manifests) != len(manifests) {
+		t.Fatalf("expected %d manifests in the image index, got %d", len(manifests), len(index.Manifests))
+	}
+	for i, desc := range index.Manifests {
+		if desc.Digest != manifests[i] {
+			t.Fatalf("unexpected manifest %d of the image index: %s != %s", i, desc.Digest, manifests[i])
+		}
+	}
+	return dgst
+}
+
+func TestManifestListPlatformAttributes(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/attributes")
+	attributes := []map[string]string{
+		{"io.myco.env": "prod", "io.buildkits.gpu": "true"},
+		{"io.myco.env": "prod"},
+		{"io.myco.env": "dev", "io.buildkits.gpu": "true"},
+	}
+	var descriptors []manifestlist.ManifestDescriptor
+	var manifests []digest.Digest
+	for i, platformAttributes := range attributes {
+		dgst := pushTransparencyManifest(t, env, name, fmt.Sprintf(`{"platform":%d}`, i))
+		descriptors = append(descriptors, manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    dgst,
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: "amd64",
+				OS:           "linux",
+				Attributes:   platformAttributes,
+			},
+		})
+		manifests = append(manifests, dgst)
+	}
+	index, err := manifestlist.FromDescriptorsWithMediaType(descriptors, v1.MediaTypeImageIndex)
+	checkErr(t, err, "creating image index")
+	_, payload, err := index.Payload()
+	checkErr(t, err, "getting image index payload")
+	indexDigest := digest.FromBytes(payload)
+
+	tagRef, _ := reference.WithTag(name, "multi")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting image index", manifestURL, v1.MediaTypeImageIndex, index)
+	defer resp.Body.Close()
+	checkResponse(t, "putting image index", resp, http.StatusCreated)
+
+	// Without attributes, the stored index is returned.
+	resp = getIndex(t, env, tagRef, nil)
+	defer resp.Body.Close()
+	if dgst := checkIndexManifests(t, resp, manifests...); dgst != indexDigest {
+		t.Fatalf("expected the stored image index %s, got %s", indexDigest, dgst)
+	}
+
+	// The manifests are filtered by all the attributes.
+	resp = getIndex(t, env, tagRef, url.Values{"platform.attribute.io.myco.env": []string{"prod"}})
+	defer resp.Body.Close()
+	filtered := checkIndexManifests(t, resp, manifests[0], manifests[1])
+	if filtered == indexDigest {
+		t.Fatal("expected the filtered image index to have its own digest")
+	}
+
+	resp = getIndex(t, env, tagRef, url.Values{
+		"platform.attribute.io.myco.env":      []string{"prod"},
+		"platform.attribute.io.buildkits.gpu": []string{"true"},
+	})
+	defer resp.Body.Close()
+	checkIndexManifests(t, resp, manifests[0])
+
+	digestRef, _ := reference.WithDigest(name, indexDigest)
+	resp = getIndex(t, env, digestRef, url.Values{"platform.attribute.io.buildkits.gpu": []string{"true"}})
+	defer resp.Body.Close()
+	checkIndexManifests(t, resp, manifests[0], manifests[2])
+
+	// Other query parameters are ignored.
+	resp = getIndex(t, env, tagRef, url.Values{"platform.os": []string{"windows"}})
+	defer resp.Body.Close()
+	checkIndexManifests(t, resp, manifests...)
+
+	resp = getIndex(t, env, tagRef, url.Values{"platform.attribute.io.myco.env": []string{"staging"}})
+	defer resp.Body.Close()
+	checkResponse(t, "fetching image index without matching manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching image index without matching manifest", resp, v2.ErrorCodeManifestUnknown)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultManifestChainDepth is the number of subjects followed by manifest
+// chain requests without depth parameter.
+const defaultManifestChainDepth = 10
+
+// manifestChainDispatcher constructs the handler returning the chain of a
+// manifest.
+func manifestChainDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	manifestChainHandler := &manifestChainHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(manifestChainHandler.GetChain),
+	}
+}
+
+// manifestChainHandler handles requests for the chain of a manifest.
+type manifestChainHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+type manifestChainAPIResponse struct {
+	Name  string             `json:"name"`
+	Chain *storage.ChainNode `json:"chain"`
+}
+
+// GetChain returns the tree of the chain of the manifest, following the
+// subjects of the manifests.
+func (mch *manifestChainHandler) GetChain(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	maxDepth := defaultManifestChainDepth
+	if depth := r.URL.Query().Get("depth"); depth != "" {
+		var err error
+		maxDepth, err = strconv.Atoi(depth)
+		if err != nil || maxDepth < 1 {
+			mch.Errors = append(mch.Errors, v2.ErrorCodeChainDepthInvalid.WithDetail(map[string]string{"depth": depth}))
+			return
+		}
+	}
+
+	manifests, err := mch.Repository.Manifests(mch)
+	if err != nil {
+		mch.Errors = append(mch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	chain, err := storage.ManifestChain(mch, manifests, mch.Digest, maxDepth)
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrManifestUnknownRevision:
+			mch.Errors = append(mch.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		case distribution.ErrRepositoryUnknown:
+			mch.Errors = append(mch.Errors, v2.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": mch.Repository.Named().Name()}))
+		case errcode.Error:
+			mch.Errors = append(mch.Errors, err)
+		default:
+			mch.Errors = append(mch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(manifestChainAPIResponse{
+		Name:  mch.Repository.Named().Name(),
+		Chain: chain[len(chain)-1],
+	}); err != nil {
+		mch.Errors = append(mch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
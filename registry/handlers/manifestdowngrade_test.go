@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/reference"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func newDowngradeTestEnv(t *testing.T, downgrade bool) *testEnv {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.DowngradeOCIToSchema2 = downgrade
+	return newTestEnvWithConfig(t, &config)
+}
+
+// pushOCIImage pushes an OCI image manifest with a config and a layer to the
+// tag latest of the repository name, and returns its digest.
+func pushOCIImage(t *testing.T, env *testEnv, name reference.Named) digest.Digest {
+	mfst := ocischema.Manifest{Versioned: ocischema.SchemaVersion}
+	for i, content := range []string{`{"architecture":"amd64","os":"linux"}`, "layer content"} {
+		blob := []byte(content)
+		desc := distribution.Descriptor{
+			MediaType: v1.MediaTypeImageLayerGzip,
+			Digest:    digest.FromBytes(blob),
+			Size:      int64(len(blob)),
+		}
+		uploadURLBase, _ := startPushLayer(t, env, name)
+		pushLayer(t, env.builder, name, desc.Digest, uploadURLBase, bytes.NewReader(blob))
+		if i == 0 {
+			desc.MediaType = v1.MediaTypeImageConfig
+			mfst.Config = desc
+		} else {
+			mfst.Layers = append(mfst.Layers, desc)
+		}
+	}
+	m, err := ocischema.FromStruct(mfst)
+	checkErr(t, err, "creating manifest")
+	_, payload, _ := m.Payload()
+
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting manifest", manifestURL, v1.MediaTypeImageManifest, m)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest", resp, http.StatusCreated)
+	return digest.FromBytes(payload)
+}
+
+func getManifestAccepting(t *testing.T, manifestURL string, accept ...string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	checkErr(t, err, "creating manifest request")
+	for _, mediaType := range accept {
+		req.Header.Add("Accept", mediaType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest")
+	return resp
+}
+
+func TestManifestDowngradeOCIToSchema2(t *testing.T) {
+	env := newDowngradeTestEnv(t, true)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/downgrade")
+	ociDigest := pushOCIImage(t, env, name)
+	tagRef, _ := reference.WithTag(name, "latest")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	// Clients accepting OCI manifests get the stored manifest.
+	resp := getManifestAccepting(t, tagURL, v1.MediaTypeImageManifest, schema2.MediaTypeManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest accepting oci", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{v1.MediaTypeImageManifest},
+		"Docker-Content-Digest": []string{ociDigest.String()},
+	})
+
+	// Others get it converted to schema2.
+	resp = getManifestAccepting(t, tagURL, schema2.MediaTypeManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest accepting schema2", resp, http.StatusOK)
+	p, err := io.ReadAll(resp.Body)
+	checkErr(t, err, "reading manifest")
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{schema2.MediaTypeManifest},
+		"Docker-Content-Digest": []string{digest.FromBytes(p).String()},
+	})
+	var m schema2.DeserializedManifest
+	if err := json.Unmarshal(p, &m); err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+	if m.Config.MediaType != schema2.MediaTypeImageConfig {
+		t.Fatalf("unexpected config media type: %s", m.Config.MediaType)
+	}
+	if len(m.Layers) != 1 || m.Layers[0].MediaType != schema2.MediaTypeLayer {
+		t.Fatalf("unexpected layers: %+v", m.Layers)
+	}
+
+	// The stored manifest is still the OCI one.
+	digestRef, _ := reference.WithDigest(name, ociDigest)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+	resp = getManifestAccepting(t, digestURL, v1.MediaTypeImageManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest by digest", resp, http.StatusOK)
+
+	// Manifests fetched by digest are never rewritten.
+	resp = getManifestAccepting(t, digestURL, schema2.MediaTypeManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest by digest accepting schema2", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching manifest by digest accepting schema2", resp, v2.ErrorCodeManifestUnknown)
+}
+
+func TestManifestDowngradeOCIToSchema2Disabled(t *testing.T) {
+	env := newDowngradeTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/nodowngrade")
+	pushOCIImage(t, env, name)
+	tagRef, _ := reference.WithTag(name, "latest")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp := getManifestAccepting(t, tagURL, schema2.MediaTypeManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest accepting schema2", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching manifest accepting schema2", resp, v2.ErrorCodeManifestUnknown)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+)
+
+// mediaTypeMergePatch is the media type of JSON merge patches, as described
+// by RFC 7396.
+const mediaTypeMergePatch = "application/merge-patch+json"
+
+// maxManifestPatchBodySize bounds the size of the bodies of manifest patches.
+const maxManifestPatchBodySize = 1 << 20
+
+// PatchManifest updates the annotations of the manifest with the merge patch
+// in the request body. The updated manifest is stored under its own digest,
+// and the tags of the manifest are moved to it.
+func (imh *manifestHandler) PatchManifest(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(imh).Debug("PatchImageManifest")
+
+	if imh.Digest == "" {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid.WithDetail("manifests can only be patched by digest"))
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != mediaTypeMergePatch {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(fmt.Sprintf("patches must be of type %s", mediaTypeMergePatch)))
+		return
+	}
+
+	var body bytes.Buffer
+	if err := copyFullPayload(imh, w, r, &body, maxManifestPatchBodySize, "image manifest PATCH"); err != nil {
+		// copyFullPayload reports the error if necessary
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err.Error()))
+		return
+	}
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body.Bytes(), &patch); err != nil {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+		return
+	}
+	for field := range patch {
+		if field != "annotations" {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(fmt.Sprintf("field %s cannot be patched", field)))
+			return
+		}
+	}
+	var annotations map[string]*string
+	if raw, ok := patch["annotations"]; ok {
+		if err := json.Unmarshal(raw, &annotations); err != nil {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+			return
+		}
+	}
+
+	manifests, err := imh.Repository.Manifests(imh)
+	if err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+	manifest, err := manifests.Get(imh, imh.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	original, ok := manifest.(*ocischema.DeserializedManifest)
+	if !ok {
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail("only the annotations of OCI image manifests can be patched"))
+		return
+	}
+	mediaType, payload, err := original.Payload()
+	if err != nil {
+		imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	originalDesc := distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    imh.Digest,
+		Size:      int64(len(payload)),
+	}
+
+	// Merge the annotations, a null annotations field removing them all.
+	m := original.Manifest
+	merged := make(map[string]string)
+	if string(patch["annotations"]) != "null" {
+		for key, value := range m.Annotations {
+			merged[key] = value
+		}
+	}
+	for key, value := range annotations {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = *value
+		}
+	}
+	m.Annotations = nil
+	if len(merged) > 0 {
+		m.Annotations = merged
+	}
+	patched, err := ocischema.FromStruct(m)
+	if err != nil {
+		imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if err := imh.applyResourcePolicy(patched); err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+	dgst, err := manifests.Put(imh, patched)
+	if err != nil {
+		imh.Errors = appendManifestPutError(imh.Errors, err)
+		return
+	}
+	_, payload, err = patched.Payload()
+	if err != nil {
+		imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	desc := distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}
+
+	// Move the tags of the original manifest to the patched manifest.
+	tags := imh.Repository.Tags(imh)
+	tagged, err := tags.Lookup(imh, originalDesc)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	}
+	for _, tag := range tagged {
+		if err := imh.tagManifest(tags, tag, desc); err != nil {
+			imh.Errors = appendTagError(imh.Errors, err)
+			return
+		}
+	}
+
+	imh.recordTransparency(dgst)
+
+	ref, err := reference.WithDigest(imh.Repository.Named(), dgst)
+	if err != nil {
+		imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	location, err := imh.urlBuilder.BuildManifestURL(ref)
+	if err != nil {
+		dcontext.GetLogger(imh).Errorf("error building manifest url from digest: %v", err)
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func patchManifest(t *testing.T, env *testEnv, ref reference.Named, contentType, body string) *http.Response {
+	t.Helper()
+
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest(http.MethodPatch, manifestURL, strings.NewReader(body))
+	checkErr(t, err, "creating manifest patch request")
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "patching manifest")
+	return resp
+}
+
+// patchAnnotations patches the annotations of the manifest dgst of name,
+// and returns the digest of the patched manifest.
+func patchAnnotations(t *testing.T, env *testEnv, name reference.Named, dgst digest.Digest, body string) digest.Digest {
+	t.Helper()
+
+	ref, _ := reference.WithDigest(name, dgst)
+	resp := patchManifest(t, env, ref, mediaTypeMergePatch, body)
+	defer resp.Body.Close()
+	checkResponse(t, "patching manifest annotations", resp, http.StatusCreated)
+	patched, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	checkErr(t, err, "parsing the digest of the patched manifest")
+	return patched
+}
+
+// checkTaggedAnnotations checks the manifest tagged latest in name is the
+// manifest dgst, with the given annotations.
+func checkTaggedAnnotations(t *testing.T, env *testEnv, name reference.Named, dgst digest.Digest, annotations map[string]string) {
+	t.Helper()
+
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	checkErr(t, err, "creating manifest request")
+	req.Header.Set("Accept", v1.MediaTypeImageManifest)
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{"Docker-Content-Digest": []string{dgst.String()}})
+
+	p, err := io.ReadAll(resp.Body)
+	checkErr(t, err, "reading manifest")
+	var m ocischema.DeserializedManifest
+	checkErr(t, m.UnmarshalJSON(p), "decoding manifest")
+	if !reflect.DeepEqual(m.Annotations, annotations) {
+		t.Fatalf("unexpected annotations %v, expected %v", m.Annotations, annotations)
+	}
+}
+
+func TestManifestPatchAnnotations(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/patch")
+	original := pushTransparencyManifest(t, env, name, `{"patch":true}`)
+
+	// Add annotations.
+	added := patchAnnotations(t, env, name, original, `{"annotations":{"org.example.a":"1","org.example.b":"2"}}`)
+	if added == original {
+		t.Fatal("expected the patched manifest to have a new digest")
+	}
+	checkTaggedAnnotations(t, env, name, added, map[string]string{"org.example.a": "1", "org.example.b": "2"})
+
+	// Update an annotation, leaving the others.
+	updated := patchAnnotations(t, env, name, added, `{"annotations":{"org.example.a":"3"}}`)
+	checkTaggedAnnotations(t, env, name, updated, map[string]string{"org.example.a": "3", "org.example.b": "2"})
+
+	// Delete an annotation with a null value.
+	deleted := patchAnnotations(t, env, name, updated, `{"annotations":{"org.example.b":null}}`)
+	checkTaggedAnnotations(t, env, name, deleted, map[string]string{"org.example.a": "3"})
+
+	// Deleting all annotations restores the original manifest.
+	restored := patchAnnotations(t, env, name, deleted, `{"annotations":null}`)
+	if restored != original {
+		t.Fatalf("expected the manifest without annotations to be the original manifest, got %s", restored)
+	}
+	checkTaggedAnnotations(t, env, name, original, nil)
+
+	// Manifests are only patched by digest.
+	tagRef, _ := reference.WithTag(name, "latest")
+	resp := patchManifest(t, env, tagRef, mediaTypeMergePatch, `{"annotations":{}}`)
+	defer resp.Body.Close()
+	checkResponse(t, "patching manifest by tag", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "patching manifest by tag", resp, v2.ErrorCodeDigestInvalid)
+
+	digestRef, _ := reference.WithDigest(name, original)
+	for _, tc := range []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"annotations":{}}`},
+		{mediaTypeMergePatch, `{"config":{}}`},
+		{mediaTypeMergePatch, `{"annotations":{"org.example.a":1}}`},
+		{mediaTypeMergePatch, `not json`},
+	} {
+		resp := patchManifest(t, env, digestRef, tc.contentType, tc.body)
+		defer resp.Body.Close()
+		checkResponse(t, "patching manifest with "+tc.body, resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "patching manifest with "+tc.body, resp, v2.ErrorCodeManifestInvalid)
+	}
+
+	unknownRef, _ := reference.WithDigest(name, digest.FromString("never pushed"))
+	resp = patchManifest(t, env, unknownRef, mediaTypeMergePatch, `{"annotations":{}}`)
+	defer resp.Body.Close()
+	checkResponse(t, "patching unknown manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "patching unknown manifest", resp, v2.ErrorCodeManifestUnknown)
+}
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/distribution/distribution/v3"
 	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/manifestlist"
 	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/manifest/schema1"
@@ -17,6 +21,7 @@ import (
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
@@ -30,6 +35,10 @@ const (
 	defaultOS           = "linux"
 	maxManifestBodySize = 4 << 20
 	imageClass          = "image"
+
+	// defaultServerPushMaxSize is the size of the largest blob pushed along
+	// with a manifest, when http.http2.serverpush.maxsize is not set.
+	defaultServerPushMaxSize = 1 << 20
 )
 
 type storageType int
@@ -65,6 +74,7 @@ func manifestDispatcher(ctx *Context, r *http.Request) http.Handler {
 
 	if !ctx.readOnly {
 		mhandler[http.MethodPut] = http.HandlerFunc(manifestHandler.PutManifest)
+		mhandler[http.MethodPatch] = http.HandlerFunc(manifestHandler.PatchManifest)
 		mhandler[http.MethodDelete] = http.HandlerFunc(manifestHandler.DeleteManifest)
 	}
 
@@ -132,7 +142,9 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		imh.Digest = desc.Digest
 	}
 
-	if etagMatch(r, imh.Digest.String()) {
+	// Manifest lists filtered by platform attributes have their own digest.
+	attributes := platformAttributes(r.URL.Query())
+	if len(attributes) == 0 && etagMatch(r, imh.Digest.String()) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
@@ -143,9 +155,12 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 	}
 	manifest, err := manifests.Get(imh, imh.Digest, options...)
 	if err != nil {
-		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+		switch err := err.(type) {
+		case distribution.ErrManifestUnknownRevision:
 			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
-		} else {
+		case distribution.ErrManifestDeleted:
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestDeleted.WithDetail(manifestDeletedDetail(err)))
+		default:
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
 		return
@@ -167,13 +182,56 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 	}
 
 	if manifestType == ociSchema && !supports[ociSchema] {
-		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("OCI manifest found, but accept header does not support OCI manifests"))
-		return
+		// As for schema1, only rewrite OCI manifests when they are being
+		// fetched by tag.
+		if imh.Tag == "" || !imh.App.Config.Compatibility.DowngradeOCIToSchema2 {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("OCI manifest found, but accept header does not support OCI manifests"))
+			return
+		}
+
+		// Rewrite manifest in schema2 format
+		dcontext.GetLogger(imh).Infof("rewriting manifest %s in schema2 format to support old client", imh.Digest.String())
+
+		schema2Manifest, err = ocischema.ConvertOCIToSchema2(manifest.(*ocischema.DeserializedManifest))
+		if err != nil {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("OCI manifest found, but accept header does not support OCI manifests").WithDetail(err.Error()))
+			return
+		}
+		_, p, err := schema2Manifest.Payload()
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		manifest = schema2Manifest
+		manifestType = manifestSchema2
+		imh.Digest = digest.FromBytes(p)
 	}
 	if manifestType == ociImageIndexSchema && !supports[ociImageIndexSchema] {
 		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("OCI index found, but accept header does not support OCI indexes"))
 		return
 	}
+	if isManifestList && len(attributes) > 0 {
+		manifestList, err = filterManifestList(manifestList, attributes)
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		if len(manifestList.Manifests) == 0 {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage("no manifest of the manifest list matches the platform attributes"))
+			return
+		}
+		_, p, err := manifestList.Payload()
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		manifest = manifestList
+		imh.Digest = digest.FromBytes(p)
+		if etagMatch(r, imh.Digest.String()) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
 	// Only rewrite schema2 manifests when they are being fetched by tag.
 	// If they are being fetched by digest, we can't return something not
 	// matching the digest.
@@ -185,26 +243,18 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			return
 		}
-	} else if imh.Tag != "" && manifestType == manifestlistSchema && !supports[manifestlistSchema] {
-		// Rewrite manifest in schema1 format
-		dcontext.GetLogger(imh).Infof("rewriting manifest list %s in schema1 format to support old client", imh.Digest.String())
+	} else if imh.Tag != "" && manifestType == manifestlistSchema && (!supports[manifestlistSchema] || isLegacyDockerClient(r.UserAgent())) {
+		// Return a single image manifest to clients which do not accept
+		// manifest lists, or fail on them
+		dcontext.GetLogger(imh).Infof("flattening manifest list %s to support old client", imh.Digest.String())
 
-		// Find the image manifest corresponding to the default
+		// Return the image manifest corresponding to the default
 		// platform
 		var manifestDigest digest.Digest
-		for _, manifestDescriptor := range manifestList.Manifests {
-			if manifestDescriptor.Platform.Architecture == defaultArch && manifestDescriptor.Platform.OS == defaultOS {
-				manifestDigest = manifestDescriptor.Digest
-				break
-			}
-		}
-
-		if manifestDigest == "" {
-			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown)
-			return
-		}
-
-		manifest, err = manifests.Get(imh, manifestDigest)
+		manifest, manifestDigest, err = imh.flattenManifestList(imh, manifests, manifestList, v1.Platform{
+			Architecture: defaultArch,
+			OS:           defaultOS,
+		})
 		if err != nil {
 			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
 				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
@@ -234,9 +284,174 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
 	w.Header().Set("Etag", fmt.Sprintf(`"%s"`, imh.Digest))
+	if imh.App.manifestContentDisposition != "" {
+		w.Header().Set("Content-Disposition", formatContentDisposition(imh.App.manifestContentDisposition, imh.Repository.Named().Name(), imh.Digest))
+	}
+	if r.Method == http.MethodGet && imh.App.Config.HTTP.HTTP2.ServerPush.Enabled {
+		// The blobs must be promised before the manifest referencing them
+		// is sent, lest the client requests them first.
+		imh.pushBlobs(w, r, manifest)
+	}
 	w.Write(p)
 }
 
+// pushBlobs pushes the config and the small layers of an image manifest to
+// http2 clients, which then need not request them. It does nothing for
+// clients which do not support server push.
+func (imh *manifestHandler) pushBlobs(w http.ResponseWriter, r *http.Request, manifest distribution.Manifest) {
+	pusher, ok := w.(http.Pusher)
+	if !ok {
+		return
+	}
+	switch manifest.(type) {
+	case *schema2.DeserializedManifest, *ocischema.DeserializedManifest:
+	default:
+		// The references of manifest lists are manifests.
+		return
+	}
+
+	maxSize := imh.App.Config.HTTP.HTTP2.ServerPush.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultServerPushMaxSize
+	}
+
+	// The pushed requests are authorized as the manifest request.
+	var header http.Header
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		header = http.Header{"Authorization": []string{authorization}}
+	}
+
+	for _, desc := range manifest.References() {
+		if desc.Size > maxSize || len(desc.URLs) > 0 {
+			continue
+		}
+
+		ref, err := reference.WithDigest(imh.Repository.Named(), desc.Digest)
+		if err != nil {
+			continue
+		}
+		blobURL, err := imh.urlBuilder.BuildBlobURL(ref)
+		if err != nil {
+			dcontext.GetLogger(imh).Errorf("error building blob url for push: %v", err)
+			return
+		}
+		u, err := url.Parse(blobURL)
+		if err != nil {
+			dcontext.GetLogger(imh).Errorf("error parsing blob url for push: %v", err)
+			return
+		}
+
+		if err := pusher.Push(u.RequestURI(), &http.PushOptions{Header: header}); err != nil {
+			if err != http.ErrNotSupported {
+				dcontext.GetLogger(imh).Debugf("error pushing blob %s: %v", desc.Digest, err)
+			}
+			return
+		}
+	}
+}
+
+// flattenManifestList returns the image manifest of ml matching platform,
+// along with its digest, for clients which do not understand manifest lists.
+// The variant of the platform is only matched when set.
+func (imh *manifestHandler) flattenManifestList(ctx context.Context, manifests distribution.ManifestService, ml *manifestlist.DeserializedManifestList, platform v1.Platform) (distribution.Manifest, digest.Digest, error) {
+	for _, desc := range ml.Manifests {
+		if desc.Platform.Architecture != platform.Architecture || desc.Platform.OS != platform.OS {
+			continue
+		}
+		if platform.Variant != "" && desc.Platform.Variant != platform.Variant {
+			continue
+		}
+
+		manifest, err := manifests.Get(ctx, desc.Digest)
+		if err != nil {
+			return nil, "", err
+		}
+		return manifest, desc.Digest, nil
+	}
+
+	return nil, "", distribution.ErrManifestUnknownRevision{
+		Name:     imh.Repository.Named().Name(),
+		Revision: imh.Digest,
+	}
+}
+
+// platformAttributeParameterPrefix prefixes the query parameters selecting the
+// manifests of manifest lists by the attributes of their platform.
+const platformAttributeParameterPrefix = "platform.attribute."
+
+// platformAttributes returns the platform attributes required by the
+// platform.attribute.<key>=<value> parameters of query.
+func platformAttributes(query url.Values) []manifest.PlatformAttribute {
+	var attributes []manifest.PlatformAttribute
+	for parameter, values := range query {
+		key := strings.TrimPrefix(parameter, platformAttributeParameterPrefix)
+		if key == parameter || key == "" {
+			continue
+		}
+		for _, value := range values {
+			attributes = append(attributes, manifest.PlatformAttribute{Key: key, Value: value})
+		}
+	}
+	return attributes
+}
+
+// filterManifestList returns the manifest list of the manifests of ml whose
+// platform has the required attributes.
+func filterManifestList(ml *manifestlist.DeserializedManifestList, required []manifest.PlatformAttribute) (*manifestlist.DeserializedManifestList, error) {
+	var descriptors []manifestlist.ManifestDescriptor
+	for _, desc := range ml.Manifests {
+		if manifest.MatchPlatformAttributes(desc.Platform.Attributes, required) {
+			descriptors = append(descriptors, desc)
+		}
+	}
+	mediaType, _, err := ml.Payload()
+	if err != nil {
+		return nil, err
+	}
+	return manifestlist.FromDescriptorsWithMediaType(descriptors, mediaType)
+}
+
+// manifestDeletedDetail returns the detail of the error returned for the
+// deleted manifest of err.
+func manifestDeletedDetail(err distribution.ErrManifestDeleted) map[string]interface{} {
+	detail := map[string]interface{}{
+		"digest":     err.Digest,
+		"deleted_at": err.DeletedAt,
+	}
+	if err.Reason != "" {
+		detail["reason"] = err.Reason
+	}
+	if err.ReplacedBy != "" {
+		detail["replaced_by"] = err.ReplacedBy
+	}
+	return detail
+}
+
+// isLegacyDockerClient reports whether userAgent is the one of a Docker
+// daemon older than 19.03, which fails on manifest lists even when they are
+// listed in its Accept header.
+func isLegacyDockerClient(userAgent string) bool {
+	for _, product := range strings.Fields(userAgent) {
+		version := strings.TrimPrefix(product, "docker/")
+		if version == product {
+			continue
+		}
+
+		majorStr, rest, _ := strings.Cut(version, ".")
+		minorStr, _, _ := strings.Cut(rest, ".")
+		major, err := strconv.Atoi(majorStr)
+		if err != nil {
+			return false
+		}
+		minor, err := strconv.Atoi(minorStr)
+		if err != nil {
+			return false
+		}
+		return major < 19 || (major == 19 && minor < 3)
+	}
+	return false
+}
+
 func (imh *manifestHandler) convertSchema2Manifest(schema2Manifest *schema2.DeserializedManifest) (distribution.Manifest, error) {
 	targetDescriptor := schema2Manifest.Target()
 	blobs := imh.Repository.Blobs(imh)
@@ -289,11 +504,6 @@ func etagMatch(r *http.Request, etag string) bool {
 // PutManifest validates and stores a manifest in the registry.
 func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request) {
 	dcontext.GetLogger(imh).Debug("PutImageManifest")
-	manifests, err := imh.Repository.Manifests(imh)
-	if err != nil {
-		imh.Errors = append(imh.Errors, err)
-		return
-	}
 
 	var jsonBuf bytes.Buffer
 	if err := copyFullPayload(imh, w, r, &jsonBuf, maxManifestBodySize, "image manifest PUT"); err != nil {
@@ -302,8 +512,27 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	mediaType := r.Header.Get("Content-Type")
-	manifest, desc, err := distribution.UnmarshalManifest(mediaType, jsonBuf.Bytes())
+	imh.putManifestPayload(w, r.Header.Get("Content-Type"), jsonBuf.Bytes())
+}
+
+// putManifestPayload unmarshals payload as a manifest of the given media type
+// and stores it in the repository, tagging it if a tag was requested.
+func (imh *manifestHandler) putManifestPayload(w http.ResponseWriter, mediaType string, payload []byte) {
+	if err := imh.applyNamingPolicy(); err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+
+	manifests, err := imh.Repository.Manifests(imh)
+	if err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+	if imh.App.validateManifestSchemas {
+		manifests = storage.NewValidatingManifestStore(manifests)
+	}
+
+	manifest, desc, err := distribution.UnmarshalManifest(mediaType, payload)
 	if err != nil {
 		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
 		return
@@ -340,55 +569,32 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err = manifests.Put(imh, manifest, options...)
-	if err != nil {
-		// TODO(stevvooe): These error handling switches really need to be
-		// handled by an app global mapper.
-		if err == distribution.ErrUnsupported {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnsupported)
-			return
-		}
-		if err == distribution.ErrAccessDenied {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeDenied)
+	// A locked tag would be refused after storing the manifest, which would
+	// then be left untagged.
+	if imh.Tag != "" {
+		if err := imh.checkTagLock(imh.Tag); err != nil {
+			imh.Errors = appendTagError(imh.Errors, err)
 			return
 		}
-		switch err := err.(type) {
-		case distribution.ErrManifestVerification:
-			for _, verificationError := range err {
-				switch verificationError := verificationError.(type) {
-				case distribution.ErrManifestBlobUnknown:
-					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestBlobUnknown.WithDetail(verificationError.Digest))
-				case distribution.ErrManifestNameInvalid:
-					imh.Errors = append(imh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
-				case distribution.ErrManifestUnverified:
-					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnverified)
-				default:
-					if verificationError == digest.ErrDigestInvalidFormat {
-						imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
-					} else {
-						imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown, verificationError)
-					}
-				}
-			}
-		case errcode.Error:
-			imh.Errors = append(imh.Errors, err)
-		default:
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
-		}
+	}
+
+	_, err = manifests.Put(imh, manifest, options...)
+	if err != nil {
+		imh.Errors = appendManifestPutError(imh.Errors, err)
 		return
 	}
 
 	// Tag this manifest
 	if imh.Tag != "" {
-		tags := imh.Repository.Tags(imh)
-		err = tags.Tag(imh, imh.Tag, desc)
-		if err != nil {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		if err := imh.tagManifest(imh.Repository.Tags(imh), imh.Tag, desc); err != nil {
+			imh.Errors = appendTagError(imh.Errors, err)
 			return
 		}
 
 	}
 
+	imh.recordTransparency(imh.Digest)
+
 	// Construct a canonical url for the uploaded manifest.
 	ref, err := reference.WithDigest(imh.Repository.Named(), imh.Digest)
 	if err != nil {
@@ -411,6 +617,142 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 	dcontext.GetLogger(imh).Debug("Succeeded in putting manifest!")
 }
 
+// tagManifest tags desc with tag, recording the authenticated user as the
+// actor. Locked tags are overwritten when the client is an administrator.
+func (imh *manifestHandler) tagManifest(tags distribution.TagService, tag string, desc distribution.Descriptor) error {
+	var opts []distribution.TagOption
+	if actor := dcontext.GetStringValue(imh, auth.UserNameKey); actor != "" {
+		opts = append(opts, distribution.WithActor(actor))
+	}
+	err := tags.Tag(imh, tag, desc, opts...)
+	if _, ok := err.(distribution.ErrTagLocked); ok && imh.App.isAdmin(imh.Context) {
+		err = tags.Tag(storage.WithTagLockBypass(imh), tag, desc, opts...)
+	}
+	return err
+}
+
+// checkTagLock returns ErrTagLocked if tag is locked, unless the client is an
+// administrator, who overwrites locked tags.
+func (imh *manifestHandler) checkTagLock(tag string) error {
+	if imh.App.caseInsensitiveTags {
+		tag = strings.ToLower(tag)
+	}
+	locked, err := storage.TagLocked(imh, imh.App.driver, imh.Repository.Named().Name(), tag)
+	if err != nil {
+		return err
+	}
+	if locked && !imh.App.isAdmin(imh.Context) {
+		return distribution.ErrTagLocked{Tag: tag}
+	}
+	return nil
+}
+
+// untagContext returns the context removing tags, which bypasses the tag locks
+// when the client is an administrator.
+func (imh *manifestHandler) untagContext() context.Context {
+	if imh.App.isAdmin(imh.Context) {
+		return storage.WithTagLockBypass(imh)
+	}
+	return imh
+}
+
+// appendTagError appends to errs the error reported for err, the error of
+// tagging a manifest.
+func appendTagError(errs errcode.Errors, err error) errcode.Errors {
+	switch err.(type) {
+	case distribution.ErrTagConflict, distribution.ErrTagCollision:
+		return append(errs, v2.ErrorCodeTagConflict.WithDetail(err))
+	case distribution.ErrTagLocked:
+		return append(errs, v2.ErrorCodeTagLocked.WithDetail(err))
+	case distribution.ErrTagInvalid:
+		return append(errs, v2.ErrorCodeTagInvalid.WithDetail(err))
+	default:
+		return append(errs, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
+
+// recordTransparency records the manifest dgst in the transparency log, if
+// enabled. The push succeeds even if the log is unavailable.
+func (imh *manifestHandler) recordTransparency(dgst digest.Digest) {
+	if imh.App.transparency == nil {
+		return
+	}
+	if err := imh.App.transparency.record(imh, imh.App.driver, imh.Repository.Named().Name(), dgst); err != nil {
+		dcontext.GetLogger(imh).Errorf("error recording manifest %s in the transparency log: %v", dgst, err)
+	}
+}
+
+// validateManifestSchema checks that manifest complies with the constraints
+// of its schema, if enabled.
+func (imh *manifestHandler) validateManifestSchema(manifest distribution.Manifest) error {
+	if !imh.App.validateManifestSchemas {
+		return nil
+	}
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return err
+	}
+	return storage.ValidateManifestPayload(mediaType, payload)
+}
+
+// appendManifestPutError appends to errs the errors reported for err, the
+// error of storing or validating a manifest.
+func appendManifestPutError(errs errcode.Errors, err error) errcode.Errors {
+	// TODO(stevvooe): These error handling switches really need to be
+	// handled by an app global mapper.
+	if err == distribution.ErrUnsupported {
+		return append(errs, errcode.ErrorCodeUnsupported)
+	}
+	if err == distribution.ErrAccessDenied {
+		return append(errs, errcode.ErrorCodeDenied)
+	}
+	switch err := err.(type) {
+	case distribution.ErrManifestInvalid:
+		errs = append(errs, v2.ErrorCodeManifestInvalid.WithDetail(err.Reason))
+	case distribution.ErrManifestVerification:
+		for _, verificationError := range err {
+			switch verificationError := verificationError.(type) {
+			case distribution.ErrManifestBlobUnknown:
+				errs = append(errs, v2.ErrorCodeManifestBlobUnknown.WithDetail(verificationError.Digest))
+			case distribution.ErrManifestNameInvalid:
+				errs = append(errs, v2.ErrorCodeNameInvalid.WithDetail(err))
+			case distribution.ErrManifestUnverified:
+				errs = append(errs, v2.ErrorCodeManifestUnverified)
+			default:
+				if verificationError == digest.ErrDigestInvalidFormat {
+					errs = append(errs, v2.ErrorCodeDigestInvalid)
+				} else {
+					errs = append(errs, errcode.ErrorCodeUnknown, verificationError)
+				}
+			}
+		}
+	case errcode.Error:
+		errs = append(errs, err)
+	default:
+		errs = append(errs, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+	return errs
+}
+
+// applyNamingPolicy checks whether the name of the repository matches the
+// naming pattern of the policy configuration. It is only applied to pushes,
+// such that the repositories named before the pattern was configured remain
+// pullable.
+func (imh *manifestHandler) applyNamingPolicy() error {
+	if imh.App.namingPattern == nil {
+		return nil
+	}
+	name := imh.Repository.Named().Name()
+	if imh.App.namingPattern.MatchString(name) {
+		return nil
+	}
+
+	if message := imh.App.Config.Policy.Repository.NamingPolicy.DenyMessage; message != "" {
+		return v2.ErrorCodeNameInvalid.WithMessage(message).WithDetail(map[string]string{"name": name})
+	}
+	return v2.ErrorCodeNameInvalid.WithDetail(fmt.Sprintf("repository name %q does not match the naming pattern %q", name, imh.App.namingPattern))
+}
+
 // applyResourcePolicy checks whether the resource class matches what has
 // been authorized and allowed by the policy configuration.
 func (imh *manifestHandler) applyResourcePolicy(manifest distribution.Manifest) error {
@@ -493,10 +835,12 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 	if imh.Tag != "" {
 		dcontext.GetLogger(imh).Debug("DeleteImageTag")
 		tagService := imh.Repository.Tags(imh.Context)
-		if err := tagService.Untag(imh.Context, imh.Tag); err != nil {
+		if err := tagService.Untag(imh.untagContext(), imh.Tag); err != nil {
 			switch err.(type) {
 			case distribution.ErrTagUnknown, driver.PathNotFoundError:
 				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			case distribution.ErrTagLocked:
+				imh.Errors = append(imh.Errors, v2.ErrorCodeTagLocked.WithDetail(err))
 			default:
 				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			}
@@ -512,7 +856,33 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = manifests.Delete(imh, imh.Digest)
+	// The manifest is kept while any of its tags is locked, which would
+	// otherwise be left pointing to it.
+	tagService := imh.Repository.Tags(imh)
+	referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
+	if err != nil {
+		imh.Errors = append(imh.Errors, err)
+		return
+	}
+	for _, tag := range referencedTags {
+		if err := imh.checkTagLock(tag); err != nil {
+			imh.Errors = appendTagError(imh.Errors, err)
+			return
+		}
+	}
+
+	// The reason of the deletion and the manifest replacing the deleted
+	// one are recorded in its tombstone, if tombstones are enabled.
+	var replacedBy digest.Digest
+	if v := r.URL.Query().Get("replaced_by"); v != "" {
+		if replacedBy, err = digest.Parse(v); err != nil {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+			return
+		}
+	}
+	ctx := storage.WithTombstone(imh, r.URL.Query().Get("reason"), replacedBy)
+
+	err = manifests.Delete(ctx, imh.Digest)
 	if err != nil {
 		switch err {
 		case digest.ErrDigestUnsupported:
@@ -531,15 +901,8 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	tagService := imh.Repository.Tags(imh)
-	referencedTags, err := tagService.Lookup(imh, distribution.Descriptor{Digest: imh.Digest})
-	if err != nil {
-		imh.Errors = append(imh.Errors, err)
-		return
-	}
-
 	for _, tag := range referencedTags {
-		if err := tagService.Untag(imh, tag); err != nil {
+		if err := tagService.Untag(imh.untagContext(), tag); err != nil {
 			imh.Errors = append(imh.Errors, err)
 			return
 		}
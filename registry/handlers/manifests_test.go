@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/reference"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestIsLegacyDockerClient(t *testing.T) {
+	for _, tc := range []struct {
+		userAgent string
+		legacy    bool
+	}{
+		{"docker/1.13.1 go/go1.7.5 git-commit/092cba3 kernel/4.9.0 os/linux arch/amd64", true},
+		{"docker/17.03.2-ce go/go1.7.5 git-commit/f5ec1e2 kernel/4.4.0 os/linux arch/amd64", true},
+		{"docker/18.09.7 go/go1.10.8 git-commit/2d0083d kernel/4.19.76 os/linux arch/amd64 UpstreamClient(Docker-Client/18.09.7 \\(linux\\))", true},
+		{"docker/19.03.0 go/go1.12.5 git-commit/aeac949 kernel/5.0.0 os/linux arch/amd64", false},
+		{"docker/20.10.21 go/go1.18.7 git-commit/3056208 kernel/5.15.0 os/linux arch/amd64", false},
+		{"containerd/1.6.8", false},
+		{"Go-http-client/1.1", false},
+		{"", false},
+		{"docker/unknown", false},
+	} {
+		if legacy := isLegacyDockerClient(tc.userAgent); legacy != tc.legacy {
+			t.Errorf("isLegacyDockerClient(%q) = %t, expected %t", tc.userAgent, legacy, tc.legacy)
+		}
+	}
+}
+
+func TestManifestServerPush(t *testing.T) {
+	ctx := context.Background()
+	config := &configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.HTTP2.ServerPush.Enabled = true
+	config.HTTP.HTTP2.ServerPush.MaxSize = 1024
+	app := NewApp(ctx, config)
+
+	// Store an image with a small and a large layer.
+	named, err := reference.WithName("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := app.registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repo.Blobs(ctx)
+	var descs []distribution.Descriptor
+	for _, blob := range []struct {
+		mediaType string
+		content   []byte
+	}{
+		{schema2.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`)},
+		{schema2.MediaTypeLayer, bytes.Repeat([]byte("a"), 512)},
+		{schema2.MediaTypeLayer, bytes.Repeat([]byte("b"), 4096)},
+	} {
+		desc, err := blobs.Put(ctx, blob.mediaType, blob.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		descs = append(descs, desc)
+	}
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: manifest.Versioned{SchemaVersion: 2, MediaType: schema2.MediaTypeManifest},
+		Config:    descs[0],
+		Layers:    descs[1:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := ms.Put(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(app)
+	if err := http2.ConfigureServer(server.Config, &http2.Server{}); err != nil {
+		t.Fatal(err)
+	}
+	server.TLS = server.Config.TLSConfig
+	server.StartTLS()
+	defer server.Close()
+
+	t.Run("push", func(t *testing.T) {
+		promised := fetchPromised(t, server.Listener.Addr().String(), "/v2/foo/bar/manifests/latest")
+		expected := []string{
+			"/v2/foo/bar/blobs/" + descs[0].Digest.String(),
+			"/v2/foo/bar/blobs/" + descs[1].Digest.String(),
+		}
+		sort.Strings(expected)
+		sort.Strings(promised)
+		if len(promised) != len(expected) || promised[0] != expected[0] || promised[1] != expected[1] {
+			t.Fatalf("expected the config and the small layer to be pushed, got %v", promised)
+		}
+	})
+
+	// Clients which do not accept pushes are served the manifest alone.
+	insecure := &tls.Config{InsecureSkipVerify: true}
+	for name, transport := range map[string]http.RoundTripper{
+		"http/1.1":            &http.Transport{TLSClientConfig: insecure},
+		"http2 push disabled": &http2.Transport{TLSClientConfig: insecure},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/foo/bar/manifests/latest", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", schema2.MediaTypeManifest)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected status fetching manifest: %s", resp.Status)
+			}
+			_, payload, _ := m.Payload()
+			if body, err := io.ReadAll(resp.Body); err != nil || !bytes.Equal(body, payload) {
+				t.Fatalf("unexpected manifest %q: %v", body, err)
+			}
+		})
+	}
+}
+
+// fetchPromised fetches the manifest at path over http2 from a client
+// accepting pushes, and returns the paths promised by the server.
+func fetchPromised(t *testing.T, addr, path string) []string {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{http2.NextProtoTLS}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: http.MethodGet},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: addr},
+		{Name: ":path", Value: path},
+		{Name: "accept", Value: schema2.MediaTypeManifest},
+	} {
+		if err := encoder.WriteField(field); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// All the header blocks must be decoded, in order, to keep the state
+	// of the decoder.
+	decoder := hpack.NewDecoder(4096, nil)
+	var promised []string
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				if err := framer.WriteSettingsAck(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case *http2.PushPromiseFrame:
+			fields, err := decoder.DecodeFull(f.HeaderBlockFragment())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range fields {
+				if field.Name == ":path" {
+					promised = append(promised, field.Value)
+				}
+			}
+		case *http2.HeadersFrame:
+			fields, err := decoder.DecodeFull(f.HeaderBlockFragment())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range fields {
+				if f.StreamID == 1 && field.Name == ":status" && field.Value != "200" {
+					t.Fatalf("unexpected status fetching manifest: %s", field.Value)
+				}
+			}
+		case *http2.DataFrame:
+			if f.StreamID == 1 && f.StreamEnded() {
+				return promised
+			}
+		case *http2.GoAwayFrame:
+			t.Fatalf("connection closed by server: %v", f.ErrCode)
+		}
+	}
+}
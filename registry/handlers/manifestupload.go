@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// manifestUploadDispatcher constructs and returns the manifest upload handler
+// for the given request context.
+func manifestUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
+	muh := &manifestUploadHandler{
+		Context: ctx,
+		UUID:    getUploadUUID(ctx),
+		Uploads: storage.NewManifestUploadStore(ctx.App.driver, ctx.Repository.Named(), maxManifestBodySize),
+	}
+
+	handler := handlers.MethodHandler{}
+
+	if !ctx.readOnly {
+		handler[http.MethodPost] = http.HandlerFunc(muh.StartManifestUpload)
+		handler[http.MethodPatch] = http.HandlerFunc(muh.PatchManifestData)
+		handler[http.MethodPut] = http.HandlerFunc(muh.PutManifestUploadComplete)
+		handler[http.MethodDelete] = http.HandlerFunc(muh.CancelManifestUpload)
+	}
+
+	return handler
+}
+
+// manifestUploadHandler handles resumable manifest pushes, where the payload
+// is sent over several requests before being stored as a regular manifest.
+type manifestUploadHandler struct {
+	*Context
+
+	// UUID identifies the upload session for the current request.
+	UUID string
+
+	Uploads *storage.ManifestUploadStore
+}
+
+// StartManifestUpload allocates a new manifest upload session.
+func (muh *manifestUploadHandler) StartManifestUpload(w http.ResponseWriter, r *http.Request) {
+	if muh.App.isCache {
+		muh.Errors = append(muh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	id, err := muh.Uploads.Create(muh)
+	if err != nil {
+		muh.Errors = append(muh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	location, err := muh.urlBuilder.BuildManifestUploadChunkURL(muh.Repository.Named(), id)
+	if err != nil {
+		muh.Errors = append(muh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Length", "0")
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// PatchManifestData appends the request body to the upload session.
+func (muh *manifestUploadHandler) PatchManifestData(w http.ResponseWriter, r *http.Request) {
+	size, err := muh.Uploads.Append(muh, muh.UUID, r.Body)
+	if err != nil {
+		muh.appendUploadError(err)
+		return
+	}
+
+	location, err := muh.urlBuilder.BuildManifestUploadChunkURL(muh.Repository.Named(), muh.UUID)
+	if err != nil {
+		muh.Errors = append(muh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	endRange := size
+	if endRange > 0 {
+		endRange = endRange - 1
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", endRange))
+	w.Header().Set("Content-Length", "0")
+	w.Header().Set("Docker-Upload-UUID", muh.UUID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// PutManifestUploadComplete verifies the accumulated payload against the
+// digest parameter and stores it in the repository's manifest store. The
+// upload session is removed once the manifest has been stored.
+func (muh *manifestUploadHandler) PutManifestUploadComplete(w http.ResponseWriter, r *http.Request) {
+	dgstStr := r.FormValue("digest")
+	if dgstStr == "" {
+		muh.Errors = append(muh.Errors, v2.ErrorCodeDigestInvalid.WithDetail("digest missing"))
+		return
+	}
+
+	dgst, err := digest.Parse(dgstStr)
+	if err != nil {
+		muh.Errors = append(muh.Errors, v2.ErrorCodeDigestInvalid.WithDetail("digest parsing failed"))
+		return
+	}
+
+	payload, err := muh.Uploads.Payload(muh, muh.UUID, dgst)
+	if err != nil {
+		muh.appendUploadError(err)
+		return
+	}
+
+	imh := &manifestHandler{
+		Context: muh.Context,
+		Tag:     r.FormValue("tag"),
+		Digest:  dgst,
+	}
+	imh.putManifestPayload(w, r.Header.Get("Content-Type"), payload)
+	if len(muh.Errors) > 0 {
+		return
+	}
+
+	if err := muh.Uploads.Cancel(muh, muh.UUID); err != nil {
+		dcontext.GetLogger(muh).Errorf("error removing committed manifest upload %s: %v", muh.UUID, err)
+	}
+}
+
+// CancelManifestUpload discards the upload session and any data received.
+func (muh *manifestUploadHandler) CancelManifestUpload(w http.ResponseWriter, r *http.Request) {
+	if err := muh.Uploads.Cancel(muh, muh.UUID); err != nil {
+		muh.appendUploadError(err)
+		return
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (muh *manifestUploadHandler) appendUploadError(err error) {
+	switch err {
+	case storage.ErrManifestUploadUnknown:
+		muh.Errors = append(muh.Errors, v2.ErrorCodeManifestUploadUnknown.WithDetail(err))
+	case storage.ErrManifestUploadTooLarge:
+		muh.Errors = append(muh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err))
+	case storage.ErrManifestUploadDigestMismatch:
+		muh.Errors = append(muh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+	default:
+		muh.Errors = append(muh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+	}
+}
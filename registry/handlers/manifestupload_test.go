@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/reference"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+)
+
+func startManifestUpload(t *testing.T, env *testEnv, name reference.Named) string {
+	t.Helper()
+
+	uploadURL, err := env.builder.BuildManifestUploadURL(name)
+	checkErr(t, err, "building manifest upload url")
+
+	resp, err := http.Post(uploadURL, "", nil)
+	checkErr(t, err, "starting manifest upload")
+	defer resp.Body.Close()
+	checkResponse(t, "starting manifest upload", resp, http.StatusAccepted)
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		t.Fatal("manifest upload did not return a location")
+	}
+	return location
+}
+
+func doManifestUploadRequest(t *testing.T, method, location string, contentType string, body []byte) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, location, bytes.NewReader(body))
+	checkErr(t, err, "creating manifest upload request")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "sending manifest upload request")
+	return resp
+}
+
+func TestManifestUploadAPI(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/multiarch")
+	args := testManifestAPISchema2(t, env, imageName)
+
+	// Build a large manifest list, with an entry per platform variant.
+	var descriptors []manifestlist.ManifestDescriptor
+	for i := 0; i < 150; i++ {
+		descriptors = append(descriptors, manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{
+				Digest:    args.dgst,
+				MediaType: schema2.MediaTypeManifest,
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: "amd64",
+				OS:           "linux",
+				Variant:      fmt.Sprintf("v%d", i),
+			},
+		})
+	}
+	list, err := manifestlist.FromDescriptors(descriptors)
+	checkErr(t, err, "creating manifest list")
+	_, payload, err := list.Payload()
+	checkErr(t, err, "getting manifest list payload")
+	dgst := digest.FromBytes(payload)
+
+	location := startManifestUpload(t, env, imageName)
+
+	// Push the payload in three chunks.
+	chunkSize := len(payload)/3 + 1
+	for offset := 0; offset < len(payload); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		resp := doManifestUploadRequest(t, http.MethodPatch, location, "", payload[offset:end])
+		resp.Body.Close()
+		checkResponse(t, "patching manifest upload", resp, http.StatusAccepted)
+		checkHeaders(t, resp, http.Header{
+			"Range": []string{fmt.Sprintf("0-%d", end-1)},
+		})
+		location = resp.Header.Get("Location")
+	}
+
+	// Committing with the wrong digest leaves the upload in place.
+	u, err := url.Parse(location)
+	checkErr(t, err, "parsing upload location")
+	u.RawQuery = url.Values{"digest": []string{digest.FromString("wrong").String()}}.Encode()
+	resp := doManifestUploadRequest(t, http.MethodPut, u.String(), manifestlist.MediaTypeManifestList, nil)
+	checkResponse(t, "committing manifest upload with wrong digest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "committing manifest upload with wrong digest", resp, v2.ErrorCodeDigestInvalid)
+	resp.Body.Close()
+
+	u.RawQuery = url.Values{"digest": []string{dgst.String()}, "tag": []string{"latest"}}.Encode()
+	resp = doManifestUploadRequest(t, http.MethodPut, u.String(), manifestlist.MediaTypeManifestList, nil)
+	resp.Body.Close()
+	checkResponse(t, "committing manifest upload", resp, http.StatusCreated)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+
+	// The manifest is available through the regular manifest API.
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	checkErr(t, err, "creating manifest request")
+	req.Header.Set("Accept", manifestlist.MediaTypeManifestList)
+	resp, err = http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+	body, err := io.ReadAll(resp.Body)
+	checkErr(t, err, "reading manifest")
+	if !bytes.Equal(body, payload) {
+		t.Fatal("fetched manifest does not match uploaded payload")
+	}
+
+	// The upload session is removed once committed.
+	resp = doManifestUploadRequest(t, http.MethodPatch, location, "", payload)
+	checkResponse(t, "patching committed manifest upload", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "patching committed manifest upload", resp, v2.ErrorCodeManifestUploadUnknown)
+	resp.Body.Close()
+}
+
+func TestManifestUploadCancel(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bar")
+	location := startManifestUpload(t, env, imageName)
+
+	resp := doManifestUploadRequest(t, http.MethodPatch, location, "", []byte(`{"schemaVersion":`))
+	resp.Body.Close()
+	checkResponse(t, "patching manifest upload", resp, http.StatusAccepted)
+
+	resp = doManifestUploadRequest(t, http.MethodDelete, location, "", nil)
+	resp.Body.Close()
+	checkResponse(t, "cancelling manifest upload", resp, http.StatusNoContent)
+
+	resp = doManifestUploadRequest(t, http.MethodDelete, location, "", nil)
+	checkResponse(t, "cancelling cancelled manifest upload", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "cancelling cancelled manifest upload", resp, v2.ErrorCodeManifestUploadUnknown)
+	resp.Body.Close()
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// manifestValidateDispatcher constructs and returns the manifest validation
+// handler for the given request context.
+func manifestValidateDispatcher(ctx *Context, r *http.Request) http.Handler {
+	imh := &manifestHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodPost: http.HandlerFunc(imh.ValidateManifest),
+	}
+}
+
+// manifestValidation is the result of the validation of a manifest.
+type manifestValidation struct {
+	Valid  bool            `json:"valid"`
+	Errors json.RawMessage `json:"errors,omitempty"`
+}
+
+// ValidateManifest runs the validators of the registry on the manifest in
+// the request body, as PutManifest does, without storing it. The errors
+// the manifest would be rejected with are returned in the body rather than
+// as the errors of the request.
+func (imh *manifestHandler) ValidateManifest(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(imh).Debug("ValidateManifest")
+
+	var jsonBuf bytes.Buffer
+	if err := copyFullPayload(imh, w, r, &jsonBuf, maxManifestBodySize, "image manifest validation"); err != nil {
+		// copyFullPayload reports the error if necessary
+		imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(err.Error()))
+		return
+	}
+
+	var errs errcode.Errors
+	manifest, _, err := distribution.UnmarshalManifest(r.Header.Get("Content-Type"), jsonBuf.Bytes())
+	if err != nil {
+		errs = append(errs, v2.ErrorCodeManifestInvalid.WithDetail(err))
+	} else if err := imh.applyResourcePolicy(manifest); err != nil {
+		errs = append(errs, err)
+	} else if err := imh.validateManifestSchema(manifest); err != nil {
+		errs = appendManifestPutError(errs, err)
+	} else {
+		// Validate against the repository of the storage, as the repository
+		// of the request may be decorated without giving access to it.
+		repo, err := imh.App.registry.Repository(imh, imh.Repository.Named())
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		if err := storage.ValidateManifest(imh, repo, manifest); err != nil {
+			if err == distribution.ErrUnsupported {
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnsupported)
+				return
+			}
+			errs = appendManifestPutError(errs, err)
+		}
+	}
+
+	result := manifestValidation{
+		Valid: len(errs) == 0,
+	}
+	if len(errs) > 0 {
+		// Encode the errors as in the responses of failed requests.
+		p, err := json.Marshal(errs)
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		var encoded struct {
+			Errors json.RawMessage `json:"errors"`
+		}
+		if err := json.Unmarshal(p, &encoded); err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		result.Errors = encoded.Errors
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		dcontext.GetLogger(imh).Errorf("error encoding manifest validation: %v", err)
+	}
+}
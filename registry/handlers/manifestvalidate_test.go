@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func validateManifest(t *testing.T, env *testEnv, name reference.Named, contentType string, payload []byte) manifestValidation {
+	t.Helper()
+
+	validateURL, err := env.builder.BuildManifestValidateURL(name)
+	checkErr(t, err, "building manifest validation url")
+
+	resp := doManifestUploadRequest(t, http.MethodPost, validateURL, contentType, payload)
+	defer resp.Body.Close()
+	checkResponse(t, "validating manifest", resp, http.StatusOK)
+
+	var result manifestValidation
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("unexpected error decoding manifest validation: %v", err)
+	}
+	return result
+}
+
+func checkValidationErrorCodes(t *testing.T, result manifestValidation, errorCodes ...errcode.ErrorCode) {
+	t.Helper()
+
+	if result.Valid {
+		t.Fatal("expected the manifest to be invalid")
+	}
+	var errs []errcode.Error
+	if err := json.Unmarshal(result.Errors, &errs); err != nil {
+		t.Fatalf("unexpected error decoding validation errors: %v", err)
+	}
+	if len(errs) == 0 {
+		t.Fatal("expected validation errors")
+	}
+	expected := make(map[string]bool)
+	for _, code := range errorCodes {
+		expected[code.String()] = true
+	}
+	for _, e := range errs {
+		if !expected[e.Code.String()] {
+			t.Fatalf("unexpected validation error %v, expected %v", e, errorCodes)
+		}
+	}
+}
+
+func TestManifestValidateAPI(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/validate")
+	args := testManifestAPISchema2(t, env, imageName)
+	pushed := args.manifest.(*schema2.DeserializedManifest)
+
+	// A manifest of the blobs of the repository, distinct from the one pushed.
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    pushed.Config,
+		Layers:    pushed.Layers[:1],
+	})
+	checkErr(t, err, "creating manifest")
+	_, payload, err := m.Payload()
+	checkErr(t, err, "getting manifest payload")
+
+	result := validateManifest(t, env, imageName, schema2.MediaTypeManifest, payload)
+	if !result.Valid || len(result.Errors) != 0 {
+		t.Fatalf("expected the manifest to be valid, got %s", result.Errors)
+	}
+
+	// The validated manifest is not stored.
+	digestRef, _ := reference.WithDigest(imageName, digest.FromBytes(payload))
+	manifestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+	resp, err := http.Get(manifestURL)
+	checkErr(t, err, "fetching validated manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching validated manifest", resp, http.StatusNotFound)
+
+	// A manifest referencing unknown blobs is invalid.
+	m, err = schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    pushed.Config,
+		Layers: []distribution.Descriptor{{
+			MediaType: schema2.MediaTypeLayer,
+			Digest:    digest.FromString("unknown layer"),
+			Size:      13,
+		}},
+	})
+	checkErr(t, err, "creating manifest")
+	_, payload, err = m.Payload()
+	checkErr(t, err, "getting manifest payload")
+	result = validateManifest(t, env, imageName, schema2.MediaTypeManifest, payload)
+	checkValidationErrorCodes(t, result, v2.ErrorCodeManifestBlobUnknown)
+
+	// A payload which is not a manifest is invalid.
+	result = validateManifest(t, env, imageName, schema2.MediaTypeManifest, []byte("not a manifest"))
+	checkValidationErrorCodes(t, result, v2.ErrorCodeManifestInvalid)
+}
+
+func TestManifestSchemaValidation(t *testing.T) {
+	// The config has the media type of OCI configs, and the layer none.
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    digest.FromString("config"),
+			Size:      6,
+		},
+		Layers: []distribution.Descriptor{{
+			Digest: digest.FromString("layer"),
+			Size:   5,
+		}},
+	})
+	checkErr(t, err, "creating manifest")
+	_, payload, err := m.Payload()
+	checkErr(t, err, "getting manifest payload")
+	imageName, _ := reference.WithName("foo/schema")
+	tagRef, _ := reference.WithTag(imageName, "latest")
+
+	for _, enabled := range []bool{false, true} {
+		config := configuration.Configuration{
+			Storage: configuration.Storage{
+				"testdriver": configuration.Parameters{},
+				"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+					"enabled": false,
+				}},
+			},
+		}
+		config.HTTP.Headers = headerConfig
+		config.Validation.Manifests.Enabled = enabled
+		env := newTestEnvWithConfig(t, &config)
+
+		// Without schema validation, the manifest is only rejected for
+		// its unknown blobs.
+		errorCode := v2.ErrorCodeManifestBlobUnknown
+		if enabled {
+			errorCode = v2.ErrorCodeManifestInvalid
+		}
+
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+		resp := doManifestUploadRequest(t, http.MethodPut, manifestURL, schema2.MediaTypeManifest, payload)
+		checkResponse(t, "putting invalid manifest", resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "putting invalid manifest", resp, errorCode)
+		resp.Body.Close()
+
+		result := validateManifest(t, env, imageName, schema2.MediaTypeManifest, payload)
+		checkValidationErrorCodes(t, result, errorCode)
+
+		env.Shutdown()
+	}
+}
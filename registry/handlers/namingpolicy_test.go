@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const testNamingPattern = "^[a-z][a-z0-9-]+/[a-z][a-z0-9-]+$"
+
+func newNamingPolicyTestEnv(t *testing.T, denyMessage string) *testEnv {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Policy.Repository.NamingPolicy.Pattern = testNamingPattern
+	config.Policy.Repository.NamingPolicy.DenyMessage = denyMessage
+	return newTestEnvWithConfig(t, &config)
+}
+
+// emptyConfigDescriptor pushes an empty image config to the repository
+// name, and returns its descriptor.
+func emptyConfigDescriptor(t *testing.T, env *testEnv, name reference.Named) distribution.Descriptor {
+	config := []byte("{}")
+	desc := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+	}
+	uploadURLBase, _ := startPushLayer(t, env, name)
+	pushLayer(t, env.builder, name, desc.Digest, uploadURLBase, bytes.NewReader(config))
+	return desc
+}
+
+// putNamingPolicyManifest pushes a manifest without layers to the tag latest
+// of the repository name.
+func putNamingPolicyManifest(t *testing.T, env *testEnv, name reference.Named) *http.Response {
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    emptyConfigDescriptor(t, env, name),
+	})
+	checkErr(t, err, "creating manifest")
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	return putManifest(t, "putting manifest", manifestURL, v1.MediaTypeImageManifest, m)
+}
+
+func TestNamingPolicy(t *testing.T) {
+	env := newNamingPolicyTestEnv(t, "")
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("team/project")
+	resp := putNamingPolicyManifest(t, env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest to a matching repository", resp, http.StatusCreated)
+
+	for _, repo := range []string{"team/project/v1", "Team/project", "project"} {
+		name, _ := reference.WithName(repo)
+		resp := putNamingPolicyManifest(t, env, name)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest to "+repo, resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "putting manifest to "+repo, resp, v2.ErrorCodeNameInvalid)
+	}
+}
+
+func TestNamingPolicyDenyMessage(t *testing.T) {
+	const denyMessage = "repositories are named <team>/<project>"
+	env := newNamingPolicyTestEnv(t, denyMessage)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("team/project/v1")
+	resp := putNamingPolicyManifest(t, env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest to a non matching repository", resp, http.StatusBadRequest)
+
+	var errs errcode.Errors
+	if err := json.NewDecoder(resp.Body).Decode(&errs); err != nil {
+		t.Fatalf("error decoding error response: %v", err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected a single error, got %v", errs)
+	}
+	if err, ok := errs[0].(errcode.Error); !ok || err.Code != v2.ErrorCodeNameInvalid || err.Message != denyMessage {
+		t.Fatalf("unexpected error: %#v", errs[0])
+	}
+}
+
+func TestNamingPolicyExistingRepositoryPullable(t *testing.T) {
+	env := newNamingPolicyTestEnv(t, "")
+	defer env.Shutdown()
+
+	// The repository is pushed to before the pattern is configured.
+	pattern := env.app.namingPattern
+	env.app.namingPattern = nil
+	name, _ := reference.WithName("legacy/project/v1")
+	resp := putNamingPolicyManifest(t, env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest without naming policy", resp, http.StatusCreated)
+	env.app.namingPattern = pattern
+
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp = getManifestAccepting(t, manifestURL, v1.MediaTypeImageManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest of a non matching repository", resp, http.StatusOK)
+
+	resp = putNamingPolicyManifest(t, env, name)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest to a non matching repository", resp, http.StatusBadRequest)
+}
+
+func TestNamingPolicyInvalidPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic configuring an invalid naming pattern")
+		}
+	}()
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+		},
+	}
+	config.Policy.Repository.NamingPolicy.Pattern = "[a-z"
+	env := newTestEnvWithConfig(t, &config)
+	env.Shutdown()
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter limits the rate of the requests to the registry with a token
+// bucket per category of endpoints, shared by all the clients. The buckets of
+// the categories without a limit are nil.
+type rateLimiter struct {
+	push    *rate.Limiter
+	pull    *rate.Limiter
+	catalog *rate.Limiter
+}
+
+// newRateLimiter returns the rate limiter configured by config.
+func newRateLimiter(config configuration.RateLimit) *rateLimiter {
+	return &rateLimiter{
+		push:    newTokenBucket(config.Push),
+		pull:    newTokenBucket(config.Pull),
+		catalog: newTokenBucket(config.Catalog),
+	}
+}
+
+// newTokenBucket returns the token bucket configured by config, or nil if it
+// places no limit.
+func newTokenBucket(config configuration.RateLimitBucket) *rate.Limiter {
+	if config.RPS <= 0 {
+		return nil
+	}
+	burst := config.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(config.RPS))
+	}
+	return rate.NewLimiter(rate.Limit(config.RPS), burst)
+}
+
+// bucket returns the token bucket of the requests of method to the route, or
+// nil if they are not limited.
+func (rl *rateLimiter) bucket(routeName, method string) *rate.Limiter {
+	switch routeName {
+	case v2.RouteNameBase, v2.RouteNameHPAMetrics:
+		return nil
+	case v2.RouteNameCatalog:
+		return rl.catalog
+	case v2.RouteNameBlobBatch:
+		// Checking the existence of blobs only reads them.
+		return rl.pull
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return rl.pull
+	}
+	return rl.push
+}
+
+// limit wraps handler so that the requests to the route exceeding the rate of
+// their category are rejected with 429 Too Many Requests, and a Retry-After
+// header telling when the next request would be accepted.
+func (rl *rateLimiter) limit(routeName string, handler http.Handler) http.Handler {
+	if rl == nil || (rl.push == nil && rl.pull == nil && rl.catalog == nil) {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := rl.bucket(routeName, r.Method)
+		if bucket == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		allowed := bucket.AllowN(now, 1)
+		tokens := bucket.TokensAt(now)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(bucket.Burst()))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+		if !allowed {
+			wait := time.Duration((1 - tokens) / float64(bucket.Limit()) * float64(time.Second))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			dcontext.GetLogger(r.Context()).Warnf("rate limit of %s requests exceeded", routeName)
+			if err := errcode.ServeJSON(w, errcode.ErrorCodeTooManyRequests); err != nil {
+				dcontext.GetLogger(r.Context()).Errorf("error serving error json: %v", err)
+			}
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+)
+
+func TestRateLimit(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.RateLimit.Pull = configuration.RateLimitBucket{RPS: 0.01, Burst: 2}
+	config.HTTP.RateLimit.Catalog = configuration.RateLimitBucket{RPS: 0.01}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/ratelimit")
+	tagsURL, err := env.builder.BuildTagsURL(name)
+	checkErr(t, err, "building tags url")
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(tagsURL)
+		checkErr(t, err, "listing tags")
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			t.Fatalf("unexpected throttling of pull %d", i)
+		}
+		checkHeaders(t, resp, http.Header{
+			"X-RateLimit-Limit":     []string{"2"},
+			"X-RateLimit-Remaining": []string{strconv.Itoa(1 - i)},
+		})
+	}
+
+	resp, err := http.Get(tagsURL)
+	checkErr(t, err, "listing tags")
+	defer resp.Body.Close()
+	checkResponse(t, "listing tags over the limit", resp, http.StatusTooManyRequests)
+	checkHeaders(t, resp, http.Header{
+		"X-RateLimit-Limit":     []string{"2"},
+		"X-RateLimit-Remaining": []string{"0"},
+	})
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 100 {
+		t.Fatalf("unexpected Retry-After header: %q", resp.Header.Get("Retry-After"))
+	}
+	checkBodyHasErrorCodes(t, "listing tags over the limit", resp, errcode.ErrorCodeTooManyRequests)
+
+	// Pushes are not limited.
+	startPushLayer(t, env, name)
+
+	// The base route is not limited.
+	baseURL, err := env.builder.BuildBaseURL()
+	checkErr(t, err, "building base url")
+	resp, err = http.Get(baseURL)
+	checkErr(t, err, "checking base url")
+	resp.Body.Close()
+	checkResponse(t, "checking base url", resp, http.StatusOK)
+
+	// The catalog has a bucket of its own, of one request by default.
+	catalogURL, err := env.builder.BuildCatalogURL()
+	checkErr(t, err, "building catalog url")
+	resp, err = http.Get(catalogURL)
+	checkErr(t, err, "listing repositories")
+	resp.Body.Close()
+	checkResponse(t, "listing repositories", resp, http.StatusOK)
+	resp, err = http.Get(catalogURL)
+	checkErr(t, err, "listing repositories")
+	resp.Body.Close()
+	checkResponse(t, "listing repositories over the limit", resp, http.StatusTooManyRequests)
+}
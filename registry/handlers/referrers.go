@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// referrersDispatcher constructs the handler returning the referrers of a
+// manifest.
+func referrersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	referrersHandler := &referrersHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(referrersHandler.GetReferrers),
+	}
+}
+
+// referrersHandler handles requests for the referrers of a manifest.
+type referrersHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// referrersResponse is the image index of the referrers of a manifest.
+type referrersResponse struct {
+	SchemaVersion int                       `json:"schemaVersion"`
+	MediaType     string                    `json:"mediaType"`
+	Manifests     []distribution.Descriptor `json:"manifests"`
+}
+
+// GetReferrers returns the image index of the referrers of the manifest,
+// filtered by the artifactType query parameter if set.
+func (rh *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	// Look for the referrers in the repository of the storage, as the
+	// repository of the request may be decorated without giving access to
+	// it.
+	repo, err := rh.App.registry.Repository(rh, rh.Repository.Named())
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+	rs, err := storage.NewReferrersService(repo)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported.WithDetail(err))
+		return
+	}
+	referrers, err := rs.List(rh, rh.Digest)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if artifactType := r.URL.Query().Get("artifactType"); artifactType != "" {
+		filtered := referrers[:0]
+		for _, referrer := range referrers {
+			if referrer.ArtifactType == artifactType {
+				filtered = append(filtered, referrer)
+			}
+		}
+		referrers = filtered
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+
+	w.Header().Set("Content-Type", v1.MediaTypeImageIndex)
+	if err := json.NewEncoder(w).Encode(referrersResponse{
+		SchemaVersion: 2,
+		MediaType:     v1.MediaTypeImageIndex,
+		Manifests:     referrers,
+	}); err != nil {
+		dcontext.GetLogger(rh).Errorf("error encoding referrers: %v", err)
+	}
+}
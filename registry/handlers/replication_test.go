@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newSignatureTestServer(t *testing.T, key []byte) *httptest.Server {
+	t.Helper()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	server := httptest.NewServer(NewSignatureVerificationMiddleware(key)(handler))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func signedRequest(t *testing.T, url string, key, body []byte, signedAt time.Time) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPut, url+"/v2/foo/bar/manifests/latest?digest=sha256:1", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(body)
+	SignRequest(req, key, hex.EncodeToString(sum[:]), signedAt)
+	return req
+}
+
+func TestSignatureVerification(t *testing.T) {
+	key := []byte("replication-secret")
+	server := newSignatureTestServer(t, key)
+	body := []byte(`{"schemaVersion": 2}`)
+
+	for _, tc := range []struct {
+		name     string
+		request  func() *http.Request
+		expected int
+	}{
+		{
+			name: "valid",
+			request: func() *http.Request {
+				return signedRequest(t, server.URL, key, body, time.Now())
+			},
+			expected: http.StatusCreated,
+		},
+		{
+			name: "missing",
+			request: func() *http.Request {
+				req := signedRequest(t, server.URL, key, body, time.Now())
+				req.Header.Del(SignatureHeader)
+				return req
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "expired",
+			request: func() *http.Request {
+				return signedRequest(t, server.URL, key, body, time.Now().Add(-6*time.Minute))
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong key",
+			request: func() *http.Request {
+				return signedRequest(t, server.URL, []byte("other-secret"), body, time.Now())
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered path",
+			request: func() *http.Request {
+				req := signedRequest(t, server.URL, key, body, time.Now())
+				req.URL.Path = "/v2/foo/baz/manifests/latest"
+				return req
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered query",
+			request: func() *http.Request {
+				req := signedRequest(t, server.URL, key, body, time.Now())
+				req.URL.RawQuery = "digest=sha256:2"
+				return req
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "missing nonce",
+			request: func() *http.Request {
+				req := signedRequest(t, server.URL, key, body, time.Now())
+				req.Header.Del(SignatureNonceHeader)
+				return req
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered nonce",
+			request: func() *http.Request {
+				req := signedRequest(t, server.URL, key, body, time.Now())
+				req.Header.Set(SignatureNonceHeader, "00")
+				return req
+			},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body",
+			request: func() *http.Request {
+				req := signedRequest(t, server.URL, key, body, time.Now())
+				tampered := []byte(`{"schemaVersion": 3}`)
+				req.Body = io.NopCloser(bytes.NewReader(tampered))
+				req.ContentLength = int64(len(tampered))
+				return req
+			},
+			expected: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.DefaultClient.Do(tc.request())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.expected {
+				t.Fatalf("unexpected status code: %d != %d", resp.StatusCode, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSignatureVerificationRejectsReplays(t *testing.T) {
+	key := []byte("replication-secret")
+	server := newSignatureTestServer(t, key)
+	body := []byte(`{"schemaVersion": 2}`)
+
+	req := signedRequest(t, server.URL, key, body, time.Now())
+	replayed := req.Clone(req.Context())
+	replayed.Body = io.NopCloser(bytes.NewReader(body))
+
+	for _, tc := range []struct {
+		name     string
+		request  *http.Request
+		expected int
+	}{
+		{name: "first", request: req, expected: http.StatusCreated},
+		{name: "replayed", request: replayed, expected: http.StatusUnauthorized},
+		{name: "other", request: signedRequest(t, server.URL, key, body, time.Now()), expected: http.StatusCreated},
+	} {
+		resp, err := http.DefaultClient.Do(tc.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.expected {
+			t.Fatalf("%s: unexpected status code: %d != %d", tc.name, resp.StatusCode, tc.expected)
+		}
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	nc := &nonceCache{seen: make(map[string]time.Time)}
+	now := time.Now()
+
+	if !nc.add("a", now) {
+		t.Fatal("expected a new nonce to be accepted")
+	}
+	if nc.add("a", now.Add(2*maxSignatureAge)) {
+		t.Fatal("expected a nonce to be rejected while its signature may be valid")
+	}
+	if !nc.add("b", now.Add(4*maxSignatureAge)) {
+		t.Fatal("expected a new nonce to be accepted")
+	}
+	if _, ok := nc.seen["a"]; ok {
+		t.Fatal("expected the expired nonce to be removed")
+	}
+}
+
+func TestSignatureVerificationIgnoresPulls(t *testing.T) {
+	server := newSignatureTestServer(t, []byte("replication-secret"))
+
+	resp, err := http.Get(server.URL + "/v2/foo/bar/manifests/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status code for unsigned pull: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// adminAccess is the access of the administrators of the registry, who
+// manage tag locks and overwrite locked tags.
+var adminAccess = auth.Access{
+	Resource: auth.Resource{
+		Type: "registry",
+		Name: "admin",
+	},
+	Action: "write",
+}
+
+// tagLockDispatcher constructs and returns the tag lock handler for the
+// given request context.
+func tagLockDispatcher(ctx *Context, r *http.Request) http.Handler {
+	tag := getTag(ctx)
+	if ctx.App.caseInsensitiveTags {
+		tag = strings.ToLower(tag)
+	}
+	tlh := &tagLockHandler{
+		Context: ctx,
+		Tag:     tag,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodPost:   http.HandlerFunc(tlh.LockTag),
+		http.MethodDelete: http.HandlerFunc(tlh.UnlockTag),
+	}
+}
+
+// tagLockHandler locks and unlocks tags.
+type tagLockHandler struct {
+	*Context
+
+	Tag string
+}
+
+// LockTag locks the tag against being overwritten.
+func (tlh *tagLockHandler) LockTag(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(tlh).Debug("LockTag")
+
+	if err := storage.LockTag(tlh, tlh.App.driver, tlh.Repository.Named().Name(), tlh.Tag); err != nil {
+		tlh.appendError(err)
+		return
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// UnlockTag unlocks the tag.
+func (tlh *tagLockHandler) UnlockTag(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(tlh).Debug("UnlockTag")
+
+	if err := storage.UnlockTag(tlh, tlh.App.driver, tlh.Repository.Named().Name(), tlh.Tag); err != nil {
+		tlh.appendError(err)
+		return
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// appendError appends the error reported for err, the error of locking or
+// unlocking the tag.
+func (tlh *tagLockHandler) appendError(err error) {
+	if _, ok := err.(distribution.ErrTagInvalid); ok {
+		tlh.Errors = append(tlh.Errors, v2.ErrorCodeTagInvalid.WithDetail(err))
+		return
+	}
+	tlh.Errors = append(tlh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+}
+
+// adminEnabled reports whether the access controller of the registry grants
+// the access of the administrators to some clients only. The routes of the
+// administrators are refused otherwise, as without access controller any
+// client would be an administrator, and with an access controller only
+// authenticating users, such as htpasswd, any authenticated user would.
+func (app *App) adminEnabled() bool {
+	return app.accessController != nil && auth.GrantsScopes(app.accessController)
+}
+
+// isAdmin reports whether the client of the request of ctx has the access of
+// the administrators. Unless administrators are enabled, no client has.
+func (app *App) isAdmin(ctx *Context) bool {
+	if !app.adminEnabled() {
+		return false
+	}
+	_, err := app.accessController.Authorized(ctx.Context, adminAccess)
+	return err == nil
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	"github.com/distribution/distribution/v3/registry/auth"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// adminAccessController grants the access of the administrators to the
+// requests with the "admin" Authorization header, and any other access to
+// all the requests.
+type adminAccessController struct{}
+
+func (adminAccessController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Authorization") == "admin" {
+		return ctx, nil
+	}
+	for _, a := range access {
+		if a == adminAccess {
+			return nil, adminChallenge{}
+		}
+	}
+	return ctx, nil
+}
+
+func (adminAccessController) GrantsScopes() bool {
+	return true
+}
+
+// userAccessController grants any access to all the requests, as access
+// controllers only authenticating users do.
+type userAccessController struct{}
+
+func (userAccessController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	return ctx, nil
+}
+
+type adminChallenge struct{}
+
+func (adminChallenge) SetHeaders(r *http.Request, w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="test",scope="registry:admin:write"`)
+}
+
+func (adminChallenge) Error() string {
+	return "admin access required"
+}
+
+func doAdminRequest(t *testing.T, method, url string, admin bool, contentType string, body []byte) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	checkErr(t, err, "creating request")
+	if admin {
+		req.Header.Set("Authorization", "admin")
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "sending request")
+	return resp
+}
+
+// putLatestManifest puts an image manifest with content as the latest tag of
+// the repository name, and returns its digest with the response.
+func putLatestManifest(t *testing.T, env *testEnv, name reference.Named, content string, admin bool) (digest.Digest, *http.Response) {
+	t.Helper()
+
+	configBlob := []byte(content)
+	configDigest := digest.FromBytes(configBlob)
+	uploadURLBase, _ := startPushLayer(t, env, name)
+	pushLayer(t, env.builder, name, configDigest, uploadURLBase, bytes.NewReader(configBlob))
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(configBlob)),
+		},
+	})
+	checkErr(t, err, "creating manifest")
+	_, payload, err := m.Payload()
+	checkErr(t, err, "getting manifest payload")
+
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	return digest.FromBytes(payload), doAdminRequest(t, http.MethodPut, manifestURL, admin, v1.MediaTypeImageManifest, payload)
+}
+
+func checkLatestManifest(t *testing.T, env *testEnv, name reference.Named, expected digest.Digest) {
+	t.Helper()
+
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	checkErr(t, err, "creating manifest request")
+	req.Header.Set("Accept", v1.MediaTypeImageManifest)
+	resp, err := http.DefaultClient.Do(req)
+	checkErr(t, err, "fetching manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{expected.String()},
+	})
+}
+
+func TestTagLock(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+			"delete": configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+	env.app.accessController = adminAccessController{}
+
+	name, _ := reference.WithName("foo/locked")
+	first, resp := putLatestManifest(t, env, name, `{"first":true}`, false)
+	resp.Body.Close()
+	checkResponse(t, "putting first manifest", resp, http.StatusCreated)
+
+	lockURL, err := env.builder.BuildTagLockURL(name, "latest")
+	checkErr(t, err, "building tag lock url")
+
+	// Only administrators lock tags.
+	resp = doAdminRequest(t, http.MethodPost, lockURL, false, "", nil)
+	resp.Body.Close()
+	checkResponse(t, "locking tag without admin access", resp, http.StatusUnauthorized)
+
+	resp = doAdminRequest(t, http.MethodPost, lockURL, true, "", nil)
+	resp.Body.Close()
+	checkResponse(t, "locking tag", resp, http.StatusCreated)
+
+	// The locked tag is not overwritten, but still served.
+	second, resp := putLatestManifest(t, env, name, `{"second":true}`, false)
+	checkResponse(t, "putting manifest with locked tag", resp, http.StatusLocked)
+	checkBodyHasErrorCodes(t, "putting manifest with locked tag", resp, v2.ErrorCodeTagLocked)
+	resp.Body.Close()
+	checkLatestManifest(t, env, name, first)
+
+	// The manifest refused for its locked tag is not stored.
+	ref, _ := reference.WithDigest(name, second)
+	secondURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp, err = http.Head(secondURL)
+	checkErr(t, err, "checking manifest")
+	resp.Body.Close()
+	checkResponse(t, "checking manifest refused for its locked tag", resp, http.StatusNotFound)
+
+	// Administrators bypass the lock.
+	third, resp := putLatestManifest(t, env, name, `{"third":true}`, true)
+	resp.Body.Close()
+	checkResponse(t, "putting manifest with locked tag as admin", resp, http.StatusCreated)
+	checkLatestManifest(t, env, name, third)
+
+	// The locked tag is not removed, directly or with its manifest.
+	tagRef, _ := reference.WithTag(name, "latest")
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp = doAdminRequest(t, http.MethodDelete, tagURL, false, "", nil)
+	checkResponse(t, "deleting locked tag", resp, http.StatusLocked)
+	checkBodyHasErrorCodes(t, "deleting locked tag", resp, v2.ErrorCodeTagLocked)
+	resp.Body.Close()
+
+	ref, _ = reference.WithDigest(name, third)
+	thirdURL, err := env.builder.BuildManifestURL(ref)
+	checkErr(t, err, "building manifest url")
+	resp = doAdminRequest(t, http.MethodDelete, thirdURL, false, "", nil)
+	checkResponse(t, "deleting manifest of locked tag", resp, http.StatusLocked)
+	checkBodyHasErrorCodes(t, "deleting manifest of locked tag", resp, v2.ErrorCodeTagLocked)
+	resp.Body.Close()
+	checkLatestManifest(t, env, name, third)
+
+	resp = doAdminRequest(t, http.MethodDelete, lockURL, false, "", nil)
+	resp.Body.Close()
+	checkResponse(t, "unlocking tag without admin access", resp, http.StatusUnauthorized)
+
+	resp = doAdminRequest(t, http.MethodDelete, lockURL, true, "", nil)
+	resp.Body.Close()
+	checkResponse(t, "unlocking tag", resp, http.StatusAccepted)
+
+	fourth, resp := putLatestManifest(t, env, name, `{"fourth":true}`, false)
+	resp.Body.Close()
+	checkResponse(t, "putting manifest with unlocked tag", resp, http.StatusCreated)
+	checkLatestManifest(t, env, name, fourth)
+}
+
+func TestTagLockRequiresScopes(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/locked")
+	lockURL, err := env.builder.BuildTagLockURL(name, "latest")
+	checkErr(t, err, "building tag lock url")
+
+	for _, tc := range []struct {
+		name             string
+		accessController auth.AccessController
+	}{
+		{name: "without access controller"},
+		{name: "with an access controller granting any access", accessController: userAccessController{}},
+	} {
+		env.app.accessController = tc.accessController
+		for _, method := range []string{http.MethodPost, http.MethodDelete} {
+			resp := doAdminRequest(t, method, lockURL, true, "", nil)
+			checkResponse(t, method+" tag lock "+tc.name, resp, errcode.ErrorCodeUnsupported.Descriptor().HTTPStatusCode)
+			checkBodyHasErrorCodes(t, method+" tag lock "+tc.name, resp, errcode.ErrorCodeUnsupported)
+			resp.Body.Close()
+		}
+	}
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"sort"
 	"strconv"
 
 	"github.com/distribution/distribution/v3"
@@ -37,8 +36,28 @@ type tagsAPIResponse struct {
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
+	// do pagination if requested, listing all the tags after the last
+	// entry, if any specified, unless `n` entries are requested.
+	q := r.URL.Query()
+	lastEntry := q.Get("last")
+	maxEntries := -1
+	if n := q.Get("n"); n != "" {
+		var err error
+		maxEntries, err = strconv.Atoi(n)
+		if err != nil || maxEntries < 0 {
+			th.Errors = append(th.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(map[string]string{"n": n}))
+			return
+		}
+	}
+
+	// one more entry than requested tells whether there are tags left the
+	// user needs.
+	count := maxEntries
+	if maxEntries > 0 {
+		count++
+	}
 	tagService := th.Repository.Tags(th)
-	tags, err := tagService.All(th)
+	tags, err := tagService.AllPaged(th, lastEntry, count)
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
@@ -51,49 +70,15 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// do pagination if requested
-	q := r.URL.Query()
-	// get entries after latest, if any specified
-	if lastEntry := q.Get("last"); lastEntry != "" {
-		lastEntryIndex := sort.SearchStrings(tags, lastEntry)
-
-		// as`sort.SearchStrings` can return len(tags), if the
-		// specified `lastEntry` is not found, we need to
-		// ensure it does not panic when slicing.
-		if lastEntryIndex == len(tags) {
-			tags = []string{}
-		} else {
-			tags = tags[lastEntryIndex+1:]
-		}
-	}
-
-	// if no error, means that the user requested `n` entries
-	if n := q.Get("n"); n != "" {
-		maxEntries, err := strconv.Atoi(n)
-		if err != nil || maxEntries < 0 {
-			th.Errors = append(th.Errors, v2.ErrorCodePaginationNumberInvalid.WithDetail(map[string]string{"n": n}))
+	if maxEntries > 0 && len(tags) > maxEntries {
+		tags = tags[:maxEntries]
+		// defined in `catalog.go`
+		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, tags[maxEntries-1])
+		if err != nil {
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			return
 		}
-
-		// if there is requested more than or
-		// equal to the amount of tags we have,
-		// then set the request to equal `len(tags)`.
-		// the reason for the `=`, is so the else
-		// clause will only activate if there
-		// are tags left the user needs.
-		if maxEntries >= len(tags) {
-			maxEntries = len(tags)
-		} else if maxEntries > 0 {
-			// defined in `catalog.go`
-			urlStr, err := createLinkEntry(r.URL.String(), maxEntries, tags[maxEntries-1])
-			if err != nil {
-				th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
-				return
-			}
-			w.Header().Set("Link", urlStr)
-		}
-
-		tags = tags[:maxEntries]
+		w.Header().Set("Link", urlStr)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/transparency"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultTransparencyTimeout bounds the submission of a manifest to the
+// transparency log, unless configured otherwise.
+const defaultTransparencyTimeout = 10 * time.Second
+
+// transparencyLog records the pushed manifests in a Rekor transparency log.
+type transparencyLog struct {
+	client *transparency.Client
+	signer *transparency.Signer
+}
+
+// configureTransparency prepares the recording of the pushed manifests in
+// the transparency log, if enabled.
+func (app *App) configureTransparency(config *configuration.Configuration) {
+	if !config.Transparency.Enabled {
+		return
+	}
+	if config.Transparency.Key == "" {
+		panic("transparency log requires a signing key")
+	}
+
+	signer, err := transparency.LoadSigner(config.Transparency.Key, config.Transparency.Certificate)
+	if err != nil {
+		panic(fmt.Sprintf("unable to load transparency log signing key: %v", err))
+	}
+	rekorURL := config.Transparency.RekorURL
+	if rekorURL == "" {
+		rekorURL = transparency.DefaultRekorURL
+	}
+	timeout := config.Transparency.Timeout
+	if timeout <= 0 {
+		timeout = defaultTransparencyTimeout
+	}
+
+	app.transparency = &transparencyLog{
+		client: transparency.NewClient(rekorURL, &http.Client{Timeout: timeout}),
+		signer: signer,
+	}
+	dcontext.GetLogger(app).Infof("recording pushed manifests in the transparency log at %s", rekorURL)
+}
+
+// record submits the manifest dgst of the repository name to the log, unless
+// it was already, and records its entry beside the manifest.
+func (tl *transparencyLog) record(ctx context.Context, d storagedriver.StorageDriver, name string, dgst digest.Digest) error {
+	existing, err := storage.GetTransparencyRecord(ctx, d, name, dgst)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+
+	rekord, err := tl.signer.HashedRekord(dgst)
+	if err != nil {
+		return err
+	}
+	entry, err := tl.client.Upload(ctx, rekord)
+	if err != nil {
+		return err
+	}
+	dcontext.GetLogger(ctx).Infof("recorded manifest %s in the transparency log at index %d", dgst, entry.LogIndex)
+
+	return storage.PutTransparencyRecord(ctx, d, name, dgst, storage.TransparencyRecord{
+		RekorURL:       tl.client.URL(),
+		LogIndex:       entry.LogIndex,
+		UUID:           entry.UUID,
+		IntegratedTime: entry.IntegratedTime,
+	})
+}
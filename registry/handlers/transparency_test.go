@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/distribution/distribution/v3/registry/transparency"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// stubRekor accepts hashedrekord entries, answering with consecutive log
+// indexes, or with failures when unavailable.
+type stubRekor struct {
+	mu          sync.Mutex
+	entries     []transparency.HashedRekord
+	unavailable bool
+}
+
+func (s *stubRekor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var rekord transparency.HashedRekord
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&rekord) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.entries = append(s.entries, rekord)
+	body, _ := json.Marshal(rekord)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]transparency.LogEntry{
+		"uuid": {
+			Body:     body,
+			LogIndex: int64(100 + len(s.entries) - 1),
+		},
+	})
+}
+
+func newTransparencyTestEnv(t *testing.T, rekorURL string) *testEnv {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error encoding key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("unexpected error writing key: %v", err)
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Transparency: configuration.Transparency{
+			Enabled:  true,
+			RekorURL: rekorURL,
+			Key:      keyPath,
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	return newTestEnvWithConfig(t, &config)
+}
+
+// pushTransparencyManifest pushes an image manifest with content to the
+// repository name, and returns its digest.
+func pushTransparencyManifest(t *testing.T, env *testEnv, name reference.Named, content string) digest.Digest {
+	configBlob := []byte(content)
+	configDigest := digest.FromBytes(configBlob)
+	uploadURLBase, _ := startPushLayer(t, env, name)
+	pushLayer(t, env.builder, name, configDigest, uploadURLBase, bytes.NewReader(configBlob))
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(configBlob)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	_, payload, _ := m.Payload()
+	dgst := digest.FromBytes(payload)
+
+	ref, _ := reference.WithTag(name, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest url: %v", err)
+	}
+	resp := putManifest(t, "putting manifest", manifestURL, v1.MediaTypeImageManifest, m)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest", resp, http.StatusCreated)
+	return dgst
+}
+
+func TestManifestTransparency(t *testing.T) {
+	rekor := &stubRekor{}
+	rekorServer := httptest.NewServer(rekor)
+	defer rekorServer.Close()
+
+	env := newTransparencyTestEnv(t, rekorServer.URL)
+	defer env.Shutdown()
+
+	name, _ := reference.WithName("foo/transparency")
+	dgst := pushTransparencyManifest(t, env, name, `{"first":true}`)
+
+	record, err := storage.GetTransparencyRecord(env.ctx, env.app.driver, name.Name(), dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting transparency record: %v", err)
+	}
+	if record == nil || record.LogIndex != 100 || record.RekorURL != rekorServer.URL || record.UUID != "uuid" {
+		t.Fatalf("unexpected transparency record: %+v", record)
+	}
+	if len(rekor.entries) != 1 {
+		t.Fatalf("expected a single entry, got %d", len(rekor.entries))
+	}
+	hash := rekor.entries[0].Spec.Data.Hash
+	if hash.Algorithm != "sha256" || hash.Value != dgst.Encoded() {
+		t.Fatalf("unexpected hash of the entry: %+v", hash)
+	}
+
+	// Pushing the manifest again does not record it twice.
+	pushTransparencyManifest(t, env, name, `{"first":true}`)
+	if len(rekor.entries) != 1 {
+		t.Fatalf("expected the manifest to be recorded once, got %d entries", len(rekor.entries))
+	}
+
+	// The push succeeds when the log is unavailable, without record.
+	rekor.mu.Lock()
+	rekor.unavailable = true
+	rekor.mu.Unlock()
+	dgst = pushTransparencyManifest(t, env, name, `{"second":true}`)
+	record, err = storage.GetTransparencyRecord(env.ctx, env.app.driver, name.Name(), dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting transparency record: %v", err)
+	}
+	if record != nil {
+		t.Fatalf("expected no transparency record, got %+v", record)
+	}
+}
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultLogSamplingInitial is the number of identical lines logged
+	// every second before sampling them.
+	defaultLogSamplingInitial = 100
+
+	// defaultLogSamplingThereafter is the rate of identical lines logged
+	// past the initial ones.
+	defaultLogSamplingThereafter = 10
+)
+
+// logSampler is a logrus formatter limiting the number of identical lines
+// logged every second: past the first initial lines, one in thereafter
+// lines is formatted, the others are dropped. Lines matching one of exclude
+// are always formatted.
+//
+// Logrus has no way to drop an entry once logged, so dropped entries are
+// formatted as nothing.
+type logSampler struct {
+	logrus.Formatter
+	initial    int
+	thereafter int
+	exclude    []*regexp.Regexp
+
+	mu     sync.Mutex
+	second time.Time
+	counts map[string]int
+}
+
+func newLogSampler(formatter logrus.Formatter, config configuration.LogSampling) (*logSampler, error) {
+	ls := &logSampler{
+		Formatter:  formatter,
+		initial:    config.Initial,
+		thereafter: config.Thereafter,
+		counts:     make(map[string]int),
+	}
+	if ls.initial <= 0 {
+		ls.initial = defaultLogSamplingInitial
+	}
+	if ls.thereafter <= 0 {
+		ls.thereafter = defaultLogSamplingThereafter
+	}
+	for _, pattern := range config.Exclude {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log sampling exclude pattern %q: %v", pattern, err)
+		}
+		ls.exclude = append(ls.exclude, re)
+	}
+	return ls, nil
+}
+
+// Format formats entry with the formatter it wraps, unless entry is dropped.
+func (ls *logSampler) Format(entry *logrus.Entry) ([]byte, error) {
+	if !ls.sample(entry) {
+		return nil, nil
+	}
+	return ls.Formatter.Format(entry)
+}
+
+// sample reports whether entry is logged.
+func (ls *logSampler) sample(entry *logrus.Entry) bool {
+	if ls.excluded(entry) {
+		return true
+	}
+
+	key := samplingKey(entry)
+	second := entry.Time.Truncate(time.Second)
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if !second.Equal(ls.second) {
+		ls.second = second
+		ls.counts = make(map[string]int)
+	}
+	ls.counts[key]++
+	n := ls.counts[key]
+	return n <= ls.initial || (n-ls.initial)%ls.thereafter == 0
+}
+
+// excluded reports whether entry is never sampled.
+func (ls *logSampler) excluded(entry *logrus.Entry) bool {
+	for _, re := range ls.exclude {
+		if re.MatchString(entry.Message) {
+			return true
+		}
+		for field := range entry.Data {
+			if re.MatchString(field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// samplingKey returns the key of the identical lines of entry: the method,
+// path and status of the request for lines logged for a request, the level
+// and message otherwise.
+func samplingKey(entry *logrus.Entry) string {
+	method, ok := entry.Data["http.request.method"]
+	if !ok {
+		return entry.Level.String() + " " + entry.Message
+	}
+	return fmt.Sprint(method, " ", entry.Data["http.request.uri"], " ", entry.Data["http.response.status"])
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogSampling(t *testing.T) {
+	sampler, err := newLogSampler(&logrus.TextFormatter{DisableTimestamp: true}, configuration.LogSampling{
+		Enabled:    true,
+		Initial:    100,
+		Thereafter: 10,
+		Exclude:    []string{"auth.*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(sampler)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	request := func(path string, status int) *logrus.Entry {
+		return logger.WithTime(start).WithFields(logrus.Fields{
+			"http.request.method":  "GET",
+			"http.request.uri":     path,
+			"http.response.status": status,
+		})
+	}
+	logged := func(log func()) int {
+		out.Reset()
+		log()
+		return strings.Count(out.String(), "\n")
+	}
+
+	for _, tc := range []struct {
+		name     string
+		log      func()
+		expected int
+	}{
+		{
+			name: "identical requests",
+			log: func() {
+				for i := 0; i < 1000; i++ {
+					request("/v2/a/manifests/latest", 200).Info("response completed")
+				}
+			},
+			// The first 100, then one in 10 of the remaining 900.
+			expected: 190,
+		},
+		{
+			name: "different status",
+			log: func() {
+				for i := 0; i < 150; i++ {
+					request("/v2/a/manifests/latest", 404).Info("response completed")
+				}
+			},
+			expected: 105,
+		},
+		{
+			name: "messages",
+			log: func() {
+				for i := 0; i < 200; i++ {
+					logger.WithTime(start).Warn("slow storage")
+				}
+			},
+			expected: 110,
+		},
+		{
+			name: "next second",
+			log: func() {
+				for i := 0; i < 100; i++ {
+					request("/v2/a/manifests/latest", 200).WithTime(start.Add(time.Second)).Info("response completed")
+				}
+			},
+			expected: 100,
+		},
+		{
+			name: "excluded message",
+			log: func() {
+				for i := 0; i < 500; i++ {
+					logger.WithTime(start).Warn("auth failed")
+				}
+			},
+			expected: 500,
+		},
+		{
+			name: "excluded field",
+			log: func() {
+				for i := 0; i < 500; i++ {
+					request("/v2/a/manifests/latest", 200).WithField("auth.user.name", "alice").Info("response completed")
+				}
+			},
+			expected: 500,
+		},
+	} {
+		if n := logged(tc.log); n != tc.expected {
+			t.Errorf("%s: %d lines logged, expected %d", tc.name, n, tc.expected)
+		}
+	}
+
+	if _, err := newLogSampler(&logrus.TextFormatter{}, configuration.LogSampling{Exclude: []string{"("}}); err == nil {
+		t.Error("expected an error with an invalid exclude pattern")
+	}
+}
@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/spf13/cobra"
+)
+
+// MigrateReferrersCmd is the cobra command that corresponds to the migrate-referrers subcommand
+var MigrateReferrersCmd = &cobra.Command{
+	Use:   "migrate-referrers <config>",
+	Short: "`migrate-referrers` indexes the referrers of the manifests stored",
+	Long: "`migrate-referrers` adds the manifests having a subject to the index of the referrers of their subject,\n" +
+		"which the referrers API lists. Manifests pushed before the registry maintained the indexes are\n" +
+		"missing from them otherwise. Referrers already indexed are skipped, such that the migration may\n" +
+		"be run again while the registry is in use.",
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s\n", err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := storage.MigrateReferrers(ctx, registry); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate referrers: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/shard"
+	"github.com/spf13/cobra"
+)
+
+// MigrateShardsCmd is the cobra command that corresponds to the migrate-shards subcommand
+var MigrateShardsCmd = &cobra.Command{
+	Use:   "migrate-shards <config>",
+	Short: "`migrate-shards` copies the content of the storage to its shards",
+	Long: "`migrate-shards` copies the content of the storage driver to the backends of storage.shard,\n" +
+		"which the registry uses once storage.shard.enabled is set. Files already copied are skipped,\n" +
+		"such that the migration may be resumed.",
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		single, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+		shardConfig, ok := config.Storage["shard"]
+		if !ok {
+			fmt.Fprintln(os.Stderr, "no shards configured in storage.shard")
+			os.Exit(1)
+		}
+		sharded, err := shard.FromParameters(shardConfig, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct sharded driver: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := shard.MigrateToShards(dcontext.Background(), single, sharded); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate to shards: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,381 @@
+// Package ocicrypt encrypts and decrypts the layers of OCI images stored in
+// a registry with containers/ocicrypt, wrapping the keys of the layers for
+// the RSA public keys of their recipients in JWEs.
+package ocicrypt
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	encryption "github.com/containers/ocicrypt"
+	encconfig "github.com/containers/ocicrypt/config"
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const mediaTypeImageLayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+
+var (
+	// ErrNoMatchingKey is returned when a layer is not encrypted for the
+	// key trying to decrypt it.
+	ErrNoMatchingKey = errors.New("layer is not encrypted for this key")
+
+	// ErrIntegrity is returned when the content of an encrypted layer does
+	// not match its HMAC.
+	ErrIntegrity = errors.New("encrypted layer failed integrity check")
+)
+
+// Options configures the connection to the registry.
+type Options struct {
+	// Auth holds the credentials for the registry.
+	Auth remote.AuthConfig
+
+	// PlainHTTP connects to the registry over HTTP rather than HTTPS.
+	PlainHTTP bool
+}
+
+// Encrypt encrypts the layers of the OCI image referenced by ref, by tag or
+// digest, for recipients, and pushes the encrypted image in place of ref.
+// Layers already encrypted are left as they are, unless key can decrypt
+// them, in which case recipients are added to them.
+func Encrypt(ctx context.Context, ref string, recipients []*rsa.PublicKey, key *rsa.PrivateKey, opts Options) (distribution.Descriptor, error) {
+	if len(recipients) == 0 {
+		return distribution.Descriptor{}, errors.New("no recipient to encrypt for")
+	}
+	ec, err := encryptConfig(recipients, key)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	return rewrite(ctx, ref, opts, func(blobs distribution.BlobStore, layer distribution.Descriptor) (distribution.Descriptor, error) {
+		if ocischema.IsEncryptedLayer(layer.MediaType) {
+			if key == nil {
+				return layer, nil
+			}
+			return addRecipients(layer, ec)
+		}
+		switch layer.MediaType {
+		case v1.MediaTypeImageLayer, v1.MediaTypeImageLayerGzip, mediaTypeImageLayerZstd:
+			return encryptLayer(ctx, blobs, layer, ec)
+		}
+		// Non-distributable layers are not stored in the registry.
+		return layer, nil
+	})
+}
+
+// Decrypt decrypts the layers of the OCI image referenced by ref, by tag or
+// digest, with key, and pushes the decrypted image in place of ref.
+func Decrypt(ctx context.Context, ref string, key *rsa.PrivateKey, opts Options) (distribution.Descriptor, error) {
+	dc, err := decryptConfig(key)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	return rewrite(ctx, ref, opts, func(blobs distribution.BlobStore, layer distribution.Descriptor) (distribution.Descriptor, error) {
+		if !ocischema.IsEncryptedLayer(layer.MediaType) {
+			return layer, nil
+		}
+		return decryptLayer(ctx, blobs, layer, dc)
+	})
+}
+
+// rewrite replaces the layers of the OCI image referenced by ref by the
+// result of transform, and pushes the resulting image in place of ref.
+func rewrite(ctx context.Context, ref string, opts Options, transform func(distribution.BlobStore, distribution.Descriptor) (distribution.Descriptor, error)) (distribution.Descriptor, error) {
+	named, repo, err := resolve(ref, opts)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	var (
+		dgst    digest.Digest
+		options []distribution.ManifestServiceOption
+	)
+	switch ref := named.(type) {
+	case reference.Canonical:
+		dgst = ref.Digest()
+	case reference.Tagged:
+		options = append(options, distribution.WithTag(ref.Tag()))
+	default:
+		return distribution.Descriptor{}, fmt.Errorf("%s: reference must be tagged or referenced by digest", ref)
+	}
+	m, err := ms.Get(ctx, dgst, options...)
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("fetching %s: %v", ref, err)
+	}
+	im, ok := m.(*ocischema.DeserializedManifest)
+	if !ok {
+		return distribution.Descriptor{}, fmt.Errorf("%s is not an OCI image manifest", ref)
+	}
+
+	blobs := repo.Blobs(ctx)
+	layers := make([]distribution.Descriptor, len(im.Layers))
+	for i, layer := range im.Layers {
+		if layers[i], err = transform(blobs, layer); err != nil {
+			return distribution.Descriptor{}, fmt.Errorf("layer %s: %w", layer.Digest, err)
+		}
+	}
+
+	rewritten, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:   im.Versioned,
+		Config:      im.Config,
+		Layers:      layers,
+		Annotations: im.Annotations,
+	})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if dgst, err = ms.Put(ctx, rewritten, options...); err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("pushing manifest: %v", err)
+	}
+
+	mediaType, payload, err := rewritten.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+// encryptConfig returns the configuration encrypting layers for recipients,
+// and adding recipients to the layers key decrypts, if set.
+func encryptConfig(recipients []*rsa.PublicKey, key *rsa.PrivateKey) (*encconfig.EncryptConfig, error) {
+	pubKeys := make([][]byte, len(recipients))
+	for i, recipient := range recipients {
+		p, err := x509.MarshalPKIXPublicKey(recipient)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys[i] = p
+	}
+	cc, err := encconfig.EncryptWithJwe(pubKeys)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		dcc, err := encconfig.DecryptWithPrivKeys([][]byte{x509.MarshalPKCS1PrivateKey(key)}, [][]byte{nil})
+		if err != nil {
+			return nil, err
+		}
+		cc = encconfig.CombineCryptoConfigs([]encconfig.CryptoConfig{cc, dcc})
+	}
+	return cc.EncryptConfig, nil
+}
+
+// decryptConfig returns the configuration decrypting layers with key.
+func decryptConfig(key *rsa.PrivateKey) (*encconfig.DecryptConfig, error) {
+	cc, err := encconfig.DecryptWithPrivKeys([][]byte{x509.MarshalPKCS1PrivateKey(key)}, [][]byte{nil})
+	if err != nil {
+		return nil, err
+	}
+	return cc.DecryptConfig, nil
+}
+
+// encryptLayer pushes the encryption of layer for the recipients of ec, and
+// returns its descriptor.
+func encryptLayer(ctx context.Context, blobs distribution.BlobStore, layer distribution.Descriptor, ec *encconfig.EncryptConfig) (distribution.Descriptor, error) {
+	rc, err := blobs.Open(ctx, layer.Digest)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	defer rc.Close()
+
+	plain := digest.Canonical.Digester()
+	r, finalize, err := encryption.EncryptLayer(ec, io.TeeReader(rc, plain.Hash()), ociDescriptor(layer))
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	encrypted := digest.Canonical.Digester()
+	desc := distribution.Descriptor{
+		MediaType:   layer.MediaType + "+encrypted",
+		Annotations: make(map[string]string, len(layer.Annotations)+2),
+	}
+	for k, v := range layer.Annotations {
+		desc.Annotations[k] = v
+	}
+	return push(ctx, blobs, io.TeeReader(r, encrypted.Hash()), encrypted, desc, func() error {
+		if plain.Digest() != layer.Digest {
+			return fmt.Errorf("content does not match digest %s", layer.Digest)
+		}
+		annotations, err := finalize()
+		if err != nil {
+			return err
+		}
+		for k, v := range annotations {
+			desc.Annotations[k] = v
+		}
+		return nil
+	})
+}
+
+// decryptLayer pushes the decryption of layer with dc, and returns its
+// descriptor.
+func decryptLayer(ctx context.Context, blobs distribution.BlobStore, layer distribution.Descriptor, dc *encconfig.DecryptConfig) (distribution.Descriptor, error) {
+	if err := ocischema.ValidateEncryptedLayer(layer); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	// The key of the layer is unwrapped before reading it, such that layers
+	// which are not encrypted for dc are told from other errors.
+	if _, _, err := encryption.DecryptLayer(dc, nil, ociDescriptor(layer), true); err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("%w: %v", ErrNoMatchingKey, err)
+	}
+
+	rc, err := blobs.Open(ctx, layer.Digest)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	defer rc.Close()
+
+	src := &sourceReader{r: rc}
+	r, dgst, err := encryption.DecryptLayer(dc, src, ociDescriptor(layer), false)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	plain := digest.Canonical.Digester()
+	desc := distribution.Descriptor{
+		MediaType:   strings.TrimSuffix(layer.MediaType, "+encrypted"),
+		Annotations: encryption.FilterOutAnnotations(layer.Annotations),
+	}
+	if len(desc.Annotations) == 0 {
+		desc.Annotations = nil
+	}
+	return push(ctx, blobs, io.TeeReader(integrityReader{r: r, src: src}, plain.Hash()), plain, desc, func() error {
+		// ocicrypt does not report the digest of the original content
+		// of all the layers, which the HMAC authenticates anyway.
+		if dgst != "" && plain.Digest() != dgst {
+			return fmt.Errorf("decrypted content does not match digest %s", dgst)
+		}
+		return nil
+	})
+}
+
+// sourceReader records the error of reading an encrypted layer, to tell it
+// from the cipher failing.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (sr *sourceReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	if err != nil && err != io.EOF {
+		sr.err = err
+	}
+	return n, err
+}
+
+// integrityReader reads the decryption r of src, reporting the errors of the
+// cipher, which only fails once the HMAC of the content does not match, as
+// ErrIntegrity.
+type integrityReader struct {
+	r   io.Reader
+	src *sourceReader
+}
+
+func (ir integrityReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if err != nil && err != io.EOF && ir.src.err == nil {
+		err = fmt.Errorf("%w: %v", ErrIntegrity, err)
+	}
+	return n, err
+}
+
+// push uploads the content of r, whose digest is computed by digester, and
+// commits it with desc once check accepts it.
+func push(ctx context.Context, blobs distribution.BlobStore, r io.Reader, digester digest.Digester, desc distribution.Descriptor, check func() error) (distribution.Descriptor, error) {
+	bw, err := blobs.Create(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	n, err := bw.ReadFrom(r)
+	if err == nil {
+		err = check()
+	}
+	if err != nil {
+		bw.Cancel(ctx)
+		return distribution.Descriptor{}, err
+	}
+
+	desc.Digest = digester.Digest()
+	desc.Size = n
+	committed, err := bw.Commit(ctx, desc)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	desc.Digest, desc.Size = committed.Digest, committed.Size
+	return desc, nil
+}
+
+// addRecipients returns layer, with its key wrapped for the recipients of ec
+// as well. The content of the layer is left as it is.
+func addRecipients(layer distribution.Descriptor, ec *encconfig.EncryptConfig) (distribution.Descriptor, error) {
+	_, finalize, err := encryption.EncryptLayer(ec, nil, ociDescriptor(layer))
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("%w: %v", ErrNoMatchingKey, err)
+	}
+	wrapped, err := finalize()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	annotations := make(map[string]string, len(layer.Annotations))
+	for k, v := range layer.Annotations {
+		annotations[k] = v
+	}
+	for k, v := range wrapped {
+		annotations[k] = v
+	}
+	layer.Annotations = annotations
+	return layer, nil
+}
+
+// ociDescriptor returns desc as the descriptor type of ocicrypt.
+func ociDescriptor(desc distribution.Descriptor) v1.Descriptor {
+	return v1.Descriptor{
+		MediaType:   desc.MediaType,
+		Digest:      desc.Digest,
+		Size:        desc.Size,
+		Annotations: desc.Annotations,
+	}
+}
+
+// resolve returns the parsed ref and its repository.
+func resolve(ref string, opts Options) (reference.Named, distribution.Repository, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scheme := "https"
+	if opts.PlainHTTP {
+		scheme = "http"
+	}
+	name, err := reference.WithName(reference.Path(named))
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := remote.NewRepository(name, &url.URL{Scheme: scheme, Host: reference.Domain(named)}, opts.Auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	return named, repo, nil
+}
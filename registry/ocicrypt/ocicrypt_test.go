@@ -0,0 +1,250 @@
+package ocicrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/registrytest"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// The content of the config and of the single layer of the image in
+// testdata/manifest.json, encrypted for testdata/private.pem.
+const (
+	fixtureConfig = `{"architecture":"amd64","os":"linux"}`
+	fixtureLayer  = "layer encrypted by the fixture key\n"
+)
+
+var plainHTTP = Options{PlainHTTP: true}
+
+func getManifest(t *testing.T, repo distribution.Repository, dgst digest.Digest) *ocischema.DeserializedManifest {
+	t.Helper()
+	ctx := context.Background()
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ms.Get(ctx, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.(*ocischema.DeserializedManifest)
+}
+
+// pushImage pushes an image with a tar and a gzip layer to repo, tagged
+// with tag, and returns its digest.
+func pushImage(t *testing.T, repo distribution.Repository, tag string) digest.Digest {
+	t.Helper()
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    registrytest.PutBlob(t, repo, v1.MediaTypeImageConfig, []byte(fixtureConfig)),
+		Layers: []distribution.Descriptor{
+			registrytest.PutBlob(t, repo, v1.MediaTypeImageLayer, []byte("tar layer of "+tag)),
+			registrytest.PutBlob(t, repo, v1.MediaTypeImageLayerGzip, []byte("gzip layer of "+tag)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registrytest.PutManifest(t, repo, tag, m).Digest
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ctx := context.Background()
+	base := registrytest.New(t)
+	host := base.Host
+	repo := registrytest.Repository(t, base, "foo/app", nil)
+	dgst := pushImage(t, repo, "1.0")
+	original := getManifest(t, repo, dgst)
+	alice, bob := generateKey(t), generateKey(t)
+
+	encrypted, err := Encrypt(ctx, host+"/foo/app:1.0", []*rsa.PublicKey{&alice.PublicKey}, nil, plainHTTP)
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	m := getManifest(t, repo, encrypted.Digest)
+	for i, layer := range m.Layers {
+		if layer.MediaType != original.Layers[i].MediaType+"+encrypted" {
+			t.Errorf("unexpected media type of encrypted layer: %s", layer.MediaType)
+		}
+		if err := ocischema.ValidateEncryptedLayer(layer); err != nil {
+			t.Error(err)
+		}
+		p, err := repo.Blobs(ctx).Get(ctx, layer.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := repo.Blobs(ctx).Get(ctx, original.Layers[i].Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(p, plain) {
+			t.Errorf("layer %s stored in the clear", layer.Digest)
+		}
+	}
+
+	// Encrypting again leaves the encrypted layers as they are.
+	again, err := Encrypt(ctx, host+"/foo/app@"+encrypted.Digest.String(), []*rsa.PublicKey{&bob.PublicKey}, nil, plainHTTP)
+	if err != nil {
+		t.Fatalf("error encrypting again: %v", err)
+	}
+	if again.Digest != encrypted.Digest {
+		t.Errorf("encrypting an encrypted image changed it to %s", again.Digest)
+	}
+
+	if _, err := Decrypt(ctx, host+"/foo/app:1.0", bob, plainHTTP); !errors.Is(err, ErrNoMatchingKey) {
+		t.Fatalf("expected %v decrypting with another key, got %v", ErrNoMatchingKey, err)
+	}
+
+	decrypted, err := Decrypt(ctx, host+"/foo/app:1.0", alice, plainHTTP)
+	if err != nil {
+		t.Fatalf("error decrypting: %v", err)
+	}
+	if decrypted.Digest != dgst {
+		t.Fatalf("decrypted manifest %s differs from the original %s", decrypted.Digest, dgst)
+	}
+}
+
+func TestEncryptAddsRecipients(t *testing.T) {
+	ctx := context.Background()
+	base := registrytest.New(t)
+	host := base.Host
+	repo := registrytest.Repository(t, base, "foo/app", nil)
+	dgst := pushImage(t, repo, "1.0")
+	alice, bob := generateKey(t), generateKey(t)
+
+	encrypted, err := Encrypt(ctx, host+"/foo/app:1.0", []*rsa.PublicKey{&alice.PublicKey}, nil, plainHTTP)
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	shared, err := Encrypt(ctx, host+"/foo/app:1.0", []*rsa.PublicKey{&bob.PublicKey}, alice, plainHTTP)
+	if err != nil {
+		t.Fatalf("error adding recipient: %v", err)
+	}
+
+	// The layers are not encrypted again, only their keys are wrapped for
+	// the new recipient.
+	before, after := getManifest(t, repo, encrypted.Digest), getManifest(t, repo, shared.Digest)
+	for i := range before.Layers {
+		if before.Layers[i].Digest != after.Layers[i].Digest {
+			t.Errorf("layer %s was encrypted again as %s", before.Layers[i].Digest, after.Layers[i].Digest)
+		}
+	}
+
+	for _, key := range []*rsa.PrivateKey{alice, bob} {
+		decrypted, err := Decrypt(ctx, host+"/foo/app@"+shared.Digest.String(), key, plainHTTP)
+		if err != nil {
+			t.Fatalf("error decrypting: %v", err)
+		}
+		if decrypted.Digest != dgst {
+			t.Fatalf("decrypted manifest %s differs from the original %s", decrypted.Digest, dgst)
+		}
+	}
+}
+
+// pushFixture pushes the image of testdata/manifest.json, with layer as the
+// content of its layer, to repo tagged latest.
+func pushFixture(t *testing.T, repo distribution.Repository, layer []byte) {
+	t.Helper()
+
+	p, err := os.ReadFile("testdata/manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(ocischema.DeserializedManifest)
+	if err := m.UnmarshalJSON(p); err != nil {
+		t.Fatal(err)
+	}
+	fixture := m.Manifest
+
+	registrytest.PutBlob(t, repo, v1.MediaTypeImageConfig, []byte(fixtureConfig))
+	desc := registrytest.PutBlob(t, repo, fixture.Layers[0].MediaType, layer)
+	fixture.Layers[0].Digest, fixture.Layers[0].Size = desc.Digest, desc.Size
+	rewritten, err := ocischema.FromStruct(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrytest.PutManifest(t, repo, "latest", rewritten)
+}
+
+func TestDecryptFixture(t *testing.T) {
+	ctx := context.Background()
+	key, err := LoadPrivateKey("testdata/private.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := os.ReadFile("testdata/layer.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := registrytest.New(t)
+	repo := registrytest.Repository(t, base, "foo/fixture", nil)
+	pushFixture(t, repo, layer)
+	decrypted, err := Decrypt(ctx, base.Host+"/foo/fixture:latest", key, plainHTTP)
+	if err != nil {
+		t.Fatalf("error decrypting fixture: %v", err)
+	}
+
+	m := getManifest(t, repo, decrypted.Digest)
+	if len(m.Layers) != 1 || m.Layers[0].MediaType != v1.MediaTypeImageLayer || len(m.Layers[0].Annotations) != 0 {
+		t.Fatalf("unexpected decrypted layers: %+v", m.Layers)
+	}
+	if m.Layers[0].Digest != digest.FromString(fixtureLayer) {
+		t.Fatalf("unexpected digest of decrypted layer: %s", m.Layers[0].Digest)
+	}
+	p, err := repo.Blobs(ctx).Get(ctx, m.Layers[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != fixtureLayer {
+		t.Fatalf("unexpected decrypted layer %q", p)
+	}
+}
+
+func TestDecryptTamperedLayer(t *testing.T) {
+	key, err := LoadPrivateKey("testdata/private.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := os.ReadFile("testdata/layer.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer[0] ^= 0xff
+
+	base := registrytest.New(t)
+	pushFixture(t, registrytest.Repository(t, base, "foo/fixture", nil), layer)
+	if _, err := Decrypt(context.Background(), base.Host+"/foo/fixture:latest", key, plainHTTP); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected %v decrypting a tampered layer, got %v", ErrIntegrity, err)
+	}
+}
+
+func TestLoadPublicKey(t *testing.T) {
+	if _, err := LoadPublicKey("testdata/private.pem"); err == nil {
+		t.Fatal("expected an error loading a private key as a public key")
+	}
+	if _, err := LoadPrivateKey("testdata/manifest.json"); err == nil {
+		t.Fatal("expected an error loading a file without PEM data")
+	}
+}
@@ -0,0 +1,281 @@
+package ocilayout
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/opencontainers/go-digest"
+)
+
+// blobStore implements distribution.BlobStore on the blobs directory of the
+// layout. The layout does not record the media type of blobs, so they are
+// described as application/octet-stream.
+type blobStore struct {
+	repo *repository
+}
+
+var _ distribution.BlobStore = &blobStore{}
+
+func (bs *blobStore) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	path, err := bs.path(dgst)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return distribution.Descriptor{}, distribution.ErrBlobUnknown
+		}
+		return distribution.Descriptor{}, err
+	}
+
+	return distribution.Descriptor{
+		MediaType: "application/octet-stream",
+		Digest:    dgst,
+		Size:      fi.Size(),
+	}, nil
+}
+
+func (bs *blobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	rc, err := bs.Open(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+func (bs *blobStore) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	path, err := bs.path(dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, distribution.ErrBlobUnknown
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (bs *blobStore) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
+	desc, err := bs.Stat(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	rc, err := bs.Open(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if w.Header().Get("Docker-Content-Digest") == "" {
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", desc.MediaType)
+	}
+	if w.Header().Get("Etag") == "" {
+		w.Header().Set("Etag", strconv.Quote(dgst.String()))
+	}
+	http.ServeContent(w, r, dgst.String(), time.Time{}, rc)
+	return nil
+}
+
+func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
+	dgst := digest.FromBytes(p)
+	path, err := bs.path(dgst)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if err := writeFileAtomic(path, p); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(p)),
+	}, nil
+}
+
+func (bs *blobStore) Create(ctx context.Context, options ...distribution.BlobCreateOption) (distribution.BlobWriter, error) {
+	var opts distribution.CreateOptions
+	for _, option := range options {
+		if err := option.Apply(&opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Mount.ShouldMount {
+		return nil, distribution.ErrUnsupported
+	}
+
+	dir := filepath.Join(bs.repo.dir, uploadsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	id := uuid.Generate().String()
+	f, err := os.OpenFile(filepath.Join(dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &blobWriter{bs: bs, id: id, file: f, startedAt: time.Now()}, nil
+}
+
+func (bs *blobStore) Resume(ctx context.Context, id string) (distribution.BlobWriter, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, distribution.ErrBlobUploadUnknown
+	}
+
+	path := filepath.Join(bs.repo.dir, uploadsDir, id)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, distribution.ErrBlobUploadUnknown
+		}
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &blobWriter{bs: bs, id: id, file: f, size: fi.Size(), startedAt: fi.ModTime()}, nil
+}
+
+func (bs *blobStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	path, err := bs.path(dgst)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return distribution.ErrBlobUnknown
+		}
+		return err
+	}
+	return nil
+}
+
+func (bs *blobStore) path(dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", distribution.ErrBlobInvalidDigest{Digest: dgst, Reason: err}
+	}
+	return bs.repo.blobPath(dgst.String())
+}
+
+// blobWriter writes a blob to a file in the uploads directory, which is
+// moved into the blobs directory on commit.
+type blobWriter struct {
+	bs        *blobStore
+	id        string
+	file      *os.File
+	size      int64
+	startedAt time.Time
+}
+
+var _ distribution.BlobWriter = &blobWriter{}
+
+func (bw *blobWriter) Write(p []byte) (int, error) {
+	n, err := bw.file.Write(p)
+	bw.size += int64(n)
+	return n, err
+}
+
+func (bw *blobWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(bw.file, r)
+	bw.size += n
+	return n, err
+}
+
+func (bw *blobWriter) Close() error {
+	return bw.file.Close()
+}
+
+func (bw *blobWriter) Size() int64 {
+	return bw.size
+}
+
+func (bw *blobWriter) ID() string {
+	return bw.id
+}
+
+func (bw *blobWriter) StartedAt() time.Time {
+	return bw.startedAt
+}
+
+func (bw *blobWriter) Commit(ctx context.Context, provisional distribution.Descriptor) (distribution.Descriptor, error) {
+	// Closing twice is harmless, the error of the second close is ignored.
+	bw.file.Close()
+	uploadPath := bw.file.Name()
+
+	path, err := bw.bs.path(provisional.Digest)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if provisional.Size > 0 && provisional.Size != bw.size {
+		return distribution.Descriptor{}, distribution.ErrBlobInvalidLength
+	}
+
+	f, err := os.Open(uploadPath)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	verifier := provisional.Digest.Verifier()
+	_, err = io.Copy(verifier, f)
+	f.Close()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if !verifier.Verified() {
+		return distribution.Descriptor{}, distribution.ErrBlobInvalidDigest{
+			Digest: provisional.Digest,
+			Reason: errors.New("content does not match digest"),
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if err := os.Rename(uploadPath, path); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	mediaType := provisional.MediaType
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    provisional.Digest,
+		Size:      bw.size,
+	}, nil
+}
+
+func (bw *blobWriter) Cancel(ctx context.Context) error {
+	bw.file.Close()
+	if err := os.Remove(bw.file.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
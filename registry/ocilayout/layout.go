@@ -0,0 +1,214 @@
+// Package ocilayout provides a distribution.Repository backed by an OCI image
+// layout directory, as described by the OCI image specification. It allows
+// tools to handle local layouts and remote registries through the same
+// interfaces.
+package ocilayout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	// Register the manifest schemas which may be found in a layout.
+	_ "github.com/distribution/distribution/v3/manifest/manifestlist"
+	_ "github.com/distribution/distribution/v3/manifest/ocischema"
+	_ "github.com/distribution/distribution/v3/manifest/schema2"
+)
+
+const (
+	// indexFile is the name of the image index at the root of the layout.
+	indexFile = "index.json"
+
+	// blobsDir holds the content of the layout, by digest.
+	blobsDir = "blobs"
+
+	// uploadsDir holds in progress blob writes. It is not part of the layout
+	// specification, and is ignored by other implementations.
+	uploadsDir = ".uploads"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// repository is a distribution.Repository backed by an OCI image layout.
+type repository struct {
+	dir  string
+	name reference.Named
+
+	// mu guards index.json.
+	mu sync.Mutex
+}
+
+var _ distribution.Repository = &repository{}
+
+// NewOCILayoutRepository returns a repository reading from and writing to the
+// OCI image layout in dir. The layout is created if dir does not exist or is
+// empty. Manifests and blobs are stored under blobs/, tags are the
+// org.opencontainers.image.ref.name annotations of the entries of
+// index.json.
+func NewOCILayoutRepository(dir string) (distribution.Repository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	layoutPath := filepath.Join(dir, v1.ImageLayoutFile)
+	p, err := os.ReadFile(layoutPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		p, err = json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(layoutPath, p, 0o644); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		var layout v1.ImageLayout
+		if err := json.Unmarshal(p, &layout); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", v1.ImageLayoutFile, err)
+		}
+		if layout.Version != v1.ImageLayoutVersion {
+			return nil, fmt.Errorf("unsupported image layout version %q", layout.Version)
+		}
+	}
+
+	repo := &repository{
+		dir:  dir,
+		name: layoutName(dir),
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, indexFile)); errors.Is(err, os.ErrNotExist) {
+		if err := repo.writeIndex(&v1.Index{}); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// layoutName derives a repository name from the name of the layout
+// directory. Layouts are not named, but a repository must be.
+func layoutName(dir string) reference.Named {
+	abs, err := filepath.Abs(dir)
+	if err == nil {
+		dir = abs
+	}
+
+	base := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(filepath.Base(dir)), "-"), "._-")
+	if name, err := reference.WithName(base); err == nil {
+		return name
+	}
+
+	name, _ := reference.WithName("layout")
+	return name
+}
+
+func (r *repository) Named() reference.Named {
+	return r.name
+}
+
+func (r *repository) Manifests(ctx context.Context, options ...distribution.ManifestServiceOption) (distribution.ManifestService, error) {
+	ms := &manifestService{repo: r}
+	for _, option := range options {
+		if err := option.Apply(ms); err != nil {
+			return nil, err
+		}
+	}
+	return ms, nil
+}
+
+func (r *repository) Blobs(ctx context.Context) distribution.BlobStore {
+	return &blobStore{repo: r}
+}
+
+func (r *repository) Tags(ctx context.Context) distribution.TagService {
+	return &tagService{repo: r}
+}
+
+// blobPath returns the path of the blob identified by dgst.
+func (r *repository) blobPath(dgst string) (string, error) {
+	parts := strings.SplitN(dgst, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(dgst, `/\`) {
+		return "", fmt.Errorf("invalid digest %q", dgst)
+	}
+	return filepath.Join(r.dir, blobsDir, parts[0], parts[1]), nil
+}
+
+// readIndex reads index.json. The caller must hold mu.
+func (r *repository) readIndex() (*v1.Index, error) {
+	p, err := os.ReadFile(filepath.Join(r.dir, indexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var index v1.Index
+	if err := json.Unmarshal(p, &index); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", indexFile, err)
+	}
+	return &index, nil
+}
+
+// writeIndex replaces index.json. The caller must hold mu.
+func (r *repository) writeIndex(index *v1.Index) error {
+	index.SchemaVersion = 2
+	index.MediaType = v1.MediaTypeImageIndex
+	if index.Manifests == nil {
+		index.Manifests = []v1.Descriptor{}
+	}
+
+	p, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(r.dir, indexFile), p)
+}
+
+// updateIndex applies update to index.json.
+func (r *repository) updateIndex(update func(index *v1.Index) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index, err := r.readIndex()
+	if err != nil {
+		return err
+	}
+	if err := update(index); err != nil {
+		return err
+	}
+	return r.writeIndex(index)
+}
+
+// writeFileAtomic writes p to a temporary file next to path, and renames it
+// into place.
+func writeFileAtomic(path string, p []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
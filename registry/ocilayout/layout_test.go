@@ -0,0 +1,351 @@
+package ocilayout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func newTestRepository(t *testing.T) (distribution.Repository, string) {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "My Layout")
+	repo, err := NewOCILayoutRepository(dir)
+	if err != nil {
+		t.Fatalf("unexpected error creating layout: %v", err)
+	}
+	return repo, dir
+}
+
+func TestNewOCILayoutRepository(t *testing.T) {
+	repo, dir := newTestRepository(t)
+
+	if name := repo.Named().Name(); name != "my-layout" {
+		t.Fatalf("unexpected repository name: %s", name)
+	}
+
+	p, err := os.ReadFile(filepath.Join(dir, v1.ImageLayoutFile))
+	if err != nil {
+		t.Fatalf("layout file not written: %v", err)
+	}
+	if string(p) != `{"imageLayoutVersion":"1.0.0"}` {
+		t.Fatalf("unexpected layout file: %s", p)
+	}
+
+	p, err = os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+	if string(p) != `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}` {
+		t.Fatalf("unexpected index: %s", p)
+	}
+
+	// Existing layouts are opened as is.
+	if _, err := NewOCILayoutRepository(dir); err != nil {
+		t.Fatalf("unexpected error opening layout: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, v1.ImageLayoutFile), []byte(`{"imageLayoutVersion":"2.0.0"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOCILayoutRepository(dir); err == nil {
+		t.Fatal("expected error opening layout with unsupported version")
+	}
+}
+
+func TestBlobStore(t *testing.T) {
+	ctx := context.Background()
+	repo, dir := newTestRepository(t)
+	bs := repo.Blobs(ctx)
+
+	content := []byte("some blob content")
+	desc, err := bs.Put(ctx, v1.MediaTypeImageLayer, content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	if desc.Digest != digest.FromBytes(content) || desc.Size != int64(len(content)) || desc.MediaType != v1.MediaTypeImageLayer {
+		t.Fatalf("unexpected descriptor: %v", desc)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "sha256", desc.Digest.Hex())); err != nil {
+		t.Fatalf("blob not stored in layout: %v", err)
+	}
+
+	stat, err := bs.Stat(ctx, desc.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error statting blob: %v", err)
+	}
+	if stat.Size != desc.Size {
+		t.Fatalf("unexpected size: %d", stat.Size)
+	}
+
+	p, err := bs.Get(ctx, desc.Digest)
+	if err != nil || !bytes.Equal(p, content) {
+		t.Fatalf("unexpected blob content %q: %v", p, err)
+	}
+
+	rc, err := bs.Open(ctx, desc.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error opening blob: %v", err)
+	}
+	if _, err := rc.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(p, content[5:]) {
+		t.Fatalf("unexpected content after seek: %q", p)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := bs.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) || w.Header().Get("Docker-Content-Digest") != desc.Digest.String() {
+		t.Fatalf("unexpected response: %d %v %q", w.Code, w.Header(), w.Body.Bytes())
+	}
+
+	if err := bs.Delete(ctx, desc.Digest); err != nil {
+		t.Fatalf("unexpected error deleting blob: %v", err)
+	}
+	if _, err := bs.Stat(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob, got %v", err)
+	}
+	if err := bs.Delete(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob, got %v", err)
+	}
+	if _, err := bs.Open(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob, got %v", err)
+	}
+}
+
+func TestBlobWriter(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestRepository(t)
+	bs := repo.Blobs(ctx)
+
+	content := []byte("content written in two parts")
+	dgst := digest.FromBytes(content)
+
+	bw, err := bs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	if _, err := bw.Write(content[:10]); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bw, err = bs.Resume(ctx, bw.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming writer: %v", err)
+	}
+	if bw.Size() != 10 {
+		t.Fatalf("unexpected size after resume: %d", bw.Size())
+	}
+	if _, err := bw.ReadFrom(bytes.NewReader(content[10:])); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bw.Commit(ctx, distribution.Descriptor{Digest: digest.FromString("wrong")}); err == nil {
+		t.Fatal("expected error committing with wrong digest")
+	}
+	desc, err := bw.Commit(ctx, distribution.Descriptor{Digest: dgst, Size: int64(len(content))})
+	if err != nil {
+		t.Fatalf("unexpected error committing: %v", err)
+	}
+	if desc.Digest != dgst || desc.Size != int64(len(content)) {
+		t.Fatalf("unexpected descriptor: %v", desc)
+	}
+	if p, err := bs.Get(ctx, dgst); err != nil || !bytes.Equal(p, content) {
+		t.Fatalf("unexpected committed content %q: %v", p, err)
+	}
+	if _, err := bs.Resume(ctx, bw.ID()); err != distribution.ErrBlobUploadUnknown {
+		t.Fatalf("expected unknown upload after commit, got %v", err)
+	}
+
+	bw, err = bs.Create(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bw.Write(content)
+	if err := bw.Cancel(ctx); err != nil {
+		t.Fatalf("unexpected error cancelling: %v", err)
+	}
+	if _, err := bs.Resume(ctx, bw.ID()); err != distribution.ErrBlobUploadUnknown {
+		t.Fatalf("expected unknown upload after cancel, got %v", err)
+	}
+}
+
+func TestManifestsAndTags(t *testing.T) {
+	ctx := context.Background()
+	repo, dir := newTestRepository(t)
+	bs := repo.Blobs(ctx)
+
+	config, err := bs.Put(ctx, v1.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := bs.Put(ctx, v1.MediaTypeImageLayer, []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := ms.Put(ctx, m, distribution.WithTag("latest"))
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	if exists, err := ms.Exists(ctx, dgst); err != nil || !exists {
+		t.Fatalf("expected manifest to exist: %v", err)
+	}
+	got, err := ms.Get(ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest: %v", err)
+	}
+	if _, ok := got.(*ocischema.DeserializedManifest); !ok {
+		t.Fatalf("unexpected manifest type: %T", got)
+	}
+	got, err = ms.Get(ctx, "", distribution.WithTag("latest"))
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest by tag: %v", err)
+	}
+	if !reflect.DeepEqual(got.References(), m.References()) {
+		t.Fatalf("unexpected references: %v", got.References())
+	}
+
+	tags := repo.Tags(ctx)
+	desc, err := tags.Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error getting tag: %v", err)
+	}
+	if desc.Digest != dgst || desc.MediaType != v1.MediaTypeImageManifest {
+		t.Fatalf("unexpected tag descriptor: %v", desc)
+	}
+	if err := tags.Tag(ctx, "v1", desc); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+	// Retagging replaces the previous entry.
+	if err := tags.Tag(ctx, "v1", desc); err != nil {
+		t.Fatalf("unexpected error retagging: %v", err)
+	}
+
+	all, err := tags.All(ctx)
+	if err != nil || !reflect.DeepEqual(all, []string{"latest", "v1"}) {
+		t.Fatalf("unexpected tags %v: %v", all, err)
+	}
+	found, err := tags.Lookup(ctx, desc)
+	if err != nil || !reflect.DeepEqual(found, []string{"latest", "v1"}) {
+		t.Fatalf("unexpected lookup %v: %v", found, err)
+	}
+
+	// The tags are recorded in index.json, where other tools find them.
+	p, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index v1.Index
+	if err := json.Unmarshal(p, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 2 || index.Manifests[1].Annotations[v1.AnnotationRefName] != "v1" {
+		t.Fatalf("unexpected index: %s", p)
+	}
+
+	if err := tags.Rename(ctx, "v1", "latest"); err == nil {
+		t.Fatal("expected error renaming onto an existing tag")
+	}
+	if err := tags.Rename(ctx, "v1", "v2"); err != nil {
+		t.Fatalf("unexpected error renaming tag: %v", err)
+	}
+	all, err = tags.All(ctx)
+	if err != nil || !reflect.DeepEqual(all, []string{"latest", "v2"}) {
+		t.Fatalf("unexpected tags after rename %v: %v", all, err)
+	}
+
+	if err := tags.Untag(ctx, "v2"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+	if err := tags.Untag(ctx, "v1"); err == nil {
+		t.Fatal("expected error untagging unknown tag")
+	}
+	if _, err := tags.Get(ctx, "v1"); err == nil {
+		t.Fatal("expected error getting removed tag")
+	}
+
+	if err := ms.Delete(ctx, dgst); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	if exists, err := ms.Exists(ctx, dgst); err != nil || exists {
+		t.Fatalf("expected manifest to be deleted: %v", err)
+	}
+	if all, _ := tags.All(ctx); len(all) != 0 {
+		t.Fatalf("expected tags of deleted manifest to be removed: %v", all)
+	}
+	if _, err := ms.Get(ctx, dgst); err == nil {
+		t.Fatal("expected error getting deleted manifest")
+	}
+	if err := ms.Delete(ctx, dgst); err == nil {
+		t.Fatal("expected error deleting unknown manifest")
+	}
+}
+
+func TestManifestMediaType(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestRepository(t)
+
+	// OCI manifests and indexes may omit their media type.
+	for _, tc := range []struct {
+		payload  string
+		expected interface{}
+	}{
+		{
+			payload:  `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`,
+			expected: &ocischema.DeserializedManifest{},
+		},
+		{
+			payload:  `{"schemaVersion":2,"manifests":[]}`,
+			expected: &manifestlist.DeserializedManifestList{},
+		},
+	} {
+		desc, err := repo.Blobs(ctx).Put(ctx, "", []byte(tc.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms, _ := repo.Manifests(ctx)
+		m, err := ms.Get(ctx, desc.Digest)
+		if err != nil {
+			t.Fatalf("unexpected error getting manifest %s: %v", tc.payload, err)
+		}
+		if reflect.TypeOf(m) != reflect.TypeOf(tc.expected) {
+			t.Fatalf("unexpected manifest type for %s: %T", tc.payload, m)
+		}
+	}
+}
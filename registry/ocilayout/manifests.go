@@ -0,0 +1,139 @@
+package ocilayout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// manifestService implements distribution.ManifestService on the blobs of
+// the layout. Manifests are stored as regular blobs, and tagged through
+// index.json.
+type manifestService struct {
+	repo *repository
+}
+
+var _ distribution.ManifestService = &manifestService{}
+
+func (ms *manifestService) Exists(ctx context.Context, dgst digest.Digest) (bool, error) {
+	_, err := ms.blobs().Stat(ctx, dgst)
+	switch err {
+	case nil:
+		return true, nil
+	case distribution.ErrBlobUnknown:
+		return false, nil
+	}
+	return false, err
+}
+
+func (ms *manifestService) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	for _, option := range options {
+		if opt, ok := option.(distribution.WithTagOption); ok {
+			desc, err := ms.repo.Tags(ctx).Get(ctx, opt.Tag)
+			if err != nil {
+				return nil, err
+			}
+			dgst = desc.Digest
+		}
+	}
+
+	p, err := ms.blobs().Get(ctx, dgst)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return nil, distribution.ErrManifestUnknownRevision{
+				Name:     ms.repo.Named().Name(),
+				Revision: dgst,
+			}
+		}
+		return nil, err
+	}
+
+	mediaType, err := manifestMediaType(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m, _, err := distribution.UnmarshalManifest(mediaType, p)
+	return m, err
+}
+
+func (ms *manifestService) Put(ctx context.Context, m distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
+	mediaType, p, err := m.Payload()
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := ms.blobs().Put(ctx, mediaType, p)
+	if err != nil {
+		return "", err
+	}
+
+	for _, option := range options {
+		if opt, ok := option.(distribution.WithTagOption); ok {
+			if err := ms.repo.Tags(ctx).Tag(ctx, opt.Tag, desc); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return desc.Digest, nil
+}
+
+// Delete removes the manifest blob, along with the entries of index.json
+// referencing it.
+func (ms *manifestService) Delete(ctx context.Context, dgst digest.Digest) error {
+	if err := ms.blobs().Delete(ctx, dgst); err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return distribution.ErrManifestUnknownRevision{
+				Name:     ms.repo.Named().Name(),
+				Revision: dgst,
+			}
+		}
+		return err
+	}
+
+	return ms.repo.updateIndex(func(index *v1.Index) error {
+		manifests := index.Manifests[:0]
+		for _, desc := range index.Manifests {
+			if desc.Digest != dgst {
+				manifests = append(manifests, desc)
+			}
+		}
+		index.Manifests = manifests
+		return nil
+	})
+}
+
+func (ms *manifestService) blobs() *blobStore {
+	return &blobStore{repo: ms.repo}
+}
+
+// manifestMediaType returns the media type of the manifest p. OCI manifests
+// and indexes are not required to carry their media type, in which case it
+// is inferred from their content.
+func manifestMediaType(p []byte) (string, error) {
+	var versioned struct {
+		SchemaVersion int             `json:"schemaVersion"`
+		MediaType     string          `json:"mediaType"`
+		Manifests     json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(p, &versioned); err != nil {
+		return "", err
+	}
+	if versioned.SchemaVersion != 2 {
+		return "", fmt.Errorf("unsupported manifest schema version %d", versioned.SchemaVersion)
+	}
+
+	switch {
+	case versioned.MediaType != "":
+		return versioned.MediaType, nil
+	case versioned.Manifests != nil:
+		return v1.MediaTypeImageIndex, nil
+	default:
+		return v1.MediaTypeImageManifest, nil
+	}
+}
@@ -0,0 +1,164 @@
+package ocilayout
+
+import (
+	"context"
+	"sort"
+
+	"github.com/distribution/distribution/v3"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// tagService implements distribution.TagService on index.json. A tag is the
+// org.opencontainers.image.ref.name annotation of an entry.
+type tagService struct {
+	repo *repository
+}
+
+var _ distribution.TagService = &tagService{}
+
+func (ts *tagService) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	index, err := ts.index()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Annotations[v1.AnnotationRefName] == tag {
+			return distribution.Descriptor{
+				MediaType: desc.MediaType,
+				Digest:    desc.Digest,
+				Size:      desc.Size,
+			}, nil
+		}
+	}
+	return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+}
+
+func (ts *tagService) Exists(ctx context.Context, tag string) (bool, error) {
+	_, err := ts.Get(ctx, tag)
+	if err != nil {
+		if _, ok := err.(distribution.ErrTagUnknown); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (ts *tagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor, opts ...distribution.TagOption) error {
+	return ts.repo.updateIndex(func(index *v1.Index) error {
+		index.Manifests = removeTag(index.Manifests, tag)
+		index.Manifests = append(index.Manifests, v1.Descriptor{
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+			Annotations: map[string]string{
+				v1.AnnotationRefName: tag,
+			},
+		})
+		return nil
+	})
+}
+
+func (ts *tagService) Untag(ctx context.Context, tag string) error {
+	return ts.repo.updateIndex(func(index *v1.Index) error {
+		manifests := removeTag(index.Manifests, tag)
+		if len(manifests) == len(index.Manifests) {
+			return distribution.ErrTagUnknown{Tag: tag}
+		}
+		index.Manifests = manifests
+		return nil
+	})
+}
+
+func (ts *tagService) Rename(ctx context.Context, src, dst string) error {
+	return ts.repo.updateIndex(func(index *v1.Index) error {
+		renamed := -1
+		for i, desc := range index.Manifests {
+			switch desc.Annotations[v1.AnnotationRefName] {
+			case dst:
+				return distribution.ErrTagConflict{Tag: src, ExistingTag: dst}
+			case src:
+				renamed = i
+			}
+		}
+		if renamed < 0 {
+			return distribution.ErrTagUnknown{Tag: src}
+		}
+		annotations := make(map[string]string, len(index.Manifests[renamed].Annotations))
+		for key, value := range index.Manifests[renamed].Annotations {
+			annotations[key] = value
+		}
+		annotations[v1.AnnotationRefName] = dst
+		index.Manifests[renamed].Annotations = annotations
+		return nil
+	})
+}
+
+func (ts *tagService) All(ctx context.Context) ([]string, error) {
+	index, err := ts.index()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, desc := range index.Manifests {
+		if tag, ok := desc.Annotations[v1.AnnotationRefName]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (ts *tagService) AllPaged(ctx context.Context, last string, count int) ([]string, error) {
+	tags, err := ts.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return distribution.PageTags(tags, last, count), nil
+}
+
+func (ts *tagService) Lookup(ctx context.Context, digest distribution.Descriptor, opts ...distribution.LookupOption) ([]string, error) {
+	index, err := ts.index()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	for _, desc := range index.Manifests {
+		if tag, ok := desc.Annotations[v1.AnnotationRefName]; ok && desc.Digest == digest.Digest {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// History returns the current descriptor of tag, as the index of the
+// layout only holds the current descriptors of the tags.
+func (ts *tagService) History(ctx context.Context, tag string) ([]distribution.Descriptor, error) {
+	desc, err := ts.Get(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return []distribution.Descriptor{desc}, nil
+}
+
+func (ts *tagService) index() (*v1.Index, error) {
+	ts.repo.mu.Lock()
+	defer ts.repo.mu.Unlock()
+
+	return ts.repo.readIndex()
+}
+
+// removeTag returns the entries of manifests not named tag.
+func removeTag(manifests []v1.Descriptor, tag string) []v1.Descriptor {
+	var kept []v1.Descriptor
+	for _, desc := range manifests {
+		if desc.Annotations[v1.AnnotationRefName] != tag {
+			kept = append(kept, desc)
+		}
+	}
+	return kept
+}
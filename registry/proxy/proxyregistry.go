@@ -26,6 +26,7 @@ type proxyingRegistry struct {
 	scheduler      *scheduler.TTLExpirationScheduler
 	remoteURL      url.URL
 	authChallenger authChallenger
+	transport      http.RoundTripper
 }
 
 // NewRegistryPullThroughCache creates a registry acting as a pull through cache
@@ -98,10 +99,16 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 		return nil, err
 	}
 
+	tr := http.DefaultTransport
+	if config.ResilientTransport {
+		tr = transport.NewResilientTransport(transport.TransportConfig{RequestID: true})
+	}
+
 	return &proxyingRegistry{
 		embedded:  registry,
 		scheduler: s,
 		remoteURL: *remoteURL,
+		transport: tr,
 		authChallenger: &remoteAuthChallenger{
 			remoteURL: *remoteURL,
 			cm:        challenge.NewSimpleManager(),
@@ -122,7 +129,7 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 	c := pr.authChallenger
 
 	tkopts := auth.TokenHandlerOptions{
-		Transport:   http.DefaultTransport,
+		Transport:   pr.transport,
 		Credentials: c.credentialStore(),
 		Scopes: []auth.Scope{
 			auth.RepositoryScope{
@@ -133,7 +140,7 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 		Logger: dcontext.GetLogger(ctx),
 	}
 
-	tr := transport.NewTransport(http.DefaultTransport,
+	tr := transport.NewTransport(pr.transport,
 		auth.NewAuthorizer(c.challengeManager(),
 			auth.NewTokenHandlerWithOptions(tkopts)))
 
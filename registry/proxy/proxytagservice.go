@@ -24,7 +24,8 @@ func (pt proxyTagService) Get(ctx context.Context, tag string) (distribution.Des
 		desc, err := pt.remoteTags.Get(ctx, tag)
 		if err == nil {
 			err := pt.localTags.Tag(ctx, tag, desc)
-			if err != nil {
+			// In read-only mode, the tag is served without being cached.
+			if err != nil && err != distribution.ErrReadOnly {
 				return distribution.Descriptor{}, err
 			}
 			return desc, nil
@@ -38,7 +39,24 @@ func (pt proxyTagService) Get(ctx context.Context, tag string) (distribution.Des
 	return desc, nil
 }
 
-func (pt proxyTagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+// Exists checks the remote tag service first, without caching the tag
+// locally, and then the local tag service.
+func (pt proxyTagService) Exists(ctx context.Context, tag string) (bool, error) {
+	err := pt.authChallenger.tryEstablishChallenges(ctx)
+	if err == nil {
+		exists, err := pt.remoteTags.Exists(ctx, tag)
+		if err == nil && exists {
+			return true, nil
+		}
+	}
+	return pt.localTags.Exists(ctx, tag)
+}
+
+func (pt proxyTagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor, opts ...distribution.TagOption) error {
+	return distribution.ErrUnsupported
+}
+
+func (pt proxyTagService) Rename(ctx context.Context, src, dst string) error {
 	return distribution.ErrUnsupported
 }
 
@@ -61,6 +79,23 @@ func (pt proxyTagService) All(ctx context.Context) ([]string, error) {
 	return pt.localTags.All(ctx)
 }
 
-func (pt proxyTagService) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
+func (pt proxyTagService) AllPaged(ctx context.Context, last string, count int) ([]string, error) {
+	err := pt.authChallenger.tryEstablishChallenges(ctx)
+	if err == nil {
+		tags, err := pt.remoteTags.AllPaged(ctx, last, count)
+		if err == nil {
+			return tags, err
+		}
+	}
+	return pt.localTags.AllPaged(ctx, last, count)
+}
+
+func (pt proxyTagService) Lookup(ctx context.Context, digest distribution.Descriptor, opts ...distribution.LookupOption) ([]string, error) {
 	return []string{}, distribution.ErrUnsupported
 }
+
+// History returns the history of the tag cached locally, as the remote API
+// has no history of tags.
+func (pt proxyTagService) History(ctx context.Context, tag string) ([]distribution.Descriptor, error) {
+	return pt.localTags.History(ctx, tag)
+}
@@ -26,7 +26,7 @@ func (m *mockTagStore) Get(ctx context.Context, tag string) (distribution.Descri
 	return distribution.Descriptor{}, distribution.ErrTagUnknown{}
 }
 
-func (m *mockTagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+func (m *mockTagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor, opts ...distribution.TagOption) error {
 	m.Lock()
 	defer m.Unlock()
 
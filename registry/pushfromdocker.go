@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/distribution/distribution/v3/registry/dockersave"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dockerSocket        string
+	pushDockerUsername  string
+	pushDockerPassword  string
+	pushDockerPlainHTTP bool
+)
+
+func init() {
+	PushFromDockerCmd.Flags().StringVar(&dockerSocket, "socket", dockersave.DefaultSocket, "path of the Docker daemon socket")
+	PushFromDockerCmd.Flags().StringVarP(&pushDockerUsername, "username", "u", "", "username for the registry")
+	PushFromDockerCmd.Flags().StringVarP(&pushDockerPassword, "password", "p", "", "password for the registry")
+	PushFromDockerCmd.Flags().BoolVar(&pushDockerPlainHTTP, "plain-http", false, "connect to the registry over plain HTTP")
+}
+
+// PushFromDockerCmd is the cobra command that corresponds to the
+// push-from-docker subcommand
+var PushFromDockerCmd = &cobra.Command{
+	Use:   "push-from-docker [--socket <path>] <image> <registry/repo:tag>",
+	Short: "`push-from-docker` pushes an image of a Docker daemon to a registry",
+	Long: "`push-from-docker` exports <image> from a Docker daemon, and pushes it as a schema2 manifest to <registry/repo:tag>.\n" +
+		"No docker client is required, the daemon is reached through its socket.",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := dcontext.Background()
+
+		named, err := reference.ParseNormalizedNamed(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid reference %s: %v\n", args[1], err)
+			os.Exit(1)
+		}
+		tagged, ok := named.(reference.NamedTagged)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s: reference must be tagged\n", args[1])
+			os.Exit(1)
+		}
+		name, err := reference.WithName(reference.Path(named))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid reference %s: %v\n", args[1], err)
+			os.Exit(1)
+		}
+
+		scheme := "https"
+		if pushDockerPlainHTTP {
+			scheme = "http"
+		}
+		repo, err := remote.NewRepository(name, &url.URL{Scheme: scheme, Host: reference.Domain(named)}, remote.AuthConfig{
+			Username: pushDockerUsername,
+			Password: pushDockerPassword,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create repository: %v\n", err)
+			os.Exit(1)
+		}
+
+		daemon, err := dockersave.NewDaemonClient(dockerSocket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to connect to the docker daemon: %v\n", err)
+			os.Exit(1)
+		}
+		rc, err := daemon.ImageSave(ctx, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to export image: %v\n", err)
+			os.Exit(1)
+		}
+		defer rc.Close()
+
+		desc, err := dockersave.Push(ctx, rc, repo, tagged.Tag())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to push image: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(desc.Digest)
+	},
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	s3 "github.com/distribution/distribution/v3/registry/storage/driver/s3-aws"
+	"github.com/spf13/cobra"
+)
+
+var recoverS3Version string
+
+func init() {
+	RecoverCmd.Flags().StringVar(&recoverS3Version, "s3-version", "", "version of the object to restore; the versions are listed when unset")
+}
+
+// RecoverCmd is the cobra command that corresponds to the recover subcommand
+var RecoverCmd = &cobra.Command{
+	Use:   "recover [--s3-version <version-id>] <path> [<config>]",
+	Short: "`recover` restores a previous version of a file of the storage",
+	Long: "`recover` restores the version <version-id> of the file at <path> in the storage, recovering it if it was deleted.\n" +
+		"Without --s3-version, the versions of the files at <path> and below are listed instead.\n" +
+		"The storage must be s3, with enableversioning set.",
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+		versioned, ok := driver.(*s3.Driver)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "the %s driver does not support versioning\n", config.Storage.Type())
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		path := args[0]
+		if recoverS3Version == "" {
+			versions, err := versioned.ListVersions(ctx, path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to list the versions of %s: %v\n", path, err)
+				os.Exit(1)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "PATH\tVERSION\tLAST MODIFIED\tSIZE\tLATEST")
+			for _, v := range versions {
+				size := fmt.Sprint(v.Size)
+				if v.IsDeleteMarker {
+					size = "deleted"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", v.Path, v.VersionID, v.LastModified.Format(time.RFC3339), size, v.IsLatest)
+			}
+			w.Flush()
+			return
+		}
+
+		if err := versioned.RestoreVersion(ctx, path, recoverS3Version); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restore version %s of %s: %v\n", recoverS3Version, path, err)
+			os.Exit(1)
+		}
+	},
+}
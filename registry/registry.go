@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -115,6 +116,10 @@ var ServeCmd = &cobra.Command{
 			logrus.Fatalln(err)
 		}
 
+		if config.Config.WatchFile {
+			go registry.watchConfigFile(ctx, resolveConfigurationPath(args))
+		}
+
 		if config.HTTP.Debug.Prometheus.Enabled {
 			path := config.HTTP.Debug.Prometheus.Path
 			if path == "" {
@@ -137,6 +142,11 @@ type Registry struct {
 	config *configuration.Configuration
 	app    *handlers.App
 	server *http.Server
+
+	// running is the configuration as last reloaded, guarded by
+	// reloadMu, which serializes configuration reloads.
+	running  *configuration.Configuration
+	reloadMu sync.Mutex
 }
 
 // NewRegistry creates a new registry from a context and configuration struct.
@@ -158,6 +168,18 @@ func NewRegistry(ctx context.Context, config *configuration.Configuration) (*Reg
 	// can only be called once per process.
 	app.RegisterHealthChecks()
 	handler := configureReporting(app)
+	if config.Replication.VerifySignature {
+		if config.Replication.SigningKey == "" {
+			return nil, fmt.Errorf("replication.signingkey is required when replication.verifysignature is enabled")
+		}
+		handler = handlers.NewSignatureVerificationMiddleware([]byte(config.Replication.SigningKey))(handler)
+	}
+	if config.HTTP.UI.Enabled {
+		handler, err = ui(config.HTTP.UI.Prefix, config.HTTP.Prefix, config.HTTP.UI.Dir, config.HTTP.UI.IndexFallback, config.HTTP.Headers, handler)
+		if err != nil {
+			return nil, err
+		}
+	}
 	handler = alive("/", handler)
 	handler = health.Handler(handler)
 	handler = panicHandler(handler)
@@ -293,7 +315,8 @@ func (registry *Registry) ListenAndServe() error {
 		dcontext.GetLogger(registry.app).Infof("listening on %v", ln.Addr())
 	}
 
-	if config.HTTP.DrainTimeout == 0 {
+	timeout := shutdownTimeout(config)
+	if timeout == 0 {
 		return registry.server.Serve(ln)
 	}
 
@@ -310,14 +333,43 @@ func (registry *Registry) ListenAndServe() error {
 	case err := <-serveErr:
 		return err
 	case <-quit:
-		dcontext.GetLogger(registry.app).Info("stopping server gracefully. Draining connections for ", config.HTTP.DrainTimeout)
+		dcontext.GetLogger(registry.app).Info("stopping server gracefully. Draining connections for ", timeout)
 		// shutdown the server with a grace period of configured timeout
-		c, cancel := context.WithTimeout(context.Background(), config.HTTP.DrainTimeout)
+		c, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
-		return registry.server.Shutdown(c)
+		return registry.shutdown(c)
 	}
 }
 
+// shutdownTimeout returns how long the registry waits for in-flight requests
+// and pending notifications when it receives SIGTERM.
+func shutdownTimeout(config *configuration.Configuration) time.Duration {
+	if config.GracefulShutdown.Timeout != 0 {
+		return config.GracefulShutdown.Timeout
+	}
+	return config.HTTP.DrainTimeout
+}
+
+// shutdown lets the in-flight requests complete, and flushes the pending
+// notifications, until ctx is done. The requests still running then are
+// aborted by closing their connections, so that the uploads they carry are
+// left uncommitted.
+func (registry *Registry) shutdown(ctx context.Context) error {
+	err := registry.server.Shutdown(ctx)
+	if err != nil {
+		dcontext.GetLogger(registry.app).Warnf("aborting in-flight requests: %v", err)
+		registry.server.Close()
+	}
+
+	if flushErr := registry.app.Shutdown(ctx); flushErr != nil {
+		dcontext.GetLogger(registry.app).Errorf("error flushing notifications: %v", flushErr)
+		if err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
 func configureReporting(app *handlers.App) http.Handler {
 	var handler http.Handler = app
 
@@ -346,7 +398,35 @@ func configureReporting(app *handlers.App) http.Handler {
 func configureLogging(ctx context.Context, config *configuration.Configuration) (context.Context, error) {
 	logrus.SetLevel(logLevel(config.Log.Level))
 
-	formatter := config.Log.Formatter
+	if err := configureLogFormatter(config.Log.Formatter); err != nil {
+		return ctx, err
+	}
+
+	if config.Log.Sampling.Enabled {
+		sampler, err := newLogSampler(logrus.StandardLogger().Formatter, config.Log.Sampling)
+		if err != nil {
+			return ctx, err
+		}
+		logrus.SetFormatter(sampler)
+	}
+
+	if len(config.Log.Fields) > 0 {
+		// build up the static fields, if present.
+		var fields []interface{}
+		for k := range config.Log.Fields {
+			fields = append(fields, k)
+		}
+
+		ctx = dcontext.WithValues(ctx, config.Log.Fields)
+		ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(ctx, fields...))
+	}
+
+	dcontext.SetDefaultLogger(dcontext.GetLogger(ctx))
+	return ctx, nil
+}
+
+// configureLogFormatter sets the formatter of the standard logger.
+func configureLogFormatter(formatter string) error {
 	if formatter == "" {
 		formatter = defaultLogFormatter
 	}
@@ -366,23 +446,11 @@ func configureLogging(ctx context.Context, config *configuration.Configuration)
 			Formatter: &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano},
 		})
 	default:
-		return ctx, fmt.Errorf("unsupported logging formatter: %q", formatter)
+		return fmt.Errorf("unsupported logging formatter: %q", formatter)
 	}
 
 	logrus.Debugf("using %q logging formatter", formatter)
-	if len(config.Log.Fields) > 0 {
-		// build up the static fields, if present.
-		var fields []interface{}
-		for k := range config.Log.Fields {
-			fields = append(fields, k)
-		}
-
-		ctx = dcontext.WithValues(ctx, config.Log.Fields)
-		ctx = dcontext.WithLogger(ctx, dcontext.GetLogger(ctx, fields...))
-	}
-
-	dcontext.SetDefaultLogger(dcontext.GetLogger(ctx))
-	return ctx, nil
+	return nil
 }
 
 func logLevel(level configuration.Loglevel) logrus.Level {
@@ -453,28 +521,36 @@ func alive(path string, handler http.Handler) http.Handler {
 }
 
 func resolveConfiguration(args []string) (*configuration.Configuration, error) {
-	var configurationPath string
-
-	if len(args) > 0 {
-		configurationPath = args[0]
-	} else if os.Getenv("REGISTRY_CONFIGURATION_PATH") != "" {
-		configurationPath = os.Getenv("REGISTRY_CONFIGURATION_PATH")
-	}
-
+	configurationPath := resolveConfigurationPath(args)
 	if configurationPath == "" {
 		return nil, fmt.Errorf("configuration path unspecified")
 	}
 
-	fp, err := os.Open(configurationPath)
+	return parseConfigurationFile(configurationPath)
+}
+
+// resolveConfigurationPath returns the path of the configuration file, from
+// the command line or the environment.
+func resolveConfigurationPath(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return os.Getenv("REGISTRY_CONFIGURATION_PATH")
+}
+
+// parseConfigurationFile parses the configuration file at path, applying the
+// environment and the overrides of the command line.
+func parseConfigurationFile(path string) (*configuration.Configuration, error) {
+	fp, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 
 	defer fp.Close()
 
-	config, err := configuration.Parse(fp)
+	config, err := configuration.ParseWithOverrides(fp, configOverrides)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing %s: %v", configurationPath, err)
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
 	}
 
 	return config, nil
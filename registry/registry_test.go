@@ -11,22 +11,32 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io"
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
 	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/distribution/distribution/v3/configuration"
 	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/notifications"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
@@ -126,6 +136,187 @@ func TestGracefulShutdown(t *testing.T) {
 	}
 }
 
+func TestGracefulShutdownDuringUpload(t *testing.T) {
+	// The notification endpoint records the blobs pushed. It is slow, so
+	// that the push is still pending delivery when the upload completes.
+	var (
+		mu     sync.Mutex
+		pushed []digest.Digest
+	)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var envelope struct {
+			Events []notifications.Event `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(2 * time.Second)
+		mu.Lock()
+		for _, event := range envelope.Events {
+			if event.Action == notifications.EventActionPush {
+				pushed = append(pushed, event.Target.Digest)
+			}
+		}
+		mu.Unlock()
+	}))
+	defer endpoint.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	root := t.TempDir()
+	config := &configuration.Configuration{}
+	config.HTTP.Addr = addr
+	config.GracefulShutdown.Timeout = 10 * time.Second
+	config.Log.AccessLog.Disabled = true
+	config.Storage = configuration.Storage{
+		"filesystem": configuration.Parameters{"rootdirectory": root},
+		"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+			"enabled": false,
+		}},
+	}
+	config.Notifications.Endpoints = []configuration.Endpoint{{
+		Name:      "test",
+		URL:       endpoint.URL,
+		Timeout:   5 * time.Second,
+		Threshold: 3,
+		Backoff:   100 * time.Millisecond,
+		// Ignoring pulls of manifests wraps the endpoint queue, which must
+		// still be flushed.
+		Ignore: configuration.Ignore{
+			MediaTypes: []string{schema2.MediaTypeManifest},
+			Actions:    []string{notifications.EventActionPull},
+		},
+	}}
+	registry, err := NewRegistry(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errchan := make(chan error, 1)
+	go func() {
+		errchan <- registry.ListenAndServe()
+	}()
+
+	// Once the registry answers, it is notified of SIGTERM.
+	baseURL := "http://" + addr
+	for i := 0; ; i++ {
+		resp, err := http.Get(baseURL + "/v2/")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("registry did not start: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	resp, err := http.Post(baseURL+"/v2/foo/bar/blobs/uploads/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("unexpected status starting the upload: %s", resp.Status)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := location.Query()
+
+	content := make([]byte, 16<<20)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromBytes(content)
+	q.Set("digest", dgst.String())
+	location.RawQuery = q.Encode()
+
+	// Stream the blob, so that the upload is in flight when the registry
+	// receives SIGTERM.
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPut, baseURL+location.RequestURI(), pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = int64(len(content))
+	respchan := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("error uploading blob: %v", err)
+		}
+		respchan <- resp
+	}()
+
+	half := len(content) / 2
+	if _, err := pw.Write(content[:half]); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if i == 50 {
+			t.Fatal("registry still accepts connections after SIGTERM")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if _, err := pw.Write(content[half:]); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+
+	resp = <-respchan
+	if resp == nil {
+		t.FailNow()
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status completing the upload: %s", resp.Status)
+	}
+
+	select {
+	case err := <-errchan:
+		if err != nil {
+			t.Fatalf("error shutting down: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("registry did not shut down")
+	}
+
+	mu.Lock()
+	if len(pushed) != 1 || pushed[0] != dgst {
+		t.Errorf("expected the push of %s to be notified before exiting, got %v", dgst, pushed)
+	}
+	mu.Unlock()
+
+	// The blob was committed intact.
+	driver, err := factory.Create("filesystem", map[string]interface{}{"rootdirectory": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := driver.GetContent(context.Background(), path.Join("/docker/registry/v2/blobs/sha256", dgst.Hex()[:2], dgst.Hex(), "data"))
+	if err != nil {
+		t.Fatalf("error reading the uploaded blob: %v", err)
+	}
+	if digest.FromBytes(stored) != dgst {
+		t.Fatal("uploaded blob is corrupted")
+	}
+}
+
 func TestGetCipherSuite(t *testing.T) {
 	resp, err := getCipherSuites([]string{"TLS_RSA_WITH_AES_128_CBC_SHA"})
 	if err != nil || len(resp) != 1 || resp[0] != tls.TLS_RSA_WITH_AES_128_CBC_SHA {
@@ -424,3 +615,121 @@ log:
 		t.Error("field baz not configured correctly; expected 'xyzzy' got: ", val)
 	}
 }
+
+// reloadCounter is a logrus hook counting configuration reloads.
+type reloadCounter struct {
+	mu      sync.Mutex
+	reloads int
+}
+
+func (h *reloadCounter) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *reloadCounter) Fire(entry *logrus.Entry) error {
+	if strings.HasPrefix(entry.Message, "configuration reloaded") {
+		h.mu.Lock()
+		h.reloads++
+		h.mu.Unlock()
+	}
+	return nil
+}
+
+func (h *reloadCounter) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.reloads
+}
+
+func writeWatchedConfig(t *testing.T, path, level, addr string) {
+	t.Helper()
+	config := fmt.Sprintf(`version: 0.1
+log:
+  level: %s
+storage:
+  inmemory: {}
+http:
+  addr: %s
+config:
+  watchfile: true
+  watchdebounce: 100ms
+`, level, addr)
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	const interval = 10 * time.Millisecond
+
+	hook := &reloadCounter{}
+	logrus.AddHook(hook)
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	configPath := path.Join(t.TempDir(), "config.yml")
+	writeWatchedConfig(t, configPath, "info", ":5000")
+	config, err := parseConfigurationFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logrus.SetLevel(logLevel(config.Log.Level))
+
+	registry := &Registry{config: config}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.watchConfigFile(ctx, configPath)
+
+	// Successive writes within the debounce window trigger a single reload,
+	// with the content of the last write.
+	time.Sleep(5 * interval)
+	writeWatchedConfig(t, configPath, "warn", ":5001")
+	time.Sleep(2 * interval)
+	writeWatchedConfig(t, configPath, "debug", ":5001")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for logrus.GetLevel() != logrus.DebugLevel {
+		if time.Now().After(deadline) {
+			t.Fatalf("configuration was not reloaded, log level is %s", logrus.GetLevel())
+		}
+		time.Sleep(interval)
+	}
+
+	// Let a spurious second reload happen, if any.
+	time.Sleep(300 * time.Millisecond)
+	if n := hook.count(); n != 1 {
+		t.Errorf("expected a single reload, got %d", n)
+	}
+
+	registry.reloadMu.Lock()
+	defer registry.reloadMu.Unlock()
+	if registry.running.Log.Level != "debug" {
+		t.Errorf("expected running log level to be debug, got %s", registry.running.Log.Level)
+	}
+	// Changes which require a restart are not merged into the running
+	// configuration.
+	if registry.running.HTTP.Addr != ":5000" {
+		t.Errorf("expected running http.addr to be :5000, got %s", registry.running.HTTP.Addr)
+	}
+	// The configuration read by the request handlers is left as it is.
+	if config.Log.Level != "info" {
+		t.Errorf("expected the configuration of the handlers to be left alone, got log level %s", config.Log.Level)
+	}
+}
+
+func TestDiffConfiguration(t *testing.T) {
+	a := &configuration.Configuration{}
+	a.Log.Level = "info"
+	a.Storage = configuration.Storage{"inmemory": configuration.Parameters{}}
+
+	b := &configuration.Configuration{}
+	b.Log.Level = "debug"
+	b.HTTP.Addr = ":5001"
+	b.Storage = configuration.Storage{"inmemory": configuration.Parameters{}}
+
+	var keys []string
+	for _, change := range diffConfiguration(a, b) {
+		keys = append(keys, change.key)
+	}
+	if expected := []string{"log.level", "http.addr"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected changes to %v, got %v", expected, keys)
+	}
+}
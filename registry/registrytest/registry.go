@@ -0,0 +1,130 @@
+// Package registrytest provides an in-process registry and helpers pushing
+// content to it, for testing the clients of the registry.
+package registrytest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/client"
+	"github.com/distribution/distribution/v3/registry/handlers"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Config returns the configuration of a registry storing its content in
+// memory, without the purging of uploads.
+func Config() *configuration.Configuration {
+	return &configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+}
+
+// NewServer serves handler until the end of the test, and returns its URL.
+func NewServer(t *testing.T, handler http.Handler) *url.URL {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// New serves a registry with the configuration of Config until the end of
+// the test, and returns its URL.
+func New(t *testing.T) *url.URL {
+	t.Helper()
+	return NewServer(t, handlers.NewApp(context.Background(), Config()))
+}
+
+// Repository returns a client of the repository name of the registry at
+// base. A nil transport uses the default one.
+func Repository(t *testing.T, base *url.URL, name string, transport http.RoundTripper) distribution.Repository {
+	t.Helper()
+
+	named, err := reference.WithName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := client.NewRepository(named, base.String(), transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// PutBlob pushes p to repo, and returns its descriptor with mediaType.
+func PutBlob(t *testing.T, repo distribution.Repository, mediaType string, p []byte) distribution.Descriptor {
+	t.Helper()
+	ctx := context.Background()
+
+	desc, err := repo.Blobs(ctx).Put(ctx, mediaType, p)
+	if err != nil {
+		t.Fatalf("error pushing blob: %v", err)
+	}
+	desc.MediaType = mediaType
+	return desc
+}
+
+// PutManifest pushes m to repo, tagged with tag unless it is empty, and
+// returns its descriptor.
+func PutManifest(t *testing.T, repo distribution.Repository, tag string, m distribution.Manifest) distribution.Descriptor {
+	t.Helper()
+	ctx := context.Background()
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var options []distribution.ManifestServiceOption
+	if tag != "" {
+		options = append(options, distribution.WithTag(tag))
+	}
+	dgst, err := ms.Put(ctx, m, options...)
+	if err != nil {
+		t.Fatalf("error pushing manifest: %v", err)
+	}
+
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}
+}
+
+// PushImage pushes a linux image for arch with a single layer holding layer
+// to repo, tagged with tag unless it is empty, and returns the descriptor of
+// its manifest.
+func PushImage(t *testing.T, repo distribution.Repository, tag, arch string, layer []byte) distribution.Descriptor {
+	t.Helper()
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    PutBlob(t, repo, v1.MediaTypeImageConfig, []byte(`{"architecture":"`+arch+`","os":"linux"}`)),
+		Layers:    []distribution.Descriptor{PutBlob(t, repo, v1.MediaTypeImageLayer, layer)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return PutManifest(t, repo, tag, m)
+}
@@ -0,0 +1,35 @@
+package registrytest
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPushImage(t *testing.T) {
+	ctx := context.Background()
+	repo := Repository(t, New(t), "foo/app", nil)
+
+	desc := PushImage(t, repo, "1.0", "arm64", []byte("layer"))
+	if desc.MediaType != v1.MediaTypeImageManifest {
+		t.Fatalf("unexpected media type %s", desc.MediaType)
+	}
+
+	tagged, err := repo.Tags(ctx).Get(ctx, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tagged.Digest != desc.Digest || tagged.Size != desc.Size {
+		t.Fatalf("unexpected tagged descriptor %v, expected %v", tagged, desc)
+	}
+
+	untagged := PushImage(t, repo, "", "amd64", []byte("other layer"))
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Get(ctx, untagged.Digest); err != nil {
+		t.Fatalf("error getting %s: %v", untagged.Digest, err)
+	}
+}
@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultConfigWatchDebounce is how long the configuration file must remain
+// unchanged before it is reloaded, when config.watchdebounce is not set.
+const defaultConfigWatchDebounce = 500 * time.Millisecond
+
+// configChange describes a configuration parameter whose value changed.
+type configChange struct {
+	key      string
+	from, to interface{}
+}
+
+func (c configChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.key, c.from, c.to)
+}
+
+// reloadableKeys are the configuration parameters applied to a running
+// registry. Changes to any other parameter require a restart.
+var reloadableKeys = map[string]bool{
+	"log.level":     true,
+	"log.formatter": true,
+}
+
+// Reload merges config into the running configuration of the registry. The
+// parameters which can change at runtime, the log level and formatter, are
+// applied and the effective changes are logged; changes to other parameters
+// are reported, and only take effect after a restart.
+func (registry *Registry) Reload(ctx context.Context, config *configuration.Configuration) error {
+	registry.reloadMu.Lock()
+	defer registry.reloadMu.Unlock()
+
+	// The configuration the registry was created with is read by the
+	// request handlers, so reloads update a copy of it.
+	if registry.running == nil {
+		running := *registry.config
+		registry.running = &running
+	}
+	running := registry.running
+
+	var applied, ignored []string
+	for _, change := range diffConfiguration(running, config) {
+		if reloadableKeys[change.key] {
+			applied = append(applied, change.String())
+		} else {
+			ignored = append(ignored, change.key)
+		}
+	}
+
+	if config.Log.Formatter != running.Log.Formatter {
+		if err := configureLogFormatter(config.Log.Formatter); err != nil {
+			return err
+		}
+		running.Log.Formatter = config.Log.Formatter
+	}
+	if config.Log.Level != running.Log.Level {
+		logrus.SetLevel(logLevel(config.Log.Level))
+		running.Log.Level = config.Log.Level
+	}
+
+	logger := dcontext.GetLogger(ctx)
+	if len(applied) > 0 {
+		logger.Infof("configuration reloaded: %s", strings.Join(applied, ", "))
+	}
+	if len(ignored) > 0 {
+		logger.Warnf("configuration changes require a restart to take effect: %s", strings.Join(ignored, ", "))
+	}
+	return nil
+}
+
+// watchConfigFile reloads the configuration file at path into the registry
+// whenever its content changes, until ctx is done. Successive changes within
+// the debounce window of the configuration trigger a single reload.
+func (registry *Registry) watchConfigFile(ctx context.Context, path string) {
+	debounce := registry.config.Config.WatchDebounce
+	if debounce <= 0 {
+		debounce = defaultConfigWatchDebounce
+	}
+
+	logger := dcontext.GetLogger(ctx)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("error watching configuration file %s: %v", path, err)
+		return
+	}
+	defer watcher.Close()
+	// The directory is watched rather than the file, which editors and the
+	// symlink swaps of Kubernetes ConfigMap volumes replace by renames.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		logger.Errorf("error watching configuration file %s: %v", path, err)
+		return
+	}
+	logger.Infof("watching configuration file %s", path)
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		logger.Errorf("error reading configuration file %s: %v", path, err)
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Errorf("error watching configuration file %s: %v", path, err)
+			continue
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// Any change to the directory may replace the file, so the
+			// file is read once the directory stops changing.
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(debounce)
+			continue
+		case <-timer.C:
+		}
+
+		p, err := os.ReadFile(path)
+		if err != nil {
+			logger.Errorf("error reading configuration file %s: %v", path, err)
+			continue
+		}
+		if bytes.Equal(p, current) {
+			continue
+		}
+		current = p
+
+		config, err := parseConfigurationFile(path)
+		if err != nil {
+			logger.Errorf("error reloading configuration: %v", err)
+			continue
+		}
+		if err := registry.Reload(ctx, config); err != nil {
+			logger.Errorf("error reloading configuration: %v", err)
+		}
+	}
+}
+
+// diffConfiguration returns the parameters whose value differs between a and
+// b, named by their dot-notation key. Maps, slices and interfaces are
+// compared as a whole.
+func diffConfiguration(a, b *configuration.Configuration) []configChange {
+	return diffValues("", reflect.ValueOf(*a), reflect.ValueOf(*b))
+}
+
+func diffValues(key string, a, b reflect.Value) []configChange {
+	if a.Kind() != reflect.Struct {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []configChange{{key: key, from: a.Interface(), to: b.Interface()}}
+	}
+
+	var changes []configChange
+	for i := 0; i < a.NumField(); i++ {
+		sf := a.Type().Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if key != "" {
+			name = key + "." + name
+		}
+		changes = append(changes, diffValues(name, a.Field(i), b.Field(i))...)
+	}
+	return changes
+}
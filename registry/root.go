@@ -3,23 +3,45 @@ package registry
 import (
 	"fmt"
 	"os"
+	"time"
 
 	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/registry/storage"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/distribution/v3/registry/storage/policy"
 	"github.com/distribution/distribution/v3/version"
 	"github.com/docker/libtrust"
 	"github.com/spf13/cobra"
 )
 
-var showVersion bool
+var (
+	showVersion     bool
+	configOverrides []string
+)
 
 func init() {
 	RootCmd.AddCommand(ServeCmd)
 	RootCmd.AddCommand(GCCmd)
-	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
+	RootCmd.AddCommand(BuildxCmd)
+	RootCmd.AddCommand(TagCmd)
+	RootCmd.AddCommand(PushFromDockerCmd)
+	RootCmd.AddCommand(AuditCmd)
+	RootCmd.AddCommand(AttestationCmd)
+	RootCmd.AddCommand(EncryptCmd)
+	RootCmd.AddCommand(DecryptCmd)
+	RootCmd.AddCommand(RecoverCmd)
+	RootCmd.AddCommand(MigrateShardsCmd)
+	RootCmd.AddCommand(MigrateReferrersCmd)
+	RootCmd.AddCommand(DiagnoseCmd)
+	RootCmd.AddCommand(VerifyTransparencyCmd)
+	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove data, printing the blobs and manifests which would be removed as JSON lines")
 	GCCmd.Flags().BoolVarP(&removeUntagged, "delete-untagged", "m", false, "delete manifests that are not currently referenced via tag")
+	GCCmd.Flags().IntVar(&sweepWorkers, "sweep-workers", 4, "number of blobs deleted concurrently")
+	GCCmd.Flags().Float64Var(&markFalsePositiveRate, "mark-false-positive-rate", storage.DefaultMarkFalsePositiveRate, "rate of unreachable blobs kept because the mark set reports them as reachable")
+	GCCmd.Flags().DurationVar(&tombstoneTTL, "tombstone-ttl", 0, "remove the tombstones of manifests deleted longer ago than this duration")
+	GCCmd.Flags().StringVar(&policyFile, "policy-file", "", "YAML file of the tag policy removing the tags it does not retain")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
+	RootCmd.PersistentFlags().StringArrayVar(&configOverrides, "config-override", nil, "override a configuration parameter, as key=value with a dot-notation key (can be repeated)")
 }
 
 // RootCmd is the main command for the 'registry' binary.
@@ -37,8 +59,12 @@ var RootCmd = &cobra.Command{
 }
 
 var (
-	dryRun         bool
-	removeUntagged bool
+	dryRun                bool
+	removeUntagged        bool
+	sweepWorkers          int
+	tombstoneTTL          time.Duration
+	markFalsePositiveRate float64
+	policyFile            string
 )
 
 // GCCmd is the cobra command that corresponds to the garbage-collect subcommand
@@ -67,6 +93,21 @@ var GCCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		var tagPolicy policy.TagPolicy
+		if policyFile != "" {
+			f, err := os.Open(policyFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "unable to open policy file: %v", err)
+				os.Exit(1)
+			}
+			tagPolicy, err = policy.Parse(f)
+			f.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "unable to parse policy file %s: %v", policyFile, err)
+				os.Exit(1)
+			}
+		}
+
 		k, err := libtrust.GenerateECP256PrivateKey()
 		if err != nil {
 			fmt.Fprint(os.Stderr, err)
@@ -80,8 +121,12 @@ var GCCmd = &cobra.Command{
 		}
 
 		err = storage.MarkAndSweep(ctx, driver, registry, storage.GCOpts{
-			DryRun:         dryRun,
-			RemoveUntagged: removeUntagged,
+			DryRun:                dryRun,
+			RemoveUntagged:        removeUntagged,
+			SweepWorkers:          sweepWorkers,
+			TombstoneTTL:          tombstoneTTL,
+			MarkFalsePositiveRate: markFalsePositiveRate,
+			TagPolicy:             tagPolicy,
 		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to garbage collect: %v", err)
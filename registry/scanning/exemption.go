@@ -0,0 +1,103 @@
+// Package scanning holds the vulnerability scanning policies of the
+// registry.
+package scanning
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/docker/libtrust"
+)
+
+const (
+	// ExemptionAnnotation is the manifest annotation listing the CVEs
+	// exempted from blocking the push of an image, separated by commas.
+	ExemptionAnnotation = "org.example.security.cve-exemption"
+
+	// ExemptionSignatureAnnotation is the manifest annotation holding the
+	// signature of the exemption, as returned by SignExemption.
+	ExemptionSignatureAnnotation = ExemptionAnnotation + ".signature"
+)
+
+var (
+	// ErrExemptionUnsigned is returned when a manifest carries an exemption
+	// without signature.
+	ErrExemptionUnsigned = errors.New("cve exemption is not signed")
+
+	// ErrExemptionSignatureInvalid is returned when the signature of an
+	// exemption does not verify with the exemption signing key.
+	ErrExemptionSignatureInvalid = errors.New("invalid cve exemption signature")
+)
+
+// exemptionPayload returns the signed content of an exemption. It binds the
+// exemption to the content of the image, so that it cannot be copied to other
+// manifests.
+func exemptionPayload(exemption string, references []distribution.Descriptor) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(exemption)
+	buf.WriteString("\n")
+	for _, desc := range references {
+		buf.WriteString(desc.Digest.String())
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// SignExemption signs exemption, the value of the ExemptionAnnotation of a
+// manifest referencing references, with key. It returns the value of the
+// ExemptionSignatureAnnotation.
+func SignExemption(key libtrust.PrivateKey, exemption string, references []distribution.Descriptor) (string, error) {
+	sig, alg, err := key.Sign(bytes.NewReader(exemptionPayload(exemption, references)), crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return alg + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// VerifyExemptionSignature returns the CVEs exempted by the annotations of
+// manifest, after verifying their signature with key. No CVE is returned for
+// manifests without exemption, including the manifests which cannot carry
+// annotations.
+func VerifyExemptionSignature(manifest distribution.Manifest, key libtrust.PublicKey) ([]string, error) {
+	m, ok := manifest.(*ocischema.DeserializedManifest)
+	if !ok {
+		return nil, nil
+	}
+	exemption, ok := m.Annotations[ExemptionAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	signature, ok := m.Annotations[ExemptionSignatureAnnotation]
+	if !ok || signature == "" {
+		return nil, ErrExemptionUnsigned
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: no exemption signing key configured", ErrExemptionSignatureInvalid)
+	}
+	alg, encoded, ok := strings.Cut(signature, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed signature", ErrExemptionSignatureInvalid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExemptionSignatureInvalid, err)
+	}
+	if err := key.Verify(bytes.NewReader(exemptionPayload(exemption, m.References())), alg, sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExemptionSignatureInvalid, err)
+	}
+
+	var cves []string
+	for _, cve := range strings.Split(exemption, ",") {
+		if cve = strings.TrimSpace(cve); cve != "" {
+			cves = append(cves, cve)
+		}
+	}
+	return cves, nil
+}
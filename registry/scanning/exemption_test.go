@@ -0,0 +1,125 @@
+package scanning
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func makeManifest(t *testing.T, layer string, annotations map[string]string) *ocischema.DeserializedManifest {
+	t.Helper()
+
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config: distribution.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    digest.FromString("config"),
+			Size:      6,
+		},
+		Layers: []distribution.Descriptor{{
+			MediaType: v1.MediaTypeImageLayerGzip,
+			Digest:    digest.FromString(layer),
+			Size:      int64(len(layer)),
+		}},
+		Annotations: annotations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// signedManifest returns a manifest exempting exemption, signed by key.
+func signedManifest(t *testing.T, key libtrust.PrivateKey, layer, exemption string) *ocischema.DeserializedManifest {
+	t.Helper()
+
+	signature, err := SignExemption(key, exemption, makeManifest(t, layer, nil).References())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return makeManifest(t, layer, map[string]string{
+		ExemptionAnnotation:          exemption,
+		ExemptionSignatureAnnotation: signature,
+	})
+}
+
+func TestVerifyExemptionSignature(t *testing.T) {
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := signedManifest(t, key, "layer", "CVE-2023-1234, CVE-2023-5678")
+	cves, err := VerifyExemptionSignature(m, key.PublicKey())
+	if err != nil {
+		t.Fatalf("unexpected error verifying a valid exemption: %v", err)
+	}
+	if expected := []string{"CVE-2023-1234", "CVE-2023-5678"}; !reflect.DeepEqual(cves, expected) {
+		t.Fatalf("expected exempted CVEs %v, got %v", expected, cves)
+	}
+
+	// The exemption was signed for another image.
+	copied := makeManifest(t, "other layer", m.Annotations)
+
+	// The CVE list was extended after signing.
+	tampered := makeManifest(t, "layer", map[string]string{
+		ExemptionAnnotation:          "CVE-2023-1234,CVE-2023-5678,CVE-2024-0001",
+		ExemptionSignatureAnnotation: m.Annotations[ExemptionSignatureAnnotation],
+	})
+
+	for _, tc := range []struct {
+		name     string
+		manifest *ocischema.DeserializedManifest
+		key      libtrust.PublicKey
+		expected error
+	}{
+		{name: "unsigned", manifest: makeManifest(t, "layer", map[string]string{ExemptionAnnotation: "CVE-2023-1234"}), key: key.PublicKey(), expected: ErrExemptionUnsigned},
+		{name: "other key", manifest: m, key: otherKey.PublicKey(), expected: ErrExemptionSignatureInvalid},
+		{name: "no key", manifest: m, expected: ErrExemptionSignatureInvalid},
+		{name: "copied", manifest: copied, key: key.PublicKey(), expected: ErrExemptionSignatureInvalid},
+		{name: "tampered", manifest: tampered, key: key.PublicKey(), expected: ErrExemptionSignatureInvalid},
+		{name: "malformed", manifest: makeManifest(t, "layer", map[string]string{
+			ExemptionAnnotation:          "CVE-2023-1234",
+			ExemptionSignatureAnnotation: "garbage",
+		}), key: key.PublicKey(), expected: ErrExemptionSignatureInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cves, err := VerifyExemptionSignature(tc.manifest, tc.key)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+			if cves != nil {
+				t.Fatalf("unexpected exempted CVEs %v", cves)
+			}
+		})
+	}
+}
+
+func TestVerifyExemptionSignatureWithoutExemption(t *testing.T) {
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []distribution.Manifest{
+		makeManifest(t, "layer", nil),
+		makeManifest(t, "layer", map[string]string{"org.opencontainers.image.title": "app"}),
+		&schema2.DeserializedManifest{},
+	} {
+		cves, err := VerifyExemptionSignature(m, key.PublicKey())
+		if err != nil || cves != nil {
+			t.Fatalf("expected no exemption for %T, got %v, %v", m, cves, err)
+		}
+	}
+}
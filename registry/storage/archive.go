@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var (
+	// ErrRepositoryArchived is returned when archiving a repository which
+	// is archived already.
+	ErrRepositoryArchived = errors.New("repository is archived")
+
+	// ErrRepositoryNotArchived is returned when unarchiving a repository
+	// which is not archived.
+	ErrRepositoryNotArchived = errors.New("repository is not archived")
+)
+
+// ArchiveRecord records the archive of a repository to cold storage. A
+// repository with a record is archived, and read-only.
+type ArchiveRecord struct {
+	// ArchivedAt is the time the archive completed. It is zero while the
+	// content of the repository is being copied.
+	ArchivedAt time.Time `json:"archivedAt,omitempty"`
+
+	// Location is the location of the content of the repository in cold
+	// storage.
+	Location string `json:"location,omitempty"`
+
+	// Removed is true when the content of the repository was removed from
+	// hot storage once archived.
+	Removed bool `json:"removed,omitempty"`
+}
+
+// RepositoryArchived reports whether the repository name is archived, or
+// being archived.
+func RepositoryArchived(ctx context.Context, d driver.StorageDriver, name string) (bool, error) {
+	recordPath, err := pathFor(repositoryArchivePathSpec{name: name})
+	if err != nil {
+		return false, err
+	}
+	if _, err := d.Stat(ctx, recordPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetArchiveRecord returns the record of the archive of the repository name,
+// or ErrRepositoryNotArchived.
+func GetArchiveRecord(ctx context.Context, d driver.StorageDriver, name string) (ArchiveRecord, error) {
+	recordPath, err := pathFor(repositoryArchivePathSpec{name: name})
+	if err != nil {
+		return ArchiveRecord{}, err
+	}
+	p, err := d.GetContent(ctx, recordPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return ArchiveRecord{}, ErrRepositoryNotArchived
+		}
+		return ArchiveRecord{}, err
+	}
+	var record ArchiveRecord
+	if err := json.Unmarshal(p, &record); err != nil {
+		return ArchiveRecord{}, err
+	}
+	return record, nil
+}
+
+func putArchiveRecord(ctx context.Context, d driver.StorageDriver, name string, record ArchiveRecord) error {
+	recordPath, err := pathFor(repositoryArchivePathSpec{name: name})
+	if err != nil {
+		return err
+	}
+	p, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, recordPath, p)
+}
+
+func deleteArchiveRecord(ctx context.Context, d driver.StorageDriver, name string) error {
+	recordPath, err := pathFor(repositoryArchivePathSpec{name: name})
+	if err != nil {
+		return err
+	}
+	if err := d.Delete(ctx, recordPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// ArchiveRepository archives the repository name of the hot storage to the
+// cold storage. The repository is recorded as archived first, such that it is
+// read-only while its manifests, tags and the blobs they link are copied to
+// the same paths of the cold storage. The content of the repository is then
+// removed from hot storage if remove is set, its blobs being left to the
+// garbage collection as other repositories may link them. An archive which
+// was interrupted is resumed. If the copy fails, the repository is no longer
+// recorded as archived.
+func ArchiveRepository(ctx context.Context, hot, cold driver.StorageDriver, name string, remove bool) (ArchiveRecord, error) {
+	record, err := GetArchiveRecord(ctx, hot, name)
+	switch err {
+	case nil:
+		if !record.ArchivedAt.IsZero() {
+			return ArchiveRecord{}, ErrRepositoryArchived
+		}
+	case ErrRepositoryNotArchived:
+	default:
+		return ArchiveRecord{}, err
+	}
+
+	repoDir, err := repositoryDir(name)
+	if err != nil {
+		return ArchiveRecord{}, err
+	}
+	if _, err := hot.Stat(ctx, repoDir); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return ArchiveRecord{}, distribution.ErrRepositoryUnknown{Name: name}
+		}
+		return ArchiveRecord{}, err
+	}
+
+	if err := putArchiveRecord(ctx, hot, name, ArchiveRecord{}); err != nil {
+		return ArchiveRecord{}, err
+	}
+	if err := copyRepository(ctx, hot, cold, name); err != nil {
+		if derr := deleteArchiveRecord(ctx, hot, name); derr != nil {
+			dcontext.GetLogger(ctx).Errorf("error removing archive record of %s after failed archive: %v", name, derr)
+		}
+		return ArchiveRecord{}, err
+	}
+	if remove {
+		if err := hot.Delete(ctx, repoDir); err != nil {
+			return ArchiveRecord{}, err
+		}
+	}
+
+	record = ArchiveRecord{
+		ArchivedAt: time.Now().UTC(),
+		Location:   cold.Name() + ":" + repoDir,
+		Removed:    remove,
+	}
+	if err := putArchiveRecord(ctx, hot, name, record); err != nil {
+		return ArchiveRecord{}, err
+	}
+	return record, nil
+}
+
+// UnarchiveRepository restores the repository name archived to the cold
+// storage. Content removed from hot storage is copied back, and the
+// repository is no longer recorded as archived, which makes it writable
+// again. The archive is left in cold storage.
+func UnarchiveRepository(ctx context.Context, hot, cold driver.StorageDriver, name string) error {
+	record, err := GetArchiveRecord(ctx, hot, name)
+	if err != nil {
+		return err
+	}
+	// An interrupted archive removed nothing yet.
+	if record.Removed {
+		if err := copyRepository(ctx, cold, hot, name); err != nil {
+			return err
+		}
+	}
+	return deleteArchiveRecord(ctx, hot, name)
+}
+
+// repositoryDir returns the directory of the repository name.
+func repositoryDir(name string) (string, error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return "", err
+	}
+	return path.Join(root, name), nil
+}
+
+// copyRepository copies the manifests and tags of the repository name from
+// the storage src to dst, with the blobs its layer and manifest links point
+// to. Uploads in progress are not copied. Blobs already in dst are skipped.
+// The compression markers of the blobs are copied along with them.
+func copyRepository(ctx context.Context, src, dst driver.StorageDriver, name string) error {
+	repoDir, err := repositoryDir(name)
+	if err != nil {
+		return err
+	}
+
+	blobs := make(map[digest.Digest]struct{})
+	err = src.Walk(ctx, repoDir, func(fi driver.FileInfo) error {
+		p := fi.Path()
+		if fi.IsDir() {
+			if path.Base(p) == "_uploads" {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+		if err := copyFile(ctx, src, dst, p); err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(p, repoDir)
+		if path.Base(p) == "link" && (strings.HasPrefix(rel, "/_layers/") || strings.HasPrefix(rel, "/_manifests/revisions/")) {
+			content, err := src.GetContent(ctx, p)
+			if err != nil {
+				return err
+			}
+			dgst, err := digest.Parse(string(content))
+			if err != nil {
+				return err
+			}
+			blobs[dgst] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for dgst := range blobs {
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Stat(ctx, blobPath); err == nil {
+			continue
+		}
+		// The marker is copied first, as blobStore.put writes it, such
+		// that compressed data is never found without it.
+		markerPath, err := pathFor(blobCompressedPathSpec{digest: dgst})
+		if err != nil {
+			return err
+		}
+		if err := copyFile(ctx, src, dst, markerPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return err
+			}
+		}
+		if err := copyFile(ctx, src, dst, blobPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile streams the file at p of the storage src to the same path of dst.
+func copyFile(ctx context.Context, src, dst driver.StorageDriver, p string) error {
+	r, err := src.Reader(ctx, p, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := dst.Writer(ctx, p, false)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Cancel()
+		w.Close()
+		return err
+	}
+	if err := w.Commit(); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
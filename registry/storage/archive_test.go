@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestArchiveRepository(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := inmemory.New(), inmemory.New()
+	registry := createRegistry(t, hot)
+	repo := makeRepository(t, registry, "archived/repo")
+	image := uploadRandomSchema2Image(t, repo)
+	desc := distribution.Descriptor{Digest: image.manifestDigest}
+	if err := repo.Tags(ctx).Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := ArchiveRepository(ctx, hot, cold, "archived/repo", true)
+	if err != nil {
+		t.Fatalf("unexpected error archiving repository: %v", err)
+	}
+	if record.ArchivedAt.IsZero() || !record.Removed || record.Location != "inmemory:/docker/registry/v2/repositories/archived/repo" {
+		t.Fatalf("unexpected archive record: %+v", record)
+	}
+	if archived, err := RepositoryArchived(ctx, hot, "archived/repo"); err != nil || !archived {
+		t.Fatalf("expected the repository archived, got %v, %v", archived, err)
+	}
+	if _, err := ArchiveRepository(ctx, hot, cold, "archived/repo", true); err != ErrRepositoryArchived {
+		t.Fatalf("expected ErrRepositoryArchived archiving again, got %v", err)
+	}
+
+	// The repository is served from the cold storage alone.
+	coldRepo := makeRepository(t, createRegistry(t, cold), "archived/repo")
+	got, err := coldRepo.Tags(ctx).Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error getting archived tag: %v", err)
+	}
+	if got.Digest != image.manifestDigest {
+		t.Fatalf("unexpected digest of archived tag: %s != %s", got.Digest, image.manifestDigest)
+	}
+	if _, err := makeManifestService(t, coldRepo).Get(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting archived manifest: %v", err)
+	}
+	for dgst := range image.layers {
+		if _, err := coldRepo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("unexpected error getting archived layer %s: %v", dgst, err)
+		}
+	}
+
+	// The content was removed from the hot storage.
+	if _, err := repo.Tags(ctx).Get(ctx, "latest"); err == nil {
+		t.Fatal("expected the tag removed from the hot storage")
+	}
+
+	if err := UnarchiveRepository(ctx, hot, cold, "archived/repo"); err != nil {
+		t.Fatalf("unexpected error unarchiving repository: %v", err)
+	}
+	if archived, err := RepositoryArchived(ctx, hot, "archived/repo"); err != nil || archived {
+		t.Fatalf("expected the repository unarchived, got %v, %v", archived, err)
+	}
+	if err := UnarchiveRepository(ctx, hot, cold, "archived/repo"); err != ErrRepositoryNotArchived {
+		t.Fatalf("expected ErrRepositoryNotArchived unarchiving again, got %v", err)
+	}
+
+	got, err = repo.Tags(ctx).Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error getting restored tag: %v", err)
+	}
+	if got.Digest != image.manifestDigest {
+		t.Fatalf("unexpected digest of restored tag: %s != %s", got.Digest, image.manifestDigest)
+	}
+	if _, err := makeManifestService(t, repo).Get(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting restored manifest: %v", err)
+	}
+}
+
+func TestArchiveRepositoryCompressed(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := inmemory.New(), inmemory.New()
+	registry := createRegistry(t, hot, CompressManifests)
+	repo := makeRepository(t, registry, "archived/compressed")
+	image := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := uncompressedSize(ctx, hot, image.manifestDigest); err != nil || !ok {
+		t.Fatalf("expected the manifest stored compressed, got %t, %v", ok, err)
+	}
+
+	if _, err := ArchiveRepository(ctx, hot, cold, "archived/compressed", true); err != nil {
+		t.Fatalf("unexpected error archiving repository: %v", err)
+	}
+	if _, ok, err := uncompressedSize(ctx, cold, image.manifestDigest); err != nil || !ok {
+		t.Fatalf("expected the compression marker archived, got %t, %v", ok, err)
+	}
+
+	// The blobs of the removed repository are left to the garbage
+	// collection, and restored from the archive.
+	if err := MarkAndSweep(ctx, hot, registry, GCOpts{}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if _, ok, err := uncompressedSize(ctx, hot, image.manifestDigest); err != nil || ok {
+		t.Fatalf("expected the compression marker collected, got %t, %v", ok, err)
+	}
+	if err := UnarchiveRepository(ctx, hot, cold, "archived/compressed"); err != nil {
+		t.Fatalf("unexpected error unarchiving repository: %v", err)
+	}
+
+	m, err := makeManifestService(t, repo).Get(ctx, image.manifestDigest)
+	if err != nil {
+		t.Fatalf("unexpected error getting restored manifest: %v", err)
+	}
+	_, payload, err := m.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pushed, err := image.manifest.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, pushed) {
+		t.Fatal("restored manifest does not match pushed manifest")
+	}
+}
+
+func TestArchiveRepositoryUnknown(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := inmemory.New(), inmemory.New()
+
+	_, err := ArchiveRepository(ctx, hot, cold, "missing/repo", false)
+	if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("expected ErrRepositoryUnknown, got %v", err)
+	}
+	if archived, err := RepositoryArchived(ctx, hot, "missing/repo"); err != nil || archived {
+		t.Fatalf("expected the repository not archived, got %v, %v", archived, err)
+	}
+}
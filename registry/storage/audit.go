@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema1"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// AuditOpts contains options for Audit
+type AuditOpts struct {
+	// Repository restricts the audit to a single repository.
+	Repository string
+
+	// Fix removes the link files pointing to missing blobs.
+	Fix bool
+
+	// Workers is the number of link files checked concurrently. Defaults
+	// to 4.
+	Workers int
+}
+
+// AuditReport is the outcome of Audit.
+type AuditReport struct {
+	// LinksChecked is the number of link files checked.
+	LinksChecked int `json:"linksChecked"`
+
+	// ManifestsChecked is the number of linked manifests parsed.
+	ManifestsChecked int `json:"manifestsChecked"`
+
+	// OrphanedLinks are the link files which do not point to an existing
+	// blob.
+	OrphanedLinks []AuditLink `json:"orphanedLinks"`
+
+	// MissingBlobs are the blobs referenced by a manifest, but missing from
+	// the blob store.
+	MissingBlobs []AuditMissingBlob `json:"missingBlobs"`
+
+	// UnparseableManifests are the linked manifests which cannot be parsed.
+	UnparseableManifests []AuditManifestError `json:"unparseableManifests"`
+}
+
+// AuditLink describes an orphaned link file.
+type AuditLink struct {
+	Repository string        `json:"repository"`
+	Path       string        `json:"path"`
+	Digest     digest.Digest `json:"digest,omitempty"`
+	Reason     string        `json:"reason"`
+	Removed    bool          `json:"removed"`
+}
+
+// AuditMissingBlob describes a blob referenced by a manifest, and missing
+// from the blob store.
+type AuditMissingBlob struct {
+	Repository string        `json:"repository"`
+	Manifest   digest.Digest `json:"manifest"`
+	Digest     digest.Digest `json:"digest"`
+}
+
+// AuditManifestError describes a manifest which cannot be parsed.
+type AuditManifestError struct {
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+	Error      string        `json:"error"`
+}
+
+// Consistent reports whether the audit found no inconsistency.
+func (r *AuditReport) Consistent() bool {
+	return len(r.OrphanedLinks) == 0 && len(r.MissingBlobs) == 0 && len(r.UnparseableManifests) == 0
+}
+
+// auditLink is a link file found while walking the repositories.
+type auditLink struct {
+	repository string
+	path       string
+	// revision is set for the links of manifest revisions.
+	revision bool
+}
+
+// Audit checks the consistency of the repositories of the registry stored
+// in storageDriver: every link file must point to an existing blob, every
+// linked manifest must be parseable, and every blob referenced by a manifest
+// must exist. The link files are found with a walk of the repositories, and
+// checked by a pool of workers.
+func Audit(ctx context.Context, storageDriver driver.StorageDriver, opts AuditOpts) (*AuditReport, error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Repository != "" {
+		root = path.Join(root, opts.Repository)
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 4
+	}
+
+	a := &auditor{
+		driver: storageDriver,
+		fix:    opts.Fix,
+		report: &AuditReport{
+			OrphanedLinks:        []AuditLink{},
+			MissingBlobs:         []AuditMissingBlob{},
+			UnparseableManifests: []AuditManifestError{},
+		},
+		blobs:     make(map[digest.Digest]bool),
+		manifests: make(map[digest.Digest]manifestCheck),
+	}
+
+	links := make(chan auditLink)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range links {
+				a.checkLink(ctx, link)
+			}
+		}()
+	}
+
+	err = storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		p := fileInfo.Path()
+		if fileInfo.IsDir() {
+			if path.Base(p) == "_uploads" {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+		if path.Base(p) != "link" {
+			return nil
+		}
+
+		link, ok := parseLinkPath(root, opts.Repository, p)
+		if ok {
+			links <- link
+		}
+		return nil
+	})
+	close(links)
+	wg.Wait()
+
+	switch err.(type) {
+	case nil:
+	case driver.PathNotFoundError:
+		if opts.Repository != "" {
+			return nil, distribution.ErrRepositoryUnknown{Name: opts.Repository}
+		}
+	default:
+		return nil, err
+	}
+
+	a.report.sort()
+	return a.report, nil
+}
+
+// parseLinkPath returns the link file at p, under the repositories root, if
+// it belongs to a repository.
+func parseLinkPath(root, repository, p string) (auditLink, bool) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		switch part {
+		case "_layers", "_manifests":
+			name := strings.Join(parts[:i], "/")
+			if repository != "" {
+				name = path.Join(repository, name)
+			}
+			if name == "" {
+				return auditLink{}, false
+			}
+			return auditLink{
+				repository: name,
+				path:       p,
+				revision:   part == "_manifests" && i+1 < len(parts) && parts[i+1] == "revisions",
+			}, true
+		}
+	}
+	return auditLink{}, false
+}
+
+// manifestCheck caches the outcome of parsing a manifest.
+type manifestCheck struct {
+	references []distribution.Descriptor
+	err        error
+}
+
+type auditor struct {
+	driver driver.StorageDriver
+	fix    bool
+
+	mu        sync.Mutex
+	report    *AuditReport
+	blobs     map[digest.Digest]bool
+	manifests map[digest.Digest]manifestCheck
+}
+
+func (a *auditor) checkLink(ctx context.Context, link auditLink) {
+	a.mu.Lock()
+	a.report.LinksChecked++
+	a.mu.Unlock()
+
+	content, err := a.driver.GetContent(ctx, link.path)
+	if err != nil {
+		a.orphaned(ctx, link, "", fmt.Sprintf("unreadable link: %v", err))
+		return
+	}
+	dgst, err := digest.Parse(strings.TrimSpace(string(content)))
+	if err != nil {
+		a.orphaned(ctx, link, "", fmt.Sprintf("invalid link content: %v", err))
+		return
+	}
+
+	exists, err := a.blobExists(ctx, dgst)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error checking blob %s: %v", dgst, err)
+		return
+	}
+	if !exists {
+		a.orphaned(ctx, link, dgst, "blob does not exist")
+		return
+	}
+
+	if link.revision {
+		a.checkManifest(ctx, link.repository, dgst)
+	}
+}
+
+// checkManifest checks that the manifest dgst can be parsed, and that all of
+// its references exist.
+func (a *auditor) checkManifest(ctx context.Context, repository string, dgst digest.Digest) {
+	a.mu.Lock()
+	check, ok := a.manifests[dgst]
+	a.mu.Unlock()
+
+	if !ok {
+		check.err = a.parseManifest(ctx, dgst, &check.references)
+		a.mu.Lock()
+		a.manifests[dgst] = check
+		a.report.ManifestsChecked++
+		a.mu.Unlock()
+	}
+
+	if check.err != nil {
+		a.mu.Lock()
+		a.report.UnparseableManifests = append(a.report.UnparseableManifests, AuditManifestError{
+			Repository: repository,
+			Digest:     dgst,
+			Error:      check.err.Error(),
+		})
+		a.mu.Unlock()
+		return
+	}
+
+	for _, desc := range check.references {
+		if len(desc.URLs) > 0 {
+			// Foreign layers are not stored in the registry.
+			continue
+		}
+		exists, err := a.blobExists(ctx, desc.Digest)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error checking blob %s: %v", desc.Digest, err)
+			continue
+		}
+		if !exists {
+			a.mu.Lock()
+			a.report.MissingBlobs = append(a.report.MissingBlobs, AuditMissingBlob{
+				Repository: repository,
+				Manifest:   dgst,
+				Digest:     desc.Digest,
+			})
+			a.mu.Unlock()
+		}
+	}
+}
+
+func (a *auditor) parseManifest(ctx context.Context, dgst digest.Digest, references *[]distribution.Descriptor) error {
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return err
+	}
+	content, err := a.driver.GetContent(ctx, blobPath)
+	if err != nil {
+		return err
+	}
+
+	m, err := unmarshalStoredManifest(content)
+	if err != nil {
+		return err
+	}
+	*references = m.References()
+	return nil
+}
+
+// unmarshalStoredManifest parses the content of a stored manifest, detecting
+// its type as the manifest store does.
+func unmarshalStoredManifest(content []byte) (distribution.Manifest, error) {
+	var versioned manifest.Versioned
+	if err := json.Unmarshal(content, &versioned); err != nil {
+		return nil, err
+	}
+
+	switch versioned.SchemaVersion {
+	case 1:
+		m, _, err := distribution.UnmarshalManifest(schema1.MediaTypeSignedManifest, content)
+		return m, err
+	case 2:
+		if versioned.MediaType != "" {
+			m, _, err := distribution.UnmarshalManifest(versioned.MediaType, content)
+			return m, err
+		}
+
+		// OCI image or image index - no media type in the content
+		m, _, err := distribution.UnmarshalManifest(v1.MediaTypeImageIndex, content)
+		if index, ok := m.(*manifestlist.DeserializedManifestList); err == nil && ok && index.Manifests != nil {
+			return index, nil
+		}
+		m, _, err = distribution.UnmarshalManifest(v1.MediaTypeImageManifest, content)
+		return m, err
+	}
+
+	return nil, fmt.Errorf("unrecognized manifest schema version %d", versioned.SchemaVersion)
+}
+
+// blobExists reports whether the data of the blob dgst exists.
+func (a *auditor) blobExists(ctx context.Context, dgst digest.Digest) (bool, error) {
+	a.mu.Lock()
+	exists, ok := a.blobs[dgst]
+	a.mu.Unlock()
+	if ok {
+		return exists, nil
+	}
+
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return false, err
+	}
+	_, err = a.driver.Stat(ctx, blobPath)
+	switch err.(type) {
+	case nil:
+		exists = true
+	case driver.PathNotFoundError:
+		exists = false
+	default:
+		return false, err
+	}
+
+	a.mu.Lock()
+	a.blobs[dgst] = exists
+	a.mu.Unlock()
+	return exists, nil
+}
+
+// orphaned records an orphaned link, and removes it when fixing.
+func (a *auditor) orphaned(ctx context.Context, link auditLink, dgst digest.Digest, reason string) {
+	entry := AuditLink{
+		Repository: link.repository,
+		Path:       link.path,
+		Digest:     dgst,
+		Reason:     reason,
+	}
+	if a.fix {
+		if err := a.driver.Delete(ctx, link.path); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error removing link %s: %v", link.path, err)
+		} else {
+			entry.Removed = true
+		}
+	}
+
+	a.mu.Lock()
+	a.report.OrphanedLinks = append(a.report.OrphanedLinks, entry)
+	a.mu.Unlock()
+}
+
+// sort orders the findings of the report, which workers record in any
+// order.
+func (r *AuditReport) sort() {
+	sort.Slice(r.OrphanedLinks, func(i, j int) bool {
+		return r.OrphanedLinks[i].Path < r.OrphanedLinks[j].Path
+	})
+	sort.Slice(r.MissingBlobs, func(i, j int) bool {
+		a, b := r.MissingBlobs[i], r.MissingBlobs[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		if a.Manifest != b.Manifest {
+			return a.Manifest < b.Manifest
+		}
+		return a.Digest < b.Digest
+	})
+	sort.Slice(r.UnparseableManifests, func(i, j int) bool {
+		a, b := r.UnparseableManifests[i], r.UnparseableManifests[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Digest < b.Digest
+	})
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func mustPathFor(t *testing.T, spec pathSpec) string {
+	t.Helper()
+	p, err := pathFor(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry := createRegistry(t, d)
+	repo := makeRepository(t, registry, "foo/bar")
+	uploadRandomSchema2Image(t, repo)
+	unparseable := uploadRandomSchema2Image(t, repo)
+	incomplete := uploadRandomSchema2Image(t, makeRepository(t, registry, "foo/baz"))
+
+	// A layer link to a blob which was never pushed.
+	dangling := digest.FromString("dangling")
+	danglingPath := mustPathFor(t, layerLinkPathSpec{name: "foo/bar", digest: dangling})
+	if err := d.PutContent(ctx, danglingPath, []byte(dangling)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A manifest whose content was corrupted.
+	if err := d.PutContent(ctx, mustPathFor(t, blobDataPathSpec{digest: unparseable.manifestDigest}), []byte("{garbage")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A manifest whose layer was removed from the blob store.
+	missing := getAnyKey(incomplete.layers)
+	if err := d.Delete(ctx, mustPathFor(t, blobPathSpec{digest: missing})); err != nil {
+		t.Fatal(err)
+	}
+	missingPath := mustPathFor(t, layerLinkPathSpec{name: "foo/baz", digest: missing})
+
+	report, err := Audit(ctx, d, AuditOpts{})
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+	if report.Consistent() {
+		t.Fatal("expected inconsistencies to be reported")
+	}
+	if report.ManifestsChecked != 3 {
+		t.Errorf("expected 3 manifests checked, got %d", report.ManifestsChecked)
+	}
+
+	if len(report.OrphanedLinks) != 2 {
+		t.Fatalf("expected 2 orphaned links, got %+v", report.OrphanedLinks)
+	}
+	for i, expected := range []AuditLink{
+		{Repository: "foo/bar", Path: danglingPath, Digest: dangling},
+		{Repository: "foo/baz", Path: missingPath, Digest: missing},
+	} {
+		link := report.OrphanedLinks[i]
+		if link.Repository != expected.Repository || link.Path != expected.Path || link.Digest != expected.Digest || link.Removed {
+			t.Errorf("unexpected orphaned link %+v, expected %+v", link, expected)
+		}
+	}
+
+	if len(report.UnparseableManifests) != 1 || report.UnparseableManifests[0].Repository != "foo/bar" ||
+		report.UnparseableManifests[0].Digest != unparseable.manifestDigest {
+		t.Errorf("unexpected unparseable manifests %+v", report.UnparseableManifests)
+	}
+
+	expectedMissing := AuditMissingBlob{Repository: "foo/baz", Manifest: incomplete.manifestDigest, Digest: missing}
+	if len(report.MissingBlobs) != 1 || report.MissingBlobs[0] != expectedMissing {
+		t.Errorf("unexpected missing blobs %+v, expected %+v", report.MissingBlobs, expectedMissing)
+	}
+
+	// Restricting the audit to a repository only reports its findings.
+	report, err = Audit(ctx, d, AuditOpts{Repository: "foo/baz"})
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+	if len(report.OrphanedLinks) != 1 || report.OrphanedLinks[0].Repository != "foo/baz" ||
+		len(report.UnparseableManifests) != 0 || len(report.MissingBlobs) != 1 {
+		t.Errorf("unexpected report for foo/baz: %+v", report)
+	}
+}
+
+func TestAuditFix(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry := createRegistry(t, d)
+	uploadRandomSchema2Image(t, makeRepository(t, registry, "foo/bar"))
+
+	dangling := digest.FromString("dangling")
+	danglingPath := mustPathFor(t, layerLinkPathSpec{name: "foo/bar", digest: dangling})
+	if err := d.PutContent(ctx, danglingPath, []byte(dangling)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Audit(ctx, d, AuditOpts{Fix: true})
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+	if len(report.OrphanedLinks) != 1 || !report.OrphanedLinks[0].Removed {
+		t.Fatalf("expected the orphaned link to be removed, got %+v", report.OrphanedLinks)
+	}
+	if _, err := d.Stat(ctx, danglingPath); err == nil {
+		t.Fatal("orphaned link still exists")
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		t.Fatal(err)
+	}
+
+	report, err = Audit(ctx, d, AuditOpts{})
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+	if !report.Consistent() {
+		t.Fatalf("expected a consistent registry after fixing, got %+v", report)
+	}
+}
+
+func TestAuditUnknownRepository(t *testing.T) {
+	if _, err := Audit(context.Background(), inmemory.New(), AuditOpts{Repository: "foo/unknown"}); err == nil {
+		t.Fatal("expected an error auditing an unknown repository")
+	}
+}
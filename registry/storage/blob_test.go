@@ -13,6 +13,7 @@ import (
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/storage/cache/memory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
 	"github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
 	"github.com/distribution/distribution/v3/testutil"
 	"github.com/opencontainers/go-digest"
@@ -47,6 +48,142 @@ func TestWriteSeek(t *testing.T) {
 	}
 }
 
+// TestBlobUploadProgress tests that the progress callbacks are called after
+// each write to an upload.
+func TestBlobUploadProgress(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/bar")
+	registry, err := NewRegistry(ctx, testdriver.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := registry.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	bs := repository.Blobs(ctx)
+
+	type progress struct{ written, total int64 }
+	var calls []progress
+	record := func(written, total int64) {
+		calls = append(calls, progress{written, total})
+	}
+
+	blobUpload, err := bs.Create(ctx, WithProgressCallback(record))
+	if err != nil {
+		t.Fatalf("unexpected error starting layer upload: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := blobUpload.Write([]byte{1, 2, 3}); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+	}
+	blobUpload.Close()
+	expected := []progress{{3, -1}, {6, -1}, {9, -1}}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("unexpected progress: %v != %v", calls, expected)
+	}
+
+	// Resumed uploads report their progress to the callback of the context,
+	// with the total expected once the pending writes complete.
+	calls = nil
+	blobUpload, err = bs.Resume(WithUploadProgress(ctx, record, 6), blobUpload.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming layer upload: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := blobUpload.Write([]byte{4, 5, 6}); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+	}
+	blobUpload.Close()
+	expected = []progress{{12, 15}, {15, 15}}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("unexpected progress: %v != %v", calls, expected)
+	}
+
+	// Copies report their progress too.
+	calls = nil
+	blobUpload, err = bs.Resume(WithUploadProgress(ctx, record, -1), blobUpload.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming layer upload: %s", err)
+	}
+	if _, err := io.Copy(blobUpload, bytes.NewReader(make([]byte, 100))); err != nil {
+		t.Fatalf("unexpected error copying: %v", err)
+	}
+	if len(calls) == 0 || calls[len(calls)-1] != (progress{115, -1}) {
+		t.Fatalf("unexpected progress of copy: %v", calls)
+	}
+	if err := blobUpload.Cancel(ctx); err != nil {
+		t.Fatalf("unexpected error canceling upload: %v", err)
+	}
+}
+
+func TestBlobUploadRange(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/bar")
+	registry, err := NewRegistry(ctx, testdriver.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := registry.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	bs := repository.Blobs(ctx)
+
+	blobUpload, err := bs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting layer upload: %s", err)
+	}
+	if _, err := blobUpload.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	blobUpload.Close()
+
+	// Data overlapping or leaving a gap with the upload is not written.
+	for _, start := range []int64{0, 2, 4} {
+		blobUpload, err = bs.Resume(WithUploadRange(ctx, start), blobUpload.ID())
+		if err != nil {
+			t.Fatalf("unexpected error resuming layer upload: %s", err)
+		}
+		_, err := io.Copy(blobUpload, bytes.NewReader([]byte{4, 5, 6}))
+		expected := distribution.ErrBlobUploadRangeInvalid{Start: start, Size: 3}
+		if err != expected {
+			t.Fatalf("expected %v writing at %d, got %v", expected, start, err)
+		}
+		if _, err := blobUpload.Write([]byte{4, 5, 6}); err != expected {
+			t.Fatalf("expected %v writing at %d, got %v", expected, start, err)
+		}
+		if size := blobUpload.Size(); size != 3 {
+			t.Fatalf("unexpected size of the upload after writing at %d: %d", start, size)
+		}
+		blobUpload.Close()
+	}
+
+	// The range applies to the first write only.
+	blobUpload, err = bs.Resume(WithUploadRange(ctx, 3), blobUpload.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming layer upload: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := blobUpload.Write([]byte{4, 5, 6}); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+	}
+	blobUpload.Close()
+	blobUpload, err = bs.Resume(ctx, blobUpload.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming layer upload: %s", err)
+	}
+	if size := blobUpload.Size(); size != 9 {
+		t.Fatalf("unexpected size of the upload: %d", size)
+	}
+	if err := blobUpload.Cancel(ctx); err != nil {
+		t.Fatalf("unexpected error canceling upload: %v", err)
+	}
+}
+
 // TestSimpleBlobUpload covers the blob upload process, exercising common
 // error paths that might be seen during an upload.
 func TestSimpleBlobUpload(t *testing.T) {
@@ -509,6 +646,77 @@ func TestBlobMount(t *testing.T) {
 	}
 }
 
+// BenchmarkBlobMount compares uploading a 500 MB layer to a repository with
+// mounting it from another repository, which only links the blob.
+func BenchmarkBlobMount(b *testing.B) {
+	const layerSize = 500 << 20
+
+	ctx := context.Background()
+	driver, err := filesystem.FromParameters(map[string]interface{}{
+		"rootdirectory": b.TempDir(),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	registry, err := NewRegistry(ctx, driver)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sourceName, _ := reference.WithName("foo/source")
+	source, err := registry.Repository(ctx, sourceName)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	layer := make([]byte, layerSize)
+	for i := range layer {
+		layer[i] = byte(i)
+	}
+	desc, err := source.Blobs(ctx).Put(ctx, "application/octet-stream", layer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	canonicalRef, err := reference.WithDigest(sourceName, desc.Digest)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	destination := func(b *testing.B, kind string, i int) distribution.BlobStore {
+		name, _ := reference.WithName(fmt.Sprintf("foo/%s-%d", kind, i))
+		repo, err := registry.Repository(ctx, name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return repo.Blobs(ctx)
+	}
+
+	b.Run("upload", func(b *testing.B) {
+		b.SetBytes(layerSize)
+		for i := 0; i < b.N; i++ {
+			bw, err := destination(b, "upload", i).Create(ctx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := bw.Write(layer); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := bw.Commit(ctx, distribution.Descriptor{Digest: desc.Digest}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("mount", func(b *testing.B) {
+		b.SetBytes(layerSize)
+		for i := 0; i < b.N; i++ {
+			_, err := destination(b, "mount", i).Create(ctx, WithMountFrom(canonicalRef))
+			if _, ok := err.(distribution.ErrBlobMounted); !ok {
+				b.Fatalf("expected the blob to be mounted, got %v", err)
+			}
+		}
+	})
+}
+
 // TestLayerUploadZeroLength uploads zero-length
 func TestLayerUploadZeroLength(t *testing.T) {
 	ctx := context.Background()
@@ -606,3 +814,45 @@ func addBlob(ctx context.Context, bs distribution.BlobIngester, desc distributio
 
 	return wr.Commit(ctx, desc)
 }
+
+// TestBlobWriterSync checks the data written to an upload is stored at once
+// by the drivers buffering it, such that an interrupted upload resumes after
+// the data written.
+func TestBlobWriterSync(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/bar")
+	registry, err := NewRegistry(ctx, filesystem.New(filesystem.DriverParameters{
+		RootDirectory: t.TempDir(),
+		MaxThreads:    25,
+	}))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := registry.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	bs := repository.Blobs(ctx)
+
+	blobUpload, err := bs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting layer upload: %s", err)
+	}
+	chunk := bytes.Repeat([]byte("a"), 1000)
+	if _, err := blobUpload.Write(chunk); err != nil {
+		t.Fatalf("unexpected error writing to the upload: %v", err)
+	}
+	if _, err := blobUpload.ReadFrom(bytes.NewReader(chunk)); err != nil {
+		t.Fatalf("unexpected error writing to the upload: %v", err)
+	}
+
+	// The upload is resumed without closing it.
+	resumed, err := bs.Resume(ctx, blobUpload.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming upload: %v", err)
+	}
+	defer resumed.Close()
+	if resumed.Size() != int64(2*len(chunk)) {
+		t.Fatalf("unexpected size of the resumed upload %d, expected %d", resumed.Size(), 2*len(chunk))
+	}
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+)
+
+// WithProgressCallback returns a BlobCreateOption which calls fn after each
+// write to the created upload, with the number of bytes written to it and,
+// as the size of the blob is unknown when the upload is created, -1.
+//
+// fn runs synchronously in the goroutine writing to the upload, which waits
+// for it: it must return quickly, handing the progress off to be reported
+// elsewhere rather than, for example, sending it to a client.
+func WithProgressCallback(fn func(written, total int64)) distribution.BlobCreateOption {
+	return optionFunc(func(v interface{}) error {
+		opts, ok := v.(*distribution.CreateOptions)
+		if !ok {
+			return fmt.Errorf("unexpected options type: %T", v)
+		}
+
+		opts.Progress = fn
+
+		return nil
+	})
+}
+
+type uploadProgressKey struct{}
+
+type uploadProgress struct {
+	fn       func(written, total int64)
+	expected int64
+}
+
+// WithUploadProgress returns a context with which the uploads created or
+// resumed call fn after each write, as with WithProgressCallback. expected
+// is the number of bytes about to be written, such as the Content-Length of
+// the request writing them, or -1 if unknown. The total passed to fn is the
+// size of the upload once they are written.
+//
+// Resuming an upload takes no options, so the HTTP handlers, which resume
+// the upload on each request, report its progress with the context.
+func WithUploadProgress(ctx context.Context, fn func(written, total int64), expected int64) context.Context {
+	return context.WithValue(ctx, uploadProgressKey{}, uploadProgress{fn: fn, expected: expected})
+}
@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -14,6 +16,10 @@ import (
 // TODO(stevvooe): This should configurable in the future.
 const blobCacheControlMaxAge = 365 * 24 * time.Hour
 
+// defaultRedirectExpiry is the expiry of the URLs returned by URLFor for most
+// storage drivers.
+const defaultRedirectExpiry = 20 * time.Minute
+
 // blobServer simply serves blobs from a driver instance using a path function
 // to identify paths and a descriptor service to fill in metadata.
 type blobServer struct {
@@ -21,6 +27,17 @@ type blobServer struct {
 	statter  distribution.BlobStatter
 	pathFn   func(dgst digest.Digest) (string, error)
 	redirect bool // allows disabling URLFor redirects
+
+	// redirectBandwidth is the expected download bandwidth of clients, in
+	// bytes per second, used to extend the expiry of redirect URLs for large
+	// blobs. Zero keeps the default expiry of the driver.
+	redirectBandwidth int64
+	// redirectMaxExpiry bounds the expiry of redirect URLs.
+	redirectMaxExpiry time.Duration
+
+	// verify is set when the content of blobs served in full is verified
+	// against their digest.
+	verify bool
 }
 
 func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
@@ -34,10 +51,51 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		return err
 	}
 
+	// Content stored compressed is decompressed rather than redirected to
+	// the backend, whether or not compression is enabled.
+	if mayBeCompressed(desc.Size) {
+		_, ok, err := uncompressedSize(ctx, bs.driver, desc.Digest)
+		if err != nil {
+			return err
+		}
+		if ok {
+			p, err := getContent(ctx, bs.driver, path)
+			if err != nil {
+				return err
+			}
+			// The data may have since been overwritten by an uncompressed
+			// upload of the same content, which leaves the marker behind.
+			if bytes.HasPrefix(p, gzipMagic) {
+				if p, err = decompressContent(p); err != nil {
+					return err
+				}
+			}
+			return bs.serveContent(ctx, w, r, desc, path, bytes.NewReader(p))
+		}
+	}
+
 	if bs.redirect {
-		redirectURL, err := bs.driver.URLFor(ctx, path, map[string]interface{}{"method": r.Method})
+		options := map[string]interface{}{"method": r.Method}
+		expiry, renew := redirectExpiry(desc.Size, bs.redirectBandwidth, bs.redirectMaxExpiry)
+
+		var redirectURL string
+		if expiry > 0 {
+			redirectURL, err = bs.driver.URLForWithExpiry(ctx, path, expiry, options)
+		} else {
+			redirectURL, err = bs.driver.URLFor(ctx, path, options)
+		}
 		switch err.(type) {
 		case nil:
+			if renew {
+				// The download may outlive the URL. Redirect with a response
+				// which must not be cached, so that clients resuming the
+				// download come back for a fresh URL.
+				w.Header().Set("Cache-Control", "no-store")
+				w.Header().Set("Expires", time.Now().Add(expiry).UTC().Format(http.TimeFormat))
+				http.Redirect(w, r, redirectURL, http.StatusFound)
+				return nil
+			}
+
 			// Redirect to storage URL.
 			http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 			return err
@@ -56,6 +114,36 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 	}
 	defer br.Close()
 
+	return bs.serveContent(ctx, w, r, desc, path, br)
+}
+
+// redirectExpiry returns the expiry of the URL redirecting the download of a
+// blob of size bytes, by clients downloading bandwidth bytes per second. Zero
+// is returned when the default expiry is at least twice the estimated
+// download time. Otherwise the URL expires after twice the estimate, bounded
+// by maxExpiry, and renew reports whether the bound applies, as the download
+// may then outlive the URL.
+func redirectExpiry(size, bandwidth int64, maxExpiry time.Duration) (expiry time.Duration, renew bool) {
+	if bandwidth <= 0 || size <= 0 {
+		return 0, false
+	}
+
+	estimate := time.Duration(float64(size) / float64(bandwidth) * float64(time.Second))
+	if estimate <= defaultRedirectExpiry/2 {
+		return 0, false
+	}
+
+	expiry = 2 * estimate
+	if maxExpiry > 0 && expiry > maxExpiry {
+		return maxExpiry, true
+	}
+	return expiry, false
+}
+
+// serveContent writes the blob headers for desc and serves content, read
+// from path. ErrBlobCorrupted is returned when the content is verified and
+// does not match the digest, in which case the response is left incomplete.
+func (bs *blobServer) serveContent(ctx context.Context, w http.ResponseWriter, r *http.Request, desc distribution.Descriptor, path string, content io.ReadSeeker) error {
 	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, desc.Digest)) // If-None-Match handled by ServeContent
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%.f", blobCacheControlMaxAge.Seconds()))
 
@@ -73,6 +161,16 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		w.Header().Set("Content-Length", fmt.Sprint(desc.Size))
 	}
 
-	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, br)
+	var vr *verifyingReader
+	if bs.verify && desc.Digest.Algorithm().Available() {
+		vr = newVerifyingReader(ctx, content, path, desc)
+		content = vr
+	}
+
+	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, content)
+
+	if vr != nil {
+		return vr.err
+	}
 	return nil
 }
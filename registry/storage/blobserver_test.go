@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bytes"
+	stdcontext "context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRedirectExpiry(t *testing.T) {
+	const (
+		mib = 1 << 20
+		gib = 1 << 30
+	)
+
+	for _, tc := range []struct {
+		name      string
+		size      int64
+		bandwidth int64
+		maxExpiry time.Duration
+		expiry    time.Duration
+		renew     bool
+	}{
+		{name: "no bandwidth", size: 50 * gib, maxExpiry: time.Hour},
+		{name: "small blob", size: 100 * mib, bandwidth: mib, maxExpiry: time.Hour},
+		{name: "half the default expiry", size: 600 * mib, bandwidth: mib, maxExpiry: time.Hour},
+		{name: "extended", size: 1200 * mib, bandwidth: mib, maxExpiry: time.Hour, expiry: 40 * time.Minute},
+		{name: "unbounded", size: 50 * gib, bandwidth: 10 * mib, expiry: 2 * 5120 * time.Second},
+		{name: "within the maximum expiry", size: 50 * gib, bandwidth: 10 * mib, maxExpiry: 4 * time.Hour, expiry: 2 * 5120 * time.Second},
+		{name: "renewed", size: 50 * gib, bandwidth: 10 * mib, maxExpiry: time.Hour, expiry: time.Hour, renew: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expiry, renew := redirectExpiry(tc.size, tc.bandwidth, tc.maxExpiry)
+			if expiry != tc.expiry || renew != tc.renew {
+				t.Fatalf("expected (%s, %t), got (%s, %t)", tc.expiry, tc.renew, expiry, renew)
+			}
+		})
+	}
+}
+
+// expiryDriver records the expiry of the URLs it returns.
+type expiryDriver struct {
+	driver.StorageDriver
+	expiry time.Duration
+}
+
+func (d *expiryDriver) URLFor(ctx stdcontext.Context, path string, options map[string]interface{}) (string, error) {
+	d.expiry = defaultRedirectExpiry
+	return "https://storage.example.com" + path, nil
+}
+
+func (d *expiryDriver) URLForWithExpiry(ctx stdcontext.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	d.expiry = expiry
+	return "https://storage.example.com" + path + "?renewed", nil
+}
+
+func TestServeBlobRedirectExpiry(t *testing.T) {
+	ctx := context.Background()
+	d := &expiryDriver{StorageDriver: inmemory.New()}
+
+	// A 64 bytes per second bandwidth makes the 64KiB blob take 1024 seconds
+	// to download, more than half the default expiry.
+	ns, err := NewRegistry(ctx, d, EnableRedirect, RedirectExpiry(64, 30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := ns.(*registry).blobStore.Put(ctx, "application/octet-stream", make([]byte, 64<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := ns.(*registry).blobServer.ServeBlob(ctx, w, httptest.NewRequest(http.MethodGet, "/", nil), desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected a %d redirect, got %d", http.StatusFound, w.Code)
+	}
+	if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("Expires") == "" {
+		t.Fatalf("expected an uncacheable redirect, got headers %v", w.Header())
+	}
+	if d.expiry != 30*time.Minute {
+		t.Fatalf("expected a URL expiring after the maximum expiry, got %s", d.expiry)
+	}
+
+	// Small blobs keep the default expiry of the driver.
+	desc, err = ns.(*registry).blobStore.Put(ctx, "application/octet-stream", make([]byte, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	if err := ns.(*registry).blobServer.ServeBlob(ctx, w, httptest.NewRequest(http.MethodGet, "/", nil), desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusTemporaryRedirect || d.expiry != defaultRedirectExpiry {
+		t.Fatalf("expected a %d redirect with the default expiry, got %d and %s", http.StatusTemporaryRedirect, w.Code, d.expiry)
+	}
+}
+
+func TestServeBlobVerifyOnRead(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	ctx := context.WithLogger(context.Background(), logrus.NewEntry(logger))
+	d := inmemory.New()
+
+	ns, err := NewRegistry(ctx, d, VerifyBlobsOnRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("verified content "), 4096)
+	desc, err := ns.(*registry).blobStore.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(rangeHeader string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		return w, ns.(*registry).blobServer.ServeBlob(ctx, w, r, desc.Digest)
+	}
+
+	w, err := serve("")
+	if err != nil {
+		t.Fatalf("unexpected error serving intact blob: %v", err)
+	}
+	if !bytes.Equal(w.Body.Bytes(), content) {
+		t.Fatal("unexpected content served for intact blob")
+	}
+
+	// Flip a bit of the stored content.
+	dataPath := mustPathFor(t, blobDataPathSpec{digest: desc.Digest})
+	corrupted := append([]byte(nil), content...)
+	corrupted[len(corrupted)/2] ^= 0x01
+	if err := d.PutContent(ctx, dataPath, corrupted); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = serve("")
+	if err != distribution.ErrBlobCorrupted {
+		t.Fatalf("expected %v serving corrupted blob, got %v", distribution.ErrBlobCorrupted, err)
+	}
+	if w.Body.Len() >= len(content) {
+		t.Fatalf("expected the corrupted blob not to be served in full, got %d bytes", w.Body.Len())
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.ErrorLevel || !strings.Contains(entry.Message, "CRITICAL") ||
+		entry.Data["path"] != dataPath || entry.Data["digest"] != desc.Digest {
+		t.Fatalf("expected the corruption to be logged, got %+v", entry)
+	}
+
+	// Partial reads are not verified.
+	hook.Reset()
+	w, err = serve("bytes=0-99")
+	if err != nil {
+		t.Fatalf("unexpected error serving range of corrupted blob: %v", err)
+	}
+	if w.Code != http.StatusPartialContent || w.Body.Len() != 100 {
+		t.Fatalf("expected 100 bytes of partial content, got %d and %d bytes", w.Code, w.Body.Len())
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Fatalf("unexpected log entries serving range: %+v", hook.AllEntries())
+	}
+}
@@ -1,9 +1,11 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"path"
+	"strconv"
 
 	"github.com/distribution/distribution/v3"
 	dcontext "github.com/distribution/distribution/v3/context"
@@ -39,6 +41,20 @@ func (bs *blobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error
 		return nil, err
 	}
 
+	// Content stored compressed is recognized whether or not compression is
+	// enabled, so that manifests stored while it was remain readable. This
+	// costs nothing for other content, as manifests never start with the
+	// gzip header.
+	if bytes.HasPrefix(p, gzipMagic) {
+		_, ok, err := uncompressedSize(ctx, bs.driver, dgst)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return decompressContent(p)
+		}
+	}
+
 	return p, nil
 }
 
@@ -48,6 +64,22 @@ func (bs *blobStore) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekC
 		return nil, err
 	}
 
+	// Content stored compressed is decompressed whether or not compression
+	// is enabled, so that manifests stored while it was remain readable.
+	if mayBeCompressed(desc.Size) {
+		_, ok, err := uncompressedSize(ctx, bs.driver, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			p, err := bs.Get(ctx, desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			return readSeekNopCloser{bytes.NewReader(p)}, nil
+		}
+	}
+
 	path, err := bs.path(desc.Digest)
 	if err != nil {
 		return nil, err
@@ -60,6 +92,17 @@ func (bs *blobStore) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekC
 // content is already present, only the digest will be returned. This should
 // only be used for small objects, such as manifests. This implemented as a convenience for other Put implementations
 func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
+	return bs.put(ctx, p, false)
+}
+
+// putCompressed behaves like Put, but stores new content gzip compressed
+// along with a marker recording its uncompressed size. The returned
+// descriptor, like the digest, describes the uncompressed content.
+func (bs *blobStore) putCompressed(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
+	return bs.put(ctx, p, true)
+}
+
+func (bs *blobStore) put(ctx context.Context, p []byte, compress bool) (distribution.Descriptor, error) {
 	dgst := digest.FromBytes(p)
 	desc, err := bs.statter.Stat(ctx, dgst)
 	if err == nil {
@@ -76,6 +119,23 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 		return distribution.Descriptor{}, err
 	}
 
+	content := p
+	if compress {
+		if content, err = compressContent(p); err != nil {
+			return distribution.Descriptor{}, err
+		}
+
+		// The marker is written before the data, so that readers never
+		// see compressed data without it.
+		markerPath, err := pathFor(blobCompressedPathSpec{digest: dgst})
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		if err := bs.driver.PutContent(ctx, markerPath, []byte(strconv.Itoa(len(p)))); err != nil {
+			return distribution.Descriptor{}, err
+		}
+	}
+
 	// TODO(stevvooe): Write out mediatype here, as well.
 	return distribution.Descriptor{
 		Size: int64(len(p)),
@@ -85,7 +145,7 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 		// for the specific repository.
 		MediaType: "application/octet-stream",
 		Digest:    dgst,
-	}, bs.driver.PutContent(ctx, bp, p)
+	}, bs.driver.PutContent(ctx, bp, content)
 }
 
 func (bs *blobStore) Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error {
@@ -152,6 +212,9 @@ func (bs *blobStore) readlink(ctx context.Context, path string) (digest.Digest,
 	return linked, nil
 }
 
+// blobStatter reports the size of the uncompressed content of the blobs
+// stored gzip compressed. Only the blobs small enough to be stored compressed
+// are checked.
 type blobStatter struct {
 	driver driver.StorageDriver
 }
@@ -187,12 +250,23 @@ func (bs *blobStatter) Stat(ctx context.Context, dgst digest.Digest) (distributi
 		return distribution.Descriptor{}, distribution.ErrBlobUnknown
 	}
 
+	size := fi.Size()
+	if mayBeCompressed(size) {
+		uncompressed, ok, err := uncompressedSize(ctx, bs.driver, dgst)
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		if ok {
+			size = uncompressed
+		}
+	}
+
 	// TODO(stevvooe): Add method to resolve the mediatype. We can store and
 	// cache a "global" media type for the blob, even if a specific repo has a
 	// mediatype that overrides the main one.
 
 	return distribution.Descriptor{
-		Size: fi.Size(),
+		Size: size,
 
 		// NOTE(stevvooe): The central blob store firewalls media types from
 		// other users. The caller should look this up and override the value
@@ -209,3 +283,12 @@ func (bs *blobStatter) Clear(ctx context.Context, dgst digest.Digest) error {
 func (bs *blobStatter) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
 	return distribution.ErrUnsupported
 }
+
+// readSeekNopCloser adds a no-op Close to an in-memory reader.
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
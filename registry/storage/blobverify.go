@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/opencontainers/go-digest"
+)
+
+var blobCorruptedCount = prometheus.StorageNamespace.NewCounter("blob_corrupted", "The number of blobs read from storage whose content does not match their digest")
+
+// verifyingReader verifies the content of a blob against its digest, when
+// the blob is read in full through it from the start.
+type verifyingReader struct {
+	io.ReadSeeker
+
+	ctx      context.Context
+	path     string
+	desc     distribution.Descriptor
+	digester digest.Digester
+	offset   int64
+
+	// sequential is set while the content has been read sequentially from
+	// the start, and is yet to be verified.
+	sequential bool
+
+	// err is ErrBlobCorrupted once the content failed verification.
+	err error
+}
+
+func newVerifyingReader(ctx context.Context, rs io.ReadSeeker, path string, desc distribution.Descriptor) *verifyingReader {
+	return &verifyingReader{
+		ReadSeeker: rs,
+		ctx:        ctx,
+		path:       path,
+		desc:       desc,
+		digester:   desc.Digest.Algorithm().Digester(),
+		sequential: true,
+	}
+}
+
+// Read reads from the content. The read completing the content returns
+// ErrBlobCorrupted, without its data, when the content does not match the
+// digest, such that clients never receive the corrupted blob in full.
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	if vr.err != nil {
+		return 0, vr.err
+	}
+
+	n, err := vr.ReadSeeker.Read(p)
+	if vr.sequential {
+		vr.digester.Hash().Write(p[:n])
+	}
+	vr.offset += int64(n)
+
+	if vr.sequential && (vr.offset >= vr.desc.Size || err == io.EOF) {
+		vr.sequential = false
+		if computed := vr.digester.Digest(); computed != vr.desc.Digest {
+			dcontext.GetLoggerWithFields(vr.ctx, map[interface{}]interface{}{
+				"path":            vr.path,
+				"digest":          vr.desc.Digest,
+				"computed.digest": computed,
+			}).Errorf("CRITICAL: content of blob %s does not match its digest", vr.desc.Digest)
+			blobCorruptedCount.Inc(1)
+			vr.err = distribution.ErrBlobCorrupted
+			return 0, vr.err
+		}
+	}
+	return n, err
+}
+
+// Seek seeks in the content. Seeking back to the start verifies the content
+// read from there, while seeking elsewhere leaves it unverified.
+func (vr *verifyingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := vr.ReadSeeker.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if pos != vr.offset {
+		vr.sequential = pos == 0
+		vr.digester = vr.desc.Digest.Algorithm().Digester()
+	}
+	vr.offset = pos
+	return pos, nil
+}
@@ -39,6 +39,28 @@ type blobWriter struct {
 
 	resumableDigestEnabled bool
 	committed              bool
+
+	// progress, if set, is called after each write with the size of the
+	// upload, progressWritten, and its expected size, progressTotal, or -1
+	// if unknown.
+	progress        func(written, total int64)
+	progressWritten int64
+	progressTotal   int64
+
+	// rangeStart, if not negative, is the offset the data written next must
+	// start at, from the Content-Range of the request writing it.
+	rangeStart int64
+}
+
+type uploadRangeKey struct{}
+
+// WithUploadRange returns a context with which the uploads resumed reject
+// the data written next, such as the payload of a request with a
+// Content-Range, unless it starts at start and the upload has exactly start
+// bytes. The data of a request retried after a gap or an overlap is rejected
+// with ErrBlobUploadRangeInvalid rather than appended at the wrong offset.
+func WithUploadRange(ctx context.Context, start int64) context.Context {
+	return context.WithValue(ctx, uploadRangeKey{}, start)
 }
 
 var _ distribution.BlobWriter = &blobWriter{}
@@ -110,6 +132,10 @@ func (bw *blobWriter) Size() int64 {
 }
 
 func (bw *blobWriter) Write(p []byte) (int, error) {
+	if err := bw.checkRange(); err != nil {
+		return 0, err
+	}
+
 	// Ensure that the current write offset matches how many bytes have been
 	// written to the digester. If not, we need to update the digest state to
 	// match the current write position.
@@ -121,14 +147,22 @@ func (bw *blobWriter) Write(p []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if err := bw.sync(); err != nil {
+		return 0, err
+	}
 
 	n, err := bw.digester.Hash().Write(p)
 	bw.written += int64(n)
+	bw.reportProgress(n)
 
 	return n, err
 }
 
 func (bw *blobWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	if err := bw.checkRange(); err != nil {
+		return 0, err
+	}
+
 	// Ensure that the current write offset matches how many bytes have been
 	// written to the digester. If not, we need to update the digest state to
 	// match the current write position.
@@ -140,12 +174,68 @@ func (bw *blobWriter) ReadFrom(r io.Reader) (n int64, err error) {
 	// the amount written to the digester as well as ensuring that we
 	// write to the fileWriter first
 	tee := io.TeeReader(r, bw.fileWriter)
-	nn, err := io.Copy(bw.digester.Hash(), tee)
+	var digester io.Writer = bw.digester.Hash()
+	if bw.progress != nil {
+		digester = &progressWriter{Writer: digester, bw: bw}
+	}
+	nn, err := io.Copy(digester, tee)
 	bw.written += nn
 
+	// The data received is stored even when reading more fails, such that
+	// the upload resumes after it.
+	if serr := bw.sync(); err == nil {
+		err = serr
+	}
 	return nn, err
 }
 
+// checkRange ensures that the data about to be written starts at the end of
+// the upload, if its range is known. The range only applies to the first
+// write.
+func (bw *blobWriter) checkRange() error {
+	if bw.rangeStart < 0 {
+		return nil
+	}
+	if size := bw.Size(); bw.rangeStart != size {
+		return distribution.ErrBlobUploadRangeInvalid{Start: bw.rangeStart, Size: size}
+	}
+	bw.rangeStart = -1
+	return nil
+}
+
+// sync flushes the data written to the upload to the storage, when the
+// storage driver buffers it, so that the size of the upload, as reported to
+// the clients resuming it, is the size of the data written.
+func (bw *blobWriter) sync() error {
+	syncer, ok := bw.fileWriter.(storagedriver.FileWriterSyncer)
+	if !ok {
+		return nil
+	}
+	return syncer.Sync()
+}
+
+// reportProgress reports the n bytes written to the upload to the progress
+// callback, if any.
+func (bw *blobWriter) reportProgress(n int) {
+	if bw.progress != nil {
+		bw.progressWritten += int64(n)
+		bw.progress(bw.progressWritten, bw.progressTotal)
+	}
+}
+
+// progressWriter reports the progress of the upload after each write of
+// ReadFrom, once the written data is stored and digested.
+type progressWriter struct {
+	io.Writer
+	bw *blobWriter
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.Writer.Write(p)
+	pw.bw.reportProgress(n)
+	return n, err
+}
+
 func (bw *blobWriter) Close() error {
 	if bw.committed {
 		return errors.New("blobwriter close after commit")
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// newBloomFilter returns a bloom filter sized for n strings, with a false
+// positive rate of at most p once they are added. The number of bits is
+// rounded up to a power of two, which keeps the rate below p.
+func newBloomFilter(n int, p float64) *bloom.BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	optimal, hashes := bloom.EstimateParameters(uint(n), p)
+	m := uint(64)
+	for m < optimal {
+		m <<= 1
+	}
+	return bloom.New(m, hashes)
+}
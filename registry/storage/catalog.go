@@ -134,7 +134,9 @@ func compareReplaceInline(s1, s2 string, old, new byte) int {
 
 // handleRepository calls function fn with a repository path if fileInfo
 // has a path of a repository under root and that it is lexographically
-// after last. Otherwise, it will return ErrSkipDir. This should be used
+// after last. Otherwise, it will return ErrSkipDir. Directories holding
+// only repositories up to last are skipped as well, such that a walk
+// resuming after last does not list them again. This should be used
 // with Walk to do handling with repositories in a storage.
 func handleRepository(fileInfo driver.FileInfo, root, last string, fn func(repoPath string) error) error {
 	filePath := fileInfo.Path()
@@ -153,6 +155,8 @@ func handleRepository(fileInfo driver.FileInfo, root, last string, fn func(repoP
 		return driver.ErrSkipDir
 	} else if strings.HasPrefix(file, "_") {
 		return driver.ErrSkipDir
+	} else if fileInfo.IsDir() && lessPath(repo, last) && !strings.HasPrefix(last, repo+"/") {
+		return driver.ErrSkipDir
 	}
 
 	return nil
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/distribution/distribution/v3"
@@ -242,6 +243,49 @@ func TestCatalogWalkError(t *testing.T) {
 	}
 }
 
+// listRecordingDriver records the directories listed by Walk.
+type listRecordingDriver struct {
+	driver.StorageDriver
+	listed []string
+}
+
+func (d *listRecordingDriver) List(ctx context.Context, path string) ([]string, error) {
+	d.listed = append(d.listed, path)
+	return d.StorageDriver.List(ctx, path)
+}
+
+func (d *listRecordingDriver) Walk(ctx context.Context, path string, f driver.WalkFn) error {
+	return driver.WalkFallback(ctx, d, path, f)
+}
+
+func TestCatalogSkipsBeforeLast(t *testing.T) {
+	env := setupFS(t)
+	d := &listRecordingDriver{StorageDriver: env.driver}
+	registry, err := NewRegistry(env.ctx, d, EnableSchema1)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	p := make([]string, 3)
+	numFilled, err := registry.Repositories(env.ctx, p, "foo/a")
+	if err != nil || numFilled != len(p) {
+		t.Fatalf("expected more values in catalog, got %d, %v", numFilled, err)
+	}
+	if !testEq(p, env.expected[4:7], numFilled) {
+		t.Errorf("expected %v, got %v", env.expected[4:7], p)
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, listed := range d.listed {
+		if strings.HasPrefix(listed, root+"/bar") {
+			t.Errorf("unexpected listing of %s, before the last repository", listed)
+		}
+	}
+}
+
 func BenchmarkPathCompareEqual(B *testing.B) {
 	B.StopTimer()
 	pp := randomPath(100)
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strconv"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// gzipMagic is the header every gzip stream starts with. Manifests are JSON
+// documents, so stored content carrying this header is the only case in
+// which the compression marker needs to be consulted on read.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// maxCompressedBlobSize is the largest size of a blob stored compressed.
+// Compressed content is read whole, so it is at most maxBlobGetSize bytes
+// uncompressed, and gzip adds at most 5 bytes to each stored block of 64 KiB,
+// along with its 18 bytes of header and trailer.
+const maxCompressedBlobSize = maxBlobGetSize + (maxBlobGetSize/(64<<10)+1)*5 + 18
+
+// mayBeCompressed reports whether a blob of size bytes, compressed or not,
+// may be stored compressed, and thus whether its compression marker needs to
+// be looked up. Larger blobs, such as most layers, are spared the lookup.
+func mayBeCompressed(size int64) bool {
+	return size <= maxCompressedBlobSize
+}
+
+// compressContent gzip compresses p.
+func compressContent(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressContent reverses compressContent.
+func decompressContent(p []byte) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	return readAllLimited(gr, maxBlobGetSize)
+}
+
+// uncompressedSize returns the size of the uncompressed content of the blob
+// identified by dgst, as recorded in its compression marker. The boolean
+// result is false when the blob is not stored compressed.
+func uncompressedSize(ctx context.Context, d driver.StorageDriver, dgst digest.Digest) (int64, bool, error) {
+	markerPath, err := pathFor(blobCompressedPathSpec{digest: dgst})
+	if err != nil {
+		return 0, false, err
+	}
+
+	content, err := d.GetContent(ctx, markerPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	size, err := strconv.ParseInt(string(content), 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return size, true, nil
+}
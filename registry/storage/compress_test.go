@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/cache/memory"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestManifestStorageCompressed(t *testing.T) {
+	k, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testManifestStorage(t, true, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)), EnableDelete, EnableRedirect, Schema1SigningKey(k), EnableSchema1, CompressManifests)
+}
+
+// makeImageIndex returns an image index with an entry for each of n
+// platforms.
+func makeImageIndex(t testing.TB, n int) *manifestlist.DeserializedManifestList {
+	var descriptors []manifestlist.ManifestDescriptor
+	for i := 0; i < n; i++ {
+		descriptors = append(descriptors, manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    digest.FromString(fmt.Sprintf("platform-%d", i)),
+				Size:      int64(1000 + i),
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: "amd64",
+				OS:           "linux",
+				Variant:      fmt.Sprintf("v%d", i),
+			},
+		})
+	}
+
+	index, err := manifestlist.FromDescriptorsWithMediaType(descriptors, v1.MediaTypeImageIndex)
+	if err != nil {
+		t.Fatalf("unexpected error creating index: %v", err)
+	}
+	return index
+}
+
+// putImageIndex stores index in a new registry configured with options and
+// returns the registry's driver and the stored payload.
+func putImageIndex(t testing.TB, index *manifestlist.DeserializedManifestList, options ...RegistryOption) (driver.StorageDriver, distribution.Namespace, distribution.ManifestService, []byte) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry, err := NewRegistry(ctx, d, options...)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	name, _ := reference.WithName("foo/index")
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	ms, err := repo.Manifests(ctx, SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ms.Put(ctx, index); err != nil {
+		t.Fatalf("unexpected error putting index: %v", err)
+	}
+
+	_, payload, err := index.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, registry, ms, payload
+}
+
+func storedSize(t testing.TB, d driver.StorageDriver, dgst digest.Digest) int64 {
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := d.Stat(context.Background(), dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func TestCompressedManifestStorage(t *testing.T) {
+	ctx := context.Background()
+	index := makeImageIndex(t, 100)
+	d, ns, ms, payload := putImageIndex(t, index, CompressManifests)
+	dgst := digest.FromBytes(payload)
+
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := d.GetContent(ctx, dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(stored, gzipMagic) || len(stored) >= len(payload) {
+		t.Fatalf("expected stored manifest to be compressed: %d >= %d", len(stored), len(payload))
+	}
+
+	size, ok, err := uncompressedSize(ctx, d, dgst)
+	if err != nil || !ok || size != int64(len(payload)) {
+		t.Fatalf("unexpected compression marker: %d, %t, %v", size, ok, err)
+	}
+
+	fetched, err := ms.Get(ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	_, fetchedPayload, err := fetched.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fetchedPayload, payload) {
+		t.Fatal("fetched manifest does not match stored manifest")
+	}
+
+	desc, err := ns.BlobStatter().Stat(ctx, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Size != int64(len(payload)) {
+		t.Fatalf("unexpected size: %d != %d", desc.Size, len(payload))
+	}
+
+	blobServer := ns.(*registry).blobServer
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	if err := blobServer.ServeBlob(ctx, w, req, dgst); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+	if !bytes.Equal(w.Body.Bytes(), payload) {
+		t.Fatal("served blob does not match stored manifest")
+	}
+}
+
+func TestCompressedManifestReadWithoutOption(t *testing.T) {
+	ctx := context.Background()
+	index := makeImageIndex(t, 10)
+	d, _, _, payload := putImageIndex(t, index, CompressManifests)
+	dgst := digest.FromBytes(payload)
+
+	// A registry started without the option still reads compressed
+	// manifests, through the manifest store and the blob API.
+	ns, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _ := reference.WithName("foo/index")
+	repo, err := ns.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := ms.Get(ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	_, fetchedPayload, err := fetched.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fetchedPayload, payload) {
+		t.Fatal("fetched manifest does not match stored manifest")
+	}
+
+	desc, err := ns.BlobStatter().Stat(ctx, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Size != int64(len(payload)) {
+		t.Fatalf("unexpected size: %d != %d", desc.Size, len(payload))
+	}
+
+	rc, err := ns.(*registry).blobStore.Open(ctx, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	opened, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, payload) {
+		t.Fatal("opened blob does not match stored manifest")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	if err := ns.(*registry).blobServer.ServeBlob(ctx, w, req, dgst); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+	if !bytes.Equal(w.Body.Bytes(), payload) {
+		t.Fatal("served blob does not match stored manifest")
+	}
+}
+
+// markerCountingDriver counts the reads of compression markers.
+type markerCountingDriver struct {
+	driver.StorageDriver
+	reads int32
+}
+
+func (d *markerCountingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if strings.HasSuffix(path, "/.compressed") {
+		atomic.AddInt32(&d.reads, 1)
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func TestCompressedMarkerSkippedForLargeBlobs(t *testing.T) {
+	ctx := context.Background()
+	d := &markerCountingDriver{StorageDriver: inmemory.New()}
+	ns, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Serving a blob stats it before checking its own marker, so small
+	// blobs have theirs read three times.
+	for _, tc := range []struct {
+		size  int
+		reads int32
+	}{
+		{size: maxCompressedBlobSize + 1, reads: 0},
+		{size: 1024, reads: 3},
+	} {
+		atomic.StoreInt32(&d.reads, 0)
+		content := bytes.Repeat([]byte{'a'}, tc.size)
+		dgst := digest.FromBytes(content)
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.PutContent(ctx, blobPath, content); err != nil {
+			t.Fatal(err)
+		}
+
+		desc, err := ns.BlobStatter().Stat(ctx, dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if desc.Size != int64(tc.size) {
+			t.Fatalf("unexpected size: %d != %d", desc.Size, tc.size)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		w := httptest.NewRecorder()
+		if err := ns.(*registry).blobServer.ServeBlob(ctx, w, req, dgst); err != nil {
+			t.Fatalf("unexpected error serving blob: %v", err)
+		}
+		if w.Body.Len() != tc.size {
+			t.Fatalf("unexpected served size: %d != %d", w.Body.Len(), tc.size)
+		}
+
+		if reads := atomic.LoadInt32(&d.reads); reads != tc.reads {
+			t.Fatalf("unexpected number of marker reads for a %d bytes blob: %d != %d", tc.size, reads, tc.reads)
+		}
+	}
+}
+
+// BenchmarkCompressedManifestSize reports the space used on disk by a 100
+// platform image index, with and without compression.
+func BenchmarkCompressedManifestSize(b *testing.B) {
+	index := makeImageIndex(b, 100)
+
+	for _, bc := range []struct {
+		name    string
+		options []RegistryOption
+	}{
+		{name: "uncompressed"},
+		{name: "compressed", options: []RegistryOption{CompressManifests}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var stored, payloadSize int64
+			for i := 0; i < b.N; i++ {
+				d, _, _, payload := putImageIndex(b, index, bc.options...)
+				stored = storedSize(b, d, digest.FromBytes(payload))
+				payloadSize = int64(len(payload))
+			}
+			b.ReportMetric(float64(stored), "stored-bytes")
+			b.ReportMetric(float64(stored)/float64(payloadSize), "stored/manifest")
+		})
+	}
+}
@@ -6,32 +6,56 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/base"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
-
-	azure "github.com/Azure/azure-sdk-for-go/storage"
 )
 
 const driverName = "azure"
 
 const (
-	paramAccountName = "accountname"
-	paramAccountKey  = "accountkey"
-	paramContainer   = "container"
-	paramRealm       = "realm"
-	maxChunkSize     = 4 * 1024 * 1024
+	maxChunkSize = 4 * 1024 * 1024
+
+	// maxPutContentSize is the largest blob uploaded with a single "Put Blob"
+	// operation, for service versions after "2016-05-31".
+	// https://docs.microsoft.com/en-us/rest/api/storageservices/put-blob#remarks
+	maxPutContentSize = 256 * 1024 * 1024
+
+	// userDelegationKeyLifetime is how long the user delegation keys signing
+	// the URLs are valid, below the 7 days accepted by the service.
+	userDelegationKeyLifetime = 6 * 24 * time.Hour
 )
 
 type driver struct {
-	client    azure.BlobStorageClient
-	container string
+	service                *service.Client
+	client                 *container.Client
+	rootPrefix             string
+	userDelegation         bool
+	copyStatusPollMaxRetry int
+	copyStatusPollDelay    time.Duration
+
+	mu        sync.Mutex
+	udc       *service.UserDelegationCredential
+	udcExpiry time.Time
 }
 
 type baseEmbed struct{ base.Base }
@@ -51,52 +75,112 @@ func (factory *azureDriverFactory) Create(parameters map[string]interface{}) (st
 }
 
 // FromParameters constructs a new Driver with a given parameters map.
+// Required parameters:
+// - container
+// - connectionstring, or accountname with either accountkey or credentials
 func FromParameters(parameters map[string]interface{}) (*Driver, error) {
-	accountName, ok := parameters[paramAccountName]
-	if !ok || fmt.Sprint(accountName) == "" {
-		return nil, fmt.Errorf("no %s parameter provided", paramAccountName)
-	}
-
-	accountKey, ok := parameters[paramAccountKey]
-	if !ok || fmt.Sprint(accountKey) == "" {
-		return nil, fmt.Errorf("no %s parameter provided", paramAccountKey)
-	}
-
-	container, ok := parameters[paramContainer]
-	if !ok || fmt.Sprint(container) == "" {
-		return nil, fmt.Errorf("no %s parameter provided", paramContainer)
-	}
-
-	realm, ok := parameters[paramRealm]
-	if !ok || fmt.Sprint(realm) == "" {
-		realm = azure.DefaultBaseURL
+	params, err := NewParameters(parameters)
+	if err != nil {
+		return nil, err
 	}
-
-	return New(fmt.Sprint(accountName), fmt.Sprint(accountKey), fmt.Sprint(container), fmt.Sprint(realm))
+	return NewWithParameters(*params)
 }
 
 // New constructs a new Driver with the given Azure Storage Account credentials
 func New(accountName, accountKey, container, realm string) (*Driver, error) {
-	api, err := azure.NewClient(accountName, accountKey, realm, azure.DefaultAPIVersion, true)
+	if realm == "" {
+		realm = defaultRealm
+	}
+	return NewWithParameters(Parameters{
+		Container:              container,
+		AccountName:            accountName,
+		AccountKey:             accountKey,
+		Realm:                  realm,
+		ServiceURL:             fmt.Sprintf("https://%s.blob.%s", accountName, realm),
+		CopyStatusPollMaxRetry: defaultCopyStatusPollMaxRetry,
+		CopyStatusPollDelay:    defaultCopyStatusPollDelay,
+	})
+}
+
+// NewWithParameters constructs a new Driver from the given parameters,
+// creating the container when it does not exist.
+func NewWithParameters(params Parameters) (*Driver, error) {
+	svc, userDelegation, err := newServiceClient(params)
 	if err != nil {
 		return nil, err
 	}
 
-	blobClient := api.GetBlobService()
-
 	// Create registry container
-	containerRef := blobClient.GetContainerReference(container)
-	if _, err = containerRef.CreateIfNotExists(nil); err != nil {
-		return nil, err
+	client := svc.NewContainerClient(params.Container)
+	if _, err := client.Create(context.Background(), nil); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		// Identities granted access to the container alone cannot
+		// create it, which is fine as long as it exists.
+		if _, perr := client.GetProperties(context.Background(), nil); perr != nil {
+			return nil, err
+		}
+	}
+
+	rootPrefix := strings.Trim(params.RootDirectory, "/")
+	if rootPrefix != "" {
+		rootPrefix += "/"
+	}
+	if !params.TrimLegacyRootPrefix {
+		// The names of the blobs stored by the legacy driver are the
+		// paths, starting with a slash.
+		rootPrefix = "/" + rootPrefix
 	}
 
 	d := &driver{
-		client:    blobClient,
-		container: container,
+		service:                svc,
+		client:                 client,
+		rootPrefix:             rootPrefix,
+		userDelegation:         userDelegation,
+		copyStatusPollMaxRetry: params.CopyStatusPollMaxRetry,
+		copyStatusPollDelay:    params.CopyStatusPollDelay,
 	}
 	return &Driver{baseEmbed: baseEmbed{Base: base.Base{StorageDriver: d}}}, nil
 }
 
+// newServiceClient returns the client of the storage service authenticated
+// as configured by params, and whether its URLs are signed with user
+// delegation keys rather than the account key.
+func newServiceClient(params Parameters) (*service.Client, bool, error) {
+	switch {
+	case params.ConnectionString != "":
+		client, err := service.NewClientFromConnectionString(params.ConnectionString, nil)
+		return client, false, err
+	case params.Credentials.Type == "":
+		cred, err := service.NewSharedKeyCredential(params.AccountName, params.AccountKey)
+		if err != nil {
+			return nil, false, err
+		}
+		client, err := service.NewClientWithSharedKeyCredential(params.ServiceURL, cred, nil)
+		return client, false, err
+	}
+
+	cred, err := newTokenCredential(params.Credentials)
+	if err != nil {
+		return nil, false, err
+	}
+	client, err := service.NewClient(params.ServiceURL, cred, nil)
+	return client, true, err
+}
+
+func newTokenCredential(creds Credentials) (azcore.TokenCredential, error) {
+	switch creds.Type {
+	case credentialsClientSecret:
+		return azidentity.NewClientSecretCredential(creds.TenantID, creds.ClientID, creds.Secret, nil)
+	case credentialsManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if creds.ClientID != "" {
+			options.ID = azidentity.ClientID(creds.ClientID)
+		}
+		return azidentity.NewManagedIdentityCredential(options)
+	default:
+		return azidentity.NewDefaultAzureCredential(nil)
+	}
+}
+
 // Implement the storagedriver.StorageDriver interface.
 func (d *driver) Name() string {
 	return driverName
@@ -104,8 +188,7 @@ func (d *driver) Name() string {
 
 // GetContent retrieves the content stored at "path" as a []byte.
 func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
-	blobRef := d.client.GetContainerReference(d.container).GetBlobReference(path)
-	blob, err := blobRef.Get(nil)
+	resp, err := d.client.NewBlobClient(d.blobName(path)).DownloadStream(ctx, nil)
 	if err != nil {
 		if is404(err) {
 			return nil, storagedriver.PathNotFoundError{Path: path}
@@ -113,178 +196,140 @@ func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
 		return nil, err
 	}
 
-	defer blob.Close()
-	return io.ReadAll(blob)
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
 }
 
 // PutContent stores the []byte content at a location designated by "path".
 func (d *driver) PutContent(ctx context.Context, path string, contents []byte) error {
-	// max size for block blobs uploaded via single "Put Blob" for version after "2016-05-31"
-	// https://docs.microsoft.com/en-us/rest/api/storageservices/put-blob#remarks
-	const limit = 256 * 1024 * 1024
-	if len(contents) > limit {
-		return fmt.Errorf("uploading %d bytes with PutContent is not supported; limit: %d bytes", len(contents), limit)
-	}
-
-	// Historically, blobs uploaded via PutContent used to be of type AppendBlob
-	// (https://github.com/distribution/distribution/pull/1438). We can't replace
-	// these blobs atomically via a single "Put Blob" operation without
-	// deleting them first. Once we detect they are BlockBlob type, we can
-	// overwrite them with an atomically "Put Blob" operation.
-	//
-	// While we delete the blob and create a new one, there will be a small
-	// window of inconsistency and if the Put Blob fails, we may end up with
-	// losing the existing data while migrating it to BlockBlob type. However,
-	// expectation is the clients pushing will be retrying when they get an error
-	// response.
-	blobRef := d.client.GetContainerReference(d.container).GetBlobReference(path)
-	err := blobRef.GetProperties(nil)
+	if len(contents) > maxPutContentSize {
+		return fmt.Errorf("uploading %d bytes with PutContent is not supported; limit: %d bytes", len(contents), maxPutContentSize)
+	}
+
+	// Blobs uploaded by the legacy driver may be of type AppendBlob, which
+	// cannot be replaced atomically by a "Put Blob" operation without
+	// deleting them first. As with the legacy driver, a failed upload
+	// after the deletion loses the existing data, which the clients pushing
+	// it are expected to retry.
+	name := d.blobName(path)
+	blobRef := d.client.NewBlobClient(name)
+	props, err := blobRef.GetProperties(ctx, nil)
 	if err != nil && !is404(err) {
 		return fmt.Errorf("failed to get blob properties: %v", err)
 	}
-	if err == nil && blobRef.Properties.BlobType != azure.BlobTypeBlock {
-		if err := blobRef.Delete(nil); err != nil {
-			return fmt.Errorf("failed to delete legacy blob (%s): %v", blobRef.Properties.BlobType, err)
+	if err == nil && props.BlobType != nil && *props.BlobType != blob.BlobTypeBlockBlob {
+		if _, err := blobRef.Delete(ctx, nil); err != nil {
+			return fmt.Errorf("failed to delete legacy blob (%s): %v", *props.BlobType, err)
 		}
 	}
 
-	r := bytes.NewReader(contents)
-	// reset properties to empty before doing overwrite
-	blobRef.Properties = azure.BlobProperties{}
-	return blobRef.CreateBlockBlobFromReader(r, nil)
+	_, err = d.client.NewBlockBlobClient(name).UploadBuffer(ctx, contents, nil)
+	return err
 }
 
 // Reader retrieves an io.ReadCloser for the content stored at "path" with a
-// given byte offset.
+// given byte offset. The content is streamed, resuming the download when the
+// connection fails while reading.
 func (d *driver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
-	blobRef := d.client.GetContainerReference(d.container).GetBlobReference(path)
-	if ok, err := blobRef.Exists(); err != nil {
-		return nil, err
-	} else if !ok {
-		return nil, storagedriver.PathNotFoundError{Path: path}
-	}
-
-	err := blobRef.GetProperties(nil)
+	blobRef := d.client.NewBlobClient(d.blobName(path))
+	props, err := blobRef.GetProperties(ctx, nil)
 	if err != nil {
+		if is404(err) {
+			return nil, storagedriver.PathNotFoundError{Path: path}
+		}
 		return nil, err
 	}
-	info := blobRef.Properties
-	size := info.ContentLength
-	if offset >= size {
+	if offset >= deref(props.ContentLength) {
 		return io.NopCloser(bytes.NewReader(nil)), nil
 	}
 
-	resp, err := blobRef.GetRange(&azure.GetBlobRangeOptions{
-		Range: &azure.BlobRange{
-			Start: uint64(offset),
-			End:   0,
-		},
+	resp, err := blobRef.DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset},
 	})
 	if err != nil {
+		if is404(err) {
+			return nil, storagedriver.PathNotFoundError{Path: path}
+		}
 		return nil, err
 	}
-	return resp, nil
+	return resp.NewRetryReader(ctx, nil), nil
 }
 
 // Writer returns a FileWriter which will store the content written to it
 // at the location designated by "path" after the call to Commit.
 func (d *driver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
-	blobRef := d.client.GetContainerReference(d.container).GetBlobReference(path)
-	blobExists, err := blobRef.Exists()
-	if err != nil {
-		return nil, err
-	}
+	name := d.blobName(path)
+	blobRef := d.client.NewAppendBlobClient(name)
+
 	var size int64
-	if blobExists {
-		if append {
-			err = blobRef.GetProperties(nil)
-			if err != nil {
-				return nil, err
-			}
-			blobProperties := blobRef.Properties
-			size = blobProperties.ContentLength
-		} else {
-			err = blobRef.Delete(nil)
-			if err != nil {
-				return nil, err
-			}
-		}
-	} else {
-		if append {
-			return nil, storagedriver.PathNotFoundError{Path: path}
-		}
-		err = blobRef.PutAppendBlob(nil)
+	if append {
+		props, err := blobRef.GetProperties(ctx, nil)
 		if err != nil {
+			if is404(err) {
+				return nil, storagedriver.PathNotFoundError{Path: path}
+			}
 			return nil, err
 		}
+		size = deref(props.ContentLength)
+	} else if _, err := blobRef.Create(ctx, nil); err != nil {
+		return nil, err
 	}
 
-	return d.newWriter(path, size), nil
+	return d.newWriter(ctx, name, size), nil
 }
 
 // Stat retrieves the FileInfo for the given path, including the current size
 // in bytes and the creation time.
 func (d *driver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
-	blobRef := d.client.GetContainerReference(d.container).GetBlobReference(path)
 	// Check if the path is a blob
-	if ok, err := blobRef.Exists(); err != nil {
-		return nil, err
-	} else if ok {
-		err = blobRef.GetProperties(nil)
-		if err != nil {
+	if path != "/" {
+		props, err := d.client.NewBlobClient(d.blobName(path)).GetProperties(ctx, nil)
+		if err == nil {
+			return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+				Path:    path,
+				Size:    deref(props.ContentLength),
+				ModTime: deref(props.LastModified),
+				IsDir:   false,
+			}}, nil
+		}
+		if !is404(err) {
 			return nil, err
 		}
-		blobProperties := blobRef.Properties
-
-		return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
-			Path:    path,
-			Size:    blobProperties.ContentLength,
-			ModTime: time.Time(blobProperties.LastModified),
-			IsDir:   false,
-		}}, nil
 	}
 
-	// Check if path is a virtual container
-	virtContainerPath := path
-	if !strings.HasSuffix(virtContainerPath, "/") {
-		virtContainerPath += "/"
-	}
-
-	containerRef := d.client.GetContainerReference(d.container)
-	blobs, err := containerRef.ListBlobs(azure.ListBlobsParameters{
-		Prefix:     virtContainerPath,
-		MaxResults: 1,
+	// Check if path is a virtual directory
+	pager := d.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix:     to.Ptr(d.dirPrefix(path)),
+		MaxResults: to.Ptr(int32(1)),
 	})
-	if err != nil {
-		return nil, err
-	}
-	if len(blobs.Blobs) > 0 {
-		// path is a virtual container
-		return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
-			Path:  path,
-			IsDir: true,
-		}}, nil
+	if pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Segment.BlobItems) > 0 {
+			return storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+				Path:  path,
+				IsDir: true,
+			}}, nil
+		}
 	}
 
-	// path is not a blob or virtual container
+	// path is not a blob or virtual directory
 	return nil, storagedriver.PathNotFoundError{Path: path}
 }
 
 // List returns a list of the objects that are direct descendants of the given
 // path.
 func (d *driver) List(ctx context.Context, path string) ([]string, error) {
-	if path == "/" {
-		path = ""
-	}
-
-	blobs, err := d.listBlobs(d.container, path)
+	children, err := d.listChildren(ctx, path)
 	if err != nil {
-		return blobs, err
+		return nil, err
 	}
 
-	list := directDescendants(blobs, path)
-	if path != "" && len(list) == 0 {
-		return nil, storagedriver.PathNotFoundError{Path: path}
+	list := make([]string, 0, len(children))
+	for _, child := range children {
+		list = append(list, child.Path())
 	}
 	return list, nil
 }
@@ -292,10 +337,9 @@ func (d *driver) List(ctx context.Context, path string) ([]string, error) {
 // Move moves an object stored at sourcePath to destPath, removing the original
 // object.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
-	srcBlobRef := d.client.GetContainerReference(d.container).GetBlobReference(sourcePath)
-	sourceBlobURL := srcBlobRef.GetURL()
-	destBlobRef := d.client.GetContainerReference(d.container).GetBlobReference(destPath)
-	err := destBlobRef.Copy(sourceBlobURL, nil)
+	srcBlobRef := d.client.NewBlobClient(d.blobName(sourcePath))
+	destBlobRef := d.client.NewBlobClient(d.blobName(destPath))
+	resp, err := destBlobRef.StartCopyFromURL(ctx, srcBlobRef.URL(), nil)
 	if err != nil {
 		if is404(err) {
 			return storagedriver.PathNotFoundError{Path: sourcePath}
@@ -303,34 +347,68 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 		return err
 	}
 
-	return srcBlobRef.Delete(nil)
+	// The copy within the account is usually synchronous, but may be left
+	// pending by the service, in which case its status is polled.
+	copyStatus := deref(resp.CopyStatus)
+	delay := d.copyStatusPollDelay
+	for retries := 0; copyStatus == blob.CopyStatusTypePending; retries++ {
+		if retries >= d.copyStatusPollMaxRetry {
+			if _, err := destBlobRef.AbortCopyFromURL(ctx, deref(resp.CopyID), nil); err != nil {
+				return fmt.Errorf("failed to abort the pending copy of %s to %s: %v", sourcePath, destPath, err)
+			}
+			return fmt.Errorf("the copy of %s to %s is still pending after %d polls", sourcePath, destPath, retries)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+
+		props, err := destBlobRef.GetProperties(ctx, nil)
+		if err != nil {
+			return err
+		}
+		copyStatus = deref(props.CopyStatus)
+	}
+	if copyStatus != "" && copyStatus != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("the copy of %s to %s ended with status %s", sourcePath, destPath, copyStatus)
+	}
+
+	_, err = srcBlobRef.Delete(ctx, nil)
+	return err
 }
 
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (d *driver) Delete(ctx context.Context, path string) error {
-	blobRef := d.client.GetContainerReference(d.container).GetBlobReference(path)
-	ok, err := blobRef.DeleteIfExists(nil)
-	if err != nil {
-		return err
-	}
-	if ok {
+	_, err := d.client.NewBlobClient(d.blobName(path)).Delete(ctx, nil)
+	if err == nil {
 		return nil // was a blob and deleted, return
 	}
-
-	// Not a blob, see if path is a virtual container with blobs
-	blobs, err := d.listBlobs(d.container, path)
-	if err != nil {
+	if !is404(err) {
 		return err
 	}
 
-	for _, b := range blobs {
-		blobRef = d.client.GetContainerReference(d.container).GetBlobReference(b)
-		if err = blobRef.Delete(nil); err != nil {
+	// Not a blob, see if path is a virtual directory with blobs
+	deleted := 0
+	pager := d.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix: to.Ptr(d.dirPrefix(path)),
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
 			return err
 		}
+		for _, item := range resp.Segment.BlobItems {
+			if _, err := d.client.NewBlobClient(*item.Name).Delete(ctx, nil); err != nil && !is404(err) {
+				return err
+			}
+			deleted++
+		}
 	}
 
-	if len(blobs) == 0 {
+	if deleted == 0 {
 		return storagedriver.PathNotFoundError{Path: path}
 	}
 	return nil
@@ -338,8 +416,18 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 
 // URLFor returns a publicly accessible URL for the blob stored at given path
 // for specified duration by making use of Azure Storage Shared Access Signatures (SAS).
-// See https://msdn.microsoft.com/en-us/library/azure/ee395415.aspx for more info.
+// The signatures are made with the account key, or with a user delegation
+// key when the driver authenticates with Azure Active Directory credentials.
+// See https://docs.microsoft.com/en-us/rest/api/storageservices/delegate-access-with-shared-access-signature for more info.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	method, ok := options["method"]
+	if ok {
+		methodString, ok := method.(string)
+		if !ok || (methodString != http.MethodGet && methodString != http.MethodHead) {
+			return "", storagedriver.ErrUnsupportedMethod{}
+		}
+	}
+
 	expiresTime := time.Now().UTC().Add(20 * time.Minute) // default expiration
 	expires, ok := options["expiry"]
 	if ok {
@@ -348,94 +436,185 @@ func (d *driver) URLFor(ctx context.Context, path string, options map[string]int
 			expiresTime = t
 		}
 	}
-	blobRef := d.client.GetContainerReference(d.container).GetBlobReference(path)
-	return blobRef.GetSASURI(azure.BlobSASOptions{
-		BlobServiceSASPermissions: azure.BlobServiceSASPermissions{
-			Read: true,
-		},
-		SASOptions: azure.SASOptions{
-			Expiry: expiresTime,
-		},
-	})
+
+	blobRef := d.client.NewBlobClient(d.blobName(path))
+	if !d.userDelegation {
+		u, err := blobRef.GetSASURL(sas.BlobPermissions{Read: true}, expiresTime, nil)
+		if errors.Is(err, bloberror.MissingSharedKeyCredential) {
+			// connection strings may come without an account key
+			return "", storagedriver.ErrUnsupportedMethod{}
+		}
+		return u, err
+	}
+
+	udc, udcExpiry, err := d.userDelegationCredential(ctx, expiresTime)
+	if err != nil {
+		return "", err
+	}
+	if expiresTime.After(udcExpiry) {
+		expiresTime = udcExpiry
+	}
+
+	urlParts, err := blob.ParseURL(blobRef.URL())
+	if err != nil {
+		return "", err
+	}
+	urlParts.SAS, err = sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		ExpiryTime:    expiresTime.UTC(),
+		Permissions:   (&sas.BlobPermissions{Read: true}).String(),
+		ContainerName: urlParts.ContainerName,
+		BlobName:      urlParts.BlobName,
+	}.SignWithUserDelegation(udc)
+	if err != nil {
+		return "", err
+	}
+	return urlParts.String(), nil
+}
+
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path until expiry has elapsed.
+func (d *driver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return d.URLFor(ctx, path, storagedriver.ExpiryOptions(options, expiry))
 }
 
 // Walk traverses a filesystem defined within driver, starting
-// from the given path, calling f on each file and directory
+// from the given path, calling f on each file and directory. The file infos
+// are taken from the listings of the directories, without a Stat for each
+// of them as in storagedriver.WalkFallback.
 func (d *driver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
-	return storagedriver.WalkFallback(ctx, d, path, f)
+	_, err := d.doWalk(ctx, path, f)
+	return err
 }
 
-// directDescendants will find direct descendants (blobs or virtual containers)
-// of from list of blob paths and will return their full paths. Elements in blobs
-// list must be prefixed with a "/" and
-//
-// Example: direct descendants of "/" in {"/foo", "/bar/1", "/bar/2"} is
-// {"/foo", "/bar"} and direct descendants of "bar" is {"/bar/1", "/bar/2"}
-func directDescendants(blobs []string, prefix string) []string {
-	if !strings.HasPrefix(prefix, "/") { // add trailing '/'
-		prefix = "/" + prefix
+func (d *driver) doWalk(ctx context.Context, path string, f storagedriver.WalkFn) (bool, error) {
+	children, err := d.listChildren(ctx, path)
+	if err != nil {
+		return false, err
 	}
-	if !strings.HasSuffix(prefix, "/") { // containerify the path
-		prefix += "/"
+	for _, fileInfo := range children {
+		err := f(fileInfo)
+		if err == nil && fileInfo.IsDir() {
+			if ok, err := d.doWalk(ctx, fileInfo.Path(), f); err != nil || !ok {
+				return ok, err
+			}
+		} else if err == storagedriver.ErrSkipDir {
+			// noop for folders, will just skip
+			if !fileInfo.IsDir() {
+				return false, nil // no error but stop iteration
+			}
+		} else if err != nil {
+			return false, err
+		}
 	}
+	return true, nil
+}
 
-	out := make(map[string]bool)
-	for _, b := range blobs {
-		if strings.HasPrefix(b, prefix) {
-			rel := b[len(prefix):]
-			c := strings.Count(rel, "/")
-			if c == 0 {
-				out[b] = true
-			} else {
-				out[prefix+rel[:strings.Index(rel, "/")]] = true
+// listChildren returns the file infos of the blobs and virtual directories
+// which are direct descendants of the given path, sorted by path.
+func (d *driver) listChildren(ctx context.Context, path string) ([]storagedriver.FileInfo, error) {
+	var children []storagedriver.FileInfo
+	pager := d.client.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
+		Prefix: to.Ptr(d.dirPrefix(path)),
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range resp.Segment.BlobPrefixes {
+			children = append(children, storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+				Path:  d.pathOf(strings.TrimSuffix(*prefix.Name, "/")),
+				IsDir: true,
+			}})
+		}
+		for _, item := range resp.Segment.BlobItems {
+			fields := storagedriver.FileInfoFields{Path: d.pathOf(*item.Name)}
+			if item.Properties != nil {
+				fields.Size = deref(item.Properties.ContentLength)
+				fields.ModTime = deref(item.Properties.LastModified)
 			}
+			children = append(children, storagedriver.FileInfoInternal{FileInfoFields: fields})
 		}
 	}
 
-	var keys []string
-	for k := range out {
-		keys = append(keys, k)
+	if path != "/" && len(children) == 0 {
+		return nil, storagedriver.PathNotFoundError{Path: path}
 	}
-	return keys
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Path() < children[j].Path()
+	})
+	return children, nil
 }
 
-func (d *driver) listBlobs(container, virtPath string) ([]string, error) {
-	if virtPath != "" && !strings.HasSuffix(virtPath, "/") { // containerify the path
-		virtPath += "/"
+// userDelegationCredential returns a user delegation key valid until at
+// least the given time, if the service allows it, along with its expiry. The
+// key is cached and renewed once it no longer covers the requested times
+// and half of its lifetime elapsed.
+func (d *driver) userDelegationCredential(ctx context.Context, expires time.Time) (*service.UserDelegationCredential, time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.udc != nil && (!expires.After(d.udcExpiry) || time.Until(d.udcExpiry) > userDelegationKeyLifetime/2) {
+		return d.udc, d.udcExpiry, nil
 	}
 
-	out := []string{}
-	marker := ""
-	containerRef := d.client.GetContainerReference(d.container)
-	for {
-		resp, err := containerRef.ListBlobs(azure.ListBlobsParameters{
-			Marker: marker,
-			Prefix: virtPath,
-		})
-		if err != nil {
-			return out, err
-		}
+	now := time.Now().UTC()
+	expiry := now.Add(userDelegationKeyLifetime)
+	udc, err := d.service.GetUserDelegationCredential(ctx, service.KeyInfo{
+		Start:  to.Ptr(now.Format(sas.TimeFormat)),
+		Expiry: to.Ptr(expiry.Format(sas.TimeFormat)),
+	}, nil)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to get a user delegation key: %v", err)
+	}
 
-		for _, b := range resp.Blobs {
-			out = append(out, b.Name)
-		}
+	d.udc = udc
+	d.udcExpiry = expiry
+	return udc, expiry, nil
+}
 
-		if len(resp.Blobs) == 0 || resp.NextMarker == "" {
-			break
-		}
-		marker = resp.NextMarker
+// blobName returns the name of the blob stored at the given path, below the
+// root directory.
+func (d *driver) blobName(path string) string {
+	return d.rootPrefix + strings.TrimLeft(path, "/")
+}
+
+// dirPrefix returns the prefix of the names of the blobs stored below the
+// given path.
+func (d *driver) dirPrefix(path string) string {
+	prefix := d.blobName(path)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
 	}
-	return out, nil
+	return prefix
+}
+
+// pathOf returns the path of the blob with the given name.
+func (d *driver) pathOf(name string) string {
+	return "/" + strings.TrimPrefix(name, d.rootPrefix)
 }
 
 func is404(err error) bool {
-	statusCodeErr, ok := err.(azure.AzureStorageServiceError)
-	return ok && statusCodeErr.StatusCode == http.StatusNotFound
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// deref returns the value p points to, or the zero value when p is nil, as
+// for the optional fields of the responses of the service.
+func deref[T any](p *T) T {
+	var v T
+	if p != nil {
+		v = *p
+	}
+	return v
 }
 
+var _ storagedriver.FileWriterSyncer = &writer{}
+
 type writer struct {
 	driver    *driver
-	path      string
+	name      string
 	size      int64
 	bw        *bufio.Writer
 	closed    bool
@@ -443,15 +622,15 @@ type writer struct {
 	cancelled bool
 }
 
-func (d *driver) newWriter(path string, size int64) storagedriver.FileWriter {
+func (d *driver) newWriter(ctx context.Context, name string, size int64) storagedriver.FileWriter {
 	return &writer{
 		driver: d,
-		path:   path,
+		name:   name,
 		size:   size,
 		bw: bufio.NewWriterSize(&blockWriter{
-			client:    d.client,
-			container: d.container,
-			path:      path,
+			ctx:    ctx,
+			client: d.client,
+			name:   name,
 		}, maxChunkSize),
 	}
 }
@@ -482,6 +661,14 @@ func (w *writer) Close() error {
 	return w.bw.Flush()
 }
 
+// Sync appends the buffered content to the blob.
+func (w *writer) Sync() error {
+	if w.closed {
+		return fmt.Errorf("already closed")
+	}
+	return w.bw.Flush()
+}
+
 func (w *writer) Cancel() error {
 	if w.closed {
 		return fmt.Errorf("already closed")
@@ -489,8 +676,8 @@ func (w *writer) Cancel() error {
 		return fmt.Errorf("already committed")
 	}
 	w.cancelled = true
-	blobRef := w.driver.client.GetContainerReference(w.driver.container).GetBlobReference(w.path)
-	return blobRef.Delete(nil)
+	_, err := w.driver.client.NewBlobClient(w.name).Delete(context.Background(), nil)
+	return err
 }
 
 func (w *writer) Commit() error {
@@ -505,22 +692,24 @@ func (w *writer) Commit() error {
 	return w.bw.Flush()
 }
 
+// blockWriter appends the content written to it to an append blob, in blocks
+// of at most maxChunkSize bytes.
 type blockWriter struct {
-	client    azure.BlobStorageClient
-	container string
-	path      string
+	ctx    context.Context
+	client *container.Client
+	name   string
 }
 
 func (bw *blockWriter) Write(p []byte) (int, error) {
 	n := 0
-	blobRef := bw.client.GetContainerReference(bw.container).GetBlobReference(bw.path)
+	blobRef := bw.client.NewAppendBlobClient(bw.name)
 	for offset := 0; offset < len(p); offset += maxChunkSize {
 		chunkSize := maxChunkSize
 		if offset+chunkSize > len(p) {
 			chunkSize = len(p) - offset
 		}
-		err := blobRef.AppendBlock(p[offset:offset+chunkSize], nil)
-		if err != nil {
+		chunk := streaming.NopCloser(bytes.NewReader(p[offset : offset+chunkSize]))
+		if _, err := blobRef.AppendBlock(bw.ctx, chunk, nil); err != nil {
 			return n, err
 		}
 
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/testsuites"
@@ -61,3 +62,129 @@ func init() {
 
 	testsuites.RegisterSuite(azureDriverConstructor, skipCheck)
 }
+
+func TestNewParameters(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		parameters map[string]interface{}
+		err        string
+		serviceURL string
+	}{
+		{
+			name:       "account key",
+			parameters: map[string]interface{}{"container": "registry", "accountname": "acct", "accountkey": "key"},
+			serviceURL: "https://acct.blob.core.windows.net",
+		},
+		{
+			name:       "realm",
+			parameters: map[string]interface{}{"container": "registry", "accountname": "acct", "accountkey": "key", "realm": "core.chinacloudapi.cn"},
+			serviceURL: "https://acct.blob.core.chinacloudapi.cn",
+		},
+		{
+			name:       "connection string",
+			parameters: map[string]interface{}{"container": "registry", "connectionstring": "UseDevelopmentStorage=true"},
+		},
+		{
+			name: "managed identity",
+			parameters: map[string]interface{}{"container": "registry", "accountname": "acct",
+				"credentials": map[interface{}]interface{}{"type": "managed_identity"}},
+			serviceURL: "https://acct.blob.core.windows.net",
+		},
+		{
+			name: "service url",
+			parameters: map[string]interface{}{"container": "registry", "serviceurl": "http://127.0.0.1:10000/devstoreaccount1",
+				"credentials": map[string]interface{}{"type": "default_credentials"}},
+			serviceURL: "http://127.0.0.1:10000/devstoreaccount1",
+		},
+		{
+			name:       "missing container",
+			parameters: map[string]interface{}{"accountname": "acct", "accountkey": "key"},
+			err:        "no container parameter provided",
+		},
+		{
+			name:       "missing credentials",
+			parameters: map[string]interface{}{"container": "registry", "accountname": "acct"},
+			err:        "no accountkey, connectionstring or credentials parameter provided",
+		},
+		{
+			name: "incomplete client secret",
+			parameters: map[string]interface{}{"container": "registry", "accountname": "acct",
+				"credentials": map[string]interface{}{"type": "client_secret", "clientid": "id"}},
+			err: "the client_secret credentials require the clientid, tenantid and secret parameters",
+		},
+		{
+			name: "unknown credentials",
+			parameters: map[string]interface{}{"container": "registry", "accountname": "acct",
+				"credentials": map[string]interface{}{"type": "password"}},
+			err: `invalid credentials type "password"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			params, err := NewParameters(tc.parameters)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.ServiceURL != tc.serviceURL {
+				t.Errorf("expected service URL %q, got %q", tc.serviceURL, params.ServiceURL)
+			}
+		})
+	}
+}
+
+func TestNewParametersCopyStatusPoll(t *testing.T) {
+	params, err := NewParameters(map[string]interface{}{
+		"container":              "registry",
+		"accountname":            "acct",
+		"accountkey":             "key",
+		"copystatuspollmaxretry": "10",
+		"copystatuspolldelay":    "1s",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.CopyStatusPollMaxRetry != 10 {
+		t.Errorf("expected 10 copy status polls, got %d", params.CopyStatusPollMaxRetry)
+	}
+	if params.CopyStatusPollDelay != time.Second {
+		t.Errorf("expected a copy status poll delay of 1s, got %v", params.CopyStatusPollDelay)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	d := &driver{rootPrefix: "root/"}
+	if name := d.blobName("/docker/registry"); name != "root/docker/registry" {
+		t.Errorf("unexpected blob name %q", name)
+	}
+	if prefix := d.dirPrefix("/"); prefix != "root/" {
+		t.Errorf("unexpected prefix %q", prefix)
+	}
+	if prefix := d.dirPrefix("/docker"); prefix != "root/docker/" {
+		t.Errorf("unexpected prefix %q", prefix)
+	}
+	if path := d.pathOf("root/docker/registry"); path != "/docker/registry" {
+		t.Errorf("unexpected path %q", path)
+	}
+
+	d = &driver{}
+	if prefix := d.dirPrefix("/"); prefix != "" {
+		t.Errorf("unexpected prefix %q", prefix)
+	}
+
+	// The names of the blobs of the legacy driver start with a slash.
+	d = &driver{rootPrefix: "/"}
+	if name := d.blobName("/docker/registry"); name != "/docker/registry" {
+		t.Errorf("unexpected legacy blob name %q", name)
+	}
+	if prefix := d.dirPrefix("/"); prefix != "/" {
+		t.Errorf("unexpected legacy prefix %q", prefix)
+	}
+	if path := d.pathOf("/docker/registry"); path != "/docker/registry" {
+		t.Errorf("unexpected legacy path %q", path)
+	}
+}
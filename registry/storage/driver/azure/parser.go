@@ -0,0 +1,122 @@
+package azure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	defaultRealm                  = "core.windows.net"
+	defaultCopyStatusPollMaxRetry = 5
+	defaultCopyStatusPollDelay    = 100 * time.Millisecond
+)
+
+// The types of the credentials the driver authenticates with, in addition to
+// a shared account key or a connection string.
+const (
+	credentialsClientSecret    = "client_secret"
+	credentialsManagedIdentity = "managed_identity"
+	credentialsDefault         = "default_credentials"
+)
+
+// Credentials configures the Azure Active Directory credentials the driver
+// authenticates with, when neither an account key nor a connection string is
+// provided.
+type Credentials struct {
+	// Type is one of "client_secret", "managed_identity" or
+	// "default_credentials".
+	Type string `mapstructure:"type"`
+	// ClientID is the client ID of the service principal or of the user
+	// assigned managed identity. It is optional for a managed identity,
+	// for which the system assigned identity is then used.
+	ClientID string `mapstructure:"clientid"`
+	// TenantID is the tenant of the service principal.
+	TenantID string `mapstructure:"tenantid"`
+	// Secret is the client secret of the service principal.
+	Secret string `mapstructure:"secret"`
+}
+
+// Parameters encapsulates all of the driver parameters after all values have
+// been set.
+type Parameters struct {
+	Container        string      `mapstructure:"container"`
+	AccountName      string      `mapstructure:"accountname"`
+	AccountKey       string      `mapstructure:"accountkey"`
+	ConnectionString string      `mapstructure:"connectionstring"`
+	Credentials      Credentials `mapstructure:"credentials"`
+	// Realm is the domain name suffix of the storage service endpoint,
+	// "core.windows.net" by default.
+	Realm string `mapstructure:"realm"`
+	// ServiceURL overrides the storage service endpoint derived from the
+	// account name and the realm.
+	ServiceURL    string `mapstructure:"serviceurl"`
+	RootDirectory string `mapstructure:"rootdirectory"`
+	// CopyStatusPollMaxRetry is the number of times the status of a copy
+	// started by Move is polled before giving up on it.
+	CopyStatusPollMaxRetry int `mapstructure:"copystatuspollmaxretry"`
+	// CopyStatusPollDelay is the delay before the first poll of the status
+	// of a copy, doubled after each poll.
+	CopyStatusPollDelay time.Duration `mapstructure:"copystatuspolldelay"`
+	// TrimLegacyRootPrefix stores the blobs under names without the
+	// leading slash of the names of the blobs stored by the legacy driver,
+	// which are then not found.
+	TrimLegacyRootPrefix bool `mapstructure:"trimlegacyrootprefix"`
+}
+
+// NewParameters decodes the driver parameters from the given parameters map
+// and validates them.
+func NewParameters(parameters map[string]interface{}) (*Parameters, error) {
+	params := Parameters{
+		Realm:                  defaultRealm,
+		CopyStatusPollMaxRetry: defaultCopyStatusPollMaxRetry,
+		CopyStatusPollDelay:    defaultCopyStatusPollDelay,
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(parameters); err != nil {
+		return nil, err
+	}
+
+	if params.Container == "" {
+		return nil, fmt.Errorf("no container parameter provided")
+	}
+
+	if params.ConnectionString != "" {
+		return &params, nil
+	}
+
+	if params.AccountName == "" && params.ServiceURL == "" {
+		return nil, fmt.Errorf("no accountname parameter provided")
+	}
+
+	switch params.Credentials.Type {
+	case "":
+		if params.AccountKey == "" {
+			return nil, fmt.Errorf("no accountkey, connectionstring or credentials parameter provided")
+		}
+		if params.AccountName == "" {
+			return nil, fmt.Errorf("no accountname parameter provided")
+		}
+	case credentialsClientSecret:
+		if params.Credentials.ClientID == "" || params.Credentials.TenantID == "" || params.Credentials.Secret == "" {
+			return nil, fmt.Errorf("the %s credentials require the clientid, tenantid and secret parameters", credentialsClientSecret)
+		}
+	case credentialsManagedIdentity, credentialsDefault:
+	default:
+		return nil, fmt.Errorf("invalid credentials type %q; must be one of %s, %s or %s",
+			params.Credentials.Type, credentialsClientSecret, credentialsManagedIdentity, credentialsDefault)
+	}
+
+	if params.ServiceURL == "" {
+		params.ServiceURL = fmt.Sprintf("https://%s.blob.%s", params.AccountName, params.Realm)
+	}
+	return &params, nil
+}
@@ -225,6 +225,21 @@ func (base *Base) URLFor(ctx context.Context, path string, options map[string]in
 	return str, base.setDriverName(e)
 }
 
+// URLForWithExpiry wraps URLForWithExpiry of underlying storage driver.
+func (base *Base) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	ctx, done := dcontext.WithTrace(ctx)
+	defer done("%s.URLForWithExpiry(%q, %s)", base.Name(), path, expiry)
+
+	if !storagedriver.PathRegexp.MatchString(path) {
+		return "", storagedriver.InvalidPathError{Path: path, DriverName: base.StorageDriver.Name()}
+	}
+
+	start := time.Now()
+	str, e := base.StorageDriver.URLForWithExpiry(ctx, path, expiry, options)
+	storageAction.WithValues(base.Name(), "URLForWithExpiry").UpdateSince(start)
+	return str, base.setDriverName(e)
+}
+
 // Walk wraps Walk of underlying storage driver.
 func (base *Base) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
 	ctx, done := dcontext.WithTrace(ctx)
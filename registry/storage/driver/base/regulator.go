@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strconv"
 	"sync"
+	"time"
 
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 )
@@ -182,3 +183,15 @@ func (r *regulator) URLFor(ctx context.Context, path string, options map[string]
 
 	return r.StorageDriver.URLFor(ctx, path, options)
 }
+
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path until expiry has elapsed, possibly using the given
+// options.
+// May return an ErrUnsupportedMethod in certain StorageDriver
+// implementations.
+func (r *regulator) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	r.enter()
+	defer r.exit()
+
+	return r.StorageDriver.URLForWithExpiry(ctx, path, expiry, options)
+}
@@ -0,0 +1,298 @@
+// Package cache provides a storagedriver.StorageDriver caching the listings,
+// file infos and small file contents of the storage driver it wraps, such as
+// the tag links read on every request of busy registries.
+//
+// The cache is invalidated by the writes going through it. The writes of
+// other registry instances sharing the storage are only seen once the cached
+// entries expire, which bounds how stale the cache gets.
+package cache
+
+import (
+	"context"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// DefaultSize is the number of entries cached if no size is explicitly
+	// configured.
+	DefaultSize = 10000
+
+	// DefaultTTL is how long entries are cached if no TTL is explicitly
+	// configured.
+	DefaultTTL = 5 * time.Second
+
+	// maxContentSize is the size of the largest file contents cached.
+	maxContentSize = 64 << 10
+)
+
+// Options configures the cache of a cached driver.
+type Options struct {
+	// Size is the number of entries cached. It defaults to DefaultSize, and
+	// negative values place no limit on the number of entries.
+	Size int
+
+	// TTL is how long entries are cached. It defaults to DefaultTTL.
+	TTL time.Duration
+
+	// Pattern matches the paths cached. All the paths are cached if nil.
+	Pattern *regexp.Regexp
+}
+
+type entryKind int
+
+const (
+	kindContent entryKind = iota
+	kindStat
+	kindList
+)
+
+type entryKey struct {
+	kind entryKind
+	path string
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// cachedDriver caches the results of GetContent, Stat and List of the
+// storage driver it embeds.
+type cachedDriver struct {
+	storagedriver.StorageDriver
+
+	lru     *lru.Cache
+	ttl     time.Duration
+	pattern *regexp.Regexp
+
+	// mu guards generation, which is incremented by every invalidation
+	// such that results read before an invalidation are not cached after
+	// it.
+	mu         sync.Mutex
+	generation uint64
+}
+
+var _ storagedriver.LockableDriver = &cachedDriver{}
+
+// New returns a storage driver caching the listings, file infos and file
+// contents of d as configured by options.
+func New(d storagedriver.StorageDriver, options Options) storagedriver.StorageDriver {
+	size := options.Size
+	switch {
+	case size == 0:
+		size = DefaultSize
+	case size < 0:
+		size = math.MaxInt
+	}
+	ttl := options.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	lruCache, err := lru.New(size)
+	if err != nil {
+		// New can only fail if size is <= 0, so this unreachable
+		panic(err)
+	}
+	return &cachedDriver{
+		StorageDriver: d,
+		lru:           lruCache,
+		ttl:           ttl,
+		pattern:       options.Pattern,
+	}
+}
+
+func (d *cachedDriver) cached(p string) bool {
+	return d.pattern == nil || d.pattern.MatchString(p)
+}
+
+func (d *cachedDriver) get(key entryKey) (interface{}, bool) {
+	v, ok := d.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(entry)
+	if time.Now().After(e.expires) {
+		d.lru.Remove(key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// add caches value under key, unless the cache was invalidated since
+// generation, when value was read.
+func (d *cachedDriver) add(key entryKey, value interface{}, generation uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.generation != generation {
+		return
+	}
+	d.lru.Add(key, entry{value: value, expires: time.Now().Add(d.ttl)})
+}
+
+func (d *cachedDriver) currentGeneration() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.generation
+}
+
+// invalidate removes the entries of p, of the paths under it if tree is set,
+// and the file infos and listings of its parent directories.
+func (d *cachedDriver) invalidate(p string, tree bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.generation++
+	if tree {
+		for _, k := range d.lru.Keys() {
+			key := k.(entryKey)
+			if key.path == p || strings.HasPrefix(key.path, p+"/") {
+				d.lru.Remove(key)
+			}
+		}
+	} else {
+		for _, kind := range []entryKind{kindContent, kindStat, kindList} {
+			d.lru.Remove(entryKey{kind: kind, path: p})
+		}
+	}
+	for dir := path.Dir(p); ; dir = path.Dir(dir) {
+		d.lru.Remove(entryKey{kind: kindStat, path: dir})
+		d.lru.Remove(entryKey{kind: kindList, path: dir})
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+}
+
+// GetContent retrieves the content stored at "path" as a []byte, from the
+// cache if the content is small enough to be cached.
+func (d *cachedDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if !d.cached(path) {
+		return d.StorageDriver.GetContent(ctx, path)
+	}
+	key := entryKey{kind: kindContent, path: path}
+	if v, ok := d.get(key); ok {
+		return append([]byte(nil), v.([]byte)...), nil
+	}
+	generation := d.currentGeneration()
+	content, err := d.StorageDriver.GetContent(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) <= maxContentSize {
+		d.add(key, append([]byte(nil), content...), generation)
+	}
+	return content, nil
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *cachedDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	defer d.invalidate(path, false)
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+// Writer returns a FileWriter which will store the content written to it
+// at the location designated by "path" after the call to Commit.
+func (d *cachedDriver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	d.invalidate(path, false)
+	fw, err := d.StorageDriver.Writer(ctx, path, append)
+	if err != nil {
+		return nil, err
+	}
+	return &fileWriter{FileWriter: fw, driver: d, path: path}, nil
+}
+
+// Stat retrieves the FileInfo for the given path, from the cache if cached.
+func (d *cachedDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if !d.cached(path) {
+		return d.StorageDriver.Stat(ctx, path)
+	}
+	key := entryKey{kind: kindStat, path: path}
+	if v, ok := d.get(key); ok {
+		return v.(storagedriver.FileInfo), nil
+	}
+	generation := d.currentGeneration()
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	d.add(key, fi, generation)
+	return fi, nil
+}
+
+// List returns a list of the objects that are direct descendants of the
+// given path, from the cache if cached.
+func (d *cachedDriver) List(ctx context.Context, path string) ([]string, error) {
+	if !d.cached(path) {
+		return d.StorageDriver.List(ctx, path)
+	}
+	key := entryKey{kind: kindList, path: path}
+	if v, ok := d.get(key); ok {
+		return append([]string(nil), v.([]string)...), nil
+	}
+	generation := d.currentGeneration()
+	children, err := d.StorageDriver.List(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	d.add(key, append([]string(nil), children...), generation)
+	return children, nil
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the
+// original object.
+func (d *cachedDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	defer func() {
+		d.invalidate(sourcePath, true)
+		d.invalidate(destPath, true)
+	}()
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+func (d *cachedDriver) Delete(ctx context.Context, path string) error {
+	defer d.invalidate(path, true)
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+// Lock acquires the lock of key with the wrapped driver, if it can lock.
+func (d *cachedDriver) Lock(ctx context.Context, key string) (func(), error) {
+	return storagedriver.AsLockable(d.StorageDriver).Lock(ctx, key)
+}
+
+var _ storagedriver.FileWriterSyncer = &fileWriter{}
+
+// fileWriter invalidates the cache of its path once it syncs, commits or
+// closes.
+type fileWriter struct {
+	storagedriver.FileWriter
+
+	driver *cachedDriver
+	path   string
+}
+
+// Sync syncs the wrapped writer, if it buffers the content written.
+func (fw *fileWriter) Sync() error {
+	syncer, ok := fw.FileWriter.(storagedriver.FileWriterSyncer)
+	if !ok {
+		return nil
+	}
+	defer fw.driver.invalidate(fw.path, false)
+	return syncer.Sync()
+}
+
+func (fw *fileWriter) Commit() error {
+	defer fw.driver.invalidate(fw.path, false)
+	return fw.FileWriter.Commit()
+}
+
+func (fw *fileWriter) Close() error {
+	defer fw.driver.invalidate(fw.path, false)
+	return fw.FileWriter.Close()
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+// countingDriver counts the calls reaching the driver it embeds.
+type countingDriver struct {
+	storagedriver.StorageDriver
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newCountingDriver() *countingDriver {
+	return &countingDriver{StorageDriver: inmemory.New(), calls: make(map[string]int)}
+}
+
+func (d *countingDriver) count(op, path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls[op+" "+path]++
+}
+
+func (d *countingDriver) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = make(map[string]int)
+}
+
+func (d *countingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	d.count("get", path)
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func (d *countingDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	d.count("stat", path)
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+func (d *countingDriver) List(ctx context.Context, path string) ([]string, error) {
+	d.count("list", path)
+	return d.StorageDriver.List(ctx, path)
+}
+
+func mustGetContent(t *testing.T, d storagedriver.StorageDriver, path string, expected string) {
+	t.Helper()
+	content, err := d.GetContent(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected {
+		t.Fatalf("unexpected content of %s: %q != %q", path, content, expected)
+	}
+}
+
+func mustList(t *testing.T, d storagedriver.StorageDriver, path string, expected ...string) {
+	t.Helper()
+	children, err := d.List(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(children, expected) {
+		t.Fatalf("unexpected children of %s: %v != %v", path, children, expected)
+	}
+}
+
+func TestCachedDriver(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingDriver()
+	d := New(backend, Options{})
+
+	if err := d.PutContent(ctx, "/a/b/link", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		mustGetContent(t, d, "/a/b/link", "first")
+		mustList(t, d, "/a/b", "/a/b/link")
+		if _, err := d.Stat(ctx, "/a/b/link"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, call := range []string{"get /a/b/link", "list /a/b", "stat /a/b/link"} {
+		if backend.calls[call] != 1 {
+			t.Fatalf("expected a single %s, got %d", call, backend.calls[call])
+		}
+	}
+
+	// Writes invalidate the entries of the path and its parents.
+	if err := d.PutContent(ctx, "/a/b/link", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	mustGetContent(t, d, "/a/b/link", "second")
+	if err := d.PutContent(ctx, "/a/b/other", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	mustList(t, d, "/a/b", "/a/b/link", "/a/b/other")
+
+	w, err := d.Writer(ctx, "/a/b/written", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mustList(t, d, "/a/b", "/a/b/link", "/a/b/other", "/a/b/written")
+
+	if err := d.Move(ctx, "/a/b/other", "/a/c/other"); err != nil {
+		t.Fatal(err)
+	}
+	mustList(t, d, "/a/b", "/a/b/link", "/a/b/written")
+	mustList(t, d, "/a", "/a/b", "/a/c")
+	if _, err := d.GetContent(ctx, "/a/b/other"); err == nil {
+		t.Fatal("expected the moved file not found")
+	}
+
+	if err := d.Delete(ctx, "/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetContent(ctx, "/a/b/link"); err == nil {
+		t.Fatal("expected the deleted file not found")
+	}
+	mustList(t, d, "/a", "/a/c")
+}
+
+// syncingDriver returns writers counting their syncs.
+type syncingDriver struct {
+	storagedriver.StorageDriver
+	syncs int
+}
+
+type syncingWriter struct {
+	storagedriver.FileWriter
+	driver *syncingDriver
+}
+
+func (d *syncingDriver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	fw, err := d.StorageDriver.Writer(ctx, path, append)
+	if err != nil {
+		return nil, err
+	}
+	return &syncingWriter{FileWriter: fw, driver: d}, nil
+}
+
+func (w *syncingWriter) Sync() error {
+	w.driver.syncs++
+	return nil
+}
+
+func TestCachedDriverWriterSync(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name    string
+		backend storagedriver.StorageDriver
+		syncs   int
+	}{
+		{name: "syncer", backend: &syncingDriver{StorageDriver: inmemory.New()}, syncs: 1},
+		{name: "non-syncer", backend: inmemory.New()},
+	} {
+		w, err := New(tc.backend, Options{}).Writer(ctx, "/a/data", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		syncer, ok := w.(storagedriver.FileWriterSyncer)
+		if !ok {
+			t.Fatalf("%s: expected the writer to implement FileWriterSyncer", tc.name)
+		}
+		if err := syncer.Sync(); err != nil {
+			t.Fatalf("%s: unexpected error syncing: %v", tc.name, err)
+		}
+		if d, ok := tc.backend.(*syncingDriver); ok && d.syncs != tc.syncs {
+			t.Fatalf("%s: unexpected number of syncs: %d != %d", tc.name, d.syncs, tc.syncs)
+		}
+		w.Close()
+	}
+}
+
+func TestCachedDriverTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingDriver()
+	d := New(backend, Options{TTL: 10 * time.Millisecond})
+
+	if err := backend.PutContent(ctx, "/link", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	mustGetContent(t, d, "/link", "first")
+
+	// Writes bypassing the cache are seen once the entries expire.
+	if err := backend.PutContent(ctx, "/link", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	mustGetContent(t, d, "/link", "first")
+	time.Sleep(20 * time.Millisecond)
+	mustGetContent(t, d, "/link", "second")
+}
+
+func TestCachedDriverPattern(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingDriver()
+	d := New(backend, Options{Pattern: regexp.MustCompile(`/_manifests/tags/`)})
+
+	for _, path := range []string{"/repo/_manifests/tags/latest/current/link", "/repo/_layers/link"} {
+		if err := d.PutContent(ctx, path, []byte("content")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend.reset()
+	for i := 0; i < 2; i++ {
+		mustGetContent(t, d, "/repo/_manifests/tags/latest/current/link", "content")
+		mustGetContent(t, d, "/repo/_layers/link", "content")
+	}
+	if n := backend.calls["get /repo/_manifests/tags/latest/current/link"]; n != 1 {
+		t.Fatalf("expected the matching path read once, got %d reads", n)
+	}
+	if n := backend.calls["get /repo/_layers/link"]; n != 2 {
+		t.Fatalf("expected the other path read twice, got %d reads", n)
+	}
+}
+
+func TestCachedDriverSize(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingDriver()
+	d := New(backend, Options{Size: 1})
+
+	for _, path := range []string{"/first", "/second"} {
+		if err := d.PutContent(ctx, path, []byte(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend.reset()
+	mustGetContent(t, d, "/first", "/first")
+	mustGetContent(t, d, "/second", "/second")
+	mustGetContent(t, d, "/first", "/first")
+	if n := backend.calls["get /first"]; n != 2 {
+		t.Fatalf("expected the evicted path read twice, got %d reads", n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/tracing"
 )
 
 // driverFactories stores an internal mapping between storage driver names and their respective
@@ -42,16 +43,35 @@ func Register(name string, factory StorageDriverFactory) {
 	driverFactories[name] = factory
 }
 
+// TracingParameter is the parameter which, set to true, makes Create wrap the
+// driver it creates to record an OpenTelemetry span for every call, with the
+// global tracer provider. The parameter is passed on to the driver, which
+// ignores it.
+const TracingParameter = "tracing"
+
 // Create a new storagedriver.StorageDriver with the given name and
 // parameters. To use a driver, the StorageDriverFactory must first be
 // registered with the given name. If no drivers are found, an
-// InvalidStorageDriverError is returned
+// InvalidStorageDriverError is returned. The driver is traced if the
+// TracingParameter is set.
 func Create(name string, parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
 	driverFactory, ok := driverFactories[name]
 	if !ok {
 		return nil, InvalidStorageDriverError{name}
 	}
-	return driverFactory.Create(parameters)
+	var traced bool
+	switch v := parameters[TracingParameter].(type) {
+	case nil:
+	case bool:
+		traced = v
+	default:
+		return nil, fmt.Errorf("invalid type for the %s parameter: %#v", TracingParameter, v)
+	}
+	driver, err := driverFactory.Create(parameters)
+	if err != nil || !traced {
+		return driver, err
+	}
+	return tracing.New(driver, nil), nil
 }
 
 // InvalidStorageDriverError records an attempt to construct an unregistered storage driver
@@ -0,0 +1,43 @@
+package factory_test
+
+import (
+	"testing"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+type fixedDriverFactory struct {
+	driver storagedriver.StorageDriver
+}
+
+func (f fixedDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
+	return f.driver, nil
+}
+
+func TestCreateTracing(t *testing.T) {
+	driver := inmemory.New()
+	factory.Register("fixed", fixedDriverFactory{driver: driver})
+
+	for _, tc := range []struct {
+		parameters map[string]interface{}
+		traced     bool
+	}{
+		{parameters: nil},
+		{parameters: map[string]interface{}{factory.TracingParameter: false}},
+		{parameters: map[string]interface{}{factory.TracingParameter: true}, traced: true},
+	} {
+		created, err := factory.Create("fixed", tc.parameters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if traced := created != storagedriver.StorageDriver(driver); traced != tc.traced {
+			t.Fatalf("unexpected tracing of the driver created with %v: %t", tc.parameters, traced)
+		}
+	}
+
+	if _, err := factory.Create("fixed", map[string]interface{}{factory.TracingParameter: "yes"}); err == nil {
+		t.Fatal("expected an error for an invalid tracing parameter")
+	}
+}
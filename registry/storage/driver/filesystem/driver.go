@@ -4,10 +4,13 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"strconv"
+	"syscall"
 	"time"
 
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
@@ -24,6 +27,10 @@ const (
 	// parameter. If the driver's parameters are less than this we set
 	// the parameters to minThreads
 	minThreads = uint64(25)
+
+	// lockDirectory is the directory of the root directory holding the
+	// files locked by Lock.
+	lockDirectory = ".locks"
 )
 
 // DriverParameters represents all configuration options available for the
@@ -31,6 +38,9 @@ const (
 type DriverParameters struct {
 	RootDirectory string
 	MaxThreads    uint64
+	// Reflink makes Move clone files with the FICLONE ioctl on copy-on-write
+	// filesystems such as btrfs and XFS, before falling back to a rename.
+	Reflink bool
 }
 
 func init() {
@@ -46,6 +56,7 @@ func (factory *filesystemDriverFactory) Create(parameters map[string]interface{}
 
 type driver struct {
 	rootDirectory string
+	reflink       bool
 }
 
 type baseEmbed struct {
@@ -56,12 +67,14 @@ type baseEmbed struct {
 // filesystem. All provided paths will be subpaths of the RootDirectory.
 type Driver struct {
 	baseEmbed
+	rootDirectory string
 }
 
 // FromParameters constructs a new Driver with a given parameters map
 // Optional Parameters:
 // - rootdirectory
 // - maxthreads
+// - reflink
 func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 	params, err := fromParametersImpl(parameters)
 	if err != nil || params == nil {
@@ -75,6 +88,7 @@ func fromParametersImpl(parameters map[string]interface{}) (*DriverParameters, e
 		err           error
 		maxThreads    = defaultMaxThreads
 		rootDirectory = defaultRootDirectory
+		reflink       bool
 	)
 
 	if parameters != nil {
@@ -86,18 +100,33 @@ func fromParametersImpl(parameters map[string]interface{}) (*DriverParameters, e
 		if err != nil {
 			return nil, fmt.Errorf("maxthreads config error: %s", err.Error())
 		}
+
+		switch v := parameters["reflink"].(type) {
+		case string:
+			reflink, err = strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("the reflink parameter should be a boolean")
+			}
+		case bool:
+			reflink = v
+		case nil:
+			// do nothing
+		default:
+			return nil, fmt.Errorf("the reflink parameter should be a boolean")
+		}
 	}
 
 	params := &DriverParameters{
 		RootDirectory: rootDirectory,
 		MaxThreads:    maxThreads,
+		Reflink:       reflink,
 	}
 	return params, nil
 }
 
 // New constructs a new Driver with a given rootDirectory
 func New(params DriverParameters) *Driver {
-	fsDriver := &driver{rootDirectory: params.RootDirectory}
+	fsDriver := &driver{rootDirectory: params.RootDirectory, reflink: params.Reflink}
 
 	return &Driver{
 		baseEmbed: baseEmbed{
@@ -105,6 +134,7 @@ func New(params DriverParameters) *Driver {
 				StorageDriver: base.NewRegulator(fsDriver, params.MaxThreads),
 			},
 		},
+		rootDirectory: params.RootDirectory,
 	}
 }
 
@@ -264,6 +294,15 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 	}
 
 	err := os.Rename(source, dest)
+
+	// A rename fails across mount points. Cloning lets the move succeed
+	// there when they belong to the same copy-on-write filesystem.
+	if d.reflink && errors.Is(err, syscall.EXDEV) {
+		if reflinkFile(source, dest) != nil {
+			return err
+		}
+		return os.Remove(source)
+	}
 	return err
 }
 
@@ -288,6 +327,13 @@ func (d *driver) URLFor(ctx context.Context, path string, options map[string]int
 	return "", storagedriver.ErrUnsupportedMethod{}
 }
 
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path.
+// May return an UnsupportedMethodErr in certain StorageDriver implementations.
+func (d *driver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return "", storagedriver.ErrUnsupportedMethod{}
+}
+
 // Walk traverses a filesystem defined within driver, starting
 // from the given path, calling f on each file and directory
 func (d *driver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
@@ -333,6 +379,8 @@ func (fi fileInfo) IsDir() bool {
 	return fi.FileInfo.IsDir()
 }
 
+var _ storagedriver.FileWriterSyncer = &fileWriter{}
+
 type fileWriter struct {
 	file      *os.File
 	size      int64
@@ -387,6 +435,19 @@ func (fw *fileWriter) Close() error {
 	return nil
 }
 
+// Sync flushes the buffered content to the file and syncs it to the disk.
+func (fw *fileWriter) Sync() error {
+	if fw.closed {
+		return fmt.Errorf("already closed")
+	}
+
+	if err := fw.bw.Flush(); err != nil {
+		return err
+	}
+
+	return fw.file.Sync()
+}
+
 func (fw *fileWriter) Cancel() error {
 	if fw.closed {
 		return fmt.Errorf("already closed")
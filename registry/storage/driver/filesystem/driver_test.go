@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"context"
 	"os"
 	"reflect"
 	"testing"
@@ -86,6 +87,35 @@ func TestFromParametersImpl(t *testing.T) {
 			},
 			pass: true,
 		},
+		{
+			params: map[string]interface{}{
+				"reflink": true,
+			},
+			expected: DriverParameters{
+				RootDirectory: defaultRootDirectory,
+				MaxThreads:    defaultMaxThreads,
+				Reflink:       true,
+			},
+			pass: true,
+		},
+		{
+			params: map[string]interface{}{
+				"reflink": "true",
+			},
+			expected: DriverParameters{
+				RootDirectory: defaultRootDirectory,
+				MaxThreads:    defaultMaxThreads,
+				Reflink:       true,
+			},
+			pass: true,
+		},
+		{
+			params: map[string]interface{}{
+				"reflink": "sometimes",
+			},
+			expected: DriverParameters{},
+			pass:     false,
+		},
 	}
 
 	for _, item := range tests {
@@ -108,3 +138,45 @@ func TestFromParametersImpl(t *testing.T) {
 		}
 	}
 }
+
+// TestMoveReflink checks that moves succeed with reflinks enabled, whether
+// or not the filesystem of the test supports them.
+func TestMoveReflink(t *testing.T) {
+	d, err := FromParameters(map[string]interface{}{
+		"rootdirectory": t.TempDir(),
+		"reflink":       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating filesystem driver: %v", err)
+	}
+
+	ctx := context.Background()
+	contents := []byte("contents")
+	if err := d.PutContent(ctx, "/source", contents); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.PutContent(ctx, "/dest/file", []byte("previous contents")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+
+	if err := d.Move(ctx, "/source", "/dest/file"); err != nil {
+		t.Fatalf("unexpected error moving file: %v", err)
+	}
+
+	received, err := d.GetContent(ctx, "/dest/file")
+	if err != nil {
+		t.Fatalf("unexpected error getting content: %v", err)
+	}
+	if string(received) != string(contents) {
+		t.Fatalf("unexpected content: %q != %q", received, contents)
+	}
+	if _, err := d.Stat(ctx, "/source"); err == nil {
+		t.Fatalf("expected the source to be removed")
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error statting the source: %v", err)
+	}
+
+	if err := d.Move(ctx, "/missing", "/dest/file"); err == nil {
+		t.Fatalf("expected an error moving a missing file")
+	}
+}
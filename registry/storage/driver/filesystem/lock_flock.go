@@ -0,0 +1,55 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"golang.org/x/sys/unix"
+)
+
+// lockPollInterval is how often a lock held by another process is tried.
+const lockPollInterval = 50 * time.Millisecond
+
+// Lock acquires the lock of key with an advisory flock of a file of the
+// locks directory, which excludes the other registry instances sharing the
+// root directory on the same host or, depending on the filesystem, across
+// hosts.
+func (d *Driver) Lock(ctx context.Context, key string) (func(), error) {
+	dir := filepath.Join(d.rootDirectory, lockDirectory)
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, storagedriver.LockName(key)), os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, unix.EWOULDBLOCK) {
+			f.Close()
+			return nil, err
+		}
+		select {
+		case <-time.After(lockPollInterval):
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() {
+		// Closing the file releases the lock.
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,55 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	d, err := FromParameters(map[string]interface{}{
+		"rootdirectory": t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating filesystem driver: %v", err)
+	}
+
+	ctx := context.Background()
+	unlock, err := d.Lock(ctx, "key")
+	if err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := d.Lock(timeoutCtx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected locking a held key to time out, got %v", err)
+	}
+
+	unlockOther, err := d.Lock(ctx, "other")
+	if err != nil {
+		t.Fatalf("unexpected error locking another key: %v", err)
+	}
+	unlockOther()
+
+	acquired := make(chan func())
+	go func() {
+		unlock, err := d.Lock(ctx, "key")
+		if err != nil {
+			t.Errorf("unexpected error locking: %v", err)
+			close(acquired)
+			return
+		}
+		acquired <- unlock
+	}()
+	unlock()
+	select {
+	case unlock := <-acquired:
+		if unlock != nil {
+			unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock to be acquired once released")
+	}
+}
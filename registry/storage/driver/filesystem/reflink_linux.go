@@ -0,0 +1,51 @@
+//go:build linux
+// +build linux
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile clones the regular file at source to dest with the FICLONE
+// ioctl, sharing its extents instead of copying its content. The clone is
+// made in a temporary file next to dest, which is then renamed to dest, so
+// that a failure never leaves a partial file at dest.
+func reflinkFile(source, dest string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", source)
+	}
+
+	tmp, err := os.CreateTemp(path.Dir(dest), "."+path.Base(dest)+".reflink-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := unix.IoctlFileClone(int(tmp.Fd()), int(src.Fd())); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
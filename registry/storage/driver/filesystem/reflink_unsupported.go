@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package filesystem
+
+import "errors"
+
+// reflinkFile is only supported on Linux, Move always falls back to a
+// rename elsewhere.
+func reflinkFile(source, dest string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
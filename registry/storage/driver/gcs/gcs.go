@@ -834,6 +834,12 @@ func (d *driver) URLFor(context context.Context, path string, options map[string
 	return storage.SignedURL(d.bucket, name, opts)
 }
 
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path until expiry has elapsed.
+func (d *driver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return d.URLFor(ctx, path, storagedriver.ExpiryOptions(options, expiry))
+}
+
 // Walk traverses a filesystem defined within driver, starting
 // from the given path, calling f on each file
 func (d *driver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
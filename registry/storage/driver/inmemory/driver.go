@@ -22,12 +22,21 @@ func init() {
 type inMemoryDriverFactory struct{}
 
 func (factory *inMemoryDriverFactory) Create(parameters map[string]interface{}) (storagedriver.StorageDriver, error) {
-	return New(), nil
+	var options []Option
+	if path, ok := parameters["wal"]; ok && path != nil && fmt.Sprint(path) != "" {
+		options = append(options, WithWAL(fmt.Sprint(path)))
+	}
+	return newDriver(options...)
 }
 
 type driver struct {
 	root  *dir
 	mutex sync.RWMutex
+	wal   *wal
+
+	// locks holds a channel per key locked by Lock, closed on unlock.
+	locks      map[string]chan struct{}
+	locksMutex sync.Mutex
 }
 
 // baseEmbed allows us to hide the Base embed.
@@ -41,23 +50,90 @@ type Driver struct {
 	baseEmbed // embedded, hidden base driver.
 }
 
-var _ storagedriver.StorageDriver = &Driver{}
+var _ storagedriver.LockableDriver = &Driver{}
+
+// Option configures a Driver.
+type Option func(*driver) error
+
+// WithWAL makes the driver record the operations modifying its content in a
+// write-ahead log at path, and replay the operations already in the log on
+// creation. The log lets a driver survive a restart of the process, so as to
+// test how the registry recovers from crashes in the middle of operations;
+// it is not meant for production use.
+func WithWAL(path string) Option {
+	return func(d *driver) error {
+		wal, err := openWAL(path, d.apply)
+		if err != nil {
+			return fmt.Errorf("failed to open the write-ahead log: %v", err)
+		}
+		d.wal = wal
+		return nil
+	}
+}
+
+// New constructs a new Driver. It panics if an option fails, such as when
+// the write-ahead log can't be replayed.
+func New(options ...Option) *Driver {
+	d, err := newDriver(options...)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func newDriver(options ...Option) (*Driver, error) {
+	d := &driver{
+		root: &dir{
+			common: common{
+				p:   "/",
+				mod: time.Now(),
+			},
+		},
+		locks: make(map[string]chan struct{}),
+	}
+	for _, option := range options {
+		if err := option(d); err != nil {
+			return nil, err
+		}
+	}
 
-// New constructs a new Driver.
-func New() *Driver {
 	return &Driver{
 		baseEmbed: baseEmbed{
 			Base: base.Base{
-				StorageDriver: &driver{
-					root: &dir{
-						common: common{
-							p:   "/",
-							mod: time.Now(),
-						},
-					},
-				},
+				StorageDriver: d,
 			},
 		},
+	}, nil
+}
+
+// Lock acquires the lock of key, which excludes the other users of the
+// driver.
+func (d *Driver) Lock(ctx context.Context, key string) (func(), error) {
+	dr := d.StorageDriver.(*driver)
+	for {
+		dr.locksMutex.Lock()
+		held, ok := dr.locks[key]
+		if !ok {
+			released := make(chan struct{})
+			dr.locks[key] = released
+			dr.locksMutex.Unlock()
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					dr.locksMutex.Lock()
+					defer dr.locksMutex.Unlock()
+					delete(dr.locks, key)
+					close(released)
+				})
+			}, nil
+		}
+		dr.locksMutex.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 }
 
@@ -98,7 +174,7 @@ func (d *driver) PutContent(ctx context.Context, p string, contents []byte) erro
 	f.truncate()
 	f.WriteAt(contents, 0)
 
-	return nil
+	return d.log(walRecord{Op: walPut, Path: normalized, Data: contents})
 }
 
 // Reader retrieves an io.ReadCloser for the content stored at "path" with a
@@ -144,6 +220,9 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 
 	if !append {
 		f.truncate()
+		if err := d.log(walRecord{Op: walPut, Path: normalized}); err != nil {
+			return nil, err
+		}
 	}
 
 	return d.newWriter(f), nil
@@ -213,6 +292,8 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 
 	err := d.root.move(normalizedSrc, normalizedDst)
 	switch err {
+	case nil:
+		return d.log(walRecord{Op: walMove, Path: normalizedSrc, Dest: normalizedDst})
 	case errNotExists:
 		return storagedriver.PathNotFoundError{Path: destPath}
 	default:
@@ -229,6 +310,8 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 
 	err := d.root.delete(normalized)
 	switch err {
+	case nil:
+		return d.log(walRecord{Op: walDelete, Path: normalized})
 	case errNotExists:
 		return storagedriver.PathNotFoundError{Path: path}
 	default:
@@ -242,6 +325,13 @@ func (d *driver) URLFor(ctx context.Context, path string, options map[string]int
 	return "", storagedriver.ErrUnsupportedMethod{}
 }
 
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path.
+// May return an UnsupportedMethodErr in certain StorageDriver implementations.
+func (d *driver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return "", storagedriver.ErrUnsupportedMethod{}
+}
+
 // Walk traverses a filesystem defined within driver, starting
 // from the given path, calling f on each file and directory
 func (d *driver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
@@ -275,7 +365,11 @@ func (w *writer) Write(p []byte) (int, error) {
 	w.d.mutex.Lock()
 	defer w.d.mutex.Unlock()
 
-	return w.f.WriteAt(p, int64(len(w.f.data)))
+	n, err := w.f.WriteAt(p, int64(len(w.f.data)))
+	if err != nil {
+		return n, err
+	}
+	return n, w.d.log(walRecord{Op: walAppend, Path: w.f.path(), Data: p[:n]})
 }
 
 func (w *writer) Size() int64 {
@@ -304,7 +398,10 @@ func (w *writer) Cancel() error {
 	w.d.mutex.Lock()
 	defer w.d.mutex.Unlock()
 
-	return w.d.root.delete(w.f.path())
+	if err := w.d.root.delete(w.f.path()); err != nil {
+		return err
+	}
+	return w.d.log(walRecord{Op: walDelete, Path: w.f.path()})
 }
 
 func (w *writer) Commit() error {
@@ -0,0 +1,228 @@
+package inmemory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// walOp is the kind of operation recorded by a write-ahead log record.
+type walOp string
+
+const (
+	// walPut replaces the content of a file.
+	walPut walOp = "put"
+	// walAppend appends to the content of a file, as written by a writer.
+	walAppend walOp = "append"
+	// walDelete deletes a file or directory.
+	walDelete walOp = "delete"
+	// walMove moves a file or directory.
+	walMove walOp = "move"
+)
+
+// walRecord is an operation of the write-ahead log, stored as a line of JSON.
+type walRecord struct {
+	Op   walOp  `json:"op"`
+	Path string `json:"path"`
+	Dest string `json:"dest,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// wal is a write-ahead log recording the operations modifying the content
+// of a driver, so that a driver created on the same log later finds the
+// content back.
+//
+// Records are written through to the file without being synced, which
+// survives a crash of the process but not of the host. A record torn by a
+// crash in the middle of its write is dropped on replay.
+type wal struct {
+	path string
+	file *os.File
+}
+
+// openWAL opens the write-ahead log at path, creating it if needed, and
+// replays its records with apply.
+func openWAL(path string, apply func(walRecord) error) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+
+	var offset int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything after the last newline is a torn record.
+			break
+		} else if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			break
+		}
+		if err := apply(record); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("replaying %s of %s from %s: %v", record.Op, record.Path, path, err)
+		}
+		offset += int64(len(line))
+	}
+
+	// Drop the records which couldn't be replayed, so that the new ones
+	// follow the last valid record.
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &wal{path: path, file: file}, nil
+}
+
+// append writes record at the end of the log.
+func (w *wal) append(record walRecord) error {
+	p, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.file.Write(append(p, '\n'))
+	return err
+}
+
+// rewrite replaces the log with the given records. The records are written
+// to a new file which then atomically replaces the log.
+func (w *wal) rewrite(records []walRecord) error {
+	var buf bytes.Buffer
+	for _, record := range records {
+		p, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(p)
+		buf.WriteByte('\n')
+	}
+
+	tmp := w.path + ".compact"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	w.file.Close()
+	w.file = file
+	return nil
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
+
+// apply applies a record replayed from the write-ahead log to the content
+// of the driver.
+func (d *driver) apply(record walRecord) error {
+	switch record.Op {
+	case walPut, walAppend:
+		f, err := d.root.mkfile(record.Path)
+		if err != nil {
+			return err
+		}
+		if record.Op == walPut {
+			f.truncate()
+		}
+		f.WriteAt(record.Data, int64(len(f.data)))
+		return nil
+	case walDelete:
+		return d.root.delete(record.Path)
+	case walMove:
+		return d.root.move(record.Path, record.Dest)
+	default:
+		return fmt.Errorf("unknown operation %q", record.Op)
+	}
+}
+
+// log records an operation in the write-ahead log of the driver, if any.
+// The caller must hold the write lock of the driver.
+func (d *driver) log(record walRecord) error {
+	if d.wal == nil {
+		return nil
+	}
+	return d.wal.append(record)
+}
+
+// snapshot returns the records putting the content of all the files of the
+// driver, sorted by path.
+func (d *driver) snapshot() []walRecord {
+	var records []walRecord
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *dir:
+			for _, child := range n.children {
+				walk(child)
+			}
+		case *file:
+			records = append(records, walRecord{
+				Op:   walPut,
+				Path: n.path(),
+				Data: n.data,
+			})
+		}
+	}
+	walk(d.root)
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Path < records[j].Path
+	})
+	return records
+}
+
+// Compact rewrites the write-ahead log of the driver to the minimal set of
+// records restoring its current content.
+func (d *Driver) Compact() error {
+	dr := d.StorageDriver.(*driver)
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+
+	if dr.wal == nil {
+		return fmt.Errorf("the %s driver has no write-ahead log", driverName)
+	}
+	return dr.wal.rewrite(dr.snapshot())
+}
+
+// Close closes the write-ahead log of the driver, if any. The driver must
+// not be used afterwards.
+func (d *Driver) Close() error {
+	dr := d.StorageDriver.(*driver)
+	dr.mutex.Lock()
+	defer dr.mutex.Unlock()
+
+	if dr.wal == nil {
+		return nil
+	}
+	return dr.wal.close()
+}
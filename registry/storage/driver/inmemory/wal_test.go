@@ -0,0 +1,199 @@
+package inmemory
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+)
+
+func checkContent(t *testing.T, d storagedriver.StorageDriver, path, expected string) {
+	t.Helper()
+	content, err := d.GetContent(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error getting %s: %v", path, err)
+	}
+	if string(content) != expected {
+		t.Fatalf("unexpected content of %s: %q != %q", path, content, expected)
+	}
+}
+
+func checkNotFound(t *testing.T, d storagedriver.StorageDriver, path string) {
+	t.Helper()
+	_, err := d.Stat(context.Background(), path)
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("expected %s not to be found, got %v", path, err)
+	}
+}
+
+// populate runs operations of all kinds on d.
+func populate(t *testing.T, d storagedriver.StorageDriver) {
+	t.Helper()
+	ctx := context.Background()
+	if err := d.PutContent(ctx, "/a/file", []byte("first")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.PutContent(ctx, "/a/file", []byte("second")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.PutContent(ctx, "/b/deleted", []byte("deleted")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.Delete(ctx, "/b"); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	if err := d.PutContent(ctx, "/c/moved", []byte("moved")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.Move(ctx, "/c/moved", "/d/moved"); err != nil {
+		t.Fatalf("unexpected error moving: %v", err)
+	}
+
+	fw, err := d.Writer(ctx, "/e/written", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	for _, p := range []string{"written ", "in ", "parts"} {
+		if _, err := fw.Write([]byte(p)); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+	}
+	if err := fw.Commit(); err != nil {
+		t.Fatalf("unexpected error committing: %v", err)
+	}
+
+	fw, err = d.Writer(ctx, "/f/cancelled", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	if _, err := fw.Write([]byte("cancelled")); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if err := fw.Cancel(); err != nil {
+		t.Fatalf("unexpected error cancelling: %v", err)
+	}
+}
+
+// checkPopulated checks the content left by populate.
+func checkPopulated(t *testing.T, d storagedriver.StorageDriver) {
+	t.Helper()
+	checkContent(t, d, "/a/file", "second")
+	checkNotFound(t, d, "/b/deleted")
+	checkNotFound(t, d, "/c/moved")
+	checkContent(t, d, "/d/moved", "moved")
+	checkContent(t, d, "/e/written", "written in parts")
+	checkNotFound(t, d, "/f/cancelled")
+}
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+
+	d := New(WithWAL(path))
+	populate(t, d)
+	checkPopulated(t, d)
+	if err := d.Close(); err != nil {
+		t.Fatalf("unexpected error closing driver: %v", err)
+	}
+
+	d = New(WithWAL(path))
+	defer d.Close()
+	checkPopulated(t, d)
+}
+
+func TestWALTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+
+	d := New(WithWAL(path))
+	if err := d.PutContent(context.Background(), "/file", []byte("content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	d.Close()
+
+	// Simulate a crash in the middle of the write of a record.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening log: %v", err)
+	}
+	if _, err := f.Write([]byte(`{"op":"put","path":"/torn","da`)); err != nil {
+		t.Fatalf("unexpected error writing log: %v", err)
+	}
+	f.Close()
+
+	d = New(WithWAL(path))
+	checkContent(t, d, "/file", "content")
+	checkNotFound(t, d, "/torn")
+	if err := d.PutContent(context.Background(), "/after", []byte("after")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	d.Close()
+
+	d = New(WithWAL(path))
+	defer d.Close()
+	checkContent(t, d, "/file", "content")
+	checkContent(t, d, "/after", "after")
+}
+
+func TestWALCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+
+	d := New(WithWAL(path))
+	populate(t, d)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error reading log: %v", err)
+	}
+	if err := d.Compact(); err != nil {
+		t.Fatalf("unexpected error compacting: %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error reading log: %v", err)
+	}
+	if len(after) >= len(before) {
+		t.Fatalf("expected compaction to shrink the log from %d bytes, got %d bytes", len(before), len(after))
+	}
+	if lines := bytes.Count(after, []byte("\n")); lines != 3 {
+		t.Fatalf("expected a record per file, got %d records", lines)
+	}
+
+	// The log keeps recording operations after compaction.
+	if err := d.PutContent(context.Background(), "/a/file", []byte("third")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	d.Close()
+
+	d = New(WithWAL(path))
+	defer d.Close()
+	checkContent(t, d, "/a/file", "third")
+	checkContent(t, d, "/d/moved", "moved")
+	checkContent(t, d, "/e/written", "written in parts")
+
+	if err := New().Compact(); err == nil {
+		t.Fatal("expected an error compacting a driver without write-ahead log")
+	}
+}
+
+func TestWALFactory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+
+	d, err := factory.Create(driverName, map[string]interface{}{"wal": path})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if err := d.PutContent(context.Background(), "/file", []byte("content")); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	d.(*Driver).Close()
+
+	d = New(WithWAL(path))
+	defer d.(*Driver).Close()
+	checkContent(t, d, "/file", "content")
+
+	if _, err := factory.Create(driverName, map[string]interface{}{"wal": t.TempDir()}); err == nil {
+		t.Fatal("expected an error creating a driver with a directory as write-ahead log")
+	}
+}
@@ -0,0 +1,46 @@
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// LockableDriver is implemented by the storage drivers able to lock keys
+// across all the registry instances sharing their storage, so that the
+// instances coordinate their updates of the same files.
+type LockableDriver interface {
+	StorageDriver
+
+	// Lock blocks until it acquires the lock of key, or ctx is done. The
+	// returned function releases the lock.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// NoopLockableDriver adapts a StorageDriver unable to lock into a
+// LockableDriver, whose locks are always acquired at once and exclude
+// nothing.
+type NoopLockableDriver struct {
+	StorageDriver
+}
+
+// Lock returns at once.
+func (NoopLockableDriver) Lock(ctx context.Context, key string) (func(), error) {
+	return func() {}, nil
+}
+
+// AsLockable returns driver as a LockableDriver, adapting it with
+// NoopLockableDriver if it can't lock.
+func AsLockable(driver StorageDriver) LockableDriver {
+	if lockable, ok := driver.(LockableDriver); ok {
+		return lockable
+	}
+	return NoopLockableDriver{StorageDriver: driver}
+}
+
+// LockName returns the name of the file or object a driver locks key with,
+// which is valid in any path whatever the key.
+func LockName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
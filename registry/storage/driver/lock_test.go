@@ -0,0 +1,43 @@
+package driver
+
+import (
+	"context"
+	"testing"
+)
+
+type lockableDriver struct {
+	StorageDriver
+	locked []string
+}
+
+func (d *lockableDriver) Lock(ctx context.Context, key string) (func(), error) {
+	d.locked = append(d.locked, key)
+	return func() {}, nil
+}
+
+func TestAsLockable(t *testing.T) {
+	lockable := &lockableDriver{}
+	if AsLockable(lockable) != LockableDriver(lockable) {
+		t.Fatal("expected a lockable driver to be returned as is")
+	}
+
+	noop := AsLockable(nil)
+	if _, ok := noop.(NoopLockableDriver); !ok {
+		t.Fatalf("expected a driver unable to lock to be adapted, got %T", noop)
+	}
+	unlock, err := noop.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+	unlock()
+}
+
+func TestLockName(t *testing.T) {
+	name := LockName("/docker/registry/v2/repositories/a/b/_manifests/tags/latest")
+	if !PathRegexp.MatchString("/" + name) {
+		t.Fatalf("expected the lock name %q to be a valid path component", name)
+	}
+	if name == LockName("/docker/registry/v2/repositories/a/b/_manifests/tags/other") {
+		t.Fatal("expected different keys to have different lock names")
+	}
+}
@@ -24,7 +24,7 @@ type aliCDNStorageMiddleware struct {
 	duration  time.Duration
 }
 
-var _ storagedriver.StorageDriver = &aliCDNStorageMiddleware{}
+var _ storagedriver.LockableDriver = &aliCDNStorageMiddleware{}
 
 // newAliCDNStorageMiddleware constructs and returns a new AliCDN
 // StorageDriver implementation.
@@ -102,7 +102,22 @@ func (ac *aliCDNStorageMiddleware) URLFor(ctx context.Context, path string, opti
 		dcontext.GetLogger(ctx).Warn("the AliCDN middleware does not support this backend storage driver")
 		return ac.StorageDriver.URLFor(ctx, path, options)
 	}
-	acURL, err := ac.urlSigner.Sign(ac.baseURL+path, time.Now().Add(ac.duration))
+	return ac.sign(path, ac.duration)
+}
+
+// URLForWithExpiry attempts to find a url which may be used to retrieve the
+// file at the given path until expiry has elapsed.
+func (ac *aliCDNStorageMiddleware) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	if ac.StorageDriver.Name() != "oss" {
+		dcontext.GetLogger(ctx).Warn("the AliCDN middleware does not support this backend storage driver")
+		return ac.StorageDriver.URLForWithExpiry(ctx, path, expiry, options)
+	}
+	return ac.sign(path, expiry)
+}
+
+// sign returns the signed CDN url of path, valid for duration.
+func (ac *aliCDNStorageMiddleware) sign(path string, duration time.Duration) (string, error) {
+	acURL, err := ac.urlSigner.Sign(ac.baseURL+path, time.Now().Add(duration))
 	if err != nil {
 		return "", err
 	}
@@ -110,6 +125,11 @@ func (ac *aliCDNStorageMiddleware) URLFor(ctx context.Context, path string, opti
 }
 
 // init registers the alicdn layerHandler backend.
+// Lock acquires the lock of key with the wrapped driver, if it can lock.
+func (ac *aliCDNStorageMiddleware) Lock(ctx context.Context, key string) (func(), error) {
+	return storagedriver.AsLockable(ac.StorageDriver).Lock(ctx, key)
+}
+
 func init() {
 	storagemiddleware.Register("alicdn", newAliCDNStorageMiddleware)
 }
@@ -0,0 +1,173 @@
+// Package middleware - cdn wrapper for storage drivers which redirects blob
+// downloads to a content delivery network using provider specific signed URLs.
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+	dcontext "github.com/distribution/distribution/v3/context"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+const (
+	// ProviderCloudFront signs URLs with the CloudFront canned policy, using
+	// RSA-SHA1.
+	ProviderCloudFront = "cloudfront"
+
+	// ProviderFastly signs URLs with a Fastly token, using HMAC-SHA256.
+	ProviderFastly = "fastly"
+
+	defaultDuration = 20 * time.Minute
+)
+
+// CDNConfig configures the CDN redirector.
+type CDNConfig struct {
+	// Provider is the CDN provider, one of "cloudfront" or "fastly".
+	Provider string
+
+	// BaseURL is the URL of the CDN distribution fronting the storage
+	// backend.
+	BaseURL string
+
+	// SigningKey is the key used to sign URLs. For CloudFront, it is a PEM
+	// encoded RSA private key. For Fastly, it is the shared token secret.
+	SigningKey string
+
+	// KeyPairID is the CloudFront key pair identifier. It is ignored for
+	// other providers.
+	KeyPairID string
+
+	// Duration is the lifetime of generated URLs. It defaults to 20 minutes.
+	Duration time.Duration
+}
+
+// urlSigner produces a signed URL for the CDN resource rawURL, expiring at
+// expires.
+type urlSigner interface {
+	Sign(rawURL string, expires time.Time) (string, error)
+}
+
+// cdnStorageMiddleware redirects blob downloads to a CDN. When a signed URL
+// cannot be generated, it reports the method as unsupported so that the blob
+// server falls back to serving the content directly.
+type cdnStorageMiddleware struct {
+	storagedriver.StorageDriver
+	signer   urlSigner
+	baseURL  string
+	duration time.Duration
+}
+
+var _ storagedriver.LockableDriver = &cdnStorageMiddleware{}
+
+// NewCDNRedirector wraps driver so that URLFor returns signed URLs pointing
+// at the configured CDN.
+func NewCDNRedirector(config CDNConfig, driver storagedriver.StorageDriver) (storagedriver.StorageDriver, error) {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		return nil, fmt.Errorf("no baseurl provided")
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid baseurl: %v", err)
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	if config.SigningKey == "" {
+		return nil, fmt.Errorf("no signingkey provided")
+	}
+
+	var signer urlSigner
+	switch strings.ToLower(config.Provider) {
+	case ProviderCloudFront:
+		if config.KeyPairID == "" {
+			return nil, fmt.Errorf("no keypairid provided")
+		}
+		privateKey, err := sign.LoadPEMPrivKey(strings.NewReader(config.SigningKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cloudfront signingkey: %v", err)
+		}
+		signer = newCloudFrontSigner(config.KeyPairID, privateKey)
+	case ProviderFastly:
+		signer = &fastlySigner{key: []byte(config.SigningKey)}
+	default:
+		return nil, fmt.Errorf("unsupported cdn provider %q, must be one of %s|%s", config.Provider, ProviderCloudFront, ProviderFastly)
+	}
+
+	duration := config.Duration
+	if duration <= 0 {
+		duration = defaultDuration
+	}
+
+	return &cdnStorageMiddleware{
+		StorageDriver: driver,
+		signer:        signer,
+		baseURL:       baseURL,
+		duration:      duration,
+	}, nil
+}
+
+// URLFor returns a signed CDN URL for path. Only GET and HEAD requests are
+// redirected.
+func (cm *cdnStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return cm.URLForWithExpiry(ctx, path, cm.duration, options)
+}
+
+// URLForWithExpiry returns a signed CDN URL for path, valid until expiry has
+// elapsed. Only GET and HEAD requests are redirected.
+func (cm *cdnStorageMiddleware) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	if method, ok := options["method"].(string); ok && method != http.MethodGet && method != http.MethodHead {
+		return "", storagedriver.ErrUnsupportedMethod{}
+	}
+
+	signedURL, err := cm.signer.Sign(cm.baseURL+"/"+strings.TrimPrefix(path, "/"), time.Now().Add(expiry))
+	if err != nil {
+		dcontext.GetLogger(ctx).Warnf("failed to sign cdn url, serving content directly: %v", err)
+		return "", storagedriver.ErrUnsupportedMethod{}
+	}
+	return signedURL, nil
+}
+
+func newCloudFrontSigner(keyPairID string, privateKey *rsa.PrivateKey) urlSigner {
+	return sign.NewURLSigner(keyPairID, privateKey)
+}
+
+// fastlySigner generates Fastly token authenticated URLs. The token has the
+// form "<expiration>_<signature>", where signature is the hex encoded
+// HMAC-SHA256 of the URL path concatenated with the expiration.
+type fastlySigner struct {
+	key []byte
+}
+
+func (fs *fastlySigner) Sign(rawURL string, expires time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	expiration := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, fs.key)
+	mac.Write([]byte(u.EscapedPath() + expiration))
+
+	q := u.Query()
+	q.Set("token", expiration+"_"+hex.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Lock acquires the lock of key with the wrapped driver, if it can lock.
+func (cm *cdnStorageMiddleware) Lock(ctx context.Context, key string) (func(), error) {
+	return storagedriver.AsLockable(cm.StorageDriver).Lock(ctx, key)
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func generatePEMKey(t *testing.T) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+func TestCloudFrontURL(t *testing.T) {
+	driver, err := NewCDNRedirector(CDNConfig{
+		Provider:   ProviderCloudFront,
+		BaseURL:    "cdn.example.com/",
+		SigningKey: generatePEMKey(t),
+		KeyPairID:  "APKAEXAMPLE",
+		Duration:   10 * time.Minute,
+	}, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	signed, err := driver.URLFor(context.Background(), "/docker/registry/v2/blobs/sha256/ab/abcd/data", map[string]interface{}{"method": http.MethodGet})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "https" || u.Host != "cdn.example.com" || u.Path != "/docker/registry/v2/blobs/sha256/ab/abcd/data" {
+		t.Fatalf("unexpected url: %s", signed)
+	}
+
+	q := u.Query()
+	if q.Get("Key-Pair-Id") != "APKAEXAMPLE" {
+		t.Fatalf("unexpected key pair id: %q", q.Get("Key-Pair-Id"))
+	}
+	if q.Get("Signature") == "" {
+		t.Fatal("expected a signature")
+	}
+	expires, err := strconv.ParseInt(q.Get("Expires"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := before.Add(10 * time.Minute).Unix()
+	if expires < expected || expires > expected+1 {
+		t.Fatalf("unexpected expiry: %d, expected %d", expires, expected)
+	}
+}
+
+func TestFastlyURL(t *testing.T) {
+	key := "fastly-secret"
+	driver, err := NewCDNRedirector(CDNConfig{
+		Provider:   ProviderFastly,
+		BaseURL:    "https://cdn.example.com",
+		SigningKey: key,
+	}, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	signed, err := driver.URLFor(context.Background(), "/docker/registry/v2/blobs/sha256/ab/abcd/data", map[string]interface{}{"method": http.MethodHead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "cdn.example.com" || u.Path != "/docker/registry/v2/blobs/sha256/ab/abcd/data" {
+		t.Fatalf("unexpected url: %s", signed)
+	}
+
+	expiration, signature, ok := strings.Cut(u.Query().Get("token"), "_")
+	if !ok {
+		t.Fatalf("malformed token in %s", signed)
+	}
+	expires, err := strconv.ParseInt(expiration, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := before.Add(defaultDuration).Unix()
+	if expires < expected || expires > expected+1 {
+		t.Fatalf("unexpected expiry: %d, expected %d", expires, expected)
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(u.Path + expiration))
+	if hex.EncodeToString(mac.Sum(nil)) != signature {
+		t.Fatalf("unexpected signature in %s", signed)
+	}
+}
+
+type failingSigner struct{}
+
+func (failingSigner) Sign(string, time.Time) (string, error) {
+	return "", errors.New("key rotated")
+}
+
+func TestFallbackToDirectServing(t *testing.T) {
+	driver := &cdnStorageMiddleware{
+		StorageDriver: inmemory.New(),
+		signer:        failingSigner{},
+		baseURL:       "https://cdn.example.com",
+		duration:      defaultDuration,
+	}
+
+	_, err := driver.URLFor(context.Background(), "/data", map[string]interface{}{"method": http.MethodGet})
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); !ok {
+		t.Fatalf("expected ErrUnsupportedMethod, got %v", err)
+	}
+
+	driver.signer = &fastlySigner{key: []byte("secret")}
+	_, err = driver.URLFor(context.Background(), "/data", map[string]interface{}{"method": http.MethodPut})
+	if _, ok := err.(storagedriver.ErrUnsupportedMethod); !ok {
+		t.Fatalf("expected ErrUnsupportedMethod for PUT, got %v", err)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, config := range []CDNConfig{
+		{Provider: ProviderFastly, SigningKey: "secret"},
+		{Provider: ProviderFastly, BaseURL: "https://cdn.example.com"},
+		{Provider: "akamai", BaseURL: "https://cdn.example.com", SigningKey: "secret"},
+		{Provider: ProviderCloudFront, BaseURL: "https://cdn.example.com", SigningKey: "not a key", KeyPairID: "id"},
+		{Provider: ProviderCloudFront, BaseURL: "https://cdn.example.com", SigningKey: "not a key"},
+	} {
+		if _, err := NewCDNRedirector(config, inmemory.New()); err == nil {
+			t.Errorf("expected error for config %+v", config)
+		}
+	}
+}
@@ -29,7 +29,7 @@ type cloudFrontStorageMiddleware struct {
 	duration  time.Duration
 }
 
-var _ storagedriver.StorageDriver = &cloudFrontStorageMiddleware{}
+var _ storagedriver.LockableDriver = &cloudFrontStorageMiddleware{}
 
 // newCloudFrontLayerHandler constructs and returns a new CloudFront
 // LayerHandler implementation.
@@ -198,19 +198,33 @@ type S3BucketKeyer interface {
 // URLFor attempts to find a url which may be used to retrieve the file at the given path.
 // Returns an error if the file cannot be found.
 func (lh *cloudFrontStorageMiddleware) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return lh.urlFor(ctx, path, lh.duration, options, lh.StorageDriver.URLFor)
+}
+
+// URLForWithExpiry attempts to find a url which may be used to retrieve the
+// file at the given path until expiry has elapsed.
+func (lh *cloudFrontStorageMiddleware) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return lh.urlFor(ctx, path, expiry, options, func(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+		return lh.StorageDriver.URLForWithExpiry(ctx, path, expiry, options)
+	})
+}
+
+// urlFor signs a cloudfront url valid for duration, or falls back to
+// driverURLFor for requests which cannot be served by cloudfront.
+func (lh *cloudFrontStorageMiddleware) urlFor(ctx context.Context, path string, duration time.Duration, options map[string]interface{}, driverURLFor func(context.Context, string, map[string]interface{}) (string, error)) (string, error) {
 	// TODO(endophage): currently only supports S3
 	keyer, ok := lh.StorageDriver.(S3BucketKeyer)
 	if !ok {
 		dcontext.GetLogger(ctx).Warn("the CloudFront middleware does not support this backend storage driver")
-		return lh.StorageDriver.URLFor(ctx, path, options)
+		return driverURLFor(ctx, path, options)
 	}
 
 	if eligibleForS3(ctx, lh.awsIPs) {
-		return lh.StorageDriver.URLFor(ctx, path, options)
+		return driverURLFor(ctx, path, options)
 	}
 
 	// Get signed cloudfront url.
-	cfURL, err := lh.urlSigner.Sign(lh.baseURL+keyer.S3BucketKey(path), time.Now().Add(lh.duration))
+	cfURL, err := lh.urlSigner.Sign(lh.baseURL+keyer.S3BucketKey(path), time.Now().Add(duration))
 	if err != nil {
 		return "", err
 	}
@@ -218,6 +232,11 @@ func (lh *cloudFrontStorageMiddleware) URLFor(ctx context.Context, path string,
 }
 
 // init registers the cloudfront layerHandler backend.
+// Lock acquires the lock of key with the wrapped driver, if it can lock.
+func (lh *cloudFrontStorageMiddleware) Lock(ctx context.Context, key string) (func(), error) {
+	return storagedriver.AsLockable(lh.StorageDriver).Lock(ctx, key)
+}
+
 func init() {
 	storagemiddleware.Register("cloudfront", newCloudFrontStorageMiddleware)
 }
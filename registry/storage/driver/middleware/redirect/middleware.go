@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	storagemiddleware "github.com/distribution/distribution/v3/registry/storage/driver/middleware"
@@ -15,7 +16,7 @@ type redirectStorageMiddleware struct {
 	host   string
 }
 
-var _ storagedriver.StorageDriver = &redirectStorageMiddleware{}
+var _ storagedriver.LockableDriver = &redirectStorageMiddleware{}
 
 func newRedirectStorageMiddleware(sd storagedriver.StorageDriver, options map[string]interface{}) (storagedriver.StorageDriver, error) {
 	o, ok := options["baseurl"]
@@ -45,6 +46,16 @@ func (r *redirectStorageMiddleware) URLFor(ctx context.Context, path string, opt
 	return u.String(), nil
 }
 
+// URLForWithExpiry returns the same URL as URLFor, which does not expire.
+func (r *redirectStorageMiddleware) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return r.URLFor(ctx, path, options)
+}
+
+// Lock acquires the lock of key with the wrapped driver, if it can lock.
+func (r *redirectStorageMiddleware) Lock(ctx context.Context, key string) (func(), error) {
+	return storagedriver.AsLockable(r.StorageDriver).Lock(ctx, key)
+}
+
 func init() {
 	storagemiddleware.Register("redirect", newRedirectStorageMiddleware)
 }
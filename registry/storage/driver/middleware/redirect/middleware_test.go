@@ -3,7 +3,10 @@ package middleware
 import (
 	"context"
 	"testing"
+	"time"
 
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
 	check "gopkg.in/check.v1"
 )
 
@@ -57,3 +60,21 @@ func (s *MiddlewareSuite) TestHTTP(c *check.C) {
 	c.Assert(err, check.Equals, nil)
 	c.Assert(url, check.Equals, "http://example.com/morty/data")
 }
+
+func (s *MiddlewareSuite) TestLock(c *check.C) {
+	options := make(map[string]interface{})
+	options["baseurl"] = "https://example.com/"
+	middleware, err := newRedirectStorageMiddleware(inmemory.New(), options)
+	c.Assert(err, check.Equals, nil)
+
+	locker, ok := middleware.(storagedriver.LockableDriver)
+	c.Assert(ok, check.Equals, true)
+	unlock, err := locker.Lock(context.Background(), "key")
+	c.Assert(err, check.Equals, nil)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(ctx, "key")
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+}
@@ -1,3 +1,3 @@
-// Package oss implements the Aliyun OSS Storage driver backend. Support can be
+// Package oss implements the Alibaba Cloud OSS storage driver backend. Support can be
 // enabled by including the "include_oss" build tag.
 package oss
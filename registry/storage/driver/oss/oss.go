@@ -1,8 +1,8 @@
 // Package oss provides a storagedriver.StorageDriver implementation to
-// store blobs in Aliyun OSS cloud storage.
+// store blobs in Alibaba Cloud OSS cloud storage.
 //
-// This package leverages the denverdino/aliyungo client library for interfacing with
-// oss.
+// This package leverages the aliyun/aliyun-oss-go-sdk client library for
+// interfacing with oss.
 //
 // Because OSS is a key, value store the Stat call does not support last modification
 // time for directories (directories are an abstraction for key, value stores)
@@ -15,19 +15,20 @@ package oss
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/denverdino/aliyungo/oss"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/base"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
-	"github.com/sirupsen/logrus"
 )
 
 const driverName = "oss"
@@ -36,26 +37,31 @@ const driverName = "oss"
 // OSS API requires multipart upload chunks to be at least 5MB
 const minChunkSize = 5 << 20
 
-const (
-	defaultChunkSize = 2 * minChunkSize
-	defaultTimeout   = 2 * time.Minute // 2 minute timeout per chunk
-)
+const defaultChunkSize = 2 * minChunkSize
 
 // listMax is the largest amount of objects you can request from OSS in a list call
 const listMax = 1000
 
+// maxCopySize is the largest object OSS copies with a single CopyObject
+// call, larger objects are copied part by part.
+const maxCopySize = 1 << 30
+
+// maxConcurrency is the number of parts of a large object copied in parallel.
+const maxConcurrency = 10
+
 // DriverParameters A struct that encapsulates all of the driver parameters after all values have been set
 type DriverParameters struct {
 	AccessKeyID     string
 	AccessKeySecret string
 	Bucket          string
-	Region          oss.Region
+	Region          string
 	Internal        bool
 	Encrypt         bool
 	Secure          bool
 	ChunkSize       int64
 	RootDirectory   string
 	Endpoint        string
+	Cname           bool
 	EncryptionKeyID string
 }
 
@@ -83,22 +89,19 @@ type baseEmbed struct {
 	base.Base
 }
 
-// Driver is a storagedriver.StorageDriver implementation backed by Aliyun OSS
-// Objects are stored at absolute keys in the provided bucket.
+// Driver is a storagedriver.StorageDriver implementation backed by Alibaba
+// Cloud OSS. Objects are stored at absolute keys in the provided bucket.
 type Driver struct {
 	baseEmbed
 }
 
 // FromParameters constructs a new Driver with a given parameters map
 // Required parameters:
-// - accesskey
-// - secretkey
-// - region
+// - accesskeyid
+// - accesskeysecret
 // - bucket
-// - encrypt
+// - endpoint or region
 func FromParameters(parameters map[string]interface{}) (*Driver, error) {
-	// Providing no values for these is valid in case the user is authenticating
-
 	accessKey, ok := parameters["accesskeyid"]
 	if !ok {
 		return nil, fmt.Errorf("No accesskeyid parameter provided")
@@ -108,16 +111,24 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		return nil, fmt.Errorf("No accesskeysecret parameter provided")
 	}
 
-	regionName, ok := parameters["region"]
-	if !ok || fmt.Sprint(regionName) == "" {
-		return nil, fmt.Errorf("No region parameter provided")
-	}
-
 	bucket, ok := parameters["bucket"]
 	if !ok || fmt.Sprint(bucket) == "" {
 		return nil, fmt.Errorf("No bucket parameter provided")
 	}
 
+	endpoint, ok := parameters["endpoint"]
+	if !ok || endpoint == nil {
+		endpoint = ""
+	}
+
+	regionName, ok := parameters["region"]
+	if !ok || regionName == nil {
+		regionName = ""
+	}
+	if fmt.Sprint(endpoint) == "" && fmt.Sprint(regionName) == "" {
+		return nil, fmt.Errorf("No endpoint or region parameter provided")
+	}
+
 	internalBool := false
 	internal, ok := parameters["internal"]
 	if ok {
@@ -127,6 +138,15 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		}
 	}
 
+	cnameBool := false
+	cname, ok := parameters["cname"]
+	if ok {
+		cnameBool, ok = cname.(bool)
+		if !ok {
+			return nil, fmt.Errorf("The cname parameter should be a boolean")
+		}
+	}
+
 	encryptBool := false
 	encrypt, ok := parameters["encrypt"]
 	if ok {
@@ -137,7 +157,7 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 	}
 
 	encryptionKeyID, ok := parameters["encryptionkeyid"]
-	if !ok {
+	if !ok || encryptionKeyID == nil {
 		encryptionKeyID = ""
 	}
 
@@ -165,7 +185,7 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		case int, uint, int32, uint32, uint64:
 			chunkSize = reflect.ValueOf(v).Convert(reflect.TypeOf(chunkSize)).Int()
 		default:
-			return nil, fmt.Errorf("invalid valud for chunksize: %#v", chunkSizeParam)
+			return nil, fmt.Errorf("invalid value for chunksize: %#v", chunkSizeParam)
 		}
 
 		if chunkSize < minChunkSize {
@@ -174,49 +194,46 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 	}
 
 	rootDirectory, ok := parameters["rootdirectory"]
-	if !ok {
+	if !ok || rootDirectory == nil {
 		rootDirectory = ""
 	}
 
-	endpoint, ok := parameters["endpoint"]
-	if !ok {
-		endpoint = ""
-	}
-
 	params := DriverParameters{
 		AccessKeyID:     fmt.Sprint(accessKey),
 		AccessKeySecret: fmt.Sprint(secretKey),
 		Bucket:          fmt.Sprint(bucket),
-		Region:          oss.Region(fmt.Sprint(regionName)),
+		Region:          fmt.Sprint(regionName),
 		ChunkSize:       chunkSize,
 		RootDirectory:   fmt.Sprint(rootDirectory),
 		Encrypt:         encryptBool,
 		Secure:          secureBool,
 		Internal:        internalBool,
 		Endpoint:        fmt.Sprint(endpoint),
+		Cname:           cnameBool,
 		EncryptionKeyID: fmt.Sprint(encryptionKeyID),
 	}
 
 	return New(params)
 }
 
-// New constructs a new Driver with the given Aliyun credentials, region, encryption flag, and
-// bucketName
+// New constructs a new Driver with the given Alibaba Cloud credentials,
+// endpoint, encryption flag, and bucketName
 func New(params DriverParameters) (*Driver, error) {
-	client := oss.NewOSSClient(params.Region, params.Internal, params.AccessKeyID, params.AccessKeySecret, params.Secure)
-	client.SetEndpoint(params.Endpoint)
-	bucket := client.Bucket(params.Bucket)
-	client.SetDebug(false)
+	client, err := oss.New(endpointURL(params), params.AccessKeyID, params.AccessKeySecret, oss.UseCname(params.Cname))
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := client.Bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
 
 	// Validate that the given credentials have at least read permissions in the
 	// given bucket scope.
-	if _, err := bucket.List(strings.TrimRight(params.RootDirectory, "/"), "", "", 1); err != nil {
+	if _, err := bucket.ListObjectsV2(oss.Prefix(strings.Trim(params.RootDirectory, "/")), oss.MaxKeys(1)); err != nil {
 		return nil, err
 	}
 
-	// TODO(tg123): Currently multipart uploads have no timestamps, so this would be unwise
-	// if you initiated a new OSS client while another one is running on the same bucket.
-
 	d := &driver{
 		Client:          client,
 		Bucket:          bucket,
@@ -235,6 +252,39 @@ func New(params DriverParameters) (*Driver, error) {
 	}, nil
 }
 
+// endpointURL returns the URL of the OSS endpoint the driver talks to. Unless
+// an endpoint is configured, it is derived from the region.
+//
+// The client addresses the bucket as a subdomain of the endpoint. Earlier
+// releases of this driver used the endpoint as the host of the bucket itself,
+// as in [bucket].[region].aliyuncs.com, so a leading bucket name is stripped
+// to keep such configurations working. A custom domain bound to the bucket is
+// used as is when cname is set.
+func endpointURL(params DriverParameters) string {
+	endpoint := params.Endpoint
+	if endpoint == "" {
+		region := params.Region
+		if params.Internal {
+			region += "-internal"
+		}
+		endpoint = region + ".aliyuncs.com"
+	}
+	scheme := ""
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		scheme, endpoint = endpoint[:i+3], endpoint[i+3:]
+	}
+	if !params.Cname {
+		endpoint = strings.TrimPrefix(endpoint, params.Bucket+".")
+	}
+	if scheme != "" {
+		return scheme + endpoint
+	}
+	if params.Secure {
+		return "https://" + endpoint
+	}
+	return "http://" + endpoint
+}
+
 // Implement the storagedriver.StorageDriver interface
 
 func (d *driver) Name() string {
@@ -243,39 +293,36 @@ func (d *driver) Name() string {
 
 // GetContent retrieves the content stored at "path" as a []byte.
 func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
-	content, err := d.Bucket.Get(d.ossPath(path))
+	reader, err := d.Bucket.GetObject(d.ossPath(path), oss.WithContext(ctx))
 	if err != nil {
 		return nil, parseError(path, err)
 	}
-	return content, nil
+	defer reader.Close()
+	return io.ReadAll(reader)
 }
 
 // PutContent stores the []byte content at a location designated by "path".
 func (d *driver) PutContent(ctx context.Context, path string, contents []byte) error {
-	return parseError(path, d.Bucket.Put(d.ossPath(path), contents, d.getContentType(), getPermissions(), d.getOptions()))
+	return parseError(path, d.Bucket.PutObject(d.ossPath(path), bytes.NewReader(contents), d.getOptions(ctx)...))
 }
 
 // Reader retrieves an io.ReadCloser for the content stored at "path" with a
 // given byte offset.
 func (d *driver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
-	headers := make(http.Header)
-	headers.Add("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
-
-	resp, err := d.Bucket.GetResponseWithHeaders(d.ossPath(path), headers)
+	// The standard range behavior makes OSS reject a range starting past the
+	// end of the object, instead of returning the whole object.
+	result, err := d.Bucket.DoGetObject(&oss.GetObjectRequest{ObjectKey: d.ossPath(path)}, []oss.Option{
+		oss.WithContext(ctx),
+		oss.NormalizedRange(strconv.FormatInt(offset, 10) + "-"),
+		oss.RangeBehavior("standard"),
+	})
 	if err != nil {
+		if hasStatusCode(err, http.StatusRequestedRangeNotSatisfiable) {
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
 		return nil, parseError(path, err)
 	}
-
-	// Due to Aliyun OSS API, status 200 and whole object will be return instead of an
-	// InvalidRange error when range is invalid.
-	//
-	// OSS sever will always return http.StatusPartialContent if range is acceptable.
-	if resp.StatusCode != http.StatusPartialContent {
-		resp.Body.Close()
-		return io.NopCloser(bytes.NewReader(nil)), nil
-	}
-
-	return resp.Body, nil
+	return result.Response, nil
 }
 
 // Writer returns a FileWriter which will store the content written to it
@@ -284,139 +331,133 @@ func (d *driver) Writer(ctx context.Context, path string, append bool) (storaged
 	key := d.ossPath(path)
 	if !append {
 		// TODO (brianbland): cancel other uploads at this path
-		multi, err := d.Bucket.InitMulti(key, d.getContentType(), getPermissions(), d.getOptions())
+		imur, err := d.Bucket.InitiateMultipartUpload(key, d.getOptions(ctx)...)
 		if err != nil {
 			return nil, err
 		}
-		return d.newWriter(key, multi, nil), nil
+		return d.newWriter(ctx, key, imur, nil), nil
 	}
-	multis, _, err := d.Bucket.ListMulti(key, "")
-	if err != nil {
-		return nil, parseError(path, err)
-	}
-	for _, multi := range multis {
-		if key != multi.Key {
-			continue
-		}
-		parts, err := multi.ListParts()
+
+	var keyMarker, uploadIDMarker string
+	for {
+		resp, err := d.Bucket.ListMultipartUploads(oss.WithContext(ctx), oss.Prefix(key),
+			oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIDMarker), oss.MaxUploads(listMax))
 		if err != nil {
 			return nil, parseError(path, err)
 		}
-		var multiSize int64
-		for _, part := range parts {
-			multiSize += part.Size
+		for _, upload := range resp.Uploads {
+			if key != upload.Key {
+				continue
+			}
+			imur := oss.InitiateMultipartUploadResult{
+				Bucket:   d.Bucket.BucketName,
+				Key:      upload.Key,
+				UploadID: upload.UploadID,
+			}
+			parts, err := d.listParts(ctx, imur)
+			if err != nil {
+				return nil, parseError(path, err)
+			}
+			return d.newWriter(ctx, key, imur, parts), nil
+		}
+		if !resp.IsTruncated {
+			break
 		}
-		return d.newWriter(key, multi, parts), nil
+		keyMarker, uploadIDMarker = resp.NextKeyMarker, resp.NextUploadIDMarker
 	}
 	return nil, storagedriver.PathNotFoundError{Path: path}
 }
 
+// listParts returns all the parts uploaded so far to the given multipart
+// upload.
+func (d *driver) listParts(ctx context.Context, imur oss.InitiateMultipartUploadResult) ([]oss.UploadedPart, error) {
+	var parts []oss.UploadedPart
+	partNumberMarker := 0
+	for {
+		resp, err := d.Bucket.ListUploadedParts(imur, oss.WithContext(ctx),
+			oss.PartNumberMarker(partNumberMarker), oss.MaxParts(listMax))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, resp.UploadedParts...)
+		if !resp.IsTruncated {
+			return parts, nil
+		}
+		partNumberMarker, err = strconv.Atoi(resp.NextPartNumberMarker)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
 // Stat retrieves the FileInfo for the given path, including the current size
 // in bytes and the creation time.
 func (d *driver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
-	listResponse, err := d.Bucket.List(d.ossPath(path), "", "", 1)
-	if err != nil {
-		return nil, err
-	}
-
 	fi := storagedriver.FileInfoFields{
 		Path: path,
 	}
 
-	if len(listResponse.Contents) == 1 {
-		if listResponse.Contents[0].Key != d.ossPath(path) {
-			fi.IsDir = true
-		} else {
-			fi.IsDir = false
-			fi.Size = listResponse.Contents[0].Size
-
-			timestamp, err := time.Parse(time.RFC3339Nano, listResponse.Contents[0].LastModified)
-			if err != nil {
-				return nil, err
-			}
-			fi.ModTime = timestamp
+	header, err := d.Bucket.GetObjectMeta(d.ossPath(path), oss.WithContext(ctx))
+	if err == nil {
+		fi.Size, err = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if err != nil {
+			return nil, err
 		}
-	} else if len(listResponse.CommonPrefixes) == 1 {
-		fi.IsDir = true
-	} else {
-		return nil, storagedriver.PathNotFoundError{Path: path}
-	}
-
-	return storagedriver.FileInfoInternal{FileInfoFields: fi}, nil
-}
-
-// List returns a list of the objects that are direct descendants of the given path.
-func (d *driver) List(ctx context.Context, opath string) ([]string, error) {
-	path := opath
-	if path != "/" && opath[len(path)-1] != '/' {
-		path = path + "/"
+		fi.ModTime, err = http.ParseTime(header.Get("Last-Modified"))
+		if err != nil {
+			return nil, err
+		}
+		return storagedriver.FileInfoInternal{FileInfoFields: fi}, nil
 	}
-
-	// This is to cover for the cases when the rootDirectory of the driver is either "" or "/".
-	// In those cases, there is no root prefix to replace and we must actually add a "/" to all
-	// results in order to keep them as valid paths as recognized by storagedriver.PathRegexp
-	prefix := ""
-	if d.ossPath("") == "" {
-		prefix = "/"
+	if !hasStatusCode(err, http.StatusNotFound) {
+		return nil, err
 	}
 
-	ossPath := d.ossPath(path)
-	listResponse, err := d.Bucket.List(ossPath, "/", "", listMax)
+	// There is no object at the path, it is a directory if any object is
+	// stored below it.
+	resp, err := d.Bucket.ListObjectsV2(oss.WithContext(ctx), oss.Prefix(d.dirPrefix(path)), oss.MaxKeys(1))
 	if err != nil {
-		return nil, parseError(opath, err)
+		return nil, err
 	}
-
-	files := []string{}
-	directories := []string{}
-
-	for {
-		for _, key := range listResponse.Contents {
-			files = append(files, strings.Replace(key.Key, d.ossPath(""), prefix, 1))
-		}
-
-		for _, commonPrefix := range listResponse.CommonPrefixes {
-			directories = append(directories, strings.Replace(commonPrefix[0:len(commonPrefix)-1], d.ossPath(""), prefix, 1))
-		}
-
-		if listResponse.IsTruncated {
-			listResponse, err = d.Bucket.List(ossPath, "/", listResponse.NextMarker, listMax)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			break
-		}
+	if len(resp.Objects) == 0 {
+		return nil, storagedriver.PathNotFoundError{Path: path}
 	}
+	fi.IsDir = true
+	return storagedriver.FileInfoInternal{FileInfoFields: fi}, nil
+}
 
-	// This is to cover for the cases when the first key equal to ossPath.
-	if len(files) > 0 && files[0] == strings.Replace(ossPath, d.ossPath(""), prefix, 1) {
-		files = files[1:]
+// List returns a list of the objects that are direct descendants of the given path.
+func (d *driver) List(ctx context.Context, path string) ([]string, error) {
+	children, err := d.listChildren(ctx, path)
+	if err != nil {
+		return nil, err
 	}
-
-	if opath != "/" {
-		if len(files) == 0 && len(directories) == 0 {
-			// Treat empty response as missing directory, since we don't actually
-			// have directories in s3.
-			return nil, storagedriver.PathNotFoundError{Path: opath}
-		}
+	paths := make([]string, 0, len(children))
+	for _, child := range children {
+		paths = append(paths, child.Path())
 	}
-
-	return append(files, directories...), nil
+	return paths, nil
 }
 
-const maxConcurrency = 10
-
 // Move moves an object stored at sourcePath to destPath, removing the original
 // object.
 func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
-	logrus.Infof("Move from %s to %s", d.ossPath(sourcePath), d.ossPath(destPath))
-	err := d.Bucket.CopyLargeFileInParallel(d.ossPath(sourcePath), d.ossPath(destPath),
-		d.getContentType(),
-		getPermissions(),
-		d.getOptions(),
-		maxConcurrency)
+	fileInfo, err := d.Stat(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if fileInfo.IsDir() {
+		return storagedriver.PathNotFoundError{Path: sourcePath}
+	}
+
+	if fileInfo.Size() <= maxCopySize {
+		_, err = d.Bucket.CopyObject(d.ossPath(sourcePath), d.ossPath(destPath), d.getOptions(ctx)...)
+	} else {
+		// Objects too large for a single copy are copied part by part.
+		options := append(d.getOptions(ctx), oss.Routines(maxConcurrency))
+		err = d.Bucket.CopyFile(d.Bucket.BucketName, d.ossPath(sourcePath), d.ossPath(destPath), d.ChunkSize, options...)
+	}
 	if err != nil {
-		logrus.Errorf("Failed for move from %s to %s: %v", d.ossPath(sourcePath), d.ossPath(destPath), err)
 		return parseError(sourcePath, err)
 	}
 
@@ -426,37 +467,40 @@ func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) e
 // Delete recursively deletes all objects stored at "path" and its subpaths.
 func (d *driver) Delete(ctx context.Context, path string) error {
 	ossPath := d.ossPath(path)
-	listResponse, err := d.Bucket.List(ossPath, "", "", listMax)
-	if err != nil || len(listResponse.Contents) == 0 {
-		return storagedriver.PathNotFoundError{Path: path}
-	}
-
-	ossObjects := make([]oss.Object, listMax)
-
-	for len(listResponse.Contents) > 0 {
-		numOssObjects := len(listResponse.Contents)
-		for index, key := range listResponse.Contents {
-			// Stop if we encounter a key that is not a subpath (so that deleting "/a" does not delete "/ab").
-			if len(key.Key) > len(ossPath) && (key.Key)[len(ossPath)] != '/' {
-				numOssObjects = index
-				break
+	var keys []string
+	continuationToken := ""
+	for {
+		resp, err := d.Bucket.ListObjectsV2(oss.WithContext(ctx), oss.Prefix(ossPath),
+			oss.ContinuationToken(continuationToken), oss.MaxKeys(listMax))
+		if err != nil {
+			return parseError(path, err)
+		}
+		for _, object := range resp.Objects {
+			// Skip keys that are not subpaths (so that deleting "/a" does not delete "/ab").
+			if len(object.Key) > len(ossPath) && ossPath != "" && object.Key[len(ossPath)] != '/' {
+				continue
 			}
-			ossObjects[index].Key = key.Key
+			keys = append(keys, object.Key)
 		}
-
-		err := d.Bucket.DelMulti(oss.Delete{Quiet: false, Objects: ossObjects[0:numOssObjects]})
-		if err != nil {
-			return nil
+		if !resp.IsTruncated {
+			break
 		}
+		continuationToken = resp.NextContinuationToken
+	}
 
-		if numOssObjects < len(listResponse.Contents) {
-			return nil
-		}
+	if len(keys) == 0 {
+		return storagedriver.PathNotFoundError{Path: path}
+	}
 
-		listResponse, err = d.Bucket.List(d.ossPath(path), "", "", listMax)
-		if err != nil {
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > listMax {
+			batch = batch[:listMax]
+		}
+		if _, err := d.Bucket.DeleteObjects(batch, oss.WithContext(ctx), oss.DeleteObjectsQuiet(true)); err != nil {
 			return err
 		}
+		keys = keys[len(batch):]
 	}
 
 	return nil
@@ -469,80 +513,171 @@ func (d *driver) URLFor(ctx context.Context, path string, options map[string]int
 	method, ok := options["method"]
 	if ok {
 		methodString, ok = method.(string)
-		if !ok || (methodString != http.MethodGet) {
+		if !ok || (methodString != http.MethodGet && methodString != http.MethodHead) {
 			return "", storagedriver.ErrUnsupportedMethod{}
 		}
 	}
 
-	expiresTime := time.Now().Add(20 * time.Minute)
-
+	expiresIn := 20 * time.Minute
 	expires, ok := options["expiry"]
 	if ok {
 		et, ok := expires.(time.Time)
 		if ok {
-			expiresTime = et
+			expiresIn = time.Until(et)
 		}
 	}
-	logrus.Infof("methodString: %s, expiresTime: %v", methodString, expiresTime)
-	signedURL := d.Bucket.SignedURLWithMethod(methodString, d.ossPath(path), expiresTime, nil, nil)
-	logrus.Infof("signed URL: %s", signedURL)
-	return signedURL, nil
+
+	return d.Bucket.SignURL(d.ossPath(path), oss.HTTPMethod(methodString), int64(expiresIn.Seconds()))
+}
+
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path until expiry has elapsed.
+func (d *driver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return d.URLFor(ctx, path, storagedriver.ExpiryOptions(options, expiry))
 }
 
 // Walk traverses a filesystem defined within driver, starting
-// from the given path, calling f on each file
+// from the given path, calling f on each file. Each directory is listed
+// with a delimiter, so that the objects and the common prefixes directly
+// below it come with a single paged listing.
 func (d *driver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
-	return storagedriver.WalkFallback(ctx, d, path, f)
+	_, err := d.doWalk(ctx, path, f)
+	return err
+}
+
+func (d *driver) doWalk(ctx context.Context, path string, f storagedriver.WalkFn) (bool, error) {
+	children, err := d.listChildren(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	for _, fileInfo := range children {
+		err := f(fileInfo)
+		if err == nil && fileInfo.IsDir() {
+			if ok, err := d.doWalk(ctx, fileInfo.Path(), f); err != nil || !ok {
+				return ok, err
+			}
+		} else if err == storagedriver.ErrSkipDir {
+			// noop for folders, will just skip
+			if !fileInfo.IsDir() {
+				return false, nil // no error but stop iteration
+			}
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// listChildren returns the file infos of the objects and virtual directories
+// which are direct descendants of the given path, sorted by path.
+func (d *driver) listChildren(ctx context.Context, path string) ([]storagedriver.FileInfo, error) {
+	prefix := d.dirPrefix(path)
+	var children []storagedriver.FileInfo
+	continuationToken := ""
+	for {
+		resp, err := d.Bucket.ListObjectsV2(oss.WithContext(ctx), oss.Prefix(prefix), oss.Delimiter("/"),
+			oss.ContinuationToken(continuationToken), oss.MaxKeys(listMax))
+		if err != nil {
+			return nil, parseError(path, err)
+		}
+		for _, commonPrefix := range resp.CommonPrefixes {
+			children = append(children, storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+				Path:  d.pathOf(strings.TrimSuffix(commonPrefix, "/")),
+				IsDir: true,
+			}})
+		}
+		for _, object := range resp.Objects {
+			// Skip the placeholder object of the directory itself.
+			if object.Key == prefix {
+				continue
+			}
+			children = append(children, storagedriver.FileInfoInternal{FileInfoFields: storagedriver.FileInfoFields{
+				Path:    d.pathOf(object.Key),
+				Size:    object.Size,
+				ModTime: object.LastModified,
+			}})
+		}
+		if !resp.IsTruncated {
+			break
+		}
+		continuationToken = resp.NextContinuationToken
+	}
+
+	if path != "/" && len(children) == 0 {
+		// Treat empty response as missing directory, since we don't actually
+		// have directories in OSS.
+		return nil, storagedriver.PathNotFoundError{Path: path}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Path() < children[j].Path()
+	})
+	return children, nil
 }
 
 func (d *driver) ossPath(path string) string {
 	return strings.TrimLeft(strings.TrimRight(d.RootDirectory, "/")+path, "/")
 }
 
+// dirPrefix returns the key prefix of the objects stored below the given
+// path.
+func (d *driver) dirPrefix(path string) string {
+	prefix := d.ossPath(path)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// pathOf returns the driver path of the given object key.
+func (d *driver) pathOf(key string) string {
+	return "/" + strings.TrimPrefix(key, d.dirPrefix("/"))
+}
+
 func parseError(path string, err error) error {
-	if ossErr, ok := err.(*oss.Error); ok && ossErr.StatusCode == http.StatusNotFound && (ossErr.Code == "NoSuchKey" || ossErr.Code == "") {
+	if hasStatusCode(err, http.StatusNotFound) {
 		return storagedriver.PathNotFoundError{Path: path}
 	}
 
 	return err
 }
 
-func hasCode(err error, code string) bool {
-	ossErr, ok := err.(*oss.Error)
-	return ok && ossErr.Code == code
+func hasStatusCode(err error, statusCode int) bool {
+	var ossErr oss.ServiceError
+	return errors.As(err, &ossErr) && ossErr.StatusCode == statusCode
 }
 
-func (d *driver) getOptions() oss.Options {
-	return oss.Options{
-		ServerSideEncryption:      d.Encrypt,
-		ServerSideEncryptionKeyID: d.EncryptionKeyID,
+func (d *driver) getOptions(ctx context.Context) []oss.Option {
+	options := []oss.Option{
+		oss.WithContext(ctx),
+		oss.ContentType(d.getContentType()),
+		oss.ObjectACL(oss.ACLPrivate),
 	}
-}
-
-func (d *driver) getCopyOptions() oss.CopyOptions {
-	return oss.CopyOptions{
-		ServerSideEncryption:      d.Encrypt,
-		ServerSideEncryptionKeyID: d.EncryptionKeyID,
+	if d.Encrypt {
+		if d.EncryptionKeyID != "" {
+			options = append(options,
+				oss.ServerSideEncryption(string(oss.KMSAlgorithm)),
+				oss.ServerSideEncryptionKeyID(d.EncryptionKeyID))
+		} else {
+			options = append(options, oss.ServerSideEncryption(string(oss.AESAlgorithm)))
+		}
 	}
-}
-
-func getPermissions() oss.ACL {
-	return oss.Private
+	return options
 }
 
 func (d *driver) getContentType() string {
 	return "application/octet-stream"
 }
 
-// writer attempts to upload parts to S3 in a buffered fashion where the last
+// writer attempts to upload parts to OSS in a buffered fashion where the last
 // part is at least as large as the chunksize, so the multipart upload could be
 // cleanly resumed in the future. This is violated if Close is called after less
 // than a full chunk is written.
 type writer struct {
+	ctx         context.Context
 	driver      *driver
 	key         string
-	multi       *oss.Multi
-	parts       []oss.Part
+	imur        oss.InitiateMultipartUploadResult
+	parts       []oss.UploadedPart
 	size        int64
 	readyPart   []byte
 	pendingPart []byte
@@ -551,15 +686,16 @@ type writer struct {
 	cancelled   bool
 }
 
-func (d *driver) newWriter(key string, multi *oss.Multi, parts []oss.Part) storagedriver.FileWriter {
+func (d *driver) newWriter(ctx context.Context, key string, imur oss.InitiateMultipartUploadResult, parts []oss.UploadedPart) storagedriver.FileWriter {
 	var size int64
 	for _, part := range parts {
-		size += part.Size
+		size += int64(part.Size)
 	}
 	return &writer{
+		ctx:    ctx,
 		driver: d,
 		key:    key,
-		multi:  multi,
+		imur:   imur,
 		parts:  parts,
 		size:   size,
 	}
@@ -576,23 +712,26 @@ func (w *writer) Write(p []byte) (int, error) {
 
 	// If the last written part is smaller than minChunkSize, we need to make a
 	// new multipart upload :sadface:
-	if len(w.parts) > 0 && int(w.parts[len(w.parts)-1].Size) < minChunkSize {
-		err := w.multi.Complete(w.parts)
-		if err != nil {
-			w.multi.Abort()
+	if len(w.parts) > 0 && w.parts[len(w.parts)-1].Size < minChunkSize {
+		if err := w.complete(); err != nil {
 			return 0, err
 		}
 
-		multi, err := w.driver.Bucket.InitMulti(w.key, w.driver.getContentType(), getPermissions(), w.driver.getOptions())
+		imur, err := w.driver.Bucket.InitiateMultipartUpload(w.key, w.driver.getOptions(w.ctx)...)
 		if err != nil {
 			return 0, err
 		}
-		w.multi = multi
+		w.imur = imur
 
 		// If the entire written file is smaller than minChunkSize, we need to make
 		// a new part from scratch :double sad face:
 		if w.size < minChunkSize {
-			contents, err := w.driver.Bucket.Get(w.key)
+			reader, err := w.driver.Bucket.GetObject(w.key, oss.WithContext(w.ctx))
+			if err != nil {
+				return 0, err
+			}
+			contents, err := io.ReadAll(reader)
+			reader.Close()
 			if err != nil {
 				return 0, err
 			}
@@ -600,11 +739,11 @@ func (w *writer) Write(p []byte) (int, error) {
 			w.readyPart = contents
 		} else {
 			// Otherwise we can use the old file as the new first part
-			_, part, err := multi.PutPartCopy(1, w.driver.getCopyOptions(), w.driver.Bucket.Name+"/"+w.key)
+			part, err := w.driver.Bucket.UploadPartCopy(imur, w.driver.Bucket.BucketName, w.key, 0, w.size, 1, oss.WithContext(w.ctx))
 			if err != nil {
 				return 0, err
 			}
-			w.parts = []oss.Part{part}
+			w.parts = []oss.UploadedPart{{PartNumber: part.PartNumber, ETag: part.ETag, Size: int(w.size)}}
 		}
 	}
 
@@ -664,8 +803,7 @@ func (w *writer) Cancel() error {
 		return fmt.Errorf("already committed")
 	}
 	w.cancelled = true
-	err := w.multi.Abort()
-	return err
+	return w.driver.Bucket.AbortMultipartUpload(w.imur, oss.WithContext(w.ctx))
 }
 
 func (w *writer) Commit() error {
@@ -681,15 +819,32 @@ func (w *writer) Commit() error {
 		return err
 	}
 	w.committed = true
-	err = w.multi.Complete(w.parts)
-	if err != nil {
-		w.multi.Abort()
+
+	// A multipart upload can't be completed without any part, so an empty
+	// file is uploaded as a single empty part.
+	if len(w.parts) == 0 {
+		if err := w.uploadPart(nil); err != nil {
+			return err
+		}
+	}
+	return w.complete()
+}
+
+// complete completes the multipart upload with the parts uploaded so far,
+// aborting it on failure.
+func (w *writer) complete() error {
+	parts := make([]oss.UploadPart, 0, len(w.parts))
+	for _, part := range w.parts {
+		parts = append(parts, oss.UploadPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	if _, err := w.driver.Bucket.CompleteMultipartUpload(w.imur, parts, oss.WithContext(w.ctx)); err != nil {
+		w.driver.Bucket.AbortMultipartUpload(w.imur, oss.WithContext(w.ctx))
 		return err
 	}
 	return nil
 }
 
-// flushPart flushes buffers to write a part to S3.
+// flushPart flushes buffers to write a part to OSS.
 // Only called by Write (with both buffers full) and Close/Commit (always)
 func (w *writer) flushPart() error {
 	if len(w.readyPart) == 0 && len(w.pendingPart) == 0 {
@@ -703,12 +858,22 @@ func (w *writer) flushPart() error {
 		w.pendingPart = nil
 	}
 
-	part, err := w.multi.PutPart(len(w.parts)+1, bytes.NewReader(w.readyPart))
-	if err != nil {
+	if err := w.uploadPart(w.readyPart); err != nil {
 		return err
 	}
-	w.parts = append(w.parts, part)
 	w.readyPart = w.pendingPart
 	w.pendingPart = nil
 	return nil
 }
+
+// uploadPart uploads the given contents as the next part of the multipart
+// upload.
+func (w *writer) uploadPart(contents []byte) error {
+	partNumber := len(w.parts) + 1
+	part, err := w.driver.Bucket.UploadPart(w.imur, bytes.NewReader(contents), int64(len(contents)), partNumber, oss.WithContext(w.ctx))
+	if err != nil {
+		return err
+	}
+	w.parts = append(w.parts, oss.UploadedPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: len(contents)})
+	return nil
+}
@@ -8,7 +8,6 @@ import (
 	"strconv"
 	"testing"
 
-	alioss "github.com/denverdino/aliyungo/oss"
 	"github.com/distribution/distribution/v3/context"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/testsuites"
@@ -70,7 +69,7 @@ func init() {
 			AccessKeyID:     accessKey,
 			AccessKeySecret: secretKey,
 			Bucket:          bucket,
-			Region:          alioss.Region(region),
+			Region:          region,
 			Internal:        internalBool,
 			ChunkSize:       minChunkSize,
 			RootDirectory:   rootDirectory,
@@ -85,8 +84,8 @@ func init() {
 
 	// Skip OSS storage driver tests if environment variable parameters are not provided
 	skipCheck = func() string {
-		if accessKey == "" || secretKey == "" || region == "" || bucket == "" || encrypt == "" {
-			return "Must set ALIYUN_ACCESS_KEY_ID, ALIYUN_ACCESS_KEY_SECRET, OSS_REGION, OSS_BUCKET, and OSS_ENCRYPT to run OSS tests"
+		if accessKey == "" || secretKey == "" || (region == "" && endpoint == "") || bucket == "" || encrypt == "" {
+			return "Must set ALIYUN_ACCESS_KEY_ID, ALIYUN_ACCESS_KEY_SECRET, OSS_REGION or OSS_ENDPOINT, OSS_BUCKET, and OSS_ENCRYPT to run OSS tests"
 		}
 		return ""
 	}
@@ -141,3 +140,47 @@ func TestEmptyRootList(t *testing.T) {
 		}
 	}
 }
+
+func TestEndpointURL(t *testing.T) {
+	for _, tc := range []struct {
+		params   DriverParameters
+		expected string
+	}{
+		{DriverParameters{Region: "oss-cn-beijing", Secure: true}, "https://oss-cn-beijing.aliyuncs.com"},
+		{DriverParameters{Region: "oss-cn-beijing", Internal: true}, "http://oss-cn-beijing-internal.aliyuncs.com"},
+		{DriverParameters{Region: "oss-cn-beijing", Endpoint: "oss.example.com", Secure: true}, "https://oss.example.com"},
+		{DriverParameters{Endpoint: "http://127.0.0.1:8080", Secure: true}, "http://127.0.0.1:8080"},
+		// Endpoints of earlier releases name the host of the bucket.
+		{DriverParameters{Bucket: "registry", Region: "oss-cn-beijing", Endpoint: "registry.oss-cn-beijing.aliyuncs.com", Secure: true}, "https://oss-cn-beijing.aliyuncs.com"},
+		{DriverParameters{Bucket: "registry", Endpoint: "http://registry.oss-cn-beijing-internal.aliyuncs.com"}, "http://oss-cn-beijing-internal.aliyuncs.com"},
+		{DriverParameters{Bucket: "registry", Endpoint: "registry.example.com", Cname: true, Secure: true}, "https://registry.example.com"},
+	} {
+		if url := endpointURL(tc.params); url != tc.expected {
+			t.Errorf("expected endpoint %q for %+v, got %q", tc.expected, tc.params, url)
+		}
+	}
+}
+
+func TestPaths(t *testing.T) {
+	d := &driver{RootDirectory: "/root/"}
+	if key := d.ossPath("/docker/registry"); key != "root/docker/registry" {
+		t.Errorf("unexpected key %q", key)
+	}
+	if prefix := d.dirPrefix("/"); prefix != "root/" {
+		t.Errorf("unexpected prefix %q", prefix)
+	}
+	if prefix := d.dirPrefix("/docker"); prefix != "root/docker/" {
+		t.Errorf("unexpected prefix %q", prefix)
+	}
+	if path := d.pathOf("root/docker/registry"); path != "/docker/registry" {
+		t.Errorf("unexpected path %q", path)
+	}
+
+	d = &driver{RootDirectory: "/"}
+	if prefix := d.dirPrefix("/"); prefix != "" {
+		t.Errorf("unexpected prefix %q", prefix)
+	}
+	if path := d.pathOf("docker/registry"); path != "/docker/registry" {
+		t.Errorf("unexpected path %q", path)
+	}
+}
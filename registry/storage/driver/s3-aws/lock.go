@@ -0,0 +1,106 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+const (
+	// lockDirectory is the directory of the root directory holding the
+	// objects created by Lock.
+	lockDirectory = "/.locks/"
+
+	// lockPollInterval is how often a lock held by another instance is
+	// tried.
+	lockPollInterval = 200 * time.Millisecond
+
+	// lockTTL is how long a lock is held at most. The lock object of an
+	// instance which died holding it is removed by the next instance trying
+	// the lock after that.
+	lockTTL = time.Minute
+)
+
+// Lock acquires the lock of key by creating its lock object with a
+// conditional write, which fails while the object exists. Locks held longer
+// than a minute are considered abandoned and broken. Unless locking is
+// enabled, Lock returns at once like storagedriver.NoopLockableDriver.
+func (d *Driver) Lock(ctx context.Context, key string) (func(), error) {
+	dr := d.StorageDriver.(*driver)
+	if !dr.EnableLocking {
+		return func() {}, nil
+	}
+	lockKey := aws.String(dr.s3Path(lockDirectory + storagedriver.LockName(key)))
+
+	for {
+		put, err := dr.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(dr.Bucket),
+			Key:    lockKey,
+			Body:   bytes.NewReader(nil),
+		}, ifNoneMatch)
+		if err == nil {
+			// The lock object is only deleted if it is still ours, rather
+			// than the one of an instance which broke it meanwhile.
+			etag := aws.StringValue(put.ETag)
+			return func() {
+				dr.S3.DeleteObjectWithContext(context.Background(), &s3.DeleteObjectInput{
+					Bucket: aws.String(dr.Bucket),
+					Key:    lockKey,
+				}, ifMatch(etag))
+			}, nil
+		}
+		if !isLockHeld(err) {
+			return nil, err
+		}
+
+		head, err := dr.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(dr.Bucket),
+			Key:    lockKey,
+		})
+		if err == nil && time.Since(aws.TimeValue(head.LastModified)) > lockTTL {
+			// The abandoned lock object is only deleted if it wasn't
+			// replaced since it was read, such as by another instance
+			// which broke it first and acquired the lock.
+			dr.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(dr.Bucket),
+				Key:    lockKey,
+			}, ifMatch(aws.StringValue(head.ETag)))
+			continue
+		}
+
+		select {
+		case <-time.After(lockPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ifNoneMatch makes a PutObject request fail if the object exists already.
+func ifNoneMatch(r *request.Request) {
+	r.HTTPRequest.Header.Set("If-None-Match", "*")
+}
+
+// ifMatch makes a DeleteObject request fail unless the object has etag.
+func ifMatch(etag string) request.Option {
+	return func(r *request.Request) {
+		r.HTTPRequest.Header.Set("If-Match", etag)
+	}
+}
+
+// isLockHeld reports whether a conditional write of a lock object failed
+// because the object exists, or is being written by another instance.
+func isLockHeld(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() == http.StatusPreconditionFailed || reqErr.StatusCode() == http.StatusConflict
+	}
+	return false
+}
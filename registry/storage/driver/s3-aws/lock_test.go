@@ -0,0 +1,230 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// lockBucket is an S3 bucket serving the requests of Lock, honoring the
+// If-None-Match condition of object writes and the If-Match condition of
+// object deletions.
+type lockBucket struct {
+	name string
+
+	mu      sync.Mutex
+	objects map[string]lockObject
+	writes  int
+}
+
+type lockObject struct {
+	modified time.Time
+	etag     string
+}
+
+func (b *lockBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+b.name), "/")
+	object, exists := b.objects[key]
+	switch {
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Has("lifecycle"):
+		writeXML(w, http.StatusNotFound, s3Error{Code: "NoSuchLifecycleConfiguration", Message: b.name})
+
+	case key != "" && r.Method == http.MethodPut:
+		if exists && r.Header.Get("If-None-Match") == "*" {
+			writeXML(w, http.StatusPreconditionFailed, s3Error{Code: "PreconditionFailed", Message: key})
+			return
+		}
+		b.writes++
+		object = lockObject{modified: time.Now(), etag: fmt.Sprintf(`"%d"`, b.writes)}
+		b.objects[key] = object
+		w.Header().Set("ETag", object.etag)
+
+	case key != "" && r.Method == http.MethodHead:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", object.modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", object.etag)
+		w.Header().Set("Content-Length", "0")
+
+	case key != "" && r.Method == http.MethodDelete:
+		if etag := r.Header.Get("If-Match"); etag != "" && (!exists || etag != object.etag) {
+			writeXML(w, http.StatusPreconditionFailed, s3Error{Code: "PreconditionFailed", Message: key})
+			return
+		}
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeXML(w, http.StatusNotImplemented, s3Error{Code: "NotImplemented", Message: r.Method + " " + r.URL.String()})
+	}
+}
+
+func (b *lockBucket) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.objects)
+}
+
+// age ages the lock objects as if their holders died long ago.
+func (b *lockBucket) age() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, object := range b.objects {
+		object.modified = time.Now().Add(-2 * lockTTL)
+		b.objects[key] = object
+	}
+}
+
+func newLockDriver(t *testing.T, enableLocking bool) (*lockBucket, *Driver) {
+	t.Helper()
+	bucket := &lockBucket{name: "locks", objects: make(map[string]lockObject)}
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+
+	d, err := New(DriverParameters{
+		AccessKey:                   "accesskey",
+		SecretKey:                   "secretkey",
+		Bucket:                      bucket.name,
+		Region:                      "us-east-1",
+		RegionEndpoint:              server.URL,
+		ForcePathStyle:              true,
+		V4Auth:                      true,
+		ChunkSize:                   minChunkSize,
+		MultipartCopyChunkSize:      defaultMultipartCopyChunkSize,
+		MultipartCopyMaxConcurrency: defaultMultipartCopyMaxConcurrency,
+		MultipartCopyThresholdSize:  defaultMultipartCopyThresholdSize,
+		RootDirectory:               "/registry",
+		StorageClass:                noStorageClass,
+		ObjectACL:                   "private",
+		EnableLocking:               enableLocking,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	return bucket, d
+}
+
+func TestLock(t *testing.T) {
+	bucket, d := newLockDriver(t, true)
+
+	ctx := context.Background()
+	unlock, err := d.Lock(ctx, "key")
+	if err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+	if bucket.count() != 1 {
+		t.Fatalf("expected a lock object, got %d objects", bucket.count())
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	if _, err := d.Lock(timeoutCtx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected locking a held key to time out, got %v", err)
+	}
+
+	unlockOther, err := d.Lock(ctx, "other")
+	if err != nil {
+		t.Fatalf("unexpected error locking another key: %v", err)
+	}
+	unlockOther()
+
+	unlock()
+	if bucket.count() != 0 {
+		t.Fatalf("expected the lock objects to be deleted, got %d objects", bucket.count())
+	}
+	unlock, err = d.Lock(ctx, "key")
+	if err != nil {
+		t.Fatalf("unexpected error locking a released key: %v", err)
+	}
+	unlock()
+}
+
+func TestLockBreaksAbandonedLock(t *testing.T) {
+	bucket, d := newLockDriver(t, true)
+
+	ctx := context.Background()
+	unlockAbandoned, err := d.Lock(ctx, "key")
+	if err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+	bucket.age()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	unlock, err := d.Lock(timeoutCtx, "key")
+	if err != nil {
+		t.Fatalf("expected the abandoned lock to be broken, got %v", err)
+	}
+
+	// The late release of the broken lock must not release the new one.
+	unlockAbandoned()
+	if bucket.count() != 1 {
+		t.Fatalf("expected the new lock object to be kept, got %d objects", bucket.count())
+	}
+	heldCtx, cancelHeld := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancelHeld()
+	if _, err := d.Lock(heldCtx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the new lock to be held, got %v", err)
+	}
+	unlock()
+}
+
+func TestLockKeepsReplacedLock(t *testing.T) {
+	bucket, d := newLockDriver(t, true)
+
+	ctx := context.Background()
+	if _, err := d.Lock(ctx, "key"); err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+	bucket.age()
+
+	// Another instance breaks the abandoned lock and acquires it between
+	// the read of the abandoned lock object and its deletion.
+	bucket.mu.Lock()
+	var key string
+	for key = range bucket.objects {
+	}
+	stale := bucket.objects[key].etag
+	bucket.writes++
+	bucket.objects[key] = lockObject{modified: time.Now(), etag: fmt.Sprintf(`"%d"`, bucket.writes)}
+	bucket.mu.Unlock()
+
+	dr := d.StorageDriver.(*driver)
+	_, err := dr.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(dr.Bucket),
+		Key:    aws.String(key),
+	}, ifMatch(stale))
+	if err == nil {
+		t.Fatal("expected deleting the replaced lock object to fail")
+	}
+	if bucket.count() != 1 {
+		t.Fatalf("expected the replacing lock object to be kept, got %d objects", bucket.count())
+	}
+}
+
+func TestLockDisabled(t *testing.T) {
+	bucket, d := newLockDriver(t, false)
+
+	unlock, err := d.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+	if bucket.count() != 0 {
+		t.Fatalf("expected no lock object, got %d objects", bucket.count())
+	}
+	unlock()
+}
@@ -0,0 +1,205 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// multipartBucket is an S3 bucket serving the multipart upload requests the
+// driver writers make, recording the uploads that got aborted.
+type multipartBucket struct {
+	name string
+
+	mu      sync.Mutex
+	uploads int
+	aborted map[string]bool
+	// keys and parts hold the key and the sizes of the parts of each
+	// upload.
+	keys  map[string]string
+	parts map[string][]int
+}
+
+type multipartUpload struct {
+	Key      string
+	UploadId string
+}
+
+type multipartPart struct {
+	PartNumber int
+	ETag       string
+	Size       int
+}
+
+func (b *multipartBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+b.name), "/")
+	q := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet && q.Has("lifecycle"):
+		writeXML(w, http.StatusNotFound, s3Error{Code: "NoSuchLifecycleConfiguration", Message: b.name})
+
+	case key != "" && r.Method == http.MethodPost && q.Has("uploads"):
+		b.uploads++
+		uploadID := fmt.Sprintf("upload%d", b.uploads)
+		b.keys[uploadID] = key
+		writeXML(w, http.StatusOK, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: b.name, Key: key, UploadId: uploadID})
+
+	case key == "" && r.Method == http.MethodGet && q.Has("uploads"):
+		var uploads []multipartUpload
+		for uploadID, uploadKey := range b.keys {
+			if !b.aborted[uploadID] && strings.HasPrefix(uploadKey, q.Get("prefix")) {
+				uploads = append(uploads, multipartUpload{Key: uploadKey, UploadId: uploadID})
+			}
+		}
+		writeXML(w, http.StatusOK, struct {
+			XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+			Bucket      string
+			IsTruncated bool
+			Upload      []multipartUpload
+		}{Bucket: b.name, Upload: uploads})
+
+	case key != "" && r.Method == http.MethodGet && q.Has("uploadId"):
+		var parts []multipartPart
+		for i, size := range b.parts[q.Get("uploadId")] {
+			parts = append(parts, multipartPart{PartNumber: i + 1, ETag: fmt.Sprintf(`"%d"`, i+1), Size: size})
+		}
+		writeXML(w, http.StatusOK, struct {
+			XMLName     xml.Name `xml:"ListPartsResult"`
+			IsTruncated bool
+			Part        []multipartPart
+		}{Part: parts})
+
+	case key != "" && r.Method == http.MethodPut && q.Has("uploadId"):
+		if b.aborted[q.Get("uploadId")] {
+			writeXML(w, http.StatusNotFound, s3Error{Code: "NoSuchUpload", Message: q.Get("uploadId")})
+			return
+		}
+		p, _ := io.ReadAll(r.Body)
+		b.parts[q.Get("uploadId")] = append(b.parts[q.Get("uploadId")], len(p))
+		w.Header().Set("ETag", `"`+q.Get("partNumber")+`"`)
+
+	case key != "" && r.Method == http.MethodDelete && q.Has("uploadId"):
+		b.aborted[q.Get("uploadId")] = true
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeXML(w, http.StatusNotImplemented, s3Error{Code: "NotImplemented", Message: r.Method + " " + r.URL.String()})
+	}
+}
+
+func (b *multipartBucket) isAborted(uploadID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.aborted[uploadID]
+}
+
+func newMultipartDriver(t *testing.T) (*multipartBucket, *Driver) {
+	t.Helper()
+	bucket := &multipartBucket{
+		name:    "multipart",
+		aborted: make(map[string]bool),
+		keys:    make(map[string]string),
+		parts:   make(map[string][]int),
+	}
+	server := httptest.NewServer(bucket)
+	t.Cleanup(server.Close)
+
+	d, err := New(DriverParameters{
+		AccessKey:                   "accesskey",
+		SecretKey:                   "secretkey",
+		Bucket:                      bucket.name,
+		Region:                      "us-east-1",
+		RegionEndpoint:              server.URL,
+		ForcePathStyle:              true,
+		V4Auth:                      true,
+		ChunkSize:                   minChunkSize,
+		MultipartCopyChunkSize:      defaultMultipartCopyChunkSize,
+		MultipartCopyMaxConcurrency: defaultMultipartCopyMaxConcurrency,
+		MultipartCopyThresholdSize:  defaultMultipartCopyThresholdSize,
+		RootDirectory:               "/registry",
+		StorageClass:                noStorageClass,
+		ObjectACL:                   "private",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	return bucket, d
+}
+
+func TestWriterCancelAborts(t *testing.T) {
+	bucket, d := newMultipartDriver(t)
+
+	fw, err := d.Writer(context.Background(), "/upload", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	if err := fw.Cancel(); err != nil {
+		t.Fatalf("unexpected error cancelling writer: %v", err)
+	}
+	if !bucket.isAborted("upload1") {
+		t.Fatal("expected the multipart upload to be aborted")
+	}
+}
+
+// TestWriterResumesAfterRejectedChunk follows the requests of a blob upload
+// whose second chunk is rejected, or whose client disconnects, before it is
+// written: the writer of that request is neither closed nor cancelled, and
+// the upload is resumed by the next request.
+func TestWriterResumesAfterRejectedChunk(t *testing.T) {
+	bucket, d := newMultipartDriver(t)
+	chunk := bytes.Repeat([]byte("a"), minChunkSize)
+
+	fw, err := d.Writer(context.Background(), "/upload", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating writer: %v", err)
+	}
+	if _, err := fw.Write(chunk); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("unexpected error closing writer: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := d.Writer(ctx, "/upload", true); err != nil {
+		t.Fatalf("unexpected error resuming writer: %v", err)
+	}
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if bucket.isAborted("upload1") {
+		t.Fatal("expected the multipart upload to be kept after a rejected chunk")
+	}
+
+	fw, err = d.Writer(context.Background(), "/upload", true)
+	if err != nil {
+		t.Fatalf("unexpected error resuming writer after a rejected chunk: %v", err)
+	}
+	if size := fw.Size(); size != int64(len(chunk)) {
+		t.Fatalf("unexpected size of resumed writer: %d != %d", size, len(chunk))
+	}
+	if _, err := fw.Write(chunk); err != nil {
+		t.Fatalf("unexpected error writing to resumed writer: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("unexpected error closing resumed writer: %v", err)
+	}
+	if bucket.isAborted("upload1") {
+		t.Fatal("expected the multipart upload to be kept")
+	}
+}
@@ -118,6 +118,8 @@ type DriverParameters struct {
 	SessionToken                string
 	UseDualStack                bool
 	Accelerate                  bool
+	EnableVersioning            bool
+	EnableLocking               bool
 }
 
 func init() {
@@ -165,6 +167,8 @@ type driver struct {
 	RootDirectory               string
 	StorageClass                string
 	ObjectACL                   string
+	EnableVersioning            bool
+	EnableLocking               bool
 }
 
 type baseEmbed struct {
@@ -436,6 +440,40 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		return nil, fmt.Errorf("the accelerate parameter should be a boolean")
 	}
 
+	enableVersioningBool := false
+	enableVersioning := parameters["enableversioning"]
+	switch enableVersioning := enableVersioning.(type) {
+	case string:
+		b, err := strconv.ParseBool(enableVersioning)
+		if err != nil {
+			return nil, fmt.Errorf("the enableversioning parameter should be a boolean")
+		}
+		enableVersioningBool = b
+	case bool:
+		enableVersioningBool = enableVersioning
+	case nil:
+		// do nothing
+	default:
+		return nil, fmt.Errorf("the enableversioning parameter should be a boolean")
+	}
+
+	enableLockingBool := false
+	enableLocking := parameters["enablelocking"]
+	switch enableLocking := enableLocking.(type) {
+	case string:
+		b, err := strconv.ParseBool(enableLocking)
+		if err != nil {
+			return nil, fmt.Errorf("the enablelocking parameter should be a boolean")
+		}
+		enableLockingBool = b
+	case bool:
+		enableLockingBool = enableLocking
+	case nil:
+		// do nothing
+	default:
+		return nil, fmt.Errorf("the enablelocking parameter should be a boolean")
+	}
+
 	params := DriverParameters{
 		fmt.Sprint(accessKey),
 		fmt.Sprint(secretKey),
@@ -460,6 +498,8 @@ func FromParameters(parameters map[string]interface{}) (*Driver, error) {
 		fmt.Sprint(sessionToken),
 		useDualStackBool,
 		accelerateBool,
+		enableVersioningBool,
+		enableLockingBool,
 	}
 
 	return New(params)
@@ -583,8 +623,19 @@ func New(params DriverParameters) (*Driver, error) {
 		RootDirectory:               params.RootDirectory,
 		StorageClass:                params.StorageClass,
 		ObjectACL:                   params.ObjectACL,
+		EnableVersioning:            params.EnableVersioning,
+		EnableLocking:               params.EnableLocking,
+	}
+
+	if params.EnableVersioning {
+		// Deletions only leave recoverable versions on versioned buckets.
+		if err := d.checkVersioning(); err != nil {
+			return nil, err
+		}
 	}
 
+	d.checkMultipartLifecycle(context.Background())
+
 	return &Driver{
 		baseEmbed: baseEmbed{
 			Base: base.Base{
@@ -843,7 +894,14 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 		return parseError(sourcePath, err)
 	}
 
-	if fileInfo.Size() <= d.MultipartCopyThresholdSize {
+	return d.copyObject(ctx, d.Bucket+"/"+d.s3Path(sourcePath), fileInfo.Size(), destPath)
+}
+
+// copyObject copies the object copySource, of the given size, to destPath.
+// copySource is the bucket and key of the object, optionally followed by the
+// version to copy.
+func (d *driver) copyObject(ctx context.Context, copySource string, size int64, destPath string) error {
+	if size <= d.MultipartCopyThresholdSize {
 		_, err := d.S3.CopyObject(&s3.CopyObjectInput{
 			Bucket:               aws.String(d.Bucket),
 			Key:                  aws.String(d.s3Path(destPath)),
@@ -852,10 +910,10 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 			ServerSideEncryption: d.getEncryptionMode(),
 			SSEKMSKeyId:          d.getSSEKMSKeyID(),
 			StorageClass:         d.getStorageClass(),
-			CopySource:           aws.String(d.Bucket + "/" + d.s3Path(sourcePath)),
+			CopySource:           aws.String(copySource),
 		})
 		if err != nil {
-			return parseError(sourcePath, err)
+			return parseError(destPath, err)
 		}
 		return nil
 	}
@@ -873,7 +931,7 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 		return err
 	}
 
-	numParts := (fileInfo.Size() + d.MultipartCopyChunkSize - 1) / d.MultipartCopyChunkSize
+	numParts := (size + d.MultipartCopyChunkSize - 1) / d.MultipartCopyChunkSize
 	completedParts := make([]*s3.CompletedPart, numParts)
 	errChan := make(chan error, numParts)
 	limiter := make(chan struct{}, d.MultipartCopyMaxConcurrency)
@@ -884,12 +942,12 @@ func (d *driver) copy(ctx context.Context, sourcePath string, destPath string) e
 			limiter <- struct{}{}
 			firstByte := i * d.MultipartCopyChunkSize
 			lastByte := firstByte + d.MultipartCopyChunkSize - 1
-			if lastByte >= fileInfo.Size() {
-				lastByte = fileInfo.Size() - 1
+			if lastByte >= size {
+				lastByte = size - 1
 			}
 			uploadResp, err := d.S3.UploadPartCopy(&s3.UploadPartCopyInput{
 				Bucket:          aws.String(d.Bucket),
-				CopySource:      aws.String(d.Bucket + "/" + d.s3Path(sourcePath)),
+				CopySource:      aws.String(copySource),
 				Key:             aws.String(d.s3Path(destPath)),
 				PartNumber:      aws.Int64(i + 1),
 				UploadId:        createResp.UploadId,
@@ -1041,6 +1099,12 @@ func (d *driver) URLFor(ctx context.Context, path string, options map[string]int
 	return req.Presign(expiresIn)
 }
 
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path until expiry has elapsed.
+func (d *driver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return d.URLFor(ctx, path, storagedriver.ExpiryOptions(options, expiry))
+}
+
 // Walk traverses a filesystem defined within driver, starting
 // from the given path, calling f on each file
 func (d *driver) Walk(ctx context.Context, from string, f storagedriver.WalkFn) error {
@@ -1254,10 +1318,38 @@ func (d *driver) getStorageClass() *string {
 	return aws.String(d.StorageClass)
 }
 
+// checkMultipartLifecycle warns unless the lifecycle configuration of the
+// bucket aborts incomplete multipart uploads, whose parts are otherwise kept
+// and billed forever when an upload is neither committed nor cancelled.
+func (d *driver) checkMultipartLifecycle(ctx context.Context) {
+	logger := dcontext.GetLogger(ctx)
+	resp, err := d.S3.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(d.Bucket),
+	})
+	if err != nil {
+		if s3Err, ok := err.(awserr.Error); !ok || s3Err.Code() != "NoSuchLifecycleConfiguration" {
+			logger.Debugf("s3aws: unable to get the lifecycle configuration of bucket %s: %v", d.Bucket, err)
+			return
+		}
+	} else {
+		for _, rule := range resp.Rules {
+			if aws.StringValue(rule.Status) == s3.ExpirationStatusEnabled && rule.AbortIncompleteMultipartUpload != nil {
+				return
+			}
+		}
+	}
+	logger.Warnf("s3aws: bucket %s has no lifecycle rule aborting incomplete multipart uploads, "+
+		"the parts of interrupted uploads will accumulate", d.Bucket)
+}
+
 // writer attempts to upload parts to S3 in a buffered fashion where the last
 // part is at least as large as the chunksize, so the multipart upload could be
 // cleanly resumed in the future. This is violated if Close is called after less
 // than a full chunk is written.
+//
+// The multipart upload is only aborted by Cancel. A writer whose request
+// fails or whose client disconnects keeps its upload, to be resumed by a
+// later request.
 type writer struct {
 	driver      *driver
 	key         string
@@ -142,6 +142,8 @@ func init() {
 			sessionToken,
 			useDualStackBool,
 			accelerateBool,
+			false,
+			false,
 		}
 
 		return New(parameters)
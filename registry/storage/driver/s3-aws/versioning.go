@@ -0,0 +1,147 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// ObjectVersion is a version of an object of a versioned bucket.
+type ObjectVersion struct {
+	// Path is the storage driver path of the object.
+	Path string
+
+	// VersionID identifies the version of the object.
+	VersionID string
+
+	// IsLatest is set on the current version of the object.
+	IsLatest bool
+
+	// IsDeleteMarker is set on the versions recording the deletion of the
+	// object, which hold no content.
+	IsDeleteMarker bool
+
+	Size         int64
+	LastModified time.Time
+}
+
+// checkVersioning returns an error unless versioning is enabled on the
+// bucket.
+func (d *driver) checkVersioning() error {
+	resp, err := d.S3.GetBucketVersioning(&s3.GetBucketVersioningInput{
+		Bucket: aws.String(d.Bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get the versioning of bucket %s: %v", d.Bucket, err)
+	}
+	if aws.StringValue(resp.Status) != s3.BucketVersioningStatusEnabled {
+		return fmt.Errorf("versioning is not enabled on bucket %s", d.Bucket)
+	}
+	return nil
+}
+
+// ListVersions returns the versions of the objects stored at prefix and its
+// subpaths, including the delete markers left by the deletions of objects.
+// The versions of an object are ordered from the latest.
+func (d *Driver) ListVersions(ctx context.Context, prefix string) ([]ObjectVersion, error) {
+	dr := d.StorageDriver.(*driver)
+	if !dr.EnableVersioning {
+		return nil, fmt.Errorf("versioning is not enabled on the %s driver", driverName)
+	}
+
+	s3Prefix := dr.s3Path(prefix)
+	var versions []ObjectVersion
+	err := dr.S3.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(dr.Bucket),
+		Prefix: aws.String(s3Prefix),
+	}, func(resp *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		// The versions and the delete markers of a key are listed apart, and
+		// merged by their modification time.
+		for _, v := range resp.Versions {
+			versions = append(versions, ObjectVersion{
+				Path:         dr.driverPath(*v.Key),
+				VersionID:    aws.StringValue(v.VersionId),
+				IsLatest:     aws.BoolValue(v.IsLatest),
+				Size:         aws.Int64Value(v.Size),
+				LastModified: aws.TimeValue(v.LastModified),
+			})
+		}
+		for _, m := range resp.DeleteMarkers {
+			versions = append(versions, ObjectVersion{
+				Path:           dr.driverPath(*m.Key),
+				VersionID:      aws.StringValue(m.VersionId),
+				IsLatest:       aws.BoolValue(m.IsLatest),
+				IsDeleteMarker: true,
+				LastModified:   aws.TimeValue(m.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip the keys which are not subpaths, so that listing "/a" does not
+	// list "/ab".
+	filtered := versions[:0]
+	for _, v := range versions {
+		key := dr.s3Path(v.Path)
+		if len(key) > len(s3Prefix) && s3Prefix != "" && key[len(s3Prefix)] != '/' {
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+	sortVersions(filtered)
+	return filtered, nil
+}
+
+// RestoreVersion makes the version versionID of the object at path its
+// latest version, recovering it if it was deleted.
+func (d *Driver) RestoreVersion(ctx context.Context, path, versionID string) error {
+	dr := d.StorageDriver.(*driver)
+	if !dr.EnableVersioning {
+		return fmt.Errorf("versioning is not enabled on the %s driver", driverName)
+	}
+
+	resp, err := dr.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(dr.Bucket),
+		Key:       aws.String(dr.s3Path(path)),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		if aerr, ok := err.(interface{ StatusCode() int }); ok && aerr.StatusCode() == 404 {
+			return storagedriver.PathNotFoundError{Path: path, DriverName: driverName}
+		}
+		return fmt.Errorf("failed to get version %s of %s: %v", versionID, path, err)
+	}
+
+	copySource := dr.Bucket + "/" + dr.s3Path(path) + "?versionId=" + url.QueryEscape(versionID)
+	return dr.copyObject(ctx, copySource, aws.Int64Value(resp.ContentLength), path)
+}
+
+// driverPath returns the storage driver path of the s3 key.
+func (d *driver) driverPath(key string) string {
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(key, d.s3Path("")), "/")
+}
+
+// sortVersions orders versions by path, and from the latest version of each
+// path.
+func sortVersions(versions []ObjectVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Path != versions[j].Path {
+			return versions[i].Path < versions[j].Path
+		}
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+}
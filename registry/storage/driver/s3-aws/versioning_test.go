@@ -0,0 +1,339 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/context"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// versionedBucket is an in-memory S3 bucket with versioning, serving the
+// requests the driver makes with path-style addressing.
+type versionedBucket struct {
+	name       string
+	versioning string
+
+	mu      sync.Mutex
+	objects map[string][]*objectVersion // from the oldest version
+	clock   time.Time
+	nextID  int
+}
+
+type objectVersion struct {
+	id           string
+	data         []byte
+	deleteMarker bool
+	modified     time.Time
+}
+
+func newVersionedBucket(name string) *versionedBucket {
+	return &versionedBucket{
+		name:       name,
+		versioning: "Enabled",
+		objects:    make(map[string][]*objectVersion),
+		clock:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// addVersion records a new version of key, and returns it.
+func (b *versionedBucket) addVersion(key string, data []byte, deleteMarker bool) *objectVersion {
+	b.nextID++
+	b.clock = b.clock.Add(time.Second)
+	v := &objectVersion{
+		id:           fmt.Sprintf("v%d", b.nextID),
+		data:         data,
+		deleteMarker: deleteMarker,
+		modified:     b.clock,
+	}
+	b.objects[key] = append(b.objects[key], v)
+	return v
+}
+
+func (b *versionedBucket) version(key, id string) *objectVersion {
+	versions := b.objects[key]
+	for _, v := range versions {
+		if v.id == id {
+			return v
+		}
+	}
+	if id == "" && len(versions) > 0 {
+		return versions[len(versions)-1]
+	}
+	return nil
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(v)
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+func (b *versionedBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+b.name), "/")
+	q := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet && q.Has("versioning"):
+		writeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"VersioningConfiguration"`
+			Status  string   `xml:",omitempty"`
+		}{Status: b.versioning})
+
+	case key == "" && r.Method == http.MethodGet && q.Has("versions"):
+		type version struct {
+			Key          string
+			VersionId    string
+			IsLatest     bool
+			LastModified string
+			Size         int
+		}
+		type deleteMarker struct {
+			Key          string
+			VersionId    string
+			IsLatest     bool
+			LastModified string
+		}
+		result := struct {
+			XMLName       xml.Name `xml:"ListVersionsResult"`
+			Name          string
+			Prefix        string
+			IsTruncated   bool
+			Versions      []version      `xml:"Version"`
+			DeleteMarkers []deleteMarker `xml:"DeleteMarker"`
+		}{Name: b.name, Prefix: q.Get("prefix")}
+		for k, versions := range b.objects {
+			if !strings.HasPrefix(k, q.Get("prefix")) {
+				continue
+			}
+			for i, v := range versions {
+				latest := i == len(versions)-1
+				modified := v.modified.Format(time.RFC3339)
+				if v.deleteMarker {
+					result.DeleteMarkers = append(result.DeleteMarkers, deleteMarker{k, v.id, latest, modified})
+				} else {
+					result.Versions = append(result.Versions, version{k, v.id, latest, modified, len(v.data)})
+				}
+			}
+		}
+		writeXML(w, http.StatusOK, result)
+
+	case key == "" && r.Method == http.MethodGet && q.Get("list-type") == "2":
+		type content struct {
+			Key          string
+			LastModified string
+			Size         int
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string
+			Prefix      string
+			IsTruncated bool
+			KeyCount    int
+			Contents    []content
+		}{Name: b.name, Prefix: q.Get("prefix")}
+		for k, versions := range b.objects {
+			latest := versions[len(versions)-1]
+			if !strings.HasPrefix(k, q.Get("prefix")) || latest.deleteMarker {
+				continue
+			}
+			result.Contents = append(result.Contents, content{k, latest.modified.Format(time.RFC3339), len(latest.data)})
+		}
+		result.KeyCount = len(result.Contents)
+		writeXML(w, http.StatusOK, result)
+
+	case key == "" && r.Method == http.MethodPost && q.Has("delete"):
+		var req struct {
+			Objects []struct {
+				Key string
+			} `xml:"Object"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeXML(w, http.StatusBadRequest, s3Error{Code: "MalformedXML", Message: err.Error()})
+			return
+		}
+		type deleted struct {
+			Key                   string
+			DeleteMarker          bool
+			DeleteMarkerVersionId string
+		}
+		result := struct {
+			XMLName xml.Name  `xml:"DeleteResult"`
+			Deleted []deleted `xml:"Deleted"`
+		}{}
+		for _, o := range req.Objects {
+			marker := b.addVersion(o.Key, nil, true)
+			result.Deleted = append(result.Deleted, deleted{o.Key, true, marker.id})
+		}
+		writeXML(w, http.StatusOK, result)
+
+	case key != "" && r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, err := url.Parse("/" + r.Header.Get("X-Amz-Copy-Source"))
+		if err != nil {
+			writeXML(w, http.StatusBadRequest, s3Error{Code: "InvalidArgument", Message: err.Error()})
+			return
+		}
+		sourceKey := strings.TrimPrefix(source.Path, "/"+b.name+"/")
+		v := b.version(sourceKey, source.Query().Get("versionId"))
+		if v == nil || v.deleteMarker {
+			writeXML(w, http.StatusNotFound, s3Error{Code: "NoSuchKey", Message: sourceKey})
+			return
+		}
+		copied := b.addVersion(key, v.data, false)
+		w.Header().Set("X-Amz-Version-Id", copied.id)
+		writeXML(w, http.StatusOK, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: `"` + copied.id + `"`, LastModified: copied.modified.Format(time.RFC3339)})
+
+	case key != "" && r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeXML(w, http.StatusBadRequest, s3Error{Code: "IncompleteBody", Message: err.Error()})
+			return
+		}
+		v := b.addVersion(key, data, false)
+		w.Header().Set("X-Amz-Version-Id", v.id)
+		w.Header().Set("ETag", `"`+v.id+`"`)
+
+	case key != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		v := b.version(key, q.Get("versionId"))
+		if v == nil {
+			writeXML(w, http.StatusNotFound, s3Error{Code: "NoSuchKey", Message: key})
+			return
+		}
+		if v.deleteMarker {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+			status := http.StatusNotFound
+			if q.Get("versionId") != "" {
+				status = http.StatusMethodNotAllowed
+			}
+			writeXML(w, status, s3Error{Code: "NoSuchKey", Message: key})
+			return
+		}
+		data := v.data
+		if rng := r.Header.Get("Range"); strings.HasPrefix(rng, "bytes=") {
+			offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if offset > len(data) {
+				writeXML(w, http.StatusRequestedRangeNotSatisfiable, s3Error{Code: "InvalidRange", Message: rng})
+				return
+			}
+			data = data[offset:]
+		}
+		w.Header().Set("X-Amz-Version-Id", v.id)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", v.modified.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+
+	default:
+		writeXML(w, http.StatusNotImplemented, s3Error{Code: "NotImplemented", Message: r.Method + " " + r.URL.String()})
+	}
+}
+
+func newVersionedDriver(t *testing.T, endpoint, bucket string) (*Driver, error) {
+	t.Helper()
+	return New(DriverParameters{
+		AccessKey:                   "accesskey",
+		SecretKey:                   "secretkey",
+		Bucket:                      bucket,
+		Region:                      "us-east-1",
+		RegionEndpoint:              endpoint,
+		ForcePathStyle:              true,
+		V4Auth:                      true,
+		ChunkSize:                   minChunkSize,
+		MultipartCopyChunkSize:      defaultMultipartCopyChunkSize,
+		MultipartCopyMaxConcurrency: defaultMultipartCopyMaxConcurrency,
+		MultipartCopyThresholdSize:  defaultMultipartCopyThresholdSize,
+		RootDirectory:               "/registry",
+		StorageClass:                noStorageClass,
+		ObjectACL:                   "private",
+		EnableVersioning:            true,
+	})
+}
+
+func TestVersioningRestoreDeleted(t *testing.T) {
+	bucket := newVersionedBucket("versioned")
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	d, err := newVersionedDriver(t, server.URL, bucket.name)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	ctx := context.Background()
+	const path = "/docker/registry/v2/blobs/sha256/ab/abcdef/data"
+	original := []byte("original content")
+	if err := d.PutContent(ctx, path, original); err != nil {
+		t.Fatalf("unexpected error putting content: %v", err)
+	}
+	if err := d.Delete(ctx, path); err != nil {
+		t.Fatalf("unexpected error deleting content: %v", err)
+	}
+	if _, err := d.GetContent(ctx, path); err == nil {
+		t.Fatal("expected an error getting deleted content")
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error getting deleted content: %v", err)
+	}
+
+	versions, err := d.ListVersions(ctx, "/docker")
+	if err != nil {
+		t.Fatalf("unexpected error listing versions: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected a version and a delete marker, got %+v", versions)
+	}
+	marker, version := versions[0], versions[1]
+	if marker.Path != path || !marker.IsDeleteMarker || !marker.IsLatest {
+		t.Fatalf("expected the latest version to be a delete marker, got %+v", marker)
+	}
+	if version.Path != path || version.IsDeleteMarker || version.IsLatest || version.Size != int64(len(original)) {
+		t.Fatalf("unexpected version of the deleted content: %+v", version)
+	}
+
+	if err := d.RestoreVersion(ctx, path, version.VersionID); err != nil {
+		t.Fatalf("unexpected error restoring version: %v", err)
+	}
+	restored, err := d.GetContent(ctx, path)
+	if err != nil {
+		t.Fatalf("unexpected error getting restored content: %v", err)
+	}
+	if string(restored) != string(original) {
+		t.Fatalf("unexpected restored content: %q != %q", restored, original)
+	}
+
+	if err := d.RestoreVersion(ctx, path, "unknown"); err == nil {
+		t.Fatal("expected an error restoring an unknown version")
+	}
+}
+
+func TestVersioningRequiresVersionedBucket(t *testing.T) {
+	bucket := newVersionedBucket("unversioned")
+	bucket.versioning = ""
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+
+	if _, err := newVersionedDriver(t, server.URL, bucket.name); err == nil {
+		t.Fatal("expected an error creating a driver with versioning on an unversioned bucket")
+	}
+}
@@ -0,0 +1,97 @@
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// defaultReplicas is the number of points of each shard on the ring of the
+// default hasher.
+const defaultReplicas = 128
+
+// ShardHasher assigns keys to shards.
+type ShardHasher interface {
+	// Shard returns the shard of key, between 0 and shards-1. It must
+	// return the same shard for the same key and number of shards.
+	Shard(key string, shards int) int
+}
+
+// RingHasher is a ShardHasher placing keys and shards on a hash ring, such
+// that adding a shard only moves the keys it takes over, about 1/n of them.
+type RingHasher struct {
+	replicas int
+
+	mu    sync.Mutex
+	rings map[int][]ringPoint
+}
+
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// NewRingHasher returns a RingHasher placing replicas points per shard on
+// the ring. More points spread the keys more evenly.
+func NewRingHasher(replicas int) *RingHasher {
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &RingHasher{
+		replicas: replicas,
+		rings:    make(map[int][]ringPoint),
+	}
+}
+
+// Shard returns the shard of the first point of the ring following the hash
+// of key.
+func (rh *RingHasher) Shard(key string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	ring := rh.ring(shards)
+	h := hash(key)
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].shard
+}
+
+// ring returns the ring of shards, building it on first use.
+func (rh *RingHasher) ring(shards int) []ringPoint {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	if ring, ok := rh.rings[shards]; ok {
+		return ring
+	}
+	ring := make([]ringPoint, 0, shards*rh.replicas)
+	for shard := 0; shard < shards; shard++ {
+		for replica := 0; replica < rh.replicas; replica++ {
+			ring = append(ring, ringPoint{
+				hash:  hash(fmt.Sprintf("shard-%d-%d", shard, replica)),
+				shard: shard,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	rh.rings[shards] = ring
+	return ring
+}
+
+// hash returns the 64-bit FNV-1a hash of s, finalized to spread the hashes
+// of similar strings over the ring.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	// splitmix64 finalizer
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,30 @@
+package shard
+
+import (
+	"context"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// MigrateToShards copies the files stored by the single driver, such as the
+// storage of a registry before it was sharded, to their shard of the
+// sharded driver. Files already copied, with the same size, are skipped, so
+// that an interrupted migration can be resumed. The files of single are not
+// removed.
+func MigrateToShards(ctx context.Context, single, sharded storagedriver.StorageDriver) error {
+	err := single.Walk(ctx, "/", func(fi storagedriver.FileInfo) error {
+		if fi.IsDir() {
+			return nil
+		}
+		if copied, err := sharded.Stat(ctx, fi.Path()); err == nil && !copied.IsDir() && copied.Size() == fi.Size() {
+			return nil
+		} else if _, ok := err.(storagedriver.PathNotFoundError); err != nil && !ok {
+			return err
+		}
+		return copyFile(ctx, single, fi.Path(), sharded, fi.Path())
+	})
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,404 @@
+// Package shard provides a storagedriver.StorageDriver distributing the
+// repositories and blobs of a registry across several storage drivers, such
+// as several buckets, by consistent hashing.
+//
+// The files of a repository are stored by the shard of its name, and blobs
+// by the shard of their digest. Paths which belong to no single repository
+// or blob, such as the root of the repositories, are listed, walked and
+// deleted across all the shards.
+package shard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/base"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+)
+
+const driverName = "shard"
+
+const (
+	// repositoriesRoot and blobsRoot are the roots of the repositories and
+	// blobs in the storage layout of the registry.
+	repositoriesRoot = "/docker/registry/v2/repositories/"
+	blobsRoot        = "/docker/registry/v2/blobs/"
+)
+
+type driver struct {
+	backends []storagedriver.StorageDriver
+	hasher   ShardHasher
+}
+
+type baseEmbed struct {
+	base.Base
+}
+
+// Driver is a storagedriver.StorageDriver distributing the repositories and
+// blobs across several storage drivers.
+type Driver struct {
+	baseEmbed
+}
+
+// NewShardedDriver returns a storage driver distributing the repositories
+// and blobs across backends, according to hasher. A nil hasher places them
+// on a hash ring. The shard of a repository depends on the order of
+// backends, which must be kept.
+func NewShardedDriver(backends []storagedriver.StorageDriver, hasher ShardHasher) storagedriver.StorageDriver {
+	if hasher == nil {
+		hasher = NewRingHasher(defaultReplicas)
+	}
+	return &Driver{
+		baseEmbed: baseEmbed{
+			Base: base.Base{
+				StorageDriver: &driver{
+					backends: backends,
+					hasher:   hasher,
+				},
+			},
+		},
+	}
+}
+
+// Lock acquires the lock of key with the shard storing the file at key, if it
+// can lock, such that the lock excludes the instances sharing the shard.
+func (d *Driver) Lock(ctx context.Context, key string) (func(), error) {
+	return storagedriver.AsLockable(d.StorageDriver.(*driver).backend(key)).Lock(ctx, key)
+}
+
+// FromParameters constructs a sharded driver from the parameters of the
+// storage.shard configuration. Its backends parameter lists the storage
+// driver of each shard, as a map from the driver type to its parameters.
+// The parameters in common are added to the parameters of each backend.
+func FromParameters(parameters map[string]interface{}, common map[string]interface{}) (storagedriver.StorageDriver, error) {
+	backendsParam, ok := parameters["backends"].([]interface{})
+	if !ok || len(backendsParam) == 0 {
+		return nil, fmt.Errorf("the backends parameter must list the storage drivers of the shards")
+	}
+
+	backends := make([]storagedriver.StorageDriver, 0, len(backendsParam))
+	for i, backendParam := range backendsParam {
+		driverType, driverParams, err := backendParameters(backendParam)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend %d: %v", i, err)
+		}
+		for k, v := range common {
+			if _, ok := driverParams[k]; !ok {
+				driverParams[k] = v
+			}
+		}
+		backend, err := factory.Create(driverType, driverParams)
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct %s driver of backend %d: %v", driverType, i, err)
+		}
+		backends = append(backends, backend)
+	}
+	return NewShardedDriver(backends, nil), nil
+}
+
+// backendParameters returns the type and the parameters of the storage
+// driver configured by param.
+func backendParameters(param interface{}) (string, map[string]interface{}, error) {
+	var backend map[string]interface{}
+	switch param := param.(type) {
+	case map[string]interface{}:
+		backend = param
+	case map[interface{}]interface{}:
+		backend = make(map[string]interface{}, len(param))
+		for k, v := range param {
+			backend[fmt.Sprint(k)] = v
+		}
+	default:
+		return "", nil, fmt.Errorf("expected a storage driver, got %T", param)
+	}
+	if len(backend) != 1 {
+		return "", nil, fmt.Errorf("expected a single storage driver, got %d", len(backend))
+	}
+
+	for driverType, v := range backend {
+		driverParams := make(map[string]interface{})
+		switch v := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			for k, pv := range v {
+				driverParams[k] = pv
+			}
+		case map[interface{}]interface{}:
+			for k, pv := range v {
+				driverParams[fmt.Sprint(k)] = pv
+			}
+		default:
+			return "", nil, fmt.Errorf("invalid parameters for %s driver: %T", driverType, v)
+		}
+		return driverType, driverParams, nil
+	}
+	panic("unreachable")
+}
+
+// shardKey returns the key by which the file or directory at path is
+// sharded, the name of its repository or the digest of its blob. It returns
+// false for paths which belong to no single repository or blob.
+func shardKey(path string) (string, bool) {
+	switch {
+	case strings.HasPrefix(path, repositoriesRoot):
+		// The name of the repository spans the components up to the first
+		// one starting with an underscore, such as _manifests.
+		components := strings.Split(strings.TrimPrefix(path, repositoriesRoot), "/")
+		for i, component := range components {
+			if strings.HasPrefix(component, "_") {
+				if i == 0 {
+					return "", false
+				}
+				return strings.Join(components[:i], "/"), true
+			}
+		}
+	case strings.HasPrefix(path, blobsRoot):
+		// <algorithm>/<first two hex digits>/<hex digest>
+		components := strings.Split(strings.TrimPrefix(path, blobsRoot), "/")
+		if len(components) >= 3 {
+			return components[0] + ":" + components[2], true
+		}
+	}
+	return "", false
+}
+
+// backend returns the backend storing the file at path. The files outside
+// of a repository or blob are sharded by their path.
+func (d *driver) backend(path string) storagedriver.StorageDriver {
+	key, ok := shardKey(path)
+	if !ok {
+		key = path
+	}
+	return d.backends[d.hasher.Shard(key, len(d.backends))]
+}
+
+func (d *driver) Name() string {
+	return driverName
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *driver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	return d.backend(path).GetContent(ctx, path)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *driver) PutContent(ctx context.Context, path string, content []byte) error {
+	return d.backend(path).PutContent(ctx, path, content)
+}
+
+// Reader retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset.
+func (d *driver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	return d.backend(path).Reader(ctx, path, offset)
+}
+
+// Writer returns a FileWriter which will store the content written to it
+// at the location designated by "path" after the call to Commit.
+func (d *driver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	return d.backend(path).Writer(ctx, path, append)
+}
+
+// Stat retrieves the FileInfo for the given path. Directories outside of a
+// repository or blob are looked up on all the shards.
+func (d *driver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if _, ok := shardKey(path); ok {
+		return d.backend(path).Stat(ctx, path)
+	}
+
+	var dir storagedriver.FileInfo
+	for _, backend := range d.backends {
+		fi, err := backend.Stat(ctx, path)
+		if err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return fi, nil
+		}
+		if dir == nil || fi.ModTime().After(dir.ModTime()) {
+			dir = fi
+		}
+	}
+	if dir == nil {
+		return nil, storagedriver.PathNotFoundError{Path: path, DriverName: driverName}
+	}
+	return dir, nil
+}
+
+// List returns a list of the objects that are direct descendants of the
+// given path. Directories outside of a repository or blob are listed on all
+// the shards.
+func (d *driver) List(ctx context.Context, path string) ([]string, error) {
+	if _, ok := shardKey(path); ok {
+		return d.backend(path).List(ctx, path)
+	}
+
+	seen := make(map[string]struct{})
+	var children []string
+	found := false
+	for _, backend := range d.backends {
+		list, err := backend.List(ctx, path)
+		if err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, child := range list {
+			if _, ok := seen[child]; !ok {
+				seen[child] = struct{}{}
+				children = append(children, child)
+			}
+		}
+	}
+	if !found {
+		return nil, storagedriver.PathNotFoundError{Path: path, DriverName: driverName}
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// Move moves an object stored at sourcePath to destPath, removing the
+// original object. Objects are copied across shards, such as when an upload
+// of a repository becomes a blob.
+func (d *driver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	source, dest := d.backend(sourcePath), d.backend(destPath)
+	if source == dest {
+		return source.Move(ctx, sourcePath, destPath)
+	}
+	if err := copyFile(ctx, source, sourcePath, dest, destPath); err != nil {
+		return err
+	}
+	return source.Delete(ctx, sourcePath)
+}
+
+// copyFile copies the file at sourcePath of source to destPath of dest.
+func copyFile(ctx context.Context, source storagedriver.StorageDriver, sourcePath string, dest storagedriver.StorageDriver, destPath string) error {
+	r, err := source.Reader(ctx, sourcePath, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := dest.Writer(ctx, destPath, false)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Cancel()
+		return err
+	}
+	if err := w.Commit(); err != nil {
+		w.Cancel()
+		return err
+	}
+	return w.Close()
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+// Directories outside of a repository or blob are deleted on all the
+// shards.
+func (d *driver) Delete(ctx context.Context, path string) error {
+	if _, ok := shardKey(path); ok {
+		return d.backend(path).Delete(ctx, path)
+	}
+
+	found := false
+	for _, backend := range d.backends {
+		if err := backend.Delete(ctx, path); err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				continue
+			}
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return storagedriver.PathNotFoundError{Path: path, DriverName: driverName}
+	}
+	return nil
+}
+
+// URLFor returns a URL which may be used to retrieve the content stored at
+// the given path.
+func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return d.backend(path).URLFor(ctx, path, options)
+}
+
+// URLForWithExpiry returns a URL which may be used to retrieve the content
+// stored at the given path until expiry has elapsed.
+func (d *driver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	return d.backend(path).URLForWithExpiry(ctx, path, expiry, options)
+}
+
+// Walk traverses the files from the given path. Directories outside of a
+// repository or blob are walked across all the shards, in lexical order,
+// and the repositories and blobs below them by the walk of their shard.
+func (d *driver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
+	if _, ok := shardKey(path); ok {
+		return d.backend(path).Walk(ctx, path, f)
+	}
+	_, err := d.walk(ctx, path, f)
+	return err
+}
+
+// walk walks the directory at path, and returns false if f stopped the walk.
+func (d *driver) walk(ctx context.Context, path string, f storagedriver.WalkFn) (bool, error) {
+	children, err := d.List(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	for _, child := range children {
+		fi, err := d.Stat(ctx, child)
+		if err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				// removed between listing and enumeration
+				continue
+			}
+			return false, err
+		}
+
+		err = f(fi)
+		switch {
+		case err == storagedriver.ErrSkipDir:
+			if !fi.IsDir() {
+				return false, nil
+			}
+		case err != nil:
+			return false, err
+		case !fi.IsDir():
+		case isSharded(child):
+			// Walk the repository or blob on its shard, noting whether f
+			// stopped it, as the walk returns no error then.
+			stopped := false
+			err := d.backend(child).Walk(ctx, child, func(fi storagedriver.FileInfo) error {
+				err := f(fi)
+				if err == storagedriver.ErrSkipDir && !fi.IsDir() {
+					stopped = true
+				}
+				return err
+			})
+			if err != nil || stopped {
+				return false, err
+			}
+		default:
+			if ok, err := d.walk(ctx, child, f); err != nil || !ok {
+				return ok, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func isSharded(path string) bool {
+	_, ok := shardKey(path)
+	return ok
+}
@@ -0,0 +1,196 @@
+package shard
+
+import (
+	stdcontext "context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/context"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/testsuites"
+	"gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { check.TestingT(t) }
+
+func init() {
+	testsuites.RegisterSuite(func() (storagedriver.StorageDriver, error) {
+		return NewShardedDriver([]storagedriver.StorageDriver{inmemory.New(), inmemory.New(), inmemory.New()}, nil), nil
+	}, testsuites.NeverSkip)
+}
+
+func TestRingHasherConsistentRouting(t *testing.T) {
+	const keys = 10000
+	hasher := NewRingHasher(defaultReplicas)
+	counts := make([]int, 4)
+	before := make([]int, keys)
+	for i := range before {
+		key := fmt.Sprintf("library/image-%d", i)
+		before[i] = hasher.Shard(key, 4)
+		if other := NewRingHasher(defaultReplicas).Shard(key, 4); other != before[i] {
+			t.Fatalf("key %s routed to shard %d, then %d", key, before[i], other)
+		}
+		counts[before[i]]++
+	}
+	for shard, count := range counts {
+		if count < keys/8 || count > keys*3/8 {
+			t.Fatalf("unbalanced shards: shard %d has %d of %d keys", shard, count, keys)
+		}
+	}
+
+	// Adding a shard only moves the keys it takes over.
+	moved := 0
+	for i, shard := range before {
+		after := hasher.Shard(fmt.Sprintf("library/image-%d", i), 5)
+		if after == shard {
+			continue
+		}
+		if after != 4 {
+			t.Fatalf("key %d moved from shard %d to existing shard %d", i, shard, after)
+		}
+		moved++
+	}
+	if moved < keys/10 || moved > keys*3/10 {
+		t.Fatalf("expected about a fifth of the keys to move to the new shard, got %d of %d", moved, keys)
+	}
+}
+
+func TestShardedDriverRouting(t *testing.T) {
+	ctx := context.Background()
+	backends := []storagedriver.StorageDriver{inmemory.New(), inmemory.New(), inmemory.New()}
+	d := NewShardedDriver(backends, nil)
+
+	// The files of a repository are stored on the same shard.
+	repositories := []string{"library/ubuntu", "library/alpine", "team/app", "team/app/sidecar"}
+	shards := make(map[string]storagedriver.StorageDriver)
+	for _, name := range repositories {
+		root := repositoriesRoot + name
+		for _, p := range []string{"/_manifests/tags/latest/current/link", "/_layers/sha256/abcd/link", "/_uploads/uuid/startedat"} {
+			if err := d.PutContent(ctx, root+p, []byte(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var found []storagedriver.StorageDriver
+		for _, backend := range backends {
+			if _, err := backend.Stat(ctx, root+"/_manifests"); err == nil {
+				found = append(found, backend)
+			}
+		}
+		if len(found) != 1 {
+			t.Fatalf("expected repository %s on a single shard, found on %d", name, len(found))
+		}
+		for _, p := range []string{"/_layers", "/_uploads"} {
+			if _, err := found[0].Stat(ctx, root+p); err != nil {
+				t.Fatalf("expected %s of repository %s on the shard of its manifests: %v", p, name, err)
+			}
+		}
+		shards[name] = found[0]
+	}
+	if shards["library/ubuntu"] == shards["library/alpine"] && shards["library/alpine"] == shards["team/app"] && shards["team/app"] == shards["team/app/sidecar"] {
+		t.Fatal("expected the repositories to be spread across shards")
+	}
+
+	// Uploads are moved to the shard of their blob.
+	const blobPath = blobsRoot + "sha256/ab/abcdef/data"
+	uploadPath := repositoriesRoot + "team/app/_uploads/uuid/data"
+	if err := d.PutContent(ctx, uploadPath, []byte("blob")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Move(ctx, uploadPath, blobPath); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := d.GetContent(ctx, blobPath); err != nil || string(p) != "blob" {
+		t.Fatalf("unexpected content of moved blob %q: %v", p, err)
+	}
+	if _, err := d.Stat(ctx, uploadPath); err == nil {
+		t.Fatal("expected the upload to be removed once moved")
+	}
+
+	// Listing and walking merge the shards.
+	list, err := d.List(ctx, repositoriesRoot+"library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{repositoriesRoot + "library/alpine", repositoriesRoot + "library/ubuntu"}
+	if !reflect.DeepEqual(list, expected) {
+		t.Fatalf("unexpected listing: %v != %v", list, expected)
+	}
+	var files []string
+	if err := d.Walk(ctx, "/", func(fi storagedriver.FileInfo) error {
+		if !fi.IsDir() {
+			files = append(files, fi.Path())
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Three files per repository, and the blob.
+	if len(files) != 3*len(repositories)+1 {
+		t.Fatalf("expected to walk %d files, got %d: %v", 3*len(repositories)+1, len(files), files)
+	}
+	if !sort.StringsAreSorted(files) {
+		t.Fatalf("expected the walk in lexical order, got %v", files)
+	}
+}
+
+func TestShardedDriverLock(t *testing.T) {
+	ctx := context.Background()
+	d, ok := NewShardedDriver([]storagedriver.StorageDriver{inmemory.New(), inmemory.New(), inmemory.New()}, nil).(storagedriver.LockableDriver)
+	if !ok {
+		t.Fatal("expected the sharded driver to lock")
+	}
+
+	const key = repositoriesRoot + "team/app/_manifests/tags/latest"
+	unlock, err := d.Lock(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock is held until released.
+	timeoutCtx, cancel := stdcontext.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := d.Lock(timeoutCtx, key); err == nil {
+		t.Fatal("expected locking a held key to time out")
+	}
+	unlock()
+	unlock, err = d.Lock(ctx, key)
+	if err != nil {
+		t.Fatalf("error locking a released key: %v", err)
+	}
+	unlock()
+}
+
+func TestMigrateToShards(t *testing.T) {
+	ctx := context.Background()
+	single := inmemory.New()
+	paths := []string{
+		repositoriesRoot + "library/ubuntu/_manifests/tags/latest/current/link",
+		repositoriesRoot + "team/app/_layers/sha256/abcd/link",
+		blobsRoot + "sha256/ab/abcd/data",
+	}
+	for _, p := range paths {
+		if err := single.PutContent(ctx, p, []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sharded := NewShardedDriver([]storagedriver.StorageDriver{inmemory.New(), inmemory.New()}, nil)
+	for i := 0; i < 2; i++ {
+		if err := MigrateToShards(ctx, single, sharded); err != nil {
+			t.Fatalf("migration %d failed: %v", i, err)
+		}
+	}
+	for _, p := range paths {
+		content, err := sharded.GetContent(ctx, p)
+		if err != nil || string(content) != p {
+			t.Fatalf("unexpected content of migrated file %s %q: %v", p, content, err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Version is a string representing the storage driver version, of the form
@@ -84,6 +85,14 @@ type StorageDriver interface {
 	// implementations.
 	URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error)
 
+	// URLForWithExpiry returns a URL which may be used to retrieve the content
+	// stored at the given path until expiry has elapsed, possibly using the
+	// given options. Drivers may shorten the expiry to the longest one their
+	// backend supports.
+	// May return an ErrUnsupportedMethod in certain StorageDriver
+	// implementations.
+	URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error)
+
 	// Walk traverses a filesystem defined within driver, starting
 	// from the given path, calling f on each file.
 	// If the returned error from the WalkFn is ErrSkipDir and fileInfo refers
@@ -92,6 +101,18 @@ type StorageDriver interface {
 	Walk(ctx context.Context, path string, f WalkFn) error
 }
 
+// ExpiryOptions returns a copy of the URLFor options, with the "expiry"
+// option set to expire after expiry. Drivers accepting the option implement
+// URLForWithExpiry with it.
+func ExpiryOptions(options map[string]interface{}, expiry time.Duration) map[string]interface{} {
+	withExpiry := make(map[string]interface{}, len(options)+1)
+	for k, v := range options {
+		withExpiry[k] = v
+	}
+	withExpiry["expiry"] = time.Now().Add(expiry)
+	return withExpiry
+}
+
 // FileWriter provides an abstraction for an opened writable file-like object in
 // the storage backend. The FileWriter must flush all content written to it on
 // the call to Close, but is only required to make its content readable on a
@@ -111,6 +132,15 @@ type FileWriter interface {
 	Commit() error
 }
 
+// FileWriterSyncer is implemented by the FileWriters which buffer the
+// content written.
+type FileWriterSyncer interface {
+	// Sync flushes the content written so far to the storage, such that a
+	// FileWriter opened to append to the file after an interruption resumes
+	// at the current size of this FileWriter.
+	Sync() error
+}
+
 // PathRegexp is the regular expression which each file path must match. A
 // file path is absolute, beginning with a slash and containing a positive
 // number of path components separated by slashes, where each component is
@@ -0,0 +1,180 @@
+// Package tracing provides a storage driver wrapper recording an
+// OpenTelemetry span for every call to the wrapped driver, such that the time
+// spent in the storage backend can be told apart from the rest of a request.
+//
+// The spans are not exported unless the program installs a tracer provider
+// with an exporter, or passes one to New.
+package tracing
+
+import (
+	"context"
+	"io"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the spans.
+const instrumentationName = "github.com/distribution/distribution/v3/registry/storage/driver/tracing"
+
+// Span attribute keys.
+const (
+	driverKey   = attribute.Key("storage.driver")
+	pathKey     = attribute.Key("storage.path")
+	destPathKey = attribute.Key("storage.dest_path")
+	offsetKey   = attribute.Key("storage.offset")
+	bytesKey    = attribute.Key("storage.bytes")
+)
+
+type tracingDriver struct {
+	storagedriver.StorageDriver
+	tracer trace.Tracer
+}
+
+var _ storagedriver.LockableDriver = &tracingDriver{}
+
+// New returns a storage driver recording a span for every call to driver
+// with the tracer of provider, or of the global tracer provider if provider
+// is nil. The spans are the children of the span of the context of the call.
+func New(driver storagedriver.StorageDriver, provider trace.TracerProvider) storagedriver.StorageDriver {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &tracingDriver{
+		StorageDriver: driver,
+		tracer:        provider.Tracer(instrumentationName),
+	}
+}
+
+// start starts the span of the named operation on path.
+func (d *tracingDriver) start(ctx context.Context, operation, path string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append([]attribute.KeyValue{
+		driverKey.String(d.StorageDriver.Name()),
+		pathKey.String(path),
+	}, attrs...)
+	return d.tracer.Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+}
+
+// end ends span, with an error status if err is not nil.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// GetContent wraps GetContent of the underlying storage driver.
+func (d *tracingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	ctx, span := d.start(ctx, "GetContent", path)
+	content, err := d.StorageDriver.GetContent(ctx, path)
+	span.SetAttributes(bytesKey.Int(len(content)))
+	end(span, err)
+	return content, err
+}
+
+// PutContent wraps PutContent of the underlying storage driver.
+func (d *tracingDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	ctx, span := d.start(ctx, "PutContent", path, bytesKey.Int(len(content)))
+	err := d.StorageDriver.PutContent(ctx, path, content)
+	end(span, err)
+	return err
+}
+
+// Reader wraps Reader of the underlying storage driver. The span covers
+// opening the reader, not reading from it.
+func (d *tracingDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	ctx, span := d.start(ctx, "Reader", path, offsetKey.Int64(offset))
+	rc, err := d.StorageDriver.Reader(ctx, path, offset)
+	end(span, err)
+	return rc, err
+}
+
+// Writer wraps Writer of the underlying storage driver. The span covers
+// opening the writer, recording the size of the content already written when
+// appending.
+func (d *tracingDriver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	ctx, span := d.start(ctx, "Writer", path, attribute.Bool("storage.append", append))
+	fw, err := d.StorageDriver.Writer(ctx, path, append)
+	if err == nil {
+		span.SetAttributes(bytesKey.Int64(fw.Size()))
+	}
+	end(span, err)
+	return fw, err
+}
+
+// Stat wraps Stat of the underlying storage driver.
+func (d *tracingDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	ctx, span := d.start(ctx, "Stat", path)
+	fi, err := d.StorageDriver.Stat(ctx, path)
+	if err == nil && !fi.IsDir() {
+		span.SetAttributes(bytesKey.Int64(fi.Size()))
+	}
+	end(span, err)
+	return fi, err
+}
+
+// List wraps List of the underlying storage driver.
+func (d *tracingDriver) List(ctx context.Context, path string) ([]string, error) {
+	ctx, span := d.start(ctx, "List", path)
+	children, err := d.StorageDriver.List(ctx, path)
+	span.SetAttributes(attribute.Int("storage.children", len(children)))
+	end(span, err)
+	return children, err
+}
+
+// Move wraps Move of the underlying storage driver.
+func (d *tracingDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	ctx, span := d.start(ctx, "Move", sourcePath, destPathKey.String(destPath))
+	err := d.StorageDriver.Move(ctx, sourcePath, destPath)
+	end(span, err)
+	return err
+}
+
+// Delete wraps Delete of the underlying storage driver.
+func (d *tracingDriver) Delete(ctx context.Context, path string) error {
+	ctx, span := d.start(ctx, "Delete", path)
+	err := d.StorageDriver.Delete(ctx, path)
+	end(span, err)
+	return err
+}
+
+// URLFor wraps URLFor of the underlying storage driver.
+func (d *tracingDriver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	ctx, span := d.start(ctx, "URLFor", path)
+	url, err := d.StorageDriver.URLFor(ctx, path, options)
+	end(span, err)
+	return url, err
+}
+
+// URLForWithExpiry wraps URLForWithExpiry of the underlying storage driver.
+func (d *tracingDriver) URLForWithExpiry(ctx context.Context, path string, expiry time.Duration, options map[string]interface{}) (string, error) {
+	ctx, span := d.start(ctx, "URLForWithExpiry", path)
+	url, err := d.StorageDriver.URLForWithExpiry(ctx, path, expiry, options)
+	end(span, err)
+	return url, err
+}
+
+// Walk wraps Walk of the underlying storage driver. The span covers the whole
+// traversal, including the calls to f.
+func (d *tracingDriver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
+	ctx, span := d.start(ctx, "Walk", path)
+	err := d.StorageDriver.Walk(ctx, path, f)
+	end(span, err)
+	return err
+}
+
+// Lock acquires the lock of key with the wrapped driver, if it can lock. The
+// span covers waiting for the lock, not holding it.
+func (d *tracingDriver) Lock(ctx context.Context, key string) (func(), error) {
+	ctx, span := d.start(ctx, "Lock", key)
+	unlock, err := storagedriver.AsLockable(d.StorageDriver).Lock(ctx, key)
+	end(span, err)
+	return unlock, err
+}
@@ -0,0 +1,108 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTracedDriver() (storagedriver.StorageDriver, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return tracing.New(inmemory.New(), provider), recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestSpans(t *testing.T) {
+	ctx := context.Background()
+	driver, recorder := newTracedDriver()
+
+	if err := driver.PutContent(ctx, "/a", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.GetContent(ctx, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.List(ctx, "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	for i, name := range []string{"storage.PutContent", "storage.GetContent", "storage.List"} {
+		span := spans[i]
+		if span.Name() != name {
+			t.Errorf("expected span %d to be %s, got %s", i, name, span.Name())
+		}
+		attrs := attributes(span)
+		if driverName := attrs["storage.driver"].AsString(); driverName != "inmemory" {
+			t.Errorf("%s: expected driver inmemory, got %q", name, driverName)
+		}
+		if span.Status().Code == codes.Error {
+			t.Errorf("%s: unexpected error status", name)
+		}
+	}
+	for _, span := range spans[:2] {
+		attrs := attributes(span)
+		if path := attrs["storage.path"].AsString(); path != "/a" {
+			t.Errorf("%s: expected path /a, got %q", span.Name(), path)
+		}
+		if n := attrs["storage.bytes"].AsInt64(); n != int64(len("content")) {
+			t.Errorf("%s: expected %d bytes, got %d", span.Name(), len("content"), n)
+		}
+	}
+}
+
+func TestSpanError(t *testing.T) {
+	driver, recorder := newTracedDriver()
+
+	_, err := driver.Stat(context.Background(), "/missing")
+	if !errors.As(err, new(storagedriver.PathNotFoundError)) {
+		t.Fatalf("expected a PathNotFoundError, got %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if code := spans[0].Status().Code; code != codes.Error {
+		t.Errorf("expected error status, got %v", code)
+	}
+}
+
+func TestChildSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	driver := tracing.New(inmemory.New(), provider)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	if _, err := driver.List(ctx, "/"); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("expected the storage span to be a child of the request span")
+	}
+}
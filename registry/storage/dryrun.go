@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// dryRunAction is the action of the entries written by DryRunDeleter.
+const dryRunAction = "would_delete"
+
+// dryRunBlob is the entry written by DryRunDeleter for a blob.
+type dryRunBlob struct {
+	Type   string        `json:"type"`
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+	Action string        `json:"action"`
+}
+
+// dryRunManifest is the entry written by DryRunDeleter for a manifest. The
+// manifest content is a blob, whose size is reported with the blob.
+type dryRunManifest struct {
+	Type       string        `json:"type"`
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+	Tags       []string      `json:"tags,omitempty"`
+	Action     string        `json:"action"`
+}
+
+// dryRunTagIndexEntry is the entry written by DryRunDeleter for an entry of
+// the index of a tag.
+type dryRunTagIndexEntry struct {
+	Type       string        `json:"type"`
+	Repository string        `json:"repository"`
+	Tag        string        `json:"tag"`
+	Digest     digest.Digest `json:"digest"`
+	Action     string        `json:"action"`
+}
+
+// dryRunTag is the entry written by DryRunDeleter for a tag.
+type dryRunTag struct {
+	Type       string `json:"type"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Action     string `json:"action"`
+}
+
+// DryRunDeleter is a Deleter which removes nothing. It writes instead a line
+// of JSON for every blob, manifest, tag and tag index entry it is asked to
+// remove, such as
+//
+//	{"type":"blob","digest":"sha256:...","size":1234,"action":"would_delete"}
+//
+// DryRunDeleter is safe for concurrent use.
+type DryRunDeleter struct {
+	ctx    context.Context
+	driver driver.StorageDriver
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+var _ Deleter = &DryRunDeleter{}
+
+// NewDryRunDeleter creates a DryRunDeleter of the content of driver, writing
+// to w.
+func NewDryRunDeleter(ctx context.Context, driver driver.StorageDriver, w io.Writer) *DryRunDeleter {
+	return &DryRunDeleter{
+		ctx:    ctx,
+		driver: driver,
+		enc:    json.NewEncoder(w),
+	}
+}
+
+// RemoveBlob writes the entry of a blob, with its size.
+func (d *DryRunDeleter) RemoveBlob(dgst string) error {
+	parsed, err := digest.Parse(dgst)
+	if err != nil {
+		return err
+	}
+
+	blobPath, err := pathFor(blobDataPathSpec{digest: parsed})
+	if err != nil {
+		return err
+	}
+	fi, err := d.driver.Stat(d.ctx, blobPath)
+	if err != nil {
+		return err
+	}
+
+	return d.write(dryRunBlob{
+		Type:   "blob",
+		Digest: parsed,
+		Size:   fi.Size(),
+		Action: dryRunAction,
+	})
+}
+
+// RemoveManifest writes the entry of a manifest, with the tags whose index
+// has an entry for it among the given tags.
+func (d *DryRunDeleter) RemoveManifest(name string, dgst digest.Digest, tags []string) error {
+	var indexed []string
+	for _, tag := range tags {
+		tagsPath, err := pathFor(manifestTagIndexEntryPathSpec{name: name, revision: dgst, tag: tag})
+		if err != nil {
+			return err
+		}
+
+		_, err = d.driver.Stat(d.ctx, tagsPath)
+		if err != nil {
+			switch err := err.(type) {
+			case driver.PathNotFoundError:
+				continue
+			default:
+				return err
+			}
+		}
+		indexed = append(indexed, tag)
+	}
+
+	return d.write(dryRunManifest{
+		Type:       "manifest",
+		Repository: name,
+		Digest:     dgst,
+		Tags:       indexed,
+		Action:     dryRunAction,
+	})
+}
+
+// RemoveTagIndexEntry writes the entry of an entry of the index of a tag.
+func (d *DryRunDeleter) RemoveTagIndexEntry(name, tag string, dgst digest.Digest) error {
+	return d.write(dryRunTagIndexEntry{
+		Type:       "tag_index_entry",
+		Repository: name,
+		Tag:        tag,
+		Digest:     dgst,
+		Action:     dryRunAction,
+	})
+}
+
+// RemoveTag writes the entry of a tag.
+func (d *DryRunDeleter) RemoveTag(name, tag string) error {
+	return d.write(dryRunTag{
+		Type:       "tag",
+		Repository: name,
+		Tag:        tag,
+		Action:     dryRunAction,
+	})
+}
+
+func (d *DryRunDeleter) write(entry interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.enc.Encode(entry)
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestMarkAndSweepDryRunOutput(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "dryrun")
+	manifestService, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := testutil.CreateRandomLayers(3)
+	if err != nil {
+		t.Fatalf("failed to make layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(repo, layers); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+	manifest, err := testutil.MakeSchema1Manifest(getKeys(layers))
+	if err != nil {
+		t.Fatalf("failed to make manifest: %v", err)
+	}
+	// The manifest is untagged, which makes it and its layers unreachable.
+	manifestDigest, err := manifestService.Put(ctx, manifest)
+	if err != nil {
+		t.Fatalf("manifest upload failed: %v", err)
+	}
+	unreachable := make(map[digest.Digest]struct{})
+	unreachable[manifestDigest] = struct{}{}
+	for dgst := range layers {
+		unreachable[dgst] = struct{}{}
+	}
+
+	tagged, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("failed to make layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(repo, tagged); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+	taggedManifest, err := testutil.MakeSchema1Manifest(getKeys(tagged))
+	if err != nil {
+		t.Fatalf("failed to make manifest: %v", err)
+	}
+	taggedDigest, err := manifestService.Put(ctx, taggedManifest)
+	if err != nil {
+		t.Fatalf("manifest upload failed: %v", err)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: taggedDigest}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := allBlobs(t, registry)
+
+	var out bytes.Buffer
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         true,
+		DryRunOutput:   &out,
+		RemoveUntagged: true,
+		SweepWorkers:   4,
+	})
+	if err != nil {
+		t.Fatalf("failed mark and sweep: %v", err)
+	}
+
+	after := allBlobs(t, registry)
+	if len(before) != len(after) {
+		t.Fatalf("dry run affected blob storage: %d != %d", len(before), len(after))
+	}
+	if _, err := manifestService.Get(ctx, manifestDigest); err != nil {
+		t.Fatalf("dry run affected manifest storage: %v", err)
+	}
+
+	type entry struct {
+		Type       string
+		Repository string
+		Digest     digest.Digest
+		Size       *int64
+		Action     string
+	}
+	blobs := make(map[digest.Digest]int64)
+	var manifests []digest.Digest
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("unexpected line %q: %v", scanner.Text(), err)
+		}
+		if e.Action != "would_delete" {
+			t.Fatalf("unexpected action of line %q", scanner.Text())
+		}
+		switch e.Type {
+		case "blob":
+			if e.Size == nil {
+				t.Fatalf("expected a size in line %q", scanner.Text())
+			}
+			blobs[e.Digest] = *e.Size
+		case "manifest":
+			if e.Repository != "dryrun" {
+				t.Fatalf("unexpected repository in line %q", scanner.Text())
+			}
+			manifests = append(manifests, e.Digest)
+		default:
+			t.Fatalf("unexpected type of line %q", scanner.Text())
+		}
+	}
+
+	if len(manifests) != 1 || manifests[0] != manifestDigest {
+		t.Fatalf("expected manifest %s to be reported, got %v", manifestDigest, manifests)
+	}
+	if len(blobs) != len(unreachable) {
+		t.Fatalf("expected the %d unreachable blobs to be reported, got %d", len(unreachable), len(blobs))
+	}
+	for dgst := range unreachable {
+		size, ok := blobs[dgst]
+		if !ok {
+			t.Fatalf("expected blob %s to be reported", dgst)
+		}
+		desc, err := registry.BlobStatter().Stat(ctx, dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != desc.Size {
+			t.Fatalf("unexpected size of blob %s: %d != %d", dgst, size, desc.Size)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultBlobExistenceCacheTTL is the time the existence of a blob is cached
+// by default.
+const DefaultBlobExistenceCacheTTL = 60 * time.Second
+
+// existenceCacheMaxEntries is the number of entries past which the expired
+// ones are dropped.
+const existenceCacheMaxEntries = 10000
+
+// existenceCache coalesces the concurrent existence checks of the same blob
+// link, such as those of the layers shared by the images of a parallel push,
+// into a single check against the storage. The descriptors of the blobs
+// found are cached for ttl, while missing blobs are checked again every
+// time, for uploads to complete.
+type existenceCache struct {
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]existenceEntry
+	// calls holds the sequence number of the check in flight for each
+	// link, which an invalidation removes.
+	calls map[string]uint64
+	seq   uint64
+}
+
+// existenceEntry is the cached descriptor of a blob found by a check.
+type existenceEntry struct {
+	desc    distribution.Descriptor
+	expires time.Time
+}
+
+func newExistenceCache(ttl time.Duration) *existenceCache {
+	if ttl <= 0 {
+		ttl = DefaultBlobExistenceCacheTTL
+	}
+	return &existenceCache{
+		ttl:     ttl,
+		entries: make(map[string]existenceEntry),
+		calls:   make(map[string]uint64),
+	}
+}
+
+// stat returns the descriptor of the blob linked at linkPath, either cached,
+// from a check in flight, or from stat. The check runs on a context detached
+// from the cancellation of the callers, such that a caller giving up does not
+// fail the others waiting on the same check.
+func (c *existenceCache) stat(ctx context.Context, linkPath string, stat func(context.Context) (distribution.Descriptor, error)) (distribution.Descriptor, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[linkPath]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.desc, nil
+	}
+	c.mu.Unlock()
+
+	ch := c.group.DoChan(linkPath, func() (interface{}, error) {
+		return c.check(detachedContext{ctx}, linkPath, stat)
+	})
+	select {
+	case result := <-ch:
+		if result.Err != nil {
+			return distribution.Descriptor{}, result.Err
+		}
+		return result.Val.(distribution.Descriptor), nil
+	case <-ctx.Done():
+		return distribution.Descriptor{}, ctx.Err()
+	}
+}
+
+// check runs the existence check of the blob linked at linkPath and caches
+// the descriptor found.
+func (c *existenceCache) check(ctx context.Context, linkPath string, stat func(context.Context) (distribution.Descriptor, error)) (distribution.Descriptor, error) {
+	c.mu.Lock()
+	c.seq++
+	seq := c.seq
+	c.calls[linkPath] = seq
+	c.mu.Unlock()
+
+	desc, err := stat(ctx)
+
+	c.mu.Lock()
+	// The result of a check invalidated meanwhile is not cached, as it may
+	// predate the change of the link.
+	if call, ok := c.calls[linkPath]; ok && call == seq {
+		delete(c.calls, linkPath)
+		if err == nil {
+			c.store(linkPath, desc)
+		}
+	}
+	c.mu.Unlock()
+	return desc, err
+}
+
+// store caches desc for linkPath. The caller must hold the lock.
+func (c *existenceCache) store(linkPath string, desc distribution.Descriptor) {
+	now := time.Now()
+	if len(c.entries) >= existenceCacheMaxEntries {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= existenceCacheMaxEntries {
+			c.entries = make(map[string]existenceEntry)
+		}
+	}
+	c.entries[linkPath] = existenceEntry{desc: desc, expires: now.Add(c.ttl)}
+}
+
+// invalidate drops what is known of the blob linked at linkPath, after the
+// link was written or removed.
+func (c *existenceCache) invalidate(linkPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, linkPath)
+	delete(c.calls, linkPath)
+	// Checks started from now on do not join the one in flight.
+	c.group.Forget(linkPath)
+}
+
+// detachedContext carries the values of its parent, without its deadline and
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bytes"
+	stdcontext "context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+// layerLinkCountingDriver counts the reads of the links of layers, which take
+// latency, as on a remote storage, and fail if their context is done by then.
+type layerLinkCountingDriver struct {
+	driver.StorageDriver
+	latency time.Duration
+	reads   int32
+}
+
+func (d *layerLinkCountingDriver) GetContent(ctx stdcontext.Context, path string) ([]byte, error) {
+	if strings.Contains(path, "/_layers/") && strings.HasSuffix(path, "/link") {
+		atomic.AddInt32(&d.reads, 1)
+		time.Sleep(d.latency)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func (d *layerLinkCountingDriver) linkReads() int {
+	return int(atomic.LoadInt32(&d.reads))
+}
+
+func newExistenceCacheBlobs(t testing.TB, d driver.StorageDriver, options ...RegistryOption) distribution.BlobStore {
+	t.Helper()
+	ctx := context.Background()
+	ns, err := NewRegistry(ctx, d, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, err := reference.WithName("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := ns.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo.Blobs(ctx)
+}
+
+// statConcurrently checks the existence of the blob dgst from n goroutines
+// at once.
+func statConcurrently(blobs distribution.BlobStore, dgst distribution.Descriptor, n int) []error {
+	ctx := context.Background()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := range errs {
+		go func(i int) {
+			defer wg.Done()
+			desc, err := blobs.Stat(ctx, dgst.Digest)
+			if err == nil && desc.Digest != dgst.Digest {
+				err = distribution.ErrBlobUnknown
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestBlobExistenceCacheCoalescesChecks(t *testing.T) {
+	ctx := context.Background()
+	d := &layerLinkCountingDriver{StorageDriver: inmemory.New(), latency: 50 * time.Millisecond}
+	blobs := newExistenceCacheBlobs(t, d, BlobExistenceCache(0))
+	desc, err := blobs.Put(ctx, "application/octet-stream", []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := d.linkReads()
+	for _, err := range statConcurrently(blobs, desc, 50) {
+		if err != nil {
+			t.Fatalf("unexpected error checking blob: %v", err)
+		}
+	}
+	if reads := d.linkReads() - before; reads != 1 {
+		t.Fatalf("expected the concurrent checks to read the link once, got %d reads", reads)
+	}
+
+	// The blob found is cached.
+	if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if reads := d.linkReads() - before; reads != 1 {
+		t.Fatalf("expected the blob found to be cached, got %d reads", reads)
+	}
+}
+
+func TestBlobExistenceCacheCancelledCaller(t *testing.T) {
+	ctx := context.Background()
+	d := &layerLinkCountingDriver{StorageDriver: inmemory.New(), latency: 100 * time.Millisecond}
+	blobs := newExistenceCacheBlobs(t, d, BlobExistenceCache(0))
+	desc, err := blobs.Put(ctx, "application/octet-stream", []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first caller gives up while the check it started is in flight,
+	// which does not fail the caller waiting on the same check.
+	cancelled, cancel := stdcontext.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := blobs.Stat(cancelled, desc.Digest)
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	before := d.linkReads()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("unexpected error checking blob after the first caller gave up: %v", err)
+	}
+	if err := <-errc; err != stdcontext.Canceled {
+		t.Fatalf("expected the first caller to be cancelled, got %v", err)
+	}
+	if reads := d.linkReads() - before; reads != 0 {
+		t.Fatalf("expected the check in flight to be shared, got %d more reads", reads)
+	}
+}
+
+func TestBlobExistenceCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	d := &layerLinkCountingDriver{StorageDriver: inmemory.New()}
+	blobs := newExistenceCacheBlobs(t, d, BlobExistenceCache(time.Hour), EnableDelete)
+	content := []byte("layer")
+
+	// Missing blobs are not cached.
+	dgst := distribution.Descriptor{Digest: "sha256:3d0bfb49ae32b1b408994517e0075fcce9fb2d4d6f8bffd133cbc2e08f9efc7c"}
+	if _, err := blobs.Stat(ctx, dgst.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected an unknown blob, got %v", err)
+	}
+	desc, err := blobs.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("expected the pushed blob to exist, got %v", err)
+	}
+
+	// Linking the blob again invalidates its cached existence.
+	before := d.linkReads()
+	if _, err := blobs.Put(ctx, "application/octet-stream", content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if d.linkReads() == before {
+		t.Fatal("expected the existence of the blob linked again to be checked")
+	}
+
+	if err := blobs.Delete(ctx, desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected the deleted blob to be unknown, got %v", err)
+	}
+}
+
+func TestBlobExistenceCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	d := &layerLinkCountingDriver{StorageDriver: inmemory.New()}
+	blobs := newExistenceCacheBlobs(t, d, BlobExistenceCache(10*time.Millisecond))
+	desc, err := blobs.Put(ctx, "application/octet-stream", []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := d.linkReads()
+	for i := 0; i < 2; i++ {
+		if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if reads := d.linkReads() - before; reads != 2 {
+		t.Fatalf("expected the existence to be checked again once expired, got %d reads", reads)
+	}
+}
+
+func BenchmarkBlobExistenceCheck(b *testing.B) {
+	const goroutines = 50
+	for _, bench := range []struct {
+		name    string
+		options []RegistryOption
+	}{
+		{"uncached", nil},
+		{"cached", []RegistryOption{BlobExistenceCache(0)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			d := &layerLinkCountingDriver{StorageDriver: inmemory.New(), latency: time.Millisecond}
+			blobs := newExistenceCacheBlobs(b, d, bench.options...)
+			desc, err := blobs.Put(context.Background(), "application/octet-stream", bytes.Repeat([]byte("layer"), 1024))
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			before := d.linkReads()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, err := range statConcurrently(blobs, desc, goroutines) {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(d.linkReads()-before)/float64(b.N), "reads/op")
+		})
+	}
+}
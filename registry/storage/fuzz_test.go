@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// countingDriver counts the calls reaching the storage driver it wraps, and
+// separately those reading content.
+type countingDriver struct {
+	storagedriver.StorageDriver
+	calls int64
+	reads int64
+}
+
+func (d *countingDriver) count() {
+	atomic.AddInt64(&d.calls, 1)
+}
+
+func (d *countingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	d.count()
+	atomic.AddInt64(&d.reads, 1)
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func (d *countingDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	d.count()
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+func (d *countingDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	d.count()
+	atomic.AddInt64(&d.reads, 1)
+	return d.StorageDriver.Reader(ctx, path, offset)
+}
+
+func (d *countingDriver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	d.count()
+	return d.StorageDriver.Writer(ctx, path, append)
+}
+
+func (d *countingDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	d.count()
+	return d.StorageDriver.Stat(ctx, path)
+}
+
+func (d *countingDriver) List(ctx context.Context, path string) ([]string, error) {
+	d.count()
+	return d.StorageDriver.List(ctx, path)
+}
+
+func (d *countingDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	d.count()
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+func (d *countingDriver) Delete(ctx context.Context, path string) error {
+	d.count()
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+func (d *countingDriver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
+	d.count()
+	return d.StorageDriver.Walk(ctx, path, f)
+}
+
+// FuzzTagStoreInvalidTag checks invalid tags are rejected by the tag store
+// with an ErrTagInvalid, without reaching the storage driver.
+func FuzzTagStoreInvalidTag(f *testing.F) {
+	for _, seed := range []string{"latest", "foo bar", "", ".hidden", "-dash", "../escape", "a/b", strings.Repeat("a", 129), "\x00"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, tag string) {
+		if anchoredTagRegexp.MatchString(tag) {
+			return
+		}
+
+		ctx := context.Background()
+		d := &countingDriver{StorageDriver: inmemory.New()}
+		reg, err := NewRegistry(ctx, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		named, _ := reference.WithName("a/b")
+		repo, err := reg.Repository(ctx, named)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := repo.Tags(ctx)
+
+		desc := distribution.Descriptor{Digest: digest.FromString("manifest")}
+		for op, err := range map[string]error{
+			"tag":   ts.Tag(ctx, tag, desc),
+			"get":   func() error { _, err := ts.Get(ctx, tag); return err }(),
+			"untag": ts.Untag(ctx, tag),
+		} {
+			if _, ok := err.(distribution.ErrTagInvalid); !ok {
+				t.Fatalf("unexpected error from %s with invalid tag %q: %v", op, tag, err)
+			}
+		}
+		if calls := atomic.LoadInt64(&d.calls); calls != 0 {
+			t.Fatalf("invalid tag %q reached the storage driver %d times", tag, calls)
+		}
+	})
+}
+
+func FuzzValidateManifestPayload(f *testing.F) {
+	for _, seed := range []string{
+		`{"config":` + validConfig + `,"layers":[` + validLayer + `]}`,
+		`{"manifests":[` + validManifest + `],"subject":` + validManifest + `}`,
+		`{"config":null,"layers":[{}]}`,
+		`{"mediaType":1}`,
+		`[]`,
+		``,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, payload string) {
+		for _, mediaType := range []string{v1.MediaTypeImageManifest, v1.MediaTypeImageIndex} {
+			err := ValidateManifestPayload(mediaType, []byte(payload))
+			if err == nil {
+				continue
+			}
+			if _, ok := err.(distribution.ErrManifestInvalid); !ok {
+				t.Fatalf("unexpected error validating %q as %s: %v", payload, mediaType, err)
+			}
+		}
+	})
+}
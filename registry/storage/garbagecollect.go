@@ -3,21 +3,44 @@ package storage
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/policy"
 	"github.com/opencontainers/go-digest"
 )
 
-func emit(format string, a ...interface{}) {
-	fmt.Printf(format+"\n", a...)
-}
-
 // GCOpts contains options for garbage collector
 type GCOpts struct {
 	DryRun         bool
 	RemoveUntagged bool
+
+	// DryRunOutput is where a dry run writes the JSON stream of the blobs
+	// and manifests it would delete. Nil writes to the standard output.
+	DryRunOutput io.Writer
+
+	// SweepWorkers is the number of blobs deleted concurrently during the
+	// sweep. Values lower than 1 delete blobs one at a time.
+	SweepWorkers int
+
+	// TombstoneTTL is the age after which the tombstones of deleted
+	// manifests are removed. Zero keeps them.
+	TombstoneTTL time.Duration
+
+	// MarkFalsePositiveRate is the rate of unreachable blobs kept because
+	// the mark set reports them as reachable. Zero uses
+	// DefaultMarkFalsePositiveRate.
+	MarkFalsePositiveRate float64
+
+	// TagPolicy, if set, removes the tags it does not retain. The manifests
+	// they referenced are removed with RemoveUntagged, unless tagged
+	// otherwise.
+	TagPolicy policy.TagPolicy
 }
 
 // ManifestDel contains manifest structure which will be deleted
@@ -34,8 +57,35 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
 	}
 
+	falsePositiveRate := opts.MarkFalsePositiveRate
+	if falsePositiveRate == 0 {
+		falsePositiveRate = DefaultMarkFalsePositiveRate
+	}
+	if falsePositiveRate < 0 || falsePositiveRate >= 1 {
+		return fmt.Errorf("invalid mark false positive rate %v", falsePositiveRate)
+	}
+
+	// The progress of a dry run is written to the standard error, which
+	// leaves the standard output to its JSON stream.
+	progress := io.Writer(os.Stdout)
+	if opts.DryRun {
+		progress = os.Stderr
+	}
+	emit := func(format string, a ...interface{}) {
+		fmt.Fprintf(progress, format+"\n", a...)
+	}
+
+	var deleter Deleter = NewVacuum(ctx, storageDriver)
+	if opts.DryRun {
+		out := opts.DryRunOutput
+		if out == nil {
+			out = os.Stdout
+		}
+		deleter = NewDryRunDeleter(ctx, storageDriver, out)
+	}
+
 	// mark
-	markSet := make(map[digest.Digest]struct{})
+	markSet := newMarkSet(falsePositiveRate)
 	manifestArr := make([]ManifestDel, 0)
 	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
 		emit(repoName)
@@ -55,6 +105,22 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 			return fmt.Errorf("failed to construct manifest service: %v", err)
 		}
 
+		tagService := repository.Tags(ctx)
+		if opts.TagPolicy != nil {
+			policyTags, err := NewPolicyTagStore(ctx, repository, storageDriver, opts.TagPolicy)
+			if err != nil {
+				return fmt.Errorf("failed to evaluate the tag policy: %v", err)
+			}
+			// Locked tags are never expired, and keep their manifests.
+			for _, tag := range policyTags.Expired() {
+				emit("%s: tag %s not retained by the tag policy", repoName, tag)
+				if err := deleter.RemoveTag(repoName, tag); err != nil {
+					return fmt.Errorf("failed to delete tag %s: %v", tag, err)
+				}
+			}
+			tagService = policyTags
+		}
+
 		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
 		if !ok {
 			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
@@ -63,7 +129,7 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
 			if opts.RemoveUntagged {
 				// fetch all tags where this manifest is the latest one
-				tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+				tags, err := tagService.Lookup(ctx, distribution.Descriptor{Digest: dgst})
 				if err != nil {
 					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
 				}
@@ -72,7 +138,7 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 					// fetch all tags from repository
 					// all of these tags could contain manifest in history
 					// which means that we need check (and delete) those references when deleting manifest
-					allTags, err := repository.Tags(ctx).All(ctx)
+					allTags, err := tagService.All(ctx)
 					if err != nil {
 						return fmt.Errorf("failed to retrieve tags %v", err)
 					}
@@ -82,7 +148,7 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 			}
 			// Mark the manifest's blob
 			emit("%s: marking manifest %s ", repoName, dgst)
-			markSet[dgst] = struct{}{}
+			markSet.add(dgst)
 
 			manifest, err := manifestService.Get(ctx, dgst)
 			if err != nil {
@@ -91,7 +157,7 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 
 			descriptors := manifest.References()
 			for _, descriptor := range descriptors {
-				markSet[descriptor.Digest] = struct{}{}
+				markSet.add(descriptor.Digest)
 				emit("%s: marking blob %s", repoName, descriptor.Digest)
 			}
 
@@ -104,48 +170,122 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		//
 		// In these cases we can continue marking other manifests safely.
 		if _, ok := err.(driver.PathNotFoundError); ok {
-			return nil
+			err = nil
+		}
+		if err != nil || opts.TombstoneTTL <= 0 {
+			return err
 		}
 
+		expired, err := removeExpiredTombstones(ctx, storageDriver, repoName, opts.TombstoneTTL, opts.DryRun)
+		for _, dgst := range expired {
+			emit("%s: tombstone of manifest %s expired", repoName, dgst)
+		}
 		return err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to mark: %v", err)
 	}
+	emit("\nmark set of %d blobs uses %d bytes, against about %d bytes for a map", markSet.len(), markSet.size(), markSet.mapSize())
 
 	// sweep
-	vacuum := NewVacuum(ctx, storageDriver)
-	if !opts.DryRun {
-		for _, obj := range manifestArr {
-			err = vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
-			if err != nil {
-				return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
-			}
+	for _, obj := range manifestArr {
+		err = deleter.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
 		}
 	}
-	blobService := registry.Blobs()
-	deleteSet := make(map[digest.Digest]struct{})
-	err = blobService.Enumerate(ctx, func(dgst digest.Digest) error {
-		// check if digest is in markSet. If not, delete it!
-		if _, ok := markSet[dgst]; !ok {
-			deleteSet[dgst] = struct{}{}
+	summary, sweepErr := sweepBlobs(ctx, storageDriver, deleter, markSet.contains, opts.SweepWorkers)
+	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", markSet.len(), summary.Eligible, len(manifestArr))
+	if opts.DryRun {
+		emit("%d blobs would be deleted", summary.Deleted)
+	} else {
+		emit("%d blobs deleted", summary.Deleted)
+	}
+
+	// The entries of the tag indexes referencing manifests deleted by digest
+	// are left behind: remove those whose revision is gone.
+	removed := 0
+	err = repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		entries, err := orphanedTagIndexEntries(ctx, storageDriver, repoName, markSet.contains)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := deleter.RemoveTagIndexEntry(repoName, entry.tag, entry.digest); err != nil {
+				return fmt.Errorf("failed to delete index entry %s of tag %s: %v", entry.digest, entry.tag, err)
+			}
+			removed++
 		}
 		return nil
 	})
+	if opts.DryRun {
+		emit("%d orphaned tag index entries would be deleted", removed)
+	} else {
+		emit("%d orphaned tag index entries deleted", removed)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clean tag indexes: %v", err)
+	}
+	return sweepErr
+}
+
+// tagIndexEntry is an entry of the index of a tag.
+type tagIndexEntry struct {
+	tag    string
+	digest digest.Digest
+}
+
+// orphanedTagIndexEntries returns the entries of the tag indexes of the
+// repository name whose revision is not marked, or whose blob is missing
+// from the blob store.
+func orphanedTagIndexEntries(ctx context.Context, d driver.StorageDriver, name string, marked func(digest.Digest) bool) ([]tagIndexEntry, error) {
+	root, err := pathFor(manifestTagsPathSpec{name: name})
 	if err != nil {
-		return fmt.Errorf("error enumerating blobs: %v", err)
+		return nil, err
 	}
-	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), len(manifestArr))
-	for dgst := range deleteSet {
-		emit("blob eligible for deletion: %s", dgst)
-		if opts.DryRun {
-			continue
+
+	// Walk first, as drivers may not support deletions while walking.
+	var entries []tagIndexEntry
+	err = d.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		// <tag>/index/<algorithm>/<hex digest>/link
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
 		}
-		err = vacuum.RemoveBlob(string(dgst))
-		if err != nil {
-			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+		dir := path.Dir(fileInfo.Path())
+		algorithmDir := path.Dir(dir)
+		indexDir := path.Dir(algorithmDir)
+		if path.Base(indexDir) != "index" {
+			return nil
 		}
+		dgst := digest.NewDigestFromEncoded(digest.Algorithm(path.Base(algorithmDir)), path.Base(dir))
+		if dgst.Validate() == nil {
+			entries = append(entries, tagIndexEntry{tag: path.Base(path.Dir(indexDir)), digest: dgst})
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	var orphaned []tagIndexEntry
+	for _, entry := range entries {
+		if marked(entry.digest) {
+			blobPath, err := pathFor(blobDataPathSpec{digest: entry.digest})
+			if err != nil {
+				return nil, err
+			}
+			_, err = d.Stat(ctx, blobPath)
+			if err == nil {
+				continue
+			}
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				return nil, err
+			}
+		}
+		orphaned = append(orphaned, entry)
+	}
+	return orphaned, nil
 }
@@ -1,15 +1,22 @@
 package storage
 
 import (
+	stdcontext "context"
+	"crypto/rand"
+	"fmt"
 	"io"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bits-and-blooms/bloom/v3"
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/registry/storage/policy"
 	"github.com/distribution/distribution/v3/testutil"
 	"github.com/docker/libtrust"
 	"github.com/opencontainers/go-digest"
@@ -297,6 +304,109 @@ func TestDeleteManifestIfTagNotFound(t *testing.T) {
 	}
 }
 
+func TestTagPolicyRemovesTags(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "policy")
+	manifestService := makeManifestService(t, repo)
+
+	kept := uploadRandomSchema2Image(t, repo)
+	expired := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: kept.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Tags(ctx).Tag(ctx, "nightly", distribution.Descriptor{Digest: expired.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+
+	tagPolicy, err := policy.KeepMatchingPattern("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         true,
+		DryRunOutput:   &out,
+		RemoveUntagged: true,
+		TagPolicy:      tagPolicy,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if !strings.Contains(out.String(), `{"type":"tag","repository":"policy","tag":"nightly","action":"would_delete"}`) {
+		t.Errorf("expected the dry run to report the expired tag, got %s", out.String())
+	}
+	if !strings.Contains(out.String(), `"digest":"`+expired.manifestDigest.String()+`"`) {
+		t.Errorf("expected the dry run to report the manifest of the expired tag, got %s", out.String())
+	}
+	if tags, err := repo.Tags(ctx).All(ctx); err != nil || len(tags) != 2 {
+		t.Fatalf("expected the dry run to keep the tags, got %v, %v", tags, err)
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		TagPolicy:      tagPolicy,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	tags, err := repo.Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "latest" {
+		t.Fatalf("expected only the latest tag to be retained, got %v", tags)
+	}
+	manifests := allManifests(t, manifestService)
+	if _, ok := manifests[kept.manifestDigest]; !ok {
+		t.Error("expected the manifest of the retained tag to be kept")
+	}
+	if _, ok := manifests[expired.manifestDigest]; ok {
+		t.Error("expected the manifest of the expired tag to be deleted")
+	}
+}
+
+func TestTagPolicyKeepsLockedTags(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "policy")
+	manifestService := makeManifestService(t, repo)
+
+	locked := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "nightly", distribution.Descriptor{Digest: locked.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockTag(ctx, inmemoryDriver, "policy", "nightly"); err != nil {
+		t.Fatal(err)
+	}
+
+	tagPolicy, err := policy.KeepMatchingPattern("latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		TagPolicy:      tagPolicy,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	tags, err := repo.Tags(ctx).All(ctx)
+	if err != nil || len(tags) != 1 || tags[0] != "nightly" {
+		t.Fatalf("expected the locked tag to be retained, got %v, %v", tags, err)
+	}
+	if _, ok := allManifests(t, manifestService)[locked.manifestDigest]; !ok {
+		t.Error("expected the manifest of the locked tag to be kept")
+	}
+}
+
 func TestGCWithMissingManifests(t *testing.T) {
 	ctx := context.Background()
 	d := inmemory.New()
@@ -382,6 +492,83 @@ func TestDeletionHasEffect(t *testing.T) {
 	}
 }
 
+func TestOrphanedTagIndexEntriesDeleted(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "orphans")
+	manifests, _ := repo.Manifests(ctx)
+	tags := repo.Tags(ctx)
+
+	image1 := uploadRandomSchema2Image(t, repo)
+	image2 := uploadRandomSchema2Image(t, repo)
+	for _, tagged := range []struct {
+		tag  string
+		dgst digest.Digest
+	}{
+		{"old", image1.manifestDigest},
+		{"latest", image1.manifestDigest},
+		{"latest", image2.manifestDigest},
+	} {
+		if err := tags.Tag(ctx, tagged.tag, distribution.Descriptor{Digest: tagged.dgst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manifests.Delete(ctx, image1.manifestDigest); err != nil {
+		t.Fatal(err)
+	}
+
+	entryExists := func(tag string, dgst digest.Digest) bool {
+		t.Helper()
+		linkPath, err := pathFor(manifestTagIndexEntryLinkPathSpec{name: "orphans", tag: tag, revision: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = inmemoryDriver.Stat(ctx, linkPath)
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+
+	var out strings.Builder
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:       true,
+		DryRunOutput: &out,
+	})
+	if err != nil {
+		t.Fatalf("failed mark and sweep: %v", err)
+	}
+	for _, tag := range []string{"old", "latest"} {
+		line := fmt.Sprintf(`{"type":"tag_index_entry","repository":"orphans","tag":"%s","digest":"%s","action":"would_delete"}`, tag, image1.manifestDigest)
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Fatalf("expected the dry run to report the index entry of tag %s, got:\n%s", tag, out.String())
+		}
+		if !entryExists(tag, image1.manifestDigest) {
+			t.Fatalf("dry run deleted the index entry of tag %s", tag)
+		}
+	}
+	if strings.Contains(out.String(), string(image2.manifestDigest)) {
+		t.Fatalf("unexpected report of the tagged manifest:\n%s", out.String())
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{})
+	if err != nil {
+		t.Fatalf("failed mark and sweep: %v", err)
+	}
+	for _, tag := range []string{"old", "latest"} {
+		if entryExists(tag, image1.manifestDigest) {
+			t.Fatalf("expected the orphaned index entry of tag %s to be deleted", tag)
+		}
+	}
+	if !entryExists("latest", image2.manifestDigest) {
+		t.Fatal("expected the index entry of the tagged manifest to be kept")
+	}
+}
+
 func getAnyKey(digests map[digest.Digest]io.ReadSeeker) (d digest.Digest) {
 	for d = range digests {
 		break
@@ -501,3 +688,182 @@ func TestOrphanBlobDeleted(t *testing.T) {
 		}
 	}
 }
+
+// sweepDriver wraps a storage driver, delaying deletes by latency and failing
+// the deletion of the paths in failing.
+type sweepDriver struct {
+	driver.StorageDriver
+	latency time.Duration
+	failing map[string]struct{}
+}
+
+func (d *sweepDriver) Delete(ctx stdcontext.Context, path string) error {
+	time.Sleep(d.latency)
+	if _, ok := d.failing[path]; ok {
+		return fmt.Errorf("delete %s: permission denied", path)
+	}
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+// putBlobs writes n random blobs to the blob store of d, and returns their
+// digests.
+func putBlobs(tb testing.TB, d driver.StorageDriver, n int) []digest.Digest {
+	ctx := context.Background()
+	digests := make([]digest.Digest, 0, n)
+	for i := 0; i < n; i++ {
+		p := make([]byte, 16)
+		if _, err := rand.Read(p); err != nil {
+			tb.Fatal(err)
+		}
+		dgst := digest.FromBytes(p)
+		blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := d.PutContent(ctx, blobPath, p); err != nil {
+			tb.Fatal(err)
+		}
+		digests = append(digests, dgst)
+	}
+	return digests
+}
+
+func TestSweepBlobs(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	digests := putBlobs(t, inmemoryDriver, 20)
+
+	reachable := make(map[digest.Digest]struct{})
+	for _, dgst := range digests[:5] {
+		reachable[dgst] = struct{}{}
+	}
+
+	summary, err := NewVacuum(ctx, inmemoryDriver).SweepBlobs(ctx, reachable, 4)
+	if err != nil {
+		t.Fatalf("unexpected error sweeping blobs: %v", err)
+	}
+	if summary.Eligible != 15 || summary.Deleted != 15 || len(summary.Failed) != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	remaining := make(map[digest.Digest]struct{})
+	err = (&blobStore{driver: inmemoryDriver}).Enumerate(ctx, func(dgst digest.Digest) error {
+		remaining[dgst] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error enumerating blobs: %v", err)
+	}
+	if len(remaining) != len(reachable) {
+		t.Fatalf("expected %d remaining blobs, got %d", len(reachable), len(remaining))
+	}
+	for dgst := range reachable {
+		if _, ok := remaining[dgst]; !ok {
+			t.Fatalf("reachable blob %s was deleted", dgst)
+		}
+	}
+}
+
+func TestSweepBlobsKeepsFalsePositives(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	digests := putBlobs(t, inmemoryDriver, 40)
+
+	// A mark set of a single small filter, which reports many of the
+	// unreachable blobs as reachable.
+	ms := &markSet{filters: []*bloom.BloomFilter{newBloomFilter(1, 0.5)}, capacity: len(digests)}
+	reachable := digests[:20]
+	for _, dgst := range reachable {
+		ms.add(dgst)
+	}
+	var falsePositives int
+	for _, dgst := range digests[20:] {
+		if ms.contains(dgst) {
+			falsePositives++
+		}
+	}
+	if falsePositives == 0 {
+		t.Fatal("expected the mark set to report unreachable blobs as reachable")
+	}
+
+	summary, err := sweepBlobs(ctx, inmemoryDriver, NewVacuum(ctx, inmemoryDriver), ms.contains, 4)
+	if err != nil {
+		t.Fatalf("unexpected error sweeping blobs: %v", err)
+	}
+	if summary.Deleted != len(digests)-len(reachable)-falsePositives {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	remaining := make(map[digest.Digest]struct{})
+	err = (&blobStore{driver: inmemoryDriver}).Enumerate(ctx, func(dgst digest.Digest) error {
+		remaining[dgst] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error enumerating blobs: %v", err)
+	}
+	for _, dgst := range reachable {
+		if _, ok := remaining[dgst]; !ok {
+			t.Fatalf("reachable blob %s was deleted", dgst)
+		}
+	}
+}
+
+func TestSweepBlobsCollectsErrors(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	digests := putBlobs(t, inmemoryDriver, 10)
+
+	failing := make(map[string]struct{})
+	for _, dgst := range digests[:3] {
+		blobPath, err := pathFor(blobPathSpec{digest: dgst})
+		if err != nil {
+			t.Fatal(err)
+		}
+		failing[blobPath] = struct{}{}
+	}
+	d := &sweepDriver{StorageDriver: inmemoryDriver, failing: failing}
+
+	summary, err := NewVacuum(ctx, d).SweepBlobs(ctx, nil, 4)
+	if err == nil {
+		t.Fatal("expected an error sweeping blobs")
+	}
+	sweepErr, ok := err.(SweepError)
+	if !ok {
+		t.Fatalf("expected a SweepError, got %T", err)
+	}
+	if len(sweepErr.Failed) != 3 {
+		t.Fatalf("expected 3 failed deletions, got %d", len(sweepErr.Failed))
+	}
+	for _, dgst := range digests[:3] {
+		if _, ok := summary.Failed[dgst]; !ok {
+			t.Fatalf("expected deletion of %s to fail", dgst)
+		}
+		if !strings.Contains(err.Error(), dgst.String()) {
+			t.Fatalf("expected error to mention %s: %v", dgst, err)
+		}
+	}
+
+	// A failed deletion does not stop the others.
+	if summary.Deleted != 7 {
+		t.Fatalf("expected 7 deleted blobs, got %d", summary.Deleted)
+	}
+}
+
+func BenchmarkSweepBlobs(b *testing.B) {
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				d := &sweepDriver{StorageDriver: inmemory.New(), latency: time.Millisecond}
+				putBlobs(b, d, 100)
+				b.StartTimer()
+
+				if _, err := NewVacuum(ctx, d).SweepBlobs(ctx, nil, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
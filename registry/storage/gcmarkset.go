@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/opencontainers/go-digest"
+)
+
+// DefaultMarkFalsePositiveRate is the rate of unreachable blobs the mark set
+// of the garbage collector reports as reachable, unless set in GCOpts.
+const DefaultMarkFalsePositiveRate = 0.001
+
+// minMarkSetCapacity is the number of blobs the first bloom filter of a mark
+// set is sized for.
+const minMarkSetCapacity = 1 << 16
+
+// markMapEntryOverhead is the estimated number of bytes a map of digests
+// uses for each entry, besides the digest itself: the string header and the
+// share of its bucket.
+const markMapEntryOverhead = 24
+
+// markSet is the set of the blobs marked reachable by the garbage collector.
+// It is kept in bloom filters rather than in a map, which on registries with
+// millions of blobs takes gigabytes. A blob wrongly reported as reachable,
+// at a rate of at most falsePositiveRate, is kept rather than deleted.
+//
+// The number of blobs is not known up front: once a filter is full, a filter
+// twice as large is added, with half the false positive rate, which keeps the
+// rate of the whole set under falsePositiveRate.
+type markSet struct {
+	filters           []*bloom.BloomFilter
+	capacity          int     // of the last filter
+	count             int     // in the last filter
+	falsePositiveRate float64 // of the last filter
+
+	// marked is the number of blobs marked and digestBytes the size of
+	// their digests, to estimate the size of a map of them.
+	marked      int
+	digestBytes int
+}
+
+func newMarkSet(falsePositiveRate float64) *markSet {
+	return &markSet{
+		falsePositiveRate: falsePositiveRate,
+	}
+}
+
+// add marks the blob dgst.
+func (ms *markSet) add(dgst digest.Digest) {
+	if ms.contains(dgst) {
+		return
+	}
+	if len(ms.filters) == 0 || ms.count >= ms.capacity {
+		if len(ms.filters) == 0 {
+			ms.capacity = minMarkSetCapacity
+		} else {
+			ms.capacity *= 2
+		}
+		ms.falsePositiveRate /= 2
+		ms.filters = append(ms.filters, newBloomFilter(ms.capacity, ms.falsePositiveRate))
+		ms.count = 0
+	}
+	ms.filters[len(ms.filters)-1].AddString(dgst.String())
+	ms.count++
+	ms.marked++
+	ms.digestBytes += len(dgst)
+}
+
+// contains reports whether the blob dgst may have been marked. False means
+// dgst was definitely not marked.
+func (ms *markSet) contains(dgst digest.Digest) bool {
+	for _, bf := range ms.filters {
+		if bf.TestString(dgst.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// len returns the number of blobs marked, which may miss a few blobs
+// reported as marked before they were.
+func (ms *markSet) len() int {
+	return ms.marked
+}
+
+// size returns the number of bytes the bloom filters of the set use.
+func (ms *markSet) size() int {
+	var size int
+	for _, bf := range ms.filters {
+		size += int(bf.Cap() / 8)
+	}
+	return size
+}
+
+// mapSize returns the estimated number of bytes a map of the marked blobs
+// would use.
+func (ms *markSet) mapSize() int {
+	return ms.marked*markMapEntryOverhead + ms.digestBytes
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestMarkSet(t *testing.T) {
+	// Enough blobs to fill the first filters.
+	const n = 3 * minMarkSetCapacity
+	ms := newMarkSet(0.001)
+	for i := 0; i < n; i++ {
+		ms.add(digest.FromString(fmt.Sprintf("blob-%d", i)))
+	}
+	if len(ms.filters) != 2 {
+		t.Fatalf("unexpected number of filters %d, expected 2", len(ms.filters))
+	}
+	for i := 0; i < n; i++ {
+		if !ms.contains(digest.FromString(fmt.Sprintf("blob-%d", i))) {
+			t.Fatalf("false negative for blob %d", i)
+		}
+	}
+
+	const queries = 100000
+	var falsePositives int
+	for i := 0; i < queries; i++ {
+		if ms.contains(digest.FromString(fmt.Sprintf("absent-%d", i))) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / queries; rate >= 0.001 {
+		t.Fatalf("false positive rate %v exceeds 0.1%%", rate)
+	}
+
+	if ms.len() > n || ms.len() < n-n/100 {
+		t.Fatalf("unexpected number of marked blobs %d, expected about %d", ms.len(), n)
+	}
+	if ms.size() >= ms.mapSize()/2 {
+		t.Fatalf("mark set of %d bytes does not save memory over a map of about %d bytes", ms.size(), ms.mapSize())
+	}
+}
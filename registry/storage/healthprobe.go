@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// StorageHealthProber checks the storage driver is able to store content, by
+// writing a probe file, reading it back and deleting it.
+type StorageHealthProber struct {
+	driver       storagedriver.StorageDriver
+	probePath    string
+	probeContent []byte
+}
+
+// NewStorageHealthProber returns a prober of driver. The probe file is named
+// after the host and the process of the registry instance, such that
+// instances sharing the storage do not probe the same file.
+func NewStorageHealthProber(driver storagedriver.StorageDriver) (*StorageHealthProber, error) {
+	instance, err := probeInstance()
+	if err != nil {
+		return nil, err
+	}
+	probePath, err := pathFor(healthProbePathSpec{instance: instance})
+	if err != nil {
+		return nil, err
+	}
+	return newStorageHealthProber(driver, probePath, instance), nil
+}
+
+// NewStorageHealthProberAt returns a prober of driver writing the probe file
+// at probePath, a path of the storage driver. Instances sharing the storage
+// must be given distinct paths, lest a probe deletes the file of another.
+func NewStorageHealthProberAt(driver storagedriver.StorageDriver, probePath string) (*StorageHealthProber, error) {
+	if !storagedriver.PathRegexp.MatchString(probePath) {
+		return nil, storagedriver.InvalidPathError{Path: probePath, DriverName: driver.Name()}
+	}
+	instance, err := probeInstance()
+	if err != nil {
+		return nil, err
+	}
+	return newStorageHealthProber(driver, probePath, instance), nil
+}
+
+// probeInstance returns the name of the registry instance probing the
+// storage, after its host and process.
+func probeInstance() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid()), nil
+}
+
+func newStorageHealthProber(driver storagedriver.StorageDriver, probePath, instance string) *StorageHealthProber {
+	return &StorageHealthProber{
+		driver:       driver,
+		probePath:    probePath,
+		probeContent: []byte(fmt.Sprintf("%s %d", instance, time.Now().UnixNano())),
+	}
+}
+
+// Probe writes the probe file, reads it back and checks its content, then
+// deletes it.
+func (p *StorageHealthProber) Probe(ctx context.Context) error {
+	if err := p.driver.PutContent(ctx, p.probePath, p.probeContent); err != nil {
+		return fmt.Errorf("writing health probe: %v", err)
+	}
+	content, err := p.driver.GetContent(ctx, p.probePath)
+	if err != nil {
+		return fmt.Errorf("reading health probe: %v", err)
+	}
+	if !bytes.Equal(content, p.probeContent) {
+		return fmt.Errorf("health probe read back %q rather than %q", content, p.probeContent)
+	}
+	if err := p.driver.Delete(ctx, p.probePath); err != nil {
+		return fmt.Errorf("deleting health probe: %v", err)
+	}
+	return nil
+}
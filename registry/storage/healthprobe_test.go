@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+// failingWriterDriver fails to write any content.
+type failingWriterDriver struct {
+	driver.StorageDriver
+}
+
+func (d *failingWriterDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	return fmt.Errorf("PutContent error")
+}
+
+// corruptingDriver reads back content other than the content written.
+type corruptingDriver struct {
+	driver.StorageDriver
+}
+
+func (d *corruptingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	return []byte("corrupted"), nil
+}
+
+func TestStorageHealthProber(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	prober, err := NewStorageHealthProber(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(prober.probePath, "/docker/registry/v2/_health/probe-") {
+		t.Fatalf("unexpected probe path %s", prober.probePath)
+	}
+	if err := prober.Probe(ctx); err != nil {
+		t.Fatalf("unexpected error probing storage: %v", err)
+	}
+	// The probe file is removed once checked.
+	if _, err := d.Stat(ctx, prober.probePath); err == nil {
+		t.Fatal("expected the probe file to be deleted")
+	}
+
+	for _, tc := range []struct {
+		driver   driver.StorageDriver
+		expected string
+	}{
+		{&failingWriterDriver{StorageDriver: d}, "writing health probe"},
+		{&corruptingDriver{StorageDriver: d}, "health probe read back"},
+	} {
+		prober, err := NewStorageHealthProber(tc.driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = prober.Probe(ctx)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("expected error %q probing %T, got %v", tc.expected, tc.driver, err)
+		}
+	}
+}
+
+func TestStorageHealthProberAt(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	if _, err := NewStorageHealthProberAt(d, "_health/ping"); err == nil {
+		t.Fatal("expected an error for a relative probe path")
+	}
+
+	prober, err := NewStorageHealthProberAt(d, "/_health/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prober.Probe(ctx); err != nil {
+		t.Fatalf("unexpected error probing storage: %v", err)
+	}
+	if _, err := d.Stat(ctx, "/_health/ping"); err == nil {
+		t.Fatal("expected the probe file to be deleted")
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.BlobURLIngester = &linkedBlobStore{}
+
+// ingestClient is the client used to fetch content for IngestFromURL.
+var ingestClient = http.DefaultClient
+
+// IngestFromURL fetches the content at url and writes it into the blob store
+// through a regular blob upload, so that it is never held in memory. The
+// upload is committed against expected, and cancelled if the content does
+// not match.
+//
+// When the blob is already present in the storage backend, such as when url
+// points at the backend itself, it is linked into the repository without
+// being fetched again.
+func (lbs *linkedBlobStore) IngestFromURL(ctx context.Context, url string, expected digest.Digest) (distribution.Descriptor, error) {
+	if err := expected.Validate(); err != nil {
+		return distribution.Descriptor{}, distribution.ErrBlobInvalidDigest{Digest: expected, Reason: err}
+	}
+
+	desc, err := lbs.blobStore.statter.Stat(ctx, expected)
+	switch err {
+	case nil:
+		desc.MediaType = "application/octet-stream"
+		return desc, lbs.linkBlob(ctx, desc)
+	case distribution.ErrBlobUnknown:
+	default:
+		return distribution.Descriptor{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	resp, err := ingestClient.Do(req)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return distribution.Descriptor{}, fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+
+	bw, err := lbs.Create(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	if _, err := io.Copy(bw, resp.Body); err != nil {
+		lbs.cancelIngest(ctx, bw)
+		return distribution.Descriptor{}, err
+	}
+
+	desc, err = bw.Commit(ctx, distribution.Descriptor{
+		MediaType: "application/octet-stream",
+		Digest:    expected,
+		Size:      resp.ContentLength,
+	})
+	if err != nil {
+		lbs.cancelIngest(ctx, bw)
+		return distribution.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+func (lbs *linkedBlobStore) cancelIngest(ctx context.Context, bw distribution.BlobWriter) {
+	if err := bw.Cancel(ctx); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error cancelling ingest upload %s: %v", bw.ID(), err)
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver/testdriver"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestIngestFromURL(t *testing.T) {
+	ctx := context.Background()
+	rd, dgst, err := testutil.CreateRandomTarFile()
+	if err != nil {
+		t.Fatalf("error creating random data: %v", err)
+	}
+	content, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatalf("error reading random data: %v", err)
+	}
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	ns, err := NewRegistry(ctx, testdriver.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	ingest := func(name string, expected digest.Digest) (distribution.BlobStore, distribution.Descriptor, error) {
+		named, _ := reference.WithName(name)
+		repo, err := ns.Repository(ctx, named)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+		bs := repo.Blobs(ctx)
+		desc, err := bs.(distribution.BlobURLIngester).IngestFromURL(ctx, server.URL, expected)
+		return bs, desc, err
+	}
+
+	// A digest mismatch fails, and leaves nothing behind.
+	bs, _, err := ingest("foo/bar", digest.FromString("something else"))
+	if _, ok := err.(distribution.ErrBlobInvalidDigest); !ok {
+		t.Fatalf("expected invalid digest error, got %v", err)
+	}
+	if _, err := bs.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected blob to be unknown, got %v", err)
+	}
+
+	bs, desc, err := ingest("foo/bar", dgst)
+	if err != nil {
+		t.Fatalf("unexpected error ingesting blob: %v", err)
+	}
+	if desc.Digest != dgst || desc.Size != int64(len(content)) {
+		t.Fatalf("unexpected descriptor: %v", desc)
+	}
+	rc, err := bs.Open(ctx, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error opening ingested blob: %v", err)
+	}
+	p, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("unexpected error reading ingested blob: %v", err)
+	}
+	if !bytes.Equal(p, content) {
+		t.Fatal("ingested content does not match")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("expected 2 fetches, got %d", n)
+	}
+
+	// Content already in storage is linked without being fetched.
+	bs, desc, err = ingest("foo/baz", dgst)
+	if err != nil {
+		t.Fatalf("unexpected error ingesting stored blob: %v", err)
+	}
+	if desc.Digest != dgst || desc.Size != int64(len(content)) {
+		t.Fatalf("unexpected descriptor: %v", desc)
+	}
+	if _, err := bs.Stat(ctx, dgst); err != nil {
+		t.Fatalf("expected blob to be linked: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("expected stored blob not to be fetched, got %d fetches", n)
+	}
+}
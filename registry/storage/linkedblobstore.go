@@ -33,6 +33,10 @@ type linkedBlobStore struct {
 	deleteEnabled          bool
 	resumableDigestEnabled bool
 
+	// compress stores new content gzip compressed. It is only set for
+	// the manifest store.
+	compress bool
+
 	// linkPath allows one to control the repository blob link set to which
 	// the blob store dispatches. This is required because manifest and layer
 	// blobs have not yet been fully merged. At some point, this functionality
@@ -45,8 +49,38 @@ type linkedBlobStore struct {
 
 var _ distribution.BlobStore = &linkedBlobStore{}
 
+// LinkedBlobEnumerator enumerates the blobs linked in a repository. The blob
+// stores of repositories implement it.
+type LinkedBlobEnumerator interface {
+	// Enumerate calls ingestor with the descriptor of each linked blob.
+	Enumerate(ctx context.Context, ingestor func(desc distribution.Descriptor) error) error
+
+	// EnumerateAll returns the descriptors of all linked blobs.
+	EnumerateAll(ctx context.Context) ([]distribution.Descriptor, error)
+}
+
+var _ LinkedBlobEnumerator = &linkedBlobStore{}
+
 func (lbs *linkedBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
-	return lbs.blobAccessController.Stat(ctx, dgst)
+	if lbs.registry == nil || lbs.registry.existenceCache == nil {
+		return lbs.blobAccessController.Stat(ctx, dgst)
+	}
+
+	blobLinkPath, err := lbs.linkPath(lbs.repository.Named().Name(), dgst)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return lbs.registry.existenceCache.stat(ctx, blobLinkPath, func(ctx context.Context) (distribution.Descriptor, error) {
+		return lbs.blobAccessController.Stat(ctx, dgst)
+	})
+}
+
+// invalidateExistence drops the cached existence of the blob linked at
+// blobLinkPath, if any.
+func (lbs *linkedBlobStore) invalidateExistence(blobLinkPath string) {
+	if lbs.registry != nil && lbs.registry.existenceCache != nil {
+		lbs.registry.existenceCache.invalidate(blobLinkPath)
+	}
 }
 
 func (lbs *linkedBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
@@ -84,7 +118,11 @@ func (lbs *linkedBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter
 func (lbs *linkedBlobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
 	dgst := digest.FromBytes(p)
 	// Place the data in the blob store first.
-	desc, err := lbs.blobStore.Put(ctx, mediaType, p)
+	put := lbs.blobStore.Put
+	if lbs.compress {
+		put = lbs.blobStore.putCompressed
+	}
+	desc, err := put(ctx, mediaType, p)
 	if err != nil {
 		dcontext.GetLogger(ctx).Errorf("error putting into main store: %v", err)
 		return distribution.Descriptor{}, err
@@ -168,7 +206,14 @@ func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.
 		return nil, err
 	}
 
-	return lbs.newBlobUpload(ctx, uuid, path, startedAt, false)
+	bw, err := lbs.newBlobUpload(ctx, uuid, path, startedAt, false)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Progress != nil {
+		bw.progress, bw.progressTotal = opts.Progress, -1
+	}
+	return bw, nil
 }
 
 func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution.BlobWriter, error) {
@@ -205,7 +250,11 @@ func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution
 		return nil, err
 	}
 
-	return lbs.newBlobUpload(ctx, id, path, startedAt, true)
+	bw, err := lbs.newBlobUpload(ctx, id, path, startedAt, true)
+	if err != nil {
+		return nil, err
+	}
+	return bw, nil
 }
 
 func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
@@ -224,10 +273,19 @@ func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) erro
 		return err
 	}
 
+	blobLinkPath, err := lbs.linkPath(lbs.repository.Named().Name(), dgst)
+	if err != nil {
+		return err
+	}
+	lbs.invalidateExistence(blobLinkPath)
+
 	return nil
 }
 
-func (lbs *linkedBlobStore) Enumerate(ctx context.Context, ingestor func(digest.Digest) error) error {
+// Enumerate walks the link files of the repository, and calls ingestor with
+// the descriptor of each linked blob. Links to blobs which are missing from
+// the blob store are skipped.
+func (lbs *linkedBlobStore) Enumerate(ctx context.Context, ingestor func(desc distribution.Descriptor) error) error {
 	rootPath, err := pathFor(lbs.linkDirectoryPathSpec)
 	if err != nil {
 		return err
@@ -252,7 +310,7 @@ func (lbs *linkedBlobStore) Enumerate(ctx context.Context, ingestor func(digest.
 		}
 
 		// ensure this conforms to the linkPathFns
-		_, err = lbs.Stat(ctx, digest)
+		desc, err := lbs.Stat(ctx, digest)
 		if err != nil {
 			// we expect this error to occur so we move on
 			if err == distribution.ErrBlobUnknown {
@@ -261,7 +319,7 @@ func (lbs *linkedBlobStore) Enumerate(ctx context.Context, ingestor func(digest.
 			return err
 		}
 
-		err = ingestor(digest)
+		err = ingestor(desc)
 		if err != nil {
 			return err
 		}
@@ -270,6 +328,19 @@ func (lbs *linkedBlobStore) Enumerate(ctx context.Context, ingestor func(digest.
 	})
 }
 
+// EnumerateAll returns the descriptors of all blobs linked in the repository.
+func (lbs *linkedBlobStore) EnumerateAll(ctx context.Context) ([]distribution.Descriptor, error) {
+	var descs []distribution.Descriptor
+	err := lbs.Enumerate(ctx, func(desc distribution.Descriptor) error {
+		descs = append(descs, desc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return descs, nil
+}
+
 func (lbs *linkedBlobStore) mount(ctx context.Context, sourceRepo reference.Named, dgst digest.Digest, sourceStat *distribution.Descriptor) (distribution.Descriptor, error) {
 	var stat distribution.Descriptor
 	if sourceStat == nil {
@@ -300,7 +371,7 @@ func (lbs *linkedBlobStore) mount(ctx context.Context, sourceRepo reference.Name
 }
 
 // newBlobUpload allocates a new upload controller with the given state.
-func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string, startedAt time.Time, append bool) (distribution.BlobWriter, error) {
+func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string, startedAt time.Time, append bool) (*blobWriter, error) {
 	fw, err := lbs.driver.Writer(ctx, path, append)
 	if err != nil {
 		return nil, err
@@ -316,6 +387,16 @@ func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string
 		driver:                 lbs.driver,
 		path:                   path,
 		resumableDigestEnabled: lbs.resumableDigestEnabled,
+		rangeStart:             -1,
+	}
+	if start, ok := ctx.Value(uploadRangeKey{}).(int64); ok {
+		bw.rangeStart = start
+	}
+	if p, ok := ctx.Value(uploadProgressKey{}).(uploadProgress); ok {
+		bw.progress, bw.progressWritten, bw.progressTotal = p.fn, fw.Size(), -1
+		if p.expected >= 0 {
+			bw.progressTotal = fw.Size() + p.expected
+		}
 	}
 
 	return bw, nil
@@ -347,6 +428,7 @@ func (lbs *linkedBlobStore) linkBlob(ctx context.Context, canonical distribution
 		if err := lbs.blobStore.link(ctx, blobLinkPath, canonical.Digest); err != nil {
 			return err
 		}
+		lbs.invalidateExistence(blobLinkPath)
 	}
 
 	return nil
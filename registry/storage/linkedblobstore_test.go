@@ -43,14 +43,14 @@ func TestLinkedBlobStoreEnumerator(t *testing.T) {
 		}
 	}
 
-	enumerator, ok := fooEnv.repository.Blobs(fooEnv.ctx).(distribution.BlobEnumerator)
+	enumerator, ok := fooEnv.repository.Blobs(fooEnv.ctx).(LinkedBlobEnumerator)
 	if !ok {
-		t.Fatalf("Blobs is not a BlobEnumerator")
+		t.Fatalf("Blobs is not a LinkedBlobEnumerator")
 	}
 
 	var actual []string
-	if err := enumerator.Enumerate(ctx, func(dgst digest.Digest) error {
-		actual = append(actual, dgst.String())
+	if err := enumerator.Enumerate(ctx, func(desc distribution.Descriptor) error {
+		actual = append(actual, desc.Digest.String())
 		return nil
 	}); err != nil {
 		t.Fatalf("cannot enumerate on repository: %v", err)
@@ -61,6 +61,32 @@ func TestLinkedBlobStoreEnumerator(t *testing.T) {
 	if !reflect.DeepEqual(expected, actual) {
 		t.Fatalf("unexpected array difference (expected: %v actual: %v)", expected, actual)
 	}
+
+	// A link to a blob missing from the blob store is skipped.
+	missing := digest.FromString("missing")
+	linkPath, err := pathFor(layerLinkPathSpec{name: fooRepoName.Name(), digest: missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fooEnv.driver.PutContent(ctx, linkPath, []byte(missing)); err != nil {
+		t.Fatal(err)
+	}
+
+	descs, err := enumerator.EnumerateAll(ctx)
+	if err != nil {
+		t.Fatalf("cannot enumerate on repository: %v", err)
+	}
+	actual = actual[:0]
+	for _, desc := range descs {
+		if desc.Size == 0 {
+			t.Errorf("descriptor of %s has no size", desc.Digest)
+		}
+		actual = append(actual, desc.Digest.String())
+	}
+	sort.Strings(actual)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected array difference (expected: %v actual: %v)", expected, actual)
+	}
 }
 
 func TestLinkedBlobStoreCreateWithMountFrom(t *testing.T) {
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/opencontainers/go-digest"
+)
+
+// ChainNode is a manifest of a chain of artifacts, such as an image, its
+// signature and the attestation of the signature. The children of a
+// manifest are the manifests which have it as their subject.
+type ChainNode struct {
+	distribution.Descriptor
+	Children []*ChainNode `json:"children,omitempty"`
+}
+
+// Chain returns the chain of manifests from root to its ancestors, following
+// the subject of each manifest. See ManifestChain.
+func (ms *manifestStore) Chain(ctx context.Context, root digest.Digest, maxDepth int) ([]*ChainNode, error) {
+	return ManifestChain(ctx, ms, root, maxDepth)
+}
+
+// ManifestChain returns the manifest root, followed by its subject, the
+// subject of its subject, and so on, until a manifest without subject, with
+// a subject missing from manifests, or maxDepth subjects are reached. Each
+// manifest is the child of the next one, such that the last node is the root
+// of the tree of the chain. It is an error for root to be missing.
+func ManifestChain(ctx context.Context, manifests distribution.ManifestService, root digest.Digest, maxDepth int) ([]*ChainNode, error) {
+	var chain []*ChainNode
+	for dgst := root; ; {
+		m, err := manifests.Get(ctx, dgst)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok && len(chain) > 0 {
+				// Subjects are not required to exist.
+				return chain, nil
+			}
+			return nil, err
+		}
+		mediaType, payload, err := m.Payload()
+		if err != nil {
+			return nil, err
+		}
+
+		node := &ChainNode{
+			Descriptor: distribution.Descriptor{
+				MediaType: mediaType,
+				Digest:    dgst,
+				Size:      int64(len(payload)),
+			},
+		}
+		if len(chain) > 0 {
+			node.Children = []*ChainNode{chain[len(chain)-1]}
+		}
+		chain = append(chain, node)
+
+		om, ok := m.(*ocischema.DeserializedManifest)
+		if !ok || om.Subject == nil || len(chain) > maxDepth {
+			return chain, nil
+		}
+		dgst = om.Subject.Digest
+	}
+}
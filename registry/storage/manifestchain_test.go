@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// putArtifact stores an OCI artifact about subject, and returns its
+// descriptor.
+func putArtifact(t *testing.T, repo distribution.Repository, artifactType string, subject distribution.Descriptor) distribution.Descriptor {
+	t.Helper()
+	ctx := context.Background()
+
+	config, err := repo.Blobs(ctx).Put(ctx, artifactType, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MediaType = artifactType
+	m, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 2,
+			MediaType:     v1.MediaTypeImageManifest,
+		},
+		Config:      config,
+		Annotations: map[string]string{"subject": subject.Digest.String()},
+		Subject:     &subject,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := ms.Put(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, err := m.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst, Size: int64(len(payload))}
+}
+
+func TestManifestChain(t *testing.T) {
+	ctx := context.Background()
+	repo := makeRepository(t, createRegistry(t, inmemory.New()), "foo/chain")
+
+	img := uploadRandomSchema2Image(t, repo)
+	_, payload, err := img.manifest.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := distribution.Descriptor{MediaType: "application/vnd.docker.distribution.manifest.v2+json", Digest: img.manifestDigest, Size: int64(len(payload))}
+	signature := putArtifact(t, repo, "application/vnd.example.signature", image)
+	attestation := putArtifact(t, repo, "application/vnd.example.attestation", signature)
+
+	ms := makeManifestService(t, repo).(*manifestStore)
+	chain, err := ms.Chain(ctx, attestation.Digest, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []distribution.Descriptor{attestation, signature, image}
+	if len(chain) != len(expected) {
+		t.Fatalf("expected a chain of %d manifests, got %d", len(expected), len(chain))
+	}
+	for i, node := range chain {
+		if node.Descriptor.Digest != expected[i].Digest || node.MediaType != expected[i].MediaType || node.Size != expected[i].Size {
+			t.Fatalf("unexpected manifest %d of the chain: %+v != %+v", i, node.Descriptor, expected[i])
+		}
+		if i == 0 {
+			if len(node.Children) != 0 {
+				t.Fatalf("expected the root of the chain to have no children, got %d", len(node.Children))
+			}
+		} else if len(node.Children) != 1 || node.Children[0] != chain[i-1] {
+			t.Fatalf("expected manifest %d of the chain to be the child of manifest %d", i-1, i)
+		}
+	}
+
+	// The chain stops after maxDepth subjects.
+	chain, err = ms.Chain(ctx, attestation.Digest, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || chain[1].Descriptor.Digest != signature.Digest {
+		t.Fatalf("expected the chain to stop at the signature, got %d manifests", len(chain))
+	}
+
+	// Subjects missing from the repository end the chain.
+	orphan := putArtifact(t, repo, "application/vnd.example.signature", distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    digest.FromString("never pushed"),
+		Size:      2,
+	})
+	chain, err = ms.Chain(ctx, orphan.Digest, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || chain[0].Descriptor.Digest != orphan.Digest {
+		t.Fatalf("expected the chain of an orphan to hold it alone, got %d manifests", len(chain))
+	}
+
+	if _, err := ms.Chain(ctx, digest.FromString("never pushed"), 10); err == nil {
+		t.Fatal("expected an error getting the chain of a missing manifest")
+	} else if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("unexpected error getting the chain of a missing manifest: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// minManifestFilterCapacity is the smallest number of manifests the filter
+// of a repository is sized for.
+const minManifestFilterCapacity = 1024
+
+// manifestFilters holds, for each repository, a bloom filter of the
+// manifests stored in it, such that the manifests missing from the filter are
+// known not to exist. Requests for them are answered without reading from
+// storage.
+type manifestFilters struct {
+	falsePositiveRate float64
+	// refresh is the interval after which filters are loaded again from
+	// storage, to see the manifests pushed through other registries sharing
+	// the storage. Zero never reloads them.
+	refresh time.Duration
+
+	mu    sync.Mutex
+	repos map[string]*manifestFilter
+}
+
+// manifestFilter is the bloom filter of the manifests of a repository.
+type manifestFilter struct {
+	mu       sync.Mutex
+	bloom    *bloom.BloomFilter
+	capacity int
+	count    int
+	loadedAt time.Time
+	// pending records the manifests added while the filter is loading, as
+	// they may have been linked after the walk saw their directory.
+	pending []digest.Digest
+	loading bool
+}
+
+func newManifestFilters(falsePositiveRate float64, refresh time.Duration) *manifestFilters {
+	return &manifestFilters{
+		falsePositiveRate: falsePositiveRate,
+		refresh:           refresh,
+		repos:             make(map[string]*manifestFilter),
+	}
+}
+
+func (mf *manifestFilters) filter(name string) *manifestFilter {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+
+	f, ok := mf.repos[name]
+	if !ok {
+		f = &manifestFilter{}
+		mf.repos[name] = f
+	}
+	return f
+}
+
+// absent reports whether the manifest dgst is definitely not stored in the
+// repository name. The filter of the repository is loaded from storage
+// first if needed.
+func (mf *manifestFilters) absent(ctx context.Context, d driver.StorageDriver, name string, dgst digest.Digest) bool {
+	f := mf.filter(name)
+
+	f.mu.Lock()
+	stale := f.bloom == nil || (mf.refresh > 0 && time.Since(f.loadedAt) > mf.refresh)
+	if stale && !f.loading {
+		f.loading = true
+		f.pending = nil
+		f.mu.Unlock()
+		filter, capacity, count, err := mf.load(ctx, d, name)
+		f.mu.Lock()
+		f.loading = false
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error loading manifest filter of %s: %v", name, err)
+		} else {
+			for _, pending := range f.pending {
+				filter.AddString(pending.String())
+			}
+			f.bloom, f.capacity, f.count, f.loadedAt = filter, capacity, count+len(f.pending), time.Now()
+			stale = false
+		}
+		f.pending = nil
+	}
+	defer f.mu.Unlock()
+
+	// A filter being loaded, or failing to load, may miss manifests.
+	if f.bloom == nil || stale {
+		return false
+	}
+	return !f.bloom.TestString(dgst.String())
+}
+
+// add records the manifest dgst, stored in the repository name.
+func (mf *manifestFilters) add(name string, dgst digest.Digest) {
+	f := mf.filter(name)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.loading {
+		f.pending = append(f.pending, dgst)
+	}
+	if f.bloom == nil {
+		return
+	}
+	f.bloom.AddString(dgst.String())
+	f.count++
+	if f.count > f.capacity {
+		// The false positive rate grows past the target, load a larger
+		// filter on the next request.
+		f.bloom = nil
+	}
+}
+
+// remove records the deletion of the manifest dgst from the repository name.
+// Bloom filters cannot forget a member, so the filter is cleared and loaded
+// again on the next request.
+func (mf *manifestFilters) remove(name string, dgst digest.Digest) {
+	f := mf.filter(name)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.bloom != nil && f.bloom.TestString(dgst.String()) {
+		f.bloom = nil
+	}
+}
+
+// load returns a bloom filter of the manifest revisions linked in the
+// repository name.
+func (mf *manifestFilters) load(ctx context.Context, d driver.StorageDriver, name string) (*bloom.BloomFilter, int, int, error) {
+	root, err := pathFor(manifestRevisionsPathSpec{name: name})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// The digests are read from the link paths, of the form
+	// <algorithm>/<hex digest>/link, rather than from the links. Deleted
+	// manifests with a tombstone are included, such that fetching them
+	// reads the tombstone.
+	var dgsts []digest.Digest
+	err = d.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if base := path.Base(fileInfo.Path()); fileInfo.IsDir() || (base != "link" && base != "tombstone") {
+			return nil
+		}
+		dir := path.Dir(fileInfo.Path())
+		dgst := digest.NewDigestFromEncoded(digest.Algorithm(path.Base(path.Dir(dir))), path.Base(dir))
+		if dgst.Validate() == nil {
+			dgsts = append(dgsts, dgst)
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		err = nil
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Leave room for the manifests pushed until the next load.
+	capacity := 2 * len(dgsts)
+	if capacity < minManifestFilterCapacity {
+		capacity = minManifestFilterCapacity
+	}
+	filter := newBloomFilter(capacity, mf.falsePositiveRate)
+	for _, dgst := range dgsts {
+		filter.AddString(dgst.String())
+	}
+	return filter, capacity, len(dgsts), nil
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	stdcontext "context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/cache/memory"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const n = 10000
+	bf := newBloomFilter(n, 0.001)
+	for i := 0; i < n; i++ {
+		bf.AddString(digest.FromString(fmt.Sprintf("manifest-%d", i)).String())
+	}
+	for i := 0; i < n; i++ {
+		if !bf.TestString(digest.FromString(fmt.Sprintf("manifest-%d", i)).String()) {
+			t.Fatalf("false negative for manifest %d", i)
+		}
+	}
+
+	const queries = 100000
+	var falsePositives int
+	for i := 0; i < queries; i++ {
+		if bf.TestString(digest.FromString(fmt.Sprintf("absent-%d", i)).String()) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / queries; rate >= 0.001 {
+		t.Fatalf("false positive rate %v exceeds 0.1%%", rate)
+	}
+}
+
+func TestManifestStorageBloomFilter(t *testing.T) {
+	k, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testManifestStorage(t, true, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)), EnableDelete, EnableRedirect, Schema1SigningKey(k), EnableSchema1, ManifestBloomFilter(0.001, 0))
+}
+
+// linkCountingDriver counts the reads of manifest revision links.
+type linkCountingDriver struct {
+	driver.StorageDriver
+	reads int32
+}
+
+func (d *linkCountingDriver) GetContent(ctx stdcontext.Context, path string) ([]byte, error) {
+	if strings.Contains(path, "/_manifests/revisions/") {
+		atomic.AddInt32(&d.reads, 1)
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func TestManifestBloomFilter(t *testing.T) {
+	ctx := context.Background()
+	d := &linkCountingDriver{StorageDriver: inmemory.New()}
+	name, _ := reference.WithName("foo/index")
+
+	// An index pushed before the registry starts is loaded from storage.
+	preexisting := putImageIndexOn(t, d, name, makeImageIndex(t, 1))
+
+	ns, err := NewRegistry(ctx, d, EnableDelete, ManifestBloomFilter(0.001, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := ns.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := repo.Manifests(ctx, SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ms.Put(ctx, makeImageIndex(t, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&d.reads, 0)
+	for i := 0; i < 100; i++ {
+		dgst := digest.FromString(fmt.Sprintf("missing-%d", i))
+		if _, err := ms.Get(ctx, dgst); err == nil {
+			t.Fatalf("expected an error getting missing manifest %s", dgst)
+		} else if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+			t.Fatalf("unexpected error getting missing manifest: %v", err)
+		}
+		if exists, err := ms.Exists(ctx, dgst); err != nil || exists {
+			t.Fatalf("expected missing manifest %s not to exist: %v", dgst, err)
+		}
+	}
+	// The false positive rate allows a single read.
+	if reads := atomic.LoadInt32(&d.reads); reads > 1 {
+		t.Fatalf("expected missing manifests not to be read from storage, got %d reads", reads)
+	}
+
+	for _, dgst := range []digest.Digest{preexisting, stored} {
+		if _, err := ms.Get(ctx, dgst); err != nil {
+			t.Fatalf("error getting stored manifest %s: %v", dgst, err)
+		}
+	}
+
+	// Deleted manifests are not in storage anymore.
+	if err := ms.Delete(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Get(ctx, stored); err == nil {
+		t.Fatal("expected an error getting a deleted manifest")
+	}
+	// The filter is loaded again without the deleted manifest.
+	if !ns.(*registry).manifestFilters.absent(ctx, d, name.Name(), stored) {
+		t.Fatal("expected the deleted manifest to be known not to exist")
+	}
+}
+
+func TestManifestBloomFilterRefresh(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("foo/index")
+
+	registry, err := NewRegistry(ctx, d, ManifestBloomFilter(0.001, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := makeImageIndex(t, 3)
+	_, payload, err := index.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromBytes(payload)
+	if _, err := ms.Get(ctx, dgst); err == nil {
+		t.Fatal("expected an error getting a manifest not pushed yet")
+	}
+
+	// A manifest pushed through another registry sharing the storage is
+	// seen once the filter is refreshed.
+	putImageIndexOn(t, d, name, index)
+	time.Sleep(100 * time.Millisecond)
+	if _, err := ms.Get(ctx, dgst); err != nil {
+		t.Fatalf("error getting manifest pushed through another registry: %v", err)
+	}
+}
+
+// putImageIndexOn stores index in the repository name of a new registry on
+// d, and returns its digest.
+func putImageIndexOn(t *testing.T, d driver.StorageDriver, name reference.Named, index distribution.Manifest) digest.Digest {
+	t.Helper()
+	ctx := context.Background()
+
+	registry, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := registry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := repo.Manifests(ctx, SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := ms.Put(ctx, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dgst
+}
@@ -38,10 +38,6 @@ func (ms *manifestListHandler) Put(ctx context.Context, manifestList distributio
 		return "", fmt.Errorf("wrong type put to manifestListHandler: %T", manifestList)
 	}
 
-	if err := ms.verifyManifest(ms.ctx, *m, skipDependencyVerification); err != nil {
-		return "", err
-	}
-
 	mt, payload, err := m.Payload()
 	if err != nil {
 		return "", err
@@ -56,23 +52,36 @@ func (ms *manifestListHandler) Put(ctx context.Context, manifestList distributio
 	return revision.Digest, nil
 }
 
-// verifyManifest ensures that the manifest content is valid from the
-// perspective of the registry. As a policy, the registry only tries to
-// store valid content, leaving trust policies of that content up to
-// consumers.
-func (ms *manifestListHandler) verifyManifest(ctx context.Context, mnfst manifestlist.DeserializedManifestList, skipDependencyVerification bool) error {
+// manifestListValidator is the built-in ManifestValidator of manifest lists
+// and OCI image indexes. Other types of manifests are accepted.
+type manifestListValidator struct {
+	repository                 distribution.Repository
+	skipDependencyVerification bool
+}
+
+var _ ManifestValidator = &manifestListValidator{}
+
+// Validate ensures that the manifest content is valid from the perspective of
+// the registry. As a policy, the registry only tries to store valid content,
+// leaving trust policies of that content up to consumers.
+func (v *manifestListValidator) Validate(ctx context.Context, manifest distribution.Manifest) error {
+	mnfst, ok := manifest.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		return nil
+	}
+
 	var errs distribution.ErrManifestVerification
 
 	if mnfst.SchemaVersion != 2 {
 		return fmt.Errorf("unrecognized manifest list schema version %d", mnfst.SchemaVersion)
 	}
 
-	if !skipDependencyVerification {
+	if !v.skipDependencyVerification {
 		// This manifest service is different from the blob service
 		// returned by Blob. It uses a linked blob store to ensure that
 		// only manifests are accessible.
 
-		manifestService, err := ms.repository.Manifests(ctx)
+		manifestService, err := v.repository.Manifests(ctx)
 		if err != nil {
 			return err
 		}
@@ -59,6 +59,10 @@ var _ distribution.ManifestService = &manifestStore{}
 func (ms *manifestStore) Exists(ctx context.Context, dgst digest.Digest) (bool, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Exists")
 
+	if ms.absent(ctx, dgst) {
+		return false, nil
+	}
+
 	_, err := ms.blobStore.Stat(ms.ctx, dgst)
 	if err != nil {
 		if err == distribution.ErrBlobUnknown {
@@ -77,9 +81,21 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 	// TODO(stevvooe): Need to check descriptor from above to ensure that the
 	// mediatype is as we expect for the manifest store.
 
+	if ms.absent(ctx, dgst) {
+		return nil, distribution.ErrManifestUnknownRevision{
+			Name:     ms.repository.Named().Name(),
+			Revision: dgst,
+		}
+	}
+
 	content, err := ms.blobStore.Get(ctx, dgst)
 	if err != nil {
 		if err == distribution.ErrBlobUnknown {
+			if ms.repository.tombstonesEnabled {
+				if err := ms.deleted(ctx, dgst); err != nil {
+					return nil, err
+				}
+			}
 			return nil, distribution.ErrManifestUnknownRevision{
 				Name:     ms.repository.Named().Name(),
 				Revision: dgst,
@@ -129,29 +145,123 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
+	if err := ms.validator().Validate(ms.ctx, manifest); err != nil {
+		return "", err
+	}
+
+	var handler ManifestHandler
 	switch manifest.(type) {
 	case *schema1.SignedManifest:
-		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema1Handler
 	case *schema2.DeserializedManifest:
-		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema2Handler
 	case *ocischema.DeserializedManifest:
-		return ms.ocischemaHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.ocischemaHandler
 	case *manifestlist.DeserializedManifestList:
-		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.manifestListHandler
+	default:
+		return "", fmt.Errorf("unrecognized manifest type %T", manifest)
 	}
 
-	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	dgst, err := handler.Put(ctx, manifest, ms.skipDependencyVerification)
+	if err != nil {
+		return "", err
+	}
+	if om, ok := manifest.(*ocischema.DeserializedManifest); ok && om.Subject != nil {
+		if err := linkReferrer(ctx, ms.repository.driver, ms.repository.Named().Name(), om.Subject.Digest, dgst); err != nil {
+			return "", err
+		}
+		desc, err := referrerDescriptor(om, dgst)
+		if err != nil {
+			return "", err
+		}
+		if err := indexReferrer(ctx, ms.repository.driver, ms.repository.Named().Name(), om.Subject.Digest, desc); err != nil {
+			return "", err
+		}
+	}
+	if filters := ms.repository.manifestFilters; filters != nil {
+		filters.add(ms.repository.Named().Name(), dgst)
+	}
+	return dgst, nil
 }
 
-// Delete removes the revision of the specified manifest.
+// absent reports whether the manifest dgst is known not to be stored in the
+// repository, from its bloom filter.
+func (ms *manifestStore) absent(ctx context.Context, dgst digest.Digest) bool {
+	filters := ms.repository.manifestFilters
+	if filters == nil {
+		return false
+	}
+	return filters.absent(ctx, ms.repository.driver, ms.repository.Named().Name(), dgst)
+}
+
+// validator returns the chain of the built-in validators, followed by the
+// validators of the registry.
+func (ms *manifestStore) validator() ManifestValidators {
+	validators := ManifestValidators{
+		&schema2Validator{
+			repository:                 ms.repository,
+			manifestURLs:               ms.repository.manifestURLs,
+			skipDependencyVerification: ms.skipDependencyVerification,
+		},
+		&ocischemaValidator{
+			repository:                 ms.repository,
+			manifestURLs:               ms.repository.manifestURLs,
+			skipDependencyVerification: ms.skipDependencyVerification,
+		},
+		&manifestListValidator{
+			repository:                 ms.repository,
+			skipDependencyVerification: ms.skipDependencyVerification,
+		},
+	}
+	return append(validators, ms.repository.manifestValidators...)
+}
+
+// Delete removes the revision of the specified manifest. With tombstones
+// enabled, its deletion is recorded along with the reason and replacement
+// given by WithTombstone.
 func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Delete")
-	return ms.blobStore.Delete(ctx, dgst)
+	if err := ms.blobStore.Delete(ctx, dgst); err != nil {
+		return err
+	}
+	if filters := ms.repository.manifestFilters; filters != nil {
+		filters.remove(ms.repository.Named().Name(), dgst)
+	}
+
+	if ms.repository.tombstonesEnabled {
+		// The manifest is deleted already, a missing tombstone only makes
+		// the revision unknown rather than deleted.
+		if err := writeTombstone(ctx, ms.repository.driver, ms.repository.Named().Name(), dgst); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error writing tombstone of manifest %s: %v", dgst, err)
+		}
+	}
+	return nil
+}
+
+// deleted returns the distribution.ErrManifestDeleted of the manifest dgst
+// if its tombstone records its deletion, and nil otherwise.
+func (ms *manifestStore) deleted(ctx context.Context, dgst digest.Digest) error {
+	ts, err := readTombstone(ctx, ms.repository.driver, ms.repository.Named().Name(), dgst)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error reading tombstone of manifest %s: %v", dgst, err)
+		return nil
+	}
+	if ts == nil {
+		return nil
+	}
+	return distribution.ErrManifestDeleted{
+		Name:       ms.repository.Named().Name(),
+		Digest:     dgst,
+		DeletedAt:  ts.DeletedAt,
+		Reason:     ts.Reason,
+		ReplacedBy: ts.ReplacedBy,
+	}
 }
 
 func (ms *manifestStore) Enumerate(ctx context.Context, ingester func(digest.Digest) error) error {
-	err := ms.blobStore.Enumerate(ctx, func(dgst digest.Digest) error {
-		err := ingester(dgst)
+	err := ms.blobStore.Enumerate(ctx, func(desc distribution.Descriptor) error {
+		err := ingester(desc.Digest)
 		if err != nil {
 			return err
 		}
@@ -544,6 +544,81 @@ func testOCIManifestStorage(t *testing.T, testname string, includeMediaTypes boo
 
 // TestLinkPathFuncs ensures that the link path functions behavior are locked
 // down and implemented as expected.
+// TestOCIImageIndexMissingChildren ensures that an image index referencing
+// manifests missing from the repository is rejected, with an error for each.
+func TestOCIImageIndexMissingChildren(t *testing.T) {
+	repoName, _ := reference.WithName("foo/index")
+	env := newManifestStoreTestEnv(t, repoName, "thetag")
+
+	ctx := context.Background()
+	ms, err := env.repository.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := env.repository.Blobs(ctx).Put(ctx, v1.MediaTypeImageLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+	config, err := env.repository.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error putting config: %v", err)
+	}
+	config.MediaType = v1.MediaTypeImageConfig
+	layer.MediaType = v1.MediaTypeImageLayer
+
+	image, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	imageDigest, err := ms.Put(ctx, image)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+
+	// The layer exists as a blob of the repository but not as a manifest.
+	missing := []digest.Digest{
+		digest.FromString("amd64"),
+		digest.FromString("arm64"),
+		layer.Digest,
+	}
+	descriptors := []manifestlist.ManifestDescriptor{{
+		Descriptor: distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: imageDigest, Size: 1},
+		Platform:   manifestlist.PlatformSpec{Architecture: "386", OS: "linux"},
+	}}
+	for _, dgst := range missing {
+		descriptors = append(descriptors, manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst, Size: 1},
+			Platform:   manifestlist.PlatformSpec{Architecture: "unknown", OS: "linux"},
+		})
+	}
+	index, err := manifestlist.FromDescriptorsWithMediaType(descriptors, v1.MediaTypeImageIndex)
+	if err != nil {
+		t.Fatalf("unexpected error creating image index: %v", err)
+	}
+
+	_, err = ms.Put(ctx, index)
+	verr, ok := err.(distribution.ErrManifestVerification)
+	if !ok {
+		t.Fatalf("expected ErrManifestVerification putting image index, got %v", err)
+	}
+	var unknown []digest.Digest
+	for _, err := range verr {
+		blobErr, ok := err.(distribution.ErrManifestBlobUnknown)
+		if !ok {
+			t.Fatalf("unexpected error verifying image index: %v", err)
+		}
+		unknown = append(unknown, blobErr.Digest)
+	}
+	if !reflect.DeepEqual(unknown, missing) {
+		t.Fatalf("expected unknown children %v, got %v", missing, unknown)
+	}
+}
+
 func TestLinkPathFuncs(t *testing.T) {
 	for _, testcase := range []struct {
 		repo       string
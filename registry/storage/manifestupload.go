@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"time"
+
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/opencontainers/go-digest"
+)
+
+var (
+	// ErrManifestUploadUnknown is returned when a manifest upload session
+	// does not exist or has already been committed or cancelled.
+	ErrManifestUploadUnknown = errors.New("manifest upload unknown")
+
+	// ErrManifestUploadTooLarge is returned when appending to a manifest
+	// upload would take it past the configured maximum size.
+	ErrManifestUploadTooLarge = errors.New("manifest upload too large")
+
+	// ErrManifestUploadDigestMismatch is returned when the content of a
+	// manifest upload does not match the digest it is committed with.
+	ErrManifestUploadDigestMismatch = errors.New("manifest upload does not match digest")
+)
+
+// ManifestUploadStore stages manifests that are pushed over several requests.
+// The accumulated payload is kept under the repository's _uploads/manifest
+// directory until the client commits or cancels the session. Payloads are
+// rewritten in full on each append rather than using driver appends, which
+// keeps the store usable with every storage driver; manifests are small
+// enough for this to be cheap.
+type ManifestUploadStore struct {
+	driver  driver.StorageDriver
+	name    string
+	maxSize int64
+}
+
+// NewManifestUploadStore returns a ManifestUploadStore for the named
+// repository. Uploads larger than maxSize bytes are rejected.
+func NewManifestUploadStore(driver driver.StorageDriver, name reference.Named, maxSize int64) *ManifestUploadStore {
+	return &ManifestUploadStore{
+		driver:  driver,
+		name:    name.Name(),
+		maxSize: maxSize,
+	}
+}
+
+// Create starts a new, empty manifest upload session and returns its id.
+func (mus *ManifestUploadStore) Create(ctx context.Context) (string, error) {
+	id := uuid.Generate().String()
+
+	dataPath, err := pathFor(manifestUploadDataPathSpec{name: mus.name, id: id})
+	if err != nil {
+		return "", err
+	}
+	startedAtPath, err := pathFor(manifestUploadStartedAtPathSpec{name: mus.name, id: id})
+	if err != nil {
+		return "", err
+	}
+
+	if err := mus.driver.PutContent(ctx, dataPath, []byte{}); err != nil {
+		return "", err
+	}
+	if err := mus.driver.PutContent(ctx, startedAtPath, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Append adds the contents of r to the upload identified by id and returns
+// the total number of bytes received so far.
+func (mus *ManifestUploadStore) Append(ctx context.Context, id string, r io.Reader) (int64, error) {
+	content, err := mus.content(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := bytes.NewBuffer(content)
+	remaining := mus.maxSize - int64(len(content))
+	n, err := io.Copy(buf, io.LimitReader(r, remaining+1))
+	if err != nil {
+		return 0, err
+	}
+	if n > remaining {
+		return 0, ErrManifestUploadTooLarge
+	}
+
+	dataPath, err := pathFor(manifestUploadDataPathSpec{name: mus.name, id: id})
+	if err != nil {
+		return 0, err
+	}
+	if err := mus.driver.PutContent(ctx, dataPath, buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return int64(buf.Len()), nil
+}
+
+// Payload returns the accumulated content of the upload identified by id,
+// after checking that it matches dgst. The session is left in place so that
+// it can be retried if storing the manifest fails; callers should Cancel it
+// once the manifest has been stored.
+func (mus *ManifestUploadStore) Payload(ctx context.Context, id string, dgst digest.Digest) ([]byte, error) {
+	content, err := mus.content(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+	if dgst.Algorithm().FromBytes(content) != dgst {
+		return nil, ErrManifestUploadDigestMismatch
+	}
+
+	return content, nil
+}
+
+// Cancel removes the upload identified by id.
+func (mus *ManifestUploadStore) Cancel(ctx context.Context, id string) error {
+	if _, err := mus.content(ctx, id); err != nil {
+		return err
+	}
+
+	dataPath, err := pathFor(manifestUploadDataPathSpec{name: mus.name, id: id})
+	if err != nil {
+		return err
+	}
+	return mus.driver.Delete(ctx, path.Dir(dataPath))
+}
+
+func (mus *ManifestUploadStore) content(ctx context.Context, id string) ([]byte, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrManifestUploadUnknown
+	}
+
+	dataPath, err := pathFor(manifestUploadDataPathSpec{name: mus.name, id: id})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := mus.driver.GetContent(ctx, dataPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, ErrManifestUploadUnknown
+		}
+		return nil, err
+	}
+
+	return content, nil
+}
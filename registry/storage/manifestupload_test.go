@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestManifestUploadStore(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("foo/bar")
+	uploads := NewManifestUploadStore(d, name, 16)
+
+	id, err := uploads.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error creating upload: %v", err)
+	}
+
+	for _, chunk := range []string{"0123", "4567", "89"} {
+		if _, err := uploads.Append(ctx, id, bytes.NewReader([]byte(chunk))); err != nil {
+			t.Fatalf("unexpected error appending to upload: %v", err)
+		}
+	}
+
+	if _, err := uploads.Append(ctx, id, bytes.NewReader([]byte("abcdefgh"))); err != ErrManifestUploadTooLarge {
+		t.Fatalf("expected ErrManifestUploadTooLarge, got %v", err)
+	}
+
+	if _, err := uploads.Payload(ctx, id, digest.FromString("01234567")); err != ErrManifestUploadDigestMismatch {
+		t.Fatalf("expected ErrManifestUploadDigestMismatch, got %v", err)
+	}
+
+	payload, err := uploads.Payload(ctx, id, digest.FromString("0123456789"))
+	if err != nil {
+		t.Fatalf("unexpected error reading payload: %v", err)
+	}
+	if string(payload) != "0123456789" {
+		t.Fatalf("unexpected payload: %q", payload)
+	}
+
+	if err := uploads.Cancel(ctx, id); err != nil {
+		t.Fatalf("unexpected error cancelling upload: %v", err)
+	}
+	if _, err := uploads.Append(ctx, id, bytes.NewReader([]byte("0"))); err != ErrManifestUploadUnknown {
+		t.Fatalf("expected ErrManifestUploadUnknown, got %v", err)
+	}
+}
+
+func TestPurgeManifestUploads(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	name, _ := reference.WithName("foo/bar")
+	uploads := NewManifestUploadStore(d, name, 16)
+
+	id, err := uploads.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error creating upload: %v", err)
+	}
+
+	deleted, errs := PurgeUploads(ctx, d, time.Now().Add(time.Hour), true)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors purging uploads: %v", errs)
+	}
+	if len(deleted) != 1 {
+		t.Fatalf("expected one upload to be purged, got %v", deleted)
+	}
+	if _, err := uploads.Payload(ctx, id, digest.FromString("")); err != ErrManifestUploadUnknown {
+		t.Fatalf("expected ErrManifestUploadUnknown, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/schema1"
+)
+
+// A ManifestValidator validates the manifests pushed to the registry, before
+// they are stored. Validators are given every type of manifest, and should
+// accept the types they do not apply to.
+type ManifestValidator interface {
+	// Validate returns an error if manifest must not be stored.
+	Validate(ctx context.Context, manifest distribution.Manifest) error
+}
+
+// ManifestValidatorFunc is an adapter to allow the use of ordinary functions
+// as ManifestValidators.
+type ManifestValidatorFunc func(ctx context.Context, manifest distribution.Manifest) error
+
+// Validate calls f(ctx, manifest).
+func (f ManifestValidatorFunc) Validate(ctx context.Context, manifest distribution.Manifest) error {
+	return f(ctx, manifest)
+}
+
+// ManifestValidators chains validators. They run in order, and the first
+// error is returned.
+type ManifestValidators []ManifestValidator
+
+var _ ManifestValidator = ManifestValidators{}
+
+// Validate runs each validator of the chain on manifest.
+func (validators ManifestValidators) Validate(ctx context.Context, manifest distribution.Manifest) error {
+	for _, v := range validators {
+		if err := v.Validate(ctx, manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateManifest runs on manifest the validators the manifest store of
+// repo runs before storing manifests, the built-in ones followed by those
+// given to WithManifestValidator, without storing it. Schema1 manifests are
+// verified as when they are stored. Repositories not returned by a registry
+// of this package return distribution.ErrUnsupported.
+func ValidateManifest(ctx context.Context, repo distribution.Repository, manifest distribution.Manifest) error {
+	r, ok := repo.(*repository)
+	if !ok {
+		return distribution.ErrUnsupported
+	}
+
+	ms := &manifestStore{
+		repository: r,
+		ctx:        ctx,
+	}
+	if err := ms.validator().Validate(ctx, manifest); err != nil {
+		return err
+	}
+
+	if sm, ok := manifest.(*schema1.SignedManifest); ok {
+		if !r.schema1Enabled {
+			return distribution.ErrSchemaV1Unsupported
+		}
+		handler := &signedManifestHandler{
+			ctx:               ctx,
+			schema1SigningKey: r.schema1SigningKey,
+			repository:        r,
+		}
+		return handler.verifyManifest(ctx, *sm, false)
+	}
+	return nil
+}
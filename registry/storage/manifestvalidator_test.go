@@ -0,0 +1,113 @@
+package storage
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+var errTooManyLayers = errors.New("too many layers")
+
+// maxLayersValidator rejects the schema2 manifests with more than max layers.
+func maxLayersValidator(max int) ManifestValidator {
+	return ManifestValidatorFunc(func(ctx stdcontext.Context, manifest distribution.Manifest) error {
+		if m, ok := manifest.(*schema2.DeserializedManifest); ok && len(m.Layers) > max {
+			return fmt.Errorf("%w: %d > %d", errTooManyLayers, len(m.Layers), max)
+		}
+		return nil
+	})
+}
+
+func putManifestWithLayers(t *testing.T, repository distribution.Repository, n int) (digest.Digest, error) {
+	t.Helper()
+
+	layers, err := testutil.CreateRandomLayers(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatalf("layer upload failed: %v", err)
+	}
+
+	var digests []digest.Digest
+	for dgst := range layers {
+		digests = append(digests, dgst)
+	}
+	manifest, err := testutil.MakeSchema2Manifest(repository, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return makeManifestService(t, repository).Put(context.Background(), manifest)
+}
+
+func TestManifestValidator(t *testing.T) {
+	registry := createRegistry(t, inmemory.New(), WithManifestValidator(maxLayersValidator(5)))
+	repo := makeRepository(t, registry, "foo/bar")
+
+	if _, err := putManifestWithLayers(t, repo, 5); err != nil {
+		t.Fatalf("unexpected error putting a manifest with 5 layers: %v", err)
+	}
+
+	dgst, err := putManifestWithLayers(t, repo, 6)
+	if !errors.Is(err, errTooManyLayers) {
+		t.Fatalf("expected a manifest with 6 layers to be rejected, got %v", err)
+	}
+	if dgst != "" {
+		t.Fatalf("unexpected digest %s for a rejected manifest", dgst)
+	}
+}
+
+func TestManifestValidatorsChain(t *testing.T) {
+	var calls []string
+	recorder := func(name string, err error) ManifestValidator {
+		return ManifestValidatorFunc(func(ctx stdcontext.Context, manifest distribution.Manifest) error {
+			calls = append(calls, name)
+			return err
+		})
+	}
+
+	registry := createRegistry(t, inmemory.New(),
+		WithManifestValidator(recorder("first", nil)),
+		WithManifestValidator(recorder("second", errTooManyLayers)),
+		WithManifestValidator(recorder("third", nil)),
+	)
+	repo := makeRepository(t, registry, "foo/bar")
+
+	if _, err := putManifestWithLayers(t, repo, 1); !errors.Is(err, errTooManyLayers) {
+		t.Fatalf("expected the error of the second validator, got %v", err)
+	}
+	if fmt.Sprint(calls) != "[first second]" {
+		t.Fatalf("unexpected validator calls %v", calls)
+	}
+}
+
+func TestManifestValidatorRunsAfterBuiltins(t *testing.T) {
+	called := false
+	registry := createRegistry(t, inmemory.New(), WithManifestValidator(ManifestValidatorFunc(
+		func(ctx stdcontext.Context, manifest distribution.Manifest) error {
+			called = true
+			return nil
+		})))
+	repo := makeRepository(t, registry, "foo/bar")
+
+	// The layer is never uploaded, so the built-in schema2 validator fails.
+	manifest, err := testutil.MakeSchema2Manifest(repo, []digest.Digest{digest.FromString("missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = makeManifestService(t, repo).Put(context.Background(), manifest)
+	if _, ok := err.(distribution.ErrManifestVerification); !ok {
+		t.Fatalf("expected a verification error, got %v", err)
+	}
+	if called {
+		t.Fatal("custom validator called for a manifest rejected by the built-in validators")
+	}
+}
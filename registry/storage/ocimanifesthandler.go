@@ -14,10 +14,9 @@ import (
 
 // ocischemaManifestHandler is a ManifestHandler that covers ocischema manifests.
 type ocischemaManifestHandler struct {
-	repository   distribution.Repository
-	blobStore    distribution.BlobStore
-	ctx          context.Context
-	manifestURLs manifestURLs
+	repository distribution.Repository
+	blobStore  distribution.BlobStore
+	ctx        context.Context
 }
 
 var _ ManifestHandler = &ocischemaManifestHandler{}
@@ -41,10 +40,6 @@ func (ms *ocischemaManifestHandler) Put(ctx context.Context, manifest distributi
 		return "", fmt.Errorf("non-ocischema manifest put to ocischemaManifestHandler: %T", manifest)
 	}
 
-	if err := ms.verifyManifest(ms.ctx, *m, skipDependencyVerification); err != nil {
-		return "", err
-	}
-
 	mt, payload, err := m.Payload()
 	if err != nil {
 		return "", err
@@ -59,26 +54,41 @@ func (ms *ocischemaManifestHandler) Put(ctx context.Context, manifest distributi
 	return revision.Digest, nil
 }
 
-// verifyManifest ensures that the manifest content is valid from the
-// perspective of the registry. As a policy, the registry only tries to store
-// valid content, leaving trust policies of that content up to consumers.
-func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst ocischema.DeserializedManifest, skipDependencyVerification bool) error {
+// ocischemaValidator is the built-in ManifestValidator of OCI image
+// manifests. Other types of manifests are accepted.
+type ocischemaValidator struct {
+	repository                 distribution.Repository
+	manifestURLs               manifestURLs
+	skipDependencyVerification bool
+}
+
+var _ ManifestValidator = &ocischemaValidator{}
+
+// Validate ensures that the manifest content is valid from the perspective of
+// the registry. As a policy, the registry only tries to store valid content,
+// leaving trust policies of that content up to consumers.
+func (v *ocischemaValidator) Validate(ctx context.Context, manifest distribution.Manifest) error {
+	mnfst, ok := manifest.(*ocischema.DeserializedManifest)
+	if !ok {
+		return nil
+	}
+
 	var errs distribution.ErrManifestVerification
 
 	if mnfst.Manifest.SchemaVersion != 2 {
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
-	if skipDependencyVerification {
+	if v.skipDependencyVerification {
 		return nil
 	}
 
-	manifestService, err := ms.repository.Manifests(ctx)
+	manifestService, err := v.repository.Manifests(ctx)
 	if err != nil {
 		return err
 	}
 
-	blobsService := ms.repository.Blobs(ctx)
+	blobsService := v.repository.Blobs(ctx)
 
 	for _, descriptor := range mnfst.References() {
 		err := descriptor.Digest.Validate()
@@ -88,9 +98,14 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 		}
 
 		switch descriptor.MediaType {
+		case ocischema.MediaTypeImageLayerEncrypted, ocischema.MediaTypeImageLayerGzipEncrypted, ocischema.MediaTypeImageLayerZstdEncrypted:
+			if err := ocischema.ValidateEncryptedLayer(descriptor); err != nil {
+				errs = append(errs, err)
+			}
+			fallthrough
 		case v1.MediaTypeImageLayer, v1.MediaTypeImageLayerGzip, v1.MediaTypeImageLayerNonDistributable, v1.MediaTypeImageLayerNonDistributableGzip:
-			allow := ms.manifestURLs.allow
-			deny := ms.manifestURLs.deny
+			allow := v.manifestURLs.allow
+			deny := v.manifestURLs.deny
 			for _, u := range descriptor.URLs {
 				var pu *url.URL
 				pu, err = url.Parse(u)
@@ -103,7 +118,7 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 				// check the presence if it is normal layer or
 				// there is no urls for non-distributable
 				if len(descriptor.URLs) == 0 ||
-					(descriptor.MediaType == v1.MediaTypeImageLayer || descriptor.MediaType == v1.MediaTypeImageLayerGzip) {
+					(descriptor.MediaType != v1.MediaTypeImageLayerNonDistributable && descriptor.MediaType != v1.MediaTypeImageLayerNonDistributableGzip) {
 
 					_, err = blobsService.Stat(ctx, descriptor.Digest)
 				}
@@ -117,7 +132,7 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 			}
 
 			if err != nil {
-				dcontext.GetLogger(ms.ctx).WithError(err).Debugf("failed to ensure exists of %v in manifest service", descriptor.Digest)
+				dcontext.GetLogger(ctx).WithError(err).Debugf("failed to ensure exists of %v in manifest service", descriptor.Digest)
 			}
 			fallthrough // double check the blob store.
 		default:
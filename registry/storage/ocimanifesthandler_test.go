@@ -332,3 +332,62 @@ func TestVerifyOCIManifestBlobLayerAndConfig(t *testing.T) {
 		checkFn(m, c.Err)
 	}
 }
+
+func TestVerifyOCIManifestEncryptedLayer(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, strings.ToLower(t.Name()))
+	manifestService := makeManifestService(t, repo)
+
+	config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := repo.Blobs(ctx).Put(ctx, ocischema.MediaTypeImageLayerGzipEncrypted, []byte("ciphertext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]string{
+		ocischema.AnnotationEncryptionKeysPrefix + "jwe": "a2V5cw==",
+		ocischema.AnnotationEncryptionPubOpts:            "cHVib3B0cw==",
+	}
+	for _, tc := range []struct {
+		name        string
+		digest      digest.Digest
+		annotations map[string]string
+		valid       bool
+	}{
+		{"annotated", layer.Digest, keys, true},
+		{"no annotations", layer.Digest, nil, false},
+		{"no key material", layer.Digest, map[string]string{ocischema.AnnotationEncryptionPubOpts: "cHVib3B0cw=="}, false},
+		{"no public options", layer.Digest, map[string]string{ocischema.AnnotationEncryptionKeysPrefix + "jwe": "a2V5cw=="}, false},
+		{"unknown blob", digest.FromString("unknown"), keys, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dm, err := ocischema.FromStruct(ocischema.Manifest{
+				Versioned: ocischema.SchemaVersion,
+				Config:    config,
+				Layers: []distribution.Descriptor{{
+					MediaType:   ocischema.MediaTypeImageLayerGzipEncrypted,
+					Digest:      tc.digest,
+					Size:        layer.Size,
+					Annotations: tc.annotations,
+				}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = manifestService.Put(ctx, dm)
+			if tc.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.valid {
+				if _, ok := err.(distribution.ErrManifestVerification); !ok {
+					t.Fatalf("expected a verification error, got %v", err)
+				}
+			}
+		})
+	}
+}
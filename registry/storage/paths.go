@@ -82,15 +82,27 @@ const (
 //	manifestRevisionsPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/
 //	manifestRevisionPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/
 //	manifestRevisionLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/link
+//	manifestTombstonePathSpec:     <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/tombstone
+//	manifestTransparencyPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/transparency
+//
+//	Referrers:
+//
+//	manifestReferrersPathSpec:     <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/
+//	manifestReferrerLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/<algorithm>/<hex digest>/link
+//	manifestReferrersIndexPathSpec: <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/index.json
 //
 //	Tags:
 //
 //	manifestTagsPathSpec:                  <root>/v2/repositories/<name>/_manifests/tags/
+//	manifestTagsConsolidatedPathSpec:      <root>/v2/repositories/<name>/_manifests/tags.json
 //	manifestTagPathSpec:                   <root>/v2/repositories/<name>/_manifests/tags/<tag>/
 //	manifestTagCurrentPathSpec:            <root>/v2/repositories/<name>/_manifests/tags/<tag>/current/link
+//	manifestTagAliasPathSpec:              <root>/v2/repositories/<name>/_manifests/tags/<tag>/alias
+//	manifestTagCopyPathSpec:               <root>/v2/repositories/<name>/_manifests/tags/<tag>/copy
 //	manifestTagIndexPathSpec:              <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/
 //	manifestTagIndexEntryPathSpec:         <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/
 //	manifestTagIndexEntryLinkPathSpec:     <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/link
+//	manifestTagIndexEntryMetadataPathSpec: <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/metadata
 //
 //	Blobs:
 //
@@ -102,6 +114,20 @@ const (
 //	uploadDataPathSpec:             <root>/v2/repositories/<name>/_uploads/<id>/data
 //	uploadStartedAtPathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/startedat
 //	uploadHashStatePathSpec:        <root>/v2/repositories/<name>/_uploads/<id>/hashstates/<algorithm>/<offset>
+//	manifestUploadDataPathSpec:     <root>/v2/repositories/<name>/_uploads/manifest/<id>/data
+//	manifestUploadStartedAtPathSpec: <root>/v2/repositories/<name>/_uploads/manifest/<id>/startedat
+//
+//	Tag Locks:
+//
+//	tagLockPathSpec:                <root>/v2/_admin/locks/<name>/_tags/<tag>
+//
+//	Archives:
+//
+//	repositoryArchivePathSpec:      <root>/v2/_admin/archives/<name>.json
+//
+//	Health:
+//
+//	healthProbePathSpec:            <root>/v2/_health/probe-<instance>
 //
 //	Blob Store:
 //
@@ -109,6 +135,7 @@ const (
 //	blobPathSpec:                   <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>
 //	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
+//	blobCompressedPathSpec:         <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/.compressed
 //
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
@@ -147,8 +174,53 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "link"), nil
+	case manifestTombstonePathSpec:
+		root, err := pathFor(manifestRevisionPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "tombstone"), nil
+	case manifestTransparencyPathSpec:
+		root, err := pathFor(manifestRevisionPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "transparency"), nil
+	case manifestReferrersPathSpec:
+		components, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(repoPrefix, v.name, "_manifests", "referrers"), components...)...), nil
+	case manifestReferrerLinkPathSpec:
+		root, err := pathFor(manifestReferrersPathSpec{
+			name:    v.name,
+			subject: v.subject,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, path.Join(components...), "link"), nil
+	case manifestReferrersIndexPathSpec:
+		root, err := pathFor(manifestReferrersPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, referrersIndexName), nil
 	case manifestTagsPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_manifests", "tags")...), nil
+	case manifestTagsConsolidatedPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests", "tags.json")...), nil
 	case manifestTagPathSpec:
 		root, err := pathFor(manifestTagsPathSpec{
 			name: v.name,
@@ -165,6 +237,20 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "current", "link"), nil
+	case manifestTagAliasPathSpec:
+		root, err := pathFor(manifestTagPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "alias"), nil
+	case manifestTagCopyPathSpec:
+		root, err := pathFor(manifestTagPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "copy"), nil
 	case manifestTagIndexPathSpec:
 		root, err := pathFor(manifestTagPathSpec(v))
 		if err != nil {
@@ -179,6 +265,13 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "link"), nil
+	case manifestTagIndexEntryMetadataPathSpec:
+		root, err := pathFor(manifestTagIndexEntryPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "metadata"), nil
 	case manifestTagIndexEntryPathSpec:
 		root, err := pathFor(manifestTagIndexPathSpec{
 			name: v.name,
@@ -230,6 +323,15 @@ func pathFor(spec pathSpec) (string, error) {
 		components = append(components, "data")
 		blobPathPrefix := append(rootPrefix, "blobs")
 		return path.Join(append(blobPathPrefix, components...)...), nil
+	case blobCompressedPathSpec:
+		components, err := digestPathComponents(v.digest, true)
+		if err != nil {
+			return "", err
+		}
+
+		components = append(components, ".compressed")
+		blobPathPrefix := append(rootPrefix, "blobs")
+		return path.Join(append(blobPathPrefix, components...)...), nil
 
 	case uploadDataPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "data")...), nil
@@ -241,8 +343,18 @@ func pathFor(spec pathSpec) (string, error) {
 			offset = "" // Limit to the prefix for listing offsets.
 		}
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
+	case manifestUploadDataPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_uploads", "manifest", v.id, "data")...), nil
+	case manifestUploadStartedAtPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_uploads", "manifest", v.id, "startedat")...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
+	case tagLockPathSpec:
+		return path.Join(append(rootPrefix, "_admin", "locks", v.name, "_tags", v.tag)...), nil
+	case repositoryArchivePathSpec:
+		return path.Join(append(rootPrefix, "_admin", "archives", v.name+".json")...), nil
+	case healthProbePathSpec:
+		return path.Join(append(rootPrefix, "_health", "probe-"+v.instance)...), nil
 	default:
 		// TODO(sday): This is an internal error. Ensure it doesn't escape (panic?).
 		return "", fmt.Errorf("unknown path spec: %#v", v)
@@ -284,6 +396,55 @@ type manifestRevisionLinkPathSpec struct {
 
 func (manifestRevisionLinkPathSpec) pathSpec() {}
 
+// manifestTombstonePathSpec describes the path components of the tombstone
+// recording the deletion of a manifest revision. The file holds the time of
+// the deletion, its reason and the manifest replacing the revision, in JSON.
+type manifestTombstonePathSpec struct {
+	name     string
+	revision digest.Digest
+}
+
+func (manifestTombstonePathSpec) pathSpec() {}
+
+// tagLockPathSpec describes the path components of the lock of a tag against
+// being overwritten. Locks are kept apart from the repositories, such that
+// they outlive the deletion of the tags. The tag is the one stored, lowercase
+// when tags are case insensitive. The file holds the time the tag was locked.
+type tagLockPathSpec struct {
+	name string
+	tag  string
+}
+
+func (tagLockPathSpec) pathSpec() {}
+
+// repositoryArchivePathSpec describes the path of the record of the archive
+// of a repository. Records are kept apart from the repositories, as the
+// content of archived repositories may be removed.
+type repositoryArchivePathSpec struct {
+	name string
+}
+
+func (repositoryArchivePathSpec) pathSpec() {}
+
+// healthProbePathSpec describes the path of the file written and read back
+// by the storage health probe of a registry instance. Each instance probes
+// its own file, such that instances sharing the storage do not interfere.
+type healthProbePathSpec struct {
+	instance string
+}
+
+func (healthProbePathSpec) pathSpec() {}
+
+// manifestTransparencyPathSpec describes the path components of the record
+// of a manifest revision in a transparency log. The file holds the URL of
+// the log and the index of the entry of the revision, in JSON.
+type manifestTransparencyPathSpec struct {
+	name     string
+	revision digest.Digest
+}
+
+func (manifestTransparencyPathSpec) pathSpec() {}
+
 // manifestTagsPathSpec describes the path elements required to point to the
 // manifest tags directory.
 type manifestTagsPathSpec struct {
@@ -292,6 +453,43 @@ type manifestTagsPathSpec struct {
 
 func (manifestTagsPathSpec) pathSpec() {}
 
+// manifestTagsConsolidatedPathSpec describes the file holding all the tags of
+// a repository in the consolidated format of the tag store, in JSON.
+type manifestTagsConsolidatedPathSpec struct {
+	name string
+}
+
+func (manifestTagsConsolidatedPathSpec) pathSpec() {}
+
+// manifestReferrersPathSpec describes the directory of the links to the
+// manifests of a repository having subject as their subject.
+type manifestReferrersPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (manifestReferrersPathSpec) pathSpec() {}
+
+// manifestReferrerLinkPathSpec describes the link recording the manifest
+// revision as a referrer of subject. The file holds the digest of the
+// revision. Links are left behind when the revisions are deleted.
+type manifestReferrerLinkPathSpec struct {
+	name     string
+	subject  digest.Digest
+	revision digest.Digest
+}
+
+func (manifestReferrerLinkPathSpec) pathSpec() {}
+
+// manifestReferrersIndexPathSpec describes the index of the referrers of
+// subject, holding their descriptors as an OCI image index.
+type manifestReferrersIndexPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (manifestReferrersIndexPathSpec) pathSpec() {}
+
 // manifestTagPathSpec describes the path elements required to point to the
 // manifest tag links files under a repository. These contain a blob id that
 // can be used to look up the data and signatures.
@@ -311,6 +509,27 @@ type manifestTagCurrentPathSpec struct {
 
 func (manifestTagCurrentPathSpec) pathSpec() {}
 
+// manifestTagAliasPathSpec describes the record of a tag created as an alias
+// of another tag. The file holds the aliased tag and the revision it pointed
+// to when the alias was created, in JSON.
+type manifestTagAliasPathSpec struct {
+	name string
+	tag  string
+}
+
+func (manifestTagAliasPathSpec) pathSpec() {}
+
+// manifestTagCopyPathSpec describes the record of a copy onto a tag from
+// another repository, written before the copy links the manifest and removed
+// once the current link of the tag is written. The file holds the revision
+// copied and the time the copy started, in JSON.
+type manifestTagCopyPathSpec struct {
+	name string
+	tag  string
+}
+
+func (manifestTagCopyPathSpec) pathSpec() {}
+
 // manifestTagCurrentPathSpec describes the link to the index of revisions
 // with the given tag.
 type manifestTagIndexPathSpec struct {
@@ -339,6 +558,17 @@ type manifestTagIndexEntryLinkPathSpec struct {
 
 func (manifestTagIndexEntryLinkPathSpec) pathSpec() {}
 
+// manifestTagIndexEntryMetadataPathSpec describes the metadata recorded when
+// tagging a revision, alongside the link of the index entry, in JSON. The
+// entries of the tags tagged before it was recorded have no metadata.
+type manifestTagIndexEntryMetadataPathSpec struct {
+	name     string
+	tag      string
+	revision digest.Digest
+}
+
+func (manifestTagIndexEntryMetadataPathSpec) pathSpec() {}
+
 // layersPathSpec contains the path for the layers inside a repo
 type layersPathSpec struct {
 	name string
@@ -394,6 +624,15 @@ type blobDataPathSpec struct {
 
 func (blobDataPathSpec) pathSpec() {}
 
+// blobCompressedPathSpec contains the path for the marker file written next
+// to the data of a blob stored gzip compressed. The marker holds the size of
+// the uncompressed content.
+type blobCompressedPathSpec struct {
+	digest digest.Digest
+}
+
+func (blobCompressedPathSpec) pathSpec() {}
+
 // uploadDataPathSpec defines the path parameters of the data file for
 // uploads.
 type uploadDataPathSpec struct {
@@ -417,6 +656,25 @@ type uploadStartedAtPathSpec struct {
 
 func (uploadStartedAtPathSpec) pathSpec() {}
 
+// manifestUploadDataPathSpec defines the path parameters of the data file
+// for manifest uploads.
+type manifestUploadDataPathSpec struct {
+	name string
+	id   string
+}
+
+func (manifestUploadDataPathSpec) pathSpec() {}
+
+// manifestUploadStartedAtPathSpec defines the path parameters for the file
+// that stores the start time of a manifest upload. As with blob uploads, it
+// lets PurgeUploads clean up stalled sessions.
+type manifestUploadStartedAtPathSpec struct {
+	name string
+	id   string
+}
+
+func (manifestUploadStartedAtPathSpec) pathSpec() {}
+
 // uploadHashStatePathSpec defines the path parameters for the file that stores
 // the hash function state of an upload at a specific byte offset. If `list` is
 // set, then the path mapper will generate a list prefix for all hash state
@@ -31,6 +31,12 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags",
 		},
+		{
+			spec: manifestTagsConsolidatedPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags.json",
+		},
 		{
 			spec: manifestTagPathSpec{
 				name: "foo/bar",
@@ -45,6 +51,13 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/current/link",
 		},
+		{
+			spec: manifestTagCopyPathSpec{
+				name: "foo/bar",
+				tag:  "thetag",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/copy",
+		},
 		{
 			spec: manifestTagIndexPathSpec{
 				name: "foo/bar",
@@ -68,6 +81,14 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/index/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
+		{
+			spec: manifestTagIndexEntryMetadataPathSpec{
+				name:     "foo/bar",
+				tag:      "thetag",
+				revision: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/index/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/metadata",
+		},
 
 		{
 			spec: uploadDataPathSpec{
@@ -83,10 +104,28 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/asdf-asdf-asdf-adsf/startedat",
 		},
+		{
+			spec: manifestUploadDataPathSpec{
+				name: "foo/bar",
+				id:   "asdf-asdf-asdf-adsf",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/manifest/asdf-asdf-asdf-adsf/data",
+		},
+		{
+			spec: manifestUploadStartedAtPathSpec{
+				name: "foo/bar",
+				id:   "asdf-asdf-asdf-adsf",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/manifest/asdf-asdf-asdf-adsf/startedat",
+		},
 		{
 			spec:     layersPathSpec{name: "foo/bar"},
 			expected: "/docker/registry/v2/repositories/foo/bar/_layers",
 		},
+		{
+			spec:     healthProbePathSpec{instance: "host-42"},
+			expected: "/docker/registry/v2/_health/probe-host-42",
+		},
 	} {
 		p, err := pathFor(testcase.spec)
 		if err != nil {
@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"gopkg.in/yaml.v2"
+)
+
+// File is the content of a policy file, such as
+//
+//	rules:
+//	  - repositories: "library/.*"
+//	    keeplatest: 10
+//	    keepnewerthan: 720h
+//	    keepmatching: "latest|v[0-9]+(\.[0-9]+)*"
+type File struct {
+	// Rules lists the rules of the policy.
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule retains the tags of the repositories it applies to which any of its
+// criteria retains.
+type Rule struct {
+	// Repositories is a regular expression matching in full the names of
+	// the repositories the rule applies to. Empty applies the rule to all
+	// the repositories.
+	Repositories string `yaml:"repositories,omitempty"`
+
+	// KeepLatest is the number of most recently tagged tags retained.
+	KeepLatest int `yaml:"keeplatest,omitempty"`
+
+	// KeepNewerThan retains the tags tagged more recently than this.
+	KeepNewerThan time.Duration `yaml:"keepnewerthan,omitempty"`
+
+	// KeepMatching is a regular expression retaining the tags it matches in
+	// full.
+	KeepMatching string `yaml:"keepmatching,omitempty"`
+}
+
+// Parse reads a policy file from r and returns its policy. A tag is
+// retained when any of the rules applying to its repository retains it, or
+// when no rule applies to its repository.
+func Parse(r io.Reader) (TagPolicy, error) {
+	in, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	if err := yaml.UnmarshalStrict(in, &file); err != nil {
+		return nil, fmt.Errorf("invalid policy file: %v", err)
+	}
+	return file.Policy()
+}
+
+// Policy returns the policy of the rules of f.
+func (f File) Policy() (TagPolicy, error) {
+	if len(f.Rules) == 0 {
+		return nil, fmt.Errorf("the policy file has no rules")
+	}
+	rules := make(rulesPolicy, 0, len(f.Rules))
+	for i, rule := range f.Rules {
+		r, err := rule.policy()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %v", i, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// ruleScope is a rule applying its policy to the repositories matching
+// repositories.
+type ruleScope struct {
+	repositories *regexp.Regexp
+	policy       TagPolicy
+}
+
+func (rule Rule) policy() (ruleScope, error) {
+	var scope ruleScope
+	if rule.Repositories != "" {
+		re, err := regexp.Compile("^(?:" + rule.Repositories + ")$")
+		if err != nil {
+			return scope, fmt.Errorf("invalid repositories pattern %q: %v", rule.Repositories, err)
+		}
+		scope.repositories = re
+	}
+
+	var policies []TagPolicy
+	if rule.KeepLatest < 0 {
+		return scope, fmt.Errorf("keeplatest must not be negative")
+	}
+	if rule.KeepLatest > 0 {
+		policies = append(policies, KeepLatestN(rule.KeepLatest))
+	}
+	if rule.KeepNewerThan < 0 {
+		return scope, fmt.Errorf("keepnewerthan must not be negative")
+	}
+	if rule.KeepNewerThan > 0 {
+		policies = append(policies, KeepNewerThan(rule.KeepNewerThan))
+	}
+	if rule.KeepMatching != "" {
+		p, err := KeepMatchingPattern(rule.KeepMatching)
+		if err != nil {
+			return scope, fmt.Errorf("invalid keepmatching pattern %q: %v", rule.KeepMatching, err)
+		}
+		policies = append(policies, p)
+	}
+	// A rule retaining nothing would remove all the tags it applies to,
+	// which is far more likely a mistake than intended.
+	if len(policies) == 0 {
+		return scope, fmt.Errorf("the rule must set keeplatest, keepnewerthan or keepmatching")
+	}
+	scope.policy = Any(policies...)
+	return scope, nil
+}
+
+func (rule ruleScope) appliesTo(repo reference.Named) bool {
+	return rule.repositories == nil || rule.repositories.MatchString(repo.Name())
+}
+
+type rulesPolicy []ruleScope
+
+func (rules rulesPolicy) ShouldRetain(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor, age time.Duration) (bool, error) {
+	applied := false
+	retain := false
+	for _, rule := range rules {
+		if !rule.appliesTo(repo) {
+			continue
+		}
+		applied = true
+		retained, err := rule.policy.ShouldRetain(ctx, repo, tag, desc, age)
+		if err != nil {
+			return false, err
+		}
+		retain = retain || retained
+	}
+	return retain || !applied, nil
+}
@@ -0,0 +1,92 @@
+// Package policy provides the tag policies deciding which tags the garbage
+// collector retains, and the policy files configuring them.
+package policy
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+)
+
+// TagPolicy decides which tags are retained.
+type TagPolicy interface {
+	// ShouldRetain reports whether tag of repo is retained, given the
+	// descriptor of the manifest it references and the time elapsed since
+	// it was last tagged. The tags of a repository are evaluated in turn,
+	// from the most recently to the least recently tagged.
+	ShouldRetain(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor, age time.Duration) (bool, error)
+}
+
+type keepLatestN struct {
+	n int
+
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+// KeepLatestN returns a policy retaining the n most recently tagged tags of
+// each repository. It counts the tags of each repository it evaluates, so a
+// new policy must be used for every evaluation of all the tags.
+func KeepLatestN(n int) TagPolicy {
+	return &keepLatestN{n: n, seen: make(map[string]int)}
+}
+
+func (p *keepLatestN) ShouldRetain(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor, age time.Duration) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seen[repo.Name()]++
+	return p.seen[repo.Name()] <= p.n, nil
+}
+
+type keepNewerThan time.Duration
+
+// KeepNewerThan returns a policy retaining the tags tagged less than d ago.
+func KeepNewerThan(d time.Duration) TagPolicy {
+	return keepNewerThan(d)
+}
+
+func (p keepNewerThan) ShouldRetain(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor, age time.Duration) (bool, error) {
+	return age < time.Duration(p), nil
+}
+
+type keepMatchingPattern struct {
+	pattern *regexp.Regexp
+}
+
+// KeepMatchingPattern returns a policy retaining the tags matching the
+// regular expression pattern in full.
+func KeepMatchingPattern(pattern string) (TagPolicy, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return keepMatchingPattern{pattern: re}, nil
+}
+
+func (p keepMatchingPattern) ShouldRetain(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor, age time.Duration) (bool, error) {
+	return p.pattern.MatchString(tag), nil
+}
+
+type anyPolicy []TagPolicy
+
+// Any returns a policy retaining the tags retained by any of policies. Every
+// one of policies evaluates every tag, such that KeepLatestN counts them all.
+func Any(policies ...TagPolicy) TagPolicy {
+	return anyPolicy(policies)
+}
+
+func (p anyPolicy) ShouldRetain(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor, age time.Duration) (bool, error) {
+	retain := false
+	for _, policy := range p {
+		retained, err := policy.ShouldRetain(ctx, repo, tag, desc, age)
+		if err != nil {
+			return false, err
+		}
+		retain = retain || retained
+	}
+	return retain, nil
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+)
+
+type tagAge struct {
+	tag string
+	age time.Duration
+}
+
+func retained(t *testing.T, p TagPolicy, repoName string, tags []tagAge) []string {
+	t.Helper()
+	repo, err := reference.WithName(repoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, ta := range tags {
+		retain, err := p.ShouldRetain(context.Background(), repo, ta.tag, distribution.Descriptor{}, ta.age)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if retain {
+			kept = append(kept, ta.tag)
+		}
+	}
+	return kept
+}
+
+func TestParse(t *testing.T) {
+	tags := []tagAge{
+		{"nightly-3", time.Hour},
+		{"nightly-2", 48 * time.Hour},
+		{"v1.0", 100 * time.Hour},
+		{"nightly-1", 200 * time.Hour},
+		{"latest", 300 * time.Hour},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		policy   string
+		repo     string
+		expected []string
+	}{
+		{
+			name:     "keeplatest",
+			policy:   "rules:\n  - keeplatest: 2\n",
+			repo:     "library/app",
+			expected: []string{"nightly-3", "nightly-2"},
+		},
+		{
+			name:     "keepnewerthan",
+			policy:   "rules:\n  - keepnewerthan: 72h\n",
+			repo:     "library/app",
+			expected: []string{"nightly-3", "nightly-2"},
+		},
+		{
+			name:     "keepmatching",
+			policy:   "rules:\n  - keepmatching: \"latest|v[0-9.]+\"\n",
+			repo:     "library/app",
+			expected: []string{"v1.0", "latest"},
+		},
+		{
+			name:     "combined",
+			policy:   "rules:\n  - keeplatest: 1\n    keepmatching: \"latest\"\n",
+			repo:     "library/app",
+			expected: []string{"nightly-3", "latest"},
+		},
+		{
+			name:     "repository not matched",
+			policy:   "rules:\n  - repositories: \"library/.*\"\n    keeplatest: 1\n",
+			repo:     "other/app",
+			expected: []string{"nightly-3", "nightly-2", "v1.0", "nightly-1", "latest"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Parse(strings.NewReader(tc.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := retained(t, p, tc.repo, tags)
+			if strings.Join(kept, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected %v to be retained, got %v", tc.expected, kept)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, policy := range []string{
+		"",
+		"rules:\n  - repositories: \"library/.*\"\n",
+		"rules:\n  - keeplatest: -1\n",
+		"rules:\n  - keepmatching: \"(\"\n",
+		"rules:\n  - keeplast: 1\n",
+	} {
+		if _, err := Parse(strings.NewReader(policy)); err == nil {
+			t.Errorf("expected an error parsing %q", policy)
+		}
+	}
+}
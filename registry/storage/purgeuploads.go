@@ -39,6 +39,7 @@ func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, older
 			logrus.Infof("Upload files in %s have older date (%s) than purge date (%s).  Removing upload directory.",
 				uploadData.containingDir, uploadData.startedAt, olderThan)
 			if actuallyDelete {
+				cancelUploadData(ctx, driver, uploadData.containingDir)
 				err = driver.Delete(ctx, uploadData.containingDir)
 			}
 			if err == nil {
@@ -53,6 +54,23 @@ func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, older
 	return deleted, errors
 }
 
+// cancelUploadData cancels the writer of the data of the upload in
+// containingDir, which releases what the driver keeps besides the data, such
+// as the multipart upload of the S3 driver. Errors are only logged, the
+// upload directory being deleted next.
+func cancelUploadData(ctx context.Context, driver storageDriver.StorageDriver, containingDir string) {
+	fw, err := driver.Writer(ctx, path.Join(containingDir, "data"), true)
+	if err != nil {
+		if _, ok := err.(storageDriver.PathNotFoundError); !ok {
+			logrus.Warnf("Error resuming the upload data in %s: %v", containingDir, err)
+		}
+		return
+	}
+	if err := fw.Cancel(); err != nil {
+		logrus.Warnf("Error cancelling the upload data in %s: %v", containingDir, err)
+	}
+}
+
 // getOutstandingUploads walks the upload directory, collecting files
 // which could be eligible for deletion.  The only reliable way to
 // classify the age of a file is with the date stored in the startedAt
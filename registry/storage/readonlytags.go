@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+)
+
+// ReadOnlyTagStore is a TagService which never writes, for registries in
+// read-only mode. The calls which would modify the tags return
+// distribution.ErrReadOnly, and the others, including those of the extensions
+// of TagService, are left to the TagService it embeds.
+type ReadOnlyTagStore struct {
+	distribution.TagService
+}
+
+var (
+	_ distribution.AdvancedTagService   = &ReadOnlyTagStore{}
+	_ distribution.BatchTagService      = &ReadOnlyTagStore{}
+	_ distribution.StreamingTagService  = &ReadOnlyTagStore{}
+	_ distribution.TagAliaser           = &ReadOnlyTagStore{}
+	_ distribution.TagMetadataProvider  = &ReadOnlyTagStore{}
+	_ distribution.TagManifestsProvider = &ReadOnlyTagStore{}
+)
+
+// Tag returns distribution.ErrReadOnly.
+func (ts *ReadOnlyTagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor, opts ...distribution.TagOption) error {
+	return distribution.ErrReadOnly
+}
+
+// Untag returns distribution.ErrReadOnly.
+func (ts *ReadOnlyTagStore) Untag(ctx context.Context, tag string) error {
+	return distribution.ErrReadOnly
+}
+
+// Rename returns distribution.ErrReadOnly.
+func (ts *ReadOnlyTagStore) Rename(ctx context.Context, src string, dst string) error {
+	return distribution.ErrReadOnly
+}
+
+// Copy returns distribution.ErrReadOnly.
+func (ts *ReadOnlyTagStore) Copy(ctx context.Context, src distribution.Repository, srcTag string, dstTag string) error {
+	return distribution.ErrReadOnly
+}
+
+// UntagBatch removes none of the tags, returning distribution.ErrReadOnly
+// for each of them.
+func (ts *ReadOnlyTagStore) UntagBatch(ctx context.Context, tags []string) (int, []error) {
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	errs := make([]error, len(tags))
+	for i := range errs {
+		errs[i] = distribution.ErrReadOnly
+	}
+	return 0, errs
+}
+
+// CreateAlias returns distribution.ErrReadOnly.
+func (ts *ReadOnlyTagStore) CreateAlias(ctx context.Context, srcTag, aliasTag string) error {
+	return distribution.ErrReadOnly
+}
+
+// Aliases returns the aliases recorded by the embedded TagService, or
+// distribution.ErrUnsupported if it records none.
+func (ts *ReadOnlyTagStore) Aliases(ctx context.Context) (map[string]string, error) {
+	aliaser, ok := ts.TagService.(distribution.TagAliaser)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+	return aliaser.Aliases(ctx)
+}
+
+// GetMetadata returns the metadata of tag recorded by the embedded
+// TagService, or distribution.ErrUnsupported if it records none.
+func (ts *ReadOnlyTagStore) GetMetadata(ctx context.Context, tag string) (distribution.TagMetadata, error) {
+	provider, ok := ts.TagService.(distribution.TagMetadataProvider)
+	if !ok {
+		return distribution.TagMetadata{}, distribution.ErrUnsupported
+	}
+	return provider.GetMetadata(ctx, tag)
+}
+
+// ManifestDigests returns the digests tag pointed to from the embedded
+// TagService, or distribution.ErrUnsupported if it does not record them.
+func (ts *ReadOnlyTagStore) ManifestDigests(ctx context.Context, tag string) ([]digest.Digest, error) {
+	provider, ok := ts.TagService.(distribution.TagManifestsProvider)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+	return provider.ManifestDigests(ctx, tag)
+}
+
+// LookupStream streams the tags referencing desc from the embedded
+// TagService, sending the result of its Lookup if it does not stream them.
+func (ts *ReadOnlyTagStore) LookupStream(ctx context.Context, desc distribution.Descriptor, opts ...distribution.LookupOption) (<-chan string, <-chan error) {
+	if streaming, ok := ts.TagService.(distribution.StreamingTagService); ok {
+		return streaming.LookupStream(ctx, desc, opts...)
+	}
+
+	found := make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(found)
+		tags, err := ts.TagService.Lookup(ctx, desc, opts...)
+		if err != nil {
+			errs <- err
+			return
+		}
+		for _, tag := range tags {
+			select {
+			case found <- tag:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return found, errs
+}
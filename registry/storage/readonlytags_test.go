@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestReadOnlyTagStore(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	dgst := digest.FromString("latest")
+	repo := makeRepository(t, createRegistry(t, d), "a/b")
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo = makeRepository(t, createRegistry(t, d, ReadOnlyTags), "a/b")
+	ts := repo.Tags(ctx)
+	if _, ok := ts.(*ReadOnlyTagStore); !ok {
+		t.Fatalf("unexpected tag service %T in read-only mode", ts)
+	}
+
+	desc, err := ts.Get(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != dgst {
+		t.Fatalf("unexpected digest %s, expected %s", desc.Digest, dgst)
+	}
+	tags, err := ts.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "latest" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	tags, err = ts.Lookup(ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "latest" {
+		t.Fatalf("unexpected tags referencing %s: %v", dgst, tags)
+	}
+
+	if err := ts.Tag(ctx, "other", distribution.Descriptor{Digest: dgst}); err != distribution.ErrReadOnly {
+		t.Fatalf("unexpected error tagging in read-only mode: %v", err)
+	}
+	if err := ts.Untag(ctx, "latest"); err != distribution.ErrReadOnly {
+		t.Fatalf("unexpected error untagging in read-only mode: %v", err)
+	}
+	if err := ts.Rename(ctx, "latest", "other"); err != distribution.ErrReadOnly {
+		t.Fatalf("unexpected error renaming in read-only mode: %v", err)
+	}
+	if err := ts.(distribution.AdvancedTagService).Copy(ctx, repo, "latest", "other"); err != distribution.ErrReadOnly {
+		t.Fatalf("unexpected error copying in read-only mode: %v", err)
+	}
+	if err := ts.(distribution.TagAliaser).CreateAlias(ctx, "latest", "other"); err != distribution.ErrReadOnly {
+		t.Fatalf("unexpected error creating an alias in read-only mode: %v", err)
+	}
+	if n, errs := ts.(distribution.BatchTagService).UntagBatch(ctx, []string{"latest"}); n != 0 || len(errs) != 1 || errs[0] != distribution.ErrReadOnly {
+		t.Fatalf("unexpected result untagging in batch in read-only mode: %d, %v", n, errs)
+	}
+	if _, err := ts.Get(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error getting the tag after the writes were refused: %v", err)
+	}
+
+	// The read-only extensions are left to the tag store.
+	if _, err := ts.(distribution.TagMetadataProvider).GetMetadata(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error getting the metadata of the tag: %v", err)
+	}
+	if aliases, err := ts.(distribution.TagAliaser).Aliases(ctx); err != nil || len(aliases) != 0 {
+		t.Fatalf("unexpected aliases %v, %v", aliases, err)
+	}
+	tags, err = distribution.LookupStreamToSlice(ctx, ts.(distribution.StreamingTagService), distribution.Descriptor{Digest: dgst})
+	if err != nil || len(tags) != 1 || tags[0] != "latest" {
+		t.Fatalf("unexpected tags streamed referencing %s: %v, %v", dgst, tags, err)
+	}
+}
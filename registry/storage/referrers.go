@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/uuid"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// referrersIndexName is the name of the index of the referrers of a
+// manifest, beside their links.
+const referrersIndexName = "index.json"
+
+// referrersIndex is the index of the referrers of a manifest, stored as an
+// OCI image index.
+type referrersIndex struct {
+	SchemaVersion int                       `json:"schemaVersion"`
+	MediaType     string                    `json:"mediaType"`
+	Manifests     []distribution.Descriptor `json:"manifests"`
+}
+
+// linkReferrer records the manifest dgst of the repository name as a
+// referrer of subject.
+func linkReferrer(ctx context.Context, d driver.StorageDriver, name string, subject, dgst digest.Digest) error {
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     name,
+		subject:  subject,
+		revision: dgst,
+	})
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, linkPath, []byte(dgst))
+}
+
+// Referrers returns the digests of the manifests of repo having subject as
+// their subject, in no particular order. Manifests deleted since they were
+// stored are left out. Repositories not returned by a registry of this
+// package return distribution.ErrUnsupported.
+func Referrers(ctx context.Context, repo distribution.Repository, subject digest.Digest) ([]digest.Digest, error) {
+	r, ok := repo.(*repository)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+	root, err := pathFor(manifestReferrersPathSpec{
+		name:    r.Named().Name(),
+		subject: subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	algorithms, err := r.driver.List(ctx, root)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ms, err := r.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var referrers []digest.Digest
+	for _, algorithm := range algorithms {
+		// The index and its updates in progress sit beside the
+		// links.
+		if strings.HasPrefix(path.Base(algorithm), referrersIndexName) {
+			continue
+		}
+		revisions, err := r.driver.List(ctx, algorithm)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		for _, revision := range revisions {
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(path.Base(algorithm)), path.Base(revision))
+			if err := dgst.Validate(); err != nil {
+				continue
+			}
+			exists, err := ms.Exists(ctx, dgst)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				referrers = append(referrers, dgst)
+			}
+		}
+	}
+	return referrers, nil
+}
+
+// referrerDescriptor returns the descriptor of the manifest m stored as dgst
+// in the index of the referrers of its subject, typed by its artifact type or
+// else the media type of its config.
+func referrerDescriptor(m *ocischema.DeserializedManifest, dgst digest.Digest) (distribution.Descriptor, error) {
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	artifactType := m.ArtifactType
+	if artifactType == "" {
+		artifactType = m.Config.MediaType
+	}
+	return distribution.Descriptor{
+		MediaType:    mediaType,
+		ArtifactType: artifactType,
+		Digest:       dgst,
+		Size:         int64(len(payload)),
+		Annotations:  m.Annotations,
+	}, nil
+}
+
+// readReferrersIndex returns the index of the referrers of subject in the
+// repository name, which is empty if no referrer was indexed.
+func readReferrersIndex(ctx context.Context, d driver.StorageDriver, name string, subject digest.Digest) (referrersIndex, error) {
+	index := referrersIndex{
+		SchemaVersion: 2,
+		MediaType:     v1.MediaTypeImageIndex,
+	}
+	indexPath, err := pathFor(manifestReferrersIndexPathSpec{
+		name:    name,
+		subject: subject,
+	})
+	if err != nil {
+		return index, err
+	}
+	content, err := d.GetContent(ctx, indexPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return index, nil
+		}
+		return index, err
+	}
+	if err := json.Unmarshal(content, &index); err != nil {
+		return index, fmt.Errorf("invalid referrers index %s: %v", indexPath, err)
+	}
+	return index, nil
+}
+
+// indexReferrer adds the descriptor of a referrer of subject to its index in
+// the repository name, replacing the previous descriptor of the same
+// manifest. The index is replaced at once by moving the updated index over
+// it, under the lock of the index on drivers able to lock.
+func indexReferrer(ctx context.Context, d driver.StorageDriver, name string, subject digest.Digest, desc distribution.Descriptor) error {
+	indexPath, err := pathFor(manifestReferrersIndexPathSpec{
+		name:    name,
+		subject: subject,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Instances sharing the storage could otherwise lose the referrers
+	// indexed by one another.
+	if locker, ok := d.(driver.LockableDriver); ok {
+		unlock, err := locker.Lock(ctx, indexPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	index, err := readReferrersIndex(ctx, d, name, subject)
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i, referrer := range index.Manifests {
+		if referrer.Digest == desc.Digest {
+			index.Manifests[i] = desc
+			replaced = true
+		}
+	}
+	if !replaced {
+		index.Manifests = append(index.Manifests, desc)
+	}
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := indexPath + "." + uuid.Generate().String()
+	if err := d.PutContent(ctx, tmpPath, content); err != nil {
+		return err
+	}
+	if err := d.Move(ctx, tmpPath, indexPath); err != nil {
+		d.Delete(ctx, tmpPath)
+		return err
+	}
+	return nil
+}
+
+// referrersStore is the ReferrersService of a repository, listing the
+// referrers from their indexes.
+type referrersStore struct {
+	repository *repository
+}
+
+var _ distribution.ReferrersService = &referrersStore{}
+
+// NewReferrersService returns the ReferrersService of repo. Repositories not
+// returned by a registry of this package return distribution.ErrUnsupported.
+func NewReferrersService(repo distribution.Repository) (distribution.ReferrersService, error) {
+	r, ok := repo.(*repository)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+	return &referrersStore{repository: r}, nil
+}
+
+// List returns the descriptors of the referrers of dgst. Manifests deleted
+// since they were indexed are left out, as are the referrers pushed before
+// the indexes were introduced, until MigrateReferrers indexes them.
+func (rs *referrersStore) List(ctx context.Context, dgst digest.Digest) ([]distribution.Descriptor, error) {
+	index, err := readReferrersIndex(ctx, rs.repository.driver, rs.repository.Named().Name(), dgst)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := rs.repository.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	referrers := make([]distribution.Descriptor, 0, len(index.Manifests))
+	for _, referrer := range index.Manifests {
+		exists, err := ms.Exists(ctx, referrer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			referrers = append(referrers, referrer)
+		}
+	}
+	return referrers, nil
+}
+
+// MigrateReferrers indexes the referrers of the manifests of all the
+// repositories of registry, such as those pushed before the indexes were
+// introduced. Referrers already indexed are left as they are, so that the
+// migration may be run again on a registry in use.
+func MigrateReferrers(ctx context.Context, registry distribution.Namespace) error {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	return repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+		r, ok := repo.(*repository)
+		if !ok {
+			return distribution.ErrUnsupported
+		}
+		manifestService, err := r.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %v", err)
+		}
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+		}
+
+		indexed := 0
+		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			manifest, err := manifestService.Get(ctx, dgst)
+			if err != nil {
+				// The revisions of deleted manifests are enumerated
+				// as long as their tombstones are kept.
+				if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+					return nil
+				}
+				return fmt.Errorf("failed to retrieve manifest %s: %v", dgst, err)
+			}
+			om, ok := manifest.(*ocischema.DeserializedManifest)
+			if !ok || om.Subject == nil {
+				return nil
+			}
+
+			index, err := readReferrersIndex(ctx, r.driver, repoName, om.Subject.Digest)
+			if err != nil {
+				return err
+			}
+			for _, referrer := range index.Manifests {
+				if referrer.Digest == dgst {
+					return nil
+				}
+			}
+			desc, err := referrerDescriptor(om, dgst)
+			if err != nil {
+				return err
+			}
+			if err := linkReferrer(ctx, r.driver, repoName, om.Subject.Digest, dgst); err != nil {
+				return err
+			}
+			if err := indexReferrer(ctx, r.driver, repoName, om.Subject.Digest, desc); err != nil {
+				return err
+			}
+			indexed++
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate the referrers of %s: %v", repoName, err)
+		}
+		dcontext.GetLogger(ctx).Infof("%s: %d referrers indexed", repoName, indexed)
+		return nil
+	})
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+	repo := makeRepository(t, createRegistry(t, inmemory.New()), "foo/referrers")
+
+	img := uploadRandomSchema2Image(t, repo)
+	_, payload, err := img.manifest.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := distribution.Descriptor{MediaType: "application/vnd.docker.distribution.manifest.v2+json", Digest: img.manifestDigest, Size: int64(len(payload))}
+	signature := putArtifact(t, repo, "application/vnd.example.signature", image)
+	sbom := putArtifact(t, repo, "application/vnd.example.sbom", image)
+	attestation := putArtifact(t, repo, "application/vnd.example.attestation", signature)
+
+	referrers, err := Referrers(ctx, repo, image.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(referrers, func(i, j int) bool { return referrers[i] < referrers[j] })
+	expected := []digest.Digest{signature.Digest, sbom.Digest}
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+	if len(referrers) != len(expected) || referrers[0] != expected[0] || referrers[1] != expected[1] {
+		t.Fatalf("unexpected referrers of the image: %v != %v", referrers, expected)
+	}
+
+	referrers, err = Referrers(ctx, repo, signature.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0] != attestation.Digest {
+		t.Fatalf("unexpected referrers of the signature: %v", referrers)
+	}
+
+	// Deleted referrers are left out.
+	if err := makeManifestService(t, repo).Delete(ctx, sbom.Digest); err != nil {
+		t.Fatal(err)
+	}
+	referrers, err = Referrers(ctx, repo, image.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0] != signature.Digest {
+		t.Fatalf("unexpected referrers of the image after deleting the sbom: %v", referrers)
+	}
+
+	referrers, err = Referrers(ctx, repo, digest.FromString("never pushed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 0 {
+		t.Fatalf("expected no referrers of a missing manifest, got %v", referrers)
+	}
+}
+
+func TestReferrersService(t *testing.T) {
+	ctx := context.Background()
+	repo := makeRepository(t, createRegistry(t, inmemory.New()), "foo/referrers")
+
+	img := uploadRandomSchema2Image(t, repo)
+	_, payload, err := img.manifest.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := distribution.Descriptor{MediaType: "application/vnd.docker.distribution.manifest.v2+json", Digest: img.manifestDigest, Size: int64(len(payload))}
+	signature := putArtifact(t, repo, "application/vnd.example.signature", image)
+	sbom := putArtifact(t, repo, "application/vnd.example.sbom", image)
+	putArtifact(t, repo, "application/vnd.example.attestation", signature)
+
+	rs, err := NewReferrersService(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := rs.List(ctx, image.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 2 {
+		t.Fatalf("expected 2 referrers of the image, got %v", referrers)
+	}
+	for i, expected := range []struct {
+		desc         distribution.Descriptor
+		artifactType string
+	}{
+		{signature, "application/vnd.example.signature"},
+		{sbom, "application/vnd.example.sbom"},
+	} {
+		referrer := referrers[i]
+		if referrer.Digest != expected.desc.Digest || referrer.Size != expected.desc.Size || referrer.MediaType != v1.MediaTypeImageManifest {
+			t.Fatalf("unexpected referrer %d: %+v != %+v", i, referrer, expected.desc)
+		}
+		if referrer.ArtifactType != expected.artifactType {
+			t.Fatalf("unexpected artifact type of referrer %d: %q != %q", i, referrer.ArtifactType, expected.artifactType)
+		}
+		if referrer.Annotations["subject"] != image.Digest.String() {
+			t.Fatalf("expected the annotations of referrer %d to be indexed, got %v", i, referrer.Annotations)
+		}
+	}
+
+	// Pushing a referrer again does not index it twice.
+	putArtifact(t, repo, "application/vnd.example.signature", image)
+	referrers, err = rs.List(ctx, image.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 2 {
+		t.Fatalf("expected 2 referrers of the image after pushing one again, got %v", referrers)
+	}
+
+	// Deleted referrers are left out.
+	if err := makeManifestService(t, repo).Delete(ctx, signature.Digest); err != nil {
+		t.Fatal(err)
+	}
+	referrers, err = rs.List(ctx, image.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 1 || referrers[0].Digest != sbom.Digest {
+		t.Fatalf("unexpected referrers of the image after deleting the signature: %v", referrers)
+	}
+
+	referrers, err = rs.List(ctx, digest.FromString("never pushed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 0 {
+		t.Fatalf("expected no referrers of a missing manifest, got %v", referrers)
+	}
+}
+
+func TestMigrateReferrers(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry := createRegistry(t, d)
+	repo := makeRepository(t, registry, "foo/referrers")
+
+	img := uploadRandomSchema2Image(t, repo)
+	_, payload, err := img.manifest.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := distribution.Descriptor{MediaType: "application/vnd.docker.distribution.manifest.v2+json", Digest: img.manifestDigest, Size: int64(len(payload))}
+	signature := putArtifact(t, repo, "application/vnd.example.signature", image)
+	attestation := putArtifact(t, repo, "application/vnd.example.attestation", signature)
+
+	// Referrers pushed before the indexes were introduced are not listed.
+	for _, subject := range []digest.Digest{image.Digest, signature.Digest} {
+		indexPath, err := pathFor(manifestReferrersIndexPathSpec{name: "foo/referrers", subject: subject})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Delete(ctx, indexPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rs, err := NewReferrersService(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referrers, err := rs.List(ctx, image.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 0 {
+		t.Fatalf("expected no referrers before the migration, got %v", referrers)
+	}
+
+	// Migrating twice indexes each referrer once.
+	for i := 0; i < 2; i++ {
+		if err := MigrateReferrers(ctx, registry); err != nil {
+			t.Fatalf("unexpected error migrating referrers: %v", err)
+		}
+	}
+	for subject, expected := range map[digest.Digest]digest.Digest{
+		image.Digest:     signature.Digest,
+		signature.Digest: attestation.Digest,
+	} {
+		referrers, err := rs.List(ctx, subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(referrers) != 1 || referrers[0].Digest != expected {
+			t.Fatalf("unexpected referrers of %s after the migration: %v", subject, referrers)
+		}
+	}
+}
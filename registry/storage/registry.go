@@ -2,13 +2,16 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/distribution/distribution/v3/registry/storage/cache"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/docker/libtrust"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // registry is the top-level implementation of Registry for use in the storage
@@ -16,6 +19,8 @@ import (
 type registry struct {
 	blobStore                    *blobStore
 	blobServer                   *blobServer
+	singleFlight                 *SingleFlightBlobServer
+	existenceCache               *existenceCache
 	statter                      *blobStatter // global statter service.
 	blobDescriptorCacheProvider  cache.BlobDescriptorCacheProvider
 	deleteEnabled                bool
@@ -25,6 +30,17 @@ type registry struct {
 	blobDescriptorServiceFactory distribution.BlobDescriptorServiceFactory
 	manifestURLs                 manifestURLs
 	driver                       storagedriver.StorageDriver
+	compressManifests            bool
+	manifestValidators           ManifestValidators
+	manifestFilters              *manifestFilters
+	tombstonesEnabled            bool
+	caseInsensitiveTags          bool
+	tagCollisionCheck            TagCollisionCheck
+	readOnlyTags                 bool
+	tagObservers                 FanoutTagObserver
+	tagLinkRetries               int
+	tagLinkRetryDelay            time.Duration
+	tagMetrics                   *tagStoreMetrics
 }
 
 // manifestURLs holds regular expressions for controlling manifest URL whitelisting
@@ -43,6 +59,78 @@ func EnableRedirect(registry *registry) error {
 	return nil
 }
 
+// RedirectExpiry returns a functional option for NewRegistry. It extends the
+// expiry of redirect URLs for blobs which clients, downloading bandwidth
+// bytes per second, may not download before the default expiry. The expiry
+// is bounded by maxExpiry, and downloads which may outlive it are redirected
+// such that clients come back to the registry for a fresh URL.
+func RedirectExpiry(bandwidth int64, maxExpiry time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		registry.blobServer.redirectBandwidth = bandwidth
+		registry.blobServer.redirectMaxExpiry = maxExpiry
+		return nil
+	}
+}
+
+// VerifyBlobsOnRead is a functional option for NewRegistry. It verifies the
+// content of blobs served in full against their digest, to detect the
+// corruption of the storage. Blobs redirected to the storage backend are not
+// verified.
+func VerifyBlobsOnRead(registry *registry) error {
+	registry.blobServer.verify = true
+	return nil
+}
+
+// CompressManifests is a functional option for NewRegistry. It stores newly
+// pushed manifests gzip compressed. Digests and sizes continue to describe the
+// uncompressed content, and compressed manifests are decompressed on read.
+func CompressManifests(registry *registry) error {
+	registry.compressManifests = true
+	return nil
+}
+
+// SingleFlightBlobs returns a functional option for NewRegistry. It
+// deduplicates concurrent requests for the same blob of at most maxSize
+// bytes, such that the blob is read once from storage and served to all of
+// them. A maxSize of zero or less deduplicates the requests for the blobs of
+// at most DefaultSingleFlightMaxSize bytes.
+func SingleFlightBlobs(maxSize int64) RegistryOption {
+	return func(registry *registry) error {
+		// The statter may yet be replaced by a cached one.
+		registry.singleFlight = NewSingleFlightBlobServer(registry.blobServer, nil, maxSize)
+		return nil
+	}
+}
+
+// BlobExistenceCache returns a functional option for NewRegistry. It
+// coalesces the concurrent checks of the existence of the same blob in a
+// repository into a single check against the storage, and caches the blobs
+// found for ttl. A ttl of zero or less caches them for
+// DefaultBlobExistenceCacheTTL.
+func BlobExistenceCache(ttl time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		registry.existenceCache = newExistenceCache(ttl)
+		return nil
+	}
+}
+
+// ManifestBloomFilter returns a functional option for NewRegistry. It keeps
+// a bloom filter of the manifests of each repository in memory, with the
+// given false positive rate, such that requests for manifests which do not
+// exist are answered without reading from storage. The filters are loaded
+// again from storage after refresh, to see the manifests pushed through
+// other registries sharing the storage. A refresh of zero never reloads
+// them, which is only correct when the registry is the single writer.
+func ManifestBloomFilter(falsePositiveRate float64, refresh time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+			return fmt.Errorf("invalid manifest bloom filter false positive rate %v", falsePositiveRate)
+		}
+		registry.manifestFilters = newManifestFilters(falsePositiveRate, refresh)
+		return nil
+	}
+}
+
 // EnableDelete is a functional option for NewRegistry. It enables deletion on
 // the registry.
 func EnableDelete(registry *registry) error {
@@ -50,6 +138,87 @@ func EnableDelete(registry *registry) error {
 	return nil
 }
 
+// CaseInsensitiveTags is a functional option for NewRegistry. It makes tags
+// which differ only in case refer to the same tag, by storing them in
+// lowercase.
+func CaseInsensitiveTags(registry *registry) error {
+	registry.caseInsensitiveTags = true
+	return nil
+}
+
+// ReadOnlyTags is a functional option for NewRegistry. It wraps the tag
+// services of the repositories in a ReadOnlyTagStore, for registries which
+// must never write, such as read-only replicas.
+func ReadOnlyTags(registry *registry) error {
+	registry.readOnlyTags = true
+	return nil
+}
+
+// TagCollisionCheck is the handling of tags which differ only in case from an
+// existing tag of the repository, when tags are case sensitive.
+type TagCollisionCheck string
+
+const (
+	// TagCollisionCheckError rejects such tags with ErrTagCollision. It is
+	// the default.
+	TagCollisionCheckError TagCollisionCheck = "error"
+
+	// TagCollisionCheckWarn logs a warning, then tags.
+	TagCollisionCheckWarn TagCollisionCheck = "warn"
+
+	// TagCollisionCheckOff tags without checking the existing tags.
+	TagCollisionCheckOff TagCollisionCheck = "off"
+)
+
+// TagCollisionChecking is a functional option for NewRegistry. It sets the
+// handling of tags which differ only in case from an existing tag.
+func TagCollisionChecking(check TagCollisionCheck) RegistryOption {
+	return func(registry *registry) error {
+		switch check {
+		case TagCollisionCheckError, TagCollisionCheckWarn, TagCollisionCheckOff:
+		default:
+			return fmt.Errorf("invalid tag collision check %q: expected %q, %q or %q", check, TagCollisionCheckError, TagCollisionCheckWarn, TagCollisionCheckOff)
+		}
+		registry.tagCollisionCheck = check
+		return nil
+	}
+}
+
+// TagLinkRetries is a functional option for NewRegistry. It retries the
+// write of the current link of the tags which fail, up to retries times,
+// waiting delay before the first retry and doubling it for each of the next
+// ones. A zero delay defaults to 100ms.
+func TagLinkRetries(retries int, delay time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		if retries < 0 {
+			return fmt.Errorf("invalid number of tag link retries %d: expected a positive number", retries)
+		}
+		if delay < 0 {
+			return fmt.Errorf("invalid tag link retry delay %s: expected a positive duration", delay)
+		}
+		if delay == 0 {
+			delay = defaultTagLinkRetryDelay
+		}
+		registry.tagLinkRetries = retries
+		registry.tagLinkRetryDelay = delay
+		return nil
+	}
+}
+
+// TagStoreMetrics is a functional option for NewRegistry. It records the
+// latency and the errors of the operations of the tag stores, labelled by
+// repository and operation, in metrics registered with registerer.
+func TagStoreMetrics(registerer prometheus.Registerer) RegistryOption {
+	return func(registry *registry) error {
+		m, err := newTagStoreMetrics(registerer)
+		if err != nil {
+			return fmt.Errorf("unable to register the tag store metrics: %v", err)
+		}
+		registry.tagMetrics = m
+		return nil
+	}
+}
+
 // EnableSchema1 is a functional option for NewRegistry. It enables pushing of
 // schema1 manifests.
 func EnableSchema1(registry *registry) error {
@@ -89,6 +258,28 @@ func Schema1SigningKey(key libtrust.PrivateKey) RegistryOption {
 	}
 }
 
+// WithManifestValidator returns a functional option for NewRegistry. It adds v
+// to the validators of the manifests pushed to the registry, which run after
+// the built-in validators. The option can be given several times, the
+// validators run in order.
+func WithManifestValidator(v ManifestValidator) RegistryOption {
+	return func(registry *registry) error {
+		registry.manifestValidators = append(registry.manifestValidators, v)
+		return nil
+	}
+}
+
+// WithTagObserver returns a functional option for NewRegistry. It adds o to
+// the observers notified of the tags set and removed by the tag stores of the
+// registry. The option can be given several times, the observers are
+// notified in order.
+func WithTagObserver(o TagObserver) RegistryOption {
+	return func(registry *registry) error {
+		registry.tagObservers = append(registry.tagObservers, o)
+		return nil
+	}
+}
+
 // BlobDescriptorServiceFactory returns a functional option for NewRegistry. It sets the
 // factory to create BlobDescriptorServiceFactory middleware.
 func BlobDescriptorServiceFactory(factory distribution.BlobDescriptorServiceFactory) RegistryOption {
@@ -150,10 +341,21 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 			return nil, err
 		}
 	}
+	if registry.singleFlight != nil {
+		registry.singleFlight.statter = registry.blobServer.statter
+	}
 
 	return registry, nil
 }
 
+// servingBlobs returns the server of the blobs of the registry.
+func (reg *registry) servingBlobs() distribution.BlobServer {
+	if reg.singleFlight != nil {
+		return reg.singleFlight
+	}
+	return reg.blobServer
+}
+
 // Scope returns the namespace scope for a registry. The registry
 // will only serve repositories contained within this scope.
 func (reg *registry) Scope() distribution.Scope {
@@ -204,8 +406,17 @@ func (repo *repository) Named() reference.Named {
 
 func (repo *repository) Tags(ctx context.Context) distribution.TagService {
 	tags := &tagStore{
-		repository: repo,
-		blobStore:  repo.registry.blobStore,
+		repository:      repo,
+		blobStore:       repo.registry.blobStore,
+		caseInsensitive: repo.registry.caseInsensitiveTags,
+		collisionCheck:  repo.registry.tagCollisionCheck,
+		observers:       repo.registry.tagObservers,
+		linkRetries:     repo.registry.tagLinkRetries,
+		linkRetryDelay:  repo.registry.tagLinkRetryDelay,
+		metrics:         repo.registry.tagMetrics,
+	}
+	if repo.registry.readOnlyTags {
+		return &ReadOnlyTagStore{TagService: tags}
 	}
 
 	return tags
@@ -233,6 +444,7 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 		repository:           repo,
 		deleteEnabled:        repo.registry.deleteEnabled,
 		blobAccessController: statter,
+		compress:             repo.registry.compressManifests,
 
 		// TODO(stevvooe): linkPath limits this blob store to only
 		// manifests. This instance cannot be used for blob checks.
@@ -265,10 +477,9 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 		blobStore:      blobStore,
 		schema1Handler: v1Handler,
 		schema2Handler: &schema2ManifestHandler{
-			ctx:          ctx,
-			repository:   repo,
-			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			ctx:        ctx,
+			repository: repo,
+			blobStore:  blobStore,
 		},
 		manifestListHandler: &manifestListHandler{
 			ctx:        ctx,
@@ -276,10 +487,9 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 			blobStore:  blobStore,
 		},
 		ocischemaHandler: &ocischemaManifestHandler{
-			ctx:          ctx,
-			repository:   repo,
-			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			ctx:        ctx,
+			repository: repo,
+			blobStore:  blobStore,
 		},
 	}
 
@@ -315,7 +525,7 @@ func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 	return &linkedBlobStore{
 		registry:             repo.registry,
 		blobStore:            repo.blobStore,
-		blobServer:           repo.blobServer,
+		blobServer:           repo.servingBlobs(),
 		blobAccessController: statter,
 		repository:           repo,
 		ctx:                  ctx,
@@ -20,10 +20,9 @@ var (
 
 // schema2ManifestHandler is a ManifestHandler that covers schema2 manifests.
 type schema2ManifestHandler struct {
-	repository   distribution.Repository
-	blobStore    distribution.BlobStore
-	ctx          context.Context
-	manifestURLs manifestURLs
+	repository distribution.Repository
+	blobStore  distribution.BlobStore
+	ctx        context.Context
 }
 
 var _ ManifestHandler = &schema2ManifestHandler{}
@@ -47,10 +46,6 @@ func (ms *schema2ManifestHandler) Put(ctx context.Context, manifest distribution
 		return "", fmt.Errorf("non-schema2 manifest put to schema2ManifestHandler: %T", manifest)
 	}
 
-	if err := ms.verifyManifest(ms.ctx, *m, skipDependencyVerification); err != nil {
-		return "", err
-	}
-
 	mt, payload, err := m.Payload()
 	if err != nil {
 		return "", err
@@ -65,26 +60,41 @@ func (ms *schema2ManifestHandler) Put(ctx context.Context, manifest distribution
 	return revision.Digest, nil
 }
 
-// verifyManifest ensures that the manifest content is valid from the
-// perspective of the registry. As a policy, the registry only tries to store
-// valid content, leaving trust policies of that content up to consumers.
-func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst schema2.DeserializedManifest, skipDependencyVerification bool) error {
+// schema2Validator is the built-in ManifestValidator of schema2 manifests.
+// Other types of manifests are accepted.
+type schema2Validator struct {
+	repository                 distribution.Repository
+	manifestURLs               manifestURLs
+	skipDependencyVerification bool
+}
+
+var _ ManifestValidator = &schema2Validator{}
+
+// Validate ensures that the manifest content is valid from the perspective of
+// the registry. As a policy, the registry only tries to store valid content,
+// leaving trust policies of that content up to consumers.
+func (v *schema2Validator) Validate(ctx context.Context, manifest distribution.Manifest) error {
+	mnfst, ok := manifest.(*schema2.DeserializedManifest)
+	if !ok {
+		return nil
+	}
+
 	var errs distribution.ErrManifestVerification
 
 	if mnfst.Manifest.SchemaVersion != 2 {
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
-	if skipDependencyVerification {
+	if v.skipDependencyVerification {
 		return nil
 	}
 
-	manifestService, err := ms.repository.Manifests(ctx)
+	manifestService, err := v.repository.Manifests(ctx)
 	if err != nil {
 		return err
 	}
 
-	blobsService := ms.repository.Blobs(ctx)
+	blobsService := v.repository.Blobs(ctx)
 
 	for _, descriptor := range mnfst.References() {
 		err := descriptor.Digest.Validate()
@@ -100,8 +110,8 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 			if len(descriptor.URLs) == 0 {
 				err = errMissingURL
 			}
-			allow := ms.manifestURLs.allow
-			deny := ms.manifestURLs.deny
+			allow := v.manifestURLs.allow
+			deny := v.manifestURLs.deny
 			for _, u := range descriptor.URLs {
 				var pu *url.URL
 				pu, err = url.Parse(u)
@@ -118,7 +128,7 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 			}
 
 			if err != nil {
-				dcontext.GetLogger(ms.ctx).WithError(err).Debugf("failed to ensure exists of %v in manifest service", descriptor.Digest)
+				dcontext.GetLogger(ctx).WithError(err).Debugf("failed to ensure exists of %v in manifest service", descriptor.Digest)
 			}
 			fallthrough // double check the blob store.
 		default:
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultSingleFlightMaxSize is the size of the largest blob whose requests
+// are deduplicated by default.
+const DefaultSingleFlightMaxSize = 64 << 20
+
+// SingleFlightBlobServer deduplicates concurrent requests for the same blob.
+// The first request reads the blob from storage, and concurrent requests for
+// the same digest wait for it and are served its response, rather than
+// reading the blob again.
+//
+// Responses are buffered in memory, so only blobs up to maxSize are
+// deduplicated. Range and conditional requests, whose responses depend on
+// the request, are served directly.
+type SingleFlightBlobServer struct {
+	server  distribution.BlobServer
+	statter distribution.BlobStatter
+	maxSize int64
+
+	group singleflight.Group
+}
+
+// NewSingleFlightBlobServer returns a SingleFlightBlobServer deduplicating
+// the requests served by server for blobs of at most maxSize bytes, as
+// described by statter. A maxSize of zero or less deduplicates the requests
+// for the blobs of at most DefaultSingleFlightMaxSize bytes.
+func NewSingleFlightBlobServer(server distribution.BlobServer, statter distribution.BlobStatter, maxSize int64) *SingleFlightBlobServer {
+	if maxSize <= 0 {
+		maxSize = DefaultSingleFlightMaxSize
+	}
+	return &SingleFlightBlobServer{
+		server:  server,
+		statter: statter,
+		maxSize: maxSize,
+	}
+}
+
+// ServeBlob implements distribution.BlobServer.
+func (sfs *SingleFlightBlobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
+	if !sharable(r) {
+		return sfs.server.ServeBlob(ctx, w, r, dgst)
+	}
+	desc, err := sfs.statter.Stat(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	if desc.Size > sfs.maxSize {
+		return sfs.server.ServeBlob(ctx, w, r, dgst)
+	}
+
+	ch := sfs.group.DoChan(dgst.String(), func() (interface{}, error) {
+		response := newRecordedResponse()
+		if err := sfs.server.ServeBlob(ctx, response, r, dgst); err != nil {
+			return nil, err
+		}
+		return response, nil
+	})
+
+	var result singleflight.Result
+	select {
+	case result = <-ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if result.Err != nil {
+		// The request reading the blob was canceled by its client, which
+		// says nothing about this one.
+		if errors.Is(result.Err, context.Canceled) && ctx.Err() == nil {
+			return sfs.server.ServeBlob(ctx, w, r, dgst)
+		}
+		return result.Err
+	}
+	result.Val.(*recordedResponse).replay(w)
+	return nil
+}
+
+// sharable reports whether the response to r may be shared with the
+// requests for the same blob.
+func sharable(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	for _, header := range []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if r.Header.Get(header) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// recordedResponse is an http.ResponseWriter recording the response for
+// replay.
+type recordedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecordedResponse() *recordedResponse {
+	return &recordedResponse{header: make(http.Header)}
+}
+
+func (rr *recordedResponse) Header() http.Header {
+	return rr.header
+}
+
+func (rr *recordedResponse) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+}
+
+func (rr *recordedResponse) Write(p []byte) (int, error) {
+	rr.WriteHeader(http.StatusOK)
+	return rr.body.Write(p)
+}
+
+// replay writes the recorded response to w. Headers already set on w take
+// precedence over the recorded ones.
+func (rr *recordedResponse) replay(w http.ResponseWriter) {
+	for k, v := range rr.header {
+		if _, ok := w.Header()[k]; !ok {
+			w.Header()[k] = v
+		}
+	}
+	status := rr.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(rr.body.Bytes())
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"bytes"
+	stdcontext "context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+// readCountingDriver counts the readers opened on blob data, which are held
+// until release is closed.
+type readCountingDriver struct {
+	driver.StorageDriver
+	reads   int32
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (d *readCountingDriver) Reader(ctx stdcontext.Context, path string, offset int64) (io.ReadCloser, error) {
+	if strings.HasSuffix(path, "/data") {
+		if atomic.AddInt32(&d.reads, 1) == 1 {
+			close(d.reading)
+		}
+		<-d.release
+	}
+	return d.StorageDriver.Reader(ctx, path, offset)
+}
+
+func TestSingleFlightBlobServer(t *testing.T) {
+	const requests = 50
+	ctx := context.Background()
+	d := &readCountingDriver{
+		StorageDriver: inmemory.New(),
+		reading:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	ns, err := NewRegistry(ctx, d, SingleFlightBlobs(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, err := reference.WithName("foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := ns.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := repo.Blobs(ctx)
+	content := bytes.Repeat([]byte("layer"), 1<<16)
+	desc, err := blobs.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		started sync.WaitGroup
+		served  sync.WaitGroup
+	)
+	responses := make([]*httptest.ResponseRecorder, requests)
+	errs := make([]error, requests)
+	started.Add(requests)
+	served.Add(requests)
+	for i := range responses {
+		i := i
+		responses[i] = httptest.NewRecorder()
+		go func() {
+			defer served.Done()
+			started.Done()
+			errs[i] = blobs.ServeBlob(ctx, responses[i], httptest.NewRequest(http.MethodGet, "/", nil), desc.Digest)
+		}()
+	}
+
+	// Hold the first read until the other requests are waiting for it.
+	started.Wait()
+	<-d.reading
+	time.Sleep(100 * time.Millisecond)
+	close(d.release)
+	served.Wait()
+
+	if reads := atomic.LoadInt32(&d.reads); reads != 1 {
+		t.Fatalf("expected the blob to be read once, got %d reads", reads)
+	}
+	for i, w := range responses {
+		if errs[i] != nil {
+			t.Fatalf("error serving blob: %v", errs[i])
+		}
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+			t.Fatalf("unexpected response %d with %d bytes", w.Code, w.Body.Len())
+		}
+		if w.Header().Get("Docker-Content-Digest") != desc.Digest.String() {
+			t.Fatalf("unexpected headers %v", w.Header())
+		}
+	}
+
+	// Range requests are not shared.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Range", "bytes=0-4")
+	if err := blobs.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusPartialContent || w.Body.String() != "layer" {
+		t.Fatalf("unexpected range response %d %q", w.Code, w.Body.String())
+	}
+	if reads := atomic.LoadInt32(&d.reads); reads != 2 {
+		t.Fatalf("expected the range request to read the blob, got %d reads", reads)
+	}
+}
+
+func TestSingleFlightBlobServerMaxSize(t *testing.T) {
+	ctx := context.Background()
+	d := &readCountingDriver{
+		StorageDriver: inmemory.New(),
+		reading:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	close(d.release)
+	ns, err := NewRegistry(ctx, d, SingleFlightBlobs(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := ns.(*registry)
+	desc, err := reg.blobStore.Put(ctx, "application/octet-stream", make([]byte, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blobs larger than the maximum size are served directly, so a call in
+	// flight for them is never joined.
+	started, block := make(chan struct{}), make(chan struct{})
+	defer close(block)
+	go reg.singleFlight.group.Do(desc.Digest.String(), func() (interface{}, error) {
+		close(started)
+		<-block
+		return nil, errors.New("joined")
+	})
+	<-started
+	w := httptest.NewRecorder()
+	if err := reg.servingBlobs().ServeBlob(ctx, w, httptest.NewRequest(http.MethodGet, "/", nil), desc.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != 64 {
+		t.Fatalf("unexpected response %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	// The buffered responses are always bounded.
+	for _, maxSize := range []int64{0, -1} {
+		if sfs := NewSingleFlightBlobServer(reg.blobServer, reg.statter, maxSize); sfs.maxSize != DefaultSingleFlightMaxSize {
+			t.Fatalf("unexpected maximum size %d for %d, expected %d", sfs.maxSize, maxSize, DefaultSingleFlightMaxSize)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package storagetest provides fakes of the storage services, for testing
+// code using them without a storage driver or a registry.
+package storagetest
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+)
+
+// fakeTagService is a TagService keeping tags in memory.
+type fakeTagService struct {
+	mu   sync.Mutex
+	tags map[string]distribution.Descriptor
+	// history holds the revisions of each tag, oldest first.
+	history map[string][]distribution.Descriptor
+}
+
+// NewFakeTagService returns a TagService keeping tags in memory, safe for
+// concurrent use. It follows the contract of the storage tag service: Get
+// and History return ErrTagUnknown for unknown tags, Rename returns
+// ErrTagConflict when dst exists, and tagging a revision again makes it the
+// most recent in the history of the tag. Untag of an unknown tag succeeds.
+func NewFakeTagService() distribution.TagService {
+	return &fakeTagService{
+		tags:    make(map[string]distribution.Descriptor),
+		history: make(map[string][]distribution.Descriptor),
+	}
+}
+
+func (ts *fakeTagService) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	desc, ok := ts.tags[tag]
+	if !ok {
+		return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+	}
+	return desc, nil
+}
+
+func (ts *fakeTagService) Exists(ctx context.Context, tag string) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	_, ok := ts.tags[tag]
+	return ok, nil
+}
+
+func (ts *fakeTagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor, opts ...distribution.TagOption) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.tags[tag] = desc
+	var history []distribution.Descriptor
+	for _, revision := range ts.history[tag] {
+		if revision.Digest != desc.Digest {
+			history = append(history, revision)
+		}
+	}
+	ts.history[tag] = append(history, desc)
+	return nil
+}
+
+func (ts *fakeTagService) Untag(ctx context.Context, tag string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	delete(ts.tags, tag)
+	delete(ts.history, tag)
+	return nil
+}
+
+func (ts *fakeTagService) Rename(ctx context.Context, src, dst string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	desc, ok := ts.tags[src]
+	if !ok {
+		return distribution.ErrTagUnknown{Tag: src}
+	}
+	if _, ok := ts.tags[dst]; ok {
+		return distribution.ErrTagConflict{Tag: src, ExistingTag: dst}
+	}
+	ts.tags[dst], ts.history[dst] = desc, ts.history[src]
+	delete(ts.tags, src)
+	delete(ts.history, src)
+	return nil
+}
+
+func (ts *fakeTagService) All(ctx context.Context) ([]string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	tags := make([]string, 0, len(ts.tags))
+	for tag := range ts.tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (ts *fakeTagService) AllPaged(ctx context.Context, last string, count int) ([]string, error) {
+	tags, err := ts.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return distribution.PageTags(tags, last, count), nil
+}
+
+// Lookup returns the tags pointing to the digest of desc, sorted.
+func (ts *fakeTagService) Lookup(ctx context.Context, desc distribution.Descriptor, opts ...distribution.LookupOption) ([]string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	tags := make([]string, 0)
+	for tag, current := range ts.tags {
+		if current.Digest == desc.Digest {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (ts *fakeTagService) History(ctx context.Context, tag string) ([]distribution.Descriptor, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	history, ok := ts.history[tag]
+	if !ok {
+		return nil, distribution.ErrTagUnknown{Tag: tag}
+	}
+	return append([]distribution.Descriptor(nil), history...), nil
+}
@@ -0,0 +1,132 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestFakeTagService(t *testing.T) {
+	ctx := context.Background()
+	ts := NewFakeTagService()
+	d1 := distribution.Descriptor{Digest: digest.FromString("first")}
+	d2 := distribution.Descriptor{Digest: digest.FromString("second")}
+
+	if _, err := ts.Get(ctx, "latest"); err == nil {
+		t.Fatal("expected an error getting an unknown tag")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error getting an unknown tag: %v", err)
+	}
+
+	for tag, desc := range map[string]distribution.Descriptor{"latest": d1, "v1": d1, "v2": d2} {
+		if err := ts.Tag(ctx, tag, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	desc, err := ts.Get(ctx, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != d2.Digest {
+		t.Fatalf("unexpected digest %s, expected %s", desc.Digest, d2.Digest)
+	}
+	if exists, err := ts.Exists(ctx, "v2"); err != nil || !exists {
+		t.Fatalf("expected v2 to exist, got %t, %v", exists, err)
+	}
+	if exists, err := ts.Exists(ctx, "v3"); err != nil || exists {
+		t.Fatalf("expected v3 not to exist, got %t, %v", exists, err)
+	}
+
+	tags, err := ts.Lookup(ctx, d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"latest", "v1"}) {
+		t.Fatalf("unexpected tags referencing %s: %v", d1.Digest, tags)
+	}
+	tags, err = ts.AllPaged(ctx, "latest", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"v1"}) {
+		t.Fatalf("unexpected page of tags: %v", tags)
+	}
+
+	for _, desc := range []distribution.Descriptor{d2, d1} {
+		if err := ts.Tag(ctx, "latest", desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := ts.History(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(history, []distribution.Descriptor{d2, d1}) {
+		t.Fatalf("unexpected history: %v", history)
+	}
+
+	if err := ts.Rename(ctx, "v1", "v2"); err == nil {
+		t.Fatal("expected an error renaming onto an existing tag")
+	} else if _, ok := err.(distribution.ErrTagConflict); !ok {
+		t.Fatalf("unexpected error renaming onto an existing tag: %v", err)
+	}
+	if err := ts.Rename(ctx, "v1", "stable"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ts.Untag(ctx, "v2"); err != nil {
+			t.Fatalf("unexpected error untagging: %v", err)
+		}
+	}
+	tags, err = ts.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"latest", "stable"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	if _, err := ts.History(ctx, "v2"); err == nil {
+		t.Fatal("expected an error getting the history of an untagged tag")
+	}
+}
+
+func TestFakeTagServiceConcurrency(t *testing.T) {
+	ctx := context.Background()
+	ts := NewFakeTagService()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tag := fmt.Sprintf("tag-%d", i)
+			desc := distribution.Descriptor{Digest: digest.FromString(tag)}
+			for j := 0; j < 100; j++ {
+				if err := ts.Tag(ctx, tag, desc); err != nil {
+					t.Error(err)
+				}
+				if _, err := ts.Lookup(ctx, desc); err != nil {
+					t.Error(err)
+				}
+				if _, err := ts.All(ctx); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	tags, err := ts.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 10 {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+}
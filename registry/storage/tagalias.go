@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/distribution/distribution/v3"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.TagAliaser = &tagStore{}
+
+// tagAlias is the record of a tag created as an alias of another tag.
+type tagAlias struct {
+	// Source is the aliased tag.
+	Source string `json:"source"`
+
+	// Digest is the revision the aliased tag pointed to when the alias was
+	// created.
+	Digest digest.Digest `json:"digest"`
+}
+
+// CreateAlias tags the manifest srcTag points to with aliasTag, and records
+// aliasTag as an alias of srcTag. As storage drivers do not support links,
+// the current link of the alias is a copy of the link of the source tag.
+func (ts *tagStore) CreateAlias(ctx context.Context, srcTag, aliasTag string) error {
+	desc, err := ts.Get(ctx, srcTag)
+	if err != nil {
+		return err
+	}
+	if err := ts.Tag(ctx, aliasTag, desc); err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(tagAlias{
+		Source: ts.normalize(srcTag),
+		Digest: desc.Digest,
+	})
+	if err != nil {
+		return err
+	}
+	aliasPath, err := pathFor(manifestTagAliasPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  ts.normalize(aliasTag),
+	})
+	if err != nil {
+		return err
+	}
+	return ts.blobStore.driver.PutContent(ctx, aliasPath, p)
+}
+
+// Aliases returns the tags which are aliases, mapped to the tags they alias.
+// The record of an alias is left behind when it is tagged again, so that
+// tagging needs not remove it, and is only honored while the alias still
+// points to the revision it was created with.
+func (ts *tagStore) Aliases(ctx context.Context) (map[string]string, error) {
+	tags, err := ts.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string]string)
+	for _, tag := range tags {
+		aliasPath, err := pathFor(manifestTagAliasPathSpec{
+			name: ts.repository.Named().Name(),
+			tag:  tag,
+		})
+		if err != nil {
+			return nil, err
+		}
+		p, err := ts.blobStore.driver.GetContent(ctx, aliasPath)
+		if err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		var alias tagAlias
+		if err := json.Unmarshal(p, &alias); err != nil {
+			return nil, err
+		}
+
+		desc, err := ts.get(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return nil, err
+		}
+		if desc.Digest == alias.Digest {
+			aliases[tag] = alias.Source
+		}
+	}
+	return aliases, nil
+}
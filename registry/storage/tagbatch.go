@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+)
+
+var _ distribution.BatchTagService = &tagStore{}
+
+// UntagBatch untags the tags concurrently, as many at a time as Lookup
+// resolves by default. Tags not yet untagged when ctx is done fail with the
+// error of ctx, and locked tags with ErrTagLocked unless ctx bypasses the
+// locks.
+func (ts *tagStore) UntagBatch(ctx context.Context, tags []string) (int, []error) {
+	var wg sync.WaitGroup
+	errs := make([]error, len(tags))
+	sem := make(chan struct{}, distribution.DefaultLookupConcurrency)
+	for i, tag := range tags {
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := ts.Untag(ctx, tag); err != nil {
+				errs[i] = fmt.Errorf("failed to untag %s: %w", tag, err)
+			}
+		}(i, tag)
+	}
+	wg.Wait()
+
+	removed := len(tags)
+	for _, err := range errs {
+		if err != nil {
+			removed--
+		}
+	}
+	if removed == len(tags) {
+		return removed, nil
+	}
+	return removed, errs
+}
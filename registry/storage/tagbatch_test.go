@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestTagStoreUntagBatch(t *testing.T) {
+	env := testTagStore(t)
+	ts := env.ts.(distribution.BatchTagService)
+
+	desc := distribution.Descriptor{Digest: digest.FromString("manifest")}
+	var tags []string
+	for i := 0; i < 30; i++ {
+		tag := fmt.Sprintf("v%d", i)
+		if err := ts.Tag(env.ctx, tag, desc); err != nil {
+			t.Fatal(err)
+		}
+		tags = append(tags, tag)
+	}
+
+	n, errs := ts.UntagBatch(env.ctx, tags[:20])
+	if n != 20 || errs != nil {
+		t.Fatalf("unexpected result untagging: %d tags untagged, errors %v", n, errs)
+	}
+
+	n, errs = ts.UntagBatch(env.ctx, append([]string{"missing", "in valid"}, tags[20:25]...))
+	if n != 5 {
+		t.Fatalf("unexpected number of tags untagged %d, expected 5", n)
+	}
+	// The errors are aligned with the tags.
+	if len(errs) != 7 {
+		t.Fatalf("unexpected errors untagging: %v", errs)
+	}
+	if errs[0] == nil {
+		t.Fatalf("unexpected error untagging a missing tag: %v", errs[0])
+	}
+	var invalid distribution.ErrTagInvalid
+	if !errors.As(errs[1], &invalid) || invalid.Tag != "in valid" {
+		t.Fatalf("unexpected error untagging an invalid tag: %v", errs[1])
+	}
+	for i, err := range errs[2:] {
+		if err != nil {
+			t.Fatalf("unexpected error untagging %s: %v", tags[20+i], err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(env.ctx)
+	cancel()
+	n, errs = ts.UntagBatch(ctx, tags[25:])
+	if n != 0 || len(errs) != 5 {
+		t.Fatalf("unexpected result untagging with a canceled context: %d tags untagged, errors %v", n, errs)
+	}
+
+	remaining, err := ts.All(env.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 5 {
+		t.Fatalf("unexpected tags remaining: %v", remaining)
+	}
+}
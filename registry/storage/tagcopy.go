@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.AdvancedTagService = &tagStore{}
+
+// tagCopyTimeout is the time after which a copy onto a tag which did not
+// complete is considered interrupted, rather than in progress.
+var tagCopyTimeout = 10 * time.Minute
+
+// tagCopy is the record of a copy onto a tag, kept until the current link of
+// the tag is written.
+type tagCopy struct {
+	// Digest is the revision copied.
+	Digest digest.Digest `json:"digest"`
+
+	// Indexed reports whether the revision was in the index of the tag
+	// before the copy.
+	Indexed bool `json:"indexed"`
+
+	// StartedAt is the time the copy started.
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Copy tags the manifest srcTag points to in src with dstTag. The manifest,
+// the manifests it references and their blobs are linked into the repository
+// before the tag is. A copy is recorded until the current link of dstTag is
+// written, so that a copy which fails in between is undone, or, when
+// interrupted, undone by the next copy onto dstTag or tagging of it. The
+// links of the manifest
+// and blobs are left to the garbage collector. src must be a repository of
+// the same registry.
+func (ts *tagStore) Copy(ctx context.Context, src distribution.Repository, srcTag string, dstTag string) (err error) {
+	defer ts.observe("Copy", time.Now(), &err)
+	// dstTag is part of the paths written before tagging, which would
+	// otherwise escape the directory of the tag.
+	if err := validateTag(dstTag); err != nil {
+		return err
+	}
+	tag := ts.normalize(dstTag)
+
+	srcRepo, ok := src.(*repository)
+	if !ok || srcRepo.registry != ts.repository.registry {
+		return distribution.ErrUnsupported
+	}
+
+	desc, err := srcRepo.Tags(ctx).Get(ctx, srcTag)
+	if err != nil {
+		return err
+	}
+	ms, err := srcRepo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	ok, err = ms.Exists(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return distribution.ErrManifestUnknownRevision{
+			Name:     srcRepo.Named().Name(),
+			Revision: desc.Digest,
+		}
+	}
+
+	// Check the tag may be written before linking anything.
+	name := ts.repository.Named().Name()
+	if !tagLockBypassed(ctx) {
+		locked, err := TagLocked(ctx, ts.blobStore.driver, name, tag)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return distribution.ErrTagLocked{Tag: dstTag}
+		}
+	}
+	if err := ts.checkCaseVariant(ctx, tag, ""); err != nil {
+		return err
+	}
+	// The record of an interrupted copy is about to be overwritten.
+	if err := ts.recoverCopy(ctx, tag); err != nil {
+		return err
+	}
+
+	indexPath, err := pathFor(manifestTagIndexEntryLinkPathSpec{name: name, tag: tag, revision: desc.Digest})
+	if err != nil {
+		return err
+	}
+	indexed, err := ts.linkExists(ctx, indexPath)
+	if err != nil {
+		return err
+	}
+	record := tagCopy{
+		Digest:    desc.Digest,
+		Indexed:   indexed,
+		StartedAt: time.Now().UTC(),
+	}
+	p, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	copyPath, err := pathFor(manifestTagCopyPathSpec{name: name, tag: tag})
+	if err != nil {
+		return err
+	}
+	if err := ts.blobStore.driver.PutContent(ctx, copyPath, p); err != nil {
+		return err
+	}
+
+	if err := ts.linkManifest(ctx, srcRepo, ms, desc.Digest, make(map[digest.Digest]struct{})); err != nil {
+		ts.undoCopy(ctx, tag, record)
+		return err
+	}
+	if err := ts.Tag(ctx, tag, desc); err != nil {
+		ts.undoCopy(ctx, tag, record)
+		return err
+	}
+
+	if err := ts.blobStore.driver.Delete(ctx, copyPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkManifest links the revision dgst of src into the repository of the tag
+// store, along with the manifests and blobs it references.
+func (ts *tagStore) linkManifest(ctx context.Context, src *repository, ms distribution.ManifestService, dgst digest.Digest, seen map[digest.Digest]struct{}) error {
+	if _, ok := seen[dgst]; ok {
+		return nil
+	}
+	seen[dgst] = struct{}{}
+
+	manifest, err := ms.Get(ctx, dgst)
+	if err != nil {
+		return err
+	}
+
+	name := ts.repository.Named().Name()
+	for _, ref := range manifest.References() {
+		srcRevisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: src.Named().Name(), revision: ref.Digest})
+		if err != nil {
+			return err
+		}
+		isManifest, err := ts.linkExists(ctx, srcRevisionPath)
+		if err != nil {
+			return err
+		}
+		if isManifest {
+			if err := ts.linkManifest(ctx, src, ms, ref.Digest, seen); err != nil {
+				return err
+			}
+			continue
+		}
+
+		srcLayerPath, err := pathFor(layerLinkPathSpec{name: src.Named().Name(), digest: ref.Digest})
+		if err != nil {
+			return err
+		}
+		isLayer, err := ts.linkExists(ctx, srcLayerPath)
+		if err != nil {
+			return err
+		}
+		if !isLayer {
+			// The blob is not stored in the registry, such as a foreign
+			// layer.
+			continue
+		}
+		layerPath, err := pathFor(layerLinkPathSpec{name: name, digest: ref.Digest})
+		if err != nil {
+			return err
+		}
+		if err := ts.blobStore.link(ctx, layerPath, ref.Digest); err != nil {
+			return err
+		}
+	}
+
+	revisionPath, err := pathFor(manifestRevisionLinkPathSpec{name: name, revision: dgst})
+	if err != nil {
+		return err
+	}
+	return ts.blobStore.link(ctx, revisionPath, dgst)
+}
+
+// recoverCopy undoes the copy onto tag which was interrupted before writing
+// the current link of the tag, if any. It is called before writing to the
+// tag, such that reads of the tag never write.
+func (ts *tagStore) recoverCopy(ctx context.Context, tag string) error {
+	copyPath, err := pathFor(manifestTagCopyPathSpec{name: ts.repository.Named().Name(), tag: tag})
+	if err != nil {
+		return err
+	}
+	p, err := ts.blobStore.driver.GetContent(ctx, copyPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	var record tagCopy
+	if err := json.Unmarshal(p, &record); err != nil {
+		return err
+	}
+	if time.Since(record.StartedAt) < tagCopyTimeout {
+		// The copy may still be in progress.
+		return nil
+	}
+
+	dcontext.GetLogger(ctx).Warnf("undoing copy of %s onto tag %s interrupted at %s", record.Digest, tag, record.StartedAt)
+	ts.undoCopy(ctx, tag, record)
+	return nil
+}
+
+// undoCopy removes what the copy recorded by record left of tag: the index
+// entry of the revision copied, unless the tag points to it, and the tag
+// itself when it has no current link. Errors are logged, leaving the record
+// in place for the next write to the tag to retry.
+func (ts *tagStore) undoCopy(ctx context.Context, tag string, record tagCopy) {
+	name := ts.repository.Named().Name()
+	desc, err := ts.get(ctx, tag)
+	if _, ok := err.(distribution.ErrTagUnknown); ok {
+		ts.removeEmptyTag(ctx, tag)
+		return
+	}
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error undoing copy onto tag %s: %v", tag, err)
+		return
+	}
+
+	if desc.Digest != record.Digest && !record.Indexed {
+		indexPath, err := pathFor(manifestTagIndexEntryPathSpec{name: name, tag: tag, revision: record.Digest})
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error undoing copy onto tag %s: %v", tag, err)
+			return
+		}
+		if err := ts.blobStore.driver.Delete(ctx, indexPath); err != nil {
+			if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+				dcontext.GetLogger(ctx).Errorf("error undoing copy onto tag %s: %v", tag, err)
+				return
+			}
+		}
+	}
+
+	copyPath, err := pathFor(manifestTagCopyPathSpec{name: name, tag: tag})
+	if err == nil {
+		err = ts.blobStore.driver.Delete(ctx, copyPath)
+	}
+	if _, ok := err.(storagedriver.PathNotFoundError); err != nil && !ok {
+		dcontext.GetLogger(ctx).Errorf("error undoing copy onto tag %s: %v", tag, err)
+	}
+}
+
+// linkExists reports whether the link at path exists.
+func (ts *tagStore) linkExists(ctx context.Context, path string) (bool, error) {
+	if _, err := ts.blobStore.driver.Stat(ctx, path); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+// failingCurrentLinkDriver fails to write the current links of tags.
+type failingCurrentLinkDriver struct {
+	storagedriver.StorageDriver
+}
+
+func (d *failingCurrentLinkDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	if strings.HasSuffix(path, "/current/link") {
+		return fmt.Errorf("PutContent error")
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+func TestTagStoreCopy(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	src := makeRepository(t, registry, "a/src")
+	dst := makeRepository(t, registry, "a/dst")
+
+	image := uploadRandomSchema2Image(t, src)
+	manifestList, err := testutil.MakeManifestList(registry.BlobStatter(), []digest.Digest{image.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcManifests, err := src.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listDigest, err := srcManifests.Put(ctx, manifestList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Tags(ctx).Tag(ctx, "list", distribution.Descriptor{Digest: listDigest}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := dst.Tags(ctx).(distribution.AdvancedTagService)
+	if err := ts.Copy(ctx, src, "list", "mirrored"); err != nil {
+		t.Fatalf("unexpected error copying tag: %v", err)
+	}
+
+	desc, err := ts.Get(ctx, "mirrored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != listDigest {
+		t.Fatalf("unexpected digest %s, expected %s", desc.Digest, listDigest)
+	}
+	dstManifests, err := dst.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dgst := range []digest.Digest{listDigest, image.manifestDigest} {
+		if _, err := dstManifests.Get(ctx, dgst); err != nil {
+			t.Fatalf("unexpected error getting copied manifest %s: %v", dgst, err)
+		}
+	}
+	for dgst := range image.layers {
+		if _, err := dst.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("unexpected error getting copied layer %s: %v", dgst, err)
+		}
+	}
+
+	if err := ts.Copy(ctx, src, "missing", "other"); err == nil {
+		t.Fatal("expected an error copying a missing tag")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error copying a missing tag: %v", err)
+	}
+	if err := ts.Copy(ctx, &wrappedRepository{src}, "list", "other"); err != distribution.ErrUnsupported {
+		t.Fatalf("unexpected error copying from a wrapped repository: %v", err)
+	}
+}
+
+// wrappedRepository hides the implementation of the repository it wraps.
+type wrappedRepository struct {
+	distribution.Repository
+}
+
+func TestTagStoreCopyFailure(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	src := makeRepository(t, createRegistry(t, d), "a/src")
+	image := uploadRandomSchema2Image(t, src)
+	if err := src.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The registry writing the current link of the destination fails.
+	registry := createRegistry(t, &failingCurrentLinkDriver{StorageDriver: d})
+	src = makeRepository(t, registry, "a/src")
+	dst := makeRepository(t, registry, "a/dst")
+	ts := dst.Tags(ctx).(distribution.AdvancedTagService)
+	if err := ts.Copy(ctx, src, "latest", "mirrored"); err == nil {
+		t.Fatal("expected an error copying the tag")
+	}
+
+	if _, err := ts.Get(ctx, "mirrored"); err == nil {
+		t.Fatal("expected the failed copy not to be tagged")
+	}
+	tags, err := ts.All(ctx)
+	if _, ok := err.(distribution.ErrRepositoryUnknown); !ok && err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 0 {
+		t.Fatalf("unexpected tags left by the failed copy: %v", tags)
+	}
+}
+
+func TestTagStoreCopyInterrupted(t *testing.T) {
+	env := testTagStore(t)
+	ts := env.ts.(*tagStore)
+	d := ts.blobStore.driver
+	name := ts.repository.Named().Name()
+
+	current := digest.FromString("current")
+	copied := digest.FromString("copied")
+	if err := ts.Tag(env.ctx, "existing", distribution.Descriptor{Digest: current}); err != nil {
+		t.Fatal(err)
+	}
+
+	// interrupt leaves what a copy of copied onto tag does before writing
+	// the current link, recorded as started at startedAt.
+	interrupt := func(tag string, startedAt time.Time) {
+		p, err := json.Marshal(tagCopy{Digest: copied, StartedAt: startedAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		copyPath, _ := pathFor(manifestTagCopyPathSpec{name: name, tag: tag})
+		if err := d.PutContent(env.ctx, copyPath, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.linkedBlobStore(env.ctx, tag).linkBlob(env.ctx, distribution.Descriptor{Digest: copied}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copyRecorded := func(tag string) bool {
+		copyPath, _ := pathFor(manifestTagCopyPathSpec{name: name, tag: tag})
+		ok, err := ts.linkExists(env.ctx, copyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	indexed := func(tag string, dgst digest.Digest) bool {
+		indexPath, _ := pathFor(manifestTagIndexEntryLinkPathSpec{name: name, tag: tag, revision: dgst})
+		ok, err := ts.linkExists(env.ctx, indexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// Reading a tag leaves the copy alone.
+	interrupt("read", time.Now().Add(-2*tagCopyTimeout))
+	if _, err := ts.Get(env.ctx, "read"); err == nil {
+		t.Fatal("expected the interrupted copy not to be tagged")
+	}
+	if !copyRecorded("read") {
+		t.Fatal("expected reading the tag not to undo the interrupted copy")
+	}
+
+	// A copy in progress is left alone.
+	interrupt("new", time.Now())
+	if err := ts.Tag(env.ctx, "new", distribution.Descriptor{Digest: current}); err != nil {
+		t.Fatal(err)
+	}
+	if !copyRecorded("new") {
+		t.Fatal("expected the copy in progress to be left alone")
+	}
+	if err := ts.Untag(env.ctx, "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted copy onto a new tag is undone before tagging it.
+	interrupt("new", time.Now().Add(-2*tagCopyTimeout))
+	if err := ts.Tag(env.ctx, "new", distribution.Descriptor{Digest: current}); err != nil {
+		t.Fatal(err)
+	}
+	if indexed("new", copied) {
+		t.Fatal("expected the index entry of the interrupted copy to be removed")
+	}
+	if copyRecorded("new") {
+		t.Fatal("expected the record of the interrupted copy to be removed")
+	}
+
+	// An interrupted copy onto an existing tag removes the index entry of
+	// the revision copied.
+	interrupt("existing", time.Now().Add(-2*tagCopyTimeout))
+	if err := ts.Tag(env.ctx, "existing", distribution.Descriptor{Digest: current}); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := ts.Get(env.ctx, "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != current {
+		t.Fatalf("unexpected digest %s, expected %s", desc.Digest, current)
+	}
+	for dgst, expected := range map[digest.Digest]bool{current: true, copied: false} {
+		if indexed("existing", dgst) != expected {
+			t.Fatalf("unexpected index entry of %s after undoing the interrupted copy: %v", dgst, !expected)
+		}
+	}
+	if copyRecorded("existing") {
+		t.Fatal("expected the record of the interrupted copy to be removed")
+	}
+}
+
+func TestTagStoreCopyInvalidTag(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	src := makeRepository(t, registry, "a/src")
+	dst := makeRepository(t, registry, "a/dst")
+
+	image := uploadRandomSchema2Image(t, src)
+	for _, repo := range []distribution.Repository{src, dst} {
+		if err := repo.Tags(ctx).Tag(ctx, "v1", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := dst.Tags(ctx).(distribution.AdvancedTagService)
+	for _, tag := range []string{"../..", "../../../a/src", "v1/../.."} {
+		if err := ts.Copy(ctx, src, "v1", tag); err == nil {
+			t.Fatalf("expected an error copying onto %q", tag)
+		} else if _, ok := err.(distribution.ErrTagInvalid); !ok {
+			t.Fatalf("unexpected error copying onto %q: %v", tag, err)
+		}
+	}
+
+	for _, repo := range []distribution.Repository{src, dst} {
+		tags, err := repo.Tags(ctx).All(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error listing the tags of %s: %v", repo.Named(), err)
+		}
+		if len(tags) != 1 || tags[0] != "v1" {
+			t.Fatalf("unexpected tags of %s: %v", repo.Named(), tags)
+		}
+	}
+}
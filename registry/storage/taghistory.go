@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// History returns the revisions tag pointed to, from the index of the tag,
+// oldest first. Revisions are ordered by the time they were tagged, as
+// recorded in their metadata, or, for those tagged before the metadata was
+// recorded, by the modification time of their index entry. A revision tagged
+// again is ordered by the last time it was tagged.
+func (ts *tagStore) History(ctx context.Context, tag string) (_ []distribution.Descriptor, err error) {
+	defer ts.observe("History", time.Now(), &err)
+	if err := validateTag(tag); err != nil {
+		return nil, err
+	}
+	_, entries, err := ts.sortedHistory(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]distribution.Descriptor, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, distribution.Descriptor{Digest: entry.digest})
+	}
+	return history, nil
+}
+
+// sortedHistory returns the name tag is stored under and the entries of its
+// index, oldest first.
+func (ts *tagStore) sortedHistory(ctx context.Context, tag string) (string, []historyEntry, error) {
+	tag = ts.normalize(tag)
+	entries, err := ts.history(ctx, tag)
+	if _, ok := err.(distribution.ErrTagUnknown); ok && ts.caseInsensitive {
+		// The tag may have been stored before tags were case insensitive.
+		existing, verr := ts.caseVariant(ctx, tag)
+		if verr != nil {
+			return "", nil, verr
+		}
+		if existing != "" {
+			tag = existing
+			entries, err = ts.history(ctx, tag)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].tagged.Equal(entries[j].tagged) {
+			return entries[i].tagged.Before(entries[j].tagged)
+		}
+		return entries[i].digest < entries[j].digest
+	})
+	return tag, entries, nil
+}
+
+// PruneTagHistory removes from the index of tag in repo all but the keep
+// most recent revisions of its history, as returned by History, and returns
+// the revisions removed. The revision tag points to is always kept. All the
+// tags of the repository are pruned when tag is empty, the revisions removed
+// being returned by tag. With dryRun, the revisions are returned without
+// being removed. repo must be a repository of the storage registry.
+func PruneTagHistory(ctx context.Context, repo distribution.Repository, tag string, keep int, dryRun bool) (map[string][]digest.Digest, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("invalid number of revisions to keep %d", keep)
+	}
+	r, ok := repo.(*repository)
+	if !ok {
+		return nil, distribution.ErrUnsupported
+	}
+	if r.registry.readOnlyTags {
+		return nil, distribution.ErrReadOnly
+	}
+	ts := r.Tags(ctx).(*tagStore)
+
+	tags := []string{tag}
+	if tag != "" {
+		if err := validateTag(tag); err != nil {
+			return nil, err
+		}
+		tags = []string{ts.normalize(tag)}
+	} else {
+		var err error
+		tags, err = ts.All(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pruned := make(map[string][]digest.Digest)
+	for _, tag := range tags {
+		removed, err := ts.pruneHistory(ctx, tag, keep, dryRun)
+		if err != nil {
+			return pruned, fmt.Errorf("failed to prune the history of tag %s: %v", tag, err)
+		}
+		if len(removed) > 0 {
+			pruned[tag] = removed
+		}
+	}
+	return pruned, nil
+}
+
+// pruneHistory removes from the index of tag all but the keep most recent
+// revisions and the revision tag points to.
+func (ts *tagStore) pruneHistory(ctx context.Context, tag string, keep int, dryRun bool) ([]digest.Digest, error) {
+	tag, entries, err := ts.sortedHistory(ctx, tag)
+	if err != nil || len(entries) <= keep {
+		return nil, err
+	}
+
+	current, err := ts.get(ctx, tag)
+	if _, ok := err.(distribution.ErrTagUnknown); err != nil && !ok {
+		return nil, err
+	}
+
+	var pruned []digest.Digest
+	name := ts.repository.Named().Name()
+	for _, entry := range entries[:len(entries)-keep] {
+		if entry.digest == current.Digest {
+			continue
+		}
+		if !dryRun {
+			indexPath, err := pathFor(manifestTagIndexEntryPathSpec{name: name, tag: tag, revision: entry.digest})
+			if err != nil {
+				return pruned, err
+			}
+			if err := ts.blobStore.driver.Delete(ctx, indexPath); err != nil {
+				if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+					return pruned, err
+				}
+			}
+		}
+		pruned = append(pruned, entry.digest)
+	}
+	return pruned, nil
+}
+
+// historyEntry is a revision of the index of a tag, with the time it was
+// tagged.
+type historyEntry struct {
+	digest digest.Digest
+	tagged time.Time
+}
+
+// history reads the index of the stored tag.
+func (ts *tagStore) history(ctx context.Context, tag string) ([]historyEntry, error) {
+	name := ts.repository.Named().Name()
+	indexPath, err := pathFor(manifestTagIndexPathSpec{name: name, tag: tag})
+	if err != nil {
+		return nil, err
+	}
+	algorithms, err := ts.blobStore.driver.List(ctx, indexPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, distribution.ErrTagUnknown{Tag: tag}
+		}
+		return nil, err
+	}
+
+	var entries []historyEntry
+	for _, algorithm := range algorithms {
+		revisions, err := ts.blobStore.driver.List(ctx, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		for _, revision := range revisions {
+			linkPath := path.Join(revision, "link")
+			dgst, err := ts.blobStore.readlink(ctx, linkPath)
+			if err != nil {
+				if _, ok := err.(storagedriver.PathNotFoundError); ok {
+					// The entry is being removed.
+					continue
+				}
+				return nil, err
+			}
+			tagged, err := ts.taggedAt(ctx, tag, dgst, linkPath)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, historyEntry{digest: dgst, tagged: tagged})
+		}
+	}
+	return entries, nil
+}
+
+// taggedAt returns the time tag was pointed to the revision dgst, whose
+// index entry link is at linkPath.
+func (ts *tagStore) taggedAt(ctx context.Context, tag string, dgst digest.Digest, linkPath string) (time.Time, error) {
+	metadataPath, err := pathFor(manifestTagIndexEntryMetadataPathSpec{
+		name:     ts.repository.Named().Name(),
+		tag:      tag,
+		revision: dgst,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	p, err := ts.blobStore.driver.GetContent(ctx, metadataPath)
+	if err == nil {
+		var metadata distribution.TagMetadata
+		if err := json.Unmarshal(p, &metadata); err != nil {
+			return time.Time{}, err
+		}
+		return metadata.Created, nil
+	}
+	if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		return time.Time{}, err
+	}
+
+	fi, err := ts.blobStore.driver.Stat(ctx, linkPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+)
+
+// tagLockBypassKey is the context key marking the contexts of requests
+// allowed to overwrite locked tags.
+type tagLockBypassKey struct{}
+
+// WithTagLockBypass returns a context in which tagging overwrites locked
+// tags, for administrators.
+func WithTagLockBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tagLockBypassKey{}, true)
+}
+
+// tagLockBypassed reports whether tagging in ctx overwrites locked tags.
+func tagLockBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(tagLockBypassKey{}).(bool)
+	return bypass
+}
+
+// LockTag locks the tag of the repository name against being overwritten or
+// removed. The tag needs not exist yet, but must be valid. When tags are case
+// insensitive, the tag must be lowercased by the caller.
+func LockTag(ctx context.Context, d driver.StorageDriver, name, tag string) error {
+	if err := validateTag(tag); err != nil {
+		return err
+	}
+	lockPath, err := pathFor(tagLockPathSpec{name: name, tag: tag})
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, lockPath, []byte(time.Now().UTC().Format(time.RFC3339)))
+}
+
+// UnlockTag unlocks the tag of the repository name. Unlocking a tag which is
+// not locked succeeds.
+func UnlockTag(ctx context.Context, d driver.StorageDriver, name, tag string) error {
+	if err := validateTag(tag); err != nil {
+		return err
+	}
+	lockPath, err := pathFor(tagLockPathSpec{name: name, tag: tag})
+	if err != nil {
+		return err
+	}
+	if err := d.Delete(ctx, lockPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// TagLocked reports whether the tag of the repository name is locked.
+func TagLocked(ctx context.Context, d driver.StorageDriver, name, tag string) (bool, error) {
+	lockPath, err := pathFor(tagLockPathSpec{name: name, tag: tag})
+	if err != nil {
+		return false, err
+	}
+	if _, err := d.Stat(ctx, lockPath); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// TagStoreFormat is a version of the format the tags of a repository are
+// stored in.
+type TagStoreFormat int
+
+const (
+	// TagStoreFormatV2 stores each tag as a link to its current revision,
+	// beside the index of the revisions it pointed to. It is the format the
+	// tag store of this package serves tags from.
+	TagStoreFormatV2 TagStoreFormat = 2
+
+	// TagStoreFormatV3 stores all the tags of a repository in a single JSON
+	// document, mapping them to their current revision.
+	TagStoreFormatV3 TagStoreFormat = 3
+)
+
+// consolidatedTags is the document of the tags of a repository in
+// TagStoreFormatV3.
+type consolidatedTags struct {
+	Version TagStoreFormat           `json:"version"`
+	Tags    map[string]digest.Digest `json:"tags"`
+}
+
+// MigrationReport is the outcome of the migration of the tags of a
+// repository.
+type MigrationReport struct {
+	// Format is the format the tags were found in.
+	Format TagStoreFormat
+
+	// Migrated holds the tags converted by the migration, or which would be
+	// in a dry run.
+	Migrated []string
+
+	// Skipped holds the tags which were already converted.
+	Skipped []string
+
+	// Errors holds the tags which could not be converted.
+	Errors []MigrationError
+}
+
+// MigrationError records the failure to convert a tag.
+type MigrationError struct {
+	Tag string
+	Err error
+}
+
+func (e MigrationError) Error() string {
+	return fmt.Sprintf("migrating tag %s: %v", e.Tag, e.Err)
+}
+
+// DetectTagStoreFormat returns the latest format the tags of repo are stored
+// in. Repositories not returned by a registry of this package return
+// distribution.ErrUnsupported.
+func DetectTagStoreFormat(ctx context.Context, repo distribution.Repository) (TagStoreFormat, error) {
+	r, ok := repo.(*repository)
+	if !ok {
+		return 0, distribution.ErrUnsupported
+	}
+	consolidated, err := readConsolidatedTags(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	if consolidated != nil {
+		return consolidated.Version, nil
+	}
+	return TagStoreFormatV2, nil
+}
+
+// MigrateTagStore converts the tags of repo from TagStoreFormatV2 to
+// TagStoreFormatV3. The link files the tag store serves the tags from are
+// kept, so that the repository remains usable while the migration runs.
+// Tags already converted to the revision they point to are skipped, such
+// that the migration can be run again to convert the tags changed since.
+// Once written, each converted tag is read back and checked against the
+// revision it points to. In a dry run, nothing is written.
+//
+// Repositories not returned by a registry of this package return
+// distribution.ErrUnsupported.
+func MigrateTagStore(ctx context.Context, repo distribution.Repository, dryRun bool) (MigrationReport, error) {
+	r, ok := repo.(*repository)
+	if !ok {
+		return MigrationReport{}, distribution.ErrUnsupported
+	}
+
+	report := MigrationReport{Format: TagStoreFormatV2}
+	consolidated, err := readConsolidatedTags(ctx, r)
+	if err != nil {
+		return report, err
+	}
+	if consolidated != nil {
+		report.Format = consolidated.Version
+	}
+
+	tagService := r.Tags(ctx)
+	tags, err := tagService.All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+			return report, err
+		}
+	}
+
+	converted := &consolidatedTags{
+		Version: TagStoreFormatV3,
+		Tags:    make(map[string]digest.Digest),
+	}
+	for _, tag := range tags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			report.Errors = append(report.Errors, MigrationError{Tag: tag, Err: err})
+			continue
+		}
+		converted.Tags[tag] = desc.Digest
+		if consolidated != nil && consolidated.Tags[tag] == desc.Digest {
+			report.Skipped = append(report.Skipped, tag)
+			continue
+		}
+		report.Migrated = append(report.Migrated, tag)
+	}
+
+	// The document is rewritten when tags were converted, and when tags
+	// were removed since the last migration.
+	if dryRun || (len(report.Migrated) == 0 && consolidated != nil && len(consolidated.Tags) == len(report.Skipped)) {
+		return report, nil
+	}
+	p, err := json.Marshal(converted)
+	if err != nil {
+		return report, err
+	}
+	consolidatedPath, err := pathFor(manifestTagsConsolidatedPathSpec{name: r.Named().Name()})
+	if err != nil {
+		return report, err
+	}
+	if err := r.driver.PutContent(ctx, consolidatedPath, p); err != nil {
+		return report, err
+	}
+
+	written, err := readConsolidatedTags(ctx, r)
+	if err != nil {
+		return report, err
+	}
+	var verified []string
+	for _, tag := range report.Migrated {
+		if dgst := written.Tags[tag]; dgst != converted.Tags[tag] {
+			report.Errors = append(report.Errors, MigrationError{
+				Tag: tag,
+				Err: fmt.Errorf("converted tag points to %q rather than %s", dgst, converted.Tags[tag]),
+			})
+			continue
+		}
+		verified = append(verified, tag)
+	}
+	report.Migrated = verified
+	return report, nil
+}
+
+// readConsolidatedTags returns the document of the tags of r in
+// TagStoreFormatV3, or nil if there is none.
+func readConsolidatedTags(ctx context.Context, r *repository) (*consolidatedTags, error) {
+	consolidatedPath, err := pathFor(manifestTagsConsolidatedPathSpec{name: r.Named().Name()})
+	if err != nil {
+		return nil, err
+	}
+	p, err := r.driver.GetContent(ctx, consolidatedPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var consolidated consolidatedTags
+	if err := json.Unmarshal(p, &consolidated); err != nil {
+		return nil, fmt.Errorf("invalid consolidated tags of %s: %v", r.Named().Name(), err)
+	}
+	if consolidated.Version != TagStoreFormatV3 {
+		return nil, fmt.Errorf("unsupported tag store format %d of %s", consolidated.Version, r.Named().Name())
+	}
+	return &consolidated, nil
+}
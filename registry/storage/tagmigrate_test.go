@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestMigrateTagStore(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	repo := makeRepository(t, createRegistry(t, d), "foo/migrate")
+	tags := repo.Tags(ctx)
+	first := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	second := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	for _, tag := range []string{"latest", "v1", "v2"} {
+		if err := tags.Tag(ctx, tag, first); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkFormat := func(expected TagStoreFormat) {
+		t.Helper()
+		format, err := DetectTagStoreFormat(ctx, repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != expected {
+			t.Fatalf("unexpected tag store format %d, expected %d", format, expected)
+		}
+	}
+	checkReport := func(report MigrationReport, format TagStoreFormat, migrated, skipped []string, errors int) {
+		t.Helper()
+		if report.Format != format || !reflect.DeepEqual(report.Migrated, migrated) || !reflect.DeepEqual(report.Skipped, skipped) || len(report.Errors) != errors {
+			t.Fatalf("unexpected migration report %+v", report)
+		}
+	}
+
+	// A dry run reports the tags to convert without writing them.
+	report, err := MigrateTagStore(ctx, repo, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReport(report, TagStoreFormatV2, []string{"latest", "v1", "v2"}, nil, 0)
+	checkFormat(TagStoreFormatV2)
+
+	report, err = MigrateTagStore(ctx, repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReport(report, TagStoreFormatV2, []string{"latest", "v1", "v2"}, nil, 0)
+	checkFormat(TagStoreFormatV3)
+
+	consolidated, err := readConsolidatedTags(ctx, repo.(*repository))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"latest", "v1", "v2"} {
+		if consolidated.Tags[tag] != first.Digest {
+			t.Fatalf("unexpected converted tag %s: %s", tag, consolidated.Tags[tag])
+		}
+	}
+
+	// The tags are still served from the link files.
+	desc, err := tags.Get(ctx, "latest")
+	if err != nil || desc.Digest != first.Digest {
+		t.Fatalf("unexpected tag after migration: %v, %v", desc, err)
+	}
+
+	// Running the migration again converts the tags changed since.
+	if err := tags.Tag(ctx, "latest", second); err != nil {
+		t.Fatal(err)
+	}
+	report, err = MigrateTagStore(ctx, repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReport(report, TagStoreFormatV3, []string{"latest"}, []string{"v1", "v2"}, 0)
+	consolidated, err = readConsolidatedTags(ctx, repo.(*repository))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consolidated.Tags["latest"] != second.Digest {
+		t.Fatalf("unexpected converted tag latest: %s", consolidated.Tags["latest"])
+	}
+
+	// Tags which cannot be read are reported.
+	linkPath, err := pathFor(manifestTagCurrentPathSpec{name: "foo/migrate", tag: "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutContent(ctx, linkPath, []byte("not a digest")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = MigrateTagStore(ctx, repo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReport(report, TagStoreFormatV3, nil, []string{"latest", "v1"}, 1)
+	if report.Errors[0].Tag != "v2" {
+		t.Fatalf("unexpected migration error %v", report.Errors[0])
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+)
+
+// A TagObserver is notified of the tags set and removed by the tag store,
+// such as to audit them, invalidate caches or trigger replication. Observers
+// are called synchronously once the operation succeeded, and cannot fail it:
+// those doing slow work should hand it off.
+type TagObserver interface {
+	// OnTag is called once tag of repo points to desc.
+	OnTag(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor)
+
+	// OnUntag is called once tag of repo is removed.
+	OnUntag(ctx context.Context, repo reference.Named, tag string)
+}
+
+// FanoutTagObserver notifies each of its observers, in order.
+type FanoutTagObserver []TagObserver
+
+var _ TagObserver = FanoutTagObserver{}
+
+// OnTag calls OnTag of each observer.
+func (observers FanoutTagObserver) OnTag(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor) {
+	for _, o := range observers {
+		o.OnTag(ctx, repo, tag, desc)
+	}
+}
+
+// OnUntag calls OnUntag of each observer.
+func (observers FanoutTagObserver) OnUntag(ctx context.Context, repo reference.Named, tag string) {
+	for _, o := range observers {
+		o.OnUntag(ctx, repo, tag)
+	}
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+)
+
+// recordingTagObserver records the notifications it receives.
+type recordingTagObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *recordingTagObserver) OnTag(ctx context.Context, repo reference.Named, tag string, desc distribution.Descriptor) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, "tag "+repo.Name()+":"+tag+"@"+desc.Digest.String())
+}
+
+func (o *recordingTagObserver) OnUntag(ctx context.Context, repo reference.Named, tag string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, "untag "+repo.Name()+":"+tag)
+}
+
+func TestTagObserver(t *testing.T) {
+	first, second := &recordingTagObserver{}, &recordingTagObserver{}
+	env := testTagStore(t, WithTagObserver(first), WithTagObserver(second))
+	tags := env.ts
+	ctx := env.ctx
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	if err := tags.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Rename(ctx, "latest", "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Untag(ctx, "stable"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed operations are not notified.
+	if err := tags.Tag(ctx, "in valid", desc); err == nil {
+		t.Fatal("expected an error tagging an invalid tag")
+	}
+	if err := tags.Untag(ctx, "missing"); err == nil {
+		t.Fatal("expected an error untagging an unknown tag")
+	}
+
+	expected := []string{
+		"tag a/b:latest@" + desc.Digest.String(),
+		"tag a/b:stable@" + desc.Digest.String(),
+		"untag a/b:latest",
+		"untag a/b:stable",
+	}
+	for _, o := range []*recordingTagObserver{first, second} {
+		if !reflect.DeepEqual(o.events, expected) {
+			t.Fatalf("unexpected notifications: %v != %v", o.events, expected)
+		}
+	}
+}
+
+func TestTagObserverCaseInsensitive(t *testing.T) {
+	o := &recordingTagObserver{}
+	env := testTagStore(t, CaseInsensitiveTags, WithTagObserver(o))
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	if err := env.ts.Tag(env.ctx, "Latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.ts.Untag(env.ctx, "LATEST"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Observers are given the tags as stored.
+	expected := []string{
+		"tag a/b:latest@" + desc.Digest.String(),
+		"untag a/b:latest",
+	}
+	if !reflect.DeepEqual(o.events, expected) {
+		t.Fatalf("unexpected notifications: %v != %v", o.events, expected)
+	}
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/policy"
+)
+
+// PolicyTagStore is a TagService hiding the tags of a repository which a tag
+// policy does not retain, such that garbage collection treats the manifests
+// they reference as untagged. Locked tags are always retained.
+type PolicyTagStore struct {
+	distribution.TagService
+	expired map[string]bool
+}
+
+// NewPolicyTagStore evaluates p for the tags of repo, from the most recently
+// to the least recently tagged, and returns the tag service of repo hiding
+// the tags p does not retain, other than the locked tags. The age of a tag is the time elapsed since the
+// creation recorded in its metadata or, for tags tagged before it was
+// recorded, since the last write of its link.
+func NewPolicyTagStore(ctx context.Context, repo distribution.Repository, storageDriver driver.StorageDriver, p policy.TagPolicy) (*PolicyTagStore, error) {
+	tags := repo.Tags(ctx)
+	all, err := tags.All(ctx)
+	if err != nil {
+		switch err.(type) {
+		case distribution.ErrRepositoryUnknown, driver.PathNotFoundError:
+			return &PolicyTagStore{TagService: tags}, nil
+		}
+		return nil, err
+	}
+
+	type taggedDescriptor struct {
+		tag  string
+		desc distribution.Descriptor
+		age  time.Duration
+	}
+	now := time.Now()
+	tagged := make([]taggedDescriptor, 0, len(all))
+	for _, tag := range all {
+		desc, err := tags.Get(ctx, tag)
+		if _, ok := err.(distribution.ErrTagUnknown); ok {
+			// untagged meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		created, err := tagCreated(ctx, tags, storageDriver, repo.Named().Name(), tag)
+		if err != nil {
+			return nil, err
+		}
+		tagged = append(tagged, taggedDescriptor{tag: tag, desc: desc, age: now.Sub(created)})
+	}
+	sort.SliceStable(tagged, func(i, j int) bool {
+		return tagged[i].age < tagged[j].age
+	})
+
+	expired := make(map[string]bool)
+	for _, t := range tagged {
+		retain, err := p.ShouldRetain(ctx, repo.Named(), t.tag, t.desc, t.age)
+		if err != nil {
+			return nil, err
+		}
+		if retain {
+			continue
+		}
+		locked, err := TagLocked(ctx, storageDriver, repo.Named().Name(), t.tag)
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			expired[t.tag] = true
+		}
+	}
+	return &PolicyTagStore{TagService: tags, expired: expired}, nil
+}
+
+// tagCreated returns the time tag of the repository name was pointed to its
+// current manifest.
+func tagCreated(ctx context.Context, tags distribution.TagService, storageDriver driver.StorageDriver, name, tag string) (time.Time, error) {
+	if provider, ok := tags.(distribution.TagMetadataProvider); ok {
+		metadata, err := provider.GetMetadata(ctx, tag)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !metadata.Created.IsZero() {
+			return metadata.Created, nil
+		}
+	}
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{name: name, tag: tag})
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err := storageDriver.Stat(ctx, currentPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// Expired returns the tags the policy does not retain, in lexical order.
+func (ts *PolicyTagStore) Expired() []string {
+	expired := make([]string, 0, len(ts.expired))
+	for tag := range ts.expired {
+		expired = append(expired, tag)
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// Get returns ErrTagUnknown for the tags the policy does not retain.
+func (ts *PolicyTagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	if ts.expired[tag] {
+		return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+	}
+	return ts.TagService.Get(ctx, tag)
+}
+
+// Exists reports the tags the policy does not retain as missing.
+func (ts *PolicyTagStore) Exists(ctx context.Context, tag string) (bool, error) {
+	if ts.expired[tag] {
+		return false, nil
+	}
+	return ts.TagService.Exists(ctx, tag)
+}
+
+// All returns the tags the policy retains.
+func (ts *PolicyTagStore) All(ctx context.Context) ([]string, error) {
+	tags, err := ts.TagService.All(ctx)
+	return ts.retained(tags), err
+}
+
+// AllPaged pages through the tags the policy retains.
+func (ts *PolicyTagStore) AllPaged(ctx context.Context, last string, count int) ([]string, error) {
+	tags, err := ts.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return distribution.PageTags(tags, last, count), nil
+}
+
+// Lookup returns the tags referencing desc which the policy retains.
+func (ts *PolicyTagStore) Lookup(ctx context.Context, desc distribution.Descriptor, opts ...distribution.LookupOption) ([]string, error) {
+	tags, err := ts.TagService.Lookup(ctx, desc, opts...)
+	return ts.retained(tags), err
+}
+
+func (ts *PolicyTagStore) retained(tags []string) []string {
+	if len(ts.expired) == 0 {
+		return tags
+	}
+	retained := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !ts.expired[tag] {
+			retained = append(retained, tag)
+		}
+	}
+	return retained
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+var errTransient = errors.New("transient storage error")
+
+// flakyLinkDriver fails the writes of the current links of tags, as many
+// times as set in failures, or always if failures is negative.
+type flakyLinkDriver struct {
+	storagedriver.StorageDriver
+
+	mu       sync.Mutex
+	failures int
+	writes   int
+}
+
+func (d *flakyLinkDriver) fail(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures = n
+	d.writes = 0
+}
+
+func (d *flakyLinkDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	if strings.HasSuffix(path, "/current/link") {
+		d.mu.Lock()
+		d.writes++
+		failing := d.failures != 0
+		if d.failures > 0 {
+			d.failures--
+		}
+		d.mu.Unlock()
+		if failing {
+			return errTransient
+		}
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+func testFlakyTagStore(t *testing.T, retries int) (distribution.TagService, *flakyLinkDriver) {
+	ctx := context.Background()
+	d := &flakyLinkDriver{StorageDriver: inmemory.New()}
+	reg, err := NewRegistry(ctx, d, TagLinkRetries(retries, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo.Tags(ctx), d
+}
+
+func TestTagRetriesTransientError(t *testing.T) {
+	ctx := context.Background()
+	tags, d := testFlakyTagStore(t, 3)
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	d.fail(1)
+	if err := tags.Tag(ctx, "latest", desc); err != nil {
+		t.Fatalf("unexpected error tagging after a transient error: %v", err)
+	}
+	if d.writes != 2 {
+		t.Fatalf("expected the current link written twice, got %d writes", d.writes)
+	}
+	got, err := tags.Get(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Digest != desc.Digest {
+		t.Fatalf("unexpected digest of tag: %s != %s", got.Digest, desc.Digest)
+	}
+}
+
+func TestTagRetriesExhausted(t *testing.T) {
+	ctx := context.Background()
+	tags, d := testFlakyTagStore(t, 2)
+	first := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	second := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	// A new tag failing is removed altogether.
+	d.fail(-1)
+	if err := tags.Tag(ctx, "new", first); err != errTransient {
+		t.Fatalf("expected the transient error, got %v", err)
+	}
+	if d.writes != 3 {
+		t.Fatalf("expected the current link written 3 times, got %d writes", d.writes)
+	}
+	if all, err := tags.All(ctx); err == nil && len(all) > 0 {
+		t.Fatalf("expected the failed tag not listed, got %v", all)
+	}
+
+	// An existing tag failing is left as it was.
+	d.fail(0)
+	if err := tags.Tag(ctx, "latest", first); err != nil {
+		t.Fatal(err)
+	}
+	d.fail(-1)
+	if err := tags.Tag(ctx, "latest", second); err != errTransient {
+		t.Fatalf("expected the transient error, got %v", err)
+	}
+	// Tagging the current revision again keeps its index entry.
+	if err := tags.Tag(ctx, "latest", first); err != errTransient {
+		t.Fatalf("expected the transient error, got %v", err)
+	}
+	d.fail(0)
+
+	got, err := tags.Get(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Digest != first.Digest {
+		t.Fatalf("unexpected digest of tag: %s != %s", got.Digest, first.Digest)
+	}
+	history, err := tags.History(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Digest != first.Digest {
+		t.Fatalf("expected the history of the tag to hold the current revision only, got %v", history)
+	}
+	all, err := tags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0] != "latest" {
+		t.Fatalf("unexpected tags: %v", all)
+	}
+}
+
+func TestTagLinkRetriesInvalid(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewRegistry(ctx, inmemory.New(), TagLinkRetries(-1, 0)); err == nil {
+		t.Fatal("expected an error configuring negative retries")
+	}
+	if _, err := NewRegistry(ctx, inmemory.New(), TagLinkRetries(1, -time.Second)); err == nil {
+		t.Fatal("expected an error configuring a negative retry delay")
+	}
+}
+
+func TestTagFailureKeepsMetadata(t *testing.T) {
+	ctx := context.Background()
+	tags, d := testFlakyTagStore(t, 0)
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	if err := tags.Tag(ctx, "latest", desc, distribution.WithActor("alice")); err != nil {
+		t.Fatal(err)
+	}
+	d.fail(-1)
+	if err := tags.Tag(ctx, "latest", desc, distribution.WithActor("bob")); err != errTransient {
+		t.Fatalf("expected the transient error, got %v", err)
+	}
+	d.fail(0)
+
+	// The tag was not written again, so its metadata is the one of the
+	// tagging which succeeded.
+	metadata, err := tags.(distribution.TagMetadataProvider).GetMetadata(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Actor != "alice" {
+		t.Fatalf("unexpected actor of the tag: %q != %q", metadata.Actor, "alice")
+	}
+}
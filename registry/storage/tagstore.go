@@ -2,15 +2,55 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"path"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/distribution/distribution/v3"
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/opencontainers/go-digest"
 )
 
-var _ distribution.TagService = &tagStore{}
+var (
+	_ distribution.TagService          = &tagStore{}
+	_ distribution.TagMetadataProvider = &tagStore{}
+)
+
+const (
+	// maxTagLength is the length of the longest valid tag.
+	maxTagLength = 128
+
+	// defaultTagLinkRetryDelay is the delay before retrying to write the
+	// current link of a tag, unless configured otherwise.
+	defaultTagLinkRetryDelay = 100 * time.Millisecond
+)
+
+// anchoredTagRegexp matches valid tag names, as a whole.
+var anchoredTagRegexp = regexp.MustCompile(`^` + reference.TagRegexp.String() + `$`)
+
+// validateTag returns an ErrTagInvalid when tag is not a valid tag name, such
+// that invalid names are rejected before reaching the storage driver.
+func validateTag(tag string) error {
+	var reason string
+	switch {
+	case tag == "":
+		reason = "tag is empty"
+	case len(tag) > maxTagLength:
+		reason = fmt.Sprintf("tag is longer than %d characters", maxTagLength)
+	case !anchoredTagRegexp.MatchString(tag):
+		reason = "tag must start with a letter, a digit or an underscore, followed by letters, digits, underscores, periods or dashes"
+	default:
+		return nil
+	}
+	return distribution.ErrTagInvalid{Tag: tag, Reason: reason}
+}
 
 // tagStore provides methods to manage manifest tags in a backend storage driver.
 // This implementation uses the same on-disk layout as the (now deleted) tag
@@ -20,10 +60,50 @@ var _ distribution.TagService = &tagStore{}
 type tagStore struct {
 	repository *repository
 	blobStore  *blobStore
+
+	// caseInsensitive stores tags in lowercase, such that tags which differ
+	// only in case refer to the same tag. Otherwise, tagging with a tag which
+	// differs only in case from an existing tag is handled according to
+	// collisionCheck.
+	caseInsensitive bool
+	collisionCheck  TagCollisionCheck
+
+	// observers are notified of the tags set and removed.
+	observers FanoutTagObserver
+
+	// linkRetries is the number of times the write of the current link of
+	// a tag is retried, the first retry after linkRetryDelay.
+	linkRetries    int
+	linkRetryDelay time.Duration
+
+	// metrics, when set, record the latency and the errors of the
+	// operations.
+	metrics *tagStoreMetrics
+}
+
+// observe records the operation started at start, which failed unless *err
+// is nil.
+func (ts *tagStore) observe(operation string, start time.Time, err *error) {
+	ts.metrics.observe(ts.repository.Named().Name(), operation, start, *err)
+}
+
+// observeGet records the Get operation started at start, counting unknown
+// tags as misses rather than errors.
+func (ts *tagStore) observeGet(start time.Time, err *error) {
+	if _, ok := (*err).(distribution.ErrTagUnknown); ok {
+		ts.metrics.observeMiss(ts.repository.Named().Name(), "Get", start)
+		return
+	}
+	ts.observe("Get", start, err)
 }
 
 // All returns all tags
-func (ts *tagStore) All(ctx context.Context) ([]string, error) {
+func (ts *tagStore) All(ctx context.Context) (tags []string, err error) {
+	defer ts.observe("All", time.Now(), &err)
+	return ts.all(ctx)
+}
+
+func (ts *tagStore) all(ctx context.Context) ([]string, error) {
 	var tags []string
 
 	pathSpec, err := pathFor(manifestTagPathSpec{
@@ -55,9 +135,64 @@ func (ts *tagStore) All(ctx context.Context) ([]string, error) {
 	return tags, nil
 }
 
+// AllPaged returns the tags after last, up to count of them. The storage
+// drivers list the tags of a directory at once, so the tags are paged once
+// listed.
+func (ts *tagStore) AllPaged(ctx context.Context, last string, count int) ([]string, error) {
+	tags, err := ts.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return distribution.PageTags(tags, last, count), nil
+}
+
 // Tag tags the digest with the given tag, updating the the store to point at
-// the current tag. The digest must point to a manifest.
-func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+// the current tag. The digest must point to a manifest. Locked tags are only
+// overwritten in contexts bypassing the locks. The time of tagging and the
+// actor set by opts are recorded in the index entry of the digest. The write
+// of the current link is retried as configured, and the index entry removed
+// if it still fails, unless it predates the call. A copy onto the tag which
+// was interrupted is undone first.
+func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor, opts ...distribution.TagOption) (err error) {
+	defer ts.observe("Tag", time.Now(), &err)
+	if err := validateTag(tag); err != nil {
+		return err
+	}
+	tag = ts.normalize(tag)
+	if !tagLockBypassed(ctx) {
+		locked, err := TagLocked(ctx, ts.blobStore.driver, ts.repository.Named().Name(), tag)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return distribution.ErrTagLocked{Tag: tag}
+		}
+	}
+
+	// Instances sharing the storage could otherwise interleave their updates
+	// of the links of the tag.
+	if locker, ok := ts.blobStore.driver.(storagedriver.LockableDriver); ok {
+		tagPath, err := pathFor(manifestTagPathSpec{
+			name: ts.repository.Named().Name(),
+			tag:  tag,
+		})
+		if err != nil {
+			return err
+		}
+		unlock, err := locker.Lock(ctx, tagPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if err := ts.recoverCopy(ctx, tag); err != nil {
+		return err
+	}
+	if err := ts.checkCaseVariant(ctx, tag, ""); err != nil {
+		return err
+	}
+
 	currentPath, err := pathFor(manifestTagCurrentPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -66,19 +201,175 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 		return err
 	}
 
+	indexEntryPath, err := pathFor(manifestTagIndexEntryPathSpec{
+		name:     ts.repository.Named().Name(),
+		tag:      tag,
+		revision: desc.Digest,
+	})
+	if err != nil {
+		return err
+	}
+	indexed := true
+	if _, err := ts.blobStore.driver.Stat(ctx, indexEntryPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+		indexed = false
+	}
+	// fail removes the index entry created for a tag which could not be
+	// set, leaving the tag as it was.
+	fail := func(err error) error {
+		if !indexed {
+			ts.removeIndexEntry(ctx, tag, indexEntryPath)
+		}
+		return err
+	}
+
 	lbs := ts.linkedBlobStore(ctx, tag)
 
 	// Link into the index
 	if err := lbs.linkBlob(ctx, desc); err != nil {
-		return err
+		return fail(err)
 	}
 
 	// Overwrite the current link
-	return ts.blobStore.link(ctx, currentPath, desc.Digest)
+	if err := ts.linkCurrent(ctx, currentPath, desc.Digest); err != nil {
+		return fail(err)
+	}
+
+	// The metadata is only written once the tag points to the revision, so
+	// that a failed tagging leaves the metadata of an earlier one in place.
+	ts.putMetadata(ctx, tag, desc.Digest, distribution.TagMetadata{
+		Created: time.Now().UTC(),
+		Actor:   distribution.NewTagOptions(opts...).Actor,
+	})
+	ts.observers.OnTag(ctx, ts.repository.Named(), tag, desc)
+	return nil
+}
+
+// putMetadata records the metadata of the tagging of tag with revision. The
+// tag is set already, so errors are logged. The metadata of an earlier
+// tagging with revision is then removed, such that the tag reads as tagged
+// when its current link was written.
+func (ts *tagStore) putMetadata(ctx context.Context, tag string, revision digest.Digest, metadata distribution.TagMetadata) {
+	metadataPath, err := pathFor(manifestTagIndexEntryMetadataPathSpec{
+		name:     ts.repository.Named().Name(),
+		tag:      tag,
+		revision: revision,
+	})
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error recording the metadata of tag %s: %v", tag, err)
+		return
+	}
+	p, err := json.Marshal(metadata)
+	if err == nil {
+		err = ts.blobStore.driver.PutContent(ctx, metadataPath, p)
+	}
+	if err == nil {
+		return
+	}
+	dcontext.GetLogger(ctx).Errorf("error recording the metadata of tag %s: %v", tag, err)
+	if err := ts.blobStore.driver.Delete(ctx, metadataPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			dcontext.GetLogger(ctx).Errorf("error removing the stale metadata of tag %s: %v", tag, err)
+		}
+	}
+}
+
+// linkCurrent writes the current link of a tag at path, retrying the failed
+// writes linkRetries times with an exponential back-off.
+func (ts *tagStore) linkCurrent(ctx context.Context, path string, dgst digest.Digest) error {
+	delay := ts.linkRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := ts.blobStore.link(ctx, path, dgst)
+		if err == nil || attempt >= ts.linkRetries {
+			return err
+		}
+		dcontext.GetLogger(ctx).Warnf("error writing %s, retrying in %s: %v", path, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// removeIndexEntry removes the index entry of tag at path, and the tag itself
+// when it is left without a current link. Errors are logged, as the tagging
+// has failed already.
+func (ts *tagStore) removeIndexEntry(ctx context.Context, tag, path string) {
+	if err := ts.blobStore.driver.Delete(ctx, path); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			dcontext.GetLogger(ctx).Errorf("error removing index entry %s of failed tag: %v", path, err)
+			return
+		}
+	}
+	if _, err := ts.get(ctx, tag); err != nil {
+		if _, ok := err.(distribution.ErrTagUnknown); ok {
+			ts.removeEmptyTag(ctx, tag)
+		}
+	}
 }
 
 // resolve the current revision for name and tag.
-func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+func (ts *tagStore) Get(ctx context.Context, tag string) (desc distribution.Descriptor, err error) {
+	defer ts.observeGet(time.Now(), &err)
+	if err := validateTag(tag); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	desc, err = ts.get(ctx, ts.normalize(tag))
+	if _, ok := err.(distribution.ErrTagUnknown); ok && ts.caseInsensitive {
+		// The tag may have been stored before tags were case insensitive.
+		existing, verr := ts.caseVariant(ctx, tag)
+		if verr != nil {
+			return distribution.Descriptor{}, verr
+		}
+		if existing != "" {
+			return ts.get(ctx, existing)
+		}
+	}
+	return desc, err
+}
+
+// Exists reports whether tag exists by stat'ing its current link, which
+// storage drivers answer more cheaply than reading it.
+func (ts *tagStore) Exists(ctx context.Context, tag string) (_ bool, err error) {
+	defer ts.observe("Exists", time.Now(), &err)
+	if err := validateTag(tag); err != nil {
+		return false, err
+	}
+	exists, err := ts.exists(ctx, ts.normalize(tag))
+	if err != nil || exists || !ts.caseInsensitive {
+		return exists, err
+	}
+	// The tag may have been stored before tags were case insensitive.
+	existing, err := ts.caseVariant(ctx, tag)
+	if err != nil {
+		return false, err
+	}
+	return existing != "", nil
+}
+
+func (ts *tagStore) exists(ctx context.Context, tag string) (bool, error) {
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  tag,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := ts.blobStore.driver.Stat(ctx, currentPath); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (ts *tagStore) get(ctx context.Context, tag string) (distribution.Descriptor, error) {
 	currentPath, err := pathFor(manifestTagCurrentPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -100,8 +391,90 @@ func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descripto
 	return distribution.Descriptor{Digest: revision}, nil
 }
 
-// Untag removes the tag association
-func (ts *tagStore) Untag(ctx context.Context, tag string) error {
+// GetMetadata returns the metadata recorded when tag was pointed to its
+// current revision, or the zero TagMetadata for tags tagged before the
+// metadata was recorded.
+func (ts *tagStore) GetMetadata(ctx context.Context, tag string) (_ distribution.TagMetadata, err error) {
+	defer ts.observe("GetMetadata", time.Now(), &err)
+	if err := validateTag(tag); err != nil {
+		return distribution.TagMetadata{}, err
+	}
+	tag = ts.normalize(tag)
+	desc, err := ts.get(ctx, tag)
+	if _, ok := err.(distribution.ErrTagUnknown); ok && ts.caseInsensitive {
+		// The tag may have been stored before tags were case insensitive.
+		existing, verr := ts.caseVariant(ctx, tag)
+		if verr != nil {
+			return distribution.TagMetadata{}, verr
+		}
+		if existing != "" {
+			tag = existing
+			desc, err = ts.get(ctx, tag)
+		}
+	}
+	if err != nil {
+		return distribution.TagMetadata{}, err
+	}
+
+	metadataPath, err := pathFor(manifestTagIndexEntryMetadataPathSpec{
+		name:     ts.repository.Named().Name(),
+		tag:      tag,
+		revision: desc.Digest,
+	})
+	if err != nil {
+		return distribution.TagMetadata{}, err
+	}
+	p, err := ts.blobStore.driver.GetContent(ctx, metadataPath)
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return distribution.TagMetadata{}, nil
+		}
+		return distribution.TagMetadata{}, err
+	}
+	var metadata distribution.TagMetadata
+	if err := json.Unmarshal(p, &metadata); err != nil {
+		return distribution.TagMetadata{}, err
+	}
+	return metadata, nil
+}
+
+// Untag removes the tag association. Locked tags are only removed in contexts
+// bypassing the locks.
+func (ts *tagStore) Untag(ctx context.Context, tag string) (err error) {
+	defer ts.observe("Untag", time.Now(), &err)
+	if err := validateTag(tag); err != nil {
+		return err
+	}
+	untagged := ts.normalize(tag)
+	if !tagLockBypassed(ctx) {
+		locked, err := TagLocked(ctx, ts.blobStore.driver, ts.repository.Named().Name(), untagged)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return distribution.ErrTagLocked{Tag: untagged}
+		}
+	}
+	err = ts.untag(ctx, untagged)
+	if _, ok := err.(storagedriver.PathNotFoundError); ok && ts.caseInsensitive {
+		// The tag may have been stored before tags were case insensitive.
+		existing, verr := ts.caseVariant(ctx, tag)
+		if verr != nil {
+			return verr
+		}
+		if existing != "" {
+			untagged = existing
+			err = ts.untag(ctx, existing)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	ts.observers.OnUntag(ctx, ts.repository.Named(), untagged)
+	return nil
+}
+
+func (ts *tagStore) untag(ctx context.Context, tag string) error {
 	tagPath, err := pathFor(manifestTagPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
@@ -113,6 +486,148 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 	return ts.blobStore.driver.Delete(ctx, tagPath)
 }
 
+// Rename renames the tag src to dst. The current link of src is moved to
+// dst, such that the tag resolves under either name at any time, then the
+// index of dst is updated and the rest of src removed. Of concurrent renames
+// of src, only one succeeds, the others returning ErrTagUnknown. Locked tags
+// are only renamed, and overwritten, in contexts bypassing the locks.
+func (ts *tagStore) Rename(ctx context.Context, src, dst string) (err error) {
+	defer ts.observe("Rename", time.Now(), &err)
+	for _, tag := range []string{src, dst} {
+		if err := validateTag(tag); err != nil {
+			return err
+		}
+	}
+	src, dst = ts.normalize(src), ts.normalize(dst)
+	name := ts.repository.Named().Name()
+	if !tagLockBypassed(ctx) {
+		for _, tag := range []string{src, dst} {
+			locked, err := TagLocked(ctx, ts.blobStore.driver, name, tag)
+			if err != nil {
+				return err
+			}
+			if locked {
+				return distribution.ErrTagLocked{Tag: tag}
+			}
+		}
+	}
+
+	if err := ts.checkCaseVariant(ctx, dst, src); err != nil {
+		return err
+	}
+	if _, err := ts.get(ctx, dst); err == nil {
+		return distribution.ErrTagConflict{Tag: src, ExistingTag: dst}
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		return err
+	}
+
+	srcPath, err := pathFor(manifestTagCurrentPathSpec{name: name, tag: src})
+	if err != nil {
+		return err
+	}
+	dstPath, err := pathFor(manifestTagCurrentPathSpec{name: name, tag: dst})
+	if err != nil {
+		return err
+	}
+	if err := ts.blobStore.driver.Move(ctx, srcPath, dstPath); err != nil {
+		// The drivers create the parents of dst before finding src is
+		// missing, which leaves dst listed without a current link.
+		if _, derr := ts.get(ctx, dst); derr != nil {
+			if _, ok := derr.(distribution.ErrTagUnknown); ok {
+				ts.removeEmptyTag(ctx, dst)
+			}
+		}
+		// src was moved by a concurrent rename, which some drivers report
+		// as another error than PathNotFoundError.
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return distribution.ErrTagUnknown{Tag: src}
+		}
+		if _, serr := ts.get(ctx, src); serr != nil {
+			if _, ok := serr.(distribution.ErrTagUnknown); ok {
+				return serr
+			}
+		}
+		return err
+	}
+
+	desc, err := ts.get(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if err := ts.linkedBlobStore(ctx, dst).linkBlob(ctx, desc); err != nil {
+		return err
+	}
+	if err := ts.untag(ctx, src); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return err
+		}
+	}
+	// Observers see a rename as dst being tagged, then src untagged.
+	ts.observers.OnTag(ctx, ts.repository.Named(), dst, desc)
+	ts.observers.OnUntag(ctx, ts.repository.Named(), src)
+	return nil
+}
+
+// removeEmptyTag removes the directory of the tag left without a current
+// link by a failed rename or copy.
+func (ts *tagStore) removeEmptyTag(ctx context.Context, tag string) {
+	err := ts.untag(ctx, tag)
+	if _, ok := err.(storagedriver.PathNotFoundError); err != nil && !ok {
+		dcontext.GetLogger(ctx).Errorf("error removing tag %s left without a current link: %v", tag, err)
+	}
+}
+
+// normalize returns the tag as stored, in lowercase when tags are case
+// insensitive.
+func (ts *tagStore) normalize(tag string) string {
+	if ts.caseInsensitive {
+		return strings.ToLower(tag)
+	}
+	return tag
+}
+
+// checkCaseVariant checks the tags of the repository for a tag differing
+// from tag only in case, other than except, before tagging with tag. Such a
+// tag is reported as ErrTagCollision, or logged, depending on the collision
+// check of the tag store.
+func (ts *tagStore) checkCaseVariant(ctx context.Context, tag, except string) error {
+	if ts.caseInsensitive || ts.collisionCheck == TagCollisionCheckOff {
+		return nil
+	}
+	existing, err := ts.caseVariant(ctx, tag)
+	if err != nil {
+		return err
+	}
+	if existing == "" || existing == except {
+		return nil
+	}
+	if ts.collisionCheck == TagCollisionCheckWarn {
+		dcontext.GetLogger(ctx).Warnf("tag %s of repository %s differs only in case from the existing tag %s", tag, ts.repository.Named().Name(), existing)
+		return nil
+	}
+	return distribution.ErrTagCollision{Tag: tag, ExistingTag: existing}
+}
+
+// caseVariant returns the existing tag which differs from tag only in case,
+// if any.
+func (ts *tagStore) caseVariant(ctx context.Context, tag string) (string, error) {
+	allTags, err := ts.all(ctx)
+	switch err.(type) {
+	case distribution.ErrRepositoryUnknown:
+		return "", nil
+	case nil:
+	default:
+		return "", err
+	}
+
+	for _, existing := range allTags {
+		if existing != tag && strings.EqualFold(existing, tag) {
+			return existing, nil
+		}
+	}
+	return "", nil
+}
+
 // linkedBlobStore returns the linkedBlobStore for the named tag, allowing one
 // to index manifest blobs by tag name. While the tag store doesn't map
 // precisely to the linked blob store, using this ensures the links are
@@ -132,10 +647,35 @@ func (ts *tagStore) linkedBlobStore(ctx context.Context, tag string) *linkedBlob
 	}
 }
 
+var _ distribution.StreamingTagService = &tagStore{}
+
 // Lookup recovers a list of tags which refer to this digest.  When a manifest is deleted by
 // digest, tag entries which point to it need to be recovered to avoid dangling tags.
-func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([]string, error) {
-	allTags, err := ts.All(ctx)
+// The tags are resolved concurrently, DefaultLookupConcurrency at a time
+// unless set with WithConcurrency. Tags are no longer resolved once ctx is
+// done.
+func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor, opts ...distribution.LookupOption) (tags []string, err error) {
+	defer ts.observe("Lookup", time.Now(), &err)
+	return distribution.LookupStreamToSlice(ctx, ts, desc, opts...)
+}
+
+// LookupStream sends the tags which refer to this digest as they are
+// resolved, as concurrently as Lookup. The first error stops the lookup.
+func (ts *tagStore) LookupStream(ctx context.Context, desc distribution.Descriptor, opts ...distribution.LookupOption) (<-chan string, <-chan error) {
+	tags := make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(tags)
+		if err := ts.lookup(ctx, desc, distribution.NewLookupOptions(opts...), tags); err != nil {
+			errs <- err
+		}
+	}()
+	return tags, errs
+}
+
+func (ts *tagStore) lookup(ctx context.Context, desc distribution.Descriptor, options distribution.LookupOptions, found chan<- string) error {
+	allTags, err := ts.all(ctx)
 	switch err.(type) {
 	case distribution.ErrRepositoryUnknown:
 		// This tag store has been initialized but not yet populated
@@ -143,35 +683,84 @@ func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([
 	case nil:
 		break
 	default:
-		return nil, err
+		return err
 	}
 
-	var tags []string
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		// Tags stored before tags were case insensitive may differ only in
+		// case.
+		seen = make(map[string]struct{})
+	)
+	sem := make(chan struct{}, options.Concurrency)
 	for _, tag := range allTags {
-		tagLinkPathSpec := manifestTagCurrentPathSpec{
-			name: ts.repository.Named().Name(),
-			tag:  tag,
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			continue
 		}
 
-		tagLinkPath, _ := pathFor(tagLinkPathSpec)
-		tagDigest, err := ts.blobStore.readlink(ctx, tagLinkPath)
-		if err != nil {
-			switch err.(type) {
-			case storagedriver.PathNotFoundError:
-				continue
+		wg.Add(1)
+		go func(tag string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			tagLinkPath, _ := pathFor(manifestTagCurrentPathSpec{
+				name: ts.repository.Named().Name(),
+				tag:  tag,
+			})
+			tagDigest, err := ts.blobStore.readlink(ctx, tagLinkPath)
+			if err != nil {
+				if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+				}
+				return
+			}
+			if tagDigest != desc.Digest {
+				return
 			}
-			return nil, err
-		}
 
-		if tagDigest == desc.Digest {
-			tags = append(tags, tag)
-		}
+			if ts.caseInsensitive {
+				tag = strings.ToLower(tag)
+				mu.Lock()
+				_, ok := seen[tag]
+				seen[tag] = struct{}{}
+				mu.Unlock()
+				if ok {
+					return
+				}
+			}
+			select {
+			case found <- tag:
+			case <-ctx.Done():
+			}
+		}(tag)
 	}
+	wg.Wait()
 
-	return tags, nil
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
 }
 
 func (ts *tagStore) ManifestDigests(ctx context.Context, tag string) ([]digest.Digest, error) {
+	tag = ts.normalize(tag)
 	tagLinkPath := func(name string, dgst digest.Digest) (string, error) {
 		return pathFor(manifestTagIndexEntryLinkPathSpec{
 			name:     name,
@@ -194,13 +783,13 @@ func (ts *tagStore) ManifestDigests(ctx context.Context, tag string) ([]digest.D
 			tag:  tag,
 		},
 	}
-	var dgsts []digest.Digest
-	err := lbs.Enumerate(ctx, func(dgst digest.Digest) error {
-		dgsts = append(dgsts, dgst)
-		return nil
-	})
+	descs, err := lbs.EnumerateAll(ctx)
 	if err != nil {
 		return nil, err
 	}
+	var dgsts []digest.Digest
+	for _, desc := range descs {
+		dgsts = append(dgsts, desc.Digest)
+	}
 	return dgsts, nil
 }
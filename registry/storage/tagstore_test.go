@@ -2,13 +2,22 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/schema2"
 	"github.com/distribution/distribution/v3/reference"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
 	digest "github.com/opencontainers/go-digest"
 )
@@ -21,10 +30,10 @@ type tagsTestEnv struct {
 	ctx context.Context
 }
 
-func testTagStore(t *testing.T) *tagsTestEnv {
+func testTagStore(t testing.TB, options ...RegistryOption) *tagsTestEnv {
 	ctx := context.Background()
 	d := inmemory.New()
-	reg, err := NewRegistry(ctx, d)
+	reg, err := NewRegistry(ctx, d, options...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -119,16 +128,613 @@ func TestTagStoreUnTag(t *testing.T) {
 	}
 }
 
+func TestTagStoreCaseSensitive(t *testing.T) {
+	env := testTagStore(t)
+	tags := env.ts
+	ctx := env.ctx
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	if err := tags.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	// Retagging is not a conflict.
+	if err := tags.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	err := tags.Tag(ctx, "Latest", desc)
+	expected := distribution.ErrTagCollision{Tag: "Latest", ExistingTag: "latest"}
+	if err != expected {
+		t.Fatalf("expected %v tagging with a tag differing only in case, got %v", expected, err)
+	}
+	if _, err := tags.Get(ctx, "Latest"); err == nil {
+		t.Fatal("expected tags differing only in case to be distinct")
+	}
+	if err := tags.Untag(ctx, "Latest"); err == nil {
+		t.Fatal("expected an error removing a tag differing only in case")
+	}
+
+	all, err := tags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"latest"}) {
+		t.Fatalf("unexpected tags: %v", all)
+	}
+}
+
+func TestTagStoreCollisionCheck(t *testing.T) {
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	for _, tc := range []struct {
+		check    TagCollisionCheck
+		err      error
+		expected []string
+	}{
+		{TagCollisionCheckError, distribution.ErrTagCollision{Tag: "Latest", ExistingTag: "latest"}, []string{"latest"}},
+		{TagCollisionCheckWarn, nil, []string{"Latest", "latest"}},
+		{TagCollisionCheckOff, nil, []string{"Latest", "latest"}},
+	} {
+		t.Run(string(tc.check), func(t *testing.T) {
+			env := testTagStore(t, TagCollisionChecking(tc.check))
+			tags := env.ts
+			ctx := env.ctx
+
+			if err := tags.Tag(ctx, "latest", desc); err != nil {
+				t.Fatal(err)
+			}
+			if err := tags.Tag(ctx, "Latest", desc); err != tc.err {
+				t.Fatalf("unexpected error tagging with a tag differing only in case: %v, expected %v", err, tc.err)
+			}
+			all, err := tags.All(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(all, tc.expected) {
+				t.Fatalf("unexpected tags: %v", all)
+			}
+		})
+	}
+
+	if _, err := NewRegistry(context.Background(), inmemory.New(), TagCollisionChecking("strict")); err == nil {
+		t.Fatal("expected an error configuring an unknown tag collision check")
+	}
+}
+
+func TestTagStoreExists(t *testing.T) {
+	ctx := context.Background()
+	d := &countingDriver{StorageDriver: inmemory.New()}
+	reg, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	if err := tags.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt64(&d.reads, 0)
+	for _, tc := range []struct {
+		tag    string
+		exists bool
+	}{
+		{tag: "latest", exists: true},
+		{tag: "missing", exists: false},
+	} {
+		exists, err := tags.Exists(ctx, tc.tag)
+		if err != nil {
+			t.Fatalf("unexpected error checking %s exists: %v", tc.tag, err)
+		}
+		if exists != tc.exists {
+			t.Errorf("expected %s to exist: %t, got %t", tc.tag, tc.exists, exists)
+		}
+	}
+	if reads := atomic.LoadInt64(&d.reads); reads != 0 {
+		t.Errorf("expected no content read checking tags exist, got %d reads", reads)
+	}
+
+	if _, err := tags.Exists(ctx, "../escape"); !errors.As(err, new(distribution.ErrTagInvalid)) {
+		t.Errorf("expected ErrTagInvalid checking an invalid tag exists, got %v", err)
+	}
+
+	if err := tags.Untag(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := tags.Exists(ctx, "latest"); err != nil || exists {
+		t.Errorf("expected untagged tag not to exist, got %t, %v", exists, err)
+	}
+}
+
+func TestTagStoreCaseInsensitive(t *testing.T) {
+	env := testTagStore(t, CaseInsensitiveTags)
+	tags := env.ts
+	ctx := env.ctx
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	if err := tags.Tag(ctx, "Latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"Latest", "latest", "LATEST"} {
+		d, err := tags.Get(ctx, tag)
+		if err != nil {
+			t.Fatalf("unexpected error getting %s: %v", tag, err)
+		}
+		if d.Digest != desc.Digest {
+			t.Fatalf("unexpected digest of %s: %s", tag, d.Digest)
+		}
+		if exists, err := tags.Exists(ctx, tag); err != nil || !exists {
+			t.Fatalf("expected %s to exist, got %t, %v", tag, exists, err)
+		}
+	}
+
+	// Tagging with another case overwrites the same tag.
+	desc.Digest = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	if err := tags.Tag(ctx, "LATEST", desc); err != nil {
+		t.Fatal(err)
+	}
+	all, err := tags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"latest"}) {
+		t.Fatalf("expected the tag stored in lowercase, got %v", all)
+	}
+	found, err := tags.Lookup(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, []string{"latest"}) {
+		t.Fatalf("unexpected tags of %s: %v", desc.Digest, found)
+	}
+
+	if err := tags.Untag(ctx, "lAtEsT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tags.Get(ctx, "latest"); err == nil {
+		t.Fatal("expected an error getting an untagged tag")
+	}
+}
+
+func TestTagStoreCaseInsensitiveExistingTags(t *testing.T) {
+	env := testTagStore(t)
+	ctx := env.ctx
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	// Tags stored in mixed case before tags were case insensitive.
+	if err := env.ts.Tag(ctx, "Stable", desc); err != nil {
+		t.Fatal(err)
+	}
+	tags := env.ts.(*tagStore)
+	tags.caseInsensitive = true
+
+	d, err := tags.Get(ctx, "stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Digest != desc.Digest {
+		t.Fatalf("unexpected digest: %s", d.Digest)
+	}
+	found, err := tags.Lookup(ctx, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, []string{"stable"}) {
+		t.Fatalf("unexpected tags of %s: %v", desc.Digest, found)
+	}
+	if err := tags.Untag(ctx, "STABLE"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tags.Get(ctx, "Stable"); err == nil {
+		t.Fatal("expected an error getting an untagged tag")
+	}
+}
+
+func TestTagStoreLock(t *testing.T) {
+	env := testTagStore(t)
+	ctx := env.ctx
+	tags := env.ts
+	d := env.ts.(*tagStore).blobStore.driver
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	other := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	if err := tags.Tag(ctx, "release", desc); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockTag(ctx, d, "a/b", "release"); err != nil {
+		t.Fatal(err)
+	}
+	locked, err := TagLocked(ctx, d, "a/b", "release")
+	if err != nil || !locked {
+		t.Fatalf("expected the tag to be locked, got %t, %v", locked, err)
+	}
+	// Tags differing only in case are distinct unless tags are case
+	// insensitive.
+	if locked, err := TagLocked(ctx, d, "a/b", "Release"); err != nil || locked {
+		t.Fatalf("expected the tag differing in case not to be locked, got %t, %v", locked, err)
+	}
+	if err := LockTag(ctx, d, "a/b", "../release"); !errors.As(err, new(distribution.ErrTagInvalid)) {
+		t.Fatalf("expected ErrTagInvalid locking an invalid tag, got %v", err)
+	}
+
+	err = tags.Tag(ctx, "release", other)
+	if _, ok := err.(distribution.ErrTagLocked); !ok {
+		t.Fatalf("expected %T overwriting a locked tag, got %v", distribution.ErrTagLocked{}, err)
+	}
+
+	err = tags.Untag(ctx, "release")
+	if _, ok := err.(distribution.ErrTagLocked); !ok {
+		t.Fatalf("expected %T removing a locked tag, got %v", distribution.ErrTagLocked{}, err)
+	}
+	n, errs := tags.(distribution.BatchTagService).UntagBatch(ctx, []string{"release"})
+	if n != 0 || len(errs) != 1 || !errors.As(errs[0], new(distribution.ErrTagLocked)) {
+		t.Fatalf("expected %T removing a locked tag in a batch, got %d, %v", distribution.ErrTagLocked{}, n, errs)
+	}
+
+	// Locked tags are still read.
+	got, err := tags.Get(ctx, "release")
+	if err != nil || got.Digest != desc.Digest {
+		t.Fatalf("unexpected locked tag %v, %v", got, err)
+	}
+	found, err := tags.Lookup(ctx, desc)
+	if err != nil || !reflect.DeepEqual(found, []string{"release"}) {
+		t.Fatalf("unexpected tags of %s: %v, %v", desc.Digest, found, err)
+	}
+
+	// Other tags of the repository and the same tag of other repositories
+	// are not locked.
+	if err := tags.Tag(ctx, "latest", other); err != nil {
+		t.Fatal(err)
+	}
+	if locked, err := TagLocked(ctx, d, "a/c", "release"); err != nil || locked {
+		t.Fatalf("expected the tag of another repository not to be locked, got %t, %v", locked, err)
+	}
+
+	// Locks are bypassed by administrators.
+	if err := tags.Tag(WithTagLockBypass(ctx), "release", other); err != nil {
+		t.Fatalf("unexpected error bypassing the lock: %v", err)
+	}
+	if got, err := tags.Get(ctx, "release"); err != nil || got.Digest != other.Digest {
+		t.Fatalf("unexpected tag overwritten bypassing the lock %v, %v", got, err)
+	}
+	if err := tags.Untag(WithTagLockBypass(ctx), "release"); err != nil {
+		t.Fatalf("unexpected error removing a tag bypassing the lock: %v", err)
+	}
+
+	if err := UnlockTag(ctx, d, "a/b", "release"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnlockTag(ctx, d, "a/b", "release"); err != nil {
+		t.Fatalf("unexpected error unlocking an unlocked tag: %v", err)
+	}
+	if err := tags.Tag(ctx, "release", desc); err != nil {
+		t.Fatalf("unexpected error tagging an unlocked tag: %v", err)
+	}
+}
+
+func TestTagStoreLockCaseInsensitive(t *testing.T) {
+	env := testTagStore(t)
+	ctx := env.ctx
+	tags := env.ts.(*tagStore)
+	tags.caseInsensitive = true
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	if err := tags.Tag(ctx, "Release", desc); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockTag(ctx, tags.blobStore.driver, "a/b", "release"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock of the lowercase tag applies to the tags differing in case.
+	err := tags.Tag(ctx, "RELEASE", desc)
+	if _, ok := err.(distribution.ErrTagLocked); !ok {
+		t.Fatalf("expected %T overwriting a locked tag, got %v", distribution.ErrTagLocked{}, err)
+	}
+	err = tags.Untag(ctx, "Release")
+	if _, ok := err.(distribution.ErrTagLocked); !ok {
+		t.Fatalf("expected %T removing a locked tag, got %v", distribution.ErrTagLocked{}, err)
+	}
+}
+
+func TestTagStoreAlias(t *testing.T) {
+	env := testTagStore(t)
+	ctx := env.ctx
+	tags := env.ts.(*tagStore)
+	first := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	second := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	if err := tags.CreateAlias(ctx, "latest", "stable"); err == nil {
+		t.Fatal("expected an error aliasing an unknown tag")
+	}
+
+	if err := tags.Tag(ctx, "latest", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.CreateAlias(ctx, "latest", "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.CreateAlias(ctx, "latest", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := tags.Get(ctx, "stable")
+	if err != nil || d.Digest != first.Digest {
+		t.Fatalf("unexpected alias %v, %v", d, err)
+	}
+	all, err := tags.All(ctx)
+	if err != nil || !reflect.DeepEqual(all, []string{"latest", "stable", "v1"}) {
+		t.Fatalf("unexpected tags %v, %v", all, err)
+	}
+	aliases, err := tags.Aliases(ctx)
+	if err != nil || !reflect.DeepEqual(aliases, map[string]string{"stable": "latest", "v1": "latest"}) {
+		t.Fatalf("unexpected aliases %v, %v", aliases, err)
+	}
+	found, err := tags.Lookup(ctx, first)
+	if err != nil || !reflect.DeepEqual(found, []string{"latest", "stable", "v1"}) {
+		t.Fatalf("unexpected tags of %s: %v, %v", first.Digest, found, err)
+	}
+
+	// The alias keeps pointing to its manifest when the source tag moves.
+	if err := tags.Tag(ctx, "latest", second); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := tags.Get(ctx, "stable"); err != nil || d.Digest != first.Digest {
+		t.Fatalf("unexpected alias after moving its source %v, %v", d, err)
+	}
+
+	// Untagging the alias leaves the source in place.
+	if err := tags.Untag(ctx, "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := tags.Get(ctx, "latest"); err != nil || d.Digest != second.Digest {
+		t.Fatalf("unexpected source after untagging its alias %v, %v", d, err)
+	}
+
+	// And untagging the source leaves the alias in place.
+	if err := tags.Untag(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := tags.Get(ctx, "v1"); err != nil || d.Digest != first.Digest {
+		t.Fatalf("unexpected alias after untagging its source %v, %v", d, err)
+	}
+	aliases, err = tags.Aliases(ctx)
+	if err != nil || !reflect.DeepEqual(aliases, map[string]string{"v1": "latest"}) {
+		t.Fatalf("unexpected aliases %v, %v", aliases, err)
+	}
+
+	// An alias tagged with another manifest is no longer an alias.
+	if err := tags.Tag(ctx, "v1", second); err != nil {
+		t.Fatal(err)
+	}
+	aliases, err = tags.Aliases(ctx)
+	if err != nil || len(aliases) != 0 {
+		t.Fatalf("unexpected aliases %v, %v", aliases, err)
+	}
+}
+
+func TestTagStoreMetadata(t *testing.T) {
+	env := testTagStore(t)
+	ts := env.ts.(*tagStore)
+	ctx := env.ctx
+	d := ts.blobStore.driver
+
+	before := time.Now().UTC()
+	desc := distribution.Descriptor{Digest: digest.FromString("manifest")}
+	if err := ts.Tag(ctx, "latest", desc, distribution.WithActor("alice")); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := ts.GetMetadata(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Actor != "alice" {
+		t.Fatalf("unexpected actor %q, expected %q", metadata.Actor, "alice")
+	}
+	if metadata.Created.Before(before.Truncate(time.Second)) || metadata.Created.After(time.Now()) {
+		t.Fatalf("unexpected creation time %s", metadata.Created)
+	}
+
+	// The actor is omitted when unknown.
+	if err := ts.Tag(ctx, "anonymous", desc); err != nil {
+		t.Fatal(err)
+	}
+	metadataPath, _ := pathFor(manifestTagIndexEntryMetadataPathSpec{
+		name:     ts.repository.Named().Name(),
+		tag:      "anonymous",
+		revision: desc.Digest,
+	})
+	p, err := d.GetContent(ctx, metadataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(p), "actor") {
+		t.Fatalf("unexpected actor in the metadata %s", p)
+	}
+
+	// Tags tagged before the metadata was recorded have none.
+	if err := d.Delete(ctx, metadataPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Get(ctx, "anonymous"); err != nil {
+		t.Fatalf("unexpected error getting tag without metadata: %v", err)
+	}
+	tags, err := ts.All(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error listing tags without metadata: %v", err)
+	}
+	if !reflect.DeepEqual(tags, []string{"anonymous", "latest"}) {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	metadata, err = ts.GetMetadata(ctx, "anonymous")
+	if err != nil {
+		t.Fatalf("unexpected error getting missing metadata: %v", err)
+	}
+	if metadata != (distribution.TagMetadata{}) {
+		t.Fatalf("unexpected metadata %+v of a tag without metadata", metadata)
+	}
+
+	if _, err := ts.GetMetadata(ctx, "unknown"); err == nil {
+		t.Fatal("expected an error getting the metadata of an unknown tag")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error getting the metadata of an unknown tag: %v", err)
+	}
+
+	if _, err := ts.GetMetadata(ctx, "../escape"); !errors.As(err, new(distribution.ErrTagInvalid)) {
+		t.Fatalf("expected ErrTagInvalid getting the metadata of an invalid tag, got %v", err)
+	}
+}
+
+func TestTagStoreHistory(t *testing.T) {
+	env := testTagStore(t)
+	tags := env.ts
+	ctx := env.ctx
+
+	d1 := digest.FromString("first")
+	d2 := digest.FromString("second")
+	d3 := digest.FromString("third")
+	expectHistory := func(expected ...digest.Digest) {
+		t.Helper()
+		history, err := tags.History(ctx, "latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var digests []digest.Digest
+		for _, desc := range history {
+			digests = append(digests, desc.Digest)
+		}
+		if !reflect.DeepEqual(digests, expected) {
+			t.Fatalf("unexpected history %v, expected %v", digests, expected)
+		}
+	}
+
+	for _, dgst := range []digest.Digest{d1, d2, d3} {
+		if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectHistory(d1, d2, d3)
+
+	// Tagging a revision again makes it the newest.
+	if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: d1}); err != nil {
+		t.Fatal(err)
+	}
+	expectHistory(d2, d3, d1)
+
+	if _, err := tags.History(ctx, "unknown"); err == nil {
+		t.Fatal("expected an error getting the history of an unknown tag")
+	} else if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("unexpected error getting the history of an unknown tag: %v", err)
+	}
+	if _, err := tags.History(ctx, "../escape"); !errors.As(err, new(distribution.ErrTagInvalid)) {
+		t.Fatalf("expected ErrTagInvalid getting the history of an invalid tag, got %v", err)
+	}
+}
+
+func TestPruneTagHistory(t *testing.T) {
+	ctx := context.Background()
+	repo := makeRepository(t, createRegistry(t, inmemory.New()), "a/b")
+	tags := repo.Tags(ctx)
+
+	var revisions []digest.Digest
+	for i := 0; i < 100; i++ {
+		dgst := digest.FromString(fmt.Sprintf("revision-%d", i))
+		if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatal(err)
+		}
+		revisions = append(revisions, dgst)
+	}
+	if err := tags.Tag(ctx, "other", distribution.Descriptor{Digest: revisions[0]}); err != nil {
+		t.Fatal(err)
+	}
+	expectHistory := func(tag string, expected []digest.Digest) {
+		t.Helper()
+		history, err := tags.History(ctx, tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var digests []digest.Digest
+		for _, desc := range history {
+			digests = append(digests, desc.Digest)
+		}
+		if !reflect.DeepEqual(digests, expected) {
+			t.Fatalf("unexpected history of %s %v, expected %v", tag, digests, expected)
+		}
+	}
+
+	pruned, err := PruneTagHistory(ctx, repo, "latest", 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pruned, map[string][]digest.Digest{"latest": revisions[:90]}) {
+		t.Fatalf("unexpected revisions pruned in a dry run: %v", pruned)
+	}
+	expectHistory("latest", revisions)
+
+	pruned, err = PruneTagHistory(ctx, repo, "latest", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pruned, map[string][]digest.Digest{"latest": revisions[:90]}) {
+		t.Fatalf("unexpected revisions pruned: %v", pruned)
+	}
+	expectHistory("latest", revisions[90:])
+	expectHistory("other", revisions[:1])
+	desc, err := tags.Get(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != revisions[99] {
+		t.Fatalf("unexpected digest %s, expected %s", desc.Digest, revisions[99])
+	}
+
+	// The revision the tag points to is kept, even when older.
+	if err := tags.Tag(ctx, "latest", distribution.Descriptor{Digest: revisions[95]}); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err = PruneTagHistory(ctx, repo, "", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pruned, map[string][]digest.Digest{"latest": append(revisions[90:95:95], revisions[96:]...)}) {
+		t.Fatalf("unexpected revisions pruned: %v", pruned)
+	}
+	expectHistory("latest", revisions[95:96])
+
+	if _, err := PruneTagHistory(ctx, repo, "latest", 0, false); err == nil {
+		t.Fatal("expected an error keeping no revision")
+	}
+	if _, err := PruneTagHistory(ctx, repo, "../escape", 1, false); !errors.As(err, new(distribution.ErrTagInvalid)) {
+		t.Fatalf("expected ErrTagInvalid pruning the history of an invalid tag, got %v", err)
+	}
+}
+
 func TestTagStoreAll(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
 	ctx := env.ctx
 
 	alpha := "abcdefghijklmnopqrstuvwxyz"
+	var expected []string
 	for i := 0; i < len(alpha); i++ {
-		tag := alpha[i]
+		expected = append(expected, string(alpha[i]), "v"+string(alpha[i]), string(alpha[i])+"-rc")
+	}
+	sort.Strings(expected)
+
+	// Tag in a random order, such that the order of the tags listed does
+	// not follow the order they were tagged in.
+	inserted := append([]string(nil), expected...)
+	rand.Shuffle(len(inserted), func(i, j int) {
+		inserted[i], inserted[j] = inserted[j], inserted[i]
+	})
+	for _, tag := range inserted {
 		desc := distribution.Descriptor{Digest: "sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"}
-		err := tagStore.Tag(ctx, string(tag), desc)
+		err := tagStore.Tag(ctx, tag, desc)
 		if err != nil {
 			t.Error(err)
 		}
@@ -138,14 +744,8 @@ func TestTagStoreAll(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if len(all) != len(alpha) {
-		t.Errorf("Unexpected count returned from enumerate")
-	}
-
-	for i, c := range all {
-		if c != string(alpha[i]) {
-			t.Errorf("unexpected tag in enumerate %s", c)
-		}
+	if !reflect.DeepEqual(all, expected) {
+		t.Errorf("unexpected tags in enumerate %v, expected %v", all, expected)
 	}
 
 	removed := "a"
@@ -165,6 +765,230 @@ func TestTagStoreAll(t *testing.T) {
 	}
 }
 
+func TestTagStoreAllPaged(t *testing.T) {
+	env := testTagStore(t)
+	tagStore := env.ts
+	ctx := env.ctx
+
+	if _, err := tagStore.AllPaged(ctx, "", 10); err == nil {
+		t.Fatal("expected an error paging the tags of an unknown repository")
+	} else if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Fatalf("unexpected error paging the tags of an unknown repository: %v", err)
+	}
+
+	desc := distribution.Descriptor{Digest: "sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"}
+	for _, tag := range []string{"v3", "v1", "latest", "v2"} {
+		if err := tagStore.Tag(ctx, tag, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		last     string
+		count    int
+		expected []string
+	}{
+		{"all", "", -1, []string{"latest", "v1", "v2", "v3"}},
+		{"first page", "", 2, []string{"latest", "v1"}},
+		{"next page", "v1", 2, []string{"v2", "v3"}},
+		{"last page", "v2", 2, []string{"v3"}},
+		{"after last", "v1", -1, []string{"v2", "v3"}},
+		{"zero count", "", 0, []string{}},
+		{"count larger than total", "", 10, []string{"latest", "v1", "v2", "v3"}},
+		{"last is the final tag", "v3", 2, []string{}},
+		{"last after the final tag", "z", 2, []string{}},
+		{"last before the first tag", "a", 1, []string{"latest"}},
+		{"last is not a tag", "v1.5", 1, []string{"v2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tags, err := tagStore.AllPaged(ctx, tc.last, tc.count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tags) != len(tc.expected) || (len(tags) > 0 && !reflect.DeepEqual(tags, tc.expected)) {
+				t.Fatalf("unexpected tags %v, expected %v", tags, tc.expected)
+			}
+		})
+	}
+}
+
+func TestTagStoreRename(t *testing.T) {
+	env := testTagStore(t)
+	tags := env.ts
+	ctx := env.ctx
+	d := env.ts.(*tagStore).blobStore.driver
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	other := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	if err := tags.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Tag(ctx, "v1", other); err != nil {
+		t.Fatal(err)
+	}
+
+	err := tags.Rename(ctx, "unknown", "stable")
+	if _, ok := err.(distribution.ErrTagUnknown); !ok {
+		t.Fatalf("expected %T renaming an unknown tag, got %v", distribution.ErrTagUnknown{}, err)
+	}
+	err = tags.Rename(ctx, "latest", "v1")
+	if expected := (distribution.ErrTagConflict{Tag: "latest", ExistingTag: "v1"}); err != expected {
+		t.Fatalf("expected %v renaming onto an existing tag, got %v", expected, err)
+	}
+
+	if err := tags.Rename(ctx, "latest", "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tags.Get(ctx, "latest"); err == nil {
+		t.Fatal("expected the renamed tag to be removed")
+	}
+	renamed, err := tags.Get(ctx, "stable")
+	if err != nil || renamed.Digest != desc.Digest {
+		t.Fatalf("unexpected renamed tag: %v, %v", renamed, err)
+	}
+	all, err := tags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"stable", "v1"}) {
+		t.Fatalf("unexpected tags after rename: %v", all)
+	}
+	indexPath, err := pathFor(manifestTagIndexEntryLinkPathSpec{name: "a/b", tag: "stable", revision: desc.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Stat(ctx, indexPath); err != nil {
+		t.Fatalf("expected the renamed tag to be indexed: %v", err)
+	}
+}
+
+// barrierDriver holds the moves until all the expected moves are started.
+type barrierDriver struct {
+	storagedriver.StorageDriver
+	started sync.WaitGroup
+	release chan struct{}
+}
+
+func (d *barrierDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	d.started.Done()
+	<-d.release
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+func TestTagStoreRenameRace(t *testing.T) {
+	ctx := context.Background()
+	d := &barrierDriver{StorageDriver: inmemory.New(), release: make(chan struct{})}
+	reg, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	if err := tags.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	// All the renames check the tags before any of them moves the tag.
+	const renames = 8
+	d.started.Add(renames)
+	errs := make([]error, renames)
+	var wg sync.WaitGroup
+	for i := 0; i < renames; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = tags.Rename(ctx, "latest", fmt.Sprintf("renamed-%d", i))
+		}(i)
+	}
+	d.started.Wait()
+	close(d.release)
+	wg.Wait()
+
+	var renamed []string
+	for i, err := range errs {
+		switch err.(type) {
+		case nil:
+			renamed = append(renamed, fmt.Sprintf("renamed-%d", i))
+		case distribution.ErrTagUnknown:
+		default:
+			t.Fatalf("unexpected error renaming tag: %v", err)
+		}
+	}
+	if len(renamed) != 1 {
+		t.Fatalf("expected a single rename to succeed, got %v", renamed)
+	}
+	all, err := tags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, renamed) {
+		t.Fatalf("unexpected tags after concurrent renames: %v", all)
+	}
+	if got, err := tags.Get(ctx, renamed[0]); err != nil || got.Digest != desc.Digest {
+		t.Fatalf("unexpected renamed tag: %v, %v", got, err)
+	}
+}
+
+func TestTagStoreTagWaitsForDriverLock(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	reg, err := NewRegistry(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+
+	// Another instance holds the lock of the tag.
+	tagPath, err := pathFor(manifestTagPathSpec{name: "a/b", tag: "latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := d.Lock(ctx, tagPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := make(chan error)
+	go func() {
+		tagged <- tags.Tag(ctx, "latest", desc)
+	}()
+	select {
+	case err := <-tagged:
+		t.Fatalf("expected tagging to wait for the lock of the tag, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Other tags are not locked.
+	if err := tags.Tag(ctx, "other", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+	select {
+	case err := <-tagged:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected tagging to complete once the lock is released")
+	}
+	if got, err := tags.Get(ctx, "latest"); err != nil || got.Digest != desc.Digest {
+		t.Fatalf("unexpected tag: %v, %v", got, err)
+	}
+}
+
 func TestTagLookup(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
@@ -220,6 +1044,127 @@ func TestTagLookup(t *testing.T) {
 	}
 }
 
+func TestTagLookupConcurrency(t *testing.T) {
+	env := testTagStore(t)
+	tagStore := env.ts
+	ctx := env.ctx
+
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	other := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+	var expected []string
+	for i := 0; i < 50; i++ {
+		tag := fmt.Sprintf("tag-%02d", i)
+		d := other
+		if i%3 == 0 {
+			d = desc
+			expected = append(expected, tag)
+		}
+		if err := tagStore.Tag(ctx, tag, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, concurrency := range []int{-1, 0, 1, 7, 100} {
+		tags, err := tagStore.Lookup(ctx, desc, distribution.WithConcurrency(concurrency))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tags, expected) {
+			t.Fatalf("unexpected tags at concurrency %d: %v", concurrency, tags)
+		}
+	}
+
+	// No tag is resolved once the context is done.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := tagStore.Lookup(canceled, desc); err != context.Canceled {
+		t.Fatalf("expected %v looking up tags with a canceled context, got %v", context.Canceled, err)
+	}
+}
+
+func TestTagLookupStream(t *testing.T) {
+	env := testTagStore(t)
+	tagStore := env.ts.(distribution.StreamingTagService)
+	ctx := env.ctx
+
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	other := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+	var expected []string
+	for i := 0; i < 50; i++ {
+		tag := fmt.Sprintf("tag-%02d", i)
+		d := other
+		if i%3 == 0 {
+			d = desc
+			expected = append(expected, tag)
+		}
+		if err := tagStore.Tag(ctx, tag, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, errs := tagStore.LookupStream(ctx, desc)
+	var tags []string
+	for tag := range found {
+		tags = append(tags, tag)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tags)
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	tags, err := distribution.LookupStreamToSlice(ctx, tagStore, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	// Canceling the context after the first tag stops the lookup.
+	canceled, cancel := context.WithCancel(ctx)
+	defer cancel()
+	found, errs = tagStore.LookupStream(canceled, desc, distribution.WithConcurrency(1))
+	if _, ok := <-found; !ok {
+		t.Fatal("expected a tag before canceling the lookup")
+	}
+	cancel()
+	for range found {
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected %v after canceling the lookup, got %v", context.Canceled, err)
+	}
+}
+
+func BenchmarkTagLookup(b *testing.B) {
+	env := testTagStore(b)
+	tagStore := env.ts
+	ctx := env.ctx
+
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	for i := 0; i < 1000; i++ {
+		if err := tagStore.Tag(ctx, fmt.Sprintf("tag-%04d", i), desc); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, concurrency := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tags, err := tagStore.Lookup(ctx, desc, distribution.WithConcurrency(concurrency))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(tags) != 1000 {
+					b.Fatalf("unexpected number of tags %d", len(tags))
+				}
+			}
+		})
+	}
+}
+
 func TestTagIndexes(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	prometheus "github.com/distribution/distribution/v3/metrics"
+	"github.com/docker/go-metrics"
+	promclient "github.com/prometheus/client_golang/prometheus"
+)
+
+// tagMetricsRepositoryDepth is the number of path components of the
+// repository names kept in the labels of the tag store metrics, such that the
+// repositories nested deeper are accounted together.
+const tagMetricsRepositoryDepth = 2
+
+// tagStoreMetrics records the latency, the errors and the misses of the tag
+// store operations, by repository and operation.
+type tagStoreMetrics struct {
+	latency metrics.LabeledTimer
+	errors  metrics.LabeledCounter
+	misses  metrics.LabeledCounter
+}
+
+var (
+	// registeredTagStoreMetrics holds the tag store metrics registered with
+	// each registerer, such that registries created with the same registerer
+	// share them.
+	registeredTagStoreMetrics   = make(map[promclient.Registerer]*tagStoreMetrics)
+	registeredTagStoreMetricsMu sync.Mutex
+)
+
+// newTagStoreMetrics registers the tag store metrics with registerer, or
+// returns the metrics already registered with it.
+func newTagStoreMetrics(registerer promclient.Registerer) (*tagStoreMetrics, error) {
+	registeredTagStoreMetricsMu.Lock()
+	defer registeredTagStoreMetricsMu.Unlock()
+	if m, ok := registeredTagStoreMetrics[registerer]; ok {
+		return m, nil
+	}
+
+	ns := metrics.NewNamespace(prometheus.NamespacePrefix, "storage", nil)
+	m := &tagStoreMetrics{
+		latency: ns.NewLabeledTimer("tag_operation_duration", "The latency of the tag store operations", "repository", "operation"),
+		errors:  ns.NewLabeledCounter("tag_operation_errors", "The number of failed tag store operations", "repository", "operation"),
+		misses:  ns.NewLabeledCounter("tag_operation_misses", "The number of tag store operations on unknown tags", "repository", "operation"),
+	}
+	if err := registerer.Register(ns); err != nil {
+		return nil, err
+	}
+	registeredTagStoreMetrics[registerer] = m
+	return m, nil
+}
+
+// observe records an operation on repository started at start, which failed
+// unless err is nil. It is a no-op on nil metrics.
+func (m *tagStoreMetrics) observe(repository, operation string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	repository = truncateRepository(repository)
+	m.latency.WithValues(repository, operation).UpdateSince(start)
+	if err != nil {
+		m.errors.WithValues(repository, operation).Inc(1)
+	}
+}
+
+// observeMiss records an operation on repository started at start, which
+// found no tag. It is a no-op on nil metrics.
+func (m *tagStoreMetrics) observeMiss(repository, operation string, start time.Time) {
+	if m == nil {
+		return
+	}
+	repository = truncateRepository(repository)
+	m.latency.WithValues(repository, operation).UpdateSince(start)
+	m.misses.WithValues(repository, operation).Inc(1)
+}
+
+// truncateRepository returns the first tagMetricsRepositoryDepth path
+// components of repository.
+func truncateRepository(repository string) string {
+	components := strings.SplitN(repository, "/", tagMetricsRepositoryDepth+1)
+	if len(components) > tagMetricsRepositoryDepth {
+		components = components[:tagMetricsRepositoryDepth]
+	}
+	return strings.Join(components, "/")
+}
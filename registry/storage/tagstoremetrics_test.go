@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTagStoreMetrics(t *testing.T) {
+	ctx := context.Background()
+	registerer := prometheus.NewPedanticRegistry()
+	reg, err := NewRegistry(ctx, inmemory.New(), TagStoreMetrics(registerer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b/c")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := repo.Tags(ctx)
+
+	desc := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	if err := ts.Tag(ctx, "latest", desc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Get(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Get(ctx, "missing"); err == nil {
+		t.Fatal("expected an error getting a missing tag")
+	}
+	if _, err := ts.All(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Lookup(ctx, desc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Exists(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.(distribution.TagMetadataProvider).GetMetadata(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.History(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	// Copying gets the missing tag from the source repository.
+	if err := ts.(distribution.AdvancedTagService).Copy(ctx, repo, "missing", "copy"); err == nil {
+		t.Fatal("expected an error copying a missing tag")
+	}
+	if err := ts.Rename(ctx, "latest", "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Rename(ctx, "stable", "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Untag(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Untag(ctx, "latest"); err == nil {
+		t.Fatal("expected an error removing a missing tag")
+	}
+
+	expected := `
+# HELP registry_storage_tag_operation_errors_total The number of failed tag store operations
+# TYPE registry_storage_tag_operation_errors_total counter
+registry_storage_tag_operation_errors_total{operation="Copy",repository="a/b"} 1
+registry_storage_tag_operation_errors_total{operation="Untag",repository="a/b"} 1
+# HELP registry_storage_tag_operation_misses_total The number of tag store operations on unknown tags
+# TYPE registry_storage_tag_operation_misses_total counter
+registry_storage_tag_operation_misses_total{operation="Get",repository="a/b"} 2
+`
+	if err := testutil.GatherAndCompare(registerer, strings.NewReader(expected), "registry_storage_tag_operation_errors_total", "registry_storage_tag_operation_misses_total"); err != nil {
+		t.Error(err)
+	}
+
+	families, err := registerer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]uint64)
+	for _, family := range families {
+		if family.GetName() != "registry_storage_tag_operation_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["repository"] != "a/b" {
+				t.Errorf("unexpected repository label %q", labels["repository"])
+			}
+			counts[labels["operation"]] = m.GetHistogram().GetSampleCount()
+		}
+	}
+	for operation, count := range map[string]uint64{"Tag": 1, "Get": 3, "All": 1, "Lookup": 1, "Exists": 1, "GetMetadata": 1, "History": 1, "Copy": 1, "Rename": 2, "Untag": 2} {
+		if counts[operation] != count {
+			t.Errorf("unexpected number of %s operations observed: %d != %d", operation, counts[operation], count)
+		}
+	}
+	if len(counts) != 10 {
+		t.Errorf("unexpected operations observed: %v", counts)
+	}
+}
+
+func TestTagStoreMetricsRegisteredTwice(t *testing.T) {
+	ctx := context.Background()
+	registerer := prometheus.NewRegistry()
+	var stores []distribution.TagService
+	for i := 0; i < 2; i++ {
+		reg, err := NewRegistry(ctx, inmemory.New(), TagStoreMetrics(registerer))
+		if err != nil {
+			t.Fatalf("unexpected error creating registry %d: %v", i, err)
+		}
+		repoRef, _ := reference.WithName("a/b")
+		repo, err := reg.Repository(ctx, repoRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, repo.Tags(ctx))
+	}
+	for _, ts := range stores {
+		if _, err := ts.Get(ctx, "missing"); err == nil {
+			t.Fatal("expected an error getting a missing tag")
+		}
+	}
+
+	expected := `
+# HELP registry_storage_tag_operation_misses_total The number of tag store operations on unknown tags
+# TYPE registry_storage_tag_operation_misses_total counter
+registry_storage_tag_operation_misses_total{operation="Get",repository="a/b"} 2
+`
+	if err := testutil.GatherAndCompare(registerer, strings.NewReader(expected), "registry_storage_tag_operation_misses_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTruncateRepository(t *testing.T) {
+	for repository, expected := range map[string]string{
+		"a":       "a",
+		"a/b":     "a/b",
+		"a/b/c/d": "a/b",
+	} {
+		if truncated := truncateRepository(repository); truncated != expected {
+			t.Errorf("unexpected truncation of %q: %q != %q", repository, truncated, expected)
+		}
+	}
+}
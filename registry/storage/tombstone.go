@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// tombstone records the deletion of a manifest revision, such that requests
+// for the revision tell it was deleted rather than unknown.
+type tombstone struct {
+	DeletedAt  time.Time     `json:"deleted_at"`
+	Reason     string        `json:"reason,omitempty"`
+	ReplacedBy digest.Digest `json:"replaced_by,omitempty"`
+}
+
+type tombstoneContextKey struct{}
+
+// WithTombstone returns a context recording reason and the manifest
+// replacing the deleted one, replacedBy, in the tombstones of the manifests
+// deleted with it. Either may be empty.
+func WithTombstone(ctx context.Context, reason string, replacedBy digest.Digest) context.Context {
+	return context.WithValue(ctx, tombstoneContextKey{}, tombstone{Reason: reason, ReplacedBy: replacedBy})
+}
+
+// EnableTombstones is a functional option for NewRegistry. It records the
+// deletion of manifest revisions in tombstones, which fetches of deleted
+// revisions return as distribution.ErrManifestDeleted.
+func EnableTombstones(registry *registry) error {
+	registry.tombstonesEnabled = true
+	return nil
+}
+
+// writeTombstone records the deletion of the manifest dgst from the
+// repository name.
+func writeTombstone(ctx context.Context, d driver.StorageDriver, name string, dgst digest.Digest) error {
+	ts, _ := ctx.Value(tombstoneContextKey{}).(tombstone)
+	ts.DeletedAt = time.Now().UTC()
+	p, err := json.Marshal(ts)
+	if err != nil {
+		return err
+	}
+
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: name, revision: dgst})
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, tombstonePath, p)
+}
+
+// readTombstone returns the tombstone of the manifest dgst of the repository
+// name, or nil if there is none.
+func readTombstone(ctx context.Context, d driver.StorageDriver, name string, dgst digest.Digest) (*tombstone, error) {
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: name, revision: dgst})
+	if err != nil {
+		return nil, err
+	}
+	p, err := d.GetContent(ctx, tombstonePath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ts tombstone
+	if err := json.Unmarshal(p, &ts); err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// removeExpiredTombstones removes the tombstones of the repository name
+// older than ttl, and returns the digests of the manifests they recorded the
+// deletion of. Nothing is removed when dryRun is set.
+func removeExpiredTombstones(ctx context.Context, d driver.StorageDriver, name string, ttl time.Duration, dryRun bool) ([]digest.Digest, error) {
+	root, err := pathFor(manifestRevisionsPathSpec{name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk first, as drivers may not support deletions while walking.
+	var revisions []digest.Digest
+	err = d.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "tombstone" {
+			return nil
+		}
+		dir := path.Dir(fileInfo.Path())
+		dgst := digest.NewDigestFromEncoded(digest.Algorithm(path.Base(path.Dir(dir))), path.Base(dir))
+		if dgst.Validate() == nil {
+			revisions = append(revisions, dgst)
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []digest.Digest
+	for _, dgst := range revisions {
+		ts, err := readTombstone(ctx, d, name, dgst)
+		if err != nil {
+			return expired, err
+		}
+		if ts == nil || time.Since(ts.DeletedAt) < ttl {
+			continue
+		}
+		expired = append(expired, dgst)
+		if dryRun {
+			continue
+		}
+
+		// Remove the whole revision directory, unless the manifest was
+		// pushed again since.
+		linkPath, err := pathFor(manifestRevisionLinkPathSpec{name: name, revision: dgst})
+		if err != nil {
+			return expired, err
+		}
+		removePath, err := pathFor(manifestRevisionPathSpec{name: name, revision: dgst})
+		if err != nil {
+			return expired, err
+		}
+		if _, err := d.Stat(ctx, linkPath); err == nil {
+			removePath = path.Join(removePath, "tombstone")
+		} else if _, ok := err.(driver.PathNotFoundError); !ok {
+			return expired, err
+		}
+		if err := d.Delete(ctx, removePath); err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
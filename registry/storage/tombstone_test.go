@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestManifestTombstone(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry := createRegistry(t, d, EnableTombstones, ManifestBloomFilter(0.001, 0))
+	repo := makeRepository(t, registry, "foo/tombstone")
+	manifests := makeManifestService(t, repo)
+
+	deleted := uploadRandomSchema2Image(t, repo).manifestDigest
+	replacement := uploadRandomSchema2Image(t, repo).manifestDigest
+	if err := manifests.Delete(WithTombstone(ctx, "vulnerable", replacement), deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := manifests.Get(ctx, deleted)
+	errDeleted, ok := err.(distribution.ErrManifestDeleted)
+	if !ok {
+		t.Fatalf("expected %T fetching deleted manifest, got %v", errDeleted, err)
+	}
+	if errDeleted.Digest != deleted || errDeleted.Reason != "vulnerable" || errDeleted.ReplacedBy != replacement || time.Since(errDeleted.DeletedAt) > time.Minute {
+		t.Fatalf("unexpected deletion record: %+v", errDeleted)
+	}
+
+	// Tombstones are seen by the manifest filters loaded from storage.
+	manifests = makeManifestService(t, makeRepository(t, createRegistry(t, d, EnableTombstones, ManifestBloomFilter(0.001, 0)), "foo/tombstone"))
+	if _, err := manifests.Get(ctx, deleted); err == nil {
+		t.Fatal("expected an error fetching deleted manifest")
+	} else if _, ok := err.(distribution.ErrManifestDeleted); !ok {
+		t.Fatalf("expected %T fetching deleted manifest from a new registry, got %v", errDeleted, err)
+	}
+
+	// Manifests deleted without tombstones are unknown.
+	manifests = makeManifestService(t, makeRepository(t, createRegistry(t, d), "foo/tombstone"))
+	if _, err := manifests.Get(ctx, deleted); err == nil {
+		t.Fatal("expected an error fetching deleted manifest")
+	} else if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("expected %T fetching deleted manifest without tombstones, got %v", distribution.ErrManifestUnknownRevision{}, err)
+	}
+	if err := manifests.Delete(ctx, replacement); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifests.Get(ctx, replacement); err == nil {
+		t.Fatal("expected an error fetching deleted manifest")
+	} else if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("expected %T fetching manifest deleted without tombstones, got %v", distribution.ErrManifestUnknownRevision{}, err)
+	}
+}
+
+func TestGCRemovesExpiredTombstones(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry := createRegistry(t, d, EnableTombstones)
+	repo := makeRepository(t, registry, "foo/tombstone")
+	manifests := makeManifestService(t, repo)
+
+	expired := uploadRandomSchema2Image(t, repo).manifestDigest
+	recent := uploadRandomSchema2Image(t, repo).manifestDigest
+	for _, dgst := range []digest.Digest{expired, recent} {
+		if err := manifests.Delete(ctx, dgst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Backdate the tombstone of the expired manifest.
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: "foo/tombstone", revision: expired})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := json.Marshal(tombstone{DeletedAt: time.Now().Add(-48 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutContent(ctx, tombstonePath, p); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		if err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: dryRun, TombstoneTTL: 24 * time.Hour}); err != nil {
+			t.Fatalf("failed mark and sweep: %v", err)
+		}
+		_, err := manifests.Get(ctx, expired)
+		if _, ok := err.(distribution.ErrManifestDeleted); ok == !dryRun {
+			t.Fatalf("unexpected error fetching manifest with expired tombstone, dry run %t: %v", dryRun, err)
+		}
+		if _, err := manifests.Get(ctx, recent); err == nil {
+			t.Fatal("expected an error fetching deleted manifest")
+		} else if _, ok := err.(distribution.ErrManifestDeleted); !ok {
+			t.Fatalf("expected the recent tombstone to be kept, got %v", err)
+		}
+	}
+
+	revisionPath, err := pathFor(manifestRevisionPathSpec{name: "foo/tombstone", revision: expired})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Stat(ctx, revisionPath); err == nil {
+		t.Fatal("expected the revision directory of the expired tombstone to be removed")
+	}
+}
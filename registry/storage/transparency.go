@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// TransparencyRecord records the entry of a manifest revision in a
+// transparency log. Manifests being addressed by their content, the record
+// is kept beside the revision rather than annotating the manifest.
+type TransparencyRecord struct {
+	// RekorURL is the URL of the Rekor instance of the log.
+	RekorURL string `json:"rekor_url"`
+
+	// LogIndex is the index of the entry in the log.
+	LogIndex int64 `json:"log_index"`
+
+	// UUID identifies the entry in the log.
+	UUID string `json:"uuid,omitempty"`
+
+	// IntegratedTime is the time the entry was added to the log, in seconds
+	// since the Unix epoch.
+	IntegratedTime int64 `json:"integrated_time,omitempty"`
+}
+
+// PutTransparencyRecord records the entry of the manifest dgst of the
+// repository name in a transparency log.
+func PutTransparencyRecord(ctx context.Context, d driver.StorageDriver, name string, dgst digest.Digest, record TransparencyRecord) error {
+	p, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	recordPath, err := pathFor(manifestTransparencyPathSpec{name: name, revision: dgst})
+	if err != nil {
+		return err
+	}
+	return d.PutContent(ctx, recordPath, p)
+}
+
+// GetTransparencyRecord returns the record of the entry of the manifest dgst
+// of the repository name in a transparency log, or nil if there is none.
+func GetTransparencyRecord(ctx context.Context, d driver.StorageDriver, name string, dgst digest.Digest) (*TransparencyRecord, error) {
+	recordPath, err := pathFor(manifestTransparencyPathSpec{name: name, revision: dgst})
+	if err != nil {
+		return nil, err
+	}
+	p, err := d.GetContent(ctx, recordPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var record TransparencyRecord
+	if err := json.Unmarshal(p, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
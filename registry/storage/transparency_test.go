@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestTransparencyRecord(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	dgst := digest.FromString("manifest")
+
+	record, err := GetTransparencyRecord(ctx, d, "foo/bar", dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting missing record: %v", err)
+	}
+	if record != nil {
+		t.Fatalf("expected no record, got %+v", record)
+	}
+
+	expected := TransparencyRecord{
+		RekorURL:       "https://rekor.example.com",
+		LogIndex:       42,
+		UUID:           "uuid",
+		IntegratedTime: 1700000000,
+	}
+	if err := PutTransparencyRecord(ctx, d, "foo/bar", dgst, expected); err != nil {
+		t.Fatalf("unexpected error putting record: %v", err)
+	}
+	record, err = GetTransparencyRecord(ctx, d, "foo/bar", dgst)
+	if err != nil {
+		t.Fatalf("unexpected error getting record: %v", err)
+	}
+	if record == nil || *record != expected {
+		t.Fatalf("unexpected record: %+v != %+v", record, expected)
+	}
+
+	if record, err := GetTransparencyRecord(ctx, d, "foo/other", dgst); err != nil || record != nil {
+		t.Fatalf("expected no record in another repository, got %+v, %v", record, err)
+	}
+}
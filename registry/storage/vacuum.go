@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"path"
+	"sort"
+	"strings"
+	"sync"
 
 	dcontext "github.com/distribution/distribution/v3/context"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
@@ -28,6 +32,25 @@ type Vacuum struct {
 	ctx    context.Context
 }
 
+// Deleter removes the content found unreachable by garbage collection.
+type Deleter interface {
+	// RemoveBlob removes a blob.
+	RemoveBlob(dgst string) error
+
+	// RemoveManifest removes a manifest revision of the repository name,
+	// and its entries in the index of the given tags.
+	RemoveManifest(name string, dgst digest.Digest, tags []string) error
+
+	// RemoveTagIndexEntry removes the entry of the revision dgst from the
+	// index of a tag of the repository name.
+	RemoveTagIndexEntry(name, tag string, dgst digest.Digest) error
+
+	// RemoveTag removes a tag of the repository name, with its index.
+	RemoveTag(name, tag string) error
+}
+
+var _ Deleter = Vacuum{}
+
 // RemoveBlob removes a blob from the filesystem
 func (v Vacuum) RemoveBlob(dgst string) error {
 	d, err := digest.Parse(dgst)
@@ -84,6 +107,26 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 	return v.driver.Delete(v.ctx, manifestPath)
 }
 
+// RemoveTagIndexEntry removes the entry of a revision from the index of a tag
+func (v Vacuum) RemoveTagIndexEntry(name, tag string, dgst digest.Digest) error {
+	entryPath, err := pathFor(manifestTagIndexEntryPathSpec{name: name, tag: tag, revision: dgst})
+	if err != nil {
+		return err
+	}
+	dcontext.GetLogger(v.ctx).Infof("deleting tag index entry: %s", entryPath)
+	return v.driver.Delete(v.ctx, entryPath)
+}
+
+// RemoveTag removes a tag from the filesystem, with its index
+func (v Vacuum) RemoveTag(name, tag string) error {
+	tagPath, err := pathFor(manifestTagPathSpec{name: name, tag: tag})
+	if err != nil {
+		return err
+	}
+	dcontext.GetLogger(v.ctx).Infof("deleting tag: %s", tagPath)
+	return v.driver.Delete(v.ctx, tagPath)
+}
+
 // RemoveRepository removes a repository directory from the
 // filesystem
 func (v Vacuum) RemoveRepository(repoName string) error {
@@ -100,3 +143,105 @@ func (v Vacuum) RemoveRepository(repoName string) error {
 
 	return nil
 }
+
+// SweepSummary reports the outcome of SweepBlobs.
+type SweepSummary struct {
+	// Eligible is the number of unreachable blobs found.
+	Eligible int
+
+	// Deleted is the number of blobs deleted.
+	Deleted int
+
+	// Failed holds the error of each blob which could not be deleted.
+	Failed map[digest.Digest]error
+}
+
+// SweepError is returned by SweepBlobs when some blobs could not be deleted.
+type SweepError struct {
+	Failed map[digest.Digest]error
+}
+
+func (err SweepError) Error() string {
+	digests := make([]string, 0, len(err.Failed))
+	for dgst := range err.Failed {
+		digests = append(digests, string(dgst))
+	}
+	sort.Strings(digests)
+
+	msgs := make([]string, 0, len(digests))
+	for _, dgst := range digests {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", dgst, err.Failed[digest.Digest(dgst)]))
+	}
+	return fmt.Sprintf("failed to delete %d blobs: %s", len(digests), strings.Join(msgs, "; "))
+}
+
+// SweepBlobs deletes every blob not in reachable. The unreachable blobs are
+// enumerated first, then deleted by workers concurrent goroutines, which
+// speeds up the sweep on storage backends with a high per request latency.
+// Failing deletions do not stop the sweep: they are reported in the
+// summary, and through a SweepError.
+func (v Vacuum) SweepBlobs(ctx context.Context, reachable map[digest.Digest]struct{}, workers int) (SweepSummary, error) {
+	return sweepBlobs(ctx, v.driver, v, func(dgst digest.Digest) bool {
+		_, ok := reachable[dgst]
+		return ok
+	}, workers)
+}
+
+// sweepBlobs removes with deleter every blob of d for which reachable
+// returns false.
+func sweepBlobs(ctx context.Context, d driver.StorageDriver, deleter Deleter, reachable func(digest.Digest) bool, workers int) (SweepSummary, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var unreachable []digest.Digest
+	blobs := &blobStore{driver: d}
+	err := blobs.Enumerate(ctx, func(dgst digest.Digest) error {
+		if !reachable(dgst) {
+			unreachable = append(unreachable, dgst)
+		}
+		return nil
+	})
+	if err != nil {
+		return SweepSummary{}, fmt.Errorf("error enumerating blobs: %v", err)
+	}
+
+	summary := SweepSummary{
+		Eligible: len(unreachable),
+		Failed:   make(map[digest.Digest]error),
+	}
+
+	queue := make(chan digest.Digest)
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dgst := range queue {
+				err := deleter.RemoveBlob(string(dgst))
+
+				mu.Lock()
+				if err != nil {
+					summary.Failed[dgst] = err
+				} else {
+					summary.Deleted++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, dgst := range unreachable {
+		queue <- dgst
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(summary.Failed) > 0 {
+		return summary, SweepError{Failed: summary.Failed}
+	}
+	return summary, nil
+}
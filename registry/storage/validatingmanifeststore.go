@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ValidatingManifestStore is a ManifestService refusing to store the
+// manifests which do not comply with the constraints of their schema,
+// checked on their payload by ValidateManifestPayload.
+type ValidatingManifestStore struct {
+	distribution.ManifestService
+}
+
+// NewValidatingManifestStore returns a ValidatingManifestStore storing the
+// valid manifests in manifests.
+func NewValidatingManifestStore(manifests distribution.ManifestService) *ValidatingManifestStore {
+	return &ValidatingManifestStore{ManifestService: manifests}
+}
+
+// Put validates the payload of manifest before storing it.
+func (ms *ValidatingManifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateManifestPayload(mediaType, payload); err != nil {
+		return "", err
+	}
+	return ms.ManifestService.Put(ctx, manifest, options...)
+}
+
+// manifestPayload holds the fields of image manifests and indexes checked
+// by ValidateManifestPayload.
+type manifestPayload struct {
+	MediaType string                    `json:"mediaType"`
+	Config    *distribution.Descriptor  `json:"config"`
+	Layers    []distribution.Descriptor `json:"layers"`
+	Manifests []distribution.Descriptor `json:"manifests"`
+	Subject   *distribution.Descriptor  `json:"subject"`
+}
+
+// ValidateManifestPayload checks that the payload of an image manifest or
+// index of the given media type complies with the constraints of the OCI
+// image specification: the subject, config, layers and manifests it
+// references have a well-formed digest, the config has the media type of the
+// kind of the manifest, and the media type of the payload matches its
+// mediaType field. The payloads of other media types are accepted. A
+// violation is returned as a distribution.ErrManifestInvalid.
+func ValidateManifestPayload(mediaType string, payload []byte) error {
+	var image bool
+	switch mediaType {
+	case v1.MediaTypeImageManifest, schema2.MediaTypeManifest:
+		image = true
+	case v1.MediaTypeImageIndex, manifestlist.MediaTypeManifestList:
+	default:
+		return nil
+	}
+
+	var m manifestPayload
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return distribution.ErrManifestInvalid{Reason: err.Error()}
+	}
+
+	if m.MediaType != "" && m.MediaType != mediaType {
+		return invalidManifest("media type %q does not match the media type %q of the payload", m.MediaType, mediaType)
+	}
+	if m.Subject != nil {
+		if err := validateDescriptor("subject", *m.Subject); err != nil {
+			return err
+		}
+	}
+
+	if !image {
+		if m.Config != nil || m.Layers != nil {
+			return invalidManifest("an index has no config nor layers")
+		}
+		for i, desc := range m.Manifests {
+			if err := validateDescriptor(fmt.Sprintf("manifest %d", i), desc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if m.Manifests != nil {
+		return invalidManifest("an image manifest has no manifests")
+	}
+	if m.Config == nil {
+		return invalidManifest("missing config")
+	}
+	if err := validateDescriptor("config", *m.Config); err != nil {
+		return err
+	}
+	switch {
+	case mediaType == schema2.MediaTypeManifest && m.Config.MediaType != schema2.MediaTypeImageConfig:
+		return invalidManifest("config media type %q of a %s manifest is not %s", m.Config.MediaType, mediaType, schema2.MediaTypeImageConfig)
+	case mediaType == v1.MediaTypeImageManifest && m.Config.MediaType == schema2.MediaTypeImageConfig:
+		return invalidManifest("config media type %q of a %s manifest is a Docker media type", m.Config.MediaType, mediaType)
+	}
+	for i, desc := range m.Layers {
+		if err := validateDescriptor(fmt.Sprintf("layer %d", i), desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDescriptor checks that the descriptor of what has a media type, a
+// well-formed digest, and a size.
+func validateDescriptor(what string, desc distribution.Descriptor) error {
+	if desc.MediaType == "" {
+		return invalidManifest("%s has no media type", what)
+	}
+	if desc.Digest == "" {
+		return invalidManifest("%s has no digest", what)
+	}
+	if err := desc.Digest.Validate(); err != nil {
+		return invalidManifest("%s digest %q is invalid: %v", what, desc.Digest, err)
+	}
+	if desc.Size < 0 {
+		return invalidManifest("%s has a negative size %d", what, desc.Size)
+	}
+	return nil
+}
+
+func invalidManifest(format string, args ...interface{}) error {
+	return distribution.ErrManifestInvalid{Reason: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	validDigest   = "sha256:3d0bfb49ae32b1b408994517e0075fcce9fb2d4d6f8bffd133cbc2e08f9efc7c"
+	validConfig   = `{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + validDigest + `","size":2}`
+	validLayer    = `{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"` + validDigest + `","size":10}`
+	validManifest = `{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + validDigest + `","size":100}`
+)
+
+func TestValidateManifestPayload(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		mediaType string
+		payload   string
+		reason    string // empty if valid
+	}{
+		{
+			name:      "valid OCI manifest",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":` + validConfig + `,"layers":[` + validLayer + `],"subject":` + validManifest + `}`,
+		},
+		{
+			name:      "valid Docker manifest",
+			mediaType: schema2.MediaTypeManifest,
+			payload:   `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"mediaType":"application/vnd.docker.container.image.v1+json","digest":"` + validDigest + `","size":2},"layers":[]}`,
+		},
+		{
+			name:      "valid OCI index",
+			mediaType: v1.MediaTypeImageIndex,
+			payload:   `{"schemaVersion":2,"manifests":[` + validManifest + `]}`,
+		},
+		{
+			name:      "other media type",
+			mediaType: "application/vnd.example+json",
+			payload:   `not json`,
+		},
+		{
+			name:      "malformed JSON",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":`,
+			reason:    "unexpected end of JSON input",
+		},
+		{
+			name:      "mismatched media type",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":` + validConfig + `}`,
+			reason:    "does not match the media type",
+		},
+		{
+			name:      "subject digest format",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":` + validConfig + `,"subject":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:abc","size":1}}`,
+			reason:    "subject digest",
+		},
+		{
+			name:      "subject of an index",
+			mediaType: v1.MediaTypeImageIndex,
+			payload:   `{"manifests":[],"subject":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"nodigest","size":1}}`,
+			reason:    "subject digest",
+		},
+		{
+			name:      "missing config",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"layers":[` + validLayer + `]}`,
+			reason:    "missing config",
+		},
+		{
+			name:      "config without media type",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":{"digest":"` + validDigest + `","size":2}}`,
+			reason:    "config has no media type",
+		},
+		{
+			name:      "Docker config in OCI manifest",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":{"mediaType":"application/vnd.docker.container.image.v1+json","digest":"` + validDigest + `","size":2}}`,
+			reason:    "is a Docker media type",
+		},
+		{
+			name:      "OCI config in Docker manifest",
+			mediaType: schema2.MediaTypeManifest,
+			payload:   `{"config":` + validConfig + `}`,
+			reason:    "is not application/vnd.docker.container.image.v1+json",
+		},
+		{
+			name:      "layer without digest",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":` + validConfig + `,"layers":[` + validLayer + `,{"mediaType":"application/vnd.oci.image.layer.v1.tar","size":10}]}`,
+			reason:    "layer 1 has no digest",
+		},
+		{
+			name:      "layer with invalid digest",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":` + validConfig + `,"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"sha256:zz","size":10}]}`,
+			reason:    "layer 0 digest",
+		},
+		{
+			name:      "layer with negative size",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":` + validConfig + `,"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"` + validDigest + `","size":-1}]}`,
+			reason:    "negative size",
+		},
+		{
+			name:      "index manifest without digest",
+			mediaType: manifestlist.MediaTypeManifestList,
+			payload:   `{"manifests":[{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","size":10}]}`,
+			reason:    "manifest 0 has no digest",
+		},
+		{
+			name:      "index with layers",
+			mediaType: v1.MediaTypeImageIndex,
+			payload:   `{"manifests":[],"layers":[` + validLayer + `]}`,
+			reason:    "no config nor layers",
+		},
+		{
+			name:      "image manifest with manifests",
+			mediaType: v1.MediaTypeImageManifest,
+			payload:   `{"config":` + validConfig + `,"manifests":[` + validManifest + `]}`,
+			reason:    "has no manifests",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateManifestPayload(tc.mediaType, []byte(tc.payload))
+			if tc.reason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			invalid, ok := err.(distribution.ErrManifestInvalid)
+			if !ok {
+				t.Fatalf("expected an ErrManifestInvalid, got %v", err)
+			}
+			if !strings.Contains(invalid.Reason, tc.reason) {
+				t.Fatalf("expected the reason to contain %q, got %q", tc.reason, invalid.Reason)
+			}
+		})
+	}
+}
+
+func TestValidatingManifestStore(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "validating")
+	manifests, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := NewValidatingManifestStore(manifests)
+
+	blobs := repo.Blobs(ctx)
+	config, err := blobs.Put(ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The blob store describes blobs as application/octet-stream.
+	config.MediaType = schema2.MediaTypeImageConfig
+	layer.MediaType = schema2.MediaTypeLayer
+	valid, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Put(ctx, valid); err != nil {
+		t.Fatalf("unexpected error putting a valid manifest: %v", err)
+	}
+
+	// The layer has no media type.
+	invalid, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{{Digest: layer.Digest, Size: layer.Size}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.Put(ctx, invalid); err == nil {
+		t.Fatal("expected an error putting an invalid manifest")
+	} else if _, ok := err.(distribution.ErrManifestInvalid); !ok {
+		t.Fatalf("expected an ErrManifestInvalid, got %v", err)
+	}
+	_, payload, _ := invalid.Payload()
+	if exists, err := manifests.Exists(ctx, digest.FromBytes(payload)); err != nil || exists {
+		t.Fatalf("expected the invalid manifest not to be stored: %v, %v", exists, err)
+	}
+}
@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/distribution/v3/registry/tagcopy"
+	"github.com/spf13/cobra"
+)
+
+var (
+	copyWorkers   int
+	copyUsername  string
+	copyPassword  string
+	copyPlainHTTP bool
+
+	pruneKeep       int
+	pruneRepository string
+	pruneTag        string
+	pruneDryRun     bool
+)
+
+func init() {
+	TagCmd.AddCommand(TagCopyCmd)
+	TagCopyCmd.Flags().IntVar(&copyWorkers, "workers", 4, "number of blobs copied concurrently")
+	TagCopyCmd.Flags().StringVarP(&copyUsername, "username", "u", "", "username for the registries")
+	TagCopyCmd.Flags().StringVarP(&copyPassword, "password", "p", "", "password for the registries")
+	TagCopyCmd.Flags().BoolVar(&copyPlainHTTP, "plain-http", false, "connect to the registries over plain HTTP")
+
+	TagCmd.AddCommand(TagHistoryCmd)
+	TagHistoryCmd.AddCommand(TagHistoryPruneCmd)
+	TagHistoryPruneCmd.Flags().IntVar(&pruneKeep, "keep", 10, "number of most recent revisions kept in the history of each tag")
+	TagHistoryPruneCmd.Flags().StringVar(&pruneRepository, "repository", "", "repository whose tags are pruned")
+	TagHistoryPruneCmd.Flags().StringVar(&pruneTag, "tag", "", "tag pruned, instead of all the tags of the repository")
+	TagHistoryPruneCmd.Flags().BoolVarP(&pruneDryRun, "dry-run", "d", false, "print the revisions which would be pruned, without pruning them")
+	TagHistoryPruneCmd.MarkFlagRequired("repository")
+}
+
+// TagCmd is the cobra command that corresponds to the tag subcommand
+var TagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "`tag` manages tagged images",
+	Long:  "`tag` manages tagged images",
+}
+
+// TagCopyCmd is the cobra command that corresponds to the tag copy subcommand
+var TagCopyCmd = &cobra.Command{
+	Use:   "copy <src-ref> <dst-ref>",
+	Short: "`copy` copies an image to another repository or registry",
+	Long: "`copy` copies the image referenced by <src-ref> to the tagged reference <dst-ref>.\n" +
+		"Blobs are mounted from the source repository on the same registry, and streamed across registries.",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		auth := remote.AuthConfig{
+			Username: copyUsername,
+			Password: copyPassword,
+		}
+
+		desc, err := tagcopy.Copy(dcontext.Background(), args[0], args[1], tagcopy.Options{
+			Workers:         copyWorkers,
+			SourceAuth:      auth,
+			DestinationAuth: auth,
+			PlainHTTP:       copyPlainHTTP,
+			Progress:        os.Stderr,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to copy image: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(desc.Digest)
+	},
+}
+
+// TagHistoryCmd is the cobra command that corresponds to the tag history subcommand
+var TagHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "`history` manages the history of tags",
+	Long:  "`history` manages the history of tags, the revisions they pointed to",
+}
+
+// TagHistoryPruneCmd is the cobra command that corresponds to the tag history prune subcommand
+var TagHistoryPruneCmd = &cobra.Command{
+	Use:   "prune <config>",
+	Short: "`prune` removes the oldest revisions from the history of tags",
+	Long: "`prune` removes from the index of the tags of a repository all but their most recent revisions.\n" +
+		"The revision a tag points to is always kept. Manifests no longer in the index of any tag\n" +
+		"are left to the garbage collector.",
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v\n", err)
+			os.Exit(1)
+		}
+		named, err := reference.WithName(pruneRepository)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid repository name %s: %v\n", pruneRepository, err)
+			os.Exit(1)
+		}
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct repository: %v\n", err)
+			os.Exit(1)
+		}
+
+		pruned, err := storage.PruneTagHistory(ctx, repo, pruneTag, pruneKeep, pruneDryRun)
+		tags := make([]string, 0, len(pruned))
+		for tag := range pruned {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			for _, dgst := range pruned[tag] {
+				if pruneDryRun {
+					fmt.Printf("%s:%s: revision %s eligible for pruning\n", pruneRepository, tag, dgst)
+				} else {
+					fmt.Printf("%s:%s: pruned revision %s\n", pruneRepository, tag, dgst)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to prune tag history: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
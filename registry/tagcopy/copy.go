@@ -0,0 +1,268 @@
+// Package tagcopy copies tagged images between repositories, on the same
+// registry or across registries.
+package tagcopy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/client"
+	"github.com/distribution/distribution/v3/registry/client/remote"
+	"github.com/opencontainers/go-digest"
+)
+
+// Options configures Copy.
+type Options struct {
+	// Workers is the number of blobs copied concurrently. Defaults to 4.
+	Workers int
+
+	// SourceAuth and DestinationAuth hold the credentials for the source
+	// and destination registries.
+	SourceAuth      remote.AuthConfig
+	DestinationAuth remote.AuthConfig
+
+	// PlainHTTP connects to the registries over HTTP rather than HTTPS.
+	PlainHTTP bool
+
+	// Progress receives a progress bar of the blob copies, if not nil.
+	Progress io.Writer
+}
+
+// Copy copies the image referenced by src, by tag or digest, to the tagged
+// reference dst. Manifest lists are copied along with all of their
+// manifests.
+//
+// Blobs are mounted from the source repository when both references are on
+// the same registry, and streamed from one registry to the other otherwise.
+// Blobs already present in the destination are skipped.
+func Copy(ctx context.Context, src, dst string, opts Options) (distribution.Descriptor, error) {
+	srcRef, err := reference.ParseNormalizedNamed(src)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	dstRef, err := reference.ParseNormalizedNamed(dst)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	dstTagged, ok := dstRef.(reference.NamedTagged)
+	if !ok {
+		return distribution.Descriptor{}, fmt.Errorf("%s: destination reference must be tagged", dst)
+	}
+
+	c := &copier{
+		sameRegistry: reference.Domain(srcRef) == reference.Domain(dstRef),
+		workers:      opts.Workers,
+	}
+	if c.workers < 1 {
+		c.workers = 4
+	}
+	if c.src, err = newRepository(srcRef, opts.SourceAuth, opts.PlainHTTP); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if c.dst, err = newRepository(dstRef, opts.DestinationAuth, opts.PlainHTTP); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	srcManifests, err := c.src.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	var m distribution.Manifest
+	switch ref := srcRef.(type) {
+	case reference.Canonical:
+		m, err = srcManifests.Get(ctx, ref.Digest())
+	case reference.Tagged:
+		m, err = srcManifests.Get(ctx, "", distribution.WithTag(ref.Tag()))
+	default:
+		return distribution.Descriptor{}, fmt.Errorf("%s: source reference must be tagged or referenced by digest", src)
+	}
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("fetching %s: %v", src, err)
+	}
+
+	// The manifests of a list must be pushed before the list itself.
+	children, err := c.children(ctx, srcManifests, m)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	var blobs []distribution.Descriptor
+	seen := make(map[digest.Digest]struct{})
+	for _, image := range append(children, m) {
+		if _, isList := image.(*manifestlist.DeserializedManifestList); isList {
+			continue
+		}
+		for _, desc := range image.References() {
+			if _, ok := seen[desc.Digest]; ok || desc.MediaType == schema2.MediaTypeForeignLayer {
+				continue
+			}
+			seen[desc.Digest] = struct{}{}
+			blobs = append(blobs, desc)
+		}
+	}
+
+	if err := c.copyBlobs(ctx, blobs, opts.Progress); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	dstManifests, err := c.dst.Manifests(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	for _, child := range children {
+		if _, err := dstManifests.Put(ctx, child); err != nil {
+			return distribution.Descriptor{}, fmt.Errorf("pushing manifest: %v", err)
+		}
+	}
+	dgst, err := dstManifests.Put(ctx, m, distribution.WithTag(dstTagged.Tag()))
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("pushing manifest: %v", err)
+	}
+
+	mediaType, payload, err := m.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(payload)),
+	}, nil
+}
+
+// newRepository returns the repository of ref, on its registry.
+func newRepository(ref reference.Named, auth remote.AuthConfig, plainHTTP bool) (distribution.Repository, error) {
+	scheme := "https"
+	if plainHTTP {
+		scheme = "http"
+	}
+
+	name, err := reference.WithName(reference.Path(ref))
+	if err != nil {
+		return nil, err
+	}
+	return remote.NewRepository(name, &url.URL{Scheme: scheme, Host: reference.Domain(ref)}, auth)
+}
+
+type copier struct {
+	src, dst     distribution.Repository
+	sameRegistry bool
+	workers      int
+}
+
+// children fetches the manifests referenced by m, if it is a manifest list.
+func (c *copier) children(ctx context.Context, manifests distribution.ManifestService, m distribution.Manifest) ([]distribution.Manifest, error) {
+	if _, isList := m.(*manifestlist.DeserializedManifestList); !isList {
+		return nil, nil
+	}
+
+	var children []distribution.Manifest
+	for _, desc := range m.References() {
+		child, err := manifests.Get(ctx, desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("fetching manifest %s: %v", desc.Digest, err)
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// copyBlobs copies blobs to the destination from c.workers goroutines, and
+// returns the first error encountered.
+func (c *copier) copyBlobs(ctx context.Context, blobs []distribution.Descriptor, progress io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bar := newProgressBar(progress, len(blobs))
+
+	queue := make(chan distribution.Descriptor)
+	errs := make(chan error, len(blobs))
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for desc := range queue {
+				if err := c.copyBlob(ctx, desc); err != nil {
+					errs <- fmt.Errorf("copying blob %s: %v", desc.Digest, err)
+					cancel()
+					continue
+				}
+				bar.Add(1)
+			}
+		}()
+	}
+
+	for _, desc := range blobs {
+		queue <- desc
+	}
+	close(queue)
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// copyBlob makes the blob described by desc available in the destination.
+func (c *copier) copyBlob(ctx context.Context, desc distribution.Descriptor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dstBlobs := c.dst.Blobs(ctx)
+	if _, err := dstBlobs.Stat(ctx, desc.Digest); err == nil {
+		return nil
+	} else if err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	var options []distribution.BlobCreateOption
+	if c.sameRegistry {
+		from, err := reference.WithDigest(c.src.Named(), desc.Digest)
+		if err != nil {
+			return err
+		}
+		options = append(options, client.WithMountFrom(from))
+	}
+
+	bw, err := dstBlobs.Create(ctx, options...)
+	if _, mounted := err.(distribution.ErrBlobMounted); mounted {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// The blob was not mounted: stream it from the source, without
+	// buffering it.
+	if err := c.streamBlob(ctx, desc, bw); err != nil {
+		bw.Cancel(ctx)
+		return err
+	}
+	return nil
+}
+
+func (c *copier) streamBlob(ctx context.Context, desc distribution.Descriptor, bw distribution.BlobWriter) error {
+	rc, err := c.src.Blobs(ctx).Open(ctx, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if _, err := io.Copy(bw, rc); err != nil {
+		return err
+	}
+	_, err = bw.Commit(ctx, distribution.Descriptor{
+		MediaType: desc.MediaType,
+		Digest:    desc.Digest,
+		Size:      desc.Size,
+	})
+	return err
+}
@@ -0,0 +1,199 @@
+package tagcopy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/handlers"
+	"github.com/distribution/distribution/v3/registry/registrytest"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testRegistry is an in-process registry recording the blob upload requests
+// it receives.
+type testRegistry struct {
+	url *url.URL
+
+	mu      sync.Mutex
+	mounts  int
+	patches int
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+
+	app := handlers.NewApp(context.Background(), registrytest.Config())
+
+	reg := &testRegistry{}
+	reg.url = registrytest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/uploads/") {
+			reg.mu.Lock()
+			switch {
+			case r.Method == http.MethodPost && r.URL.Query().Get("mount") != "":
+				reg.mounts++
+			case r.Method == http.MethodPatch:
+				reg.patches++
+			}
+			reg.mu.Unlock()
+		}
+		app.ServeHTTP(w, r)
+	}))
+	return reg
+}
+
+func (reg *testRegistry) counts() (mounts, patches int) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.mounts, reg.patches
+}
+
+func (reg *testRegistry) repository(t *testing.T, name string) distribution.Repository {
+	t.Helper()
+	return registrytest.Repository(t, reg.url, name, nil)
+}
+
+// pushIndex pushes an image index of two single layer images to repo, and
+// returns the digests of all of its content.
+func pushIndex(t *testing.T, repo distribution.Repository, tag string) (digest.Digest, map[digest.Digest][]byte) {
+	t.Helper()
+
+	content := make(map[digest.Digest][]byte)
+	put := func(mediaType string, p []byte) distribution.Descriptor {
+		desc := registrytest.PutBlob(t, repo, mediaType, p)
+		content[desc.Digest] = p
+		return desc
+	}
+
+	var descriptors []manifestlist.ManifestDescriptor
+	for _, arch := range []string{"amd64", "arm64"} {
+		m, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    put(v1.MediaTypeImageConfig, []byte(`{"architecture":"`+arch+`","os":"linux"}`)),
+			Layers: []distribution.Descriptor{
+				put(v1.MediaTypeImageLayer, bytes.Repeat([]byte(arch), 64<<10)),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc := registrytest.PutManifest(t, repo, "", m)
+		_, payload, _ := m.Payload()
+		content[desc.Digest] = payload
+
+		descriptors = append(descriptors, manifestlist.ManifestDescriptor{
+			Descriptor: desc,
+			Platform:   manifestlist.PlatformSpec{Architecture: arch, OS: "linux"},
+		})
+	}
+
+	index, err := manifestlist.FromDescriptorsWithMediaType(descriptors, v1.MediaTypeImageIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registrytest.PutManifest(t, repo, tag, index).Digest, content
+}
+
+// checkCopied checks that repo holds all of content, and that tag
+// references the index dgst.
+func checkCopied(t *testing.T, repo distribution.Repository, tag string, dgst digest.Digest, content map[digest.Digest][]byte) {
+	t.Helper()
+	ctx := context.Background()
+
+	desc, err := repo.Tags(ctx).Get(ctx, tag)
+	if err != nil {
+		t.Fatalf("error getting tag %s: %v", tag, err)
+	}
+	if desc.Digest != dgst {
+		t.Fatalf("expected tag %s to reference %s, got %s", tag, dgst, desc.Digest)
+	}
+
+	ms, err := repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dgst, expected := range content {
+		var p []byte
+		if m, err := ms.Get(ctx, dgst); err == nil {
+			_, p, _ = m.Payload()
+		} else if p, err = repo.Blobs(ctx).Get(ctx, dgst); err != nil {
+			t.Fatalf("%s missing from destination: %v", dgst, err)
+		}
+		if !bytes.Equal(p, expected) {
+			t.Fatalf("content of %s does not match", dgst)
+		}
+	}
+}
+
+func TestCopyAcrossRegistries(t *testing.T) {
+	src := newTestRegistry(t)
+	dst := newTestRegistry(t)
+	dgst, content := pushIndex(t, src.repository(t, "foo/app"), "1.0")
+
+	var progress bytes.Buffer
+	desc, err := Copy(context.Background(), src.url.Host+"/foo/app:1.0", dst.url.Host+"/bar/app:copy", Options{
+		Workers:   2,
+		PlainHTTP: true,
+		Progress:  &progress,
+	})
+	if err != nil {
+		t.Fatalf("error copying image: %v", err)
+	}
+	if desc.Digest != dgst || desc.MediaType != v1.MediaTypeImageIndex {
+		t.Fatalf("unexpected descriptor: %v", desc)
+	}
+
+	checkCopied(t, dst.repository(t, "bar/app"), "copy", dgst, content)
+
+	if mounts, patches := dst.counts(); mounts != 0 || patches != 4 {
+		t.Errorf("expected the 4 blobs to be streamed, got %d mounts and %d uploads", mounts, patches)
+	}
+	if !strings.Contains(progress.String(), "4/4") {
+		t.Errorf("expected progress to report 4 copied blobs, got %q", progress.String())
+	}
+
+	// Copying again skips the blobs already present.
+	if _, err := Copy(context.Background(), src.url.Host+"/foo/app@"+dgst.String(), dst.url.Host+"/bar/app:again", Options{
+		PlainHTTP: true,
+	}); err != nil {
+		t.Fatalf("error copying image: %v", err)
+	}
+	if mounts, patches := dst.counts(); mounts != 0 || patches != 4 {
+		t.Errorf("expected no new blob uploads, got %d mounts and %d uploads", mounts, patches)
+	}
+}
+
+func TestCopySameRegistry(t *testing.T) {
+	reg := newTestRegistry(t)
+	dgst, content := pushIndex(t, reg.repository(t, "foo/app"), "1.0")
+	_, patches := reg.counts()
+
+	_, err := Copy(context.Background(), reg.url.Host+"/foo/app:1.0", reg.url.Host+"/bar/app:copy", Options{
+		PlainHTTP: true,
+	})
+	if err != nil {
+		t.Fatalf("error copying image: %v", err)
+	}
+
+	checkCopied(t, reg.repository(t, "bar/app"), "copy", dgst, content)
+
+	mounts, newPatches := reg.counts()
+	if mounts != 4 || newPatches != patches {
+		t.Errorf("expected the 4 blobs to be mounted, got %d mounts and %d uploads", mounts, newPatches-patches)
+	}
+}
+
+func TestCopyRequiresTaggedDestination(t *testing.T) {
+	_, err := Copy(context.Background(), "localhost:5000/foo/app:1.0", "localhost:5000/bar/app", Options{})
+	if err == nil || !strings.Contains(err.Error(), "must be tagged") {
+		t.Fatalf("expected an error for an untagged destination, got %v", err)
+	}
+}
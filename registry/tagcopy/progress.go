@@ -0,0 +1,30 @@
+package tagcopy
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// progressBarWidth is the number of characters of the bar itself.
+const progressBarWidth = 30
+
+// newProgressBar returns a bar rendering to w the number of blobs copied out
+// of blobs, on a single terminal line. A nil writer disables rendering.
+func newProgressBar(w io.Writer, blobs int) *progressbar.ProgressBar {
+	options := []progressbar.Option{
+		progressbar.OptionSetDescription("copying blobs"),
+		progressbar.OptionSetWidth(progressBarWidth),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetRenderBlankState(true),
+	}
+	if w == nil {
+		options = append(options, progressbar.OptionSetWriter(io.Discard), progressbar.OptionSetVisibility(false))
+	} else {
+		options = append(options, progressbar.OptionSetWriter(w), progressbar.OptionOnCompletion(func() {
+			fmt.Fprintln(w)
+		}))
+	}
+	return progressbar.NewOptions(blobs, options...)
+}
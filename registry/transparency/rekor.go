@@ -0,0 +1,200 @@
+// Package transparency records the manifests pushed to the registry in a
+// Rekor transparency log, and verifies their inclusion in the log.
+//
+// The registry signs the digest of each pushed manifest, and submits the
+// signature with its certificate as a hashedrekord entry. The index of the
+// entry in the log is recorded beside the manifest, such that the entry can
+// be fetched and its inclusion proof verified later.
+package transparency
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// DefaultRekorURL is the URL of the public Rekor instance of Sigstore.
+const DefaultRekorURL = "https://rekor.sigstore.dev"
+
+const (
+	hashedRekordKind       = "hashedrekord"
+	hashedRekordAPIVersion = "0.0.1"
+)
+
+// HashedRekord is the body of a hashedrekord entry, recording the signature
+// of an artifact by its hash.
+type HashedRekord struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Spec       HashedRekordSpec `json:"spec"`
+}
+
+// HashedRekordSpec is the specification of a hashedrekord entry.
+type HashedRekordSpec struct {
+	Data struct {
+		Hash struct {
+			Algorithm string `json:"algorithm"`
+			Value     string `json:"value"`
+		} `json:"hash"`
+	} `json:"data"`
+	Signature struct {
+		// Content is the signature of the hash.
+		Content   []byte `json:"content"`
+		PublicKey struct {
+			// Content is the PEM encoded certificate or public key
+			// verifying the signature.
+			Content []byte `json:"content"`
+		} `json:"publicKey"`
+	} `json:"signature"`
+}
+
+// NewHashedRekord returns the hashedrekord entry of the artifact dgst, signed
+// by signature, which certificate verifies.
+func NewHashedRekord(dgst digest.Digest, signature, certificate []byte) (*HashedRekord, error) {
+	if dgst.Algorithm() != digest.SHA256 {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", dgst.Algorithm())
+	}
+	rekord := &HashedRekord{
+		APIVersion: hashedRekordAPIVersion,
+		Kind:       hashedRekordKind,
+	}
+	rekord.Spec.Data.Hash.Algorithm = string(dgst.Algorithm())
+	rekord.Spec.Data.Hash.Value = dgst.Encoded()
+	rekord.Spec.Signature.Content = signature
+	rekord.Spec.Signature.PublicKey.Content = certificate
+	return rekord, nil
+}
+
+// LogEntry is an entry of the transparency log.
+type LogEntry struct {
+	// UUID identifies the entry in the log.
+	UUID string `json:"-"`
+
+	// Body is the canonical JSON encoding of the entry.
+	Body           []byte `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// Verification holds the proofs of the inclusion of an entry in the log.
+type Verification struct {
+	InclusionProof       *InclusionProof `json:"inclusionProof,omitempty"`
+	SignedEntryTimestamp []byte          `json:"signedEntryTimestamp,omitempty"`
+}
+
+// InclusionProof proves the inclusion of an entry in the Merkle tree of the
+// log, as described by RFC 6962.
+type InclusionProof struct {
+	// LogIndex is the index of the entry in the tree, which may differ from
+	// the index of the entry in the log when the log is sharded.
+	LogIndex int64 `json:"logIndex"`
+
+	// RootHash is the hex encoded root hash of the tree.
+	RootHash string `json:"rootHash"`
+
+	TreeSize int64 `json:"treeSize"`
+
+	// Hashes are the hex encoded hashes of the audit path, from the leaf.
+	Hashes []string `json:"hashes"`
+
+	Checkpoint string `json:"checkpoint,omitempty"`
+}
+
+// Client submits entries to a Rekor transparency log, and fetches them.
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient returns a Client for the Rekor instance at rekorURL. A nil
+// client uses http.DefaultClient.
+func NewClient(rekorURL string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		url:    strings.TrimSuffix(rekorURL, "/"),
+		client: client,
+	}
+}
+
+// URL returns the URL of the Rekor instance.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Upload submits rekord to the log, and returns its entry.
+func (c *Client) Upload(ctx context.Context, rekord *HashedRekord) (*LogEntry, error) {
+	p, err := json.Marshal(rekord)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/api/v1/log/entries", bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, http.StatusCreated)
+}
+
+// GetByIndex returns the entry of the log at index.
+func (c *Client) GetByIndex(ctx context.Context, index int64) (*LogEntry, error) {
+	u := c.url + "/api/v1/log/entries?" + url.Values{"logIndex": {strconv.FormatInt(index, 10)}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req, http.StatusOK)
+}
+
+// do sends req, and returns the single entry of the response, keyed by its
+// UUID.
+func (c *Client) do(req *http.Request, status int) (*LogEntry, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		p, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: unexpected status %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(p))
+	}
+
+	var entries map[string]LogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%s %s: invalid response: %v", req.Method, req.URL.Path, err)
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("%s %s: expected a single entry, got %d", req.Method, req.URL.Path, len(entries))
+	}
+	for uuid, entry := range entries {
+		entry.UUID = uuid
+		return &entry, nil
+	}
+	panic("unreachable")
+}
+
+// decodeBody returns the hashedrekord of entry.
+func decodeBody(entry *LogEntry) (*HashedRekord, error) {
+	var rekord HashedRekord
+	if err := json.Unmarshal(entry.Body, &rekord); err != nil {
+		return nil, fmt.Errorf("invalid entry body: %v", err)
+	}
+	if rekord.Kind != hashedRekordKind {
+		return nil, fmt.Errorf("unexpected entry kind %q", rekord.Kind)
+	}
+	return &rekord, nil
+}
@@ -0,0 +1,139 @@
+package transparency
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Signer signs the digests of manifests for the transparency log.
+type Signer struct {
+	key crypto.Signer
+
+	// certificate is the PEM encoded certificate or public key of key.
+	certificate []byte
+}
+
+// NewSigner returns a Signer signing with key, an ECDSA or RSA key, which
+// the PEM encoded certificate verifies. Without certificate, the PEM encoded
+// public key of key is submitted along with the signatures instead.
+func NewSigner(key crypto.Signer, certificate []byte) (*Signer, error) {
+	switch key.(type) {
+	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	if len(certificate) == 0 {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		certificate = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	} else {
+		public, err := parseVerifier(certificate)
+		if err != nil {
+			return nil, err
+		}
+		if k, ok := public.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(key.Public()) {
+			return nil, fmt.Errorf("the certificate does not match the key")
+		}
+	}
+
+	return &Signer{
+		key:         key,
+		certificate: certificate,
+	}, nil
+}
+
+// LoadSigner returns a Signer with the PEM encoded private key at keyPath
+// and, if certificatePath is set, the PEM encoded certificate at
+// certificatePath.
+func LoadSigner(keyPath, certificatePath string) (*Signer, error) {
+	key, err := loadPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	var certificate []byte
+	if certificatePath != "" {
+		certificate, err = os.ReadFile(certificatePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewSigner(key, certificate)
+}
+
+// loadPrivateKey reads the PEM encoded private key at path, in PKCS #8,
+// PKCS #1 or SEC 1 form.
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(p)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM encoded private key", path)
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported private key", path)
+}
+
+// HashedRekord signs dgst, and returns its hashedrekord entry.
+func (s *Signer) HashedRekord(dgst digest.Digest) (*HashedRekord, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+	if dgst.Algorithm() != digest.SHA256 {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", dgst.Algorithm())
+	}
+	hash, err := hexDigest(dgst)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.key.Sign(rand.Reader, hash, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return NewHashedRekord(dgst, signature, s.certificate)
+}
+
+// parseVerifier returns the public key of the PEM encoded certificate or
+// public key p.
+func parseVerifier(p []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(p)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded certificate or public key")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+}
@@ -0,0 +1,327 @@
+package transparency
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// mockRekor is an in-memory Rekor log, serving the entries it records with
+// their inclusion proofs in the current tree.
+type mockRekor struct {
+	mu     sync.Mutex
+	bodies [][]byte
+}
+
+func (m *mockRekor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r.URL.Path != "/api/v1/log/entries" {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var rekord HashedRekord
+		if err := json.NewDecoder(r.Body).Decode(&rekord); err != nil || rekord.Kind != hashedRekordKind {
+			http.Error(w, "invalid entry", http.StatusBadRequest)
+			return
+		}
+		body, err := json.Marshal(rekord)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		m.bodies = append(m.bodies, body)
+		m.writeEntry(w, http.StatusCreated, len(m.bodies)-1)
+	case http.MethodGet:
+		index, err := strconv.Atoi(r.URL.Query().Get("logIndex"))
+		if err != nil || index < 0 || index >= len(m.bodies) {
+			http.NotFound(w, r)
+			return
+		}
+		m.writeEntry(w, http.StatusOK, index)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *mockRekor) writeEntry(w http.ResponseWriter, status, index int) {
+	leaves := make([][]byte, len(m.bodies))
+	for i, body := range m.bodies {
+		leaves[i] = leafHash(body)
+	}
+	proof := &InclusionProof{
+		LogIndex: int64(index),
+		RootHash: hex.EncodeToString(treeHash(leaves)),
+		TreeSize: int64(len(leaves)),
+	}
+	for _, h := range auditPath(index, leaves) {
+		proof.Hashes = append(proof.Hashes, hex.EncodeToString(h))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]LogEntry{
+		fmt.Sprintf("uuid-%d", index): {
+			Body:           m.bodies[index],
+			IntegratedTime: time.Now().Unix(),
+			LogID:          "mock",
+			LogIndex:       int64(index),
+			Verification:   &Verification{InclusionProof: proof},
+		},
+	})
+}
+
+// splitPoint returns the largest power of two smaller than n.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// treeHash returns the Merkle tree hash of leaves, as described by RFC 6962.
+func treeHash(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return nodeHash(treeHash(leaves[:k]), treeHash(leaves[k:]))
+}
+
+// auditPath returns the audit path of the leaf m of leaves, as described by
+// RFC 6962.
+func auditPath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), treeHash(leaves[k:]))
+	}
+	return append(auditPath(m-k, leaves[k:]), treeHash(leaves[:k]))
+}
+
+func TestRootFromInclusionProof(t *testing.T) {
+	for size := 1; size <= 33; size++ {
+		leaves := make([][]byte, size)
+		for i := range leaves {
+			leaves[i] = leafHash([]byte(strconv.Itoa(i)))
+		}
+		root := treeHash(leaves)
+		for index := 0; index < size; index++ {
+			proof := auditPath(index, leaves)
+			computed, err := rootFromInclusionProof(int64(index), int64(size), leaves[index], proof)
+			if err != nil {
+				t.Fatalf("unexpected error verifying leaf %d of %d: %v", index, size, err)
+			}
+			if hex.EncodeToString(computed) != hex.EncodeToString(root) {
+				t.Fatalf("unexpected root of leaf %d of %d", index, size)
+			}
+
+			if size > 1 {
+				if _, err := rootFromInclusionProof(int64(index), int64(size), leaves[index], proof[1:]); err == nil {
+					t.Fatalf("expected an error verifying a truncated proof of leaf %d of %d", index, size)
+				}
+			}
+		}
+	}
+}
+
+func newECDSASigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "registry"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("unexpected error creating certificate: %v", err)
+	}
+	signer, err := NewSigner(key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if err != nil {
+		t.Fatalf("unexpected error creating signer: %v", err)
+	}
+	return signer
+}
+
+func newRSASigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	signer, err := NewSigner(key, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating signer: %v", err)
+	}
+	return signer
+}
+
+func TestUploadAndVerify(t *testing.T) {
+	server := httptest.NewServer(&mockRekor{})
+	defer server.Close()
+	client := NewClient(server.URL, nil)
+	ctx := context.Background()
+
+	signers := []*Signer{newECDSASigner(t), newRSASigner(t)}
+	var (
+		digests []digest.Digest
+		indexes []int64
+	)
+	for i := 0; i < 5; i++ {
+		dgst := digest.FromString(fmt.Sprintf("manifest %d", i))
+		rekord, err := signers[i%len(signers)].HashedRekord(dgst)
+		if err != nil {
+			t.Fatalf("unexpected error signing %s: %v", dgst, err)
+		}
+		entry, err := client.Upload(ctx, rekord)
+		if err != nil {
+			t.Fatalf("unexpected error uploading %s: %v", dgst, err)
+		}
+		if entry.UUID == "" {
+			t.Fatalf("expected the entry of %s to have a UUID", dgst)
+		}
+		if err := Verify(entry, dgst); err != nil {
+			t.Fatalf("unexpected error verifying the uploaded entry of %s: %v", dgst, err)
+		}
+		digests = append(digests, dgst)
+		indexes = append(indexes, entry.LogIndex)
+	}
+
+	// The entries are verified against the tree grown since their upload.
+	for i, dgst := range digests {
+		entry, err := client.GetByIndex(ctx, indexes[i])
+		if err != nil {
+			t.Fatalf("unexpected error getting entry %d: %v", indexes[i], err)
+		}
+		if err := Verify(entry, dgst); err != nil {
+			t.Fatalf("unexpected error verifying entry %d: %v", indexes[i], err)
+		}
+		if err := Verify(entry, digests[(i+1)%len(digests)]); err == nil {
+			t.Fatalf("expected an error verifying entry %d against another digest", indexes[i])
+		}
+	}
+
+	if _, err := client.GetByIndex(ctx, 42); err == nil {
+		t.Fatal("expected an error getting an unknown entry")
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	server := httptest.NewServer(&mockRekor{})
+	defer server.Close()
+	client := NewClient(server.URL, nil)
+	ctx := context.Background()
+	signer := newECDSASigner(t)
+
+	dgst := digest.FromString("manifest")
+	for _, other := range []string{"first", "second", "third"} {
+		rekord, err := signer.HashedRekord(digest.FromString(other))
+		if err != nil {
+			t.Fatalf("unexpected error signing: %v", err)
+		}
+		if _, err := client.Upload(ctx, rekord); err != nil {
+			t.Fatalf("unexpected error uploading: %v", err)
+		}
+	}
+	rekord, err := signer.HashedRekord(dgst)
+	if err != nil {
+		t.Fatalf("unexpected error signing: %v", err)
+	}
+	uploaded, err := client.Upload(ctx, rekord)
+	if err != nil {
+		t.Fatalf("unexpected error uploading: %v", err)
+	}
+
+	getEntry := func() *LogEntry {
+		entry, err := client.GetByIndex(ctx, uploaded.LogIndex)
+		if err != nil {
+			t.Fatalf("unexpected error getting entry: %v", err)
+		}
+		return entry
+	}
+
+	entry := getEntry()
+	entry.Verification.InclusionProof.Hashes[0] = hex.EncodeToString(make([]byte, 32))
+	if err := Verify(entry, dgst); err == nil {
+		t.Fatal("expected an error verifying an entry with a tampered proof")
+	}
+
+	entry = getEntry()
+	entry.Verification = nil
+	if err := Verify(entry, dgst); err == nil {
+		t.Fatal("expected an error verifying an entry without proof")
+	}
+
+	// A signature by another key fails, even when the entry is included.
+	rekord, err = newECDSASigner(t).HashedRekord(dgst)
+	if err != nil {
+		t.Fatalf("unexpected error signing: %v", err)
+	}
+	rekord.Spec.Signature.PublicKey.Content = signer.certificate
+	forged, err := client.Upload(ctx, rekord)
+	if err != nil {
+		t.Fatalf("unexpected error uploading: %v", err)
+	}
+	if err := Verify(forged, dgst); err == nil {
+		t.Fatal("expected an error verifying an entry with an invalid signature")
+	}
+}
+
+func TestNewSignerRejectsInvalidKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	if _, err := NewSigner(key, []byte("not PEM")); err == nil {
+		t.Fatal("expected an error creating a signer with an invalid certificate")
+	}
+	if _, err := NewSigner(key, newECDSASigner(t).certificate); err == nil {
+		t.Fatal("expected an error creating a signer with the certificate of another key")
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	if _, err := NewSigner(edKey, nil); err == nil {
+		t.Fatal("expected an error creating a signer with an ed25519 key")
+	}
+
+	signer, err := NewSigner(key, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating signer: %v", err)
+	}
+	if _, err := signer.HashedRekord(digest.SHA512.FromString("manifest")); err == nil {
+		t.Fatal("expected an error signing a sha512 digest")
+	}
+}
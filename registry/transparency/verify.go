@@ -0,0 +1,152 @@
+package transparency
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Verify verifies that entry records the manifest dgst, signed by the key of
+// the certificate of the entry, and that its inclusion proof proves its
+// inclusion in the log. The signed checkpoint of the proof and the signed
+// entry timestamp are not verified.
+func Verify(entry *LogEntry, dgst digest.Digest) error {
+	rekord, err := decodeBody(entry)
+	if err != nil {
+		return err
+	}
+	hash := rekord.Spec.Data.Hash
+	if hash.Algorithm != string(dgst.Algorithm()) || hash.Value != dgst.Encoded() {
+		return fmt.Errorf("entry %d records %s:%s rather than %s", entry.LogIndex, hash.Algorithm, hash.Value, dgst)
+	}
+	if err := verifySignature(rekord, dgst); err != nil {
+		return fmt.Errorf("entry %d: %v", entry.LogIndex, err)
+	}
+	if err := VerifyInclusion(entry); err != nil {
+		return fmt.Errorf("entry %d: %v", entry.LogIndex, err)
+	}
+	return nil
+}
+
+// verifySignature verifies the signature of dgst recorded by rekord.
+func verifySignature(rekord *HashedRekord, dgst digest.Digest) error {
+	hash, err := hexDigest(dgst)
+	if err != nil {
+		return err
+	}
+	key, err := parseVerifier(rekord.Spec.Signature.PublicKey.Content)
+	if err != nil {
+		return err
+	}
+	signature := rekord.Spec.Signature.Content
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hash, signature) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash, signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// VerifyInclusion verifies the inclusion proof of entry against the root
+// hash of the tree it was computed for.
+func VerifyInclusion(entry *LogEntry) error {
+	if entry.Verification == nil || entry.Verification.InclusionProof == nil {
+		return errors.New("no inclusion proof")
+	}
+	proof := entry.Verification.InclusionProof
+
+	root, err := hex.DecodeString(proof.RootHash)
+	if err != nil {
+		return fmt.Errorf("invalid root hash: %v", err)
+	}
+	hashes := make([][]byte, 0, len(proof.Hashes))
+	for _, h := range proof.Hashes {
+		p, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("invalid hash in inclusion proof: %v", err)
+		}
+		hashes = append(hashes, p)
+	}
+
+	computed, err := rootFromInclusionProof(proof.LogIndex, proof.TreeSize, leafHash(entry.Body), hashes)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(computed, root) {
+		return fmt.Errorf("inclusion proof does not match the root hash %s of the tree of size %d", proof.RootHash, proof.TreeSize)
+	}
+	return nil
+}
+
+// rootFromInclusionProof returns the root hash of the tree of size leaves
+// which the audit path proof proves leaf, at index, to be included in, as
+// described by RFC 9162, section 2.1.3.2.
+func rootFromInclusionProof(index, size int64, leaf []byte, proof [][]byte) ([]byte, error) {
+	if index < 0 || index >= size {
+		return nil, fmt.Errorf("index %d out of the tree of size %d", index, size)
+	}
+
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return nil, errors.New("inclusion proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil, errors.New("inclusion proof too short")
+	}
+	return r, nil
+}
+
+// leafHash returns the hash of the leaf of the tree holding data.
+func leafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// nodeHash returns the hash of the node of the tree with the children of
+// hashes left and right.
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// hexDigest returns the bytes of the hash of dgst.
+func hexDigest(dgst digest.Digest) ([]byte, error) {
+	hash, err := hex.DecodeString(dgst.Encoded())
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest %s: %v", dgst, err)
+	}
+	return hash, nil
+}
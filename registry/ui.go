@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/distribution/distribution/v3/registry/handlers"
+)
+
+const (
+	// defaultUIPrefix is the path the web interface is served under when
+	// none is configured.
+	defaultUIPrefix = "/ui"
+
+	// uiContentSecurityPolicy restricts the web interface to the resources
+	// of the registry, which it reaches through the API.
+	uiContentSecurityPolicy = "default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'"
+)
+
+// uiHandler serves the static files of a web interface from a directory
+// under a path prefix, passing the other requests to the wrapped handler.
+type uiHandler struct {
+	prefix        string
+	root          http.FileSystem
+	indexFallback bool
+	files         http.Handler
+	handler       http.Handler
+}
+
+// ui wraps handler with the serving of the files of dir under prefix. The
+// prefix must not hold the routes of the API, found under apiPrefix. With
+// indexFallback, the paths which are not files are served index.html. The
+// static response headers are added to the responses of the files.
+func ui(prefix, apiPrefix, dir string, indexFallback bool, headers http.Header, handler http.Handler) (http.Handler, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("http.ui.dir is required when the web interface is enabled")
+	}
+	if prefix == "" {
+		prefix = defaultUIPrefix
+	}
+	prefix = path.Clean("/" + prefix)
+	apiRoot := path.Join("/", apiPrefix, "v2")
+	if prefix == "/" || prefix == apiRoot || strings.HasPrefix(prefix, apiRoot+"/") || strings.HasPrefix(apiRoot, prefix+"/") {
+		return nil, fmt.Errorf("http.ui.prefix %s conflicts with the API routes under %s", prefix, apiRoot)
+	}
+
+	h := &uiHandler{
+		prefix:        prefix,
+		root:          http.Dir(dir),
+		indexFallback: indexFallback,
+		handler:       handler,
+	}
+	h.files = handlers.ResponseHeaders(headers, http.HandlerFunc(h.serveFiles))
+	return h, nil
+}
+
+func (h *uiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != h.prefix && !strings.HasPrefix(r.URL.Path, h.prefix+"/") {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	h.files.ServeHTTP(w, r)
+}
+
+// serveFiles serves the files of the web interface.
+func (h *uiHandler) serveFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == h.prefix {
+		http.Redirect(w, r, h.prefix+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", uiContentSecurityPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, h.prefix))
+	f, info, err := h.open(name)
+	if err != nil && h.indexFallback && path.Ext(name) == "" {
+		f, info, err = h.open("/index.html")
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	// The index refers to the other files, which may change along with it.
+	if info.Name() == "index.html" {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// open opens the file name of the web interface, or the index of the
+// directory name. Directories are not listed.
+func (h *uiHandler) open(name string) (http.File, fs.FileInfo, error) {
+	f, err := h.root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		if path.Base(name) == "index.html" {
+			return nil, nil, fs.ErrNotExist
+		}
+		return h.open(path.Join(name, "index.html"))
+	}
+	return f, info, nil
+}
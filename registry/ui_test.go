@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUI(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":      "<html>index</html>",
+		"app.js":          "console.log('app')",
+		"assets/logo.svg": "<svg/>",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, tc := range []struct {
+		name          string
+		indexFallback bool
+		method        string
+		path          string
+		status        int
+		body          string
+		cacheControl  string
+	}{
+		{name: "prefix", path: "/ui", status: http.StatusMovedPermanently},
+		{name: "index", path: "/ui/", status: http.StatusOK, body: "<html>index</html>", cacheControl: "no-cache"},
+		{name: "file", path: "/ui/app.js", status: http.StatusOK, body: "console.log('app')", cacheControl: "public, max-age=3600"},
+		{name: "nested file", path: "/ui/assets/logo.svg", status: http.StatusOK, body: "<svg/>", cacheControl: "public, max-age=3600"},
+		{name: "missing file", path: "/ui/missing.js", status: http.StatusNotFound},
+		{name: "directory without index", path: "/ui/assets/", status: http.StatusNotFound},
+		{name: "client route", path: "/ui/repositories/foo", status: http.StatusNotFound},
+		{name: "client route with fallback", indexFallback: true, path: "/ui/repositories/foo", status: http.StatusOK, body: "<html>index</html>", cacheControl: "no-cache"},
+		{name: "missing file with fallback", indexFallback: true, path: "/ui/missing.js", status: http.StatusNotFound},
+		{name: "escaping the directory", path: "/ui/../../etc/passwd", status: http.StatusNotFound},
+		{name: "method", method: http.MethodPost, path: "/ui/", status: http.StatusMethodNotAllowed},
+		{name: "api", path: "/v2/", status: http.StatusTeapot},
+		{name: "other prefix", path: "/uix/app.js", status: http.StatusTeapot},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, err := ui("/ui", "", dir, tc.indexFallback, http.Header{"X-Frame-Options": {"DENY"}}, api)
+			if err != nil {
+				t.Fatal(err)
+			}
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tc.path, nil)
+			// Keep the path as requested, as a client may send it.
+			req.URL.Path = tc.path
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			resp := rec.Result()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("unexpected status %d, expected %d", resp.StatusCode, tc.status)
+			}
+			if tc.body == "" {
+				return
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tc.body {
+				t.Fatalf("unexpected body %q, expected %q", body, tc.body)
+			}
+			if cacheControl := resp.Header.Get("Cache-Control"); cacheControl != tc.cacheControl {
+				t.Fatalf("unexpected Cache-Control %q, expected %q", cacheControl, tc.cacheControl)
+			}
+			if csp := resp.Header.Get("Content-Security-Policy"); csp != uiContentSecurityPolicy {
+				t.Fatalf("unexpected Content-Security-Policy %q", csp)
+			}
+			if frameOptions := resp.Header.Get("X-Frame-Options"); frameOptions != "DENY" {
+				t.Fatalf("unexpected X-Frame-Options %q", frameOptions)
+			}
+		})
+	}
+}
+
+func TestUIPrefixConflicts(t *testing.T) {
+	api := http.NotFoundHandler()
+	for _, tc := range []struct {
+		prefix    string
+		apiPrefix string
+	}{
+		{"/", ""},
+		{"/v2", ""},
+		{"/v2/ui", ""},
+		{"/registry", "/registry/"},
+		{"/registry/v2/ui", "/registry"},
+	} {
+		if _, err := ui(tc.prefix, tc.apiPrefix, t.TempDir(), false, nil, api); err == nil {
+			t.Errorf("expected prefix %s to conflict with the API under %s", tc.prefix, tc.apiPrefix)
+		}
+	}
+	if _, err := ui("/registry/ui", "/registry", t.TempDir(), false, nil, api); err != nil {
+		t.Errorf("unexpected error serving the web interface beside the API: %v", err)
+	}
+	if _, err := ui("", "", "", false, nil, api); err == nil {
+		t.Error("expected an error serving the web interface without a directory")
+	}
+}
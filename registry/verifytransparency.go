@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	dcontext "github.com/distribution/distribution/v3/context"
+	"github.com/distribution/distribution/v3/reference"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/distribution/v3/registry/transparency"
+	"github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+var verifyTransparencyRekorURL string
+
+func init() {
+	VerifyTransparencyCmd.Flags().StringVar(&verifyTransparencyRekorURL, "rekor-url", "", "URL of the Rekor instance; defaults to the one the manifest was recorded in")
+}
+
+// VerifyTransparencyCmd is the cobra command that corresponds to the
+// verify-transparency subcommand
+var VerifyTransparencyCmd = &cobra.Command{
+	Use:   "verify-transparency [--rekor-url <url>] <ref> [<config>]",
+	Short: "`verify-transparency` verifies the inclusion of a manifest in the transparency log",
+	Long: "`verify-transparency` fetches the entry of the manifest referenced by <ref>, by tag or digest, from the transparency log\n" +
+		"the registry recorded it in, and verifies that it records the manifest and its inclusion proof.",
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v\n", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ref, err := reference.Parse(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid reference %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		named, ok := ref.(reference.Named)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s: reference must name a repository\n", args[0])
+			os.Exit(1)
+		}
+
+		var dgst digest.Digest
+		switch ref := ref.(type) {
+		case reference.Canonical:
+			dgst = ref.Digest()
+		case reference.Tagged:
+			registry, err := storage.NewRegistry(ctx, driver)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to construct registry: %v\n", err)
+				os.Exit(1)
+			}
+			repo, err := registry.Repository(ctx, reference.TrimNamed(named))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to open repository %s: %v\n", named.Name(), err)
+				os.Exit(1)
+			}
+			desc, err := repo.Tags(ctx).Get(ctx, ref.Tag())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to resolve %s: %v\n", args[0], err)
+				os.Exit(1)
+			}
+			dgst = desc.Digest
+		default:
+			fmt.Fprintf(os.Stderr, "%s: reference must be tagged or referenced by digest\n", args[0])
+			os.Exit(1)
+		}
+
+		record, err := storage.GetTransparencyRecord(ctx, driver, named.Name(), dgst)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read the transparency record of %s: %v\n", dgst, err)
+			os.Exit(1)
+		}
+		if record == nil {
+			fmt.Fprintf(os.Stderr, "manifest %s was not recorded in a transparency log\n", dgst)
+			os.Exit(1)
+		}
+
+		rekorURL := record.RekorURL
+		if verifyTransparencyRekorURL != "" {
+			rekorURL = verifyTransparencyRekorURL
+		}
+		client := transparency.NewClient(rekorURL, &http.Client{Timeout: 30 * time.Second})
+		entry, err := client.GetByIndex(ctx, record.LogIndex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get entry %d from %s: %v\n", record.LogIndex, rekorURL, err)
+			os.Exit(1)
+		}
+		if err := transparency.Verify(entry, dgst); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to verify manifest %s: %v\n", dgst, err)
+			os.Exit(1)
+		}
+
+		proof := entry.Verification.InclusionProof
+		fmt.Printf("manifest %s is included in the transparency log at %s, entry %d, tree size %d\n",
+			dgst, rekorURL, entry.LogIndex, proof.TreeSize)
+	},
+}
@@ -2,6 +2,8 @@ package distribution
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 )
@@ -14,18 +16,116 @@ type TagService interface {
 	// as an ErrTagUntrusted error, with the target descriptor.
 	Get(ctx context.Context, tag string) (Descriptor, error)
 
+	// Exists reports whether the tag exists.
+	Exists(ctx context.Context, tag string) (bool, error)
+
 	// Tag associates the tag with the provided descriptor, updating the
-	// current association, if needed.
-	Tag(ctx context.Context, tag string, desc Descriptor) error
+	// current association, if needed. The implementations recording the
+	// metadata of tags record the options set by opts.
+	Tag(ctx context.Context, tag string, desc Descriptor, opts ...TagOption) error
 
 	// Untag removes the given tag association
 	Untag(ctx context.Context, tag string) error
 
-	// All returns the set of tags managed by this tag service
+	// Rename renames the tag src to dst, without a moment where both or
+	// neither of the tags exist. If dst already exists, ErrTagConflict is
+	// returned: callers overwrite dst by untagging it first.
+	Rename(ctx context.Context, src, dst string) error
+
+	// All returns the set of tags managed by this tag service, in lexical
+	// order whatever the order the backend lists them in, such that callers
+	// may search them and page through them.
 	All(ctx context.Context) ([]string, error)
 
+	// AllPaged returns the tags managed by this tag service which sort
+	// lexically after last, up to count of them, in lexical order. An empty
+	// last starts from the first tag, and a negative count places no limit
+	// on the number of tags returned.
+	AllPaged(ctx context.Context, last string, count int) ([]string, error)
+
 	// Lookup returns the set of tags referencing the given digest.
-	Lookup(ctx context.Context, digest Descriptor) ([]string, error)
+	Lookup(ctx context.Context, digest Descriptor, opts ...LookupOption) ([]string, error)
+
+	// History returns the descriptors the tag pointed to, oldest first,
+	// including the current one. The implementations keeping no history
+	// return the current descriptor.
+	History(ctx context.Context, tag string) ([]Descriptor, error)
+}
+
+// DefaultLookupConcurrency is the number of tags resolved concurrently by
+// Lookup, unless set with WithConcurrency.
+const DefaultLookupConcurrency = 10
+
+// LookupOptions configures TagService.Lookup.
+type LookupOptions struct {
+	// Concurrency is the number of tags resolved concurrently by the
+	// implementations resolving the tags one by one.
+	Concurrency int
+}
+
+// LookupOption is a function argument for TagService.Lookup.
+type LookupOption func(*LookupOptions)
+
+// WithConcurrency sets the number of tags resolved concurrently by Lookup.
+// Values lower than 1 resolve the tags one at a time.
+func WithConcurrency(n int) LookupOption {
+	return func(o *LookupOptions) {
+		o.Concurrency = n
+	}
+}
+
+// NewLookupOptions returns the options of Lookup set by opts.
+func NewLookupOptions(opts ...LookupOption) LookupOptions {
+	o := LookupOptions{Concurrency: DefaultLookupConcurrency}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	return o
+}
+
+// TagOptions configures TagService.Tag.
+type TagOptions struct {
+	// Actor is the identity of the user tagging, if known.
+	Actor string
+}
+
+// TagOption is a function argument for TagService.Tag.
+type TagOption func(*TagOptions)
+
+// WithActor sets the identity of the user tagging.
+func WithActor(actor string) TagOption {
+	return func(o *TagOptions) {
+		o.Actor = actor
+	}
+}
+
+// NewTagOptions returns the options of Tag set by opts.
+func NewTagOptions(opts ...TagOption) TagOptions {
+	var o TagOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// TagMetadata is the metadata recorded when tagging.
+type TagMetadata struct {
+	// Created is the time the tag was pointed to its current manifest.
+	Created time.Time `json:"created"`
+
+	// Actor is the identity of the user tagging, if known.
+	Actor string `json:"actor,omitempty"`
+}
+
+// TagMetadataProvider provides the metadata of tags.
+type TagMetadataProvider interface {
+	// GetMetadata returns the metadata recorded when tag was pointed to its
+	// current manifest. The metadata of tags tagged before it was recorded
+	// is the zero TagMetadata.
+	GetMetadata(ctx context.Context, tag string) (TagMetadata, error)
 }
 
 // TagManifestsProvider provides method to retrieve the digests of manifests that a tag historically
@@ -35,3 +135,70 @@ type TagManifestsProvider interface {
 	// includes currently linked digest. There is no ordering guaranteed
 	ManifestDigests(ctx context.Context, tag string) ([]digest.Digest, error)
 }
+
+// TagAliaser provides methods to create and list aliases of tags.
+type TagAliaser interface {
+	// CreateAlias tags the manifest of srcTag with aliasTag, an alias of
+	// srcTag until it is tagged again.
+	CreateAlias(ctx context.Context, srcTag, aliasTag string) error
+
+	// Aliases returns the aliases, mapped to the tags they alias.
+	Aliases(ctx context.Context) (map[string]string, error)
+}
+
+// AdvancedTagService is a TagService which also copies tags.
+type AdvancedTagService interface {
+	TagService
+
+	// Copy tags the manifest of srcTag in src with dstTag, after linking
+	// the manifest and its blobs into this repository.
+	Copy(ctx context.Context, src Repository, srcTag string, dstTag string) error
+}
+
+// BatchTagService is a TagService which also removes tags in bulk.
+type BatchTagService interface {
+	TagService
+
+	// UntagBatch removes the tags and returns the number removed. The
+	// errors, if any, are at the index of their tag.
+	UntagBatch(ctx context.Context, tags []string) (int, []error)
+}
+
+// StreamingTagService is a TagService which also streams the results of
+// Lookup.
+type StreamingTagService interface {
+	TagService
+
+	// LookupStream sends the tags referencing the given digest as they are
+	// found. Both channels are closed when done, after at most one error.
+	LookupStream(ctx context.Context, desc Descriptor, opts ...LookupOption) (<-chan string, <-chan error)
+}
+
+// LookupStreamToSlice looks up the tags referencing desc with the
+// LookupStream of ts, and returns them in lexical order once all are found,
+// as Lookup does.
+func LookupStreamToSlice(ctx context.Context, ts StreamingTagService, desc Descriptor, opts ...LookupOption) ([]string, error) {
+	found, errs := ts.LookupStream(ctx, desc, opts...)
+	var tags []string
+	for tag := range found {
+		tags = append(tags, tag)
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// PageTags returns the tags of the sorted slice tags which sort lexically
+// after last, up to count of them. An empty last starts from the first tag,
+// and a negative count places no limit on the number of tags returned.
+func PageTags(tags []string, last string, count int) []string {
+	if last != "" {
+		tags = tags[sort.Search(len(tags), func(i int) bool { return tags[i] > last }):]
+	}
+	if count >= 0 && count < len(tags) {
+		tags = tags[:count]
+	}
+	return tags
+}